@@ -0,0 +1,46 @@
+package main
+
+import (
+	"chatgogo/backend/internal/storage"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// runRevertBan reverts the ban with the given ID, restoring the user's previous ban state,
+// and returns the exit code. The ban stays in the user's sanction history, marked as
+// reverted. Like the doctor mode, it does not run migrations.
+func runRevertBan(ref string) int {
+	banID, err := strconv.ParseUint(ref, 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid ban ID %q\n", ref)
+		return 2
+	}
+
+	db, err := gorm.Open(postgres.Open(postgresDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect PostgreSQL: %v\n", err)
+		return 1
+	}
+	rdb := redis.NewUniversalClient(redisOptions())
+	defer rdb.Close()
+
+	s := storage.NewStorageService(db, rdb)
+	ban, err := s.RevertBan(uint(banID))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to revert ban #%d: %v\n", banID, err)
+		return 1
+	}
+	banned, err := s.IsUserBanned(ban.UserID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reverted ban #%d, but failed to check user %s: %v\n", ban.ID, ban.UserID, err)
+		return 1
+	}
+	fmt.Printf("Reverted ban #%d of user %s. Banned now: %t\n", ban.ID, ban.UserID, banned)
+	return 0
+}
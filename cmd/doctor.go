@@ -0,0 +1,65 @@
+package main
+
+import (
+	"chatgogo/backend/internal/doctor"
+	"chatgogo/backend/internal/localization"
+	"chatgogo/backend/internal/migrations"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// doctorTimeout bounds each network check of the doctor mode.
+const doctorTimeout = 5 * time.Second
+
+// runDoctor checks the environment, the database schema, Redis, the bot token and the
+// locale catalogs, prints a report to stdout and returns the exit code: 1 if any check
+// failed. Unlike a normal start, it neither retries connections nor runs migrations.
+func runDoctor() int {
+	report := &doctor.Report{}
+	report.Add(doctor.CheckEnvironment(os.Getenv)...)
+
+	db, err := gorm.Open(postgres.Open(fmt.Sprintf("%s connect_timeout=%d", postgresDSN(), int(doctorTimeout.Seconds()))), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		report.Add(doctor.Result{Check: "database", Status: doctor.StatusFail, Detail: fmt.Sprintf("unreachable: %v", err)})
+	} else {
+		report.Add(doctor.CheckDatabase(db, migratedModels...)...)
+		report.Add(doctor.CheckMigrations(migrations.New(db)))
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+
+	redisOpts := redisOptions()
+	redisOpts.MaxRetries = -1
+	rdb := redis.NewUniversalClient(redisOpts)
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	report.Add(doctor.CheckRedis(ctx, rdb, describeRedis(redisOpts)))
+	cancel()
+	rdb.Close()
+
+	report.Add(doctor.CheckBotToken(os.Getenv("TELEGRAM_BOT_TOKEN"), tgbotapi.APIEndpoint))
+
+	localizer, err := localization.NewLocalizer(localization.DefaultDir)
+	if err != nil {
+		report.Add(doctor.Result{Check: "locales", Status: doctor.StatusFail, Detail: err.Error()})
+	} else {
+		report.Add(doctor.CheckLocales(localizer, "en")...)
+	}
+
+	if err := report.Write(os.Stdout); err != nil {
+		log.Printf("Failed to write doctor report: %v", err)
+	}
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
@@ -2,20 +2,36 @@
 package main
 
 import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/anonymize"
 	"chatgogo/backend/internal/api/handler"
+	"chatgogo/backend/internal/archive"
 	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/config"
+	"chatgogo/backend/internal/escalation"
+	"chatgogo/backend/internal/events"
+	"chatgogo/backend/internal/features"
+	"chatgogo/backend/internal/media"
+	"chatgogo/backend/internal/metrics"
 	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/scheduler"
 	"chatgogo/backend/internal/storage"
 	"chatgogo/backend/internal/telegram"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
@@ -25,24 +41,105 @@ import (
 const (
 	maxRetries   = 5
 	initialDelay = 2 * time.Second
+	// shutdownTimeout bounds the graceful shutdown on SIGTERM or SIGINT.
+	shutdownTimeout = 15 * time.Second
 )
 
+// migratedModels are the models whose tables the migrations in internal/migrations create;
+// the doctor mode checks that the database has their columns.
+var migratedModels = []any{&models.ChatRoom{}, &models.User{}, &models.Complaint{}, &models.ChatHistory{}, &models.Ban{}, &models.OutboxMessage{}}
+
+// postgresDSN builds the PostgreSQL connection string from the DB_* environment variables.
+func postgresDSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
+}
+
+// useReadReplica sends the heavy reads of the storage to the read replica named by
+// DB_REPLICA_DSN, if it is set. If the replica cannot be reached, they stay on the primary.
+func useReadReplica(db *gorm.DB) {
+	dsn := os.Getenv("DB_REPLICA_DSN")
+	if dsn == "" {
+		return
+	}
+	if err := storage.UseReadReplica(db, dsn); err != nil {
+		log.Printf("Warning: Failed to connect the PostgreSQL read replica: %v. Reading from the primary.", err)
+		return
+	}
+	log.Println("PostgreSQL read replica connection established.")
+}
+
+// queryLogger returns the GORM logger of the application's database, which records the storage
+// metrics and logs queries slower than DB_SLOW_QUERY_THRESHOLD.
+func queryLogger() *storage.QueryLogger {
+	threshold := storage.DefaultSlowQueryThreshold
+	if v := os.Getenv("DB_SLOW_QUERY_THRESHOLD"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Printf("Warning: Invalid DB_SLOW_QUERY_THRESHOLD value '%s'. Using %v.", v, threshold)
+		} else {
+			threshold = parsed
+		}
+	}
+	return storage.NewQueryLogger(threshold)
+}
+
+// redisOptions builds the Redis client options from the REDIS_* environment variables. The
+// client connects to the server at REDIS_HOST:REDIS_PORT, or to those listed in REDIS_ADDRS:
+// with REDIS_SENTINEL_MASTER they are Sentinels, which name the current master of that name,
+// and otherwise, if there are several or REDIS_CLUSTER is true, nodes of a Redis Cluster.
+func redisOptions() *redis.UniversalOptions {
+	redisDB := 0
+	if redisDBStr := os.Getenv("REDIS_DB"); redisDBStr != "" {
+		var parseErr error
+		redisDB, parseErr = strconv.Atoi(redisDBStr)
+		if parseErr != nil {
+			log.Printf("Warning: Invalid REDIS_DB value '%s'. Using default DB 0.", redisDBStr)
+			redisDB = 0
+		}
+	}
+	addrs := []string{fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))}
+	if v := os.Getenv("REDIS_ADDRS"); v != "" {
+		addrs = nil
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return &redis.UniversalOptions{
+		Addrs:            addrs,
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		DB:               redisDB,
+		MasterName:       os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		IsClusterMode:    os.Getenv("REDIS_CLUSTER") == "true",
+	}
+}
+
+// describeRedis describes the Redis deployment the options connect to, for logs.
+func describeRedis(opts *redis.UniversalOptions) string {
+	addrs := strings.Join(opts.Addrs, ", ")
+	switch {
+	case opts.MasterName != "":
+		return fmt.Sprintf("master %s of the Sentinels at %s", opts.MasterName, addrs)
+	case len(opts.Addrs) > 1 || opts.IsClusterMode:
+		return "the Redis Cluster at " + addrs
+	}
+	return addrs
+}
+
 // setupDependencies initializes and configures the application's dependencies,
 // such as the database and Redis connections. It also runs database migrations.
-func setupDependencies() (*gorm.DB, *redis.Client) {
+func setupDependencies() (*gorm.DB, redis.UniversalClient) {
 	log.Println("Initializing PostgreSQL connection...")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		dbHost, dbUser, dbPassword, dbName, dbPort)
+	dsn := postgresDSN()
 
 	var db *gorm.DB
 	var err error
+	queries := queryLogger()
 	for i := 0; i < maxRetries; i++ {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: queries})
 		if err == nil {
 			log.Println("PostgreSQL connection established.")
 			break
@@ -54,37 +151,48 @@ func setupDependencies() (*gorm.DB, *redis.Client) {
 		time.Sleep(initialDelay)
 	}
 
+	useReadReplica(db)
+
 	log.Println("Initializing Redis connection...")
-	redisAddr := fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-	redisDBStr := os.Getenv("REDIS_DB")
-	redisDB := 0
-	if redisDBStr != "" {
-		var parseErr error
-		redisDB, parseErr = strconv.Atoi(redisDBStr)
-		if parseErr != nil {
-			log.Printf("Warning: Invalid REDIS_DB value '%s'. Using default DB 0.", redisDBStr)
-			redisDB = 0
-		}
-	}
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword,
-		DB:       redisDB,
-	})
+	redisOpts := redisOptions()
+	rdb := redis.NewUniversalClient(redisOpts)
 
 	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
-		log.Fatalf("Failed to connect Redis at %s: %v", redisAddr, err)
+		log.Fatalf("Failed to connect Redis at %s: %v", describeRedis(redisOpts), err)
+	}
+	if _, ok := rdb.(*redis.ClusterClient); ok && redisOpts.DB != 0 {
+		log.Printf("Warning: REDIS_DB is not supported by Redis Cluster. Using DB 0.")
 	}
 
-	if err := db.AutoMigrate(&models.ChatRoom{}, &models.User{}, &models.Complaint{}, &models.ChatHistory{}); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if err := migrateOnStart(db); err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
 	}
 
 	log.Println("Database and Redis connections established, migrations complete.")
 	return db, rdb
 }
 
+// newStorage returns the storage of the message transport set by MESSAGE_TRANSPORT.
+func newStorage(db *gorm.DB, rdb redis.UniversalClient) storage.Storage {
+	switch transport := os.Getenv("MESSAGE_TRANSPORT"); transport {
+	case "streams":
+		if _, ok := rdb.(*redis.ClusterClient); ok {
+			log.Fatal("MESSAGE_TRANSPORT=streams is not supported with Redis Cluster, as rooms are read from several streams at once. Use pubsub.")
+		}
+		consumer := os.Getenv("MESSAGE_STREAM_CONSUMER")
+		if consumer == "" {
+			log.Fatal("MESSAGE_TRANSPORT=streams requires MESSAGE_STREAM_CONSUMER, a name of this instance that stays the same across restarts.")
+		}
+		log.Printf("Relaying room messages over Redis Streams as consumer %s.", consumer)
+		return storage.NewStreamStorageService(db, rdb, consumer)
+	default:
+		if transport != "" && transport != "pubsub" {
+			log.Printf("Warning: Invalid MESSAGE_TRANSPORT value '%s'. Using pubsub.", transport)
+		}
+		return storage.NewStorageService(db, rdb)
+	}
+}
+
 // main is the application's entry point.
 func main() {
 	log.Println("Starting ChatGoGo Backend...")
@@ -92,11 +200,296 @@ func main() {
 		log.Println("Warning: Error loading .env file")
 	}
 
-	db, rdb := setupDependencies()
-	s := storage.NewStorageService(db, rdb)
+	doctorMode := flag.Bool("doctor", false, "check the configuration and dependencies, print a report and exit")
+	riskUser := flag.String("risk-profile", "", "print the risk profile of a user (anonymous or Telegram ID) and exit")
+	revertBan := flag.String("revert-ban", "", "revert the ban with the given ID, keeping it in the user's sanction history, and exit")
+	migrate := flag.String("migrate", "", "run a schema migration command (status, up or down) and exit")
+	demoMode := flag.Bool("demo", false, "keep all data in memory instead of PostgreSQL and Redis, for a demo; nothing is kept after exit")
+	flag.Parse()
+	if *doctorMode {
+		os.Exit(runDoctor())
+	}
+	if *riskUser != "" {
+		os.Exit(runRiskProfile(*riskUser))
+	}
+	if *revertBan != "" {
+		os.Exit(runRevertBan(*revertBan))
+	}
+	if *migrate != "" {
+		os.Exit(runMigrate(*migrate))
+	}
+
+	var s storage.Storage
+	if *demoMode {
+		log.Println("Demo mode: keeping all data in memory instead of PostgreSQL and Redis. Nothing is kept after exit.")
+		s = storage.NewMemoryStorage()
+	} else {
+		s = newStorage(setupDependencies())
+	}
 
 	hub := chathub.NewManagerService(s)
+	if key := os.Getenv("ANONYMIZATION_KEY"); key != "" {
+		hub.Anonymizer = anonymize.NewHMAC([]byte(key))
+	} else {
+		log.Println("Warning: ANONYMIZATION_KEY is not set. Pseudonyms in exports, analytics and the admin API change on every restart.")
+	}
+	if v := os.Getenv("HUB_CHANNEL_BUFFER"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: Invalid HUB_CHANNEL_BUFFER value '%s'. Using %d.", v, chathub.DefaultChannelBuffer)
+		} else {
+			hub.SetChannelBuffer(size)
+		}
+	}
+	if v := os.Getenv("MATCHER_REQUEST_QUEUE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: Invalid MATCHER_REQUEST_QUEUE_SIZE value '%s'. Using %d.", v, chathub.DefaultMatchRequestCapacity)
+		} else {
+			hub.MatchRequestCh = make(chan models.SearchRequest, size)
+		}
+	}
 	matcher := chathub.NewMatcherService(hub, s)
+	matcher.ReputationTiers = config.ReputationTiersFromEnv()
+	if v := os.Getenv("MATCHER_MIN_INTEREST_OVERLAP"); v != "" {
+		minOverlap, err := strconv.Atoi(v)
+		if err != nil || minOverlap < 0 {
+			log.Printf("Warning: Invalid MATCHER_MIN_INTEREST_OVERLAP value '%s'. Using 0.", v)
+		} else {
+			matcher.MinInterestOverlap = minOverlap
+		}
+	}
+	if v := os.Getenv("MATCHER_SEARCH_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			log.Printf("Warning: Invalid MATCHER_SEARCH_TIMEOUT value '%s'. Using %v.", v, chathub.DefaultSearchTimeout)
+		} else {
+			matcher.SearchTimeout = timeout
+		}
+	}
+	if v := os.Getenv("MATCHER_SCAN_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			log.Printf("Warning: Invalid MATCHER_SCAN_INTERVAL value '%s'. Using %v.", v, chathub.DefaultMatchScanInterval)
+		} else {
+			matcher.MatchScanInterval = interval
+		}
+	}
+	if v := os.Getenv("MATCHER_REMATCH_COOLDOWN"); v != "" {
+		cooldown, err := time.ParseDuration(v)
+		if err != nil || cooldown < 0 {
+			log.Printf("Warning: Invalid MATCHER_REMATCH_COOLDOWN value '%s'. Using %v.", v, chathub.DefaultRematchCooldown)
+		} else {
+			hub.RematchCooldown = cooldown
+		}
+	}
+	if v := os.Getenv("MATCHER_SAME_PAIR_COOLDOWN"); v != "" {
+		cooldown, err := time.ParseDuration(v)
+		if err != nil || cooldown < 0 {
+			log.Printf("Warning: Invalid MATCHER_SAME_PAIR_COOLDOWN value '%s'. Using %v.", v, chathub.DefaultSamePairCooldown)
+		} else {
+			hub.SamePairCooldown = cooldown
+		}
+	}
+	if v := os.Getenv("MATCHER_RELAX_AFTER"); v != "" {
+		relaxAfter, err := time.ParseDuration(v)
+		if err != nil || relaxAfter < 0 {
+			log.Printf("Warning: Invalid MATCHER_RELAX_AFTER value '%s'. Using %v.", v, chathub.DefaultRelaxAfter)
+		} else {
+			matcher.RelaxAfter = relaxAfter
+		}
+	}
+	hub.RequeueAbandonedPartner = os.Getenv("MATCHER_REQUEUE_ON_NEXT") == "true"
+	if v := os.Getenv("MATCHER_SKIP_LIMIT"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			log.Printf("Warning: Invalid MATCHER_SKIP_LIMIT value '%s'. Using %d.", v, chathub.DefaultSkipLimit)
+		} else {
+			hub.SkipLimit = limit
+		}
+	}
+	if v := os.Getenv("MATCHER_SKIP_COOLDOWN"); v != "" {
+		cooldown, err := time.ParseDuration(v)
+		if err != nil || cooldown <= 0 {
+			log.Printf("Warning: Invalid MATCHER_SKIP_COOLDOWN value '%s'. Using %v.", v, chathub.DefaultSkipCooldown)
+		} else {
+			hub.SkipCooldown = cooldown
+		}
+	}
+	if v := os.Getenv("MATCHER_FLOOD_MIN_DEMAND"); v != "" {
+		demand, err := strconv.Atoi(v)
+		if err != nil || demand < 0 {
+			log.Printf("Warning: Invalid MATCHER_FLOOD_MIN_DEMAND value '%s'. Using %d.", v, chathub.DefaultFloodMinDemand)
+		} else {
+			matcher.FloodMinDemand = demand
+		}
+	}
+	if v := os.Getenv("MATCHER_FLOODED_SEARCH_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			log.Printf("Warning: Invalid MATCHER_FLOODED_SEARCH_TIMEOUT value '%s'. Using %v.", v, chathub.DefaultFloodedSearchTimeout)
+		} else {
+			matcher.FloodedSearchTimeout = timeout
+		}
+	}
+	if v := os.Getenv("WS_DISCONNECT_GRACE"); v != "" {
+		grace, err := time.ParseDuration(v)
+		if err != nil || grace < 0 {
+			log.Printf("Warning: Invalid WS_DISCONNECT_GRACE value '%s'. Using %v.", v, chathub.DefaultDisconnectGrace)
+		} else {
+			hub.DisconnectGrace = grace
+		}
+	}
+	if v := os.Getenv("PRESENCE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Printf("Warning: Invalid PRESENCE_TTL value '%s'. Using %v.", v, chathub.DefaultPresenceTTL)
+		} else {
+			hub.PresenceTTL = ttl
+		}
+	}
+	if v := os.Getenv("OFFLINE_MESSAGE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Printf("Warning: Invalid OFFLINE_MESSAGE_TTL value '%s'. Using %v.", v, chathub.DefaultOfflineMessageTTL)
+		} else {
+			hub.OfflineMessageTTL = ttl
+		}
+	}
+	if v := os.Getenv("DEAD_CLIENT_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			log.Printf("Warning: Invalid DEAD_CLIENT_TIMEOUT value '%s'. Using %v.", v, chathub.DefaultDeadClientTimeout)
+		} else {
+			hub.DeadClientTimeout = timeout
+		}
+	}
+	if v := os.Getenv("MESSAGE_RATE_LIMIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 {
+			log.Printf("Warning: Invalid MESSAGE_RATE_LIMIT value '%s'. Using %v.", v, chathub.DefaultMessageRate)
+		} else {
+			hub.MessageRate = rate
+		}
+	}
+	if v := os.Getenv("MESSAGE_BURST"); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil || burst < 0 {
+			log.Printf("Warning: Invalid MESSAGE_BURST value '%s'. Using %d.", v, chathub.DefaultMessageBurst)
+		} else {
+			hub.MessageBurst = burst
+		}
+	}
+	if os.Getenv("MESSAGE_BATCH_WRITES") == "true" {
+		hub.Writer = chathub.NewMessageWriter(s)
+		if v := os.Getenv("MESSAGE_BATCH_INTERVAL"); v != "" {
+			interval, err := time.ParseDuration(v)
+			if err != nil || interval <= 0 {
+				log.Printf("Warning: Invalid MESSAGE_BATCH_INTERVAL value '%s'. Using %v.", v, chathub.DefaultMessageFlushInterval)
+			} else {
+				hub.Writer.FlushInterval = interval
+			}
+		}
+		log.Printf("Batched message writes enabled, flushing every %v.", hub.Writer.FlushInterval)
+	}
+	if v := os.Getenv("COMMAND_ABUSE_THRESHOLDS"); v != "" {
+		thresholds, err := chathub.ParseCommandAbuseThresholds(v)
+		if err != nil {
+			log.Printf("Warning: Invalid COMMAND_ABUSE_THRESHOLDS value '%s' (%v). Using %v.", v, err, chathub.DefaultCommandAbuseThresholds)
+		} else {
+			hub.CommandAbuseThresholds = thresholds
+		}
+	}
+	hostname, _ := os.Hostname()
+	instanceID := fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8])
+	if os.Getenv("MATCHER_LEADER_ELECTION") == "true" {
+		matcher.InstanceID = instanceID
+		log.Printf("Matcher leader election enabled, instance ID %s.", matcher.InstanceID)
+	}
+	if os.Getenv("CLIENT_REGISTRY") == "true" {
+		hub.InstanceID = instanceID
+		log.Printf("Client registry enabled, instance ID %s.", hub.InstanceID)
+	}
+	if v := os.Getenv("MATCHER_LEADER_LEASE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			log.Printf("Warning: Invalid MATCHER_LEADER_LEASE_TTL value '%s'. Using %v.", v, chathub.DefaultLeaderLeaseTTL)
+		} else {
+			matcher.LeaderLeaseTTL = ttl
+		}
+	}
+	queueJanitor := chathub.NewQueueJanitor(s)
+	if v := os.Getenv("SEARCH_QUEUE_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil || maxAge < 0 {
+			log.Printf("Warning: Invalid SEARCH_QUEUE_MAX_AGE value '%s'. Using %v.", v, chathub.DefaultQueueEntryMaxAge)
+		} else {
+			queueJanitor.MaxAge = maxAge
+		}
+	}
+	if queueJanitor.MaxAge > 0 && matcher.SearchTimeout > 0 && queueJanitor.MaxAge <= matcher.SearchTimeout {
+		log.Printf("Warning: SEARCH_QUEUE_MAX_AGE (%v) is not longer than MATCHER_SEARCH_TIMEOUT (%v); searching users may be dropped from the queue.", queueJanitor.MaxAge, matcher.SearchTimeout)
+	}
+	idleRoomSweeper := chathub.NewIdleRoomSweeper(s)
+	if v := os.Getenv("ROOM_IDLE_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			log.Printf("Warning: Invalid ROOM_IDLE_TIMEOUT value '%s'. Using %v.", v, chathub.DefaultRoomIdleTimeout)
+		} else {
+			idleRoomSweeper.MaxIdle = timeout
+		}
+	}
+	if idleRoomSweeper.MaxIdle > 0 {
+		idleRoomSweeper.TrackActiveRooms()
+	}
+	qualityScorer := chathub.NewQualityScorer(s)
+	historyRetention := chathub.NewHistoryRetention(s)
+	if v := os.Getenv("HISTORY_RETENTION"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil || maxAge < 0 {
+			log.Printf("Warning: Invalid HISTORY_RETENTION value '%s'. Using %v.", v, time.Duration(0))
+		} else {
+			historyRetention.MaxAge = maxAge
+		}
+	}
+	var roomArchiver *archive.Archiver
+	if bucket := os.Getenv("ARCHIVE_S3_BUCKET"); bucket != "" {
+		store := &media.S3Store{
+			Endpoint:  os.Getenv("ARCHIVE_S3_ENDPOINT"),
+			Region:    os.Getenv("ARCHIVE_S3_REGION"),
+			Bucket:    bucket,
+			AccessKey: os.Getenv("ARCHIVE_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("ARCHIVE_S3_SECRET_KEY"),
+			Client:    &http.Client{},
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" {
+			log.Fatal("ARCHIVE_S3_ENDPOINT is not set, but ARCHIVE_S3_BUCKET is.")
+		}
+		roomArchiver = archive.NewArchiver(s, store)
+		roomArchiver.Anonymizer = hub.Anonymizer
+		hub.ArchiveFiles = store
+		if v := os.Getenv("ARCHIVE_AFTER"); v != "" {
+			after, err := time.ParseDuration(v)
+			if err != nil || after <= 0 {
+				log.Printf("Warning: Invalid ARCHIVE_AFTER value '%s'. Using %v.", v, archive.DefaultAfter)
+			} else {
+				roomArchiver.After = after
+			}
+		}
+	}
+	jobs := newJobScheduler(s, queueJanitor, idleRoomSweeper, historyRetention, roomArchiver)
+
+	eventSchedule := events.NewSchedule(os.Getenv("EVENTS_FILE"))
+	if eventSchedule.Path != "" {
+		if err := eventSchedule.Reload(); err != nil {
+			log.Printf("Warning: Failed to load events file: %v", err)
+		}
+	}
+	matcher.Events = eventSchedule
+	qualityScorer.Events = eventSchedule
 
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if botToken == "" {
@@ -106,15 +499,115 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to start Telegram bot: %v", err)
 	}
+	if v := os.Getenv("TELEGRAM_SEND_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers < 0 {
+			log.Printf("Warning: Invalid TELEGRAM_SEND_WORKERS value '%s'. Using %d.", v, telegram.DefaultSendWorkers)
+		} else {
+			botService.SendWorkers = workers
+		}
+	}
+	if v := os.Getenv("TELEGRAM_SEND_BUFFER"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: Invalid TELEGRAM_SEND_BUFFER value '%s'. Using %d.", v, telegram.DefaultSendBuffer)
+		} else {
+			botService.SendBuffer = size
+		}
+	}
+	adminIDs := telegram.ParseAdminIDs(os.Getenv("ADMIN_TELEGRAM_IDS"))
+	botService.AdminIDs = adminIDs
+	if keyPath := os.Getenv("MODERATOR_PUBLIC_KEY_FILE"); keyPath != "" {
+		moderatorKey, err := escalation.LoadPublicKey(keyPath)
+		if err != nil {
+			log.Fatalf("Failed to load moderator public key: %v", err)
+		}
+		botService.Escalation = escalation.NewService(s, moderatorKey)
+	} else {
+		log.Println("Warning: MODERATOR_PUBLIC_KEY_FILE is not set. Critical complaints will not be escalated.")
+	}
+	botService.Events = eventSchedule
+	featureFlags := features.NewService()
+	if unknown := featureFlags.DisableList(os.Getenv("LABS_DISABLED_FEATURES")); len(unknown) > 0 {
+		log.Printf("Warning: Unknown features %v in LABS_DISABLED_FEATURES, ignoring them.", unknown)
+	}
+	botService.Features = featureFlags
+	botService.WebAppURL = os.Getenv("WEBAPP_URL")
+	botService.RequeueAbandonedPartner = hub.RequeueAbandonedPartner
 
-	go hub.Run()
-	go matcher.Run()
-	go botService.Run()
+	var mediaRehoster *media.Rehoster
+	if bucket := os.Getenv("MEDIA_S3_BUCKET"); bucket != "" {
+		store := &media.S3Store{
+			Endpoint:  os.Getenv("MEDIA_S3_ENDPOINT"),
+			Region:    os.Getenv("MEDIA_S3_REGION"),
+			Bucket:    bucket,
+			AccessKey: os.Getenv("MEDIA_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("MEDIA_S3_SECRET_KEY"),
+			PublicURL: os.Getenv("MEDIA_PUBLIC_URL"),
+			Client:    &http.Client{},
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" {
+			log.Fatal("MEDIA_S3_ENDPOINT is not set, but MEDIA_S3_BUCKET is.")
+		}
+		source := &telegram.FileSource{BotAPI: botService.BotAPI, Client: &http.Client{}}
+		mediaRehoster = media.NewRehoster(s, source, store)
+		hub.MediaFiles = store
+	}
+
+	stopWriter := func() {}
+	if hub.Writer != nil {
+		stopWriter = start(hub.Writer.Run)
+	}
+	stopHub := start(hub.Run)
+	stopMatcher := start(matcher.Run)
+	stopQualityScorer := start(qualityScorer.Run)
+	stopJobs := start(jobs.Run)
+	stopRehoster := func() {}
+	if mediaRehoster != nil {
+		stopRehoster = start(mediaRehoster.Run)
+	}
+	stopBot := start(botService.Run)
+	stopAnnouncer := start(func(ctx context.Context) {
+		botService.RunEventAnnouncer(ctx, telegram.DefaultEventAnnounceInterval)
+	})
+	stopPrompter := start(func(ctx context.Context) {
+		botService.RunProfilePrompter(ctx, telegram.DefaultProfilePromptInterval)
+	})
 
 	r := gin.Default()
-	h := handler.NewHandler(hub)
+	h := handler.NewHandler(hub, s)
+	if v := os.Getenv("WS_SEND_BUFFER"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Printf("Warning: Invalid WS_SEND_BUFFER value '%s'. Using %d.", v, chathub.DefaultWebSocketSendBuffer)
+		} else {
+			h.WSSendBuffer = size
+		}
+	}
+	h.BotToken = botToken
+	h.AdminIDs = adminIDs
+	h.RiskProfile = analysis.NewRiskProfile(s)
+	h.SuperAdminIDs = telegram.ParseAdminIDs(os.Getenv("SUPERADMIN_TELEGRAM_IDS"))
+	for id := range h.SuperAdminIDs {
+		adminIDs[id] = true
+	}
 	r.GET("/anonid", h.GetAnonID)
 	r.GET("/ws", h.ServeWebSocket)
+	r.POST("/link/code", h.CreateLinkCode)
+	r.GET("/webapp", h.ServeWebApp)
+	r.GET("/metrics", gin.WrapH(metrics.Default.Handler()))
+	profileAPI := r.Group("/webapp/api", h.WebAppAuth())
+	profileAPI.GET("/profile", h.GetProfile)
+	profileAPI.PUT("/profile", h.UpdateProfile)
+	adminAPI := r.Group("/admin/api", h.WebAppAuth(), h.AdminAuth())
+	adminAPI.GET("/users/:id/risk", h.GetUserRisk)
+	adminAPI.GET("/users/:id/snapshot", h.GetUserSnapshot)
+	adminAPI.GET("/commands/usage", h.GetCommandUsage)
+	adminAPI.GET("/history/search", h.SearchHistory)
+	adminAPI.GET("/rooms", h.ListRooms)
 
 	server := &http.Server{
 		Addr:           ":8080",
@@ -123,5 +616,86 @@ func main() {
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	log.Fatal(server.ListenAndServe())
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		httpCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout/2)
+		defer cancel()
+		if err := server.Shutdown(httpCtx); err != nil {
+			log.Printf("Warning: Failed to shut down the HTTP server: %v", err)
+		}
+		// Stop taking input first. The matcher sends to clients, so it stops before the hub
+		// closes their channels; the hub persists the searches the matcher did not receive.
+		stopJobs()
+		stopQualityScorer()
+		stopRehoster()
+		stopAnnouncer()
+		stopPrompter()
+		stopBot()
+		stopMatcher()
+		stopHub()
+		// The hub hands chat messages to the writer until it stops; the writer saves them.
+		stopWriter()
+		if !botService.WaitForClients(shutdownTimeout / 2) {
+			log.Println("Warning: Some Telegram messages were not delivered before shutdown.")
+		}
+	}()
+	select {
+	case <-stopped:
+		log.Println("Shutdown complete.")
+	case <-time.After(shutdownTimeout):
+		log.Println("Warning: Shutdown timed out.")
+	}
+}
+
+// start runs a service loop in a goroutine. The returned function cancels the loop's context
+// and waits for it to return.
+func start(run func(ctx context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// newJobScheduler registers the recurring jobs of the process: jobs that must not run twice
+// per interval are exclusive, the others run on every instance. Jobs without an age limit
+// are disabled, as is the room archive without an archiver.
+func newJobScheduler(s storage.Storage, janitor *chathub.QueueJanitor, sweeper *chathub.IdleRoomSweeper, retention *chathub.HistoryRetention, archiver *archive.Archiver) *scheduler.Scheduler {
+	jobs := scheduler.New(s)
+	banExpiry := chathub.NewBanExpiryProcessor(s)
+	jobs.Register(scheduler.Job{Name: "ban_expiry", Interval: banExpiry.Interval, Run: banExpiry.ProcessEndedBans})
+	recovery := chathub.NewReputationRecovery(s)
+	jobs.Register(scheduler.Job{Name: "reputation_recovery", Interval: recovery.Interval, Exclusive: true, Run: recovery.RecoverRatings})
+	if janitor.MaxAge > 0 {
+		jobs.Register(scheduler.Job{Name: "search_queue_cleanup", Interval: janitor.Interval, Run: janitor.RemoveStaleEntries})
+	}
+	if sweeper.MaxIdle > 0 {
+		jobs.Register(scheduler.Job{Name: "idle_rooms", Interval: sweeper.Interval, Run: sweeper.CloseIdleRooms})
+	}
+	if retention.MaxAge > 0 {
+		jobs.Register(scheduler.Job{Name: "history_retention", Interval: retention.Interval, Exclusive: true, Run: retention.DeleteExpiredHistory})
+	}
+	if archiver != nil {
+		jobs.Register(scheduler.Job{Name: "room_archive", Interval: archiver.Interval, Exclusive: true, Run: archiver.ArchiveClosedRooms})
+	}
+	relay := chathub.NewOutboxRelay(s)
+	jobs.Register(scheduler.Job{Name: "outbox_relay", Interval: relay.Interval, Run: relay.RelayPending})
+	return jobs
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"chatgogo/backend/internal/migrations"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// runMigrate runs a migration command and returns the exit code: "status" prints the state of
+// every migration, "up" applies the pending ones and "down" reverts the last applied one.
+func runMigrate(command string) int {
+	db, err := gorm.Open(postgres.Open(postgresDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect PostgreSQL: %v\n", err)
+		return 1
+	}
+	migrator := migrations.New(db)
+
+	switch command {
+	case "status":
+		statuses, unknown, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied"
+			} else if status.Dirty {
+				applied = "failed (dirty)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		if unknown > 0 {
+			fmt.Fprintf(w, "%04d\t\tapplied (unknown to this build)\n", unknown)
+		}
+		w.Flush()
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to apply migrations: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations.")
+		}
+	case "down":
+		reverted, err := migrator.Down()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to revert migration: %v\n", err)
+			return 1
+		}
+		if reverted == nil {
+			fmt.Println("No applied migrations.")
+			return 0
+		}
+		fmt.Printf("Reverted %04d_%s\n", reverted.Version, reverted.Name)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migration command %q, use status, up or down\n", command)
+		return 2
+	}
+	return 0
+}
+
+// migrateOnStart applies the pending migrations at startup, unless MIGRATE_ON_START is
+// false, and verifies that none is pending, so that the service never runs on a schema
+// older than it expects.
+func migrateOnStart(db *gorm.DB) error {
+	migrator := migrations.New(db)
+	if os.Getenv("MIGRATE_ON_START") != "false" {
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s.", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, unknown, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	if unknown > 0 {
+		log.Printf("Warning: The database is at migration %04d, which this build does not know.", unknown)
+	}
+	return migrator.Verify()
+}
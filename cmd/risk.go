@@ -0,0 +1,37 @@
+package main
+
+import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/storage"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// runRiskProfile prints the risk profile of a user, given by anonymous or Telegram ID, to
+// stdout and returns the exit code. Like the doctor mode, it does not run migrations.
+func runRiskProfile(ref string) int {
+	db, err := gorm.Open(postgres.Open(postgresDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect PostgreSQL: %v\n", err)
+		return 1
+	}
+	rdb := redis.NewUniversalClient(redisOptions())
+	defer rdb.Close()
+
+	profile := analysis.NewRiskProfile(storage.NewStorageService(db, rdb))
+	risk, err := profile.Lookup(ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build risk profile: %v\n", err)
+		return 1
+	}
+	if err := risk.Write(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write risk profile: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+// Package analysis computes behavioral heuristics over chat traffic. Its Detector spots
+// scripted clients ("honeypot" signals) from the timing and shape of their messages, without
+// looking at who they talk to.
+package analysis
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Signals raised by the Detector.
+const (
+	// SignalInstantOpener is raised when a user opens several rooms with the same message
+	// within moments of being matched.
+	SignalInstantOpener = "instant_identical_opener"
+	// SignalTypingSpeed is raised when a user repeatedly sends long texts faster than a
+	// human can type them.
+	SignalTypingSpeed = "impossible_typing_speed"
+	// SignalURLOpener is raised when a user opens several rooms with a link.
+	SignalURLOpener = "url_opener_across_rooms"
+)
+
+// BotScore is the number of distinct signals from which a user is treated as a bot rather
+// than a suspect.
+const BotScore = 2
+
+// urlPattern matches the link formats commonly used in spam messages.
+var urlPattern = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/|telegram\.me/)\S+`)
+
+// Config holds the thresholds of the heuristics.
+type Config struct {
+	// InstantReplyWindow is how soon after a match an opener counts as instant.
+	InstantReplyWindow time.Duration
+	// MaxCharsPerSecond is the fastest plausible typing speed.
+	MaxCharsPerSecond float64
+	// MinTypedLength is the shortest text checked for typing speed, so that quick short
+	// replies are not counted.
+	MinTypedLength int
+	// TypingStrikes is the number of too-fast texts within Window that raises SignalTypingSpeed.
+	TypingStrikes int
+	// RepeatedOpeners is the number of rooms within Window opened the same way that raises
+	// SignalInstantOpener or SignalURLOpener.
+	RepeatedOpeners int
+	// Window is how long observations are remembered.
+	Window time.Duration
+}
+
+// DefaultConfig returns thresholds that only catch clearly non-human behavior.
+func DefaultConfig() Config {
+	return Config{
+		InstantReplyWindow: 2 * time.Second,
+		MaxCharsPerSecond:  25,
+		MinTypedLength:     40,
+		TypingStrikes:      3,
+		RepeatedOpeners:    3,
+		Window:             time.Hour,
+	}
+}
+
+// Observation is a message sent by a user in a room.
+type Observation struct {
+	UserID string
+	RoomID string
+	// RoomStartedAt is the time the room was created.
+	RoomStartedAt time.Time
+	// Text is the text of the message, or the caption of media.
+	Text string
+	// Typed reports whether the text was typed in, as opposed to a media caption.
+	Typed bool
+	At    time.Time
+}
+
+// Verdict lists the signals currently raised for a user.
+type Verdict struct {
+	Signals []string
+}
+
+// Score is the number of distinct signals raised.
+func (v Verdict) Score() int {
+	return len(v.Signals)
+}
+
+// Suspect reports whether any signal is raised.
+func (v Verdict) Suspect() bool {
+	return v.Score() > 0
+}
+
+// Bot reports whether enough signals are raised to treat the user as a bot.
+func (v Verdict) Bot() bool {
+	return v.Score() >= BotScore
+}
+
+// opener is the first message a user sent in a room.
+type opener struct {
+	text    string
+	instant bool
+	hasURL  bool
+	at      time.Time
+}
+
+// userState is what the Detector remembers about a user.
+type userState struct {
+	roomID        string
+	lastMessageAt time.Time
+	openers       []opener
+	typingStrikes []time.Time
+}
+
+// Detector tracks the recent messages of users and raises signals for scripted behavior.
+// It is safe for concurrent use.
+type Detector struct {
+	Config Config
+
+	mu    sync.Mutex
+	users map[string]*userState
+}
+
+// NewDetector creates a Detector with the given thresholds.
+func NewDetector(config Config) *Detector {
+	return &Detector{Config: config, users: make(map[string]*userState)}
+}
+
+// Observe records a message and returns the signals raised for its sender.
+func (d *Detector) Observe(o Observation) Verdict {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.users[o.UserID]
+	if !ok {
+		state = &userState{}
+		d.users[o.UserID] = state
+	}
+	since := o.At.Add(-d.Config.Window)
+	state.openers = dropBefore(state.openers, since, func(op opener) time.Time { return op.at })
+	state.typingStrikes = dropBefore(state.typingStrikes, since, func(t time.Time) time.Time { return t })
+
+	if state.roomID != o.RoomID {
+		state.roomID = o.RoomID
+		state.lastMessageAt = o.RoomStartedAt
+		state.openers = append(state.openers, opener{
+			text:    normalize(o.Text),
+			instant: o.At.Sub(o.RoomStartedAt) <= d.Config.InstantReplyWindow,
+			hasURL:  urlPattern.MatchString(o.Text),
+			at:      o.At,
+		})
+	}
+
+	if o.Typed && utf8.RuneCountInString(o.Text) >= d.Config.MinTypedLength {
+		elapsed := o.At.Sub(state.lastMessageAt).Seconds()
+		if elapsed <= 0 || float64(utf8.RuneCountInString(o.Text))/elapsed > d.Config.MaxCharsPerSecond {
+			state.typingStrikes = append(state.typingStrikes, o.At)
+		}
+	}
+	state.lastMessageAt = o.At
+
+	return d.verdict(state)
+}
+
+// verdict evaluates the heuristics over the remembered state of a user.
+func (d *Detector) verdict(state *userState) Verdict {
+	var verdict Verdict
+
+	identical, withURL := 0, 0
+	var latest opener
+	if len(state.openers) > 0 {
+		latest = state.openers[len(state.openers)-1]
+	}
+	for _, op := range state.openers {
+		if op.instant && latest.instant && op.text != "" && op.text == latest.text {
+			identical++
+		}
+		if op.hasURL {
+			withURL++
+		}
+	}
+	if identical >= d.Config.RepeatedOpeners {
+		verdict.Signals = append(verdict.Signals, SignalInstantOpener)
+	}
+	if len(state.typingStrikes) >= d.Config.TypingStrikes {
+		verdict.Signals = append(verdict.Signals, SignalTypingSpeed)
+	}
+	if withURL >= d.Config.RepeatedOpeners {
+		verdict.Signals = append(verdict.Signals, SignalURLOpener)
+	}
+	return verdict
+}
+
+// Prune forgets users who have not sent a message within the window.
+func (d *Detector) Prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for userID, state := range d.users {
+		if now.Sub(state.lastMessageAt) > d.Config.Window {
+			delete(d.users, userID)
+		}
+	}
+}
+
+// normalize makes openers comparable regardless of case and spacing.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// dropBefore removes the leading entries of a time-ordered slice that are older than since.
+func dropBefore[T any](entries []T, since time.Time, at func(T) time.Time) []T {
+	i := 0
+	for i < len(entries) && at(entries[i]).Before(since) {
+		i++
+	}
+	return entries[i:]
+}
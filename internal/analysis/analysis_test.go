@@ -0,0 +1,94 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// openRoom observes the first message of a user in a new room, sent after the given delay.
+func openRoom(d *Detector, room int, delay time.Duration, text string) Verdict {
+	roomStart := start.Add(time.Duration(room) * time.Minute)
+	return d.Observe(Observation{
+		UserID:        "user_A",
+		RoomID:        fmt.Sprintf("room%d", room),
+		RoomStartedAt: roomStart,
+		Text:          text,
+		Typed:         true,
+		At:            roomStart.Add(delay),
+	})
+}
+
+func TestInstantIdenticalOpeners(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+
+	assert.False(t, openRoom(d, 1, 500*time.Millisecond, "Hi there!").Suspect())
+	assert.False(t, openRoom(d, 2, 500*time.Millisecond, "hi  THERE!").Suspect())
+	verdict := openRoom(d, 3, 500*time.Millisecond, "Hi there!")
+
+	assert.Equal(t, []string{SignalInstantOpener}, verdict.Signals)
+	assert.False(t, verdict.Bot())
+}
+
+func TestSlowOrVariedOpenersAreHuman(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+
+	openRoom(d, 1, 10*time.Second, "hi")
+	openRoom(d, 2, 10*time.Second, "hi")
+	assert.False(t, openRoom(d, 3, 10*time.Second, "hi").Suspect(), "same opener, but typed at human speed")
+
+	openRoom(d, 4, time.Second, "hello")
+	openRoom(d, 5, time.Second, "hey")
+	assert.False(t, openRoom(d, 6, time.Second, "yo").Suspect(), "instant, but different openers")
+}
+
+func TestImpossibleTypingSpeed(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+	long := "This message is far too long to be typed in a single second by anyone."
+	o := Observation{UserID: "user_A", RoomID: "room1", RoomStartedAt: start, Text: "hello", Typed: true, At: start.Add(30 * time.Second)}
+	d.Observe(o)
+
+	for i := 1; i <= 3; i++ {
+		o.Text, o.At = long, o.At.Add(time.Second)
+		verdict := d.Observe(o)
+		assert.Equal(t, i == 3, verdict.Suspect(), "strike %d", i)
+	}
+
+	caption := Observation{UserID: "user_B", RoomID: "room1", RoomStartedAt: start, Text: long, At: start}
+	for range 3 {
+		assert.False(t, d.Observe(caption).Suspect(), "media captions are not typed")
+	}
+}
+
+func TestURLOpenersAcrossRooms(t *testing.T) {
+	d := NewDetector(DefaultConfig())
+
+	openRoom(d, 1, 20*time.Second, "check https://spam.example/a")
+	openRoom(d, 2, 20*time.Second, "see www.spam.example")
+	verdict := openRoom(d, 3, 20*time.Second, "t.me/spam")
+	assert.Equal(t, []string{SignalURLOpener}, verdict.Signals)
+
+	bot := NewDetector(DefaultConfig())
+	openRoom(bot, 1, time.Second, "check https://spam.example/a")
+	openRoom(bot, 2, time.Second, "check https://spam.example/a")
+	verdict = openRoom(bot, 3, time.Second, "check https://spam.example/a")
+	assert.ElementsMatch(t, []string{SignalInstantOpener, SignalURLOpener}, verdict.Signals)
+	assert.True(t, verdict.Bot())
+}
+
+func TestObservationsExpire(t *testing.T) {
+	config := DefaultConfig()
+	config.Window = 10 * time.Minute
+	d := NewDetector(config)
+
+	openRoom(d, 1, time.Second, "https://spam.example")
+	openRoom(d, 2, time.Second, "https://spam.example")
+	assert.False(t, openRoom(d, 30, time.Second, "https://spam.example").Suspect())
+
+	d.Prune(start.Add(time.Hour))
+	assert.Empty(t, d.users)
+}
@@ -0,0 +1,244 @@
+package analysis
+
+import (
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultRiskRecentRooms is the number of recent scored rooms included in a risk profile.
+const DefaultRiskRecentRooms = 10
+
+// RiskStore is the storage used to assemble risk profiles.
+type RiskStore interface {
+	GetUserByID(userID string) (*models.User, error)
+	GetUserByTelegramID(telegramID int64) (*models.User, error)
+	IsUserBanned(anonID string) (bool, error)
+	GetBansForUser(userID string) ([]models.Ban, error)
+	GetComplaintsByReporter(userID string) ([]models.Complaint, error)
+	GetComplaintsBySuspect(userID string) ([]models.Complaint, error)
+	GetScoredRoomsForUser(userID string, limit int) ([]models.ChatRoom, error)
+}
+
+// RiskProfile assembles the moderation history of users for administrators. It is shared by
+// the command line and the admin API so that both show the same figures.
+type RiskProfile struct {
+	Store RiskStore
+	// RecentRooms is the number of recent scored rooms included in a profile.
+	RecentRooms int
+}
+
+// NewRiskProfile creates a RiskProfile reading from the given store.
+func NewRiskProfile(store RiskStore) *RiskProfile {
+	return &RiskProfile{Store: store, RecentRooms: DefaultRiskRecentRooms}
+}
+
+// ComplaintStats counts complaints by moderation outcome.
+type ComplaintStats struct {
+	Total     int `json:"total"`
+	Confirmed int `json:"confirmed"`
+	Rejected  int `json:"rejected"`
+	Pending   int `json:"pending"`
+	// ConfirmationRate is the share of moderated complaints that were confirmed, from 0 to
+	// 1. It is 0 while no complaint has been moderated.
+	ConfirmationRate float64 `json:"confirmation_rate"`
+}
+
+// Ban is a ban of the user, with the complaint it was imposed for.
+type Ban struct {
+	ID    uint   `json:"id"`
+	Level string `json:"level"`
+	// ComplaintID is 0 for a ban not imposed for a complaint; Severity and Reason are then
+	// empty.
+	ComplaintID uint      `json:"complaint_id"`
+	Severity    string    `json:"severity"`
+	Reason      string    `json:"reason"`
+	Since       time.Time `json:"since"`
+	// Until is the end of the ban, or nil for a permanent ban.
+	Until *time.Time `json:"until,omitempty"`
+	// RevertedAt is when the ban was reverted, or nil if it stands.
+	RevertedAt *time.Time `json:"reverted_at,omitempty"`
+}
+
+// RoomScore is the quality score of a closed room.
+type RoomScore struct {
+	RoomID   string    `json:"room_id"`
+	EndedAt  time.Time `json:"ended_at"`
+	Score    int       `json:"score"`
+	ClosedBy string    `json:"closed_by"`
+}
+
+// UserRisk is the risk profile of a user.
+type UserRisk struct {
+	UserID     string `json:"user_id"`
+	TelegramID int64  `json:"telegram_id"`
+	Rating     int    `json:"rating"`
+	BannedNow  bool   `json:"banned_now"`
+	// Filed are the complaints the user filed against others.
+	Filed ComplaintStats `json:"complaints_filed"`
+	// Received are the complaints others filed against the user.
+	Received ComplaintStats `json:"complaints_received"`
+	// Bans is the ban history, oldest first.
+	Bans []Ban `json:"bans"`
+	// RecentRooms are the latest scored rooms of the user, newest first.
+	RecentRooms []RoomScore `json:"recent_rooms"`
+	// AverageRoomScore is the mean score of RecentRooms, or 0 if there are none.
+	AverageRoomScore float64 `json:"average_room_score"`
+}
+
+// Lookup builds the risk profile of the user referred to by an anonymous ID or a numeric
+// Telegram ID.
+func (p *RiskProfile) Lookup(ref string) (*UserRisk, error) {
+	var (
+		user *models.User
+		err  error
+	)
+	if telegramID, parseErr := strconv.ParseInt(ref, 10, 64); parseErr == nil {
+		user, err = p.Store.GetUserByTelegramID(telegramID)
+	} else {
+		user, err = p.Store.GetUserByID(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", ref, err)
+	}
+	return p.Build(user)
+}
+
+// Build assembles the risk profile of a user.
+func (p *RiskProfile) Build(user *models.User) (*UserRisk, error) {
+	filed, err := p.Store.GetComplaintsByReporter(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("complaints filed by %s: %w", user.ID, err)
+	}
+	received, err := p.Store.GetComplaintsBySuspect(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("complaints against %s: %w", user.ID, err)
+	}
+	rooms, err := p.Store.GetScoredRoomsForUser(user.ID, p.RecentRooms)
+	if err != nil {
+		return nil, fmt.Errorf("rooms of %s: %w", user.ID, err)
+	}
+	banned, err := p.Store.IsUserBanned(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ban of %s: %w", user.ID, err)
+	}
+	bans, err := p.Store.GetBansForUser(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("bans of %s: %w", user.ID, err)
+	}
+
+	risk := &UserRisk{
+		UserID:      user.ID,
+		TelegramID:  user.TelegramID,
+		Rating:      user.RatingScore,
+		BannedNow:   banned,
+		Filed:       complaintStats(filed),
+		Received:    complaintStats(received),
+		Bans:        banHistory(bans, received),
+		RecentRooms: make([]RoomScore, 0, len(rooms)),
+	}
+	total := 0
+	for _, room := range rooms {
+		if room.QualityScore == nil {
+			continue
+		}
+		risk.RecentRooms = append(risk.RecentRooms, RoomScore{
+			RoomID:   room.RoomID,
+			EndedAt:  room.EndedAt,
+			Score:    *room.QualityScore,
+			ClosedBy: room.ClosedBy,
+		})
+		total += *room.QualityScore
+	}
+	if len(risk.RecentRooms) > 0 {
+		risk.AverageRoomScore = float64(total) / float64(len(risk.RecentRooms))
+	}
+	return risk, nil
+}
+
+// complaintStats counts complaints by status.
+func complaintStats(complaints []models.Complaint) ComplaintStats {
+	stats := ComplaintStats{Total: len(complaints)}
+	for _, complaint := range complaints {
+		switch complaint.Status {
+		case models.ComplaintStatusConfirmed:
+			stats.Confirmed++
+		case models.ComplaintStatusRejected:
+			stats.Rejected++
+		default:
+			stats.Pending++
+		}
+	}
+	if moderated := stats.Confirmed + stats.Rejected; moderated > 0 {
+		stats.ConfirmationRate = float64(stats.Confirmed) / float64(moderated)
+	}
+	return stats
+}
+
+// banHistory lists the bans of a user, including reverted ones, with the complaints against
+// the user they were imposed for.
+func banHistory(bans []models.Ban, received []models.Complaint) []Ban {
+	complaints := make(map[uint]models.Complaint, len(received))
+	for _, complaint := range received {
+		complaints[complaint.ID] = complaint
+	}
+
+	history := make([]Ban, 0, len(bans))
+	for _, ban := range bans {
+		entry := Ban{ID: ban.ID, Level: ban.Level, Since: ban.StartsAt, Until: ban.EndsAt}
+		if ban.ComplaintID != nil {
+			complaint := complaints[*ban.ComplaintID]
+			entry.ComplaintID, entry.Severity, entry.Reason = *ban.ComplaintID, complaint.Severity, complaint.Reason
+		}
+		if ban.IsReverted() {
+			revertedAt := ban.DeletedAt.Time
+			entry.RevertedAt = &revertedAt
+		}
+		history = append(history, entry)
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Since.Before(history[j].Since) })
+	return history
+}
+
+// Write writes the profile as a human-readable report.
+func (r *UserRisk) Write(w io.Writer) error {
+	lines := []string{
+		fmt.Sprintf("User:        %s (Telegram %d)", r.UserID, r.TelegramID),
+		fmt.Sprintf("Rating:      %d", r.Rating),
+		fmt.Sprintf("Banned now:  %t", r.BannedNow),
+		"Complaints:  " + formatStats("filed", r.Filed),
+		"             " + formatStats("received", r.Received),
+		fmt.Sprintf("Bans:        %d", len(r.Bans)),
+	}
+	for _, ban := range r.Bans {
+		until := "permanent"
+		if ban.Until != nil {
+			until = "until " + ban.Until.Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("  %s  ban #%d, complaint #%d (%s), %s: %s",
+			ban.Since.Format(time.RFC3339), ban.ID, ban.ComplaintID, ban.Severity, until, ban.Reason)
+		if ban.RevertedAt != nil {
+			line += ", reverted " + ban.RevertedAt.Format(time.RFC3339)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, fmt.Sprintf("Room scores: %d recent, average %.1f", len(r.RecentRooms), r.AverageRoomScore))
+	for _, room := range r.RecentRooms {
+		lines = append(lines, fmt.Sprintf("  %s  %3d  %s", room.EndedAt.Format(time.RFC3339), room.Score, room.RoomID))
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatStats renders complaint counts on one line.
+func formatStats(label string, stats ComplaintStats) string {
+	return fmt.Sprintf("%d %s, %d confirmed, %d rejected, %d pending (%.0f%% confirmed)",
+		stats.Total, label, stats.Confirmed, stats.Rejected, stats.Pending, stats.ConfirmationRate*100)
+}
@@ -0,0 +1,141 @@
+package analysis
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeRiskStore serves the moderation history of a single user.
+type fakeRiskStore struct {
+	user     *models.User
+	banned   bool
+	filed    []models.Complaint
+	received []models.Complaint
+	bans     []models.Ban
+	rooms    []models.ChatRoom
+}
+
+func (f *fakeRiskStore) GetUserByID(userID string) (*models.User, error) {
+	if userID != f.user.ID {
+		return nil, errors.New("user not found")
+	}
+	return f.user, nil
+}
+
+func (f *fakeRiskStore) GetUserByTelegramID(telegramID int64) (*models.User, error) {
+	if telegramID != f.user.TelegramID {
+		return nil, errors.New("user not found")
+	}
+	return f.user, nil
+}
+
+func (f *fakeRiskStore) IsUserBanned(string) (bool, error) { return f.banned, nil }
+
+func (f *fakeRiskStore) GetBansForUser(string) ([]models.Ban, error) { return f.bans, nil }
+
+func (f *fakeRiskStore) GetComplaintsByReporter(string) ([]models.Complaint, error) {
+	return f.filed, nil
+}
+
+func (f *fakeRiskStore) GetComplaintsBySuspect(string) ([]models.Complaint, error) {
+	return f.received, nil
+}
+
+func (f *fakeRiskStore) GetScoredRoomsForUser(_ string, limit int) ([]models.ChatRoom, error) {
+	if len(f.rooms) > limit {
+		return f.rooms[:limit], nil
+	}
+	return f.rooms, nil
+}
+
+func complaint(id uint, status, severity string, at time.Time) models.Complaint {
+	c := models.Complaint{Status: status, Severity: severity, Reason: "spam"}
+	c.ID, c.UpdatedAt = id, at
+	return c
+}
+
+func score(v int) *int { return &v }
+
+func ban(id, complaintID uint, at time.Time, duration time.Duration) models.Ban {
+	b := models.NewBan("anon-1", at, duration, &complaintID)
+	b.ID = id
+	return *b
+}
+
+func TestRiskProfile(t *testing.T) {
+	store := &fakeRiskStore{
+		user:   &models.User{ID: "anon-1", TelegramID: 42, RatingScore: -2},
+		banned: true,
+		filed: []models.Complaint{
+			complaint(1, models.ComplaintStatusConfirmed, models.ComplaintSeverityNormal, start),
+			complaint(2, models.ComplaintStatusRejected, models.ComplaintSeverityNormal, start),
+			complaint(3, models.ComplaintStatusRejected, models.ComplaintSeverityNormal, start),
+			complaint(4, models.ComplaintStatusNew, models.ComplaintSeverityNormal, start),
+		},
+		received: []models.Complaint{
+			complaint(7, models.ComplaintStatusConfirmed, models.ComplaintSeverityCritical, start.Add(48*time.Hour)),
+			complaint(5, models.ComplaintStatusConfirmed, models.ComplaintSeverityNormal, start),
+			complaint(6, models.ComplaintStatusNew, models.ComplaintSeverityNormal, start),
+		},
+		bans: []models.Ban{
+			ban(1, 5, start, 7*24*time.Hour),
+			ban(2, 7, start.Add(48*time.Hour), 0),
+		},
+		rooms: []models.ChatRoom{
+			{RoomID: "r2", QualityScore: score(20)},
+			{RoomID: "r1", QualityScore: score(60)},
+			{RoomID: "r0", QualityScore: score(100)},
+		},
+	}
+	store.bans[1].DeletedAt = gorm.DeletedAt{Time: start.Add(72 * time.Hour), Valid: true}
+	profile := NewRiskProfile(store)
+	profile.RecentRooms = 2
+
+	risk, err := profile.Lookup("42")
+	require.NoError(t, err)
+
+	assert.Equal(t, "anon-1", risk.UserID)
+	assert.Equal(t, -2, risk.Rating)
+	assert.True(t, risk.BannedNow)
+	assert.Equal(t, ComplaintStats{Total: 4, Confirmed: 1, Rejected: 2, Pending: 1, ConfirmationRate: 1.0 / 3}, risk.Filed)
+	assert.Equal(t, ComplaintStats{Total: 3, Confirmed: 2, Pending: 1, ConfirmationRate: 1}, risk.Received)
+
+	require.Len(t, risk.Bans, 2)
+	assert.Equal(t, uint(5), risk.Bans[0].ComplaintID)
+	require.NotNil(t, risk.Bans[0].Until)
+	assert.Equal(t, start.Add(7*24*time.Hour), *risk.Bans[0].Until)
+	assert.Equal(t, uint(7), risk.Bans[1].ComplaintID)
+	assert.Equal(t, models.ComplaintSeverityCritical, risk.Bans[1].Severity)
+	assert.Equal(t, models.BanLevelPermanent, risk.Bans[1].Level)
+	assert.Nil(t, risk.Bans[1].Until)
+	require.NotNil(t, risk.Bans[1].RevertedAt, "reverted bans stay in the history")
+
+	require.Len(t, risk.RecentRooms, 2)
+	assert.Equal(t, "r2", risk.RecentRooms[0].RoomID)
+	assert.Equal(t, 40.0, risk.AverageRoomScore)
+
+	var out bytes.Buffer
+	require.NoError(t, risk.Write(&out))
+	assert.Contains(t, out.String(), "3 received, 2 confirmed, 0 rejected, 1 pending (100% confirmed)")
+	assert.Contains(t, out.String(), "ban #2, complaint #7 (critical), permanent: spam, reverted ")
+}
+
+func TestRiskProfileByAnonymousID(t *testing.T) {
+	store := &fakeRiskStore{user: &models.User{ID: "anon-1", TelegramID: 42}}
+
+	risk, err := NewRiskProfile(store).Lookup("anon-1")
+	require.NoError(t, err)
+	assert.Equal(t, ComplaintStats{}, risk.Filed)
+	assert.Empty(t, risk.Bans)
+	assert.Zero(t, risk.AverageRoomScore)
+
+	_, err = NewRiskProfile(store).Lookup("anon-2")
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+// Package anonymize replaces internal user IDs with pseudonyms in data that leaves the
+// service: transcript exports, analytics and the default views of the moderation API.
+// Pseudonyms are stable within a scope, e.g. one export, so that downstream tools can still
+// tell the users of an export apart, but the pseudonyms of different scopes cannot be linked
+// to each other or to the user IDs without the key.
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pseudonymPrefix marks pseudonyms, so that they are never mistaken for user IDs.
+const pseudonymPrefix = "anon_"
+
+// pseudonymBytes is the number of HMAC bytes a pseudonym is made of.
+const pseudonymBytes = 10
+
+// scopeBytes is the number of random bytes that make the scope of one export unique.
+const scopeBytes = 8
+
+// Anonymizer derives the pseudonyms of user IDs. Implementations must return the same
+// pseudonym for the same scope and user ID, and different pseudonyms for different users.
+type Anonymizer interface {
+	// Pseudonym returns the pseudonym of a user ID within a scope.
+	Pseudonym(scope, userID string) string
+}
+
+// HMAC is the default Anonymizer: a pseudonym is the HMAC-SHA256 of the scope and the user
+// ID under a secret key. Pseudonyms stay the same as long as the key does.
+type HMAC struct {
+	Key []byte
+}
+
+// NewHMAC creates an HMAC Anonymizer with the given key.
+func NewHMAC(key []byte) *HMAC {
+	return &HMAC{Key: key}
+}
+
+// RandomKey returns a new random key, for when no key is configured. Pseudonyms derived with
+// it change when the service restarts.
+func RandomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// Pseudonym returns the pseudonym of a user ID within a scope.
+func (a *HMAC) Pseudonym(scope, userID string) string {
+	mac := hmac.New(sha256.New, a.Key)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userID))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:pseudonymBytes])
+}
+
+// Registry remembers the user IDs of the pseudonyms handed out, so that a pseudonym taken
+// from an export can be looked up later. Pseudonyms cannot be reversed without it.
+type Registry interface {
+	// SavePseudonyms remembers the user IDs of pseudonyms for ttl.
+	SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error
+	// ResolvePseudonym returns the user ID of a remembered pseudonym, or "" if it is unknown
+	// or expired.
+	ResolvePseudonym(pseudonym string) (string, error)
+}
+
+// NewScope returns a new scope for one export for the given purpose, e.g. one response of
+// the moderation API, whose pseudonyms cannot be linked to those of any other export.
+func NewScope(purpose string) string {
+	suffix := make([]byte, scopeBytes)
+	rand.Read(suffix)
+	return purpose + ":" + hex.EncodeToString(suffix)
+}
+
+// IsPseudonym reports whether an ID is a pseudonym rather than a user ID.
+func IsPseudonym(id string) bool {
+	return strings.HasPrefix(id, pseudonymPrefix)
+}
+
+// Mapping pseudonymizes the user IDs of one scope and remembers the pseudonyms it handed
+// out, so that they can be saved to a Registry once the scope is exported. A nil *Mapping
+// leaves user IDs as they are, for views that were explicitly deanonymized. It is safe for
+// concurrent use.
+type Mapping struct {
+	anonymizer Anonymizer
+	scope      string
+
+	mu      sync.Mutex
+	userIDs map[string]string
+}
+
+// NewMapping creates the mapping of a scope.
+func NewMapping(anonymizer Anonymizer, scope string) *Mapping {
+	return &Mapping{anonymizer: anonymizer, scope: scope, userIDs: make(map[string]string)}
+}
+
+// ID returns the pseudonym of a user ID. The empty ID and "system", which do not identify a
+// user, and IDs that already are pseudonyms are kept.
+func (m *Mapping) ID(userID string) string {
+	if m == nil || userID == "" || userID == "system" || IsPseudonym(userID) {
+		return userID
+	}
+	pseudonym := m.anonymizer.Pseudonym(m.scope, userID)
+	m.mu.Lock()
+	m.userIDs[pseudonym] = userID
+	m.mu.Unlock()
+	return pseudonym
+}
+
+// IDs returns the pseudonyms of user IDs.
+func (m *Mapping) IDs(userIDs []string) []string {
+	pseudonyms := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		pseudonyms[i] = m.ID(userID)
+	}
+	return pseudonyms
+}
+
+// Pseudonyms returns the pseudonyms handed out so far with their user IDs.
+func (m *Mapping) Pseudonyms() map[string]string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pseudonyms := make(map[string]string, len(m.userIDs))
+	for pseudonym, userID := range m.userIDs {
+		pseudonyms[pseudonym] = userID
+	}
+	return pseudonyms
+}
@@ -0,0 +1,46 @@
+package anonymize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMAC_Pseudonym(t *testing.T) {
+	a := NewHMAC([]byte("secret"))
+
+	pseudonym := a.Pseudonym("export-1", "user_A")
+	assert.True(t, strings.HasPrefix(pseudonym, "anon_"))
+	assert.NotContains(t, pseudonym, "user_A")
+	assert.Equal(t, pseudonym, a.Pseudonym("export-1", "user_A"), "stable within a scope")
+	assert.NotEqual(t, pseudonym, a.Pseudonym("export-1", "user_B"), "distinct per user")
+	assert.NotEqual(t, pseudonym, a.Pseudonym("export-2", "user_A"), "unlinkable across scopes")
+	assert.NotEqual(t, pseudonym, NewHMAC([]byte("other")).Pseudonym("export-1", "user_A"), "depends on the key")
+}
+
+func TestMapping(t *testing.T) {
+	m := NewMapping(NewHMAC([]byte("secret")), "export-1")
+
+	ids := m.IDs([]string{"user_A", "system", "", "user_A"})
+	assert.Equal(t, ids[0], ids[3])
+	assert.Equal(t, "system", ids[1])
+	assert.Equal(t, "", ids[2])
+
+	assert.Equal(t, "anon_0123", m.ID("anon_0123"), "already a pseudonym")
+	assert.Equal(t, map[string]string{ids[0]: "user_A"}, m.Pseudonyms())
+}
+
+func TestNewScope(t *testing.T) {
+	scope := NewScope("moderation")
+
+	assert.True(t, strings.HasPrefix(scope, "moderation:"))
+	assert.NotEqual(t, scope, NewScope("moderation"), "one scope per export")
+}
+
+func TestMapping_NilKeepsIDs(t *testing.T) {
+	var m *Mapping
+
+	assert.Equal(t, "user_A", m.ID("user_A"))
+	assert.Nil(t, m.Pseudonyms())
+}
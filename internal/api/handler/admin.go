@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth — middleware для адмінських запитів. Працює після WebAppAuth і пропускає лише
+// користувачів, чиї Telegram ID налаштовані як адміністратори.
+func (h *Handler) AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(webAppUserKey).(*models.User)
+		if !h.AdminIDs[user.TelegramID] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetUserRisk повертає профіль ризику користувача, заданого анонімним, Telegram ID або
+// псевдонімом з іншої відповіді адмінського API: статистику скарг, історію банів та оцінки
+// останніх кімнат. Ідентифікатори користувачів замінено псевдонімами, якщо
+// суперадміністратор не попросив deanonymize=true.
+func (h *Handler) GetUserRisk(c *gin.Context) {
+	if h.RiskProfile == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Risk profiles are not configured"})
+		return
+	}
+	ids, ok := h.idMapping(c)
+	if !ok {
+		return
+	}
+
+	ref, err := h.resolveUserRef(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	risk, err := h.RiskProfile.Lookup(ref)
+	if err != nil {
+		log.Printf("ERROR: Failed to build risk profile of %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found or profile unavailable"})
+		return
+	}
+	risk = anonymizeRisk(risk, ids)
+	h.rememberPseudonyms(ids)
+	c.JSON(http.StatusOK, risk)
+}
+
+// anonymizeRisk замінює ідентифікатори користувачів у профілі ризику псевдонімами з ids і
+// прибирає Telegram ID. З nil ids профіль повертається як є.
+func anonymizeRisk(risk *analysis.UserRisk, ids *anonymize.Mapping) *analysis.UserRisk {
+	if ids == nil {
+		return risk
+	}
+	anonymized := *risk
+	anonymized.UserID = ids.ID(risk.UserID)
+	anonymized.TelegramID = 0
+	anonymized.RecentRooms = make([]analysis.RoomScore, len(risk.RecentRooms))
+	for i, room := range risk.RecentRooms {
+		room.ClosedBy = ids.ID(room.ClosedBy)
+		anonymized.RecentRooms[i] = room
+	}
+	return &anonymized
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationPurpose — призначення експортів адмінського API. Кожна відповідь є окремим
+// експортом зі своєю областю псевдонімів, тож псевдоніми різних відповідей не можна
+// зіставити між собою без реєстру.
+const moderationPurpose = "moderation"
+
+// pseudonymTTL — скільки псевдоніми з відповіді адмінського API можна передавати в пошук
+// (параметри id та user).
+const pseudonymTTL = 24 * time.Hour
+
+// errUnknownPseudonym — псевдонім не видавався або вже прострочений.
+var errUnknownPseudonym = errors.New("unknown pseudonym")
+
+// idMapping повертає псевдонімізацію ідентифікаторів користувачів для відповіді адмінського
+// API в новій області. Із параметром deanonymize=true відповідь містить справжні
+// ідентифікатори (nil), але лише для суперадміністраторів; іншим надсилається 403 і
+// повертається false.
+func (h *Handler) idMapping(c *gin.Context) (*anonymize.Mapping, bool) {
+	if c.Query("deanonymize") != "true" {
+		return anonymize.NewMapping(h.Anonymizer, anonymize.NewScope(moderationPurpose)), true
+	}
+	user := c.MustGet(webAppUserKey).(*models.User)
+	if !h.SuperAdminIDs[user.TelegramID] {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Superadmin access required to deanonymize"})
+		return nil, false
+	}
+	log.Printf("Superadmin %d deanonymized %s", user.TelegramID, c.Request.URL.Path)
+	return nil, true
+}
+
+// rememberPseudonyms зберігає псевдоніми, видані у відповіді, на pseudonymTTL, щоб
+// адміністратори могли шукати за ними.
+func (h *Handler) rememberPseudonyms(ids *anonymize.Mapping) {
+	if err := h.Storage.SavePseudonyms(ids.Pseudonyms(), pseudonymTTL); err != nil {
+		log.Printf("ERROR: Failed to save pseudonyms of a moderation export: %v", err)
+	}
+}
+
+// resolveUserRef повертає ідентифікатор користувача за псевдонімом із реєстру. Інші
+// посилання (анонімний або Telegram ID) повертаються як є.
+func (h *Handler) resolveUserRef(ref string) (string, error) {
+	if !anonymize.IsPseudonym(ref) {
+		return ref, nil
+	}
+	userID, err := h.Storage.ResolvePseudonym(ref)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return "", errUnknownPseudonym
+	}
+	return userID, nil
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"chatgogo/backend/internal/chathub"
 	"net/http"
 	"time"
 
@@ -43,3 +44,29 @@ func (h *Handler) GetAnonID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"token": token, "anon_id": anonID})
 }
+
+// CreateLinkCode видає одноразовий код, яким користувач вебчату прив'язує свою анонімну особу
+// до акаунта Telegram, надіславши боту /link КОД. Після цього вебчат підключається як
+// користувач Telegram, а чат, у якому він був, продовжується там.
+func (h *Handler) CreateLinkCode(c *gin.Context) {
+	anonID, ok := h.bearerAnonID(c)
+	if !ok {
+		return
+	}
+	linkedID, err := h.Storage.GetLinkedIdentity(anonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve identity"})
+		return
+	}
+	if linkedID != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Identity is linked already"})
+		return
+	}
+
+	code, err := h.Storage.CreateLinkCode(anonID, chathub.LinkCodeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": code, "expires_in": int(chathub.LinkCodeTTL.Seconds())})
+}
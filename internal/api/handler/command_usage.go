@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultCommandUsageTop — скільки найактивніших користувачів показувати для кожної команди.
+	defaultCommandUsageTop = 10
+	// maxCommandUsageTop — найбільше значення параметра top.
+	maxCommandUsageTop = 100
+)
+
+// CommandUsageReport — використання команди за годину разом із порогом зловживання.
+type CommandUsageReport struct {
+	models.CommandUsage
+	// Threshold — кількість викликів за годину, з якої користувач вважається порушником.
+	// Нуль означає, що поріг вимкнено.
+	Threshold int64 `json:"threshold"`
+}
+
+// GetCommandUsage повертає статистику команд бота за годину: загальну кількість викликів
+// кожної команди та найактивніших користувачів, серед яких позначено тих, хто досяг порогу
+// зловживання. Година задається параметром hour у форматі RFC 3339 (типово — поточна),
+// кількість користувачів — параметром top. Користувачів подано псевдонімами, якщо
+// суперадміністратор не попросив deanonymize=true.
+func (h *Handler) GetCommandUsage(c *gin.Context) {
+	ids, ok := h.idMapping(c)
+	if !ok {
+		return
+	}
+	hour := time.Now()
+	if v := c.Query("hour"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hour must be an RFC 3339 time"})
+			return
+		}
+		hour = parsed
+	}
+	top := defaultCommandUsageTop
+	if v := c.Query("top"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > maxCommandUsageTop {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "top must be between 1 and 100"})
+			return
+		}
+		top = parsed
+	}
+
+	reports, err := h.commandUsageReports(hour, top, ids)
+	if err != nil {
+		log.Printf("ERROR: Failed to load command usage: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Command usage unavailable"})
+		return
+	}
+	h.rememberPseudonyms(ids)
+	c.JSON(http.StatusOK, reports)
+}
+
+// commandUsageReports збирає статистику всіх команд, які рахує хаб, за годину hour, і
+// замінює користувачів їхніми псевдонімами з ids. Хаб рахує користувачів під псевдонімами
+// аналітики; їх перекладено через реєстр, а ті, що вже прострочені, залишено як є.
+func (h *Handler) commandUsageReports(hour time.Time, top int, ids *anonymize.Mapping) ([]CommandUsageReport, error) {
+	commands := chathub.TrackedCommands()
+	sort.Strings(commands)
+	reports := make([]CommandUsageReport, 0, len(commands))
+	for _, command := range commands {
+		usage, err := h.Storage.GetCommandUsage(command, hour, top)
+		if err != nil {
+			return nil, err
+		}
+		report := CommandUsageReport{CommandUsage: *usage, Threshold: h.CommandAbuseThresholds[command]}
+		for i := range report.TopUsers {
+			report.TopUsers[i].Outlier = report.Threshold > 0 && report.TopUsers[i].Count >= report.Threshold
+			userID, err := h.resolveUserRef(report.TopUsers[i].UserID)
+			if err != nil {
+				userID = report.TopUsers[i].UserID
+			}
+			report.TopUsers[i].UserID = ids.ID(userID)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commandUsageStorage — сховище, де /next за годину викликали двоє користувачів під
+// псевдонімами аналітики; псевдонім user_B уже прострочений.
+type commandUsageStorage struct {
+	storage.Storage
+}
+
+func (commandUsageStorage) GetCommandUsage(command string, at time.Time, limit int) (*models.CommandUsage, error) {
+	usage := &models.CommandUsage{Command: command, Hour: at.Truncate(time.Hour)}
+	if command == "next" {
+		usage.Total = 530
+		usage.TopUsers = []models.CommandUserCount{{UserID: "anon_a", Count: 500}, {UserID: "anon_b", Count: 30}}
+	}
+	return usage, nil
+}
+
+func (commandUsageStorage) ResolvePseudonym(pseudonym string) (string, error) {
+	if pseudonym == "anon_a" {
+		return "user_A", nil
+	}
+	return "", nil
+}
+
+func TestCommandUsageReports(t *testing.T) {
+	hub := chathub.NewManagerService(commandUsageStorage{})
+	hub.CommandAbuseThresholds = map[string]int64{"next": 200}
+	h := NewHandler(hub, commandUsageStorage{})
+
+	reports, err := h.commandUsageReports(time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), 10, nil)
+
+	require.NoError(t, err)
+	require.Len(t, reports, len(chathub.TrackedCommands()))
+	var next *CommandUsageReport
+	for i := range reports {
+		if reports[i].Command == "next" {
+			next = &reports[i]
+		}
+	}
+	require.NotNil(t, next)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), next.Hour)
+	assert.Equal(t, int64(200), next.Threshold)
+	assert.Equal(t, int64(530), next.Total)
+	assert.Equal(t, []models.CommandUserCount{
+		{UserID: "user_A", Count: 500, Outlier: true},
+		{UserID: "anon_b", Count: 30},
+	}, next.TopUsers)
+}
+
+func TestCommandUsageReports_Pseudonymized(t *testing.T) {
+	h := NewHandler(chathub.NewManagerService(commandUsageStorage{}), commandUsageStorage{})
+	ids := anonymize.NewMapping(anonymize.NewHMAC([]byte("key")), "moderation")
+
+	reports, err := h.commandUsageReports(time.Now(), 10, ids)
+
+	require.NoError(t, err)
+	for _, report := range reports {
+		if report.Command != "next" {
+			continue
+		}
+		require.Len(t, report.TopUsers, 2)
+		assert.Equal(t, map[string]string{report.TopUsers[0].UserID: "user_A"}, ids.Pseudonyms())
+		assert.Equal(t, "anon_b", report.TopUsers[1].UserID)
+	}
+}
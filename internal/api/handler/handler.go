@@ -1,18 +1,118 @@
 package handler
 
 import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/anonymize"
 	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"net/http"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// SnapshotSource знімає стан користувача в хабі, наприклад *chathub.ManagerService.
+type SnapshotSource interface {
+	Snapshot(ctx context.Context, userID string) (chathub.UserSnapshot, error)
+}
+
+// Storage — частина storage.Storage, якою користується Handler.
+type Storage interface {
+	// User operations
+	GetUserByTelegramID(telegramID int64) (*models.User, error)
+	GetUserByID(userID string) (*models.User, error)
+	UpdateUserMediaSpoiler(userID string, value bool) error
+	UpdateUserAge(userID string, age int) error
+	UpdateUserGender(userID string, gender string) error
+	UpdateUserInterests(userID string, interests []string) error
+	UpdateUserSearchPreferences(userID string, gender string, ageMin, ageMax int) error
+	UpdateUserRegion(userID string, region string) error
+	UpdateUserNearTimezone(userID string, value bool) error
+	UpdateUserHideTyping(userID string, value bool) error
+	UpdateUserHidePresence(userID string, value bool) error
+	UpdateUserLanguage(telegramID int64, languageCode string) error
+
+	// User State Management (Redis)
+	GetUserState(userID string) (string, error)
+
+	// Identity links (Redis)
+	CreateLinkCode(userID string, ttl time.Duration) (string, error)
+	GetLinkedIdentity(webID string) (string, error)
+
+	// Pseudonyms (Redis)
+	SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error
+	ResolvePseudonym(pseudonym string) (string, error)
+
+	// Room operations
+	GetActiveRoomIDForUser(userID string) (string, error)
+	ListRooms(filter models.RoomFilter) ([]models.RoomListing, error)
+
+	// Message and History operations
+	SearchHistory(search models.HistorySearch) ([]models.ChatHistory, error)
+
+	// Ban operations
+	IsUserBanned(anonID string) (bool, error)
+
+	// Command usage operations (Redis)
+	GetCommandUsage(command string, at time.Time, limit int) (*models.CommandUsage, error)
+
+	// Search Queue operations
+	GetSearchQueueStatus(userID string) (position, total int, err error)
+}
+
 // Handler містить посилання на ChatHub
 type Handler struct {
-	Hub *chathub.ManagerService
+	// Hub приймає WebSocket-клієнтів та їхні повідомлення.
+	Hub     chathub.Hub
+	Storage Storage
+	// Snapshots знімає стан користувачів у хабі цього інстансу для підтримки.
+	Snapshots SnapshotSource
+	// CommandAbuseThresholds — пороги команд на годину, з яких хаб вважає користувача
+	// зловмисником (див. chathub.ManagerService.CommandAbuseThresholds).
+	CommandAbuseThresholds map[string]int64
+	// BotToken використовується для перевірки initData Telegram WebApp.
+	BotToken string
+	// AdminIDs — Telegram ID адміністраторів, яким доступний адмінський API.
+	AdminIDs map[int64]bool
+	// RiskProfile складає профілі ризику користувачів для адмінського API.
+	RiskProfile *analysis.RiskProfile
+	// SuperAdminIDs — Telegram ID адміністраторів, яким адмінський API може показати справжні
+	// ідентифікатори користувачів замість псевдонімів.
+	SuperAdminIDs map[int64]bool
+	// Anonymizer створює псевдоніми користувачів для адмінського API; типово той самий, що
+	// в хабі, щоб перекладати псевдоніми аналітики.
+	Anonymizer anonymize.Anonymizer
+	// WSSendBuffer — місткість каналу надсилання кожного WebSocket-клієнта.
+	WSSendBuffer int
+}
+
+func NewHandler(hub *chathub.ManagerService, s Storage) *Handler {
+	return &Handler{
+		Hub:                    hub,
+		Storage:                s,
+		Snapshots:              hub,
+		CommandAbuseThresholds: hub.CommandAbuseThresholds,
+		Anonymizer:             hub.Anonymizer,
+		WSSendBuffer:           chathub.DefaultWebSocketSendBuffer,
+	}
 }
 
-func NewHandler(hub *chathub.ManagerService) *Handler {
-	return &Handler{Hub: hub}
+// bearerAnonID повертає AnonID з токена в заголовку Authorization. Якщо токена немає або він
+// недійсний, запит переривається з 401.
+func (h *Handler) bearerAnonID(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" || len(authHeader) < 7 || authHeader[:7] != "Bearer " {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization token missing"})
+		return "", false
+	}
+	anonID, err := h.validateAndGetAnonID(authHeader[7:])
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token or expired"})
+		return "", false
+	}
+	return anonID, true
 }
 
 // validateAndGetAnonID перевіряє токен та повертає AnonID
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultHistorySearchLimit — скільки повідомлень типово повертає пошук в історії.
+	defaultHistorySearchLimit = 50
+	// maxHistorySearchLimit — найбільше значення параметра limit.
+	maxHistorySearchLimit = 200
+)
+
+// HistoryHit — повідомлення з історії чатів, знайдене пошуком.
+type HistoryHit struct {
+	ID       uint              `json:"id"`
+	RoomID   string            `json:"room_id"`
+	SenderID string            `json:"sender_id"`
+	Type     string            `json:"type"`
+	Content  string            `json:"content"`
+	Metadata string            `json:"metadata,omitempty"`
+	MediaURL string            `json:"media_url,omitempty"`
+	Media    *models.MediaInfo `json:"media,omitempty"`
+	SentAt   time.Time         `json:"sent_at"`
+}
+
+// SearchHistory шукає повідомлення в історії чатів за ключовими словами (параметр q, з
+// "фразами в лапках", -виключенням та OR), щоб модератори могли розслідувати скарги. Пошук
+// можна обмежити кімнатою (room), відправником (user — анонімний, Telegram ID або псевдонім) та
+// проміжком часу (from, to у форматі RFC 3339); limit задає кількість результатів, від
+// найновіших. Відправників подано псевдонімами, якщо суперадміністратор не попросив
+// deanonymize=true.
+func (h *Handler) SearchHistory(c *gin.Context) {
+	ids, ok := h.idMapping(c)
+	if !ok {
+		return
+	}
+	search, err := parseHistorySearch(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if ref := c.Query("user"); ref != "" {
+		user, err := h.lookupUser(ref)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		search.SenderID = user.ID
+	}
+
+	history, err := h.Storage.SearchHistory(search)
+	if err != nil {
+		log.Printf("ERROR: Failed to search history for %q: %v", search.Query, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "History search unavailable"})
+		return
+	}
+	hits := historyHits(history, ids)
+	h.rememberPseudonyms(ids)
+	c.JSON(http.StatusOK, hits)
+}
+
+// parseHistorySearch читає пошук з параметрів запиту, крім відправника.
+func parseHistorySearch(query url.Values) (models.HistorySearch, error) {
+	search := models.HistorySearch{
+		Query:  strings.TrimSpace(query.Get("q")),
+		RoomID: query.Get("room"),
+		Limit:  defaultHistorySearchLimit,
+	}
+	if search.Query == "" {
+		return search, errors.New("q must not be empty")
+	}
+	if search.RoomID != "" {
+		if _, err := uuid.Parse(search.RoomID); err != nil {
+			return search, errors.New("room must be a room ID")
+		}
+	}
+	for param, bound := range map[string]*time.Time{"from": &search.From, "to": &search.To} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return search, errors.New(param + " must be an RFC 3339 time")
+			}
+			*bound = parsed
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxHistorySearchLimit {
+			return search, errors.New("limit must be between 1 and 200")
+		}
+		search.Limit = limit
+	}
+	return search, nil
+}
+
+// historyHits перетворює знайдені повідомлення на відповідь, замінюючи відправників їхніми
+// псевдонімами з ids.
+func historyHits(history []models.ChatHistory, ids *anonymize.Mapping) []HistoryHit {
+	hits := make([]HistoryHit, len(history))
+	for i, entry := range history {
+		hits[i] = HistoryHit{
+			ID:       entry.ID,
+			RoomID:   entry.RoomID,
+			SenderID: ids.ID(entry.SenderID),
+			Type:     entry.Type,
+			Content:  entry.Content,
+			Metadata: entry.Metadata,
+			MediaURL: entry.MediaURL,
+			Media:    entry.AttachedMedia(),
+			SentAt:   entry.CreatedAt,
+		}
+	}
+	return hits
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestParseHistorySearch(t *testing.T) {
+	search, err := parseHistorySearch(url.Values{
+		"q":     {"  send nudes  "},
+		"room":  {"6f1c2b9e-8f0a-4d7b-9a51-3c2e1d0f4a77"},
+		"from":  {"2024-05-01T00:00:00Z"},
+		"limit": {"20"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.HistorySearch{
+		Query:  "send nudes",
+		RoomID: "6f1c2b9e-8f0a-4d7b-9a51-3c2e1d0f4a77",
+		From:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Limit:  20,
+	}, search)
+}
+
+func TestParseHistorySearch_Rejects(t *testing.T) {
+	for name, query := range map[string]url.Values{
+		"no keywords":   {"q": {" "}},
+		"bad room":      {"q": {"hi"}, "room": {"lobby"}},
+		"bad time":      {"q": {"hi"}, "to": {"yesterday"}},
+		"limit too big": {"q": {"hi"}, "limit": {"1000"}},
+	} {
+		_, err := parseHistorySearch(query)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestHistoryHits_Pseudonymized(t *testing.T) {
+	ids := anonymize.NewMapping(anonymize.NewHMAC([]byte("key")), "moderation")
+	sentAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	history := []models.ChatHistory{{
+		Model:    gorm.Model{ID: 7, CreatedAt: sentAt},
+		RoomID:   "room1",
+		SenderID: "user_A",
+		Type:     "text",
+		Content:  "send nudes",
+	}}
+
+	hits := historyHits(history, ids)
+
+	require.Len(t, hits, 1)
+	assert.NotEqual(t, "user_A", hits[0].SenderID)
+	assert.Equal(t, map[string]string{hits[0].SenderID: "user_A"}, ids.Pseudonyms())
+	assert.Equal(t, HistoryHit{ID: 7, RoomID: "room1", SenderID: hits[0].SenderID, Type: "text", Content: "send nudes", SentAt: sentAt}, hits[0])
+	assert.Equal(t, "user_A", historyHits(history, nil)[0].SenderID)
+}
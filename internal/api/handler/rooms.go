@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultRoomListLimit — скільки кімнат типово повертає список.
+	defaultRoomListLimit = 50
+	// maxRoomListLimit — найбільше значення параметра limit.
+	maxRoomListLimit = 200
+)
+
+// RoomSummary — кімната у списку кімнат для адміністраторів.
+type RoomSummary struct {
+	RoomID       string     `json:"room_id"`
+	Participants []string   `json:"participants"`
+	Active       bool       `json:"active"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	CloseReason  string     `json:"close_reason,omitempty"`
+	QualityScore *int       `json:"quality_score,omitempty"`
+	// MessageCount — кількість повідомлень в історії кімнати; 0 після архівації.
+	MessageCount int64      `json:"message_count"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+}
+
+// ListRooms повертає кімнати, від найновіших, з кількістю повідомлень, щоб адміністратори
+// могли переглядати кімнати, а не лише шукати одну за ID. Список можна обмежити станом
+// (active=true або false), учасником (user — анонімний, Telegram ID або псевдонім), часом початку (from,
+// to у форматі RFC 3339) та кількістю повідомлень (min_messages, max_messages); limit і offset
+// задають сторінку. Учасників подано псевдонімами, якщо суперадміністратор не попросив
+// deanonymize=true.
+func (h *Handler) ListRooms(c *gin.Context) {
+	ids, ok := h.idMapping(c)
+	if !ok {
+		return
+	}
+	filter, err := parseRoomFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if ref := c.Query("user"); ref != "" {
+		user, err := h.lookupUser(ref)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		filter.ParticipantID = user.ID
+	}
+
+	rooms, err := h.Storage.ListRooms(filter)
+	if err != nil {
+		log.Printf("ERROR: Failed to list rooms: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Room list unavailable"})
+		return
+	}
+	summaries := roomSummaries(rooms, ids)
+	h.rememberPseudonyms(ids)
+	c.JSON(http.StatusOK, summaries)
+}
+
+// parseRoomFilter читає фільтр кімнат з параметрів запиту, крім учасника.
+func parseRoomFilter(query url.Values) (models.RoomFilter, error) {
+	filter := models.RoomFilter{Limit: defaultRoomListLimit}
+	if v := query.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("active must be true or false")
+		}
+		filter.Active = &active
+	}
+	for param, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, errors.New(param + " must be an RFC 3339 time")
+			}
+			*bound = parsed
+		}
+	}
+	if v := query.Get("min_messages"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 0 {
+			return filter, errors.New("min_messages must be a non-negative number")
+		}
+		filter.MinMessages = count
+	}
+	if v := query.Get("max_messages"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 0 {
+			return filter, errors.New("max_messages must be a non-negative number")
+		}
+		filter.MaxMessages = &count
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxRoomListLimit {
+			return filter, errors.New("limit must be between 1 and 200")
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, errors.New("offset must be a non-negative number")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
+
+// roomSummaries перетворює знайдені кімнати на відповідь, замінюючи учасників їхніми
+// псевдонімами з ids.
+func roomSummaries(rooms []models.RoomListing, ids *anonymize.Mapping) []RoomSummary {
+	summaries := make([]RoomSummary, len(rooms))
+	for i, room := range rooms {
+		summaries[i] = RoomSummary{
+			RoomID:       room.RoomID,
+			Participants: []string{ids.ID(room.User1ID), ids.ID(room.User2ID)},
+			Active:       room.IsActive,
+			StartedAt:    room.StartedAt,
+			CloseReason:  room.CloseReason,
+			QualityScore: room.QualityScore,
+			MessageCount: room.MessageCount,
+			ArchivedAt:   room.ArchivedAt,
+		}
+		if !room.IsActive && !room.EndedAt.IsZero() {
+			endedAt := room.EndedAt
+			summaries[i].EndedAt = &endedAt
+		}
+	}
+	return summaries
+}
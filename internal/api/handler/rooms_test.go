@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoomFilter(t *testing.T) {
+	filter, err := parseRoomFilter(url.Values{
+		"active":       {"false"},
+		"to":           {"2024-05-01T00:00:00Z"},
+		"min_messages": {"1"},
+		"max_messages": {"0"},
+		"offset":       {"50"},
+	})
+
+	require.NoError(t, err)
+	active, maxMessages := false, 0
+	assert.Equal(t, models.RoomFilter{
+		Active:      &active,
+		To:          time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		MinMessages: 1,
+		MaxMessages: &maxMessages,
+		Limit:       defaultRoomListLimit,
+		Offset:      50,
+	}, filter)
+}
+
+func TestParseRoomFilter_Rejects(t *testing.T) {
+	for name, query := range map[string]url.Values{
+		"bad state":         {"active": {"maybe"}},
+		"bad time":          {"from": {"yesterday"}},
+		"negative messages": {"min_messages": {"-1"}},
+		"limit too big":     {"limit": {"1000"}},
+		"bad offset":        {"offset": {"next"}},
+	} {
+		_, err := parseRoomFilter(query)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRoomSummaries_Pseudonymized(t *testing.T) {
+	ids := anonymize.NewMapping(anonymize.NewHMAC([]byte("key")), "moderation")
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rooms := []models.RoomListing{{
+		ChatRoom:     models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true, StartedAt: startedAt},
+		MessageCount: 12,
+	}}
+
+	summaries := roomSummaries(rooms, ids)
+
+	require.Len(t, summaries, 1)
+	assert.Equal(t, []string{ids.ID("user_A"), ids.ID("user_B")}, summaries[0].Participants)
+	assert.NotContains(t, summaries[0].Participants, "user_A")
+	assert.Equal(t, RoomSummary{RoomID: "room1", Participants: summaries[0].Participants, Active: true, StartedAt: startedAt, MessageCount: 12}, summaries[0])
+	assert.Equal(t, []string{"user_A", "user_B"}, roomSummaries(rooms, nil)[0].Participants)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportSnapshotTimeout — скільки запит знімка чекає на хаб.
+const supportSnapshotTimeout = 2 * time.Second
+
+// SupportSnapshot — живий стан користувача для підтримки: з'єднання та кімната з хабу цього
+// інстансу, а також черга пошуку, активна кімната, крок діалогу бота та бан зі сховища.
+type SupportSnapshot struct {
+	UserID     string `json:"user_id"`
+	TelegramID int64  `json:"telegram_id,omitempty"`
+	// Hub — стан у хабі цього інстансу; користувач, підключений до іншого інстансу, тут не
+	// підключений.
+	Hub chathub.UserSnapshot `json:"hub"`
+	// ActiveRoomID — активна кімната користувача за даними бази.
+	ActiveRoomID string `json:"active_room_id,omitempty"`
+	// Searching — чи стоїть користувач у спільній черзі пошуку в Redis.
+	Searching bool `json:"searching"`
+	// QueuePosition — місце в черзі (з 1), 0 поза чергою.
+	QueuePosition int `json:"queue_position,omitempty"`
+	QueueLength   int `json:"queue_length"`
+	// State — крок діалогу бота, на який чекає бот (наприклад, waiting_for_age_range).
+	State        string     `json:"state,omitempty"`
+	Banned       bool       `json:"banned"`
+	BotBlockedAt *time.Time `json:"bot_blocked_at,omitempty"`
+}
+
+// GetUserSnapshot повертає живий стан користувача, заданого анонімним, Telegram ID або
+// псевдонімом, щоб підтримка могла з'ясувати, чому користувач «застряг» у пошуку, без
+// доступу до серверів.
+// Ідентифікатори користувача замінено псевдонімом, якщо суперадміністратор не попросив
+// deanonymize=true.
+func (h *Handler) GetUserSnapshot(c *gin.Context) {
+	ids, ok := h.idMapping(c)
+	if !ok {
+		return
+	}
+	user, err := h.lookupUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), supportSnapshotTimeout)
+	defer cancel()
+	snapshot, err := h.supportSnapshot(ctx, user)
+	if err != nil {
+		log.Printf("ERROR: Failed to build support snapshot of %s: %v", user.ID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Snapshot unavailable"})
+		return
+	}
+	if ids != nil {
+		snapshot.UserID = ids.ID(snapshot.UserID)
+		snapshot.TelegramID = 0
+	}
+	h.rememberPseudonyms(ids)
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// lookupUser знаходить користувача за анонімним, Telegram ID або псевдонімом із реєстру.
+func (h *Handler) lookupUser(ref string) (*models.User, error) {
+	ref, err := h.resolveUserRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if telegramID, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return h.Storage.GetUserByTelegramID(telegramID)
+	}
+	return h.Storage.GetUserByID(ref)
+}
+
+// supportSnapshot збирає знімок стану користувача з хабу та сховища.
+func (h *Handler) supportSnapshot(ctx context.Context, user *models.User) (*SupportSnapshot, error) {
+	snapshot := &SupportSnapshot{UserID: user.ID, TelegramID: user.TelegramID, BotBlockedAt: user.BotBlockedAt}
+
+	var err error
+	if snapshot.Hub, err = h.Snapshots.Snapshot(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("hub: %w", err)
+	}
+	if snapshot.ActiveRoomID, err = h.Storage.GetActiveRoomIDForUser(user.ID); err != nil {
+		return nil, fmt.Errorf("active room: %w", err)
+	}
+	if snapshot.QueuePosition, snapshot.QueueLength, err = h.Storage.GetSearchQueueStatus(user.ID); err != nil {
+		return nil, fmt.Errorf("queue status: %w", err)
+	}
+	snapshot.Searching = snapshot.QueuePosition > 0
+	if snapshot.State, err = h.Storage.GetUserState(user.ID); err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+	if snapshot.Banned, err = h.Storage.IsUserBanned(user.ID); err != nil {
+		return nil, fmt.Errorf("ban: %w", err)
+	}
+	return snapshot, nil
+}
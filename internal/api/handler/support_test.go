@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// supportStorage — частина storage.Storage, яку використовує знімок стану.
+type supportStorage struct {
+	storage.Storage
+}
+
+func (s *supportStorage) GetActiveRoomIDs() ([]string, error)           { return nil, nil }
+func (s *supportStorage) SubscribeToRooms() storage.RoomSubscription    { return idleSubscription{} }
+func (s *supportStorage) GetActiveRoomIDForUser(string) (string, error) { return "", nil }
+func (s *supportStorage) GetSearchQueueStatus(string) (int, int, error) { return 3, 7, nil }
+func (s *supportStorage) GetUserState(string) (string, error)           { return "waiting_for_age_range", nil }
+func (s *supportStorage) IsUserBanned(string) (bool, error)             { return false, nil }
+
+// idleSubscription — підписка на кімнати, в яку нічого не надходить.
+type idleSubscription struct{}
+
+func (idleSubscription) Join(context.Context, ...string) error  { return nil }
+func (idleSubscription) Leave(context.Context, ...string) error { return nil }
+func (idleSubscription) Channel() <-chan *redis.Message         { return nil }
+func (idleSubscription) Close() error                           { return nil }
+
+func TestSupportSnapshot(t *testing.T) {
+	s := &supportStorage{}
+	hub := chathub.NewManagerService(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	h := NewHandler(hub, s)
+	snapshotCtx, cancelSnapshot := context.WithTimeout(context.Background(), time.Second)
+	defer cancelSnapshot()
+	snapshot, err := h.supportSnapshot(snapshotCtx, &models.User{ID: "user_A", TelegramID: 42})
+
+	require.NoError(t, err)
+	assert.Equal(t, &SupportSnapshot{
+		UserID:        "user_A",
+		TelegramID:    42,
+		Searching:     true,
+		QueuePosition: 3,
+		QueueLength:   7,
+		State:         "waiting_for_age_range",
+	}, snapshot)
+}
+
+func TestLookupUser_AcceptsPseudonyms(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	user, err := s.SaveUserIfNotExists(42)
+	require.NoError(t, err)
+	h := &Handler{Storage: s, Anonymizer: anonymize.NewHMAC([]byte("key"))}
+	ids := anonymize.NewMapping(h.Anonymizer, anonymize.NewScope(moderationPurpose))
+	pseudonym := ids.ID(user.ID)
+	h.rememberPseudonyms(ids)
+
+	found, err := h.lookupUser(pseudonym)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+	_, err = h.lookupUser("anon_unknown")
+	assert.ErrorIs(t, err, errUnknownPseudonym)
+}
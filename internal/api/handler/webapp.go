@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebAppInitDataMaxAge — максимальний вік initData, після якого запит WebApp відхиляється.
+const WebAppInitDataMaxAge = 24 * time.Hour
+
+// Обмеження на інтереси, що надсилаються з WebApp.
+const (
+	maxInterests      = 20
+	maxInterestLength = 32
+)
+
+// webAppUserKey — ключ gin.Context, під яким middleware зберігає автентифікованого користувача.
+const webAppUserKey = "webapp_user"
+
+// supportedLanguages — мови інтерфейсу, для яких є локалізація.
+var supportedLanguages = map[string]bool{"en": true, "ru": true, "ua": true}
+
+//go:embed webapp/index.html
+var webAppHTML []byte
+
+var (
+	errInitDataHash    = errors.New("init data signature mismatch")
+	errInitDataExpired = errors.New("init data expired")
+	errInitDataUser    = errors.New("init data has no user")
+)
+
+// WebAppUser — користувач Telegram, переданий у initData.
+type WebAppUser struct {
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LanguageCode string `json:"language_code"`
+}
+
+// ProfileResponse — профіль і налаштування користувача, що повертає REST API.
+type ProfileResponse struct {
+	Age                 int      `json:"age"`
+	Gender              string   `json:"gender"`
+	Interests           []string `json:"interests"`
+	Language            string   `json:"language"`
+	DefaultMediaSpoiler bool     `json:"default_media_spoiler"`
+	PreferredGender     string   `json:"preferred_gender"`
+	PreferredAgeMin     int      `json:"preferred_age_min"`
+	PreferredAgeMax     int      `json:"preferred_age_max"`
+	Region              string   `json:"region"`
+	PreferNearTimezone  bool     `json:"prefer_near_timezone"`
+	HideTyping          bool     `json:"hide_typing"`
+	HidePresence        bool     `json:"hide_presence"`
+	Completeness        int      `json:"completeness"`
+}
+
+// ProfileUpdateRequest — часткове оновлення профілю; відсутні поля не змінюються.
+type ProfileUpdateRequest struct {
+	Age                 *int      `json:"age"`
+	Gender              *string   `json:"gender"`
+	Interests           *[]string `json:"interests"`
+	Language            *string   `json:"language"`
+	DefaultMediaSpoiler *bool     `json:"default_media_spoiler"`
+	PreferredGender     *string   `json:"preferred_gender"`
+	PreferredAgeMin     *int      `json:"preferred_age_min"`
+	PreferredAgeMax     *int      `json:"preferred_age_max"`
+	Region              *string   `json:"region"`
+	PreferNearTimezone  *bool     `json:"prefer_near_timezone"`
+	HideTyping          *bool     `json:"hide_typing"`
+	HidePresence        *bool     `json:"hide_presence"`
+}
+
+// ValidateInitData перевіряє підпис initData Telegram WebApp (HMAC-SHA256 з ключем,
+// похідним від токена бота) та його свіжість і повертає користувача Telegram.
+func ValidateInitData(initData, botToken string, maxAge time.Duration, now time.Time) (*WebAppUser, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, err
+	}
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, errInitDataHash
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key != "hash" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + "=" + values.Get(key)
+	}
+
+	secret := hmacSHA256([]byte("WebAppData"), []byte(botToken))
+	expected := hex.EncodeToString(hmacSHA256(secret, []byte(strings.Join(lines, "\n"))))
+	if !hmac.Equal([]byte(expected), []byte(hash)) {
+		return nil, errInitDataHash
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil || now.Sub(time.Unix(authDate, 0)) > maxAge {
+		return nil, errInitDataExpired
+	}
+
+	var user WebAppUser
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return nil, errInitDataUser
+	}
+	return &user, nil
+}
+
+// hmacSHA256 обчислює HMAC-SHA256 повідомлення msg з ключем key.
+func hmacSHA256(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// ServeWebApp віддає сторінку Telegram WebApp для редагування профілю та налаштувань.
+func (h *Handler) ServeWebApp(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", webAppHTML)
+}
+
+// WebAppAuth — middleware, що автентифікує запити WebApp за заголовком
+// "Authorization: tma <initData>" і завантажує відповідного користувача.
+func (h *Handler) WebAppAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.BotToken == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "WebApp is not configured"})
+			return
+		}
+
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "tma ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization init data missing"})
+			return
+		}
+
+		tgUser, err := ValidateInitData(authHeader[4:], h.BotToken, WebAppInitDataMaxAge, time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired init data"})
+			return
+		}
+
+		user, err := h.Storage.GetUserByTelegramID(tgUser.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User not found, start the bot first"})
+			return
+		}
+
+		c.Set(webAppUserKey, user)
+		c.Next()
+	}
+}
+
+// GetProfile повертає профіль автентифікованого користувача.
+func (h *Handler) GetProfile(c *gin.Context) {
+	user := c.MustGet(webAppUserKey).(*models.User)
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+// UpdateProfile застосовує часткове оновлення профілю та повертає оновлений профіль.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	user := c.MustGet(webAppUserKey).(*models.User)
+
+	var req ProfileUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := req.apply(user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveProfile(user, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, newProfileResponse(user))
+}
+
+// apply перевіряє запит і переносить змінені поля до user.
+func (r *ProfileUpdateRequest) apply(user *models.User) error {
+	if r.Age != nil {
+		if *r.Age < models.MinUserAge || *r.Age > models.MaxUserAge {
+			return errors.New("age is out of range")
+		}
+		user.Age = *r.Age
+	}
+	if r.Gender != nil {
+		if !isValidGender(*r.Gender) || *r.Gender == "" {
+			return errors.New("invalid gender")
+		}
+		user.Gender = *r.Gender
+	}
+	if r.Interests != nil {
+		interests, err := cleanInterests(*r.Interests)
+		if err != nil {
+			return err
+		}
+		user.Interests = interests
+	}
+	if r.Language != nil {
+		if !supportedLanguages[*r.Language] {
+			return errors.New("unsupported language")
+		}
+		user.Language = *r.Language
+	}
+	if r.DefaultMediaSpoiler != nil {
+		user.DefaultMediaSpoiler = *r.DefaultMediaSpoiler
+	}
+	if r.PreferredGender != nil {
+		if !isValidGender(*r.PreferredGender) {
+			return errors.New("invalid preferred gender")
+		}
+		user.PreferredGender = *r.PreferredGender
+	}
+	if r.PreferredAgeMin != nil {
+		user.PreferredAgeMin = *r.PreferredAgeMin
+	}
+	if r.PreferredAgeMax != nil {
+		user.PreferredAgeMax = *r.PreferredAgeMax
+	}
+	for _, age := range []int{user.PreferredAgeMin, user.PreferredAgeMax} {
+		if age != 0 && (age < models.MinUserAge || age > models.MaxUserAge) {
+			return errors.New("preferred age is out of range")
+		}
+	}
+	if user.PreferredAgeMin != 0 && user.PreferredAgeMax != 0 && user.PreferredAgeMin > user.PreferredAgeMax {
+		return errors.New("preferred age range is empty")
+	}
+	if r.Region != nil {
+		if _, ok := models.RegionByCode(*r.Region); !ok && *r.Region != "" {
+			return errors.New("unknown region")
+		}
+		user.Region = *r.Region
+	}
+	if r.PreferNearTimezone != nil {
+		user.PreferNearTimezone = *r.PreferNearTimezone
+	}
+	if r.HideTyping != nil {
+		user.HideTyping = *r.HideTyping
+	}
+	if r.HidePresence != nil {
+		user.HidePresence = *r.HidePresence
+	}
+	return nil
+}
+
+// saveProfile зберігає поля, змінені запитом.
+func (h *Handler) saveProfile(user *models.User, req *ProfileUpdateRequest) error {
+	if req.Age != nil {
+		if err := h.Storage.UpdateUserAge(user.ID, user.Age); err != nil {
+			return err
+		}
+	}
+	if req.Gender != nil {
+		if err := h.Storage.UpdateUserGender(user.ID, user.Gender); err != nil {
+			return err
+		}
+	}
+	if req.Interests != nil {
+		if err := h.Storage.UpdateUserInterests(user.ID, user.Interests); err != nil {
+			return err
+		}
+	}
+	if req.Language != nil {
+		if err := h.Storage.UpdateUserLanguage(user.TelegramID, user.Language); err != nil {
+			return err
+		}
+	}
+	if req.DefaultMediaSpoiler != nil {
+		if err := h.Storage.UpdateUserMediaSpoiler(user.ID, user.DefaultMediaSpoiler); err != nil {
+			return err
+		}
+	}
+	if req.Region != nil {
+		if err := h.Storage.UpdateUserRegion(user.ID, user.Region); err != nil {
+			return err
+		}
+	}
+	if req.PreferNearTimezone != nil {
+		if err := h.Storage.UpdateUserNearTimezone(user.ID, user.PreferNearTimezone); err != nil {
+			return err
+		}
+	}
+	if req.HideTyping != nil {
+		if err := h.Storage.UpdateUserHideTyping(user.ID, user.HideTyping); err != nil {
+			return err
+		}
+	}
+	if req.HidePresence != nil {
+		if err := h.Storage.UpdateUserHidePresence(user.ID, user.HidePresence); err != nil {
+			return err
+		}
+	}
+	if req.PreferredGender != nil || req.PreferredAgeMin != nil || req.PreferredAgeMax != nil {
+		return h.Storage.UpdateUserSearchPreferences(user.ID, user.PreferredGender, user.PreferredAgeMin, user.PreferredAgeMax)
+	}
+	return nil
+}
+
+// isValidGender перевіряє стать; порожнє значення означає «будь-яка».
+func isValidGender(gender string) bool {
+	return gender == "" || gender == "male" || gender == "female"
+}
+
+// cleanInterests обрізає пробіли, прибирає порожні значення й дублікати та перевіряє обмеження.
+func cleanInterests(interests []string) ([]string, error) {
+	seen := make(map[string]bool, len(interests))
+	clean := make([]string, 0, len(interests))
+	for _, interest := range interests {
+		interest = strings.TrimSpace(interest)
+		key := strings.ToLower(interest)
+		if interest == "" || seen[key] {
+			continue
+		}
+		if len([]rune(interest)) > maxInterestLength {
+			return nil, errors.New("interest is too long")
+		}
+		seen[key] = true
+		clean = append(clean, interest)
+	}
+	if len(clean) > maxInterests {
+		return nil, errors.New("too many interests")
+	}
+	return clean, nil
+}
+
+// newProfileResponse формує відповідь API з моделі користувача.
+func newProfileResponse(user *models.User) ProfileResponse {
+	interests := []string(user.Interests)
+	if interests == nil {
+		interests = []string{}
+	}
+	return ProfileResponse{
+		Age:                 user.Age,
+		Gender:              user.Gender,
+		Interests:           interests,
+		Language:            user.Language,
+		DefaultMediaSpoiler: user.DefaultMediaSpoiler,
+		PreferredGender:     user.PreferredGender,
+		PreferredAgeMin:     user.PreferredAgeMin,
+		PreferredAgeMax:     user.PreferredAgeMax,
+		Region:              user.Region,
+		PreferNearTimezone:  user.PreferNearTimezone,
+		HideTyping:          user.HideTyping,
+		HidePresence:        user.HidePresence,
+		Completeness:        user.ProfileCompleteness(),
+	}
+}
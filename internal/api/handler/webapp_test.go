@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBotToken = "123456:TEST-TOKEN"
+
+// signInitData підписує initData так само, як це робить Telegram.
+func signInitData(values url.Values, botToken string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + "=" + values.Get(key)
+	}
+	secret := hmacSHA256([]byte("WebAppData"), []byte(botToken))
+	values.Set("hash", hex.EncodeToString(hmacSHA256(secret, []byte(strings.Join(lines, "\n")))))
+	return values.Encode()
+}
+
+func testInitValues(authDate time.Time) url.Values {
+	return url.Values{
+		"query_id":  {"AAHdF6IQAAAAAN0XohDhrOrc"},
+		"user":      {`{"id":42,"first_name":"Alice","language_code":"en"}`},
+		"auth_date": {strconv.FormatInt(authDate.Unix(), 10)},
+	}
+}
+
+func TestValidateInitData(t *testing.T) {
+	now := time.Now()
+
+	t.Run("valid signature", func(t *testing.T) {
+		initData := signInitData(testInitValues(now.Add(-time.Minute)), testBotToken)
+		user, err := ValidateInitData(initData, testBotToken, time.Hour, now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), user.ID)
+		assert.Equal(t, "en", user.LanguageCode)
+	})
+
+	t.Run("tampered data", func(t *testing.T) {
+		values, _ := url.ParseQuery(signInitData(testInitValues(now), testBotToken))
+		values.Set("user", `{"id":43,"first_name":"Mallory"}`)
+		_, err := ValidateInitData(values.Encode(), testBotToken, time.Hour, now)
+		assert.ErrorIs(t, err, errInitDataHash)
+	})
+
+	t.Run("wrong bot token", func(t *testing.T) {
+		initData := signInitData(testInitValues(now), "other:TOKEN")
+		_, err := ValidateInitData(initData, testBotToken, time.Hour, now)
+		assert.ErrorIs(t, err, errInitDataHash)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		initData := signInitData(testInitValues(now.Add(-2*time.Hour)), testBotToken)
+		_, err := ValidateInitData(initData, testBotToken, time.Hour, now)
+		assert.ErrorIs(t, err, errInitDataExpired)
+	})
+}
+
+func TestProfileUpdateRequestApply(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(v string) *string { return &v }
+	boolPtr := func(v bool) *bool { return &v }
+
+	t.Run("applies valid fields", func(t *testing.T) {
+		user := &models.User{}
+		interests := []string{" music ", "Music", "", "games"}
+		req := ProfileUpdateRequest{
+			Age:             intPtr(25),
+			Gender:          strPtr("female"),
+			Interests:       &interests,
+			PreferredAgeMin: intPtr(20),
+			PreferredAgeMax: intPtr(30),
+			Region:          strPtr("europe_east"),
+			HidePresence:    boolPtr(true),
+		}
+		require.NoError(t, req.apply(user))
+		assert.Equal(t, 25, user.Age)
+		assert.Equal(t, "female", user.Gender)
+		assert.Equal(t, []string{"music", "games"}, []string(user.Interests))
+		assert.Equal(t, 20, user.PreferredAgeMin)
+		assert.Equal(t, 30, user.PreferredAgeMax)
+		assert.Equal(t, "europe_east", user.Region)
+		assert.True(t, user.HidePresence)
+		assert.False(t, user.HideTyping)
+	})
+
+	invalid := map[string]ProfileUpdateRequest{
+		"age out of range":    {Age: intPtr(5)},
+		"unknown gender":      {Gender: strPtr("other")},
+		"unsupported lang":    {Language: strPtr("de")},
+		"empty age range":     {PreferredAgeMin: intPtr(40), PreferredAgeMax: intPtr(30)},
+		"preferred age range": {PreferredAgeMax: intPtr(200)},
+		"unknown region":      {Region: strPtr("mars")},
+	}
+	for name, req := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, req.apply(&models.User{}))
+		})
+	}
+}
@@ -18,20 +18,22 @@ var upgrader = websocket.Upgrader{
 
 // ServeWebSocket оновлює HTTP-з'єднання до WebSocket
 func (h *Handler) ServeWebSocket(c *gin.Context) {
-	// 1. Отримати AnonID з JWT (опускаємо логіку перевірки токена)
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" || len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization token missing"})
+	// 1. Отримати AnonID з JWT
+	anonID, ok := h.bearerAnonID(c)
+	if !ok {
 		return
 	}
-	tokenString := authHeader[7:]
 
-	// 2. Валідація та отримання AnonID з JWT
-	anonID, err := h.validateAndGetAnonID(tokenString)
+	// 2. Прив'язана до іншого користувача (див. CreateLinkCode) анонімна особа підключається
+	// як він.
+	linkedID, err := h.Storage.GetLinkedIdentity(anonID)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token or expired"})
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve identity"})
 		return
 	}
+	if linkedID != "" {
+		anonID = linkedID
+	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -44,11 +46,11 @@ func (h *Handler) ServeWebSocket(c *gin.Context) {
 		Hub:    h.Hub, // Додано посилання на Hub
 		UserID: anonID,
 		Conn:   conn, // Збереження з'єднання
-		Send:   make(chan models.ChatMessage, 256),
+		Send:   make(chan models.ChatMessage, h.WSSendBuffer),
 	}
 
 	// 2. Реєстрація клієнта в Chat Hub
-	h.Hub.RegisterCh <- client
+	h.Hub.Register(client)
 
 	// 3. Запуск клієнта (це замінює старі виклики WritePump/ReadPump)
 	// client.Run() сам запустить необхідні goroutines
@@ -0,0 +1,136 @@
+// Package archive moves the history of closed rooms out of PostgreSQL into an object store,
+// keeping the live database small. Each room becomes one transcript (see package transcript)
+// in the store, which moderators can still fetch as evidence; the room itself stays in the
+// database with the URL of its transcript. Transcripts hold pseudonyms instead of user IDs;
+// the pseudonyms of a room are those of its participants in the scope ScopeOf(room).
+package archive
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/media"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/transcript"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often closed rooms are archived.
+	DefaultInterval = 10 * time.Minute
+	// DefaultAfter is how long after a room closed its history is archived.
+	DefaultAfter = 30 * 24 * time.Hour
+	// DefaultBatchSize is the maximum number of rooms archived per run.
+	DefaultBatchSize = 100
+	// DefaultPrefix prefixes the keys of the transcripts in the store.
+	DefaultPrefix = "rooms/"
+
+	// contentType is the type of the uploaded transcripts, JSON Lines.
+	contentType = "application/x-ndjson"
+	// uploadTimeout bounds the upload of one transcript.
+	uploadTimeout = time.Minute
+)
+
+// Storage is the part of storage.Storage the Archiver uses.
+type Storage interface {
+	GetArchivableRooms(endedBefore time.Time, limit int) ([]models.ChatRoom, error)
+	GetChatHistory(roomID string) ([]models.ChatHistory, error)
+	MarkRoomArchived(roomID, url string) error
+}
+
+// Archiver is a background job that archives the history of rooms closed more than After
+// ago: it writes each room's history as a transcript to Store, and deletes it from the
+// database only once the upload succeeded. A room whose history could not be deleted after
+// the upload is uploaded again on the next run, under the same key.
+type Archiver struct {
+	// Storage provides access to the data persistence layer.
+	Storage Storage
+	// Store keeps the transcripts, e.g. a *media.S3Store.
+	Store media.Store
+	// Interval is the time between two runs.
+	Interval time.Duration
+	// After is the time since a room closed from which it is archived.
+	After time.Duration
+	// BatchSize is the maximum number of rooms archived per run.
+	BatchSize int
+	// Prefix prefixes the keys of the transcripts, which continue with the day the room
+	// ended and its ID, e.g. rooms/2025/01/31/<room ID>.jsonl.
+	Prefix string
+	// Anonymizer derives the pseudonyms of the participants. Its key must be kept to tell
+	// who is who in an archived transcript.
+	Anonymizer anonymize.Anonymizer
+}
+
+// NewArchiver creates and returns a new Archiver with default settings.
+func NewArchiver(s Storage, store media.Store) *Archiver {
+	return &Archiver{
+		Storage:    s,
+		Store:      store,
+		Interval:   DefaultInterval,
+		After:      DefaultAfter,
+		BatchSize:  DefaultBatchSize,
+		Prefix:     DefaultPrefix,
+		Anonymizer: anonymize.NewHMAC(anonymize.RandomKey()),
+	}
+}
+
+// ArchiveClosedRooms archives one batch of the rooms closed more than After before now, and
+// returns the number of rooms archived.
+func (a *Archiver) ArchiveClosedRooms(now time.Time) int {
+	rooms, err := a.Storage.GetArchivableRooms(now.Add(-a.After), a.BatchSize)
+	if err != nil {
+		log.Printf("ERROR: Failed to load closed rooms to archive: %v", err)
+		return 0
+	}
+
+	archived := 0
+	for _, room := range rooms {
+		if err := a.archiveRoom(room, now); err != nil {
+			log.Printf("ERROR: Failed to archive room %s: %v", room.RoomID, err)
+			continue
+		}
+		archived++
+	}
+
+	if archived > 0 {
+		log.Printf("Archiver: archived the history of %d closed rooms.", archived)
+	}
+	return archived
+}
+
+// archiveRoom uploads the transcript of a room and then deletes its history.
+func (a *Archiver) archiveRoom(room models.ChatRoom, now time.Time) error {
+	history, err := a.Storage.GetChatHistory(room.RoomID)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+	var buf bytes.Buffer
+	ids := anonymize.NewMapping(a.Anonymizer, ScopeOf(room))
+	if err := transcript.EncodeAnonymized(&buf, transcript.NewHeader(room, transcript.PurposeArchive, now), history, ids); err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	url, err := a.Store.Put(ctx, a.Key(room), contentType, &buf, int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+	if err := a.Storage.MarkRoomArchived(room.RoomID, url); err != nil {
+		return fmt.Errorf("uploaded to %s, but failed to delete the history: %w", url, err)
+	}
+	return nil
+}
+
+// ScopeOf returns the pseudonym scope of the transcript of a room: each archived room is an
+// export of its own.
+func ScopeOf(room models.ChatRoom) string {
+	return "archive:" + room.RoomID
+}
+
+// Key returns the key of the transcript of a room in the store.
+func (a *Archiver) Key(room models.ChatRoom) string {
+	return a.Prefix + room.EndedAt.UTC().Format("2006/01/02/") + room.RoomID + ".jsonl"
+}
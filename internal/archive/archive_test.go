@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/transcript"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// archiveStorage holds closed rooms and their history.
+type archiveStorage struct {
+	rooms    []models.ChatRoom
+	history  map[string][]models.ChatHistory
+	archived map[string]string
+	cutoff   time.Time
+}
+
+func (s *archiveStorage) GetArchivableRooms(endedBefore time.Time, limit int) ([]models.ChatRoom, error) {
+	s.cutoff = endedBefore
+	var result []models.ChatRoom
+	for _, room := range s.rooms {
+		if _, ok := s.archived[room.RoomID]; !ok && len(result) < limit {
+			result = append(result, room)
+		}
+	}
+	return result, nil
+}
+
+func (s *archiveStorage) GetChatHistory(roomID string) ([]models.ChatHistory, error) {
+	return s.history[roomID], nil
+}
+
+func (s *archiveStorage) MarkRoomArchived(roomID, url string) error {
+	s.archived[roomID] = url
+	delete(s.history, roomID)
+	return nil
+}
+
+// fakeStore records the stored files, and fails to store those whose key contains "unlucky".
+type fakeStore struct {
+	files        map[string]string
+	contentTypes map[string]string
+}
+
+func (f *fakeStore) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error) {
+	if strings.Contains(key, "unlucky") {
+		return "", errors.New("connection reset")
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	f.files[key], f.contentTypes[key] = string(data), contentType
+	return "https://archive.example.com/" + key, nil
+}
+
+func (f *fakeStore) Delete(ctx context.Context, url string) error {
+	delete(f.files, strings.TrimPrefix(url, "https://archive.example.com/"))
+	return nil
+}
+
+// TestArchiveClosedRoomsUploadsBeforePruning verifies that the history of a room is uploaded
+// as a transcript under a key of the day the room ended, and only deleted once uploaded.
+func TestArchiveClosedRoomsUploadsBeforePruning(t *testing.T) {
+	ended := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	s := &archiveStorage{
+		rooms: []models.ChatRoom{
+			{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", StartedAt: ended.Add(-time.Hour), EndedAt: ended},
+			{RoomID: "unlucky", User1ID: "user_C", User2ID: "user_D", EndedAt: ended},
+		},
+		history: map[string][]models.ChatHistory{
+			"room1":   {{Model: gorm.Model{ID: 1}, RoomID: "room1", SenderID: "user_A", Type: "text", Content: "hello"}},
+			"unlucky": {{Model: gorm.Model{ID: 2}, RoomID: "unlucky", SenderID: "user_C", Type: "text", Content: "hi"}},
+		},
+		archived: make(map[string]string),
+	}
+	store := &fakeStore{files: make(map[string]string), contentTypes: make(map[string]string)}
+	archiver := NewArchiver(s, store)
+	archiver.Anonymizer = anonymize.NewHMAC([]byte("key"))
+	now := ended.Add(DefaultAfter + time.Hour)
+
+	require.Equal(t, 1, archiver.ArchiveClosedRooms(now))
+	assert.Equal(t, now.Add(-DefaultAfter), s.cutoff)
+
+	key := "rooms/2025/01/31/room1.jsonl"
+	assert.Equal(t, "https://archive.example.com/"+key, s.archived["room1"])
+	assert.Equal(t, contentType, store.contentTypes[key])
+	header, messages, err := transcript.Decode(bytes.NewBufferString(store.files[key]))
+	require.NoError(t, err)
+	assert.Equal(t, transcript.PurposeArchive, header.Purpose)
+	assert.Equal(t, "room1", header.RoomID)
+	pseudonymA := archiver.Anonymizer.Pseudonym(ScopeOf(s.rooms[0]), "user_A")
+	assert.True(t, header.Pseudonymized)
+	assert.Equal(t, []string{pseudonymA, archiver.Anonymizer.Pseudonym(ScopeOf(s.rooms[0]), "user_B")}, header.Participants)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "hello", messages[0].Content)
+	assert.Equal(t, pseudonymA, messages[0].SenderID)
+
+	assert.NotContains(t, s.archived, "unlucky")
+	assert.Len(t, s.history["unlucky"], 1, "history must be kept when the upload failed")
+}
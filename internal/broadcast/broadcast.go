@@ -0,0 +1,125 @@
+// Package broadcast composes admin announcements with a variant per interface language, so
+// that every user receives an announcement in their own language instead of a single-language
+// blast.
+package broadcast
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language of a broadcast composed without language tags, and the
+// first fallback for users whose language has no variant.
+const DefaultLanguage = "en"
+
+// ErrEmpty is returned when a broadcast has no text.
+var ErrEmpty = errors.New("broadcast has no text")
+
+// languageTag matches a line starting a language variant, e.g. "ru: Привет".
+var languageTag = regexp.MustCompile(`^([a-z]{2,3}):\s*(.*)$`)
+
+// Message is an announcement with a text per language.
+type Message struct {
+	// Texts holds the announcement text by language code.
+	Texts map[string]string
+	// BaseLanguage is the language of the original text. It is the source of automatic
+	// translations, and the last fallback for users whose language has no variant.
+	BaseLanguage string
+}
+
+// Parse reads a broadcast composed as language-tagged blocks:
+//
+//	en: Hello everyone!
+//	ru: Всем привет!
+//
+// A line starting with the tag of one of the given languages starts the variant for that
+// language, which runs until the next tag and may span several lines. Text before the first
+// tag is in DefaultLanguage. The first variant is the base text.
+func Parse(text string, languages []string) (Message, error) {
+	msg := Message{Texts: make(map[string]string)}
+	lang := DefaultLanguage
+	var lines []string
+	flush := func() {
+		if body := strings.TrimSpace(strings.Join(lines, "\n")); body != "" {
+			msg.Texts[lang] = body
+			if msg.BaseLanguage == "" {
+				msg.BaseLanguage = lang
+			}
+		}
+		lines = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if m := languageTag.FindStringSubmatch(strings.TrimSpace(line)); m != nil && slices.Contains(languages, m[1]) {
+			flush()
+			lang = m[1]
+			line = m[2]
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	if msg.BaseLanguage == "" {
+		return Message{}, ErrEmpty
+	}
+	return msg, nil
+}
+
+// Languages returns the languages the message has a variant for, sorted.
+func (m Message) Languages() []string {
+	languages := make([]string, 0, len(m.Texts))
+	for lang := range m.Texts {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// TextFor returns the text to send to a user with the given language, and the language of
+// that text: the variant in the user's language, falling back to DefaultLanguage and then to
+// the base text.
+func (m Message) TextFor(lang string) (text, textLang string) {
+	for _, candidate := range []string{lang, DefaultLanguage, m.BaseLanguage} {
+		if text := m.Texts[candidate]; text != "" {
+			return text, candidate
+		}
+	}
+	return "", ""
+}
+
+// Report summarizes the delivery of a broadcast.
+type Report struct {
+	// Sent counts the users who received the broadcast, by the language of the text they got.
+	Sent map[string]int
+	// Blocked counts the users who could not receive it because they blocked the bot.
+	Blocked int
+	// Failed counts the users it could not be delivered to for other reasons.
+	Failed int
+}
+
+// Summary lists the number of users reached per language, e.g. "en: 120, ru: 80".
+func (r Report) Summary() string {
+	languages := make([]string, 0, len(r.Sent))
+	for lang := range r.Sent {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	parts := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		parts = append(parts, lang+": "+strconv.Itoa(r.Sent[lang]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Total returns the number of users who received the broadcast.
+func (r Report) Total() int {
+	total := 0
+	for _, n := range r.Sent {
+		total += n
+	}
+	return total
+}
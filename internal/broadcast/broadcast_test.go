@@ -0,0 +1,55 @@
+package broadcast_test
+
+import (
+	"chatgogo/backend/internal/broadcast"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var languages = []string{"en", "ru", "ua"}
+
+// TestParse verifies that language-tagged blocks are split into variants.
+func TestParse(t *testing.T) {
+	msg, err := broadcast.Parse("ru: Привет!\nНовая функция.\n\nua: Привіт!\nps: not a language", languages)
+	assert.NoError(t, err)
+	assert.Equal(t, "ru", msg.BaseLanguage)
+	assert.Equal(t, map[string]string{
+		"ru": "Привет!\nНовая функция.",
+		"ua": "Привіт!\nps: not a language",
+	}, msg.Texts)
+	assert.Equal(t, []string{"ru", "ua"}, msg.Languages())
+
+	msg, err = broadcast.Parse("Hello everyone!", languages)
+	assert.NoError(t, err)
+	assert.Equal(t, broadcast.Message{Texts: map[string]string{"en": "Hello everyone!"}, BaseLanguage: "en"}, msg)
+
+	_, err = broadcast.Parse(" \nru: ", languages)
+	assert.ErrorIs(t, err, broadcast.ErrEmpty)
+}
+
+// TestTextFor verifies the fallback from a missing variant to English and then to the base text.
+func TestTextFor(t *testing.T) {
+	msg := broadcast.Message{Texts: map[string]string{"ru": "Привет", "en": "Hello"}, BaseLanguage: "ru"}
+
+	text, lang := msg.TextFor("ru")
+	assert.Equal(t, "Привет", text)
+	assert.Equal(t, "ru", lang)
+
+	text, lang = msg.TextFor("ua")
+	assert.Equal(t, "Hello", text)
+	assert.Equal(t, "en", lang)
+
+	delete(msg.Texts, "en")
+	text, lang = msg.TextFor("ua")
+	assert.Equal(t, "Привет", text)
+	assert.Equal(t, "ru", lang)
+}
+
+// TestReportSummary verifies the per-language delivery summary.
+func TestReportSummary(t *testing.T) {
+	report := broadcast.Report{Sent: map[string]int{"ru": 80, "en": 120}}
+
+	assert.Equal(t, "en: 120, ru: 80", report.Summary())
+	assert.Equal(t, 200, report.Total())
+}
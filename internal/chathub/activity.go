@@ -0,0 +1,92 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"time"
+)
+
+const (
+	// DefaultGhostNudgeAfter is how long a partner may stay silent before receiving a nudge.
+	DefaultGhostNudgeAfter = 5 * time.Minute
+	// DefaultGhostSkipOfferAfter is how long the waiting user waits before being offered a skip.
+	DefaultGhostSkipOfferAfter = 10 * time.Minute
+	// DefaultActivityCheckInterval is how often the hub scans rooms for silent partners.
+	DefaultActivityCheckInterval = 30 * time.Second
+)
+
+// roomActivity tracks the conversational state of a single room for anti-ghosting purposes.
+type roomActivity struct {
+	// waitingUserID is the user who sent the latest unanswered message(s).
+	waitingUserID string
+	// silentUserID is the partner who has not replied yet.
+	silentUserID string
+	// waitingSince is the time of the first unanswered message.
+	waitingSince time.Time
+	// nudged reports whether the silent partner has already been nudged.
+	nudged bool
+	// skipOffered reports whether the waiting user has already been offered a skip.
+	skipOffered bool
+}
+
+// isConversationalMessage reports whether a message type counts as a real chat reply.
+// System notifications, commands, and edits do not reset the ghosting timers.
+func isConversationalMessage(msgType string) bool {
+	switch msgType {
+	case "text", "photo", "video", "animation", "sticker", "voice", "video_note":
+		return true
+	}
+	return false
+}
+
+// trackRoomActivity records a relayed message from senderID to recipientID in the given room.
+// A reply from the silent side resets the room, while further messages from the waiting
+// side keep the original waitingSince timestamp.
+func (m *ManagerService) trackRoomActivity(roomID, senderID, recipientID string, now time.Time) {
+	activity, ok := m.roomActivity[roomID]
+	if ok && activity.waitingUserID == senderID {
+		return // Still waiting for the same partner; keep the original timer.
+	}
+
+	m.roomActivity[roomID] = &roomActivity{
+		waitingUserID: senderID,
+		silentUserID:  recipientID,
+		waitingSince:  now,
+	}
+}
+
+// forgetRoomActivity drops the activity timers of a room, e.g. when it is closed.
+func (m *ManagerService) forgetRoomActivity(roomID string) {
+	delete(m.roomActivity, roomID)
+}
+
+// checkRoomActivity scans all tracked rooms and sends nudges to silent partners and
+// skip offers to users who have been waiting for too long.
+func (m *ManagerService) checkRoomActivity(now time.Time) {
+	for roomID, activity := range m.roomActivity {
+		waited := now.Sub(activity.waitingSince)
+
+		if !activity.nudged && waited >= m.GhostNudgeAfter {
+			if client, ok := m.Clients[activity.silentUserID]; ok && client.GetRoomID() == roomID {
+				m.sendToClient(client, models.ChatMessage{
+					Type:     "system_info",
+					Content:  "system_ghost_nudge",
+					RoomID:   roomID,
+					SenderID: "system",
+				})
+			}
+			activity.nudged = true
+		}
+
+		if !activity.skipOffered && waited >= m.GhostSkipOfferAfter {
+			if client, ok := m.Clients[activity.waitingUserID]; ok && client.GetRoomID() == roomID {
+				m.sendToClient(client, models.ChatMessage{
+					Type:     "system_ghost_skip_offer",
+					Content:  "system_ghost_skip_offer",
+					RoomID:   roomID,
+					SenderID: "system",
+				})
+			}
+			activity.skipOffered = true
+		}
+	}
+}
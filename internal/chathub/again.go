@@ -0,0 +1,148 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultRematchWindow is how long after a chat ends its participants can agree to chat again.
+const DefaultRematchWindow = 10 * time.Minute
+
+// noRematchReasons are the close reasons of chats that can never be resumed with /again.
+var noRematchReasons = map[string]bool{"block": true, "report_end": true, "ban": true, "bot_blocked": true}
+
+// Rematch asks the matcher to open a new room between two users who both sent /again.
+type Rematch struct {
+	User1ID string
+	User2ID string
+}
+
+// handleAgainCommand processes /again, sent by a user who wants to chat again with the
+// partner of their last chat. The request is kept in storage until RematchWindow after that
+// chat ended; once the partner sends /again too, the matcher of the instance the partner sent
+// it to opens a new room for the pair. A partner connected to another instance is offered the
+// rematch through that instance. Chats that ended with a block, a report or a ban cannot be
+// resumed.
+func (m *ManagerService) handleAgainCommand(message models.ChatMessage) {
+	userID := message.SenderID
+	if m.rejectBanned(userID) {
+		return
+	}
+	if message.RoomID != "" {
+		m.sendAgainNotice(userID, "system_again_in_chat")
+		return
+	}
+
+	partnerID, expiresIn := m.rematchPartner(userID)
+	if partnerID == "" {
+		m.sendAgainNotice(userID, "system_again_unavailable")
+		return
+	}
+	if partnerRoom, err := m.Storage.GetActiveRoomIDForUser(partnerID); err != nil || partnerRoom != "" {
+		if err != nil {
+			log.Printf("ERROR: Failed to find active room of user %s: %v", partnerID, err)
+		}
+		m.sendAgainNotice(userID, "system_again_partner_busy")
+		return
+	}
+
+	agreed, err := m.Storage.TakeRematchRequest(partnerID, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check rematch request of %s for %s: %v", partnerID, userID, err)
+		return
+	}
+	if agreed {
+		if !m.requestRematch(Rematch{User1ID: partnerID, User2ID: userID}) {
+			// Keep the partner's agreement so that the user can try again.
+			if err := m.Storage.AddRematchRequest(partnerID, userID, expiresIn); err != nil {
+				log.Printf("ERROR: Failed to restore rematch request of %s for %s: %v", partnerID, userID, err)
+			}
+		}
+		return
+	}
+
+	if err := m.Storage.AddRematchRequest(userID, partnerID, expiresIn); err != nil {
+		log.Printf("ERROR: Failed to save rematch request of %s for %s: %v", userID, partnerID, err)
+		return
+	}
+	log.Printf("User %s asked to chat again with %s", userID, partnerID)
+	m.sendAgainNotice(userID, "system_again_requested")
+	offer := models.ChatMessage{
+		Type:     "system_again_offer",
+		Content:  "system_again_offer",
+		SenderID: "system",
+	}
+	if client, ok := m.Clients[partnerID]; ok {
+		m.sendToClient(client, offer)
+	} else {
+		m.forwardToInstance(partnerID, offer)
+	}
+}
+
+// rematchPartner returns the partner of a user's last chat and how long they can still agree
+// to chat again, or "" if the chat cannot be resumed: it ended more than RematchWindow ago,
+// for a reason in noRematchReasons, or one of them blocked the other or is banned.
+func (m *ManagerService) rematchPartner(userID string) (string, time.Duration) {
+	room, err := m.Storage.GetLastClosedRoomForUser(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load last room of user %s: %v", userID, err)
+		return "", 0
+	}
+	if room == nil || noRematchReasons[room.CloseReason] {
+		return "", 0
+	}
+	expiresIn := m.RematchWindow - time.Since(room.EndedAt)
+	if expiresIn <= 0 {
+		return "", 0
+	}
+
+	partnerID := partnerOf(room, userID)
+	user, err := m.Storage.GetUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for a rematch: %v", userID, err)
+		return "", 0
+	}
+	partner, err := m.Storage.GetUserByID(partnerID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for a rematch: %v", partnerID, err)
+		return "", 0
+	}
+	if user.HasBlocked(partnerID) || partner.HasBlocked(userID) {
+		return "", 0
+	}
+	if banned, err := m.Storage.IsUserBanned(partnerID); err != nil || banned {
+		return "", 0
+	}
+	return partnerID, expiresIn
+}
+
+// sendAgainNotice sends a system_info notice about /again to a user.
+func (m *ManagerService) sendAgainNotice(userID, content string) {
+	if client, ok := m.Clients[userID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  content,
+			SenderID: "system",
+		})
+	}
+}
+
+// Rematch opens a new room between two users who agreed to chat again, without going
+// through the queue. Users who started a new search in the meantime are taken out of it. Any
+// instance's matcher may open the room, as the match locks keep the leader from matching the
+// users meanwhile; a user whose client another instance holds is told through it (see
+// deliverMatch).
+func (m *MatcherService) Rematch(r Rematch) {
+	m.RemoveUserFromQueue(r.User1ID)
+	m.RemoveUserFromQueue(r.User2ID)
+
+	roomID, err := m.openRoom(r.User1ID, r.User2ID, "system_again_match_found")
+	m.forget(r.User1ID)
+	m.forget(r.User2ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to save rematch room of %s and %s: %v", r.User1ID, r.User2ID, err)
+		return
+	}
+	log.Printf("Rematch: %s and %s in room %s", r.User1ID, r.User2ID, roomID)
+}
@@ -0,0 +1,164 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newAgainHub returns a hub where user_A and user_B are connected and their last chat, room1,
+// closed a minute ago for the given reason.
+func newAgainHub(storageMock *MockStorage, closeReason string) (*chathub.ManagerService, *MockClient, *MockClient) {
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", EndedAt: time.Now().Add(-time.Minute), CloseReason: closeReason}
+	for _, id := range []string{"user_A", "user_B"} {
+		storageMock.On("IsUserBanned", id).Return(false, nil)
+		storageMock.On("GetLastClosedRoomForUser", id).Return(room, nil)
+		storageMock.On("GetUserByID", id).Return(&models.User{ID: id}, nil)
+		storageMock.On("GetActiveRoomIDForUser", id).Return("", nil)
+	}
+
+	return hub, addTestClient(hub, "user_A", ""), addTestClient(hub, "user_B", "")
+}
+
+// TestManager_AgainNeedsBothUsers verifies that /again offers the partner to chat again, and
+// that the pair is handed to the matcher once the partner agrees.
+func TestManager_AgainNeedsBothUsers(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA, clientB := newAgainHub(storageMock, "stop")
+	storageMock.On("TakeRematchRequest", "user_B", "user_A").Return(false, nil).Once()
+	storageMock.On("AddRematchRequest", "user_A", "user_B", mock.AnythingOfType("time.Duration")).Return(nil).Once()
+	storageMock.On("TakeRematchRequest", "user_A", "user_B").Return(true, nil).Once()
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_again", SenderID: "user_A"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Empty(t, hub.RematchCh)
+	assert.Equal(t, "system_again_requested", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_again_offer", (<-clientB.RecvChannel).Type)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_again", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, chathub.Rematch{User1ID: "user_A", User2ID: "user_B"}, <-hub.RematchCh)
+}
+
+// TestManager_AgainAfterBlockIsUnavailable verifies that a chat ended with /block cannot be
+// resumed.
+func TestManager_AgainAfterBlockIsUnavailable(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA, clientB := newAgainHub(storageMock, "block")
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_again", SenderID: "user_A"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "system_again_unavailable", (<-clientA.RecvChannel).Content)
+	assert.Empty(t, clientB.RecvChannel)
+	storageMock.AssertNotCalled(t, "AddRematchRequest", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestMatcherRematch verifies that an agreed rematch opens a room for the pair directly,
+// taking them out of the queue.
+func TestMatcherRematch(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("RemoveUserFromSearchQueue", "user_A").Return(nil).Once()
+	storageMock.On("RemoveUserFromSearchQueue", "user_B").Return(nil).Once()
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: time.Now()})
+
+	matcher.Rematch(chathub.Rematch{User1ID: "user_A", User2ID: "user_B"})
+
+	storageMock.AssertExpectations(t)
+	assert.False(t, matcher.Queue.Contains("user_A"))
+	foundA, foundB := <-clientA.RecvChannel, <-clientB.RecvChannel
+	assert.Equal(t, "system_match_found", foundA.Type)
+	assert.Equal(t, "system_again_match_found", foundA.Content)
+	assert.Equal(t, foundA.RoomID, foundB.RoomID)
+	assert.Equal(t, foundA.RoomID, clientA.GetRoomID())
+}
+
+// TestManager_AgainOffersRematchThroughInstanceOfPartner verifies that a partner connected to
+// another instance is offered the rematch through that instance.
+func TestManager_AgainOffersRematchThroughInstanceOfPartner(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA, _ := newAgainHub(storageMock, "stop")
+	delete(hub.Clients, "user_B")
+	hub.InstanceID = "instance-1"
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil).Maybe()
+	storageMock.On("RegisterClientInstance", "instance-1", mock.Anything, chathub.DefaultClientRegistryTTL).Return(nil).Maybe()
+	storageMock.On("TakeRematchRequest", "user_B", "user_A").Return(false, nil).Once()
+	storageMock.On("AddRematchRequest", "user_A", "user_B", mock.AnythingOfType("time.Duration")).Return(nil).Once()
+	storageMock.On("GetClientInstance", "user_B").Return("instance-2", nil)
+	offered := make(chan models.ChatMessage, 1)
+	storageMock.On("PublishMessage", "instance:instance-2", mock.MatchedBy(func(msg models.ChatMessage) bool {
+		return msg.Type == "instance_notice" && msg.SenderID == "user_B"
+	})).Run(func(args mock.Arguments) {
+		var notice models.ChatMessage
+		assert.NoError(t, json.Unmarshal([]byte(args.Get(1).(models.ChatMessage).Content), &notice))
+		offered <- notice
+	}).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_again", SenderID: "user_A"}
+
+	assert.Equal(t, "system_again_requested", (<-clientA.RecvChannel).Content)
+	select {
+	case notice := <-offered:
+		assert.Equal(t, "system_again_offer", notice.Type)
+	case <-time.After(time.Second):
+		t.Fatal("the offer was not forwarded to the instance of the partner")
+	}
+}
+
+// TestMatcherRematchTellsPartnerThroughTheirInstance verifies that a rematch opened on the
+// instance of one user tells the other through the instance holding their client.
+func TestMatcherRematchTellsPartnerThroughTheirInstance(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	hub.InstanceID = "instance-1"
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("RemoveUserFromSearchQueue", mock.Anything).Return(nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetClientInstance", "user_A").Return("instance-2", nil)
+	var forwarded models.ChatMessage
+	storageMock.On("PublishMessage", "instance:instance-2", mock.MatchedBy(func(msg models.ChatMessage) bool {
+		return msg.Type == "instance_notice" && msg.SenderID == "user_A" && json.Unmarshal([]byte(msg.Content), &forwarded) == nil
+	})).Return(nil).Once()
+
+	clientB := newMockClient("user_B")
+	hub.Clients["user_B"] = clientB
+
+	matcher.Rematch(chathub.Rematch{User1ID: "user_A", User2ID: "user_B"})
+
+	storageMock.AssertExpectations(t)
+	found := <-clientB.RecvChannel
+	assert.Equal(t, "system_again_match_found", found.Content)
+	assert.Equal(t, "system_again_match_found", forwarded.Content)
+	assert.Equal(t, found.RoomID, forwarded.RoomID)
+}
@@ -0,0 +1,89 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"log"
+)
+
+// DefaultMatchRequestCapacity is the number of search requests that may wait for the matcher
+// before new ones are rejected.
+const DefaultMatchRequestCapacity = 1000
+
+var (
+	matchRequestsPending = metrics.Default.NewGauge("chatgogo_hub_match_requests_pending",
+		"Search requests waiting in the hub for the matcher.")
+	matchRequestsRejected = metrics.Default.NewCounterVec("chatgogo_hub_match_requests_rejected_total",
+		"Search requests rejected because the matcher backlog was full.")
+)
+
+// requestMatch hands a search request to the matcher without blocking the hub. If
+// MatchRequestCh is full, e.g. during a traffic spike, the request is dropped and the user is
+// told that the service is busy. It reports whether the request was accepted.
+func (m *ManagerService) requestMatch(req models.SearchRequest) bool {
+	select {
+	case m.MatchRequestCh <- req:
+		m.recordMatchBacklog()
+		return true
+	default:
+	}
+
+	matchRequestsRejected.Inc()
+	channelOverflows.Inc(overflowMatchRequests)
+	log.Printf("WARNING: Matcher backlog is full (%d requests), rejecting search of user %s.", cap(m.MatchRequestCh), req.UserID)
+	if client, ok := m.Clients[req.UserID]; ok {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorServiceBusy, "system_service_busy"))
+	}
+	return false
+}
+
+// requestRematch hands a rematch to the matcher without blocking the hub. If RematchCh is
+// full, the rematch is dropped and the user who agreed last is told that the service is busy.
+// It reports whether the rematch was accepted.
+func (m *ManagerService) requestRematch(r Rematch) bool {
+	select {
+	case m.RematchCh <- r:
+		return true
+	default:
+	}
+
+	channelOverflows.Inc(overflowRematches)
+	log.Printf("WARNING: Rematches are backed up, rejecting rematch of %s and %s.", r.User1ID, r.User2ID)
+	if client, ok := m.Clients[r.User2ID]; ok {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorServiceBusy, "system_service_busy"))
+	}
+	return false
+}
+
+// recordMatchBacklog reports the number of search requests waiting for the matcher.
+func (m *ManagerService) recordMatchBacklog() {
+	matchRequestsPending.Set(float64(len(m.MatchRequestCh)))
+}
+
+// dequeue hands the removal of a user from the matchmaking queue to the matcher without
+// blocking the hub. If CancelSearchCh is full, the removal waits in the hub and is handed over
+// again on the next delivery retry (see retryCancellations).
+func (m *ManagerService) dequeue(userID string) {
+	select {
+	case m.CancelSearchCh <- userID:
+		return
+	default:
+	}
+	channelOverflows.Inc(overflowSearchCancellations)
+	log.Printf("WARNING: Search cancellations are backed up, holding the cancellation of user %s.", userID)
+	m.cancellations = append(m.cancellations, userID)
+}
+
+// retryCancellations hands the search cancellations that found CancelSearchCh full to the
+// matcher, as far as it takes them.
+func (m *ManagerService) retryCancellations() {
+	for len(m.cancellations) > 0 {
+		select {
+		case m.CancelSearchCh <- m.cancellations[0]:
+			m.cancellations = m.cancellations[1:]
+		default:
+			return
+		}
+	}
+	m.cancellations = nil
+}
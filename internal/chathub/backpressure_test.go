@@ -0,0 +1,100 @@
+package chathub_test
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultMetric returns the value of a series of the default metrics registry, or 0 if it
+// was not recorded yet.
+func defaultMetric(t *testing.T, series string) float64 {
+	var buf bytes.Buffer
+	require.NoError(t, metrics.Default.Write(&buf))
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+// TestManager_FullMatchBacklogRejectsSearch verifies that a search is rejected with a
+// "service busy" notice, instead of blocking the hub, when the matcher backlog is full.
+func TestManager_FullMatchBacklogRejectsSearch(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	hub.MatchRequestCh = make(chan models.SearchRequest, 1)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+	storageMock.On("IsUserBanned", "user_B").Return(false, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	overflows := defaultMetric(t, `chatgogo_hub_channel_overflows_total{channel="match_requests"}`)
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, overflows+1, defaultMetric(t, `chatgogo_hub_channel_overflows_total{channel="match_requests"}`))
+
+	assert.Equal(t, "user_A", (<-hub.MatchRequestCh).UserID)
+	assert.Empty(t, hub.MatchRequestCh)
+	assert.Equal(t, "system_search_start", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_service_busy", (<-clientB.RecvChannel).Content)
+	assert.Empty(t, clientB.RecvChannel, "A rejected search is not confirmed")
+}
+
+func TestManager_SetChannelBuffer(t *testing.T) {
+	hub := chathub.NewManagerService(new(MockStorage))
+	assert.Equal(t, chathub.DefaultChannelBuffer, cap(hub.IncomingCh))
+
+	hub.SetChannelBuffer(64)
+	assert.Equal(t, 64, cap(hub.IncomingCh))
+	assert.Equal(t, 64, cap(hub.PubSubCh))
+	assert.Equal(t, 64, cap(hub.RegisterCh))
+	assert.Equal(t, chathub.DefaultMatchRequestCapacity, cap(hub.MatchRequestCh))
+}
+
+// TestManager_FullCancelSearchChHoldsCancellation verifies that the hub does not block when
+// CancelSearchCh is full, and hands the cancellation to the matcher once there is room.
+func TestManager_FullCancelSearchChHoldsCancellation(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	hub.CancelSearchCh = make(chan string, 1)
+	hub.CancelSearchCh <- "user_X"
+	hub.DeliveryRetryDelay = 10 * time.Millisecond
+	storageMock.On("SetUserBotBlocked", "user_A", true).Return(nil)
+
+	overflows := defaultMetric(t, `chatgogo_hub_channel_overflows_total{channel="search_cancellations"}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_bot_blocked", SenderID: "user_A"}
+	assert.False(t, connected(t, hub, "user_A"), "the hub goes on while CancelSearchCh is full")
+	assert.Equal(t, overflows+1, defaultMetric(t, `chatgogo_hub_channel_overflows_total{channel="search_cancellations"}`))
+
+	assert.Equal(t, "user_X", <-hub.CancelSearchCh)
+	select {
+	case userID := <-hub.CancelSearchCh:
+		assert.Equal(t, "user_A", userID)
+	case <-time.After(time.Second):
+		t.Fatal("the held cancellation was not handed over")
+	}
+}
@@ -0,0 +1,110 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// handleUserBanned takes a user who was just banned out of matchmaking. If they were chatting,
+// the room is closed and the partner, who did nothing wrong, is told so and offered a new
+// search instead of being left waiting in silence.
+func (m *ManagerService) handleUserBanned(message models.ChatMessage) {
+	userID := message.SenderID
+	log.Printf("INFO: User %s was banned, removing them from chat.", userID)
+	m.dequeue(userID)
+
+	roomID, err := m.Storage.GetActiveRoomIDForUser(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find active room of banned user %s: %v", userID, err)
+	}
+	if roomID != "" {
+		m.closeRoomOfRemovedUser(roomID, userID, "ban", "system_partner_banned")
+	}
+
+	if client, ok := m.Clients[userID]; ok {
+		client.SetRoomID("")
+		m.sendToClient(client, m.banNotice(userID, time.Now()))
+	}
+}
+
+// closeRoomOfRemovedUser closes a room, for the given reason, after one of its participants
+// was removed from it, e.g. banned. The partner is sent notice, which offers a new search.
+// It does nothing if the room is already closed.
+func (m *ManagerService) closeRoomOfRemovedUser(roomID, removedID, reason, notice string) {
+	room, err := m.Storage.GetRoomByID(roomID)
+	if err != nil {
+		log.Printf("ERROR: Room %s of removed user %s not found: %v", roomID, removedID, err)
+		return
+	}
+
+	if !room.IsActive {
+		return
+	}
+
+	m.Rooms.Transition(room, RoomEnding, removedID, reason)
+	partnerID := partnerOf(room, removedID)
+	if partner, ok := m.Clients[partnerID]; ok {
+		partner.SetRoomID("")
+		m.sendToClient(partner, models.ChatMessage{
+			Type:     notice,
+			Content:  notice,
+			SenderID: "system",
+		})
+	}
+
+	m.closeRoom(room, removedID, reason)
+}
+
+// rejectBanned reports whether a user is banned, telling them why their search does not
+// start. Lookup errors fail open, so a Redis outage does not stop matchmaking.
+func (m *ManagerService) rejectBanned(userID string) bool {
+	banned, err := m.Storage.IsUserBanned(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check ban of user %s: %v", userID, err)
+		return false
+	}
+	if !banned {
+		return false
+	}
+	if client, ok := m.Clients[userID]; ok {
+		m.sendToClient(client, m.banNotice(userID, time.Now()))
+	}
+	return true
+}
+
+// banNotice returns the system_banned notice telling a banned user why they cannot chat.
+// While only temporary bans apply, its content is system_banned_until and its Metadata the
+// end of the last one (RFC 3339), so that the user is shown how long they still have to
+// wait.
+func (m *ManagerService) banNotice(userID string, now time.Time) models.ChatMessage {
+	notice := models.ChatMessage{
+		Type:     "system_banned",
+		Content:  "system_banned",
+		SenderID: "system",
+		Error:    models.NewChatError(models.ErrorBanned, "system_banned"),
+	}
+	bans, err := m.Storage.GetBansForUser(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load bans of user %s: %v", userID, err)
+		return notice
+	}
+	var end time.Time
+	for _, ban := range bans {
+		if !ban.IsActive(now) {
+			continue
+		}
+		if ban.EndsAt == nil {
+			return notice
+		}
+		if ban.EndsAt.After(end) {
+			end = *ban.EndsAt
+		}
+	}
+	if !end.IsZero() {
+		notice.Content = "system_banned_until"
+		notice.Error.Key = notice.Content
+		notice.Metadata = end.Format(time.RFC3339)
+	}
+	return notice
+}
@@ -0,0 +1,54 @@
+package chathub
+
+import (
+	"log"
+	"time"
+)
+
+// DefaultBanExpiryInterval is how often the processor looks for bans that ended.
+const DefaultBanExpiryInterval = time.Minute
+
+// BanExpiryStorage is the part of storage.Storage the BanExpiryProcessor uses.
+type BanExpiryStorage interface {
+	SyncEndedBans(endedAfter, endedBefore time.Time) (int, error)
+}
+
+// BanExpiryProcessor is a background job that processes the temporary bans that ended since
+// its last run: it mirrors the remaining bans of their users to Redis again, where
+// IsUserBanned checks them. The mirror expires with the longest ban on its own; processing
+// the ends makes sure a user whose ban is over can chat again even if the mirror was written
+// without an expiry, e.g. restored from a backup. It is safe to run on every instance.
+type BanExpiryProcessor struct {
+	// Storage provides access to the data persistence layer.
+	Storage BanExpiryStorage
+	// Interval is the time between two runs.
+	Interval time.Duration
+
+	// since is the end of the period processed by the last run.
+	since time.Time
+}
+
+// NewBanExpiryProcessor creates and returns a new BanExpiryProcessor with default settings,
+// which processes the bans that ended from one interval before now on.
+func NewBanExpiryProcessor(s BanExpiryStorage) *BanExpiryProcessor {
+	return &BanExpiryProcessor{
+		Storage:  s,
+		Interval: DefaultBanExpiryInterval,
+		since:    time.Now().Add(-DefaultBanExpiryInterval),
+	}
+}
+
+// ProcessEndedBans processes the bans that ended since the last run and up to now, and
+// returns the number of users whose bans were processed.
+func (p *BanExpiryProcessor) ProcessEndedBans(now time.Time) int {
+	synced, err := p.Storage.SyncEndedBans(p.since, now)
+	if err != nil {
+		log.Printf("ERROR: Failed to process ended bans: %v", err)
+		return 0
+	}
+	p.since = now
+	if synced > 0 {
+		log.Printf("Ban Expiry Processor: processed the ended bans of %d users.", synced)
+	}
+	return synced
+}
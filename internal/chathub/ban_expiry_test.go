@@ -0,0 +1,25 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestBanExpiryProcessor_ProcessesEachPeriodOnce verifies that every run processes the bans
+// that ended since the previous one.
+func TestBanExpiryProcessor_ProcessesEachPeriodOnce(t *testing.T) {
+	storageMock := new(MockStorage)
+	processor := chathub.NewBanExpiryProcessor(storageMock)
+	first := time.Now().Add(time.Minute)
+	second := first.Add(time.Minute)
+	storageMock.On("SyncEndedBans", first, second).Return(0, nil).Once()
+	storageMock.On("SyncEndedBans", mock.MatchedBy(func(since time.Time) bool { return since.Before(first) }), first).Return(2, nil).Once()
+
+	assert.Equal(t, 2, processor.ProcessEndedBans(first))
+	assert.Equal(t, 0, processor.ProcessEndedBans(second))
+	storageMock.AssertExpectations(t)
+}
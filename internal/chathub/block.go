@@ -0,0 +1,65 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// BlockAfterChatWindow is how long after a chat ends its partner can still be blocked with /block.
+const BlockAfterChatWindow = 10 * time.Minute
+
+// handleBlockCommand blocks the sender's current partner, ending the chat, or the partner of
+// their last chat if it ended within BlockAfterChatWindow. Blocked users are never matched
+// with the blocker again.
+func (m *ManagerService) handleBlockCommand(message models.ChatMessage) {
+	userID := message.SenderID
+	partnerID := ""
+	if message.RoomID != "" {
+		room, err := m.Storage.GetRoomByID(message.RoomID)
+		if err != nil {
+			log.Printf("ERROR: Room not found for block command: %v", err)
+			return
+		}
+		partnerID = partnerOf(room, userID)
+		m.handleStopCommand(message)
+	} else {
+		room, err := m.Storage.GetLastClosedRoomForUser(userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to load last room of user %s: %v", userID, err)
+			return
+		}
+		if room != nil && time.Since(room.EndedAt) <= BlockAfterChatWindow {
+			partnerID = partnerOf(room, userID)
+		}
+	}
+
+	client, ok := m.Clients[userID]
+	if partnerID == "" {
+		if ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorNotInChat, "system_block_no_partner"))
+		}
+		return
+	}
+
+	if err := m.Storage.BlockUser(userID, partnerID); err != nil {
+		log.Printf("ERROR: Failed to block user %s for %s: %v", partnerID, userID, err)
+		return
+	}
+	log.Printf("User %s blocked user %s", userID, partnerID)
+	if ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_user_blocked",
+			SenderID: "system",
+		})
+	}
+}
+
+// partnerOf returns the other participant of a room.
+func partnerOf(room *models.ChatRoom, userID string) string {
+	if room.User1ID == userID {
+		return room.User2ID
+	}
+	return room.User1ID
+}
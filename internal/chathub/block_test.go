@@ -0,0 +1,88 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestManager_BlockDuringChat verifies that /block ends the chat and blocks the partner.
+func TestManager_BlockDuringChat(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "block").Return(nil).Once()
+	storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil).Once()
+	storageMock.On("BlockUser", "user_A", "user_B").Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_block", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "system_match_stop_partner", (<-clientB.RecvChannel).Content)
+	assert.Equal(t, "system_match_stop_self", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_user_blocked", (<-clientA.RecvChannel).Content)
+}
+
+// TestManager_BlockAfterChat verifies that /block right after a chat blocks its partner,
+// and that a chat which ended too long ago cannot be blocked anymore.
+func TestManager_BlockAfterChat(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+
+	recent := &models.ChatRoom{RoomID: "room1", User1ID: "user_B", User2ID: "user_A", EndedAt: time.Now().Add(-time.Minute)}
+	old := &models.ChatRoom{RoomID: "room2", User1ID: "user_C", User2ID: "user_D", EndedAt: time.Now().Add(-time.Hour)}
+	storageMock.On("GetLastClosedRoomForUser", "user_A").Return(recent, nil)
+	storageMock.On("GetLastClosedRoomForUser", "user_C").Return(old, nil)
+	storageMock.On("BlockUser", "user_A", "user_B").Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	clientC := newMockClient("user_C")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_C"] = clientC
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_block", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_block", SenderID: "user_C"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "system_user_blocked", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_block_no_partner", (<-clientC.RecvChannel).Content)
+	storageMock.AssertNotCalled(t, "BlockUser", "user_C", "user_D")
+}
+
+// TestMatcherSkipsBlockedUsers verifies that users who blocked each other are never paired,
+// whichever side did the blocking.
+func TestMatcherSkipsBlockedUsers(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", BlockedUsers: []string{"user_B"}}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B"}, nil)
+
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+	matcher.FindMatch(models.SearchRequest{UserID: "user_B"})
+
+	assert.Equal(t, 2, matcher.Queue.Len())
+	storageMock.AssertNotCalled(t, "ClaimMatch", "user_A", "user_B")
+	storageMock.AssertNotCalled(t, "ClaimMatch", "user_B", "user_A")
+}
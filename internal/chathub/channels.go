@@ -0,0 +1,45 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+)
+
+// DefaultChannelBuffer is the capacity of the channels through which the hub receives
+// messages, clients and search cancellations (see SetChannelBuffer).
+const DefaultChannelBuffer = 10
+
+// DefaultWebSocketSendBuffer is the capacity of the send channels of WebSocket clients.
+const DefaultWebSocketSendBuffer = 256
+
+// Channels whose overflows are counted by chatgogo_hub_channel_overflows_total.
+const (
+	// overflowClientSend is the send channel of a client; the message is dropped.
+	overflowClientSend = "client_send"
+	// overflowMatchRequests is MatchRequestCh; the search is rejected.
+	overflowMatchRequests = "match_requests"
+	// overflowRematches is RematchCh; the rematch is rejected.
+	overflowRematches = "rematches"
+	// overflowSearchCancellations is CancelSearchCh; the cancellation is handed over again on
+	// the next delivery retry.
+	overflowSearchCancellations = "search_cancellations"
+	// overflowRoomSubscriptions is the channel of room subscription changes to the pub/sub
+	// listener; the change is made on the next sync.
+	overflowRoomSubscriptions = "room_subscriptions"
+)
+
+var channelOverflows = metrics.Default.NewCounterVec("chatgogo_hub_channel_overflows_total",
+	"Sends that found a channel full and were dropped instead of blocking, by channel.", "channel")
+
+// SetChannelBuffer replaces the channels through which the hub receives messages, clients,
+// rematches and search cancellations with channels of the given capacity. MatchRequestCh
+// keeps its own capacity. It must be called before Run and before anything uses the
+// channels.
+func (m *ManagerService) SetChannelBuffer(size int) {
+	m.IncomingCh = make(chan models.ChatMessage, size)
+	m.PubSubCh = make(chan models.ChatMessage, size)
+	m.CancelSearchCh = make(chan string, size)
+	m.RematchCh = make(chan Rematch, size)
+	m.RegisterCh = make(chan Client, size)
+	m.UnregisterCh = make(chan Client, size)
+}
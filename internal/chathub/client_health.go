@@ -0,0 +1,146 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultDeadClientTimeout is how long a client may not take any message, or a web client
+// may not be heard from, before the hub removes it.
+const DefaultDeadClientTimeout = 2 * time.Minute
+
+// Reasons for removing a client, as counted by chatgogo_hub_dead_clients_total.
+const (
+	// DeadClientStuck means the client's send channel stayed full for DeadClientTimeout.
+	DeadClientStuck = "stuck"
+	// DeadClientAbandoned means the connection of a web client was not heard from for
+	// DeadClientTimeout.
+	DeadClientAbandoned = "abandoned"
+)
+
+var deadClients = metrics.Default.NewCounterVec("chatgogo_hub_dead_clients_total",
+	"Clients removed by the hub because they stopped working, by reason.", "reason")
+
+// offer hands a message to a client without blocking, like trySend, and keeps track of
+// since when the client has not been taking messages.
+func (m *ManagerService) offer(client Client, message models.ChatMessage, now time.Time) bool {
+	userID := client.GetUserID()
+	sent := trySend(client, message)
+	m.stuckMu.Lock()
+	defer m.stuckMu.Unlock()
+	if sent {
+		delete(m.stuckSince, userID)
+		return true
+	}
+	if _, ok := m.stuckSince[userID]; !ok {
+		m.stuckSince[userID] = now
+	}
+	return false
+}
+
+// stuckClients returns a copy of stuckSince.
+func (m *ManagerService) stuckClients() map[string]time.Time {
+	m.stuckMu.Lock()
+	defer m.stuckMu.Unlock()
+	stuck := make(map[string]time.Time, len(m.stuckSince))
+	for userID, since := range m.stuckSince {
+		stuck[userID] = since
+	}
+	return stuck
+}
+
+// forgetStuck stops tracking since when the client of a user has not been taking messages.
+func (m *ManagerService) forgetStuck(userID string) {
+	m.stuckMu.Lock()
+	defer m.stuckMu.Unlock()
+	delete(m.stuckSince, userID)
+}
+
+// checkClientHealth removes the clients that stopped working: those whose send channel has
+// been full for DeadClientTimeout, and web clients whose connection was not heard from for
+// DeadClientTimeout although they are still registered. Removed clients are unregistered
+// like clients that disconnected, so web users in a chat get DisconnectGrace to come back
+// before their partner is freed.
+func (m *ManagerService) checkClientHealth(now time.Time) {
+	if m.DeadClientTimeout <= 0 {
+		return
+	}
+	for userID, since := range m.stuckClients() {
+		client, ok := m.Clients[userID]
+		if !ok || !channelFull(client.GetSendChannel()) {
+			m.forgetStuck(userID)
+			continue
+		}
+		if now.Sub(since) >= m.DeadClientTimeout {
+			m.removeStuckClient(client)
+		}
+	}
+	for userID, client := range m.Clients {
+		if !reportsPresence(client) {
+			continue
+		}
+		if seen, ok := m.LastSeen(userID); ok && now.Sub(seen) >= m.DeadClientTimeout {
+			log.Printf("WARN: Connection of user %s was not heard from since %v, removing its client.", userID, seen.Format(time.RFC3339))
+			m.removeDeadClient(client, DeadClientAbandoned)
+		}
+	}
+}
+
+// removeStuckClient removes a client that has not taken any message for DeadClientTimeout.
+// If the user is connected more than once, only the sessions that do not take messages are
+// removed, as long as another one does.
+func (m *ManagerService) removeStuckClient(client Client) {
+	userID := client.GetUserID()
+	if group, ok := client.(*sessionGroup); ok {
+		var stuck []Client
+		for _, session := range Sessions(group) {
+			if channelFull(session.GetSendChannel()) {
+				stuck = append(stuck, session)
+			}
+		}
+		if len(stuck) < group.size() {
+			for _, session := range stuck {
+				group.remove(session)
+			}
+			deadClients.Add(uint64(len(stuck)), DeadClientStuck)
+			m.forgetStuck(userID)
+			log.Printf("WARN: Removed %d stuck sessions of user %s, %d left.", len(stuck), userID, group.size())
+			return
+		}
+	}
+	log.Printf("WARN: Client of user %s did not take any message for %v, removing it.", userID, m.DeadClientTimeout)
+	m.removeDeadClient(client, DeadClientStuck)
+}
+
+// removeDeadClient unregisters a client that stopped working. Closing its send channel stops
+// its write pump, which closes a web client's connection, so that the user can connect again.
+func (m *ManagerService) removeDeadClient(client Client, reason string) {
+	deadClients.Inc(reason)
+	m.handleUnregister(client)
+	if group, ok := client.(*sessionGroup); ok {
+		// The group's delivery goroutine may be waiting for a stuck session; removing the
+		// sessions lets it close their channels and stop.
+		for _, session := range Sessions(group) {
+			group.remove(session)
+		}
+	}
+}
+
+// reportsPresence reports whether all connections of a client report their presence (see
+// TouchPresence), so that not hearing from the user means the connections are gone.
+func reportsPresence(client Client) bool {
+	for _, session := range Sessions(client) {
+		namer, ok := session.(transportNamer)
+		if !ok || namer.Transport() != TransportWebSocket {
+			return false
+		}
+	}
+	return true
+}
+
+// channelFull reports whether a send channel cannot take another message.
+func channelFull(ch chan<- models.ChatMessage) bool {
+	return len(ch) == cap(ch)
+}
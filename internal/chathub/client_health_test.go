@@ -0,0 +1,99 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// webMockClient is a MockClient that connects through the web, like a WebSocket client.
+type webMockClient struct {
+	*MockClient
+}
+
+func (c *webMockClient) Transport() string { return chathub.TransportWebSocket }
+
+func newHealthHub() (*chathub.ManagerService, *MockStorage) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true}, nil)
+	hub.ActivityCheckInterval = 20 * time.Millisecond
+	hub.DeadClientTimeout = 100 * time.Millisecond
+	hub.PresenceTTL = 0
+	return hub, storageMock
+}
+
+// connected reports whether a user has a client registered in the hub.
+func connected(t *testing.T, hub *chathub.ManagerService, userID string) bool {
+	snapshot, err := hub.Snapshot(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot.Connected
+}
+
+func TestManager_RemovesStuckClient(t *testing.T) {
+	hub, _ := newHealthHub()
+	stuck := newMockClient("user_A")
+	for len(stuck.RecvChannel) < cap(stuck.RecvChannel) {
+		stuck.RecvChannel <- models.ChatMessage{Type: "text"}
+	}
+	hub.Clients["user_A"] = stuck
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.PubSubCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, connected(t, hub, "user_A"), "not removed before DeadClientTimeout")
+	time.Sleep(150 * time.Millisecond)
+
+	assert.False(t, connected(t, hub, "user_A"), "a client that took no message for DeadClientTimeout is removed")
+	for range stuck.RecvChannel {
+		// The channel of a removed client is closed once its messages are drained.
+	}
+}
+
+func TestManager_KeepsClientThatRecovers(t *testing.T) {
+	hub, _ := newHealthHub()
+	slow := newMockClient("user_A")
+	for len(slow.RecvChannel) < cap(slow.RecvChannel) {
+		slow.RecvChannel <- models.ChatMessage{Type: "text"}
+	}
+	hub.Clients["user_A"] = slow
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.PubSubCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	<-slow.RecvChannel
+	time.Sleep(150 * time.Millisecond)
+
+	assert.True(t, connected(t, hub, "user_A"), "a client whose channel has room again is healthy")
+}
+
+func TestManager_RemovesAbandonedWebClient(t *testing.T) {
+	hub, _ := newHealthHub()
+	web := &webMockClient{newMockClient("user_A")}
+	hub.Clients["user_A"] = web
+	hub.TouchPresence("user_A")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, connected(t, hub, "user_A"))
+	time.Sleep(150 * time.Millisecond)
+
+	assert.False(t, connected(t, hub, "user_A"), "a web client not heard from for DeadClientTimeout is removed")
+	_, open := <-web.RecvChannel
+	assert.False(t, open, "the channel of a removed client is closed")
+}
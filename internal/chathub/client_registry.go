@@ -0,0 +1,174 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// DefaultClientRegistryTTL is how long the registry entry of a user's client lasts unless the
+// instance holding it refreshes it. It must be longer than ActivityCheckInterval.
+const DefaultClientRegistryTTL = 2 * time.Minute
+
+// instanceNotice is the message type, published to the inbox of an instance, that carries a
+// notice for a user whose client the instance holds: SenderID is the user and Content the
+// JSON-encoded notice.
+const instanceNotice = "instance_notice"
+
+// instanceInbox returns the pseudo-room whose channel every instance with an InstanceID
+// listens to, for the notices of its users that do not go through a room they are in yet.
+func instanceInbox(instanceID string) string {
+	return "instance:" + instanceID
+}
+
+// roomMembers are the two users of a room.
+type roomMembers struct {
+	user1ID, user2ID string
+}
+
+// partnerOf returns the member of the room who is not userID.
+func (r roomMembers) partnerOf(userID string) string {
+	if userID == r.user1ID {
+		return r.user2ID
+	}
+	return r.user1ID
+}
+
+// registerInstance records in the client registry that this instance holds the client of
+// a user, if the registry is used (see InstanceID).
+func (m *ManagerService) registerInstance(userID string) {
+	if m.InstanceID == "" {
+		return
+	}
+	if err := m.Storage.RegisterClientInstance(m.InstanceID, []string{userID}, m.ClientRegistryTTL); err != nil {
+		log.Printf("ERROR: Failed to register client of user %s in the registry: %v", userID, err)
+	}
+}
+
+// unregisterInstance removes the registry entry of a user whose client left this instance,
+// unless another instance holds the user's client by now.
+func (m *ManagerService) unregisterInstance(userID string) {
+	if m.InstanceID == "" {
+		return
+	}
+	if err := m.Storage.UnregisterClientInstance(m.InstanceID, userID); err != nil {
+		log.Printf("ERROR: Failed to unregister client of user %s from the registry: %v", userID, err)
+	}
+}
+
+// refreshClientRegistry renews the registry entries of all clients of this instance, so that
+// the entries of instances that went away expire.
+func (m *ManagerService) refreshClientRegistry() {
+	if m.InstanceID == "" || len(m.Clients) == 0 {
+		return
+	}
+	userIDs := make([]string, 0, len(m.Clients))
+	for userID := range m.Clients {
+		userIDs = append(userIDs, userID)
+	}
+	if err := m.Storage.RegisterClientInstance(m.InstanceID, userIDs, m.ClientRegistryTTL); err != nil {
+		log.Printf("ERROR: Failed to refresh %d clients in the registry: %v", len(userIDs), err)
+	}
+}
+
+// rememberRoomMembers keeps the users of a room whose messages this instance receives, so
+// that routedElsewhere can find the recipient of the next message without loading the room.
+func (m *ManagerService) rememberRoomMembers(room *models.ChatRoom) {
+	if m.InstanceID == "" || !room.IsActive {
+		return
+	}
+	m.roomMembers[room.RoomID] = roomMembers{user1ID: room.User1ID, user2ID: room.User2ID}
+}
+
+// routedElsewhere reports whether a message received over Pub/Sub is for a user whose client
+// another instance holds, according to the client registry, so that this instance leaves it
+// to that one instead of loading the room. It only knows the recipients of rooms it received
+// messages of before, and never skips recipients who have a client, or dropped out, here.
+// Chat messages it skips still count for the activity of the room, which this instance
+// tracks for its own user, the sender.
+func (m *ManagerService) routedElsewhere(message models.ChatMessage) bool {
+	if m.InstanceID == "" || message.Type == idleRoomNotice {
+		return false
+	}
+	members, ok := m.roomMembers[message.RoomID]
+	if !ok {
+		return false
+	}
+	recipientID := members.partnerOf(message.SenderID)
+	if _, ok := m.Clients[recipientID]; ok {
+		return false
+	}
+	if _, ok := m.dropped[recipientID]; ok {
+		return false
+	}
+	instanceID, err := m.Storage.GetClientInstance(recipientID)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up the instance of user %s: %v", recipientID, err)
+		return false
+	}
+	if instanceID == "" || instanceID == m.InstanceID {
+		return false
+	}
+	if isConversationalMessage(message.Type) {
+		m.trackRoomActivity(message.RoomID, message.SenderID, recipientID, time.Now())
+	}
+	return true
+}
+
+// forwardToInstance hands a notice for a user without a client here to the instance holding
+// their client, according to the client registry. It reports whether another instance holds
+// the client; the notice is lost if publishing it fails.
+func (m *ManagerService) forwardToInstance(userID string, notice models.ChatMessage) bool {
+	if m.InstanceID == "" {
+		return false
+	}
+	instanceID, err := m.Storage.GetClientInstance(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up the instance of user %s: %v", userID, err)
+		return false
+	}
+	if instanceID == "" || instanceID == m.InstanceID {
+		return false
+	}
+	payload, err := json.Marshal(notice)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode a %s notice for user %s: %v", notice.Type, userID, err)
+		return true
+	}
+	message := models.ChatMessage{Type: instanceNotice, SenderID: userID, Content: string(payload)}
+	if err := m.Storage.PublishMessage(instanceInbox(instanceID), message); err != nil {
+		log.Printf("ERROR: Failed to forward a %s notice for user %s to instance %s: %v", notice.Type, userID, instanceID, err)
+	}
+	return true
+}
+
+// handleInstanceNotice delivers a notice another instance forwarded to a user whose client
+// this instance holds. A match notice moves the client into the new room first.
+func (m *ManagerService) handleInstanceNotice(message models.ChatMessage) {
+	var notice models.ChatMessage
+	if err := json.Unmarshal([]byte(message.Content), &notice); err != nil {
+		log.Printf("ERROR: Failed to decode a notice for user %s: %v", message.SenderID, err)
+		return
+	}
+	client, ok := m.Clients[message.SenderID]
+	if !ok {
+		log.Printf("WARN: Dropped a %s notice for user %s, whose client left this instance.", notice.Type, message.SenderID)
+		return
+	}
+	if notice.Type == "system_match_found" {
+		m.joinRoom(notice.RoomID)
+		client.SetRoomID(notice.RoomID)
+	}
+	m.sendToClient(client, notice)
+}
+
+// pruneRoomMembers forgets the users of the rooms this instance no longer receives messages
+// of.
+func (m *ManagerService) pruneRoomMembers(rooms map[string]bool) {
+	for roomID := range m.roomMembers {
+		if !rooms[roomID] {
+			delete(m.roomMembers, roomID)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newRegistryHub() (*chathub.ManagerService, *MockStorage) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true}, nil)
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil)
+	storageMock.On("RegisterClientInstance", "instance-1", mock.Anything, chathub.DefaultClientRegistryTTL).Return(nil)
+	storageMock.On("UnregisterClientInstance", "instance-1", mock.Anything).Return(nil)
+	hub.InstanceID = "instance-1"
+	return hub, storageMock
+}
+
+func TestManager_RegistersClientsInRegistry(t *testing.T) {
+	hub, storageMock := newRegistryHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clientA := newMockClient("user_A")
+	hub.RegisterCh <- clientA
+	time.Sleep(50 * time.Millisecond)
+	hub.UnregisterCh <- clientA
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "RegisterClientInstance", "instance-1", []string{"user_A"}, chathub.DefaultClientRegistryTTL)
+	storageMock.AssertCalled(t, "UnregisterClientInstance", "instance-1", "user_A")
+}
+
+func TestManager_LeavesMessagesToInstanceOfRecipient(t *testing.T) {
+	hub, storageMock := newRegistryHub()
+	storageMock.On("IsUserOnline", "user_B").Return(true, nil)
+	storageMock.On("GetClientInstance", "user_B").Return("instance-2", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	hub.RegisterCh <- clientA
+	for _, content := range []string{"hi", "how are you?", "anyone?"} {
+		hub.PubSubCh <- models.ChatMessage{ID: 1, Type: "text", Content: content, RoomID: "room1", SenderID: "user_A"}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNumberOfCalls(t, "GetRoomByID", 1)
+	storageMock.AssertNumberOfCalls(t, "GetClientInstance", 2)
+	assert.Empty(t, clientA.RecvChannel)
+}
+
+func TestManager_ProcessesMessagesForLocalRecipient(t *testing.T) {
+	hub, storageMock := newRegistryHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clientB := newMockClient("user_B")
+	clientB.SetRoomID("room1")
+	hub.RegisterCh <- clientB
+	time.Sleep(50 * time.Millisecond)
+	hub.PubSubCh <- models.ChatMessage{ID: 1, Type: "text", Content: "hi", RoomID: "room1", SenderID: "user_A"}
+	hub.PubSubCh <- models.ChatMessage{ID: 2, Type: "text", Content: "there", RoomID: "room1", SenderID: "user_A"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "GetClientInstance", mock.Anything)
+	assert.Len(t, clientB.RecvChannel, 2)
+}
+
+// TestMatcherForwardsMatchToInstanceOfUser verifies that a matched user whose client another
+// instance holds is told through the inbox of that instance.
+func TestMatcherForwardsMatchToInstanceOfUser(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	hub.InstanceID = "instance-1"
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("GetUserByID", mock.Anything).Return(&models.User{}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+	storageMock.On("GetClientInstance", "user_B").Return("instance-2", nil)
+	var forwarded models.ChatMessage
+	storageMock.On("PublishMessage", "instance:instance-2", mock.MatchedBy(func(msg models.ChatMessage) bool {
+		return msg.Type == "instance_notice" && msg.SenderID == "user_B" && json.Unmarshal([]byte(msg.Content), &forwarded) == nil
+	})).Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+
+	storageMock.AssertExpectations(t)
+	notice := <-clientA.RecvChannel
+	assert.Equal(t, "system_match_found", forwarded.Type)
+	assert.Equal(t, notice.RoomID, forwarded.RoomID)
+}
+
+// TestManager_DeliversForwardedMatch verifies that a match notice forwarded by another
+// instance moves the local client into the room.
+func TestManager_DeliversForwardedMatch(t *testing.T) {
+	hub, _ := newRegistryHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clientB := newMockClient("user_B")
+	hub.RegisterCh <- clientB
+	assert.Eventually(t, func() bool {
+		snapshot, err := hub.Snapshot(ctx, "user_B")
+		return err == nil && snapshot.Connected
+	}, time.Second, 10*time.Millisecond)
+	notice, err := json.Marshal(models.ChatMessage{Type: "system_match_found", Content: "system_match_found", RoomID: "room9", SenderID: "system"})
+	assert.NoError(t, err)
+	hub.PubSubCh <- models.ChatMessage{Type: "instance_notice", SenderID: "user_B", Content: string(notice)}
+
+	select {
+	case message := <-clientB.RecvChannel:
+		assert.Equal(t, "system_match_found", message.Type)
+		assert.Equal(t, "room9", message.RoomID)
+	case <-time.After(time.Second):
+		t.Fatal("the forwarded match was not delivered")
+	}
+	snapshot, err := hub.Snapshot(ctx, "user_B")
+	assert.NoError(t, err)
+	assert.Equal(t, "room9", snapshot.RoomID)
+}
@@ -0,0 +1,157 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trackedCommands maps the message types of the commands whose usage is counted to the
+// command names.
+var trackedCommands = map[string]string{
+	"command_start":    "start",
+	"command_next":     "next",
+	"command_stop":     "stop",
+	"command_again":    "again",
+	"command_block":    "block",
+	"command_report":   "report",
+	"command_settings": "settings",
+}
+
+// analyticsScope is the scope of the pseudonyms of users in the command usage analytics.
+const analyticsScope = "analytics"
+
+// analyticsPseudonymTTL is how long the users of the pseudonyms in the analytics can be
+// looked up, as long as the command usage of an hour is kept.
+const analyticsPseudonymTTL = 48 * time.Hour
+
+// DefaultCommandAbuseThresholds are the numbers of times a user may issue each command
+// within an hour before they are considered abusive.
+var DefaultCommandAbuseThresholds = map[string]int64{
+	"start":    200,
+	"next":     200,
+	"stop":     200,
+	"again":    100,
+	"block":    50,
+	"report":   30,
+	"settings": 100,
+}
+
+var (
+	commandsTotal = metrics.Default.NewCounterVec("chatgogo_hub_commands_total",
+		"Commands handled by the hub, by command.", "command")
+	commandOutliersTotal = metrics.Default.NewCounterVec("chatgogo_hub_command_outliers_total",
+		"Users who reached the hourly abuse threshold of a command, by command.", "command")
+)
+
+// TrackedCommands returns the names of the commands whose usage is counted.
+func TrackedCommands() []string {
+	names := make([]string, 0, len(trackedCommands))
+	for _, name := range trackedCommands {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ParseCommandAbuseThresholds parses a comma-separated list of command=count pairs (e.g.,
+// the COMMAND_ABUSE_THRESHOLDS environment variable) over DefaultCommandAbuseThresholds.
+// A count of 0 disables the threshold of a command.
+func ParseCommandAbuseThresholds(raw string) (map[string]int64, error) {
+	thresholds := make(map[string]int64, len(DefaultCommandAbuseThresholds))
+	for command, count := range DefaultCommandAbuseThresholds {
+		thresholds[command] = count
+	}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		command, value, ok := strings.Cut(part, "=")
+		command = strings.TrimPrefix(strings.TrimSpace(command), "/")
+		if !ok {
+			return nil, fmt.Errorf("missing count for command %q", command)
+		}
+		if _, known := DefaultCommandAbuseThresholds[command]; !known {
+			return nil, fmt.Errorf("unknown command %q", command)
+		}
+		count, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid count %q for command %q", value, command)
+		}
+		thresholds[command] = count
+	}
+	return thresholds, nil
+}
+
+// recordCommand counts a command of a user in the analytics of the current hour, under the
+// user's pseudonym, which is saved with the first count of the hour so that superadmins can
+// deanonymize the analytics. When the user reaches the abuse threshold of the command, they are reported to moderators, and a
+// user who searches that often cannot search for SkipCooldown. This happens once per command
+// and hour, as the count passes the threshold.
+func (m *ManagerService) recordCommand(message models.ChatMessage, now time.Time) {
+	command, ok := trackedCommands[message.Type]
+	if !ok || message.SenderID == "" {
+		return
+	}
+	commandsTotal.Inc(command)
+
+	pseudonym := m.Anonymizer.Pseudonym(analyticsScope, message.SenderID)
+	count, err := m.Storage.RecordCommandUsage(pseudonym, command, now)
+	if err != nil {
+		log.Printf("ERROR: Failed to record /%s of user %s: %v", command, message.SenderID, err)
+		return
+	}
+	if count == 1 {
+		if err := m.Storage.SavePseudonyms(map[string]string{pseudonym: message.SenderID}, analyticsPseudonymTTL); err != nil {
+			log.Printf("ERROR: Failed to save the analytics pseudonym of user %s: %v", message.SenderID, err)
+		}
+	}
+	threshold := m.CommandAbuseThresholds[command]
+	if threshold <= 0 || count != threshold {
+		return
+	}
+
+	commandOutliersTotal.Inc(command)
+	log.Printf("WARN: User %s issued /%s %d times within an hour.", message.SenderID, command, count)
+	if (command == "start" || command == "next") && m.SkipCooldown > 0 {
+		state, ok := m.skips[message.SenderID]
+		if !ok {
+			state = &skipState{}
+			m.skips[message.SenderID] = state
+		}
+		state.cooldownUntil = now.Add(m.SkipCooldown)
+	}
+	m.reportCommandAbuse(message, command, count)
+}
+
+// reportCommandAbuse files a complaint against a user who issued a command too often, in
+// their current or last room. Users who never chatted are only logged.
+func (m *ManagerService) reportCommandAbuse(message models.ChatMessage, command string, count int64) {
+	roomID := message.RoomID
+	if client, ok := m.Clients[message.SenderID]; ok && roomID == "" {
+		roomID = client.GetRoomID()
+	}
+	if roomID == "" {
+		room, err := m.Storage.GetLastClosedRoomForUser(message.SenderID)
+		if err != nil || room == nil {
+			return
+		}
+		roomID = room.RoomID
+	}
+
+	complaint := &models.Complaint{
+		RoomID:     roomID,
+		ReporterID: "system",
+		SuspectID:  message.SenderID,
+		Reason:     fmt.Sprintf("auto: issued /%s %d times within an hour", command, count),
+	}
+	if err := m.Storage.SaveComplaint(complaint); err != nil {
+		log.Printf("ERROR: Failed to report command abuse of user %s: %v", message.SenderID, err)
+		return
+	}
+	log.Printf("Auto-reported user %s for /%s abuse in room %s", message.SenderID, command, roomID)
+}
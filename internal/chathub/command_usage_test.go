@@ -0,0 +1,98 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// readableAnonymizer derives pseudonyms that show their scope and user, for assertions.
+type readableAnonymizer struct{}
+
+func (readableAnonymizer) Pseudonym(scope, userID string) string {
+	return "anon_" + scope + "_" + userID
+}
+
+// newCommandUsageHub returns a hub where user_A is connected outside of a room and has issued
+// /start count times this hour, including the next one.
+func newCommandUsageHub(storageMock *MockStorage, count int64) (*chathub.ManagerService, *MockClient) {
+	expectHubStartup(storageMock)
+	hub := chathub.NewManagerService(storageMock)
+	hub.CommandAbuseThresholds = map[string]int64{"start": 3}
+	hub.Anonymizer = readableAnonymizer{}
+	storageMock.On("RecordCommandUsage", "anon_analytics_user_A", "start", mock.Anything).Return(count, nil)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+	storageMock.On("GetLastClosedRoomForUser", "user_A").Return(&models.ChatRoom{RoomID: "room1"}, nil).Maybe()
+
+	return hub, addTestClient(hub, "user_A", "")
+}
+
+// TestManager_CommandAbuseReportsOutlier verifies that a user who reaches the hourly threshold
+// of /start is reported in their last room and cannot search during the skip cooldown.
+func TestManager_CommandAbuseReportsOutlier(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA := newCommandUsageHub(storageMock, 3)
+	storageMock.On("SaveComplaint", mock.MatchedBy(func(c *models.Complaint) bool {
+		return c.RoomID == "room1" && c.ReporterID == "system" && c.SuspectID == "user_A" &&
+			c.Reason == "auto: issued /start 3 times within an hour"
+	})).Return(nil).Once()
+
+	go hub.Run(context.Background())
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Empty(t, hub.MatchRequestCh)
+	require.Len(t, clientA.RecvChannel, 1)
+	assert.Equal(t, "system_skip_cooldown", (<-clientA.RecvChannel).Type)
+}
+
+// TestManager_CommandUsageBelowThreshold verifies that commands below the threshold are only
+// counted.
+func TestManager_CommandUsageBelowThreshold(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, _ := newCommandUsageHub(storageMock, 2)
+
+	go hub.Run(context.Background())
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "RecordCommandUsage", "anon_analytics_user_A", "start", mock.Anything)
+	storageMock.AssertNotCalled(t, "SaveComplaint", mock.Anything)
+	storageMock.AssertNotCalled(t, "SavePseudonyms", mock.Anything, mock.Anything)
+	assert.Len(t, hub.MatchRequestCh, 1)
+}
+
+// TestManager_CommandUsageSavesPseudonym verifies that the first command of the hour saves
+// the user's analytics pseudonym, so that it can be deanonymized.
+func TestManager_CommandUsageSavesPseudonym(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, _ := newCommandUsageHub(storageMock, 1)
+	storageMock.On("SavePseudonyms", map[string]string{"anon_analytics_user_A": "user_A"}, mock.Anything).Return(nil).Once()
+
+	go hub.Run(context.Background())
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+}
+
+func TestParseCommandAbuseThresholds(t *testing.T) {
+	thresholds, err := chathub.ParseCommandAbuseThresholds("/next=500, report=0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), thresholds["next"])
+	assert.Equal(t, int64(0), thresholds["report"])
+	assert.Equal(t, chathub.DefaultCommandAbuseThresholds["start"], thresholds["start"])
+	assert.Equal(t, int64(200), chathub.DefaultCommandAbuseThresholds["next"], "defaults are not modified")
+
+	for _, raw := range []string{"next", "next=-1", "next=many", "dance=5"} {
+		_, err := chathub.ParseCommandAbuseThresholds(raw)
+		assert.Error(t, err, raw)
+	}
+}
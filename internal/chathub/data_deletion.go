@@ -0,0 +1,130 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// fileDeletionTimeout bounds the deletion of the files of one user from the file stores.
+const fileDeletionTimeout = time.Minute
+
+// FileStore deletes files kept outside storage, such as a *media.S3Store.
+type FileStore interface {
+	Delete(ctx context.Context, url string) error
+}
+
+// dataDeletion is the outcome of erasing the data of a user, reported to the hub goroutine.
+type dataDeletion struct {
+	userID string
+	err    error
+}
+
+// handleDeleteDataCommand processes command_delete_data, which a transport sends once a user
+// confirmed that all their data is to be erased (see storage.Storage.DeleteUserData). Like a
+// banned user, they are first taken out of matchmaking and their chat, whose partner is told
+// and offered a new search. Their data is then erased off the hub goroutine (see
+// eraseUserData) while their messages are ignored, and finishDataDeletion reports the outcome.
+func (m *ManagerService) handleDeleteDataCommand(message models.ChatMessage) {
+	userID := message.SenderID
+	client, connected := m.Clients[userID]
+	banned, err := m.Storage.IsUserBanned(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check ban of user %s before deleting their data: %v", userID, err)
+	}
+	if banned {
+		if connected {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, "system_delete_data_banned"))
+		}
+		return
+	}
+
+	m.dequeue(userID)
+	roomID, err := m.Storage.GetActiveRoomIDForUser(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to find active room of user %s deleting their data: %v", userID, err)
+	}
+	if roomID != "" {
+		m.closeRoomOfRemovedUser(roomID, userID, "deleted", "system_partner_deleted")
+	}
+	if connected {
+		client.SetRoomID("")
+	}
+
+	m.deleting[userID] = true
+	go func() {
+		m.deletions <- dataDeletion{userID: userID, err: m.eraseUserData(userID)}
+	}()
+}
+
+// eraseUserData deletes the media and chat archives of a user from the file stores, then
+// their data from storage. Files are deleted first so that a failure leaves their URLs in
+// storage to be deleted on the next request.
+func (m *ManagerService) eraseUserData(userID string) error {
+	mediaURLs, archiveURLs, err := m.Storage.GetUserFiles(userID)
+	if err != nil {
+		return fmt.Errorf("find files: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fileDeletionTimeout)
+	defer cancel()
+	if err := deleteFiles(ctx, m.MediaFiles, mediaURLs); err != nil {
+		return fmt.Errorf("delete media: %w", err)
+	}
+	if err := deleteFiles(ctx, m.ArchiveFiles, archiveURLs); err != nil {
+		return fmt.Errorf("delete archives: %w", err)
+	}
+	return m.Storage.DeleteUserData(userID)
+}
+
+// deleteFiles deletes the files at the given URLs from store. It fails if there are files but
+// no store to delete them from.
+func deleteFiles(ctx context.Context, store FileStore, urls []string) error {
+	if len(urls) > 0 && store == nil {
+		return fmt.Errorf("no store configured for %d files", len(urls))
+	}
+	for _, url := range urls {
+		if err := store.Delete(ctx, url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishDataDeletion tells a user the outcome of erasing their data. Once it is erased, their
+// sessions on this instance are closed, as the account they belong to is gone.
+func (m *ManagerService) finishDataDeletion(deletion dataDeletion) {
+	userID := deletion.userID
+	delete(m.deleting, userID)
+	client, connected := m.Clients[userID]
+	if errors.Is(deletion.err, storage.ErrUserBanned) {
+		if connected {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, "system_delete_data_banned"))
+		}
+		return
+	}
+	if deletion.err != nil {
+		log.Printf("ERROR: Failed to delete data of user %s: %v", userID, deletion.err)
+		if connected {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorInternal, "system_delete_data_failed"))
+		}
+		return
+	}
+	log.Printf("Deleted the data of user %s on their request.", userID)
+
+	delete(m.mutes, userID)
+	if !connected {
+		return
+	}
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_data_deleted",
+		SenderID: "system",
+	})
+	for _, session := range Sessions(client) {
+		m.handleUnregister(session)
+	}
+}
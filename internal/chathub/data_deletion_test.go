@@ -0,0 +1,121 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fileStore records the files deleted from it, failing with err if set.
+type fileStore struct {
+	mu      sync.Mutex
+	deleted []string
+	err     error
+}
+
+func (f *fileStore) Delete(_ context.Context, url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, url)
+	return nil
+}
+
+func (f *fileStore) Deleted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.deleted
+}
+
+func newDeleteDataHub() (*chathub.ManagerService, *MockStorage, *MockClient, *MockClient) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	return hub, storageMock, addTestClient(hub, "user_A", "room1"), addTestClient(hub, "user_B", "room1")
+}
+
+// TestManager_DeleteDataClosesChatAndSessions verifies that deleting a user's data ends their
+// chat, telling the partner, erases their files and closes the user's sessions once the data
+// is gone.
+func TestManager_DeleteDataClosesChatAndSessions(t *testing.T) {
+	hub, storageMock, clientA, clientB := newDeleteDataHub()
+	mediaFiles, archiveFiles := &fileStore{}, &fileStore{}
+	hub.MediaFiles, hub.ArchiveFiles = mediaFiles, archiveFiles
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+	storageMock.On("GetActiveRoomIDForUser", "user_A").Return("room1", nil)
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "deleted").Return(nil).Once()
+	storageMock.On("GetUserFiles", "user_A").Return([]string{"https://media/photo.jpg"}, []string{"https://archive/room1.json"}, nil).Once()
+	storageMock.On("DeleteUserData", "user_A").Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_delete_data", SenderID: "user_A", RoomID: "room1"}
+
+	assert.Equal(t, "user_A", <-hub.CancelSearchCh)
+	assert.Equal(t, "system_partner_deleted", (<-clientB.RecvChannel).Type)
+	assert.Empty(t, clientB.GetRoomID())
+
+	assert.Equal(t, "system_data_deleted", (<-clientA.RecvChannel).Content)
+	_, open := <-clientA.RecvChannel
+	assert.False(t, open, "the sessions of the deleted user must be closed")
+	assert.False(t, connected(t, hub, "user_A"))
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, []string{"https://media/photo.jpg"}, mediaFiles.Deleted())
+	assert.Equal(t, []string{"https://archive/room1.json"}, archiveFiles.Deleted())
+}
+
+// TestManager_DeleteDataKeepsDataIfFilesRemain verifies that the data of a user is kept, and
+// the user told so, when their files could not be deleted, so that a new request finds them.
+func TestManager_DeleteDataKeepsDataIfFilesRemain(t *testing.T) {
+	hub, storageMock, clientA, _ := newDeleteDataHub()
+	hub.MediaFiles = &fileStore{err: errors.New("unavailable")}
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+	storageMock.On("GetActiveRoomIDForUser", "user_A").Return("", nil)
+	storageMock.On("GetUserFiles", "user_A").Return([]string{"https://media/photo.jpg"}, []string{}, nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_delete_data", SenderID: "user_A"}
+
+	assert.Equal(t, "user_A", <-hub.CancelSearchCh)
+	notice := <-clientA.RecvChannel
+	assert.Equal(t, "system_delete_data_failed", notice.Content)
+	assert.Equal(t, models.ErrorInternal, notice.Error.Code)
+	assert.True(t, connected(t, hub, "user_A"))
+	storageMock.AssertNotCalled(t, "DeleteUserData", mock.Anything)
+}
+
+// TestManager_DeleteDataRefusesBannedUsers verifies that banned users cannot erase their data,
+// which would lift their ban.
+func TestManager_DeleteDataRefusesBannedUsers(t *testing.T) {
+	hub, storageMock, clientA, clientB := newDeleteDataHub()
+	storageMock.On("IsUserBanned", "user_A").Return(true, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_delete_data", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+
+	notice := <-clientA.RecvChannel
+	assert.Equal(t, "system_delete_data_banned", notice.Content)
+	assert.Equal(t, models.ErrorInvalidRequest, notice.Error.Code)
+	assert.Equal(t, "room1", clientB.GetRoomID())
+	assert.Empty(t, hub.CancelSearchCh)
+	storageMock.AssertNotCalled(t, "DeleteUserData", mock.Anything)
+}
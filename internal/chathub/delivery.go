@@ -0,0 +1,83 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+)
+
+// Reasons a message could not be delivered, reported by clients in the Metadata of a
+// command_delivery_failed message.
+const (
+	// DeliveryFailedBlocked means the recipient blocked the bot.
+	DeliveryFailedBlocked = "partner_blocked"
+	// DeliveryFailedRoomClosed means the room was closed before the message was relayed.
+	DeliveryFailedRoomClosed = "room_closed"
+	// DeliveryFailedError means the recipient's platform rejected the message.
+	DeliveryFailedError = "error"
+)
+
+// deliveryFailedNotices are the messages telling a sender why their message was not
+// delivered, by reason.
+var deliveryFailedNotices = map[string]string{
+	DeliveryFailedBlocked:    "system_delivery_failed_blocked",
+	DeliveryFailedRoomClosed: "system_delivery_failed_room_closed",
+	DeliveryFailedError:      "system_delivery_failed",
+}
+
+// DeliveryFailure builds the command_delivery_failed message a client sends to the hub when
+// it gives up delivering a message to its user, the recipient.
+func DeliveryFailure(recipientID string, message models.ChatMessage, reason string) models.ChatMessage {
+	return models.ChatMessage{
+		Type:              "command_delivery_failed",
+		SenderID:          recipientID,
+		RoomID:            message.RoomID,
+		Content:           message.Type,
+		Metadata:          reason,
+		TgMessageIDSender: message.TgMessageIDSender,
+	}
+}
+
+// deliveryFailedNotice builds the notice telling the sender of a message that it was not
+// delivered. TgMessageIDSender lets the sender's client point at the failed message.
+func deliveryFailedNotice(senderID string, message models.ChatMessage, reason string) models.ChatMessage {
+	content, ok := deliveryFailedNotices[reason]
+	if !ok {
+		reason, content = DeliveryFailedError, deliveryFailedNotices[DeliveryFailedError]
+	}
+	chatErr := models.NewChatError(models.ErrorDeliveryFailed, content)
+	// Resending only helps after a platform error; a blocked bot or a closed room stays.
+	chatErr.Retryable = reason == DeliveryFailedError
+	return models.ChatMessage{
+		Type:              "system_delivery_failed",
+		Content:           content,
+		SenderID:          senderID,
+		RoomID:            message.RoomID,
+		TgMessageIDSender: message.TgMessageIDSender,
+		Error:             chatErr,
+	}
+}
+
+// handleDeliveryFailed tells the sender of a chat message that a client failed to deliver
+// it for good. The notice is published to the room, so that it reaches the sender on
+// whichever instance they are connected to; its SenderID is the recipient, as for any
+// message relayed in the room.
+func (m *ManagerService) handleDeliveryFailed(message models.ChatMessage) {
+	if message.RoomID == "" || !isConversationalMessage(message.Content) {
+		return
+	}
+	log.Printf("Message in room %s could not be delivered to %s: %s", message.RoomID, message.SenderID, message.Metadata)
+
+	notice := deliveryFailedNotice(message.SenderID, message, message.Metadata)
+	if err := m.Storage.PublishMessage(message.RoomID, notice); err != nil {
+		log.Printf("ERROR: Failed to publish delivery failure for room %s: %v", message.RoomID, err)
+	}
+}
+
+// rejectClosedRoomMessage tells the sender of a chat message relayed after its room was
+// closed that it was not delivered, if the sender is connected to this instance.
+func (m *ManagerService) rejectClosedRoomMessage(message models.ChatMessage) {
+	log.Printf("Dropped %s message of %s for closed room %s", message.Type, message.SenderID, message.RoomID)
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, deliveryFailedNotice("system", message, DeliveryFailedRoomClosed))
+	}
+}
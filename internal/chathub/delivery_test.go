@@ -0,0 +1,63 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestManager_DeliveryFailureNotifiesSender verifies that a failed delivery reported by the
+// recipient's client is published to the room as a notice for the sender.
+func TestManager_DeliveryFailureNotifiesSender(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	var notice models.ChatMessage
+	storageMock.On("PublishMessage", "room1", mock.AnythingOfType("models.ChatMessage")).
+		Run(func(args mock.Arguments) { notice = args.Get(1).(models.ChatMessage) }).
+		Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	tgID := uint(42)
+	message := models.ChatMessage{Type: "text", SenderID: "user_A", RoomID: "room1", Content: "hi", TgMessageIDSender: &tgID}
+	hub.IncomingCh <- chathub.DeliveryFailure("user_B", message, chathub.DeliveryFailedBlocked)
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "system_delivery_failed", notice.Type)
+	assert.Equal(t, "system_delivery_failed_blocked", notice.Content)
+	assert.Equal(t, "user_B", notice.SenderID)
+	assert.Equal(t, &tgID, notice.TgMessageIDSender)
+}
+
+// TestManager_ClosedRoomMessageIsRejected verifies that a chat message relayed after its
+// room was closed is not delivered, and that its sender is told so.
+func TestManager_ClosedRoomMessageIsRejected(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+
+	room := &models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.PubSubCh <- models.ChatMessage{Type: "text", RoomID: "room1", SenderID: "user_A", Content: "hello"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "system_delivery_failed_room_closed", (<-clientA.RecvChannel).Content)
+	assert.Empty(t, clientB.RecvChannel)
+}
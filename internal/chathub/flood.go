@@ -0,0 +1,72 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultMessageRate is the number of chat messages per second a user may send on
+	// average.
+	DefaultMessageRate = 3.0
+	// DefaultMessageBurst is the number of chat messages a user may send at once.
+	DefaultMessageBurst = 10
+)
+
+var floodDropped = metrics.Default.NewCounterVec("chatgogo_hub_flood_dropped_total",
+	"Chat messages dropped because their sender exceeded the message rate limit.")
+
+// messageBucket is the token bucket of a user's chat messages.
+type messageBucket struct {
+	// tokens is the number of messages the user may send right now.
+	tokens float64
+	// updated is when tokens was last refilled.
+	updated time.Time
+	// warned is set once the user was told that their messages are dropped, until one passes
+	// again.
+	warned bool
+}
+
+// allowMessage takes a token from the bucket of the sender of a chat message, refilled at
+// MessageRate per second up to MessageBurst. A message without a token is dropped before it
+// reaches the partner, the database and the Telegram API; the sender is warned once per
+// flood. It returns false if the message must be dropped.
+func (m *ManagerService) allowMessage(message models.ChatMessage, now time.Time) bool {
+	if m.MessageRate <= 0 || m.MessageBurst <= 0 {
+		return true
+	}
+	bucket, ok := m.floods[message.SenderID]
+	if !ok {
+		bucket = &messageBucket{tokens: float64(m.MessageBurst), updated: now}
+		m.floods[message.SenderID] = bucket
+	}
+	bucket.tokens = min(float64(m.MessageBurst), bucket.tokens+now.Sub(bucket.updated).Seconds()*m.MessageRate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.warned = false
+		return true
+	}
+
+	floodDropped.Inc()
+	if bucket.warned {
+		return false
+	}
+	bucket.warned = true
+	log.Printf("WARN: User %s exceeds the message rate limit, dropping their messages.", message.SenderID)
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorRateLimited, "system_flood_warning"))
+	}
+	return false
+}
+
+// pruneFloods forgets the buckets that have refilled completely.
+func (m *ManagerService) pruneFloods(now time.Time) {
+	for userID, bucket := range m.floods {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*m.MessageRate >= float64(m.MessageBurst) {
+			delete(m.floods, userID)
+		}
+	}
+}
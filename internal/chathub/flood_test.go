@@ -0,0 +1,62 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManager_FloodDropsMessagesOverBurst verifies that messages beyond the burst are dropped
+// and that the sender is warned once per flood.
+func TestManager_FloodDropsMessagesOverBurst(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newHoneypotHub(storageMock)
+	hub.Honeypot = nil
+	hub.MessageBurst = 3
+	hub.MessageRate = 0.01
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	for i := 0; i < 5; i++ {
+		hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "spam"}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNumberOfCalls(t, "SaveMessage", 3)
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 3)
+	require.Len(t, clientA.RecvChannel, 1, "the sender is warned once")
+	assert.Equal(t, "system_flood_warning", (<-clientA.RecvChannel).Content)
+}
+
+// TestManager_FloodWarnsAgainAfterRecovery verifies that a user whose bucket refilled is
+// warned again when they flood again.
+func TestManager_FloodWarnsAgainAfterRecovery(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newHoneypotHub(storageMock)
+	hub.Honeypot = nil
+	hub.MessageBurst = 1
+	hub.MessageRate = 20
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	message := models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "spam"}
+	hub.IncomingCh <- message
+	hub.IncomingCh <- message
+	time.Sleep(100 * time.Millisecond)
+	hub.IncomingCh <- message
+	hub.IncomingCh <- message
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 2)
+	assert.Len(t, clientA.RecvChannel, 2)
+}
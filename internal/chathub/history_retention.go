@@ -0,0 +1,66 @@
+package chathub
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultHistoryRetentionInterval is how often old history is deleted.
+	DefaultHistoryRetentionInterval = time.Hour
+	// DefaultHistoryRetentionBatchSize is the maximum number of history entries deleted per
+	// batch.
+	DefaultHistoryRetentionBatchSize = 1000
+)
+
+// HistoryRetentionStorage is the part of storage.Storage the HistoryRetention uses.
+type HistoryRetentionStorage interface {
+	DeleteHistoryBefore(before time.Time, limit int) (int64, error)
+}
+
+// HistoryRetention is a background job that permanently deletes the chat history older than
+// MaxAge. Complaints keep their own copy of the messages they were filed for. With no MaxAge,
+// history is kept forever and the job is not run. It is safe to run on every instance, but
+// runs on one per interval to spare the database.
+type HistoryRetention struct {
+	// Storage provides access to the data persistence layer.
+	Storage HistoryRetentionStorage
+	// Interval is the time between two runs.
+	Interval time.Duration
+	// MaxAge is the age from which a history entry is deleted.
+	MaxAge time.Duration
+	// BatchSize is the maximum number of entries deleted per batch.
+	BatchSize int
+}
+
+// NewHistoryRetention creates and returns a new HistoryRetention with default settings,
+// which keeps history forever.
+func NewHistoryRetention(s HistoryRetentionStorage) *HistoryRetention {
+	return &HistoryRetention{
+		Storage:   s,
+		Interval:  DefaultHistoryRetentionInterval,
+		BatchSize: DefaultHistoryRetentionBatchSize,
+	}
+}
+
+// DeleteExpiredHistory deletes the history entries sent more than MaxAge before now, batch
+// by batch, and returns the number of entries deleted.
+func (r *HistoryRetention) DeleteExpiredHistory(now time.Time) int {
+	deleted := 0
+	for {
+		n, err := r.Storage.DeleteHistoryBefore(now.Add(-r.MaxAge), r.BatchSize)
+		if err != nil {
+			log.Printf("ERROR: Failed to delete expired history: %v", err)
+			break
+		}
+		deleted += int(n)
+		if int(n) < r.BatchSize {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("History Retention: deleted %d history entries older than %v.", deleted, r.MaxAge)
+	}
+	return deleted
+}
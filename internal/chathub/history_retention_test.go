@@ -0,0 +1,25 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHistoryRetention_DeletesOldHistoryInBatches verifies that history older than MaxAge is
+// deleted batch by batch, until a batch is not full.
+func TestHistoryRetention_DeletesOldHistoryInBatches(t *testing.T) {
+	storageMock := new(MockStorage)
+	retention := chathub.NewHistoryRetention(storageMock)
+	retention.MaxAge = 30 * 24 * time.Hour
+	retention.BatchSize = 2
+	now := time.Now()
+	cutoff := now.Add(-retention.MaxAge)
+	storageMock.On("DeleteHistoryBefore", cutoff, 2).Return(int64(2), nil).Once()
+	storageMock.On("DeleteHistoryBefore", cutoff, 2).Return(int64(1), nil).Once()
+
+	assert.Equal(t, 3, retention.DeleteExpiredHistory(now))
+	storageMock.AssertExpectations(t)
+}
@@ -0,0 +1,179 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/models"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultSuspectMessageInterval is the minimum time between two relayed messages of a
+// suspected bot.
+const DefaultSuspectMessageInterval = 5 * time.Second
+
+// suspectReportInterval is how long a reported suspect is not reported again, so that
+// moderators get one complaint per suspect a day rather than one per message.
+const suspectReportInterval = 24 * time.Hour
+
+// shadowBannedAttr is the user attribute set for shadow-banned users. Their messages are
+// silently dropped: they are not told, so scripts keep running against no one.
+const shadowBannedAttr = "shadow_banned"
+
+// honeypotState is what the hub remembers about suspected bots.
+type honeypotState struct {
+	// roomStarts caches the start time of active rooms, keyed by room ID.
+	roomStarts map[string]time.Time
+	// lastRelayed is the time of the last relayed message of each suspect.
+	lastRelayed map[string]time.Time
+	// flagged is when each suspect was last reported to moderators.
+	flagged map[string]time.Time
+	// shadowBanned caches the shadow-ban flag of users who sent messages.
+	shadowBanned map[string]bool
+}
+
+func newHoneypotState() honeypotState {
+	return honeypotState{
+		roomStarts:   make(map[string]time.Time),
+		lastRelayed:  make(map[string]time.Time),
+		flagged:      make(map[string]time.Time),
+		shadowBanned: make(map[string]bool),
+	}
+}
+
+// isShadowBanned reports whether a user is shadow-banned. The flag is looked up once per
+// user and cached. Lookup errors fail open.
+func (m *ManagerService) isShadowBanned(userID string) bool {
+	if banned, ok := m.honeypot.shadowBanned[userID]; ok {
+		return banned
+	}
+	value, err := m.Storage.GetUserAttribute(userID, shadowBannedAttr)
+	if err != nil {
+		log.Printf("ERROR: Failed to check shadow ban of user %s: %v", userID, err)
+		return false
+	}
+	m.honeypot.shadowBanned[userID] = value != ""
+	return value != ""
+}
+
+// roomStartedAt returns the start time of a room, looked up once per room and cached until
+// the room is closed. The lookup also fills the safe-mode cache of the room.
+func (m *ManagerService) roomStartedAt(roomID string) (time.Time, bool) {
+	if startedAt, ok := m.honeypot.roomStarts[roomID]; ok {
+		return startedAt, true
+	}
+	room, err := m.Storage.GetRoomByID(roomID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load room %s for bot detection: %v", roomID, err)
+		return time.Time{}, false
+	}
+	m.cacheRoom(room)
+	return room.StartedAt, true
+}
+
+// cacheRoom caches the details of an active room used by the message checks.
+func (m *ManagerService) cacheRoom(room *models.ChatRoom) {
+	m.safeModeRooms[room.RoomID] = room.SafeMode
+	m.honeypot.roomStarts[room.RoomID] = room.StartedAt
+}
+
+// passesHoneypot feeds a chat message to the bot Detector and decides whether it is
+// relayed. Messages of shadow-banned users are dropped silently. Suspects are reported to
+// moderators once and may send one message per SuspectMessageInterval; users who raise
+// analysis.BotScore signals are shadow-banned. It returns false if the message must not
+// be relayed.
+func (m *ManagerService) passesHoneypot(message models.ChatMessage, now time.Time) bool {
+	if m.Honeypot == nil || message.RoomID == "" || !isConversationalMessage(message.Type) {
+		return true
+	}
+	if m.isShadowBanned(message.SenderID) {
+		log.Printf("Dropped %s message of shadow-banned user %s", message.Type, message.SenderID)
+		return false
+	}
+	startedAt, ok := m.roomStartedAt(message.RoomID)
+	if !ok {
+		return true
+	}
+
+	text := message.Content
+	if message.Type != "text" {
+		text = message.Metadata
+	}
+	verdict := m.Honeypot.Observe(analysis.Observation{
+		UserID:        message.SenderID,
+		RoomID:        message.RoomID,
+		RoomStartedAt: startedAt,
+		Text:          text,
+		Typed:         message.Type == "text",
+		At:            now,
+	})
+	if !verdict.Suspect() {
+		return true
+	}
+
+	m.flagSuspectedBot(message, verdict, now)
+	if verdict.Bot() {
+		m.shadowBan(message.SenderID, verdict)
+		return false
+	}
+
+	if last, ok := m.honeypot.lastRelayed[message.SenderID]; ok && now.Sub(last) < m.SuspectMessageInterval {
+		if client, ok := m.Clients[message.SenderID]; ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorRateLimited, "system_message_rate_limited"))
+		}
+		return false
+	}
+	m.honeypot.lastRelayed[message.SenderID] = now
+	return true
+}
+
+// flagSuspectedBot files a complaint against a suspected bot, once per suspect and
+// suspectReportInterval, so that moderators can confirm it into a ban.
+func (m *ManagerService) flagSuspectedBot(message models.ChatMessage, verdict analysis.Verdict, now time.Time) {
+	if flaggedAt, ok := m.honeypot.flagged[message.SenderID]; ok && now.Sub(flaggedAt) < suspectReportInterval {
+		return
+	}
+	m.honeypot.flagged[message.SenderID] = now
+
+	complaint := &models.Complaint{
+		RoomID:     message.RoomID,
+		ReporterID: "system",
+		SuspectID:  message.SenderID,
+		Reason:     "auto: suspected bot (" + strings.Join(verdict.Signals, ", ") + ")",
+	}
+	if err := m.Storage.SaveComplaint(complaint); err != nil {
+		log.Printf("ERROR: Failed to report suspected bot %s: %v", message.SenderID, err)
+		return
+	}
+	log.Printf("Auto-reported suspected bot %s in room %s: %v", message.SenderID, message.RoomID, verdict.Signals)
+}
+
+// shadowBan shadow-bans a user detected as a bot.
+func (m *ManagerService) shadowBan(userID string, verdict analysis.Verdict) {
+	m.honeypot.shadowBanned[userID] = true
+	if err := m.Storage.SetUserAttribute(userID, shadowBannedAttr, strings.Join(verdict.Signals, ",")); err != nil {
+		log.Printf("ERROR: Failed to persist shadow ban of user %s: %v", userID, err)
+		return
+	}
+	log.Printf("Shadow-banned user %s as a bot: %v", userID, verdict.Signals)
+}
+
+// forgetHoneypotRoom drops the cached start time of a closed room.
+func (m *ManagerService) forgetHoneypotRoom(roomID string) {
+	delete(m.honeypot.roomStarts, roomID)
+}
+
+// pruneHoneypot forgets the reports of suspects once suspectReportInterval is over, and the
+// last relayed message of suspects once SuspectMessageInterval is.
+func (m *ManagerService) pruneHoneypot(now time.Time) {
+	for userID, flaggedAt := range m.honeypot.flagged {
+		if now.Sub(flaggedAt) >= suspectReportInterval {
+			delete(m.honeypot.flagged, userID)
+		}
+	}
+	for userID, last := range m.honeypot.lastRelayed {
+		if now.Sub(last) >= m.SuspectMessageInterval {
+			delete(m.honeypot.lastRelayed, userID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newHoneypotHub starts a hub whose rooms room1..room3 were all just created.
+func newHoneypotHub(storageMock *MockStorage) *chathub.ManagerService {
+	hub := newTestHub(storageMock)
+	storageMock.On("GetUserAttribute", "user_A", "shadow_banned").Return("", nil).Once()
+	storageMock.On("GetUserAttribute", "user_A", "first_message_reviewed").Return("1", nil).Maybe()
+	for i := 1; i <= 3; i++ {
+		roomID := fmt.Sprintf("room%d", i)
+		storageMock.On("GetRoomByID", roomID).Return(&models.ChatRoom{RoomID: roomID, IsActive: true, StartedAt: time.Now()}, nil)
+	}
+	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil)
+	return hub
+}
+
+func TestManager_HoneypotShadowBansBots(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newHoneypotHub(storageMock)
+	storageMock.On("SaveComplaint", mock.MatchedBy(func(c *models.Complaint) bool {
+		return c.SuspectID == "user_A" && c.ReporterID == "system" && c.RoomID == "room3"
+	})).Return(nil).Once()
+	storageMock.On("SetUserAttribute", "user_A", "shadow_banned", mock.Anything).Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	for i := 1; i <= 3; i++ {
+		hub.IncomingCh <- models.ChatMessage{RoomID: fmt.Sprintf("room%d", i), SenderID: "user_A", Type: "text", Content: "hot singles at https://spam.example"}
+	}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room3", SenderID: "user_A", Type: "text", Content: "are you there?"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 2)
+	storageMock.AssertNotCalled(t, "PublishSavedMessage", mock.MatchedBy(func(message models.ChatMessage) bool { return message.RoomID == "room3" }))
+}
+
+func TestManager_HoneypotRateLimitsSuspects(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newHoneypotHub(storageMock)
+	storageMock.On("SaveComplaint", mock.AnythingOfType("*models.Complaint")).Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	for i := 1; i <= 3; i++ {
+		hub.IncomingCh <- models.ChatMessage{RoomID: fmt.Sprintf("room%d", i), SenderID: "user_A", Type: "text", Content: "hi! m or f?"}
+	}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room3", SenderID: "user_A", Type: "text", Content: "hello?"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 3)
+	storageMock.AssertNotCalled(t, "SetUserAttribute", "user_A", "shadow_banned", mock.Anything)
+	select {
+	case msg := <-clientA.RecvChannel:
+		assert.Equal(t, "system_message_rate_limited", msg.Content)
+	default:
+		t.Error("suspect was not told about the rate limit")
+	}
+}
@@ -0,0 +1,69 @@
+package chathub
+
+import "chatgogo/backend/internal/models"
+
+// Hub is what transports need of the chat hub: they register the clients of their users,
+// hand over what the users send, and start searches. *ManagerService implements it; tests of
+// transports can use a fake instead. All methods are safe to call from any goroutine and
+// block while the hub is busy.
+type Hub interface {
+	// Register adds a client, e.g. when its user connects.
+	Register(client Client)
+	// Unregister removes a client, e.g. when its connection closed.
+	Unregister(client Client)
+	// Submit hands a message from a user, a chat message or a command, to the hub.
+	Submit(message models.ChatMessage)
+	// RequestMatch starts a search for a user, as /start without criteria does.
+	RequestMatch(userID string)
+	// TouchPresence reports that a user's connection is alive.
+	TouchPresence(userID string)
+	// UserSessions returns the clients a user is connected with, or nil if they are not
+	// connected to this hub.
+	UserSessions(userID string) []Client
+}
+
+// sessionsRequest asks the hub goroutine for the sessions of a user.
+type sessionsRequest struct {
+	userID string
+	result chan []Client
+}
+
+var _ Hub = (*ManagerService)(nil)
+
+// Register sends a client to RegisterCh.
+func (m *ManagerService) Register(client Client) {
+	m.RegisterCh <- client
+}
+
+// Unregister sends a client to UnregisterCh.
+func (m *ManagerService) Unregister(client Client) {
+	m.UnregisterCh <- client
+}
+
+// Submit sends a message to IncomingCh.
+func (m *ManagerService) Submit(message models.ChatMessage) {
+	m.IncomingCh <- message
+}
+
+// RequestMatch submits a command_start of the user, which goes through the same checks, e.g.
+// for bans, as the command sent by the user.
+func (m *ManagerService) RequestMatch(userID string) {
+	m.Submit(models.ChatMessage{SenderID: userID, Type: "command_start"})
+}
+
+// UserSessions sends a request to the hub goroutine, which owns Clients, and waits for the
+// sessions of the user.
+func (m *ManagerService) UserSessions(userID string) []Client {
+	req := sessionsRequest{userID: userID, result: make(chan []Client, 1)}
+	m.sessionsCh <- req
+	return <-req.result
+}
+
+// userSessions returns the sessions of a user registered in the hub, or nil.
+func (m *ManagerService) userSessions(userID string) []Client {
+	client, ok := m.Clients[userID]
+	if !ok {
+		return nil
+	}
+	return Sessions(client)
+}
@@ -0,0 +1,144 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LinkCodeTTL is how long a code for linking a web identity can be redeemed.
+const LinkCodeTTL = 10 * time.Minute
+
+// IdentityLinkTTL is how long a web identity stays linked, as long as the web tokens it is
+// used with are valid.
+const IdentityLinkTTL = 72 * time.Hour
+
+// handleLinkCommand processes command_link, e.g. "/link K7QF2M9X" sent to the bot: the web
+// identity that created the code (see storage.Storage.CreateLinkCode) is linked to the sender,
+// so that the web app connects as the sender from now on. A chat the web identity is in moves
+// to the sender, and its web sessions on this instance are closed to reconnect as them. A
+// code is used up even if linking fails.
+func (m *ManagerService) handleLinkCommand(message models.ChatMessage) {
+	client, ok := m.Clients[message.SenderID]
+	if !ok {
+		return
+	}
+	args := strings.TrimSpace(message.Content)
+	if strings.HasPrefix(args, "/") {
+		_, args, _ = strings.Cut(args, " ")
+	}
+	code := strings.ToUpper(strings.TrimSpace(args))
+	if code == "" {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, "system_link_invalid"))
+		return
+	}
+	webID, err := m.Storage.TakeLinkCode(code)
+	if err != nil {
+		log.Printf("ERROR: Failed to redeem link code of user %s: %v", message.SenderID, err)
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInternal, "system_link_failed"))
+		return
+	}
+	if webID == "" || webID == message.SenderID {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, "system_link_invalid"))
+		return
+	}
+
+	roomID, err := m.linkIdentity(webID, message.SenderID)
+	var conflict *roomConflictError
+	if errors.As(err, &conflict) {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, "system_link_busy"))
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to link web identity %s to user %s: %v", webID, message.SenderID, err)
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInternal, "system_link_failed"))
+		return
+	}
+	log.Printf("Linked web identity %s to user %s", webID, message.SenderID)
+
+	m.closeWebSessions(webID)
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_link_done",
+		SenderID: "system",
+	})
+	if roomID == "" {
+		return
+	}
+	delete(m.roomMembers, roomID)
+	m.forgetRoomActivity(roomID)
+	client.SetRoomID(roomID)
+	m.joinRoom(roomID)
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_link_chat_moved",
+		SenderID: "system",
+		RoomID:   roomID,
+	})
+}
+
+// linkIdentity links the web identity webID to userID and moves the seat of webID in its
+// active room, if any, to userID. It returns the room, or a *roomConflictError if both are in
+// an active room, or a room is being opened for one of them. The match locks of both keep
+// the matcher from opening a room for them meanwhile.
+func (m *ManagerService) linkIdentity(webID, userID string) (string, error) {
+	userIDs := []string{webID, userID}
+	token := uuid.New().String()
+	locked, err := m.Storage.LockMatch(token, userIDs, matchLockTTL)
+	if err != nil {
+		return "", err
+	}
+	if !locked {
+		return "", &roomConflictError{}
+	}
+	defer func() {
+		if err := m.Storage.UnlockMatch(token, userIDs); err != nil {
+			log.Printf("ERROR: Failed to release match locks of %s and %s: %v", webID, userID, err)
+		}
+	}()
+
+	webRoomID, err := m.Storage.GetActiveRoomIDForUser(webID)
+	if err != nil {
+		return "", err
+	}
+	if webRoomID != "" {
+		roomID, err := m.Storage.GetActiveRoomIDForUser(userID)
+		if err != nil {
+			return "", err
+		}
+		if roomID != "" {
+			return "", &roomConflictError{inRoom: userIDs}
+		}
+		if err := m.Storage.MoveRoomSeat(webRoomID, webID, userID); err != nil {
+			return "", err
+		}
+	}
+	if err := m.Storage.LinkIdentity(webID, userID, IdentityLinkTTL); err != nil {
+		return webRoomID, err
+	}
+	return webRoomID, nil
+}
+
+// closeWebSessions tells the sessions of a linked web identity on this instance to reconnect,
+// and closes them. They leave its room without dropping out of it, as the room is not theirs
+// anymore.
+func (m *ManagerService) closeWebSessions(webID string) {
+	current, ok := m.Clients[webID]
+	if !ok {
+		return
+	}
+	delete(m.mutes, webID)
+	m.sendToClient(current, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_link_reconnect",
+		SenderID: "system",
+	})
+	current.SetRoomID("")
+	for _, session := range Sessions(current) {
+		m.handleUnregister(session)
+	}
+}
@@ -0,0 +1,89 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newLinkHub() (*chathub.ManagerService, *MockStorage, *MockClient, *MockClient) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("LockMatch", mock.Anything, []string{"web_W", "tg_T"}, mock.Anything).Return(true, nil)
+	storageMock.On("UnlockMatch", mock.Anything, []string{"web_W", "tg_T"}).Return(nil)
+	return hub, storageMock, addTestClient(hub, "tg_T", ""), addTestClient(hub, "web_W", "")
+}
+
+func TestManager_LinkMovesWebChatToTelegram(t *testing.T) {
+	hub, storageMock, telegramClient, webClient := newLinkHub()
+	webClient.SetRoomID("room1")
+	storageMock.On("TakeLinkCode", "K7QF2M9X").Return("web_W", nil).Once()
+	storageMock.On("GetActiveRoomIDForUser", "web_W").Return("room1", nil)
+	storageMock.On("GetActiveRoomIDForUser", "tg_T").Return("", nil)
+	storageMock.On("MoveRoomSeat", "room1", "web_W", "tg_T").Return(nil).Once()
+	storageMock.On("LinkIdentity", "web_W", "tg_T", chathub.IdentityLinkTTL).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_link", Content: "/link k7qf2m9x", SenderID: "tg_T"}
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, "system_link_done", (<-telegramClient.RecvChannel).Content)
+	moved := <-telegramClient.RecvChannel
+	assert.Equal(t, "system_link_chat_moved", moved.Content)
+	assert.Equal(t, "room1", telegramClient.GetRoomID())
+
+	assert.Equal(t, "system_link_reconnect", (<-webClient.RecvChannel).Content)
+	_, open := <-webClient.RecvChannel
+	assert.False(t, open, "the web session must be closed to reconnect as the linked user")
+	assert.Empty(t, webClient.GetRoomID())
+	assert.False(t, connected(t, hub, "web_W"))
+	storageMock.AssertExpectations(t)
+}
+
+func TestManager_LinkRefusesUsersInTwoChats(t *testing.T) {
+	hub, storageMock, telegramClient, webClient := newLinkHub()
+	webClient.SetRoomID("room1")
+	telegramClient.SetRoomID("room2")
+	storageMock.On("TakeLinkCode", "K7QF2M9X").Return("web_W", nil).Once()
+	storageMock.On("GetActiveRoomIDForUser", "web_W").Return("room1", nil)
+	storageMock.On("GetActiveRoomIDForUser", "tg_T").Return("room2", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_link", Content: "/link K7QF2M9X", SenderID: "tg_T", RoomID: "room2"}
+	time.Sleep(50 * time.Millisecond)
+
+	notice := <-telegramClient.RecvChannel
+	assert.Equal(t, "system_link_busy", notice.Content)
+	assert.Equal(t, models.ErrorInvalidRequest, notice.Error.Code)
+	assert.Empty(t, webClient.RecvChannel)
+	assert.Equal(t, "room1", webClient.GetRoomID())
+	storageMock.AssertNotCalled(t, "MoveRoomSeat", mock.Anything, mock.Anything, mock.Anything)
+	storageMock.AssertNotCalled(t, "LinkIdentity", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestManager_LinkRejectsUnknownCode(t *testing.T) {
+	hub, storageMock, telegramClient, _ := newLinkHub()
+	storageMock.On("TakeLinkCode", "NOPE").Return("", nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_link", Content: "/link nope", SenderID: "tg_T"}
+	time.Sleep(50 * time.Millisecond)
+
+	notice := <-telegramClient.RecvChannel
+	assert.Equal(t, "system_link_invalid", notice.Content)
+	assert.Equal(t, models.ErrorInvalidRequest, notice.Error.Code)
+}
@@ -0,0 +1,146 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultIdleRoomCheckInterval is how often the sweeper looks for idle rooms.
+	DefaultIdleRoomCheckInterval = 5 * time.Minute
+	// DefaultRoomIdleTimeout is how long a room may go without a message before it is closed.
+	DefaultRoomIdleTimeout = 6 * time.Hour
+	// DefaultIdleRoomBatchSize is the maximum number of rooms claimed per batch.
+	DefaultIdleRoomBatchSize = 100
+)
+
+// idleRoomNotice is the message type, published to a room closed as idle, that tells the hubs
+// of its participants to free them.
+const idleRoomNotice = "system_room_idle_closed"
+
+// IdleRoomStorage is the part of storage.Storage the IdleRoomSweeper uses.
+type IdleRoomStorage interface {
+	CloseRoom(roomID, closedBy, reason string) error
+	ClaimIdleRooms(activeBefore time.Time, limit int) ([]string, error)
+	TrackActiveRooms() (int, error)
+	GetRoomByID(roomID string) (*models.ChatRoom, error)
+	PublishMessage(roomID string, msg models.ChatMessage) error
+}
+
+// IdleRoomSweeper is a background job that closes rooms in which no message was sent for
+// MaxIdle, e.g. because both participants forgot about the chat, so that they do not stay
+// stuck in it. Storage tracks the last message of every active room; each idle room is claimed
+// by one instance, closed, and announced on its channel, so that the hubs of its participants
+// notify them wherever they are connected. It is safe to run on every instance.
+type IdleRoomSweeper struct {
+	// Storage provides access to the data persistence layer.
+	Storage IdleRoomStorage
+	// Interval is the time between two sweeps.
+	Interval time.Duration
+	// MaxIdle is how long a room may go without a message.
+	MaxIdle time.Duration
+	// BatchSize is the maximum number of rooms claimed per batch.
+	BatchSize int
+}
+
+// NewIdleRoomSweeper creates and returns a new IdleRoomSweeper with default settings.
+func NewIdleRoomSweeper(s IdleRoomStorage) *IdleRoomSweeper {
+	return &IdleRoomSweeper{
+		Storage:   s,
+		Interval:  DefaultIdleRoomCheckInterval,
+		MaxIdle:   DefaultRoomIdleTimeout,
+		BatchSize: DefaultIdleRoomBatchSize,
+	}
+}
+
+// CloseIdleRooms closes the rooms without a message since MaxIdle before now, batch by batch,
+// and returns the number of rooms closed.
+func (s *IdleRoomSweeper) CloseIdleRooms(now time.Time) int {
+	closed := 0
+	for {
+		roomIDs, err := s.Storage.ClaimIdleRooms(now.Add(-s.MaxIdle), s.BatchSize)
+		if err != nil {
+			log.Printf("ERROR: Failed to claim idle rooms: %v", err)
+			break
+		}
+		for _, roomID := range roomIDs {
+			if s.closeRoom(roomID) {
+				closed++
+			}
+		}
+		if len(roomIDs) < s.BatchSize {
+			break
+		}
+	}
+
+	if closed > 0 {
+		log.Printf("Idle Room Sweeper: closed %d rooms idle for more than %v.", closed, s.MaxIdle)
+	}
+	return closed
+}
+
+// TrackActiveRooms makes the active rooms that storage does not track yet, e.g. after Redis
+// lost its data, count towards the idle timeout from their start. It is run once at startup.
+func (s *IdleRoomSweeper) TrackActiveRooms() {
+	added, err := s.Storage.TrackActiveRooms()
+	if err != nil {
+		log.Printf("ERROR: Failed to track the activity of active rooms: %v", err)
+		return
+	}
+	if added > 0 {
+		log.Printf("Idle Room Sweeper: tracking %d active rooms that were not tracked.", added)
+	}
+}
+
+// closeRoom closes a claimed room, unless it was closed meanwhile, and announces it on the
+// room's channel. It reports whether the room was closed.
+func (s *IdleRoomSweeper) closeRoom(roomID string) bool {
+	room, err := s.Storage.GetRoomByID(roomID)
+	if err != nil {
+		log.Printf("ERROR: Idle room %s not found: %v", roomID, err)
+		return false
+	}
+	if !room.IsActive {
+		return false
+	}
+	if err := s.Storage.CloseRoom(roomID, "system", "idle"); err != nil {
+		log.Printf("ERROR: Failed to close idle room %s: %v", roomID, err)
+		return false
+	}
+
+	notice := models.ChatMessage{
+		Type:     idleRoomNotice,
+		Content:  idleRoomNotice,
+		RoomID:   roomID,
+		SenderID: "system",
+	}
+	if err := s.Storage.PublishMessage(roomID, notice); err != nil {
+		log.Printf("ERROR: Failed to announce closing of idle room %s: %v", roomID, err)
+	}
+	return true
+}
+
+// handleIdleRoomClosed frees the participants of a room closed by the IdleRoomSweeper who are
+// connected to this instance, and tells them why the chat ended. A notice for a room that is
+// still active in storage is ignored, as only the sweeper closes rooms this way.
+func (m *ManagerService) handleIdleRoomClosed(room *models.ChatRoom, notice models.ChatMessage) {
+	if room.IsActive {
+		log.Printf("WARNING: Ignored an idle notice from %s for room %s, which is still active.", notice.SenderID, room.RoomID)
+		return
+	}
+	m.Rooms.Transition(room, RoomEnding, "system", "idle")
+	for _, userID := range []string{room.User1ID, room.User2ID} {
+		if m.dropped[userID] == room.RoomID {
+			delete(m.dropped, userID)
+		}
+		client, ok := m.Clients[userID]
+		if !ok || client.GetRoomID() != room.RoomID {
+			continue
+		}
+		client.SetRoomID("")
+		m.sendToClient(client, notice)
+	}
+	// The sweeper closed the room in storage already.
+	m.Rooms.Transition(room, RoomClosed, "system", "idle")
+}
@@ -0,0 +1,96 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestIdleRoomSweeper_ClosesIdleRooms verifies that the sweeper closes and announces the
+// claimed rooms that are still active, batch by batch.
+func TestIdleRoomSweeper_ClosesIdleRooms(t *testing.T) {
+	storageMock := new(MockStorage)
+	sweeper := chathub.NewIdleRoomSweeper(storageMock)
+	sweeper.BatchSize = 2
+	now := time.Now()
+	cutoff := now.Add(-chathub.DefaultRoomIdleTimeout)
+	storageMock.On("ClaimIdleRooms", cutoff, 2).Return([]string{"room1", "room2"}, nil).Once()
+	storageMock.On("ClaimIdleRooms", cutoff, 2).Return([]string{"room3"}, nil).Once()
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+	storageMock.On("GetRoomByID", "room2").Return(&models.ChatRoom{RoomID: "room2", IsActive: false}, nil)
+	storageMock.On("GetRoomByID", "room3").Return(&models.ChatRoom{RoomID: "room3", IsActive: true}, nil)
+	for _, roomID := range []string{"room1", "room3"} {
+		storageMock.On("CloseRoom", roomID, "system", "idle").Return(nil).Once()
+		storageMock.On("PublishMessage", roomID, mock.MatchedBy(func(msg models.ChatMessage) bool {
+			return msg.Type == "system_room_idle_closed" && msg.RoomID == roomID
+		})).Return(nil).Once()
+	}
+
+	assert.Equal(t, 2, sweeper.CloseIdleRooms(now))
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "CloseRoom", "room2", mock.Anything, mock.Anything)
+}
+
+// TestManager_IdleRoomClosedFreesParticipants verifies that the announcement of an idle room
+// frees and notifies its participants connected to the instance.
+func TestManager_IdleRoomClosedFreesParticipants(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"}, nil)
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	clientB := newMockClient("user_B")
+	clientB.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+	hub.PubSubCh <- models.ChatMessage{Type: "system_room_idle_closed", Content: "system_room_idle_closed", RoomID: "room1", SenderID: "system"}
+	time.Sleep(50 * time.Millisecond)
+
+	for _, client := range []*MockClient{clientA, clientB} {
+		assert.Empty(t, client.GetRoomID())
+		if assert.Len(t, client.RecvChannel, 1) {
+			assert.Equal(t, "system_room_idle_closed", (<-client.RecvChannel).Content)
+		}
+	}
+}
+
+// TestManager_IdleNoticeForActiveRoomIsIgnored verifies that an idle notice for a room that is
+// still active, which the sweeper never sends, leaves its participants in the chat.
+func TestManager_IdleNoticeForActiveRoomIsIgnored(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true}, nil)
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+	hub.PubSubCh <- models.ChatMessage{Type: "system_room_idle_closed", Content: "system_room_idle_closed", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, "room1", clientA.GetRoomID())
+	assert.Empty(t, clientA.RecvChannel)
+}
+
+// TestIdleRoomSweeper_TracksActiveRooms verifies that the sweeper asks storage to track the
+// active rooms it lost track of.
+func TestIdleRoomSweeper_TracksActiveRooms(t *testing.T) {
+	storageMock := new(MockStorage)
+	storageMock.On("TrackActiveRooms").Return(3, nil).Once()
+
+	chathub.NewIdleRoomSweeper(storageMock).TrackActiveRooms()
+	storageMock.AssertExpectations(t)
+}
@@ -0,0 +1,75 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultLeaderLeaseTTL is how long the matcher leader lease lasts without renewal. The
+// leader renews it three times per TTL, so a standby takes over within one TTL of the
+// leader dying.
+const DefaultLeaderLeaseTTL = 5 * time.Second
+
+// updateLeadership takes or renews the leader lease. An instance that becomes the leader
+// loads the shared queue from storage; one that loses the lease drops its local queue, which
+// stays in storage for the new leader. Errors count as a lost lease, so that two instances
+// never match at the same time.
+func (m *MatcherService) updateLeadership() {
+	leading, err := m.Storage.AcquireMatcherLeadership(m.InstanceID, m.LeaderLeaseTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to renew matcher leadership of instance %s: %v", m.InstanceID, err)
+		leading = false
+	}
+	if leading == m.leading {
+		return
+	}
+
+	m.leading = leading
+	m.Queue = NewSearchQueue()
+	m.profiles = make(map[string]*models.User)
+	m.recentPartners = make(map[string]map[string]time.Time)
+	m.toldAlone = make(map[string]bool)
+	m.lastStatus = make(map[string]string)
+	if leading {
+		log.Printf("INFO: Instance %s became the matcher leader.", m.InstanceID)
+		m.restoreSearchQueue()
+	} else {
+		log.Printf("WARNING: Instance %s is no longer the matcher leader, standing by.", m.InstanceID)
+	}
+}
+
+// queueForLeader hands a search request received by a standby instance to the leader: the
+// request is saved to the shared queue in storage, which the leader picks up on its next scan.
+func (m *MatcherService) queueForLeader(req models.SearchRequest) {
+	if err := m.Storage.SaveSearchRequest(req); err != nil {
+		log.Printf("Error adding user to search queue in storage: %v", err)
+		return
+	}
+	log.Printf("Match request of %s queued for the matcher leader.", req.UserID)
+}
+
+// syncSearchQueue brings the leader's local queue in line with the shared queue in storage:
+// users queued through standby instances are added, and users who left the queue elsewhere
+// are dropped.
+func (m *MatcherService) syncSearchQueue() {
+	users, err := m.Storage.GetSearchingUsers()
+	if err != nil {
+		log.Printf("ERROR: Failed to sync search queue: %v", err)
+		return
+	}
+
+	shared := make(map[string]bool, len(users))
+	for _, userID := range users {
+		shared[userID] = true
+		if !m.Queue.Contains(userID) {
+			m.enqueueRestored(userID)
+		}
+	}
+	for _, req := range m.Queue.Ordered() {
+		if !shared[req.UserID] {
+			m.Queue.Remove(req.UserID)
+			m.forget(req.UserID)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMatcherStandbyTakesOver verifies that a standby matcher only hands requests to the
+// shared queue, and restores that queue once it acquires the leader lease.
+func TestMatcherStandbyTakesOver(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	matcher.InstanceID = "instance-2"
+	matcher.LeaderLeaseTTL = 60 * time.Millisecond
+	matcher.MatchScanInterval = time.Hour
+
+	storageMock.On("AcquireMatcherLeadership", "instance-2", 60*time.Millisecond).Return(false, nil).Times(3)
+	storageMock.On("AcquireMatcherLeadership", "instance-2", 60*time.Millisecond).Return(true, nil)
+	strict := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female"}, Strict: true}
+	storageMock.On("SaveSearchRequest", strict).Return(nil).Once()
+	storageMock.On("GetSearchingUsers").Return([]string{"user_A"}, nil).Once()
+	storageMock.On("GetSearchRequest", "user_A").Return(&strict, nil).Once()
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A"}, nil).Once()
+
+	go matcher.Run(context.Background())
+
+	hub.MatchRequestCh <- strict
+	time.Sleep(20 * time.Millisecond)
+	storageMock.AssertCalled(t, "SaveSearchRequest", strict)
+	storageMock.AssertNotCalled(t, "GetSearchingUsers")
+	storageMock.AssertNotCalled(t, "GetUserByID", "user_A")
+
+	assert.Eventually(t, func() bool {
+		return storageMock.AssertExpectations(new(testing.T))
+	}, time.Second, 10*time.Millisecond, "standby did not take over and restore the queue")
+}
@@ -0,0 +1,210 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the queue liquidity balancer.
+const (
+	// DefaultFloodMinDemand is the minimum number of searching users in a segment before it
+	// can be considered flooded.
+	DefaultFloodMinDemand = 10
+	// DefaultFloodRatio is the number of possible partners per searching user below which a
+	// segment is flooded.
+	DefaultFloodRatio = 0.25
+	// DefaultFloodedSearchTimeout is how long a user of a flooded segment may wait before the
+	// search is cancelled.
+	DefaultFloodedSearchTimeout = 5 * time.Minute
+)
+
+// FloodedRelaxSpeedup is how many times faster the filters of users in a flooded segment are
+// relaxed.
+const FloodedRelaxSpeedup = 2
+
+// LiquidityWindow is the period over which matches are counted to estimate the wait of
+// users in a flooded segment.
+const LiquidityWindow = 15 * time.Minute
+
+// SegmentLiquidity describes the supply and demand of one queue segment.
+type SegmentLiquidity struct {
+	// Demand is the number of queued users in the segment.
+	Demand int
+	// Supply is the number of queued users whose gender and filters fit the segment.
+	Supply int
+	// Flooded is set when the demand is at least FloodMinDemand and the supply per searching
+	// user is below FloodRatio.
+	Flooded bool
+}
+
+// segmentOf returns the queue segment of a search: the gender of the user and the gender
+// they are looking for with their current filters, e.g. "male>female". Unknown genders are
+// "unknown", and no gender filter is "any".
+func (m *MatcherService) segmentOf(req models.SearchRequest) string {
+	gender, target := "unknown", "any"
+	if user := m.profile(req.UserID); user != nil && user.Gender != "" {
+		gender = user.Gender
+	}
+	if params := req.EffectiveParams(); params.TargetGender != "" {
+		target = params.TargetGender
+	}
+	return gender + ">" + target
+}
+
+// fitsSegment reports whether a segment and a queued user may be paired by gender alone.
+func fitsSegment(gender, target, candidateSegment string) bool {
+	candidateGender, candidateTarget := splitSegment(candidateSegment)
+	return (target == "any" || candidateGender == target) &&
+		(candidateTarget == "any" || candidateTarget == gender)
+}
+
+// splitSegment returns the gender and the target gender of a segment.
+func splitSegment(segment string) (gender, target string) {
+	gender, target, _ = strings.Cut(segment, ">")
+	return gender, target
+}
+
+// BalanceLiquidity measures the supply and demand of every queue segment. A segment is
+// flooded when many users search in it but few queued users fit it, e.g. many men looking
+// for women. Users of flooded segments have their filters relaxed faster, time out sooner
+// (see FloodedSearchTimeout), and are told once per search how long they can expect to wait.
+// The measurements are reported to Metrics. It returns the liquidity of every segment.
+func (m *MatcherService) BalanceLiquidity(now time.Time) map[string]SegmentLiquidity {
+	ordered := m.Queue.Ordered()
+	segments := make([]string, len(ordered))
+	liquidity := make(map[string]SegmentLiquidity)
+	for i, req := range ordered {
+		segments[i] = m.segmentOf(req)
+		l := liquidity[segments[i]]
+		l.Demand++
+		liquidity[segments[i]] = l
+	}
+	for segment, l := range liquidity {
+		gender, target := splitSegment(segment)
+		for _, candidate := range segments {
+			if fitsSegment(gender, target, candidate) {
+				l.Supply++
+			}
+		}
+		if fitsSegment(gender, target, segment) {
+			l.Supply-- // Users of the segment cannot be paired with themselves.
+		}
+		l.Flooded = m.FloodMinDemand > 0 && l.Demand >= m.FloodMinDemand &&
+			float64(l.Supply) < float64(l.Demand)*m.FloodRatio
+		if l.Flooded && !m.liquidity[segment].Flooded {
+			log.Printf("Matcher: segment %s is flooded (%d searching, %d possible partners).", segment, l.Demand, l.Supply)
+		}
+		liquidity[segment] = l
+	}
+
+	m.pruneSegmentMatches(now)
+	position := make(map[string]int)
+	for i, req := range ordered {
+		segment := segments[i]
+		position[segment]++
+		if liquidity[segment].Flooded {
+			m.tellLongWait(req.UserID, m.expectedWait(segment, position[segment]))
+		}
+	}
+
+	m.reportLiquidity(liquidity)
+	m.liquidity = liquidity
+	return liquidity
+}
+
+// isFlooded reports whether a queued search was in a flooded segment at the last
+// BalanceLiquidity.
+func (m *MatcherService) isFlooded(req models.SearchRequest) bool {
+	for _, l := range m.liquidity {
+		if l.Flooded {
+			return m.liquidity[m.segmentOf(req)].Flooded
+		}
+	}
+	return false // Don't load profiles while no segment is flooded.
+}
+
+// expectedWait estimates how long the user at the given 1-based position of a segment waits
+// for a partner, from the matches of the segment within LiquidityWindow. It returns zero if
+// no one in the segment was matched recently.
+func (m *MatcherService) expectedWait(segment string, position int) time.Duration {
+	matches := len(m.segmentMatches[segment])
+	if matches == 0 {
+		return 0
+	}
+	perMatch := LiquidityWindow / time.Duration(matches)
+	return time.Duration(position) * perMatch
+}
+
+// tellLongWait tells a user of a flooded segment, once per search, that they can expect a
+// long wait. The notice carries the expected wait in minutes as Metadata, if it is known.
+func (m *MatcherService) tellLongWait(userID string, wait time.Duration) {
+	if m.toldLongWait[userID] {
+		return
+	}
+	m.toldLongWait[userID] = true
+	message := models.ChatMessage{
+		Type:     "system_long_wait",
+		Content:  "system_long_wait_unknown",
+		SenderID: "system",
+	}
+	if wait > 0 {
+		message.Content = "system_long_wait"
+		message.Metadata = strconv.Itoa(max(int(math.Ceil(wait.Minutes())), 1))
+	}
+	m.Hub.withClient(userID, func(client Client) {
+		m.Hub.sendToClient(client, message)
+	})
+}
+
+// recordSegmentMatch remembers that a queued user was matched, for the wait estimates of
+// their segment.
+func (m *MatcherService) recordSegmentMatch(userID string, now time.Time) {
+	if req, ok := m.Queue.Get(userID); ok {
+		segment := m.segmentOf(req)
+		m.segmentMatches[segment] = append(m.segmentMatches[segment], now)
+	}
+}
+
+// pruneSegmentMatches forgets the matches older than LiquidityWindow.
+func (m *MatcherService) pruneSegmentMatches(now time.Time) {
+	for segment, matches := range m.segmentMatches {
+		recent := matches[:0]
+		for _, at := range matches {
+			if now.Sub(at) < LiquidityWindow {
+				recent = append(recent, at)
+			}
+		}
+		if len(recent) == 0 {
+			delete(m.segmentMatches, segment)
+		} else {
+			m.segmentMatches[segment] = recent
+		}
+	}
+}
+
+// reportLiquidity reports the liquidity of every segment to Metrics. Segments that emptied
+// since the last report are reported as empty.
+func (m *MatcherService) reportLiquidity(liquidity map[string]SegmentLiquidity) {
+	if m.Metrics == nil {
+		return
+	}
+	segments := make([]string, 0, len(liquidity))
+	for segment := range liquidity {
+		segments = append(segments, segment)
+	}
+	for segment := range m.liquidity {
+		if _, ok := liquidity[segment]; !ok {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Strings(segments)
+	for _, segment := range segments {
+		l := liquidity[segment]
+		m.Metrics.SegmentLiquidity(segment, l.Demand, l.Supply, l.Flooded)
+	}
+}
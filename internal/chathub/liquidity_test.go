@@ -0,0 +1,81 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFloodedMatcher returns a matcher whose queue holds four men looking for women, queued
+// 6, 4, 3 and 2 minutes ago, and one woman looking for women, queued 6 minutes ago.
+func newFloodedMatcher(storageMock *MockStorage, now time.Time) (*chathub.MatcherService, map[string]*MockClient) {
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	matcher.FloodMinDemand = 3
+
+	clients := make(map[string]*MockClient)
+	for i, waited := range []time.Duration{6, 4, 3, 2} {
+		id := fmt.Sprintf("man_%d", i)
+		storageMock.On("GetUserByID", id).Return(&models.User{ID: id, Gender: "male"}, nil)
+		clients[id] = newMockClient(id)
+		hub.Clients[id] = clients[id]
+		matcher.Queue.Push(models.SearchRequest{
+			UserID:     id,
+			Params:     models.SearchParams{TargetGender: "female"},
+			EnqueuedAt: now.Add(-waited * time.Minute),
+		})
+	}
+	storageMock.On("GetUserByID", "woman").Return(&models.User{ID: "woman", Gender: "female"}, nil)
+	clients["woman"] = newMockClient("woman")
+	hub.Clients["woman"] = clients["woman"]
+	matcher.Queue.Push(models.SearchRequest{
+		UserID:     "woman",
+		Params:     models.SearchParams{TargetGender: "female"},
+		EnqueuedAt: now.Add(-6 * time.Minute),
+		Strict:     true,
+	})
+	return matcher, clients
+}
+
+// TestMatcherBalanceLiquidity verifies that a segment with many users and no possible
+// partners is flooded, and that its users are told once about the long wait.
+func TestMatcherBalanceLiquidity(t *testing.T) {
+	storageMock := new(MockStorage)
+	now := time.Now()
+	matcher, clients := newFloodedMatcher(storageMock, now)
+
+	liquidity := matcher.BalanceLiquidity(now)
+	matcher.BalanceLiquidity(now.Add(time.Second))
+
+	assert.Equal(t, chathub.SegmentLiquidity{Demand: 4, Supply: 0, Flooded: true}, liquidity["male>female"])
+	assert.Equal(t, chathub.SegmentLiquidity{Demand: 1, Supply: 0, Flooded: false}, liquidity["female>female"])
+	notice := <-clients["man_0"].RecvChannel
+	assert.Equal(t, "system_long_wait", notice.Type)
+	assert.Equal(t, "system_long_wait_unknown", notice.Content, "No one in the segment was matched yet")
+	assert.Empty(t, clients["man_0"].RecvChannel, "The notice is sent once per search")
+	assert.Empty(t, clients["woman"].RecvChannel)
+}
+
+// TestMatcherFloodedSegmentExpiresAndRelaxesSooner verifies that searches of a flooded
+// segment time out after FloodedSearchTimeout and have their filters relaxed faster.
+func TestMatcherFloodedSegmentExpiresAndRelaxesSooner(t *testing.T) {
+	storageMock := new(MockStorage)
+	now := time.Now()
+	matcher, _ := newFloodedMatcher(storageMock, now)
+	storageMock.On("RemoveUserFromSearchQueue", "man_0").Return(nil).Once()
+	matcher.BalanceLiquidity(now)
+
+	expired := matcher.ExpireStaleSearches(now)
+	matcher.RelaxFilters(now)
+
+	assert.Equal(t, 1, expired)
+	assert.False(t, matcher.Queue.Contains("man_0"), "Flooded searches time out after FloodedSearchTimeout")
+	assert.True(t, matcher.Queue.Contains("woman"), "Other searches keep the regular SearchTimeout")
+	man, _ := matcher.Queue.Get("man_2")
+	assert.Equal(t, 3, man.RelaxLevel, "Three minutes at twice the pace are three relaxation steps")
+	storageMock.AssertExpectations(t)
+}
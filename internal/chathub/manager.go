@@ -3,15 +3,108 @@
 package chathub
 
 import (
+	"chatgogo/backend/internal/analysis"
+	"chatgogo/backend/internal/anonymize"
 	"chatgogo/backend/internal/models"
 	"chatgogo/backend/internal/storage"
+	"context"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ClientRestorer is a function type that defines a factory for creating a Client.
 // It's used to restore a client's session, for example, on application restart.
 type ClientRestorer func(userID string) (Client, error)
 
+// HubStorage is the part of storage.Storage the hub uses.
+type HubStorage interface {
+	// User operations
+	GetUserByID(userID string) (*models.User, error)
+	SetUserBotBlocked(userID string, blocked bool) error
+	UpdateUserReadReceipts(userID string, value bool) error
+	UpdateUserHideTyping(userID string, value bool) error
+	UpdateUserHidePresence(userID string, value bool) error
+	BlockUser(userID, blockedID string) error
+	GetUserFiles(userID string) (mediaURLs, archiveURLs []string, err error)
+	DeleteUserData(userID string) error
+	AdjustUserRating(userID string, delta int) error
+
+	// Generic User Attributes (Redis) - for transient data like message IDs
+	SetUserAttribute(userID string, key string, value string) error
+	GetUserAttribute(userID string, key string) (string, error)
+
+	// Presence (Redis)
+	RefreshPresence(userIDs []string, ttl time.Duration) error
+	IsUserOnline(userID string) (bool, error)
+
+	// Identity links (Redis)
+	TakeLinkCode(code string) (string, error)
+	LinkIdentity(webID, userID string, ttl time.Duration) error
+
+	// Pseudonyms (Redis)
+	SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error
+
+	// Room operations
+	CloseRoom(roomID, closedBy, reason string) error
+	MoveRoomSeat(roomID, fromUserID, toUserID string) error
+	GetActiveRoomIDForUser(userID string) (string, error)
+	GetLastClosedRoomForUser(userID string) (*models.ChatRoom, error)
+	GetActiveRoomIDs() ([]string, error)
+	GetRoomByID(roomID string) (*models.ChatRoom, error)
+
+	// Partners (Redis)
+	AddRecentPartners(user1ID, user2ID string, ttl time.Duration) error
+	AddRematchRequest(fromID, toID string, ttl time.Duration) error
+	TakeRematchRequest(fromID, toID string) (bool, error)
+
+	// Room channels (Redis Pub/Sub)
+	PublishMessage(roomID string, msg models.ChatMessage) error
+	SubscribeToRooms() storage.RoomSubscription
+
+	// Message and History operations
+	SaveMessage(msg *models.ChatMessage) error
+	MarkRead(roomID, userID string, historyID uint) (bool, error)
+	FindHistoryByID(id uint) (*models.ChatHistory, error)
+
+	// Outbox operations
+	PublishSavedMessage(msg models.ChatMessage) error
+
+	// Offline messages (Redis)
+	QueueOfflineMessage(userID string, msg models.ChatMessage, limit int, ttl time.Duration) (bool, error)
+	TakeOfflineMessages(userID string) ([]models.ChatMessage, error)
+
+	// Complaint operations
+	SaveComplaint(complaint *models.Complaint) error
+	GetComplaintsByRoomAndReportedUser(roomID, userID string) ([]models.Complaint, error)
+
+	// Ban operations
+	IsUserBanned(anonID string) (bool, error)
+	GetBansForUser(userID string) ([]models.Ban, error)
+
+	// Media moderation operations (Redis)
+	IsMediaBlacklisted(kind, value string) (bool, error)
+	IncrementMediaStrikes(userID string) (int64, error)
+
+	// Command usage operations (Redis)
+	RecordCommandUsage(userID, command string, at time.Time) (int64, error)
+
+	// Search Queue operations
+	SaveSearchRequest(req models.SearchRequest) error
+	RemoveUserFromSearchQueue(userID string) error
+	IsUserSearching(userID string) (bool, error)
+	LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error)
+	UnlockMatch(token string, userIDs []string) error
+	GetSearchQueueStatus(userID string) (position, total int, err error)
+
+	// Client registry (Redis)
+	RegisterClientInstance(instanceID string, userIDs []string, ttl time.Duration) error
+	UnregisterClientInstance(instanceID, userID string) error
+	GetClientInstance(userID string) (string, error)
+}
+
 // ManagerService acts as a central hub for managing clients and chat rooms.
 // It handles client registration, unregistration, message routing, and matchmaking requests.
 type ManagerService struct {
@@ -20,43 +113,248 @@ type ManagerService struct {
 
 	// IncomingCh is a channel for receiving all incoming messages from clients.
 	IncomingCh chan models.ChatMessage
-	// MatchRequestCh is a channel for queuing users who are looking for a chat partner.
+	// MatchRequestCh is a channel for queuing users who are looking for a chat partner. When it
+	// is full, new requests are rejected (see requestMatch); replace it before Run to change
+	// its capacity.
 	MatchRequestCh chan models.SearchRequest
+	// CancelSearchCh is a channel for removing users from the matchmaking queue.
+	CancelSearchCh chan string
+	// RematchCh is a channel for pairs of users who agreed to chat again (see /again).
+	RematchCh chan Rematch
 	// RegisterCh is a channel for handling new client registrations.
 	RegisterCh chan Client
 	// UnregisterCh is a channel for handling client disconnections.
 	UnregisterCh chan Client
 
 	// Storage provides access to the data persistence layer.
-	Storage storage.Storage
+	Storage HubStorage
 	// PubSubCh is a channel for receiving messages from the Redis Pub/Sub subscription.
 	PubSubCh chan models.ChatMessage
 	// ClientRestorer is a function used to recreate a client's state during session recovery.
 	ClientRestorer ClientRestorer
+	// Writer, if set, saves and publishes chat messages in batches (see MessageWriter);
+	// otherwise the hub saves each message itself before publishing it.
+	Writer *MessageWriter
+
+	// GhostNudgeAfter is the silence period after which the silent partner is nudged.
+	GhostNudgeAfter time.Duration
+	// GhostSkipOfferAfter is the silence period after which the waiting user is offered a skip.
+	GhostSkipOfferAfter time.Duration
+	// ActivityCheckInterval controls how often room activity timers are evaluated.
+	ActivityCheckInterval time.Duration
+	// DisconnectGrace is how long a web user who dropped out of a chat has to reconnect
+	// before the room is closed and their partner freed (0 = wait forever).
+	DisconnectGrace time.Duration
+	// PresenceTTL is how long a user counts as online after their connection was last seen
+	// alive, and how long the hub's online mark in storage lasts (0 = no presence updates).
+	PresenceTTL time.Duration
+	// DeliveryRetryDelay is how long a relayed message waits before it is handed again to a
+	// client whose send channel was full; the delay doubles with each attempt (0 =
+	// DefaultDeliveryRetryDelay).
+	DeliveryRetryDelay time.Duration
+	// DeadClientTimeout is how long a client may not take any message, or a web client may
+	// not be heard from, before the hub removes it (0 = never).
+	DeadClientTimeout time.Duration
+	// OfflineMessageTTL is how long chat messages wait for a recipient who was offline when
+	// they were relayed, to be delivered when they connect again (0 = drop them).
+	OfflineMessageTTL time.Duration
+	// InstanceID identifies this instance in the client registry, which records the instance
+	// holding each user's client so that messages are only processed where their recipient
+	// is. If empty, the registry is not used.
+	InstanceID string
+	// ClientRegistryTTL is how long a registry entry lasts unless this instance refreshes it.
+	ClientRegistryTTL time.Duration
+	// Rooms tracks the lifecycle of the rooms of this instance's users. Subscribe to it to
+	// act on rooms being matched, becoming active, ending and closing.
+	Rooms *RoomLifecycle
+
+	// Screener screens the first URL/media message of new accounts before it is relayed.
+	Screener ContentScreener
+	// NewAccountReviewPeriod is the account age below which first-message review applies.
+	NewAccountReviewPeriod time.Duration
+
+	// RematchCooldown is how long two users who chatted are kept from being matched again.
+	// Zero disables rematch prevention.
+	RematchCooldown time.Duration
+	// SamePairCooldown is the minimum time before two users who just chatted can be matched
+	// again, applied even when RematchCooldown is shorter or disabled.
+	SamePairCooldown time.Duration
+	// RematchWindow is how long after a chat ends its participants can agree with /again to
+	// chat again. Zero disables /again.
+	RematchWindow time.Duration
+	// RequeueAbandonedPartner puts the partner of a user who leaves with /next back into the
+	// search queue, unless the partner chose otherwise (models.User.AutoRequeue).
+	RequeueAbandonedPartner bool
+
+	// SkipLimit is the number of /next allowed within SkipWindow; a user who exceeds it
+	// cannot search for SkipCooldown. Zero disables the limit.
+	SkipLimit int
+	// SkipWindow is the period over which /next commands are counted.
+	SkipWindow time.Duration
+	// SkipCooldown is how long a user who exceeded SkipLimit cannot search.
+	SkipCooldown time.Duration
+	// SkipRepeatWindow is the period after a cooldown in which exceeding SkipLimit again
+	// costs SkipPenalty rating points.
+	SkipRepeatWindow time.Duration
+
+	// MessageRate is the number of chat messages per second a user may send on average, and
+	// MessageBurst the number they may send at once; messages beyond are dropped. Zero
+	// disables the limit.
+	MessageRate  float64
+	MessageBurst int
+
+	// CommandAbuseThresholds are the numbers of times per hour a user may issue each command
+	// (see trackedCommands) before they are reported to moderators. Commands without a
+	// threshold are only counted.
+	CommandAbuseThresholds map[string]int64
+	// MediaFiles and ArchiveFiles hold the re-hosted media and the archived transcripts of
+	// chats, erased along with the data of a user who asks for it. Nil if not kept.
+	MediaFiles   FileStore
+	ArchiveFiles FileStore
+	// Anonymizer derives the pseudonyms under which commands are counted in the analytics.
+	// Instances sharing the analytics must share its key.
+	Anonymizer anonymize.Anonymizer
+
+	// Honeypot detects scripted clients from the timing and shape of their messages. Nil
+	// disables bot detection.
+	Honeypot *analysis.Detector
+	// SuspectMessageInterval is the minimum time between two relayed messages of a
+	// suspected bot.
+	SuspectMessageInterval time.Duration
+
+	// roomActivity holds anti-ghosting timers, keyed by room ID.
+	roomActivity map[string]*roomActivity
+	// safeModeRooms caches the safe-mode flag of active rooms, keyed by room ID.
+	safeModeRooms map[string]bool
+	// honeypot holds the bot detection state of the hub.
+	honeypot honeypotState
+	// skips holds the /next history of users, keyed by user ID.
+	skips map[string]*skipState
+	// floods holds the message token buckets of users, keyed by user ID.
+	floods map[string]*messageBucket
+	// presence records when the connections of web users were last heard from.
+	presence *presence
+	// dropped holds the rooms of web users whose connection went away mid-chat, keyed by
+	// user ID, until they reconnect or DisconnectGrace passes.
+	dropped map[string]string
+	// lastActive holds when the users of this instance last connected or sent something,
+	// keyed by user ID: the presence of users whose transport does not report it.
+	lastActive map[string]time.Time
+	// presenceStatuses holds the last online status of the users in rooms, keyed by user ID.
+	presenceStatuses map[string]presenceStatus
+	// clientsMu guards the changes of Clients, which the matcher reads from its own
+	// goroutine (see withClient). The hub goroutine reads Clients without it.
+	clientsMu sync.RWMutex
+	// stuckMu guards stuckSince, which sendToClient updates from either goroutine.
+	stuckMu sync.Mutex
+	// stuckSince holds since when the clients that do not take messages have not been
+	// taking them, keyed by user ID.
+	stuckSince map[string]time.Time
+	// roomMembers holds the users of the rooms this instance received messages of, keyed by
+	// room ID, if the client registry is used.
+	roomMembers map[string]roomMembers
+	// mutes holds the users who muted their partner, keyed by user ID.
+	mutes map[string]*roomMute
+	// cancellations holds the users whose search cancellation found CancelSearchCh full.
+	cancellations []string
+	// deleting holds the users whose data is being erased, keyed by user ID.
+	deleting map[string]bool
+	// deletions carries the outcomes of data deletions to the hub goroutine.
+	deletions chan dataDeletion
+	// outbox holds the relayed messages waiting for busy clients, keyed by recipient ID.
+	outbox map[string][]*pendingDelivery
+	// snapshotCh carries the requests of Snapshot to the hub goroutine.
+	snapshotCh chan snapshotRequest
+	// sessionsCh carries the requests of UserSessions to the hub goroutine.
+	sessionsCh chan sessionsRequest
+	// roomSubs carries changes of the rooms joined by the pub/sub listener (see pubsub.go).
+	roomSubs chan roomSubscriptionChange
+	// listener is the subscription of the running pub/sub listener, or nil.
+	listener atomic.Pointer[roomListener]
+	// commands holds the handlers of commands and signals, keyed by message type (see Handle).
+	commands map[string]MessageHandler
+	// middlewares are the steps chat messages go through before they are saved (see Use).
+	middlewares []MessageMiddleware
+	// pipeline is the handler of chat messages built from middlewares, or nil until it is
+	// built again after they changed.
+	pipeline MessageHandler
 }
 
 // NewManagerService creates and returns a new ManagerService instance.
-func NewManagerService(s storage.Storage) *ManagerService {
-	return &ManagerService{
+func NewManagerService(s HubStorage) *ManagerService {
+	m := &ManagerService{
 		Clients:        make(map[string]Client),
-		IncomingCh:     make(chan models.ChatMessage, 10),
-		MatchRequestCh: make(chan models.SearchRequest, 10),
-		RegisterCh:     make(chan Client, 10),
-		UnregisterCh:   make(chan Client, 10),
+		MatchRequestCh: make(chan models.SearchRequest, DefaultMatchRequestCapacity),
 		Storage:        s,
-		PubSubCh:       make(chan models.ChatMessage, 10),
+
+		GhostNudgeAfter:       DefaultGhostNudgeAfter,
+		GhostSkipOfferAfter:   DefaultGhostSkipOfferAfter,
+		ActivityCheckInterval: DefaultActivityCheckInterval,
+		DisconnectGrace:       DefaultDisconnectGrace,
+		PresenceTTL:           DefaultPresenceTTL,
+		DeliveryRetryDelay:    DefaultDeliveryRetryDelay,
+		DeadClientTimeout:     DefaultDeadClientTimeout,
+		OfflineMessageTTL:     DefaultOfflineMessageTTL,
+		ClientRegistryTTL:     DefaultClientRegistryTTL,
+
+		Screener:               NewKeywordScreener(),
+		NewAccountReviewPeriod: DefaultNewAccountReviewPeriod,
+		RematchCooldown:        DefaultRematchCooldown,
+		SamePairCooldown:       DefaultSamePairCooldown,
+		RematchWindow:          DefaultRematchWindow,
+		Honeypot:               analysis.NewDetector(analysis.DefaultConfig()),
+		SuspectMessageInterval: DefaultSuspectMessageInterval,
+		SkipLimit:              DefaultSkipLimit,
+		SkipWindow:             DefaultSkipWindow,
+		SkipCooldown:           DefaultSkipCooldown,
+		SkipRepeatWindow:       DefaultSkipRepeatWindow,
+		CommandAbuseThresholds: DefaultCommandAbuseThresholds,
+		Anonymizer:             anonymize.NewHMAC(anonymize.RandomKey()),
+		MessageRate:            DefaultMessageRate,
+		MessageBurst:           DefaultMessageBurst,
+
+		roomActivity:     make(map[string]*roomActivity),
+		safeModeRooms:    make(map[string]bool),
+		honeypot:         newHoneypotState(),
+		skips:            make(map[string]*skipState),
+		floods:           make(map[string]*messageBucket),
+		presence:         newPresence(),
+		dropped:          make(map[string]string),
+		lastActive:       make(map[string]time.Time),
+		presenceStatuses: make(map[string]presenceStatus),
+		stuckSince:       make(map[string]time.Time),
+		roomMembers:      make(map[string]roomMembers),
+		mutes:            make(map[string]*roomMute),
+		deleting:         make(map[string]bool),
+		deletions:        make(chan dataDeletion),
+		outbox:           make(map[string][]*pendingDelivery),
+		snapshotCh:       make(chan snapshotRequest),
+		sessionsCh:       make(chan sessionsRequest),
+		roomSubs:         make(chan roomSubscriptionChange, roomSubscriptionBuffer),
+		Rooms:            NewRoomLifecycle(),
 	}
+	m.SetChannelBuffer(DefaultChannelBuffer)
+	m.Rooms.Subscribe(m.forgetClosedRoom)
+	m.commands = m.commandHandlers()
+	m.middlewares = m.defaultMessageMiddlewares()
+	return m
 }
 
 // Run starts the main event loop for the ManagerService.
 // It listens on all its channels and processes incoming events, such as client
-// registrations, messages, and matchmaking requests. This function is intended
-// to be run as a goroutine.
-func (m *ManagerService) Run() {
+// registrations, messages, and matchmaking requests. When ctx is cancelled, it flushes
+// pending events, closes all client channels and returns (see shutdown). This function is
+// intended to be run as a goroutine.
+func (m *ManagerService) Run(ctx context.Context) {
 	log.Println("Chat Hub Manager started and listening to channels...")
-	m.StartPubSubListener()
+	m.StartPubSubListener(ctx)
 	m.RecoverActiveRooms()
 
+	activityTicker := time.NewTicker(m.ActivityCheckInterval)
+	defer activityTicker.Stop()
+	deliveryTicker := time.NewTicker(m.deliveryRetryDelay())
+	defer deliveryTicker.Stop()
+
 	for {
 		select {
 		case client := <-m.RegisterCh:
@@ -67,6 +365,31 @@ func (m *ManagerService) Run() {
 			m.handleIncomingMessage(message)
 		case message := <-m.PubSubCh:
 			m.handlePubSubMessage(message)
+		case now := <-activityTicker.C:
+			m.checkRoomActivity(now)
+			m.checkClientHealth(now)
+			m.checkDropped(now)
+			m.updatePresence(now)
+			if m.Honeypot != nil {
+				m.Honeypot.Prune(now)
+				m.pruneHoneypot(now)
+			}
+			m.pruneSkips(now)
+			m.pruneFloods(now)
+			m.refreshClientRegistry()
+			m.syncRoomSubscriptions()
+		case now := <-deliveryTicker.C:
+			m.retryDeliveries(now)
+			m.retryCancellations()
+		case deletion := <-m.deletions:
+			m.finishDataDeletion(deletion)
+		case req := <-m.snapshotCh:
+			req.result <- m.snapshot(req.userID, time.Now())
+		case req := <-m.sessionsCh:
+			req.result <- m.userSessions(req.userID)
+		case <-ctx.Done():
+			m.shutdown()
+			return
 		}
 	}
 }
@@ -83,7 +406,7 @@ func (m *ManagerService) RestoreClientSession(userID string) error {
 		return nil // No restorer configured
 	}
 
-	if _, ok := m.Clients[userID]; ok {
+	if m.withClient(userID, func(Client) {}) {
 		return nil // Client already exists
 	}
 
@@ -119,54 +442,138 @@ func (m *ManagerService) RecoverActiveRooms() {
 }
 
 func (m *ManagerService) handleRegister(client Client) {
-	if _, ok := m.Clients[client.GetUserID()]; ok {
-		// Client is reconnecting
-		client.GetSendChannel() <- models.ChatMessage{
+	userID := client.GetUserID()
+	previous, registered := m.Clients[userID]
+	if registered && previous != client {
+		// Client is reconnecting, or connecting from another transport or tab while the
+		// previous connection is still open. Both stay connected.
+		m.sendToClient(client, models.ChatMessage{
 			Type:    "system_info",
 			Content: "system_reconnect",
-		}
+		})
+		m.setClient(userID, m.addSession(previous, client))
+	} else {
+		m.setClient(userID, client)
+	}
+	m.lastActive[userID] = time.Now()
+	m.resumeDropped(client)
+	if !registered {
+		m.registerInstance(userID)
+		m.flushOffline(client)
 	}
-	m.Clients[client.GetUserID()] = client
-	log.Printf("Client registered: %s", client.GetUserID())
+	m.joinRoom(client.GetRoomID())
+	log.Printf("Client registered: %s", userID)
 }
 
 func (m *ManagerService) handleUnregister(client Client) {
-	if _, ok := m.Clients[client.GetUserID()]; ok {
-		delete(m.Clients, client.GetUserID())
-		close(client.GetSendChannel())
-		log.Printf("Client unregistered: %s", client.GetUserID())
+	userID := client.GetUserID()
+	current, ok := m.Clients[userID]
+	if !ok {
+		return
+	}
+	if current != client {
+		// The user is connected more than once; only the last session to go unregisters them.
+		group, isGroup := current.(*sessionGroup)
+		if !isGroup || !group.remove(client) {
+			return
+		}
+		if remaining := group.size(); remaining > 0 {
+			log.Printf("Client %s closed a session, %d left.", userID, remaining)
+			return
+		}
 	}
+	m.clientsMu.Lock()
+	delete(m.Clients, userID)
+	m.clientsMu.Unlock()
+	delete(m.honeypot.shadowBanned, userID)
+	delete(m.honeypot.lastRelayed, userID)
+	m.forgetStuck(userID)
+	delete(m.lastActive, userID)
+	m.trackDropped(client)
+	if _, waiting := m.dropped[userID]; !waiting {
+		m.forgetPresence(userID)
+	}
+	m.unregisterInstance(userID)
+	close(current.GetSendChannel())
+	log.Printf("Client unregistered: %s", userID)
 }
 
 func (m *ManagerService) handleIncomingMessage(message models.ChatMessage) {
-	switch message.Type {
-	case "command_start":
-		m.MatchRequestCh <- models.SearchRequest{UserID: message.SenderID}
-		if client, ok := m.Clients[message.SenderID]; ok {
-			client.GetSendChannel() <- models.ChatMessage{
-				Type:    "system_info",
-				Content: "system_search_start",
-			}
-		}
-		return
-	case "command_stop", "command_next":
-		m.handleStopCommand(message)
+	if m.deleting[message.SenderID] {
 		return
 	}
+	if _, ok := m.Clients[message.SenderID]; ok {
+		m.lastActive[message.SenderID] = time.Now()
+	}
+	m.recordCommand(message, time.Now())
 
-	if err := m.Storage.SaveMessage(&message); err != nil {
-		log.Printf("ERROR: Failed to save message: %v", err)
+	if handler, ok := m.commands[message.Type]; ok {
+		handler(message)
 		return
 	}
+	m.messagePipeline()(message)
+}
 
-	if err := m.Storage.PublishMessage(message.RoomID, message); err != nil {
-		log.Printf("ERROR: Failed to publish message: %v", err)
+// commandHandlers returns the handlers of the message types that are commands or signals for
+// the hub rather than chat messages.
+func (m *ManagerService) commandHandlers() map[string]MessageHandler {
+	return map[string]MessageHandler{
+		"command_start":           m.handleStartCommand,
+		"command_stop":            m.handleStopCommand,
+		"command_next":            m.handleStopCommand,
+		"command_bot_blocked":     m.handleBotBlocked,
+		"command_user_banned":     m.handleUserBanned,
+		"command_block":           m.handleBlockCommand,
+		"command_status":          m.handleStatusCommand,
+		"command_keep_filters":    m.handleKeepFilters,
+		"command_delivery_failed": m.handleDeliveryFailed,
+		"command_report":          m.handleReportCommand,
+		"command_again":           m.handleAgainCommand,
+		"command_report_end":      m.handleReportEnd,
+		"command_report_continue": m.handleReportContinue,
+		"read":                    m.handleReadReceipt,
+		"command_read_receipts":   m.handleReadReceiptsSetting,
+		"typing":                  m.handleTyping,
+		"reaction":                m.handleReaction,
+		"command_hide_typing":     m.handleHideTypingSetting,
+		"command_hide_presence":   m.handleHidePresenceSetting,
+		"command_mute":            m.handleMuteCommand,
+		"command_unmute":          m.handleUnmuteCommand,
+		"command_link":            m.handleLinkCommand,
+		"command_delete_data":     m.handleDeleteDataCommand,
+		// Settings are shown by the transport; the hub only counts the command.
+		"command_settings": func(models.ChatMessage) {},
+	}
+}
+
+// handleStartCommand puts the sender into the search queue with the filters of the command,
+// unless they are banned or on a skip cooldown.
+func (m *ManagerService) handleStartCommand(message models.ChatMessage) {
+	if m.rejectBanned(message.SenderID) || m.rejectSkipCooldown(message.SenderID, time.Now()) {
+		return
+	}
+	params, err := startSearchParams(message)
+	if err != nil {
+		m.rejectSearchFilter(message.SenderID, err)
+		return
+	}
+	if !m.requestMatch(models.SearchRequest{UserID: message.SenderID, Params: params}) {
+		return
+	}
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:    "system_info",
+			Content: "system_search_start",
+		})
 	}
 }
 
 func (m *ManagerService) handleStopCommand(message models.ChatMessage) {
 	roomID := message.RoomID
 	if roomID == "" {
+		if message.Type == "command_stop" {
+			m.cancelSearch(message.SenderID)
+		}
 		return
 	}
 
@@ -184,41 +591,152 @@ func (m *ManagerService) handleStopCommand(message models.ChatMessage) {
 		partnerID = room.User1ID
 	}
 
+	// A /next over the rate limit ends the chat but does not start a new search.
+	requeueSender, skipPenalized := message.Type == "command_next" || message.Type == "command_report_end", false
+	if message.Type == "command_next" {
+		var limited bool
+		limited, skipPenalized = m.skipLimited(message.SenderID, time.Now())
+		requeueSender = !limited
+	}
+
+	m.Rooms.Transition(room, RoomEnding, message.SenderID, strings.TrimPrefix(message.Type, "command_"))
+
 	// Notify partner
+	requeuePartner := message.Type == "command_next" && m.shouldRequeuePartner(partnerID)
 	if partnerClient, ok := m.Clients[partnerID]; ok {
-		partnerClient.GetSendChannel() <- models.ChatMessage{
-			Type:    "system_info",
-			Content: "system_match_stop_partner",
+		content := "system_match_stop_partner"
+		if requeuePartner {
+			content = "system_match_stop_partner_requeued"
 		}
+		m.sendToClient(partnerClient, models.ChatMessage{
+			Type:    "system_info",
+			Content: content,
+		})
 		partnerClient.SetRoomID("")
 	}
 
 	// Notify sender
 	if senderClient, ok := m.Clients[message.SenderID]; ok {
-		senderClient.GetSendChannel() <- models.ChatMessage{
+		m.sendToClient(senderClient, models.ChatMessage{
 			Type:    "system_info",
 			Content: "system_match_stop_self",
-		}
+		})
 		senderClient.SetRoomID("")
 	}
+	if message.Type == "command_next" && !requeueSender {
+		content := "system_skip_cooldown"
+		if skipPenalized {
+			content = "system_skip_penalty"
+		}
+		m.sendSkipCooldown(message.SenderID, content, time.Now())
+	}
 
 	// Close room in storage
-	if err := m.Storage.CloseRoom(roomID); err != nil {
-		log.Printf("ERROR: Failed to close room %s: %v", roomID, err)
+	m.closeRoom(room, message.SenderID, strings.TrimPrefix(message.Type, "command_"))
+	if cooldown := m.rematchCooldown(); cooldown > 0 {
+		if err := m.Storage.AddRecentPartners(room.User1ID, room.User2ID, cooldown); err != nil {
+			log.Printf("ERROR: Failed to record recent partners of room %s: %v", roomID, err)
+		}
 	}
 
 	// If it was a /next command, re-queue the sender
-	if message.Type == "command_next" {
-		m.MatchRequestCh <- models.SearchRequest{UserID: message.SenderID}
+	if requeueSender {
+		m.requestMatch(models.SearchRequest{UserID: message.SenderID})
+	}
+	if requeuePartner {
+		m.requestMatch(models.SearchRequest{UserID: partnerID})
+	}
+}
+
+// shouldRequeuePartner reports whether the partner left by a /next is put back into the
+// search queue: they must be connected and want it, by their own preference or by
+// RequeueAbandonedPartner.
+func (m *ManagerService) shouldRequeuePartner(partnerID string) bool {
+	if _, ok := m.Clients[partnerID]; !ok {
+		return false
+	}
+	partner, err := m.Storage.GetUserByID(partnerID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s to re-queue them: %v", partnerID, err)
+		return false
+	}
+	return partner.WantsAutoRequeue(m.RequeueAbandonedPartner)
+}
+
+// rematchCooldown returns how long two users who chatted are kept from being matched again:
+// the longer of RematchCooldown and SamePairCooldown.
+func (m *ManagerService) rematchCooldown() time.Duration {
+	return max(m.RematchCooldown, m.SamePairCooldown)
+}
+
+// cancelSearch removes a user who is still waiting for a partner from the matchmaking queue
+// and confirms it to them. It does nothing if the user is not searching.
+func (m *ManagerService) cancelSearch(userID string) {
+	searching, err := m.Storage.IsUserSearching(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check search status of user %s: %v", userID, err)
+		return
+	}
+	if !searching {
+		return
+	}
+
+	m.dequeue(userID)
+	if client, ok := m.Clients[userID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_search_cancelled",
+			SenderID: "system",
+		})
+	}
+	log.Printf("Search cancelled by user %s", userID)
+}
+
+// handleBotBlocked deactivates a user whose client can no longer deliver messages because
+// the user blocked the bot: the user is marked inactive, removed from the search queue and
+// from their active room (notifying the partner), and their client is unregistered.
+func (m *ManagerService) handleBotBlocked(message models.ChatMessage) {
+	userID := message.SenderID
+	log.Printf("INFO: User %s blocked the bot, deactivating.", userID)
+
+	if err := m.Storage.SetUserBotBlocked(userID, true); err != nil {
+		log.Printf("ERROR: Failed to mark user %s as inactive: %v", userID, err)
+	}
+	m.dequeue(userID)
+
+	if message.RoomID != "" {
+		m.handleStopCommand(message)
+	}
+
+	if client, ok := m.Clients[userID]; ok {
+		m.handleUnregister(client)
 	}
 }
 
 func (m *ManagerService) handlePubSubMessage(message models.ChatMessage) {
+	if message.Type == instanceNotice {
+		m.handleInstanceNotice(message)
+		return
+	}
+	if m.routedElsewhere(message) {
+		return
+	}
 	room, err := m.Storage.GetRoomByID(message.RoomID)
 	if err != nil {
 		log.Printf("ERROR: Room not found for pub/sub message: %v", err)
 		return
 	}
+	m.rememberRoomMembers(room)
+
+	if message.Type == idleRoomNotice {
+		m.handleIdleRoomClosed(room, message)
+		return
+	}
+
+	if !room.IsActive && isConversationalMessage(message.Type) {
+		m.rejectClosedRoomMessage(message)
+		return
+	}
 
 	// Determine the recipient
 	var recipientID string
@@ -228,11 +746,61 @@ func (m *ManagerService) handlePubSubMessage(message models.ChatMessage) {
 		recipientID = room.User1ID
 	}
 
-	if client, ok := m.Clients[recipientID]; ok {
-		select {
-		case client.GetSendChannel() <- message:
-		default:
-			log.Printf("WARN: Client send channel full, message dropped for user %s", recipientID)
-		}
+	if isConversationalMessage(message.Type) {
+		m.trackRoomActivity(message.RoomID, message.SenderID, recipientID, time.Now())
+		m.Rooms.Transition(room, RoomActive, message.SenderID, "")
+	}
+
+	client, ok := m.Clients[recipientID]
+	if !ok {
+		m.queueOffline(recipientID, message)
+		return
+	}
+	if m.holdMuted(recipientID, message) {
+		return
+	}
+	// A typing indicator is stale by the time a retry could deliver it.
+	if message.Type == "typing" {
+		m.sendToClient(client, message)
+		return
+	}
+	if message.Type == presenceEvent {
+		m.sendToClient(client, partnerPresenceNotice(message.Content))
+		return
+	}
+	if message.Type == reconnectEvent {
+		m.sendToClient(client, partnerReconnectNotice(message.Content))
+		return
+	}
+	m.relay(client, message, time.Now())
+}
+
+// setClient registers the client of a user.
+func (m *ManagerService) setClient(userID string, client Client) {
+	m.clientsMu.Lock()
+	defer m.clientsMu.Unlock()
+	m.Clients[userID] = client
+}
+
+// withClient calls fn with the client of a user and reports whether the user has one. It is
+// how goroutines other than the hub's, like the matcher, reach clients: the client cannot be
+// unregistered, and its send channel closed, until fn returns.
+func (m *ManagerService) withClient(userID string, fn func(Client)) bool {
+	m.clientsMu.RLock()
+	defer m.clientsMu.RUnlock()
+	client, ok := m.Clients[userID]
+	if ok {
+		fn(client)
+	}
+	return ok
+}
+
+// sendToClient delivers a message to a client without blocking the hub.
+// If the client's send channel is full, the message is dropped and logged. Messages relayed
+// between users go through relay instead, which retries them.
+func (m *ManagerService) sendToClient(client Client, message models.ChatMessage) {
+	if !m.offer(client, message, time.Now()) {
+		channelOverflows.Inc(overflowClientSend)
+		log.Printf("WARN: Client send channel full, message dropped for user %s", client.GetUserID())
 	}
 }
@@ -3,64 +3,60 @@ package chathub_test
 import (
 	"chatgogo/backend/internal/chathub"
 	"chatgogo/backend/internal/models"
+	"context"
 	"testing"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestManager_Run(t *testing.T) {
 	storageMock := new(MockStorage)
-	hub := chathub.NewManagerService(storageMock)
-	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
-	storageMock.On("SubscribeToAllRooms").Return(&redis.PubSub{})
+	hub := newTestHub(storageMock)
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil)
 
 	clientA := newMockClient("user_A")
 
-	go hub.Run()
+	go hub.Run(context.Background())
 
 	hub.RegisterCh <- clientA
 	time.Sleep(100 * time.Millisecond)
-	assert.Contains(t, hub.Clients, "user_A")
+	assert.True(t, connected(t, hub, "user_A"))
 
 	hub.UnregisterCh <- clientA
 	time.Sleep(100 * time.Millisecond)
-	assert.NotContains(t, hub.Clients, "user_A")
+	assert.False(t, connected(t, hub, "user_A"))
 }
 
 func TestManager_handleIncomingMessage(t *testing.T) {
 	storageMock := new(MockStorage)
-	hub := chathub.NewManagerService(storageMock)
-	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
-	storageMock.On("SubscribeToAllRooms").Return(&redis.PubSub{})
+	hub := newTestHub(storageMock)
 
 	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
-	storageMock.On("PublishMessage", mock.AnythingOfType("string"), mock.AnythingOfType("models.ChatMessage")).Return(nil)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil)
 
-	go hub.Run()
+	go hub.Run(context.Background())
 
 	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "hello"}
 	time.Sleep(100 * time.Millisecond)
 
 	storageMock.AssertCalled(t, "SaveMessage", mock.AnythingOfType("*models.ChatMessage"))
-	storageMock.AssertCalled(t, "PublishMessage", "room1", mock.AnythingOfType("models.ChatMessage"))
+	storageMock.AssertCalled(t, "PublishSavedMessage", mock.AnythingOfType("models.ChatMessage"))
 }
 
 func TestManager_handlePubSubMessage(t *testing.T) {
 	storageMock := new(MockStorage)
-	hub := chathub.NewManagerService(storageMock)
-	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
-	storageMock.On("SubscribeToAllRooms").Return(&redis.PubSub{})
+	hub := newTestHub(storageMock)
 
 	clientB := newMockClient("user_B")
 	hub.Clients["user_B"] = clientB
 
-	room := &models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"}
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
 	storageMock.On("GetRoomByID", "room1").Return(room, nil)
 
-	go hub.Run()
+	go hub.Run(context.Background())
 
 	hub.PubSubCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "hello"}
 	time.Sleep(100 * time.Millisecond)
@@ -81,3 +77,230 @@ func TestManager_SetClientRestorer(t *testing.T) {
 	hub.SetClientRestorer(restorer)
 	assert.NotNil(t, hub.ClientRestorer)
 }
+
+func TestManager_GhostingNudgeAndSkipOffer(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	hub.GhostNudgeAfter = 0
+	hub.GhostSkipOfferAfter = 0
+	hub.ActivityCheckInterval = 10 * time.Millisecond
+	hub.PresenceTTL = 0
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	clientB := newMockClient("user_B")
+	clientB.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	go hub.Run(context.Background())
+
+	hub.PubSubCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "hello", Type: "text"}
+	time.Sleep(100 * time.Millisecond)
+
+	// The silent partner receives the relayed message followed by a single nudge.
+	assert.Equal(t, "hello", (<-clientB.RecvChannel).Content)
+	select {
+	case msg := <-clientB.RecvChannel:
+		assert.Equal(t, "system_ghost_nudge", msg.Content)
+	default:
+		t.Error("clientB did not receive a nudge")
+	}
+	assert.Len(t, clientB.RecvChannel, 0, "nudge must be sent only once")
+
+	// The waiting user is offered to skip to the next partner.
+	select {
+	case msg := <-clientA.RecvChannel:
+		assert.Equal(t, "system_ghost_skip_offer", msg.Type)
+	default:
+		t.Error("clientA did not receive a skip offer")
+	}
+}
+
+// TestManager_BotBlockedDeactivatesUser verifies that a user who blocked the bot is marked
+// inactive, dequeued, removed from their room and unregistered, and that the partner is told.
+func TestManager_BotBlockedDeactivatesUser(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("SetUserBotBlocked", "user_A", true).Return(nil).Once()
+	storageMock.On("CloseRoom", "room1", "user_A", "bot_blocked").Return(nil).Once()
+	storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_bot_blocked", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "user_A", <-hub.CancelSearchCh)
+	assert.Equal(t, "system_match_stop_partner", (<-clientB.RecvChannel).Content)
+	assert.False(t, connected(t, hub, "user_A"))
+	assert.True(t, connected(t, hub, "user_B"))
+}
+
+// TestManager_BannedUserLeavesRoom verifies that a user banned mid-chat is removed from the
+// room, that the partner is offered a new search, and that the banned user cannot search again.
+func TestManager_BannedUserLeavesRoom(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetActiveRoomIDForUser", "user_A").Return("room1", nil)
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "ban").Return(nil).Once()
+	storageMock.On("IsUserBanned", "user_A").Return(true, nil)
+	ban := models.NewBan("user_A", time.Now().Add(-time.Minute), 7*24*time.Hour, nil)
+	storageMock.On("GetBansForUser", "user_A").Return([]models.Ban{*ban}, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	clientA.SetRoomID("room1")
+	clientB.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_user_banned", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "user_A", <-hub.CancelSearchCh)
+	assert.Equal(t, "system_partner_banned", (<-clientB.RecvChannel).Type)
+	assert.Empty(t, clientB.GetRoomID())
+	for i := 0; i < 2; i++ {
+		notice := <-clientA.RecvChannel
+		assert.Equal(t, "system_banned", notice.Type)
+		assert.Equal(t, "system_banned_until", notice.Content)
+		assert.Equal(t, ban.EndsAt.Format(time.RFC3339), notice.Metadata)
+	}
+	assert.Empty(t, hub.MatchRequestCh, "A banned user must not be queued")
+}
+
+// TestManager_StopCancelsSearch verifies that /stop outside of a room removes a searching
+// user from the matchmaking queue and confirms it.
+func TestManager_StopCancelsSearch(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("IsUserSearching", "user_A").Return(true, nil)
+	storageMock.On("IsUserSearching", "user_B").Return(false, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_stop", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_stop", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "user_A", <-hub.CancelSearchCh)
+	assert.Equal(t, "system_search_cancelled", (<-clientA.RecvChannel).Content)
+	assert.Empty(t, hub.CancelSearchCh, "Users who are not searching must not be dequeued")
+	assert.Empty(t, clientB.RecvChannel)
+}
+
+// TestManager_NextRequeuesAbandonedPartner verifies that /next puts the partner back into the
+// search queue when the server default or their own preference asks for it.
+func TestManager_NextRequeuesAbandonedPartner(t *testing.T) {
+	off := false
+	tests := []struct {
+		name          string
+		serverDefault bool
+		partner       *models.User
+		requeued      bool
+	}{
+		{"server default on", true, &models.User{ID: "user_B"}, true},
+		{"server default off", false, &models.User{ID: "user_B"}, false},
+		{"partner opted out", true, &models.User{ID: "user_B", AutoRequeue: &off}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := new(MockStorage)
+			hub := newTestHub(storageMock)
+			hub.RequeueAbandonedPartner = tt.serverDefault
+			storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}, nil)
+			storageMock.On("GetUserByID", "user_B").Return(tt.partner, nil)
+			storageMock.On("CloseRoom", "room1", "user_A", "next").Return(nil).Once()
+			storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil).Once()
+
+			clientA := newMockClient("user_A")
+			clientB := newMockClient("user_B")
+			hub.Clients["user_A"] = clientA
+			hub.Clients["user_B"] = clientB
+
+			go hub.Run(context.Background())
+			hub.IncomingCh <- models.ChatMessage{Type: "command_next", SenderID: "user_A", RoomID: "room1"}
+
+			assert.Equal(t, "user_A", (<-hub.MatchRequestCh).UserID)
+			expected := "system_match_stop_partner"
+			if tt.requeued {
+				expected = "system_match_stop_partner_requeued"
+				assert.Equal(t, "user_B", (<-hub.MatchRequestCh).UserID)
+			}
+			assert.Equal(t, expected, (<-clientB.RecvChannel).Content)
+			assert.Empty(t, hub.MatchRequestCh)
+		})
+	}
+}
+
+// TestManager_RegisterKeepsAllSessions verifies that a user connected twice receives messages
+// in both sessions, which share the room, and that the user stays registered until the last
+// session is gone.
+func TestManager_RegisterKeepsAllSessions(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil)
+	storageMock.On("GetSearchQueueStatus", "user_A").Return(0, 0, nil)
+
+	first := newMockClient("user_A")
+	first.SetRoomID("room1")
+	second := newMockClient("user_A")
+
+	go hub.Run(context.Background())
+
+	hub.RegisterCh <- first
+	time.Sleep(20 * time.Millisecond)
+	hub.RegisterCh <- second
+	time.Sleep(20 * time.Millisecond)
+	hub.IncomingCh <- models.ChatMessage{Type: "command_status", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, "room1", second.GetRoomID())
+	assert.Equal(t, "system_reconnect", (<-second.RecvChannel).Content)
+	assert.Equal(t, "system_status_not_searching", (<-first.RecvChannel).Content)
+	assert.Equal(t, "system_status_not_searching", (<-second.RecvChannel).Content)
+
+	hub.UnregisterCh <- first
+	time.Sleep(20 * time.Millisecond)
+	hub.IncomingCh <- models.ChatMessage{Type: "command_status", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	_, open := <-first.RecvChannel
+	assert.False(t, open, "the closed session's channel is closed")
+	assert.Equal(t, "system_status_not_searching", (<-second.RecvChannel).Content)
+	assert.True(t, connected(t, hub, "user_A"))
+
+	hub.UnregisterCh <- second
+	time.Sleep(50 * time.Millisecond)
+
+	_, open = <-second.RecvChannel
+	assert.False(t, open, "the last session's channel is closed")
+	assert.False(t, connected(t, hub, "user_A"))
+}
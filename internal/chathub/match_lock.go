@@ -0,0 +1,66 @@
+package chathub
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// matchLockTTL is how long the match locks of two users last if the matcher holding them dies
+// before it releases them.
+const matchLockTTL = 10 * time.Second
+
+// roomConflictError means a room was not opened because some of its users are in an active
+// room already, or because a room is being opened for them concurrently.
+type roomConflictError struct {
+	// inRoom are the users who are in an active room already.
+	inRoom []string
+}
+
+func (e *roomConflictError) Error() string {
+	if len(e.inRoom) > 0 {
+		return fmt.Sprintf("users %s are in a room already", strings.Join(e.inRoom, ", "))
+	}
+	return "a room is being opened for the users already"
+}
+
+// lockNewRoom makes sure that two users may get a new room. It takes their match locks, which
+// keep concurrent matches, e.g. on another instance or by /again, from opening a room for
+// them meanwhile, and checks that neither of them is in an active room already, which would
+// leave them in two. The returned unlock releases the locks; call it once the room is saved.
+func (m *MatcherService) lockNewRoom(user1ID, user2ID string) (unlock func(), err error) {
+	userIDs := []string{user1ID, user2ID}
+	token := uuid.New().String()
+	locked, err := m.Storage.LockMatch(token, userIDs, matchLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, &roomConflictError{}
+	}
+	unlock = func() {
+		if err := m.Storage.UnlockMatch(token, userIDs); err != nil {
+			log.Printf("ERROR: Failed to release match locks of %s and %s: %v", user1ID, user2ID, err)
+		}
+	}
+
+	conflict := &roomConflictError{}
+	for _, userID := range userIDs {
+		roomID, err := m.Storage.GetActiveRoomIDForUser(userID)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		if roomID != "" {
+			conflict.inRoom = append(conflict.inRoom, userID)
+		}
+	}
+	if len(conflict.inRoom) > 0 {
+		unlock()
+		return nil, conflict
+	}
+	return unlock, nil
+}
@@ -0,0 +1,100 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"time"
+)
+
+// MatchMetrics receives the measurements of a MatcherService, so operators can tune
+// matchmaking with real data.
+type MatchMetrics interface {
+	// MatchCreated records a new room and how long each of the two users waited for it.
+	MatchCreated(wait1, wait2 time.Duration)
+	// SearchTimedOut records a search removed after SearchTimeout without a match.
+	SearchTimedOut()
+	// QueueLength records the current number of queued users.
+	QueueLength(n int)
+	// SegmentLiquidity records the supply and demand of a queue segment (see
+	// MatcherService.BalanceLiquidity).
+	SegmentLiquidity(segment string, demand, supply int, flooded bool)
+}
+
+// waitBuckets are the upper bounds, in seconds, of the time-to-match histogram.
+var waitBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+// registryMatchMetrics exports MatchMetrics through a metrics.Registry.
+type registryMatchMetrics struct {
+	matches     *metrics.CounterVec
+	timeouts    *metrics.CounterVec
+	waitSeconds *metrics.Histogram
+	queueLength *metrics.Gauge
+	demand      *metrics.GaugeVec
+	supply      *metrics.GaugeVec
+	flooded     *metrics.GaugeVec
+}
+
+// NewMatchMetrics creates MatchMetrics exported through the given registry:
+// chatgogo_matcher_matches_total, chatgogo_matcher_search_timeouts_total,
+// chatgogo_matcher_wait_seconds, chatgogo_matcher_queue_length and the per-segment
+// chatgogo_matcher_segment_demand, chatgogo_matcher_segment_supply and
+// chatgogo_matcher_segment_flooded.
+func NewMatchMetrics(r *metrics.Registry) MatchMetrics {
+	return &registryMatchMetrics{
+		matches: r.NewCounterVec("chatgogo_matcher_matches_total",
+			"Rooms created by the matcher."),
+		timeouts: r.NewCounterVec("chatgogo_matcher_search_timeouts_total",
+			"Searches removed from the queue without a match after the search timeout."),
+		waitSeconds: r.NewHistogram("chatgogo_matcher_wait_seconds",
+			"Time from joining the queue to being matched, per matched user.", waitBuckets...),
+		queueLength: r.NewGauge("chatgogo_matcher_queue_length",
+			"Users waiting in the matchmaking queue of the matcher leader."),
+		demand: r.NewGaugeVec("chatgogo_matcher_segment_demand",
+			"Users searching in a queue segment (own gender>partner gender).", "segment"),
+		supply: r.NewGaugeVec("chatgogo_matcher_segment_supply",
+			"Queued users whose gender and filters fit a queue segment.", "segment"),
+		flooded: r.NewGaugeVec("chatgogo_matcher_segment_flooded",
+			"1 if a queue segment is flooded, i.e. has too few possible partners for its demand.", "segment"),
+	}
+}
+
+// DefaultMatchMetrics are the matchmaking metrics served on the /metrics endpoint.
+var DefaultMatchMetrics = NewMatchMetrics(metrics.Default)
+
+func (r *registryMatchMetrics) MatchCreated(wait1, wait2 time.Duration) {
+	r.matches.Inc()
+	r.waitSeconds.Observe(wait1.Seconds())
+	r.waitSeconds.Observe(wait2.Seconds())
+}
+
+func (r *registryMatchMetrics) SearchTimedOut() {
+	r.timeouts.Inc()
+}
+
+func (r *registryMatchMetrics) QueueLength(n int) {
+	r.queueLength.Set(float64(n))
+}
+
+func (r *registryMatchMetrics) SegmentLiquidity(segment string, demand, supply int, flooded bool) {
+	r.demand.Set(float64(demand), segment)
+	r.supply.Set(float64(supply), segment)
+	value := 0.0
+	if flooded {
+		value = 1
+	}
+	r.flooded.Set(value, segment)
+}
+
+// recordQueueLength reports the queue length to Metrics.
+func (m *MatcherService) recordQueueLength() {
+	if m.Metrics != nil {
+		m.Metrics.QueueLength(m.Queue.Len())
+	}
+}
+
+// waitedFor returns how long a queued user has been waiting, or zero if they are not queued.
+func (m *MatcherService) waitedFor(userID string, now time.Time) time.Duration {
+	if req, ok := m.Queue.Get(userID); ok {
+		return now.Sub(req.EnqueuedAt)
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package chathub_test
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMatchMetrics records the measurements reported by the matcher.
+type fakeMatchMetrics struct {
+	waits    []time.Duration
+	timeouts int
+}
+
+func (f *fakeMatchMetrics) MatchCreated(wait1, wait2 time.Duration) {
+	f.waits = append(f.waits, wait1, wait2)
+}
+
+func (f *fakeMatchMetrics) SearchTimedOut() { f.timeouts++ }
+
+func (f *fakeMatchMetrics) QueueLength(int) {}
+
+func (f *fakeMatchMetrics) SegmentLiquidity(string, int, int, bool) {}
+
+func TestMatcherReportsTimeToMatch(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	recorded := &fakeMatchMetrics{}
+	matcher.Metrics = recorded
+	hub.Clients["user_A"] = newMockClient("user_A")
+	hub.Clients["user_B"] = newMockClient("user_B")
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", "user_A", "user_B").Return(true, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil)
+	expectRoomGuard(storageMock)
+
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: time.Now().Add(-time.Minute)})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B", EnqueuedAt: time.Now().Add(-10 * time.Second)})
+	matcher.MatchQueue()
+
+	require.Len(t, recorded.waits, 2)
+	assert.InDelta(t, time.Minute.Seconds(), recorded.waits[0].Seconds(), 1)
+	assert.InDelta(t, (10 * time.Second).Seconds(), recorded.waits[1].Seconds(), 1)
+}
+
+func TestMatcherReportsSearchTimeouts(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	recorded := &fakeMatchMetrics{}
+	matcher.Metrics = recorded
+	storageMock.On("RemoveUserFromSearchQueue", "user_A").Return(nil)
+
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: time.Now().Add(-time.Hour)})
+	matcher.ExpireStaleSearches(time.Now())
+
+	assert.Equal(t, 1, recorded.timeouts)
+}
+
+func TestMatchMetricsExposition(t *testing.T) {
+	r := metrics.NewRegistry()
+	m := chathub.NewMatchMetrics(r)
+
+	m.MatchCreated(3*time.Second, 90*time.Second)
+	m.SearchTimedOut()
+	m.QueueLength(4)
+	m.SegmentLiquidity("male>female", 12, 2, true)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "chatgogo_matcher_matches_total 1\n")
+	assert.Contains(t, out, "chatgogo_matcher_search_timeouts_total 1\n")
+	assert.Contains(t, out, `chatgogo_matcher_wait_seconds_bucket{le="5"} 1`+"\n")
+	assert.Contains(t, out, `chatgogo_matcher_wait_seconds_bucket{le="120"} 2`+"\n")
+	assert.Contains(t, out, "chatgogo_matcher_wait_seconds_sum 93\n")
+	assert.Contains(t, out, "chatgogo_matcher_wait_seconds_count 2\n")
+	assert.Contains(t, out, "chatgogo_matcher_queue_length 4\n")
+	assert.Contains(t, out, `chatgogo_matcher_segment_demand{segment="male>female"} 12`+"\n")
+	assert.Contains(t, out, `chatgogo_matcher_segment_supply{segment="male>female"} 2`+"\n")
+	assert.Contains(t, out, `chatgogo_matcher_segment_flooded{segment="male>female"} 1`+"\n")
+}
@@ -1,59 +1,283 @@
 package chathub
 
 import (
+	"chatgogo/backend/internal/config"
+	"chatgogo/backend/internal/events"
 	"chatgogo/backend/internal/models"
-	"chatgogo/backend/internal/storage"
+	"context"
+	"errors"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// DefaultSearchTimeout is how long a user may wait in the matchmaking queue before the
+// search is cancelled.
+const DefaultSearchTimeout = 10 * time.Minute
+
+// DefaultMatchScanInterval is how often the whole queue is rescanned for matches that became
+// possible without a new request (e.g., after a rematch cooldown ran out), and stale
+// searches are expired.
+const DefaultMatchScanInterval = 5 * time.Second
+
+// DefaultRematchCooldown is how long two users who chatted are kept from being matched again.
+const DefaultRematchCooldown = 6 * time.Hour
+
+// DefaultSamePairCooldown is the minimum time before two users who just chatted can be
+// matched again, even when the rematch cooldown is disabled. It keeps tiny queues from
+// instantly re-pairing the same people after /next.
+const DefaultSamePairCooldown = 2 * time.Minute
+
+// MatcherStorage is the part of storage.Storage the matcher uses.
+type MatcherStorage interface {
+	// User operations
+	GetUserByID(userID string) (*models.User, error)
+	GetUsersByIDs(userIDs []string) ([]models.User, error)
+
+	// Room operations
+	SaveRoom(room *models.ChatRoom) error
+	GetActiveRoomIDForUser(userID string) (string, error)
+
+	// Partners (Redis)
+	GetRecentPartners(userID string, since time.Time) (map[string]time.Time, error)
+
+	// Search Queue operations
+	AddUserToSearchQueue(userID string) error
+	SaveSearchRequest(req models.SearchRequest) error
+	GetSearchRequest(userID string) (*models.SearchRequest, error)
+	RemoveUserFromSearchQueue(userID string) error
+	GetSearchingUsers() ([]string, error)
+	IsUserSearching(userID string) (bool, error)
+	ClaimMatch(user1ID, user2ID string) (bool, error)
+	LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error)
+	UnlockMatch(token string, userIDs []string) error
+
+	// Leadership and claims (Redis)
+	AcquireMatcherLeadership(instanceID string, ttl time.Duration) (bool, error)
+}
+
 // MatcherService is responsible for the matchmaking algorithm.
 // It pairs users who are looking for a chat partner.
 type MatcherService struct {
 	// Hub is a reference to the central ManagerService.
 	Hub *ManagerService
 	// Storage provides access to the data persistence layer.
-	Storage storage.Storage
-	// Queue holds the users currently waiting to be matched.
-	// A map is used for efficient lookups and deletions, with the user's ID as the key.
-	Queue map[string]models.SearchRequest
+	Storage MatcherStorage
+	// Queue holds the users currently waiting to be matched, in first-come-first-served order.
+	Queue *SearchQueue
+	// MinInterestOverlap is the minimum number of shared interests required to pair two users.
+	// Zero disables the requirement; the best-overlapping candidate is still preferred.
+	MinInterestOverlap int
+	// SearchTimeout is how long a user may wait for a partner before being removed from the
+	// queue and notified. Zero disables the timeout.
+	SearchTimeout time.Duration
+	// ReputationTiers groups users by rating score. Low-tier users are preferentially matched
+	// with each other and never with high-tier users.
+	ReputationTiers config.ReputationTiers
+	// Events boosts candidates who share the theme interests of running events. It may be nil.
+	Events *events.Schedule
+	// MatchScanInterval is how often the whole queue is rescanned. New requests are matched
+	// immediately and do not wait for the next scan.
+	MatchScanInterval time.Duration
+	// RelaxAfter is how long a user with search filters waits before each step of filter
+	// relaxation. Zero disables relaxation.
+	RelaxAfter time.Duration
+	// QueueStatusInterval is how often waiting users are told their place in the queue when
+	// it changed. Zero disables the updates; users can still ask with /status.
+	QueueStatusInterval time.Duration
+	// InstanceID identifies this instance in the matcher leader election. If empty, leader
+	// election is disabled and this instance always runs matchmaking.
+	InstanceID string
+	// LeaderLeaseTTL is how long the leader lease lasts without renewal, and thus how quickly a
+	// standby instance takes over when the leader dies.
+	LeaderLeaseTTL time.Duration
+	// Metrics receives matchmaking measurements (matches, time-to-match, queue length). Nil
+	// disables them.
+	Metrics MatchMetrics
+	// FloodMinDemand is the minimum number of users searching in a segment (e.g., men looking
+	// for women) before it can be flooded. Zero disables the liquidity balancer.
+	FloodMinDemand int
+	// FloodRatio is the number of possible partners per searching user below which a segment
+	// with at least FloodMinDemand users is flooded.
+	FloodRatio float64
+	// FloodedSearchTimeout replaces a longer SearchTimeout for users of flooded segments, so
+	// that unmatchable searches do not pile up in the queue. Zero disables it.
+	FloodedSearchTimeout time.Duration
+
+	// profiles caches the profiles of queued users, keyed by user ID.
+	profiles map[string]*models.User
+	// recentPartners caches the recent chat partners of queued users, keyed by user ID.
+	recentPartners map[string]map[string]time.Time
+	// toldAlone holds queued users who were told that no one else is online.
+	toldAlone map[string]bool
+	// lastStatus holds the queue status last pushed to each queued user.
+	lastStatus map[string]string
+	// toldLongWait holds queued users who were told that their segment is flooded.
+	toldLongWait map[string]bool
+	// liquidity is the liquidity of every queue segment at the last BalanceLiquidity.
+	liquidity map[string]SegmentLiquidity
+	// segmentMatches holds the times users of each segment were matched within LiquidityWindow.
+	segmentMatches map[string][]time.Time
+	// leading is set while this instance runs matchmaking.
+	leading bool
 }
 
 // NewMatcherService creates and returns a new MatcherService instance.
-func NewMatcherService(hub *ManagerService, s storage.Storage) *MatcherService {
+func NewMatcherService(hub *ManagerService, s MatcherStorage) *MatcherService {
 	return &MatcherService{
-		Hub:     hub,
-		Storage: s,
-		Queue:   make(map[string]models.SearchRequest),
+		Hub:                  hub,
+		Storage:              s,
+		Queue:                NewSearchQueue(),
+		SearchTimeout:        DefaultSearchTimeout,
+		ReputationTiers:      config.DefaultReputationTiers(),
+		MatchScanInterval:    DefaultMatchScanInterval,
+		LeaderLeaseTTL:       DefaultLeaderLeaseTTL,
+		QueueStatusInterval:  DefaultQueueStatusInterval,
+		RelaxAfter:           DefaultRelaxAfter,
+		Metrics:              DefaultMatchMetrics,
+		FloodMinDemand:       DefaultFloodMinDemand,
+		FloodRatio:           DefaultFloodRatio,
+		FloodedSearchTimeout: DefaultFloodedSearchTimeout,
+		profiles:             make(map[string]*models.User),
+		recentPartners:       make(map[string]map[string]time.Time),
+		toldAlone:            make(map[string]bool),
+		lastStatus:           make(map[string]string),
+		toldLongWait:         make(map[string]bool),
+		segmentMatches:       make(map[string][]time.Time),
 	}
 }
 
 // Run starts the main goroutine for the MatcherService.
-// It listens for new match requests and periodically attempts to find pairs.
-func (m *MatcherService) Run() {
+// It is event-driven: a new request is matched as soon as it arrives, cancellations update
+// the queue, and every MatchScanInterval stale searches are expired and the whole queue is
+// rescanned. The matcher sleeps while nothing happens.
+// With leader election enabled, only the leader matches; standby instances hand their
+// requests to the leader through the shared queue in storage.
+// The matcher returns when ctx is cancelled. Its queue needs no saving, as every queued user
+// is kept in the shared queue in storage too.
+func (m *MatcherService) Run(ctx context.Context) {
 	log.Println("Matcher Service started.")
-	m.restoreSearchQueue()
+	var leaseC <-chan time.Time
+	if m.InstanceID == "" {
+		m.leading = true
+		m.restoreSearchQueue()
+	} else {
+		m.updateLeadership()
+		leaseTicker := time.NewTicker(m.LeaderLeaseTTL / 3)
+		defer leaseTicker.Stop()
+		leaseC = leaseTicker.C
+	}
+
+	scanTicker := time.NewTicker(m.MatchScanInterval)
+	defer scanTicker.Stop()
+	var statusC <-chan time.Time
+	if m.QueueStatusInterval > 0 {
+		statusTicker := time.NewTicker(m.QueueStatusInterval)
+		defer statusTicker.Stop()
+		statusC = statusTicker.C
+	}
 
-	// Main matcher loop: listens for requests and tries to find matches.
 	for {
 		select {
 		case req := <-m.Hub.MatchRequestCh:
+			m.Hub.recordMatchBacklog()
+			if !m.leading {
+				m.queueForLeader(req)
+				continue
+			}
 			m.AddUserToQueue(req)
+			if queued, ok := m.Queue.Get(req.UserID); ok {
+				m.FindMatch(queued)
+			}
+		case userID := <-m.Hub.CancelSearchCh:
+			m.RemoveUserFromQueue(userID)
+		case rematch := <-m.Hub.RematchCh:
+			m.Rematch(rematch)
+		case <-leaseC:
+			m.updateLeadership()
+		case <-statusC:
+			if m.leading {
+				m.pushQueueStatus()
+			}
+		case now := <-scanTicker.C:
+			if !m.leading {
+				continue
+			}
+			if m.InstanceID != "" {
+				m.syncSearchQueue()
+			}
+			m.BalanceLiquidity(now)
+			m.ExpireStaleSearches(now)
+			m.RelaxFilters(now)
+			m.MatchQueue()
+		case <-ctx.Done():
+			log.Println("Matcher Service stopped.")
+			return
+		}
+		m.recordQueueLength()
+	}
+}
+
+// MatchQueue tries to find a partner for every queued user, in queue order.
+func (m *MatcherService) MatchQueue() {
+	if m.Queue.Len() < 2 {
+		return
+	}
+	for _, req := range m.Queue.Ordered() {
+		if m.Queue.Contains(req.UserID) { // Skip users matched earlier in this pass.
 			m.FindMatch(req)
-		default:
-			// If there are no new requests but the queue is not empty,
-			// iterate over the queue to find matches.
-			if len(m.Queue) > 1 {
-				for _, req := range m.Queue {
-					m.FindMatch(req)
-				}
+		}
+	}
+}
+
+// ExpireStaleSearches removes users who have waited longer than SearchTimeout, or
+// FloodedSearchTimeout in a flooded segment, from the queue and tells them that no partner
+// was found. It returns the number of expired searches.
+func (m *MatcherService) ExpireStaleSearches(now time.Time) int {
+	if m.SearchTimeout <= 0 {
+		return 0
+	}
+
+	expired := 0
+	cutoff := now.Add(-m.SearchTimeout)
+	floodedCutoff := cutoff
+	if m.FloodedSearchTimeout > 0 && m.FloodedSearchTimeout < m.SearchTimeout {
+		floodedCutoff = now.Add(-m.FloodedSearchTimeout)
+	}
+	for _, req := range m.Queue.Ordered() {
+		if req.EnqueuedAt.After(floodedCutoff) {
+			break // The queue is ordered by enqueue time, so all remaining requests are newer.
+		}
+		timeout := m.SearchTimeout
+		if req.EnqueuedAt.After(cutoff) {
+			if !m.isFlooded(req) {
+				continue
 			}
-			// Pause to prevent high CPU usage when the queue is empty or has one user.
-			time.Sleep(100 * time.Millisecond)
+			timeout = m.FloodedSearchTimeout
+		}
+
+		m.Queue.Remove(req.UserID)
+		m.forget(req.UserID)
+		if err := m.Storage.RemoveUserFromSearchQueue(req.UserID); err != nil {
+			log.Printf("ERROR: Failed to remove user %s from search queue in storage: %v", req.UserID, err)
+		}
+		m.Hub.withClient(req.UserID, func(client Client) {
+			m.Hub.sendToClient(client, models.ChatMessage{
+				Type:     "system_info",
+				Content:  "system_search_timeout",
+				SenderID: "system",
+			})
+		})
+		log.Printf("Search of user %s timed out after %v.", req.UserID, timeout)
+		if m.Metrics != nil {
+			m.Metrics.SearchTimedOut()
 		}
+		expired++
 	}
+	return expired
 }
 
 // restoreSearchQueue loads the list of searching users from storage on startup
@@ -66,44 +290,361 @@ func (m *MatcherService) restoreSearchQueue() {
 	}
 
 	for _, userID := range users {
-		if err := m.Hub.RestoreClientSession(userID); err != nil {
-			log.Printf("Failed to restore session for %s: %v", userID, err)
-			m.Storage.RemoveUserFromSearchQueue(userID)
-			continue
-		}
-		m.Queue[userID] = models.SearchRequest{UserID: userID}
+		m.enqueueRestored(userID)
+	}
+	log.Printf("Restored %d users to search queue.", m.Queue.Len())
+}
+
+// enqueueRestored adds a user found in the shared queue in storage to the local queue,
+// restoring their client session so they can be notified of a match. The search request
+// saved for the user, if any, is resumed; otherwise, or if it has no criteria, the user's
+// persisted search preferences apply.
+func (m *MatcherService) enqueueRestored(userID string) {
+	if err := m.Hub.RestoreClientSession(userID); err != nil {
+		log.Printf("Failed to restore session for %s: %v", userID, err)
+		m.Storage.RemoveUserFromSearchQueue(userID)
+		return
+	}
+	req := models.SearchRequest{UserID: userID}
+	if saved, err := m.Storage.GetSearchRequest(userID); err != nil {
+		log.Printf("ERROR: Failed to load the search request of user %s: %v", userID, err)
+	} else if saved != nil {
+		req = *saved
+	}
+	profile := m.profile(userID)
+	if req.Params.IsEmpty() {
+		req.Params = searchParamsOf(profile)
 	}
-	log.Printf("Restored %d users to search queue.", len(m.Queue))
+	req.Boosted = isPremium(profile, time.Now())
+	m.Queue.Push(req)
 }
 
-// AddUserToQueue adds a new user to the matchmaking queue.
+// AddUserToQueue adds a new user to the matchmaking queue. Premium users are boosted.
+// A request without search criteria uses the user's persisted search preferences, except
+// that a strict request for a queued user keeps the criteria they are searching with.
 func (m *MatcherService) AddUserToQueue(req models.SearchRequest) {
-	m.Queue[req.UserID] = req
+	m.forget(req.UserID) // Reload the profile in case it changed since the last search.
+	profile := m.profile(req.UserID)
+	if req.Params.IsEmpty() {
+		if queued, ok := m.Queue.Get(req.UserID); ok && req.Strict {
+			req.Params = queued.Params
+		} else {
+			req.Params = searchParamsOf(profile)
+		}
+	}
+	req.Boosted = isPremium(profile, time.Now())
+	m.Queue.Push(req)
 	if err := m.Storage.AddUserToSearchQueue(req.UserID); err != nil {
 		log.Printf("Error adding user to search queue in storage: %v", err)
 	}
 	log.Printf("New match request added to queue: %s", req.UserID)
 }
 
+// RemoveUserFromQueue removes a user from the matchmaking queue and its persistent copy in storage.
+func (m *MatcherService) RemoveUserFromQueue(userID string) {
+	m.Queue.Remove(userID)
+	m.forget(userID)
+	if err := m.Storage.RemoveUserFromSearchQueue(userID); err != nil {
+		log.Printf("ERROR: Failed to remove user %s from search queue in storage: %v", userID, err)
+	}
+}
+
+// QueuePosition returns the 1-based position of a user in the matchmaking queue,
+// or 0 if the user is not searching.
+func (m *MatcherService) QueuePosition(userID string) int {
+	return m.Queue.Position(userID)
+}
+
 // FindMatch attempts to find a chat partner for the given search request.
+// Users are only paired when both sides' search criteria are mutually satisfied.
+// Users who chatted within the hub's RematchCooldown are not paired again, and high-reputation
+// users are never paired with low-reputation ones.
+// Candidates in the requester's reputation tier are preferred; among them, the one sharing
+// the most interests wins, with shared theme interests of running events counting twice.
+// Among equally suitable candidates, boosted (premium) users come first, then the
+// longest-waiting one.
+// If no one but recent partners is searching, the requester is told once that no one else
+// is online; they stay queued and are matched as soon as someone new joins.
 func (m *MatcherService) FindMatch(req models.SearchRequest) {
-	// Iterate through the queue to find a potential match.
-	for targetID := range m.Queue {
+	m.loadProfiles()
+	requester := m.profile(req.UserID)
+	requesterTier := m.ReputationTiers.TierOf(ratingOf(requester))
+	now := time.Now()
+	var recent map[string]time.Time // Loaded on the first compatible candidate.
+
+	bestID := ""
+	bestScore := -1
+	bestSameTier := false
+	skippedRecent := 0
+	// Iterate through the queue in matching order; on equal score the earlier user wins.
+	for _, target := range m.Queue.Ordered() {
+		targetID := target.UserID
 		if targetID == req.UserID {
 			continue // Don't match a user with themselves.
 		}
 
-		// In a real-world scenario, this is where you would implement
-		// more complex matching logic based on user preferences, age, gender, etc.
-		// For now, we'll match any two users.
+		candidate := m.profile(targetID)
+		if !isCompatible(req, requester, target, candidate) {
+			continue
+		}
+		candidateTier := m.ReputationTiers.TierOf(ratingOf(candidate))
+		if !config.CanMatch(requesterTier, candidateTier) {
+			continue
+		}
+		if recent == nil {
+			recent = m.recentPartnersOf(req.UserID)
+		}
+		if m.isRecentPartner(recent, targetID, now) {
+			skippedRecent++
+			continue
+		}
+
+		overlap := InterestOverlap(interestsOf(requester), interestsOf(candidate))
+		if overlap < m.MinInterestOverlap {
+			continue
+		}
+		score := overlap + m.Events.ThemeBonus(now, interestsOf(requester), interestsOf(candidate))
+		sameTier := candidateTier == requesterTier
+		if sameTier && !bestSameTier || sameTier == bestSameTier && score > bestScore {
+			bestID, bestScore, bestSameTier = targetID, score, sameTier
+		}
+	}
+
+	if bestID != "" {
+		m.createRoomForMatch(req.UserID, bestID)
+		return
+	}
+	if m.Queue.Len()-skippedRecent <= 1 {
+		m.tellAlone(req.UserID)
+	}
+}
+
+// tellAlone tells a searching user, once per search, that no one else is online right now.
+func (m *MatcherService) tellAlone(userID string) {
+	if m.toldAlone[userID] {
+		return
+	}
+	m.toldAlone[userID] = true
+	m.Hub.withClient(userID, func(client Client) {
+		m.Hub.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_no_one_else_online",
+			SenderID: "system",
+		})
+	})
+}
+
+// profile returns the cached profile of a queued user, loading it from storage on first use.
+// It returns nil if the profile cannot be loaded.
+func (m *MatcherService) profile(userID string) *models.User {
+	if user, ok := m.profiles[userID]; ok {
+		return user
+	}
+
+	user, err := m.Storage.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Matcher: failed to load profile of %s: %v", userID, err)
+		user = nil
+	}
+	m.profiles[userID] = user
+	return user
+}
+
+// loadProfiles loads the profiles of the queued users that are not cached yet in one query.
+// Users who do not exist are cached as nil. If the query fails, profile loads them one by one.
+func (m *MatcherService) loadProfiles() {
+	var missing []string
+	for _, entry := range m.Queue.Ordered() {
+		if _, ok := m.profiles[entry.UserID]; !ok {
+			missing = append(missing, entry.UserID)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
 
-		m.createRoomForMatch(req.UserID, targetID)
+	users, err := m.Storage.GetUsersByIDs(missing)
+	if err != nil {
+		log.Printf("Matcher: failed to load profiles of %d queued users: %v", len(missing), err)
 		return
 	}
+	for _, userID := range missing {
+		m.profiles[userID] = nil
+	}
+	for i := range users {
+		m.profiles[users[i].ID] = &users[i]
+	}
+}
+
+// recentPartnersOf returns the cached recent chat partners of a queued user, loading them
+// from storage on first use. It never returns nil.
+func (m *MatcherService) recentPartnersOf(userID string) map[string]time.Time {
+	if partners, ok := m.recentPartners[userID]; ok {
+		return partners
+	}
+
+	partners := map[string]time.Time{}
+	if cooldown := m.Hub.rematchCooldown(); cooldown > 0 {
+		loaded, err := m.Storage.GetRecentPartners(userID, time.Now().Add(-cooldown))
+		if err != nil {
+			log.Printf("Matcher: failed to load recent partners of %s: %v", userID, err)
+		} else if loaded != nil {
+			partners = loaded
+		}
+	}
+	m.recentPartners[userID] = partners
+	return partners
+}
+
+// isRecentPartner reports whether a candidate chatted with the requester within the rematch cooldown.
+func (m *MatcherService) isRecentPartner(recent map[string]time.Time, candidateID string, now time.Time) bool {
+	lastChat, ok := recent[candidateID]
+	return ok && now.Sub(lastChat) < m.Hub.rematchCooldown()
+}
+
+// forget drops the cached data of a user who left the queue.
+func (m *MatcherService) forget(userID string) {
+	delete(m.profiles, userID)
+	delete(m.recentPartners, userID)
+	delete(m.toldAlone, userID)
+	delete(m.lastStatus, userID)
+	delete(m.toldLongWait, userID)
+}
+
+// isCompatible reports whether two search requests mutually satisfy each other's criteria.
+// Minors are kept out of adult-only searches, including their own, and users who blocked
+// each other are never paired.
+func isCompatible(a models.SearchRequest, userA *models.User, b models.SearchRequest, userB *models.User) bool {
+	paramsA, paramsB := a.EffectiveParams(), b.EffectiveParams()
+	if isMinor(userA) && paramsA.IsAdultOnly() || isMinor(userB) && paramsB.IsAdultOnly() {
+		return false
+	}
+	if hasBlocked(userA, b.UserID) || hasBlocked(userB, a.UserID) {
+		return false
+	}
+	return paramsA.MatchesUser(userB) && paramsB.MatchesUser(userA)
+}
+
+// hasBlocked reports whether a possibly unknown user blocked the given user.
+func hasBlocked(user *models.User, userID string) bool {
+	return user != nil && user.HasBlocked(userID)
+}
+
+// isPremium reports whether a possibly unknown user has an active premium entitlement.
+func isPremium(user *models.User, now time.Time) bool {
+	return user != nil && user.IsPremium(now)
+}
+
+// searchParamsOf returns the persisted search preferences of a possibly unknown user.
+func searchParamsOf(user *models.User) models.SearchParams {
+	if user == nil {
+		return models.SearchParams{}
+	}
+	return user.SearchParams()
+}
+
+// isMinor reports whether a possibly unknown user is a minor.
+func isMinor(user *models.User) bool {
+	return user != nil && user.IsMinor()
+}
+
+// ratingOf returns the rating score of a possibly unknown user.
+func ratingOf(user *models.User) int {
+	if user == nil {
+		return 0
+	}
+	return user.RatingScore
+}
+
+// interestsOf returns the interests of a possibly unknown user.
+func interestsOf(user *models.User) []string {
+	if user == nil {
+		return nil
+	}
+	return user.Interests
+}
+
+// InterestOverlap returns the number of interests two users share.
+// Interests are compared case-insensitively, ignoring surrounding whitespace.
+func InterestOverlap(a, b []string) int {
+	seen := make(map[string]bool, len(a))
+	for _, interest := range a {
+		seen[strings.ToLower(strings.TrimSpace(interest))] = true
+	}
+
+	overlap := 0
+	for _, interest := range b {
+		key := strings.ToLower(strings.TrimSpace(interest))
+		if seen[key] {
+			overlap++
+			delete(seen, key) // Count duplicates only once.
+		}
+	}
+	return overlap
 }
 
 // createRoomForMatch creates a new chat room for a pair of matched users.
+// Both users are first claimed in the shared Redis queue, so that when several instances
+// run, each user is paired by one matcher only.
 func (m *MatcherService) createRoomForMatch(user1ID, user2ID string) {
+	claimed, err := m.Storage.ClaimMatch(user1ID, user2ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to claim %s and %s for a match: %v", user1ID, user2ID, err)
+		return
+	}
+	if !claimed {
+		m.dropTakenUsers(user1ID, user2ID)
+		return
+	}
+
+	roomID, err := m.openRoom(user1ID, user2ID, "system_match_found")
+	if err != nil {
+		log.Printf("Error saving new room: %v", err)
+		// Give the claimed users back to the shared queue, except those who are in a room
+		// already and must not be matched again.
+		var conflict *roomConflictError
+		errors.As(err, &conflict)
+		for _, userID := range []string{user1ID, user2ID} {
+			if conflict != nil && slices.Contains(conflict.inRoom, userID) {
+				m.Queue.Remove(userID)
+				m.forget(userID)
+				continue
+			}
+			if err := m.Storage.AddUserToSearchQueue(userID); err != nil {
+				log.Printf("ERROR: Failed to re-queue user %s: %v", userID, err)
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	if m.Metrics != nil {
+		m.Metrics.MatchCreated(m.waitedFor(user1ID, now), m.waitedFor(user2ID, now))
+	}
+
+	m.recordSegmentMatch(user1ID, now)
+	m.recordSegmentMatch(user2ID, now)
+
+	// Remove both users from the queue.
+	m.Queue.Remove(user1ID)
+	m.Queue.Remove(user2ID)
+	m.forget(user1ID)
+	m.forget(user2ID)
+
+	log.Printf("Match found: %s and %s in room %s", user1ID, user2ID, roomID)
+}
+
+// openRoom saves a new room for two users, moves their clients into it and sends both a
+// system_match_found message with the given content and the partner's trust badge, wherever
+// their clients are (see deliverMatch). It fails with a *roomConflictError if one of them is
+// in a room already (see lockNewRoom).
+func (m *MatcherService) openRoom(user1ID, user2ID, content string) (string, error) {
+	unlock, err := m.lockNewRoom(user1ID, user2ID)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	roomID := uuid.New().String()
 	newRoom := &models.ChatRoom{
 		RoomID:    roomID,
@@ -111,36 +652,64 @@ func (m *MatcherService) createRoomForMatch(user1ID, user2ID string) {
 		User2ID:   user2ID,
 		IsActive:  true,
 		StartedAt: time.Now(),
+		SafeMode:  isMinor(m.profile(user1ID)) || isMinor(m.profile(user2ID)),
 	}
-
 	if err := m.Storage.SaveRoom(newRoom); err != nil {
-		log.Printf("Error saving new room: %v", err)
-		return
+		return "", err
 	}
+	m.Hub.Rooms.Transition(newRoom, RoomMatched, "system", "")
 
-	// Update the clients with the new room ID.
-	if client1, ok := m.Hub.Clients[user1ID]; ok {
-		client1.SetRoomID(roomID)
+	now := time.Now()
+	for _, pair := range [][2]string{{user1ID, user2ID}, {user2ID, user1ID}} {
+		message := matchFoundMessage(roomID, m.profile(pair[1]), now)
+		message.Content = content
+		m.deliverMatch(pair[0], message)
 	}
-	if client2, ok := m.Hub.Clients[user2ID]; ok {
-		client2.SetRoomID(roomID)
+	return roomID, nil
+}
+
+// deliverMatch moves the client of a matched user into the new room and sends them the match
+// notice. A user whose client another instance holds is told through that instance, e.g. a
+// user queued through a standby instance of the matcher leader.
+func (m *MatcherService) deliverMatch(userID string, message models.ChatMessage) {
+	delivered := m.Hub.withClient(userID, func(client Client) {
+		m.Hub.joinRoom(message.RoomID)
+		client.SetRoomID(message.RoomID)
+		m.Hub.sendToClient(client, message)
+	})
+	if !delivered && !m.Hub.forwardToInstance(userID, message) {
+		log.Printf("WARN: Matched user %s has no client, they find the room when they come back.", userID)
+	}
+}
+
+// dropTakenUsers removes users who are no longer in the shared queue (e.g., because another
+// instance matched them or they cancelled there) from the local queue.
+func (m *MatcherService) dropTakenUsers(userIDs ...string) {
+	for _, userID := range userIDs {
+		searching, err := m.Storage.IsUserSearching(userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to check search status of user %s: %v", userID, err)
+			continue
+		}
+		if !searching {
+			m.Queue.Remove(userID)
+			m.forget(userID)
+			log.Printf("Matcher: user %s left the shared queue, dropping it locally.", userID)
+		}
 	}
+}
 
-	// Notify both clients that a match has been found.
-	matchMessage := models.ChatMessage{
+// matchFoundMessage builds the "match found" notification. Its Metadata carries the
+// partner's trust badge (see models.User.TrustBadge), if any.
+func matchFoundMessage(roomID string, partner *models.User, now time.Time) models.ChatMessage {
+	message := models.ChatMessage{
 		RoomID:   roomID,
 		Content:  "system_match_found",
 		Type:     "system_match_found",
 		SenderID: "system",
 	}
-	m.Hub.Clients[user1ID].GetSendChannel() <- matchMessage
-	m.Hub.Clients[user2ID].GetSendChannel() <- matchMessage
-
-	// Remove both users from the queue.
-	delete(m.Queue, user1ID)
-	delete(m.Queue, user2ID)
-	m.Storage.RemoveUserFromSearchQueue(user1ID)
-	m.Storage.RemoveUserFromSearchQueue(user2ID)
-
-	log.Printf("Match found: %s and %s in room %s", user1ID, user2ID, roomID)
+	if partner != nil {
+		message.Metadata = partner.TrustBadge(now)
+	}
+	return message
 }
@@ -3,7 +3,9 @@ package chathub_test
 import (
 	"chatgogo/backend/internal/chathub"
 	"chatgogo/backend/internal/models"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,11 +20,12 @@ func TestMatcherQueueing(t *testing.T) {
 
 	// Act - Manually add to queue (direct access since we're in the same package conceptually)
 	req := models.SearchRequest{UserID: "user_12345"}
-	matcher.Queue[req.UserID] = req
+	matcher.Queue.Push(req)
 
 	// Assert
-	assert.Contains(t, matcher.Queue, "user_12345", "User should be added to matcher queue")
-	assert.Equal(t, "user_12345", matcher.Queue["user_12345"].UserID)
+	assert.True(t, matcher.Queue.Contains("user_12345"), "User should be added to matcher queue")
+	queued, _ := matcher.Queue.Get("user_12345")
+	assert.Equal(t, "user_12345", queued.UserID)
 }
 
 // TestMatcherSuccessfulMatch_Integration tests the full matching flow via channels.
@@ -40,12 +43,15 @@ func TestMatcherSuccessfulMatch_Integration(t *testing.T) {
 	hub.Clients["user_B"] = clientB
 
 	// Expect SaveRoom to be called
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
 	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
-	storageMock.On("RemoveUserFromSearchQueue", mock.AnythingOfType("string")).Return(nil)
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
 
 	// Act - Manually add both users to the queue
-	matcher.Queue["user_A"] = models.SearchRequest{UserID: "user_A"}
-	matcher.Queue["user_B"] = models.SearchRequest{UserID: "user_B"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
 
 	// Find a partner for reqA
 	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
@@ -58,7 +64,7 @@ func TestMatcherSuccessfulMatch_Integration(t *testing.T) {
 	assert.Equal(t, clientA.GetRoomID(), clientB.GetRoomID())
 
 	// Queue should be empty
-	assert.Empty(t, matcher.Queue)
+	assert.Zero(t, matcher.Queue.Len())
 }
 
 // TestMatcherNoSelfMatch ensures a user cannot be matched with themselves.
@@ -70,13 +76,14 @@ func TestMatcherNoSelfMatch(t *testing.T) {
 
 	client := newMockClient("user_solo")
 	hub.Clients["user_solo"] = client
+	storageMock.On("GetUserByID", "user_solo").Return(&models.User{ID: "user_solo"}, nil)
 
 	// Act - Add only one user to queue
-	matcher.Queue["user_solo"] = models.SearchRequest{UserID: "user_solo"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_solo"})
 	matcher.FindMatch(models.SearchRequest{UserID: "user_solo"})
 
 	// Assert - No match should be found
-	assert.Contains(t, matcher.Queue, "user_solo", "User should remain in queue")
+	assert.True(t, matcher.Queue.Contains("user_solo"), "User should remain in queue")
 	assert.Empty(t, client.GetRoomID(), "Client should not have a room assigned")
 }
 
@@ -88,11 +95,14 @@ func TestMatcherQueueRemoval(t *testing.T) {
 	matcher := chathub.NewMatcherService(hub, storageMock)
 
 	// Add two users
-	matcher.Queue["user_X"] = models.SearchRequest{UserID: "user_X"}
-	matcher.Queue["user_Y"] = models.SearchRequest{UserID: "user_Y"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_X"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_Y"})
 
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
 	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
-	storageMock.On("RemoveUserFromSearchQueue", mock.AnythingOfType("string")).Return(nil)
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
 
 	clientA := newMockClient("user_X")
 	clientB := newMockClient("user_Y")
@@ -103,7 +113,7 @@ func TestMatcherQueueRemoval(t *testing.T) {
 	matcher.FindMatch(models.SearchRequest{UserID: "user_X"})
 
 	// Assert
-	assert.Empty(t, matcher.Queue, "Queue should be empty after both users matched")
+	assert.Zero(t, matcher.Queue.Len(), "Queue should be empty after both users matched")
 }
 
 // TestMatcherQueueStructure tests the Queue data structure properties.
@@ -116,17 +126,18 @@ func TestMatcherQueueStructure(t *testing.T) {
 	// Act - Add multiple unique users
 	for i := 0; i < 5; i++ {
 		userID := "user_" + string(rune('A'+i))
-		matcher.Queue[userID] = models.SearchRequest{UserID: userID}
+		matcher.Queue.Push(models.SearchRequest{UserID: userID})
 	}
 
 	// Assert
-	assert.Equal(t, 5, len(matcher.Queue), "Queue should contain 5 users")
+	assert.Equal(t, 5, matcher.Queue.Len(), "Queue should contain 5 users")
 
 	// Verify each user exists
 	for i := 0; i < 5; i++ {
 		userID := "user_" + string(rune('A'+i))
-		assert.Contains(t, matcher.Queue, userID)
-		assert.Equal(t, userID, matcher.Queue[userID].UserID)
+		assert.True(t, matcher.Queue.Contains(userID))
+		queued, _ := matcher.Queue.Get(userID)
+		assert.Equal(t, userID, queued.UserID)
 	}
 }
 
@@ -136,11 +147,436 @@ func TestAddUserToQueue(t *testing.T) {
 	hub := chathub.NewManagerService(storageMock)
 	matcher := chathub.NewMatcherService(hub, storageMock)
 	storageMock.On("AddUserToSearchQueue", "user_123").Return(nil)
+	storageMock.On("GetUserByID", "user_123").Return(&models.User{ID: "user_123"}, nil)
 
 	// Act
 	matcher.AddUserToQueue(models.SearchRequest{UserID: "user_123"})
 
 	// Assert
-	assert.Contains(t, matcher.Queue, "user_123")
+	assert.True(t, matcher.Queue.Contains("user_123"))
 	storageMock.AssertCalled(t, "AddUserToSearchQueue", "user_123")
 }
+
+// TestAddUserToQueueUsesSearchPreferences verifies that requests without criteria pick up
+// the user's persisted search preferences, while explicit criteria are kept.
+func TestAddUserToQueueUsesSearchPreferences(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("AddUserToSearchQueue", mock.AnythingOfType("string")).Return(nil)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{
+		PreferredGender: "female",
+		PreferredAgeMin: 20,
+		PreferredAgeMax: 30,
+	}, nil)
+
+	matcher.AddUserToQueue(models.SearchRequest{UserID: "user_A"})
+	explicit := models.SearchParams{TargetGender: "male"}
+	matcher.AddUserToQueue(models.SearchRequest{UserID: "user_B", Params: explicit})
+
+	reqA, _ := matcher.Queue.Get("user_A")
+	assert.Equal(t, models.SearchParams{TargetGender: "female", TargetAgeMin: 20, TargetAgeMax: 30}, reqA.Params)
+	reqB, _ := matcher.Queue.Get("user_B")
+	assert.Equal(t, explicit, reqB.Params)
+}
+
+// TestMatcherRespectsMutualFilters verifies that users are only paired when both
+// sides' gender/age criteria are satisfied.
+func TestMatcherRespectsMutualFilters(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", Gender: "male", Age: 25}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", Gender: "female", Age: 40}, nil)
+
+	hub.Clients["user_A"] = newMockClient("user_A")
+	hub.Clients["user_B"] = newMockClient("user_B")
+
+	reqA := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female", TargetAgeMax: 30}}
+	matcher.Queue.Push(reqA)
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+	assert.Equal(t, 2, matcher.Queue.Len(), "Users with incompatible criteria must stay in the queue")
+}
+
+// TestMatcherMatchesWhenFiltersSatisfied verifies that compatible users with filters are paired.
+func TestMatcherMatchesWhenFiltersSatisfied(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", Gender: "male", Age: 25}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", Gender: "female", Age: 27}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	hub.Clients["user_A"] = newMockClient("user_A")
+	hub.Clients["user_B"] = newMockClient("user_B")
+
+	reqA := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female", TargetAgeMin: 18, TargetAgeMax: 30}}
+	matcher.Queue.Push(reqA)
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B", Params: models.SearchParams{TargetGender: "male"}})
+
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertExpectations(t)
+	assert.Zero(t, matcher.Queue.Len())
+}
+
+// TestMatcherNearTimezone verifies that a user who only wants partners near their timezone
+// is paired with the candidate from a nearby region.
+func TestMatcherNearTimezone(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", Region: "europe_east", PreferNearTimezone: true}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", Region: "east_asia"}, nil)
+	storageMock.On("GetUserByID", "user_C").Return(&models.User{ID: "user_C", Region: "europe_central"}, nil)
+	storageMock.On("SaveRoom", mock.MatchedBy(func(room *models.ChatRoom) bool {
+		return room.User1ID == "user_A" && room.User2ID == "user_C"
+	})).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	for _, id := range []string{"user_A", "user_B", "user_C"} {
+		hub.Clients[id] = newMockClient(id)
+	}
+
+	reqA := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{NearRegion: "europe_east"}}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_C"})
+	matcher.Queue.Push(reqA)
+
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertExpectations(t)
+	_, stillQueued := matcher.Queue.Get("user_B")
+	assert.True(t, stillQueued)
+}
+
+// TestInterestOverlap verifies case-insensitive counting of shared interests.
+func TestInterestOverlap(t *testing.T) {
+	assert.Equal(t, 2, chathub.InterestOverlap([]string{"Music", "travel ", "coding"}, []string{"music", "Travel", "chess"}))
+	assert.Equal(t, 0, chathub.InterestOverlap(nil, []string{"music"}))
+	assert.Equal(t, 1, chathub.InterestOverlap([]string{"music", "music"}, []string{"music", "MUSIC"}))
+}
+
+// TestMatcherPrefersHighestInterestOverlap verifies that the candidate sharing the most
+// interests is chosen, and that the minimum overlap threshold is enforced.
+func TestMatcherPrefersHighestInterestOverlap(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	matcher.MinInterestOverlap = 1
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", Interests: []string{"music", "travel", "coding"}}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", Interests: []string{"music"}}, nil)
+	storageMock.On("GetUserByID", "user_C").Return(&models.User{ID: "user_C", Interests: []string{"travel", "coding"}}, nil)
+	storageMock.On("GetUserByID", "user_D").Return(&models.User{ID: "user_D", Interests: []string{"chess"}}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	for _, id := range []string{"user_A", "user_B", "user_C", "user_D"} {
+		hub.Clients[id] = newMockClient(id)
+		matcher.Queue.Push(models.SearchRequest{UserID: id})
+	}
+
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+
+	assert.False(t, matcher.Queue.Contains("user_C"), "Best-overlapping candidate should be matched")
+	assert.True(t, matcher.Queue.Contains("user_B"))
+	assert.True(t, matcher.Queue.Contains("user_D"))
+
+	// user_D shares no interests with user_B, so the threshold prevents a match.
+	matcher.FindMatch(models.SearchRequest{UserID: "user_B"})
+	assert.True(t, matcher.Queue.Contains("user_B"))
+	assert.True(t, matcher.Queue.Contains("user_D"))
+}
+
+// TestMatcherSendsPartnerTrustBadge verifies that each side of a match is told the
+// partner's trust band, not their own.
+func TestMatcherSendsPartnerTrustBadge(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", CreatedAt: old, RatingScore: 12}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", CreatedAt: time.Now()}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+
+	msgA := <-clientA.RecvChannel
+	msgB := <-clientB.RecvChannel
+	assert.Equal(t, "system_match_found", msgA.Type)
+	assert.Equal(t, models.TrustBadgeNew, msgA.Metadata)
+	assert.Equal(t, models.TrustBadgeTrusted, msgB.Metadata)
+}
+
+// TestMatcherSkipsRecentPartners verifies that users who just chatted are not paired again
+// while another candidate is available.
+func TestMatcherSkipsRecentPartners(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", "user_A", mock.AnythingOfType("time.Time")).
+		Return(map[string]time.Time{"user_B": time.Now().Add(-time.Hour)}, nil).Once()
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	for _, id := range []string{"user_A", "user_B", "user_C"} {
+		hub.Clients[id] = newMockClient(id)
+		matcher.Queue.Push(models.SearchRequest{UserID: id})
+	}
+
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+
+	storageMock.AssertExpectations(t)
+	assert.True(t, matcher.Queue.Contains("user_B"), "Recent partner must not be matched again")
+	assert.False(t, matcher.Queue.Contains("user_C"))
+}
+
+// TestMatcherReputationTiers verifies that low-reputation users are preferentially matched
+// with each other and that high-reputation users are never matched with them.
+func TestMatcherReputationTiers(t *testing.T) {
+	newMatcher := func(users map[string]int) (*chathub.MatcherService, *MockStorage) {
+		storageMock := new(MockStorage)
+		hub := chathub.NewManagerService(storageMock)
+		matcher := chathub.NewMatcherService(hub, storageMock)
+		for _, id := range []string{"user_A", "user_B", "user_C"} {
+			if rating, ok := users[id]; ok {
+				storageMock.On("GetUserByID", id).Return(&models.User{ID: id, RatingScore: rating}, nil)
+				hub.Clients[id] = newMockClient(id)
+				matcher.Queue.Push(models.SearchRequest{UserID: id})
+			}
+		}
+		storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+		storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil)
+		expectRoomGuard(storageMock)
+		storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+		return matcher, storageMock
+	}
+
+	t.Run("Low tier prefers low tier", func(t *testing.T) {
+		matcher, _ := newMatcher(map[string]int{"user_A": -5, "user_B": 0, "user_C": -4})
+		matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+		assert.True(t, matcher.Queue.Contains("user_B"))
+		assert.False(t, matcher.Queue.Contains("user_C"))
+	})
+
+	t.Run("High tier is protected from low tier", func(t *testing.T) {
+		matcher, storageMock := newMatcher(map[string]int{"user_A": 15, "user_B": -5})
+		matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+		storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+		assert.Equal(t, 2, matcher.Queue.Len())
+	})
+}
+
+// TestMatcherRunMatchesNewRequestsImmediately verifies that the event-driven loop matches a
+// new request on arrival instead of waiting for the periodic queue scan.
+func TestMatcherRunMatchesNewRequestsImmediately(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	matcher.MatchScanInterval = time.Hour
+
+	storageMock.On("GetSearchingUsers").Return([]string{}, nil)
+	storageMock.On("AddUserToSearchQueue", mock.AnythingOfType("string")).Return(nil)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go matcher.Run(context.Background())
+	hub.MatchRequestCh <- models.SearchRequest{UserID: "user_A"}
+	hub.MatchRequestCh <- models.SearchRequest{UserID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	// The first user was alone in the queue until the second one joined.
+	assert.Equal(t, "system_no_one_else_online", (<-clientA.RecvChannel).Content)
+	for _, client := range []*MockClient{clientA, clientB} {
+		select {
+		case msg := <-client.RecvChannel:
+			assert.Equal(t, "system_match_found", msg.Type)
+		default:
+			t.Errorf("%s was not matched", client.GetUserID())
+		}
+	}
+}
+
+// TestMatcherTinyQueue verifies that users who just chatted are not re-paired even with the
+// rematch cooldown disabled, that the requester is told once that no one else is online,
+// and that they are matched as soon as someone new joins.
+func TestMatcherTinyQueue(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	hub.RematchCooldown = 0
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	justNow := time.Now().Add(-10 * time.Second)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", "user_A", mock.Anything).Return(map[string]time.Time{"user_B": justNow}, nil)
+	storageMock.On("GetRecentPartners", "user_C", mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	clientA := newMockClient("user_A")
+	for id, client := range map[string]*MockClient{"user_A": clientA, "user_B": newMockClient("user_B"), "user_C": newMockClient("user_C")} {
+		hub.Clients[id] = client
+	}
+
+	reqA := models.SearchRequest{UserID: "user_A"}
+	matcher.Queue.Push(reqA)
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.FindMatch(reqA)
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+	assert.Equal(t, "system_no_one_else_online", (<-clientA.RecvChannel).Content)
+	assert.Len(t, clientA.RecvChannel, 0, "the user must be told only once")
+
+	reqC := models.SearchRequest{UserID: "user_C"}
+	matcher.Queue.Push(reqC)
+	matcher.FindMatch(reqC)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "system_match_found", (<-clientA.RecvChannel).Type)
+	assert.True(t, matcher.Queue.Contains("user_B"))
+}
+
+// TestMatcherLostClaim verifies that no room is created when another instance already took
+// one of the users, and that the taken user is dropped from the local queue.
+func TestMatcherLostClaim(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", "user_A", "user_B").Return(false, nil).Once()
+	storageMock.On("IsUserSearching", "user_A").Return(true, nil)
+	storageMock.On("IsUserSearching", "user_B").Return(false, nil)
+
+	hub.Clients["user_A"] = newMockClient("user_A")
+	hub.Clients["user_B"] = newMockClient("user_B")
+
+	reqA := models.SearchRequest{UserID: "user_A"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.Queue.Push(reqA)
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+	assert.True(t, matcher.Queue.Contains("user_A"))
+	assert.False(t, matcher.Queue.Contains("user_B"), "User taken by another instance must be dropped")
+}
+
+// TestMatcherSkipsUserInRoom verifies that no second room is opened for a user who is in an
+// active room already, e.g. after a duplicate search command, and that only their partner is
+// given back to the shared queue.
+func TestMatcherSkipsUserInRoom(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", "user_A", "user_B").Return(true, nil).Once()
+	storageMock.On("LockMatch", mock.Anything, []string{"user_A", "user_B"}, mock.Anything).Return(true, nil).Once()
+	storageMock.On("UnlockMatch", mock.Anything, []string{"user_A", "user_B"}).Return(nil).Once()
+	storageMock.On("GetActiveRoomIDForUser", "user_A").Return("", nil)
+	storageMock.On("GetActiveRoomIDForUser", "user_B").Return("room1", nil)
+	storageMock.On("AddUserToSearchQueue", "user_A").Return(nil).Once()
+
+	reqA := models.SearchRequest{UserID: "user_A"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.Queue.Push(reqA)
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+	storageMock.AssertNotCalled(t, "AddUserToSearchQueue", "user_B")
+	assert.True(t, matcher.Queue.Contains("user_A"))
+	assert.False(t, matcher.Queue.Contains("user_B"))
+}
+
+// TestMatcherWaitsForLockedUsers verifies that no room is opened while a room is being opened
+// for one of the users elsewhere, and that both users are given back to the shared queue.
+func TestMatcherWaitsForLockedUsers(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", "user_A", "user_B").Return(true, nil).Once()
+	storageMock.On("LockMatch", mock.Anything, []string{"user_A", "user_B"}, mock.Anything).Return(false, nil).Once()
+	storageMock.On("AddUserToSearchQueue", "user_A").Return(nil).Once()
+	storageMock.On("AddUserToSearchQueue", "user_B").Return(nil).Once()
+
+	reqA := models.SearchRequest{UserID: "user_A"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.Queue.Push(reqA)
+	matcher.FindMatch(reqA)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+	storageMock.AssertNotCalled(t, "UnlockMatch", mock.Anything, mock.Anything)
+}
+
+// TestMatcherLoadsQueuedProfilesInOneQuery verifies that the profiles of the queued users are
+// loaded in one batch instead of one query per candidate.
+func TestMatcherLoadsQueuedProfilesInOneQuery(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("GetUsersByIDs", []string{"user_A", "user_B", "user_C"}).Return([]models.User{
+		{ID: "user_A", Gender: "male"},
+		{ID: "user_B", Gender: "male"},
+		{ID: "user_C", Gender: "female"},
+	}, nil).Once()
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", "user_A", "user_C").Return(true, nil).Once()
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female"}})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_C"})
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female"}})
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "GetUserByID", mock.Anything)
+	assert.Equal(t, 1, matcher.Queue.Len())
+}
@@ -0,0 +1,152 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextMessage returns the next message of a client of the given type, skipping the others,
+// or fails the test after a second.
+func nextMessage(t *testing.T, client *MockClient, msgType string) models.ChatMessage {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg := <-client.RecvChannel:
+			if msg.Type == msgType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("%s received no %s message", client.GetUserID(), msgType)
+			return models.ChatMessage{}
+		}
+	}
+}
+
+// TestHubWithMemoryStorage verifies that the hub and the matcher run end-to-end on the
+// in-memory storage: two searching users are matched, and a message of one reaches the other
+// through the room's subscription and is kept in the history.
+func TestHubWithMemoryStorage(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	for _, userID := range []string{"user_A", "user_B"} {
+		require.NoError(t, s.SaveUser(&models.User{ID: userID, TelegramID: 1}))
+	}
+	hub := chathub.NewManagerService(s)
+	matcher := chathub.NewMatcherService(hub, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	go matcher.Run(ctx)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.RegisterCh <- clientA
+	hub.RegisterCh <- clientB
+	time.Sleep(50 * time.Millisecond)
+	hub.MatchRequestCh <- models.SearchRequest{UserID: "user_A"}
+	hub.MatchRequestCh <- models.SearchRequest{UserID: "user_B"}
+	nextMessage(t, clientA, "system_match_found")
+	nextMessage(t, clientB, "system_match_found")
+
+	roomID, err := s.GetActiveRoomIDForUser("user_A")
+	require.NoError(t, err)
+	require.NotEmpty(t, roomID)
+	hub.IncomingCh <- models.ChatMessage{RoomID: roomID, SenderID: "user_A", Type: "text", Content: "hello"}
+	assert.Equal(t, "hello", nextMessage(t, clientB, "text").Content)
+
+	history, err := s.GetChatHistory(roomID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "user_A", history[0].SenderID)
+}
+
+// TestHubWithMemoryStorage_RestoresSavedSearchCriteria verifies that the matcher restoring
+// the queue searches with the criteria of saved search requests, e.g. those persisted on
+// shutdown, instead of the users' preferences.
+func TestHubWithMemoryStorage_RestoresSavedSearchCriteria(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	for i, user := range []models.User{{ID: "user_A", Gender: "female"}, {ID: "user_B", Gender: "female"}, {ID: "user_C", Gender: "male"}} {
+		user.TelegramID = int64(i + 1)
+		require.NoError(t, s.SaveUser(&user))
+	}
+	require.NoError(t, s.SaveSearchRequest(models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "male"}, Strict: true}))
+	require.NoError(t, s.SaveSearchRequest(models.SearchRequest{UserID: "user_B", Params: models.SearchParams{TargetGender: "female"}, Strict: true}))
+	require.NoError(t, s.AddUserToSearchQueue("user_C"))
+
+	hub := chathub.NewManagerService(s)
+	matcher := chathub.NewMatcherService(hub, s)
+	matcher.MatchScanInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clients := map[string]*MockClient{}
+	for _, userID := range []string{"user_A", "user_B", "user_C"} {
+		clients[userID] = newMockClient(userID)
+		hub.RegisterCh <- clients[userID]
+	}
+	time.Sleep(50 * time.Millisecond)
+	go matcher.Run(ctx)
+
+	nextMessage(t, clients["user_A"], "system_match_found")
+	nextMessage(t, clients["user_C"], "system_match_found")
+	roomID, err := s.GetActiveRoomIDForUser("user_B")
+	require.NoError(t, err)
+	assert.Empty(t, roomID, "user_B searches for women only")
+}
+
+// TestHubWithMemoryStorage_MatcherRunsAlongsideHub verifies that the matcher notifying and
+// matching clients from its goroutine does not race with the hub registering, unregistering
+// and checking them. It is meant to be run with -race.
+func TestHubWithMemoryStorage_MatcherRunsAlongsideHub(t *testing.T) {
+	const users = 20
+	s := storage.NewMemoryStorage()
+	for i := range users {
+		require.NoError(t, s.SaveUser(&models.User{ID: fmt.Sprintf("user_%d", i), TelegramID: int64(i + 1)}))
+	}
+	hub := chathub.NewManagerService(s)
+	hub.ActivityCheckInterval = 5 * time.Millisecond
+	hub.DeadClientTimeout = 10 * time.Millisecond
+	matcher := chathub.NewMatcherService(hub, s)
+	matcher.MatchScanInterval = 5 * time.Millisecond
+	matcher.QueueStatusInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	go matcher.Run(ctx)
+
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := newMockClient(fmt.Sprintf("user_%d", i))
+			if i%2 == 0 {
+				// Leave no room in the channel, so that the notices of the matcher find it full.
+				for len(client.RecvChannel) < cap(client.RecvChannel) {
+					client.RecvChannel <- models.ChatMessage{Type: "text"}
+				}
+			}
+			hub.RegisterCh <- client
+			hub.MatchRequestCh <- models.SearchRequest{UserID: client.GetUserID()}
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			hub.UnregisterCh <- client
+		}()
+	}
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := hub.Snapshot(ctx, "user_0")
+	assert.NoError(t, err, "the hub keeps running")
+}
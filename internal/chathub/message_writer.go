@@ -0,0 +1,159 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultMessageBatchSize is the maximum number of chat messages a MessageWriter saves
+	// with one bulk insert.
+	DefaultMessageBatchSize = 100
+	// DefaultMessageFlushInterval is how long a MessageWriter collects chat messages before
+	// it saves the ones it has, unless a batch is full earlier.
+	DefaultMessageFlushInterval = 20 * time.Millisecond
+	// DefaultMessageWriterQueue is the number of chat messages that may wait for a
+	// MessageWriter before the hub saves further ones itself.
+	DefaultMessageWriterQueue = 1000
+)
+
+// Paths of saved chat messages counted by chatgogo_hub_message_writes_total.
+const (
+	// writeBatched is a message saved by the MessageWriter.
+	writeBatched = "batched"
+	// writeDirect is a message the hub saved itself, without a writer or as its queue was full.
+	writeDirect = "direct"
+	// writeFailed is a message that could not be saved, and was dropped.
+	writeFailed = "failed"
+)
+
+var messageWrites = metrics.Default.NewCounterVec("chatgogo_hub_message_writes_total",
+	"Chat messages saved by the batching writer (batched) or by the hub (direct), or dropped because they could not be saved (failed).", "path")
+
+// MessageWriterStorage is the part of storage.Storage the MessageWriter uses.
+type MessageWriterStorage interface {
+	SaveMessage(msg *models.ChatMessage) error
+	SaveMessages(msgs []*models.ChatMessage) error
+	PublishSavedMessage(msg models.ChatMessage) error
+}
+
+// MessageWriter saves chat messages in batches, off the hub goroutine, and then publishes
+// them to their rooms, so that the hub does not wait for an INSERT per message under load.
+// It collects the messages submitted by the hub and saves them with one bulk insert
+// (Storage.SaveMessages) when BatchSize are waiting or FlushInterval passed, whichever is
+// first.
+//
+// Durability: a message is only published once it is saved, together with its outbox entry,
+// so nobody receives a message that is not in the history, and a saved message is delivered
+// even if publishing fails (see OutboxRelay). A submitted message that is not saved yet is
+// only held in memory, for up to FlushInterval plus the duration of a flush: it is saved
+// when Run stops, but lost if the process crashes, or if it cannot be saved even on its own.
+// Its sender is not told, as with a failed save by the hub.
+//
+// Ordering: the writer saves and publishes the messages in the order they were submitted.
+// When its queue is full, the hub saves a message itself, which may then reach the room
+// before messages submitted earlier.
+type MessageWriter struct {
+	// Storage provides access to the data persistence layer.
+	Storage MessageWriterStorage
+	// BatchSize is the maximum number of messages saved with one bulk insert.
+	BatchSize int
+	// FlushInterval is the longest a submitted message waits to be saved.
+	FlushInterval time.Duration
+
+	queue chan models.ChatMessage
+}
+
+// NewMessageWriter creates and returns a new MessageWriter with default settings.
+func NewMessageWriter(s MessageWriterStorage) *MessageWriter {
+	return &MessageWriter{
+		Storage:       s,
+		BatchSize:     DefaultMessageBatchSize,
+		FlushInterval: DefaultMessageFlushInterval,
+		queue:         make(chan models.ChatMessage, DefaultMessageWriterQueue),
+	}
+}
+
+// Submit hands a message to the writer without blocking, and reports whether it was taken.
+// It is not taken while the queue is full. It must not be called after Run returned.
+func (w *MessageWriter) Submit(message models.ChatMessage) bool {
+	select {
+	case w.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run saves and publishes the submitted messages until ctx is cancelled, and then those that
+// are still queued. It must be stopped after the hub, which submits messages until it stops.
+func (w *MessageWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ChatMessage, 0, w.BatchSize)
+	for {
+		select {
+		case message := <-w.queue:
+			batch = append(batch, message)
+			if len(batch) >= w.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		case <-ctx.Done():
+			for {
+				select {
+				case message := <-w.queue:
+					batch = append(batch, message)
+					if len(batch) >= w.BatchSize {
+						w.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush saves a batch of messages and publishes the saved ones. If the bulk insert fails,
+// the messages are saved one by one, so that one bad message does not drop the others.
+func (w *MessageWriter) flush(batch []models.ChatMessage) {
+	if len(batch) == 0 {
+		return
+	}
+	msgs := make([]*models.ChatMessage, len(batch))
+	for i := range batch {
+		msgs[i] = &batch[i]
+	}
+
+	saved := msgs
+	if err := w.Storage.SaveMessages(msgs); err != nil {
+		log.Printf("ERROR: Failed to save a batch of %d messages, saving them one by one: %v", len(msgs), err)
+		saved = make([]*models.ChatMessage, 0, len(msgs))
+		for _, msg := range msgs {
+			msg.ID = 0
+			if err := w.Storage.SaveMessage(msg); err != nil {
+				log.Printf("ERROR: Failed to save message: %v", err)
+				messageWrites.Inc(writeFailed)
+				continue
+			}
+			saved = append(saved, msg)
+		}
+	}
+
+	messageWrites.Add(uint64(len(saved)), writeBatched)
+	for _, msg := range saved {
+		if err := w.Storage.PublishSavedMessage(*msg); err != nil {
+			log.Printf("ERROR: Failed to publish message %d, leaving it to the outbox relay: %v", msg.ID, err)
+		}
+	}
+}
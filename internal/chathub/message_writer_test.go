@@ -0,0 +1,119 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// numberMessages makes SaveMessages give the messages of a batch consecutive IDs from first.
+func numberMessages(first uint) func(args mock.Arguments) {
+	return func(args mock.Arguments) {
+		for i, msg := range args.Get(0).([]*models.ChatMessage) {
+			msg.ID = first + uint(i)
+		}
+	}
+}
+
+// TestMessageWriter_SavesAndPublishesInBatches verifies that submitted messages are saved
+// with one bulk insert once a batch is full, and then published in order with their IDs.
+func TestMessageWriter_SavesAndPublishesInBatches(t *testing.T) {
+	storageMock := new(MockStorage)
+	writer := chathub.NewMessageWriter(storageMock)
+	writer.BatchSize = 2
+	writer.FlushInterval = time.Hour
+	storageMock.On("SaveMessages", mock.MatchedBy(func(msgs []*models.ChatMessage) bool {
+		return len(msgs) == 2 && msgs[0].Content == "one" && msgs[1].Content == "two"
+	})).Run(numberMessages(7)).Return(nil).Once()
+	published := make(chan models.ChatMessage, 2)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Run(func(args mock.Arguments) {
+		published <- args.Get(0).(models.ChatMessage)
+	}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+
+	assert.True(t, writer.Submit(models.ChatMessage{RoomID: "room1", Content: "one"}))
+	assert.True(t, writer.Submit(models.ChatMessage{RoomID: "room1", Content: "two"}))
+	first, second := <-published, <-published
+	assert.Equal(t, "one", first.Content)
+	assert.Equal(t, uint(7), first.ID)
+	assert.Equal(t, "two", second.Content)
+	assert.Equal(t, uint(8), second.ID)
+	storageMock.AssertExpectations(t)
+}
+
+// TestMessageWriter_SavesOneByOneAfterFailedBatch verifies that a batch whose bulk insert
+// failed is saved message by message, and that only the messages saved are published.
+func TestMessageWriter_SavesOneByOneAfterFailedBatch(t *testing.T) {
+	storageMock := new(MockStorage)
+	writer := chathub.NewMessageWriter(storageMock)
+	writer.FlushInterval = 10 * time.Millisecond
+	storageMock.On("SaveMessages", mock.Anything).Return(errors.New("value too long")).Once()
+	storageMock.On("SaveMessage", mock.MatchedBy(func(msg *models.ChatMessage) bool { return msg.Content == "ok" })).
+		Run(func(args mock.Arguments) { args.Get(0).(*models.ChatMessage).ID = 3 }).Return(nil).Once()
+	storageMock.On("SaveMessage", mock.MatchedBy(func(msg *models.ChatMessage) bool { return msg.Content == "bad" })).
+		Return(errors.New("value too long")).Once()
+	storageMock.On("PublishSavedMessage", mock.MatchedBy(func(msg models.ChatMessage) bool { return msg.ID == 3 })).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go writer.Run(ctx)
+
+	writer.Submit(models.ChatMessage{RoomID: "room1", Content: "bad"})
+	writer.Submit(models.ChatMessage{RoomID: "room1", Content: "ok"})
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+}
+
+// TestMessageWriter_SavesQueuedMessagesOnStop verifies that the messages still queued when
+// the writer is stopped are saved before Run returns.
+func TestMessageWriter_SavesQueuedMessagesOnStop(t *testing.T) {
+	storageMock := new(MockStorage)
+	writer := chathub.NewMessageWriter(storageMock)
+	writer.FlushInterval = time.Hour
+	storageMock.On("SaveMessages", mock.MatchedBy(func(msgs []*models.ChatMessage) bool { return len(msgs) == 3 })).
+		Run(numberMessages(1)).Return(nil).Once()
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil).Times(3)
+
+	for i := 0; i < 3; i++ {
+		writer.Submit(models.ChatMessage{RoomID: "room1", Content: "hi"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+
+	storageMock.AssertExpectations(t)
+}
+
+// TestManager_WriterTakesChatMessages verifies that a hub with a writer hands chat messages
+// to it, and only saves them itself while the writer's queue is full.
+func TestManager_WriterTakesChatMessages(t *testing.T) {
+	hub, storageMock := newPipelineHub()
+	hub.Writer = chathub.NewMessageWriter(storageMock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "hello"}
+	time.Sleep(50 * time.Millisecond)
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	storageMock.AssertNotCalled(t, "PublishSavedMessage", mock.Anything)
+
+	for i := 1; i < chathub.DefaultMessageWriterQueue; i++ {
+		assert.True(t, hub.Writer.Submit(models.ChatMessage{RoomID: "room1", Content: "queued"}))
+	}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "overflow"}
+	time.Sleep(50 * time.Millisecond)
+	storageMock.AssertCalled(t, "SaveMessage", mock.MatchedBy(func(msg *models.ChatMessage) bool { return msg.Content == "overflow" }))
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 1)
+}
@@ -3,10 +3,14 @@ package chathub_test
 import (
 	"chatgogo/backend/internal/chathub"
 	"chatgogo/backend/internal/models"
+	"sync"
 )
 
+// MockClient is a client whose messages are received on RecvChannel. Its room is guarded by
+// a mutex, as the hub goroutine sets it while tests read it.
 type MockClient struct {
 	userID      string
+	mu          sync.Mutex
 	roomID      string
 	send        chan models.ChatMessage
 	userType    string
@@ -26,10 +30,14 @@ func (c *MockClient) GetUserID() string {
 }
 
 func (c *MockClient) GetRoomID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.roomID
 }
 
 func (c *MockClient) SetRoomID(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.roomID = roomID
 }
 
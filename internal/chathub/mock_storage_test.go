@@ -1,7 +1,12 @@
 package chathub_test
 
 import (
+	"chatgogo/backend/internal/chathub"
 	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/mock"
@@ -11,34 +16,55 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (m *MockStorage) SaveUser(user *models.User) error {
-	args := m.Called(user)
-	return args.Error(0)
+// fakeSubscription is a storage.RoomSubscription that records the joined rooms and delivers
+// the messages sent to Messages.
+type fakeSubscription struct {
+	mu       sync.Mutex
+	rooms    map[string]bool
+	Messages chan *redis.Message
 }
 
-func (m *MockStorage) SaveUserIfNotExists(telegramID int64) (*models.User, error) {
-	args := m.Called(telegramID)
-	return args.Get(0).(*models.User), args.Error(1)
+func newFakeSubscription() *fakeSubscription {
+	return &fakeSubscription{rooms: make(map[string]bool), Messages: make(chan *redis.Message, 10)}
 }
 
-func (m *MockStorage) IsUserBanned(anonID string) (bool, error) {
-	args := m.Called(anonID)
-	return args.Bool(0), args.Error(1)
+func (f *fakeSubscription) Join(ctx context.Context, roomIDs ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, roomID := range roomIDs {
+		f.rooms[roomID] = true
+	}
+	return nil
 }
 
-func (m *MockStorage) UpdateUserAge(userID string, age int) error {
-	args := m.Called(userID, age)
-	return args.Error(0)
+func (f *fakeSubscription) Leave(ctx context.Context, roomIDs ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, roomID := range roomIDs {
+		delete(f.rooms, roomID)
+	}
+	return nil
 }
 
-func (m *MockStorage) UpdateUserGender(userID string, gender string) error {
-	args := m.Called(userID, gender)
-	return args.Error(0)
+func (f *fakeSubscription) Channel() <-chan *redis.Message { return f.Messages }
+
+func (f *fakeSubscription) Close() error { return nil }
+
+// Joined reports whether the subscription joined a room.
+func (f *fakeSubscription) Joined(roomID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rooms[roomID]
 }
 
-func (m *MockStorage) UpdateUserInterests(userID string, interests []string) error {
-	args := m.Called(userID, interests)
-	return args.Error(0)
+func (m *MockStorage) IsUserBanned(anonID string) (bool, error) {
+	args := m.Called(anonID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) GetBansForUser(userID string) ([]models.Ban, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Ban), args.Error(1)
 }
 
 func (m *MockStorage) SetUserAttribute(userID string, key string, value string) error {
@@ -51,33 +77,23 @@ func (m *MockStorage) GetUserAttribute(userID string, key string) (string, error
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockStorage) DeleteUserAttribute(userID string, key string) error {
-	args := m.Called(userID, key)
-	return args.Error(0)
-}
-
-func (m *MockStorage) SetUserState(userID string, state string) error {
-	args := m.Called(userID, state)
+func (m *MockStorage) SaveRoom(room *models.ChatRoom) error {
+	args := m.Called(room)
 	return args.Error(0)
 }
 
-func (m *MockStorage) GetUserState(userID string) (string, error) {
-	args := m.Called(userID)
-	return args.String(0), args.Error(1)
-}
-
-func (m *MockStorage) ClearUserState(userID string) error {
-	args := m.Called(userID)
-	return args.Error(0)
+func (m *MockStorage) ClaimIdleRooms(activeBefore time.Time, limit int) ([]string, error) {
+	args := m.Called(activeBefore, limit)
+	return args.Get(0).([]string), args.Error(1)
 }
 
-func (m *MockStorage) SaveRoom(room *models.ChatRoom) error {
-	args := m.Called(room)
-	return args.Error(0)
+func (m *MockStorage) TrackActiveRooms() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
 }
 
-func (m *MockStorage) CloseRoom(roomID string) error {
-	args := m.Called(roomID)
+func (m *MockStorage) CloseRoom(roomID, closedBy, reason string) error {
+	args := m.Called(roomID, closedBy, reason)
 	return args.Error(0)
 }
 
@@ -101,26 +117,6 @@ func (m *MockStorage) PublishMessage(roomID string, msg models.ChatMessage) erro
 	return args.Error(0)
 }
 
-func (m *MockStorage) SaveTgMessageID(historyID uint, anonID string, tgMsgID int) error {
-	args := m.Called(historyID, anonID, tgMsgID)
-	return args.Error(0)
-}
-
-func (m *MockStorage) FindPartnerTelegramIDForReply(originalHistoryID uint, currentRecipientAnonID string) (*int, error) {
-	args := m.Called(originalHistoryID, currentRecipientAnonID)
-	return args.Get(0).(*int), args.Error(1)
-}
-
-func (m *MockStorage) FindOriginalHistoryIDByTgID(tgMsgID uint) (*uint, error) {
-	args := m.Called(tgMsgID)
-	return args.Get(0).(*uint), args.Error(1)
-}
-
-func (m *MockStorage) FindOriginalHistoryIDByTgIDMedia(tgMsgID uint) (*uint, error) {
-	args := m.Called(tgMsgID)
-	return args.Get(0).(*uint), args.Error(1)
-}
-
 func (m *MockStorage) FindHistoryByID(id uint) (*models.ChatHistory, error) {
 	args := m.Called(id)
 	return args.Get(0).(*models.ChatHistory), args.Error(1)
@@ -136,6 +132,17 @@ func (m *MockStorage) AddUserToSearchQueue(userID string) error {
 	return args.Error(0)
 }
 
+func (m *MockStorage) SaveSearchRequest(req models.SearchRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetSearchRequest(userID string) (*models.SearchRequest, error) {
+	args := m.Called(userID)
+	req, _ := args.Get(0).(*models.SearchRequest)
+	return req, args.Error(1)
+}
+
 func (m *MockStorage) RemoveUserFromSearchQueue(userID string) error {
 	args := m.Called(userID)
 	return args.Error(0)
@@ -145,23 +152,65 @@ func (m *MockStorage) GetSearchingUsers() ([]string, error) {
 	args := m.Called()
 	return args.Get(0).([]string), args.Error(1)
 }
+
+func (m *MockStorage) AddRematchRequest(fromID, toID string, ttl time.Duration) error {
+	args := m.Called(fromID, toID, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) TakeRematchRequest(fromID, toID string) (bool, error) {
+	args := m.Called(fromID, toID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) RemoveStaleSearchEntries(enqueuedBefore time.Time, limit int) ([]string, error) {
+	args := m.Called(enqueuedBefore, limit)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) ClaimMatch(user1ID, user2ID string) (bool, error) {
+	args := m.Called(user1ID, user2ID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error) {
+	args := m.Called(token, userIDs, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) UnlockMatch(token string, userIDs []string) error {
+	args := m.Called(token, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetSearchQueueStatus(userID string) (int, int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func (m *MockStorage) AcquireMatcherLeadership(instanceID string, ttl time.Duration) (bool, error) {
+	args := m.Called(instanceID, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockStorage) SaveMessage(msg *models.ChatMessage) error {
 	args := m.Called(msg)
 	return args.Error(0)
 }
 
-func (m *MockStorage) GetChatHistory(roomID string) ([]models.ChatHistory, error) {
-	args := m.Called(roomID)
-	return args.Get(0).([]models.ChatHistory), args.Error(1)
+func (m *MockStorage) SaveMessages(msgs []*models.ChatMessage) error {
+	args := m.Called(msgs)
+	return args.Error(0)
 }
-func (m *MockStorage) SubscribeToAllRooms() *redis.PubSub {
-	args := m.Called()
-	return args.Get(0).(*redis.PubSub)
+
+func (m *MockStorage) MarkRead(roomID, userID string, historyID uint) (bool, error) {
+	args := m.Called(roomID, userID, historyID)
+	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockStorage) UpdateUserMediaSpoiler(userID string, value bool) error {
-	args := m.Called(userID, value)
-	return args.Error(0)
+func (m *MockStorage) SubscribeToRooms() storage.RoomSubscription {
+	args := m.Called()
+	return args.Get(0).(storage.RoomSubscription)
 }
 
 func (m *MockStorage) GetUserByID(userID string) (*models.User, error) {
@@ -172,15 +221,251 @@ func (m *MockStorage) GetUserByID(userID string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockStorage) UpdateUserLanguage(telegramID int64, languageCode string) error {
-	args := m.Called(telegramID, languageCode)
+// GetUsersByIDs answers with the expectation set for it, if any. Otherwise the users are
+// loaded one by one through GetUserByID, so that tests set profiles up in one place; users
+// that fail to load are left out.
+func (m *MockStorage) GetUsersByIDs(userIDs []string) ([]models.User, error) {
+	for _, call := range m.ExpectedCalls {
+		if call.Method == "GetUsersByIDs" {
+			args := m.Called(userIDs)
+			if args.Get(0) == nil {
+				return nil, args.Error(1)
+			}
+			return args.Get(0).([]models.User), args.Error(1)
+		}
+	}
+	var users []models.User
+	for _, userID := range userIDs {
+		if user, err := m.GetUserByID(userID); err == nil && user != nil {
+			loaded := *user
+			loaded.ID = userID
+			users = append(users, loaded)
+		}
+	}
+	return users, nil
+}
+
+func (m *MockStorage) GetComplaintsByRoom(roomID string) ([]models.Complaint, error) {
+	args := m.Called(roomID)
+	return args.Get(0).([]models.Complaint), args.Error(1)
+}
+
+func (m *MockStorage) GetUnscoredClosedRooms(limit int) ([]models.ChatRoom, error) {
+	args := m.Called(limit)
+	return args.Get(0).([]models.ChatRoom), args.Error(1)
+}
+
+func (m *MockStorage) GetMessageCountsBySender(roomID string) (map[string]int64, error) {
+	args := m.Called(roomID)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockStorage) UpdateRoomQualityScore(roomID string, score int) (bool, error) {
+	args := m.Called(roomID, score)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) AdjustUserRating(userID string, delta int) error {
+	args := m.Called(userID, delta)
+	return args.Error(0)
+}
+
+func (m *MockStorage) IsMediaBlacklisted(kind, value string) (bool, error) {
+	args := m.Called(kind, value)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) IncrementMediaStrikes(userID string) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) RecordCommandUsage(userID, command string, at time.Time) (int64, error) {
+	args := m.Called(userID, command, at)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) SetUserBotBlocked(userID string, blocked bool) error {
+	args := m.Called(userID, blocked)
+	return args.Error(0)
+}
+
+func (m *MockStorage) IsUserSearching(userID string) (bool, error) {
+	args := m.Called(userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) AddRecentPartners(user1ID, user2ID string, ttl time.Duration) error {
+	args := m.Called(user1ID, user2ID, ttl)
 	return args.Error(0)
 }
 
-func (m *MockStorage) GetUserByTelegramID(telegramID int64) (*models.User, error) {
-	args := m.Called(telegramID)
+func (m *MockStorage) GetRecentPartners(userID string, since time.Time) (map[string]time.Time, error) {
+	args := m.Called(userID, since)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*models.User), args.Error(1)
+	return args.Get(0).(map[string]time.Time), args.Error(1)
+}
+
+func (m *MockStorage) UpdateUserReadReceipts(userID string, value bool) error {
+	args := m.Called(userID, value)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UpdateUserHideTyping(userID string, value bool) error {
+	args := m.Called(userID, value)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UpdateUserHidePresence(userID string, value bool) error {
+	args := m.Called(userID, value)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RefreshPresence(userIDs []string, ttl time.Duration) error {
+	args := m.Called(userIDs, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) IsUserOnline(userID string) (bool, error) {
+	args := m.Called(userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) RegisterClientInstance(instanceID string, userIDs []string, ttl time.Duration) error {
+	args := m.Called(instanceID, userIDs, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UnregisterClientInstance(instanceID, userID string) error {
+	args := m.Called(instanceID, userID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetClientInstance(userID string) (string, error) {
+	args := m.Called(userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) QueueOfflineMessage(userID string, msg models.ChatMessage, limit int, ttl time.Duration) (bool, error) {
+	args := m.Called(userID, msg, limit, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) TakeOfflineMessages(userID string) ([]models.ChatMessage, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.ChatMessage), args.Error(1)
+}
+
+func (m *MockStorage) TakeLinkCode(code string) (string, error) {
+	args := m.Called(code)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) LinkIdentity(webID, userID string, ttl time.Duration) error {
+	args := m.Called(webID, userID, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error {
+	args := m.Called(pseudonyms, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) MoveRoomSeat(roomID, fromUserID, toUserID string) error {
+	args := m.Called(roomID, fromUserID, toUserID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SyncEndedBans(endedAfter, endedBefore time.Time) (int, error) {
+	args := m.Called(endedAfter, endedBefore)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) RecoverUserRatings(step int, quietSince time.Time) (int64, error) {
+	args := m.Called(step, quietSince)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) DeleteHistoryBefore(before time.Time, limit int) (int64, error) {
+	args := m.Called(before, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) PublishSavedMessage(msg models.ChatMessage) error {
+	args := m.Called(msg)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RelayOutbox(savedBefore time.Time, limit int) (int, error) {
+	args := m.Called(savedBefore, limit)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) BlockUser(userID, blockedID string) error {
+	args := m.Called(userID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetUserFiles(userID string) ([]string, []string, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]string), args.Get(1).([]string), args.Error(2)
+}
+
+func (m *MockStorage) DeleteUserData(userID string) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetComplaintsByRoomAndReportedUser(roomID, userID string) ([]models.Complaint, error) {
+	args := m.Called(roomID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Complaint), args.Error(1)
+}
+
+func (m *MockStorage) GetLastClosedRoomForUser(userID string) (*models.ChatRoom, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ChatRoom), args.Error(1)
+}
+
+// expectRoomGuard lets the matcher take the match locks of any users and find them in no
+// room when it opens a room for them.
+func expectRoomGuard(storageMock *MockStorage) {
+	storageMock.On("LockMatch", mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Maybe()
+	storageMock.On("UnlockMatch", mock.Anything, mock.Anything).Return(nil).Maybe()
+	storageMock.On("GetActiveRoomIDForUser", mock.Anything).Return("", nil).Maybe()
+}
+
+// expectHubStartup lets a hub start: it finds no active rooms to recover and joins rooms
+// through a fake subscription.
+func expectHubStartup(storageMock *MockStorage) {
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+}
+
+// newTestHub creates a hub on storageMock that can start, and that records the usage of
+// commands and the pseudonyms of their senders if a test gets to them. Tests add the stubs of
+// the feature they cover.
+func newTestHub(storageMock *MockStorage) *chathub.ManagerService {
+	expectHubStartup(storageMock)
+	storageMock.On("RecordCommandUsage", mock.Anything, mock.Anything, mock.Anything).Return(int64(1), nil).Maybe()
+	storageMock.On("SavePseudonyms", mock.Anything, mock.Anything).Return(nil).Maybe()
+	return chathub.NewManagerService(storageMock)
+}
+
+// addTestClient connects a mock client of a user to a hub that is not running yet, in roomID
+// unless it is empty.
+func addTestClient(hub *chathub.ManagerService, userID, roomID string) *MockClient {
+	client := newMockClient(userID)
+	if roomID != "" {
+		client.SetRoomID(roomID)
+	}
+	hub.Clients[userID] = client
+	return client
 }
@@ -0,0 +1,65 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"log"
+)
+
+// MediaStrikesBeforeReport is the number of blacklisted sticker/GIF attempts within a day
+// after which the sender is automatically reported.
+const MediaStrikesBeforeReport = 3
+
+// isBlacklistedMedia reports whether a sticker or animation message uses a sticker set
+// or file that moderators have blacklisted. Lookup errors fail open so that a Redis
+// outage does not block ordinary media.
+func (m *ManagerService) isBlacklistedMedia(message models.ChatMessage) bool {
+	switch message.Type {
+	case "sticker":
+		blocked, err := m.Storage.IsMediaBlacklisted(storage.MediaBlacklistStickerSet, message.StickerSetName)
+		if err != nil {
+			log.Printf("ERROR: Failed to check sticker set blacklist: %v", err)
+		}
+		if blocked {
+			return true
+		}
+		fallthrough
+	case "animation":
+		blocked, err := m.Storage.IsMediaBlacklisted(storage.MediaBlacklistFile, message.MediaUniqueID)
+		if err != nil {
+			log.Printf("ERROR: Failed to check media blacklist: %v", err)
+		}
+		return blocked
+	}
+	return false
+}
+
+// rejectBlacklistedMedia drops a blacklisted sticker/GIF, informs the sender, and
+// automatically files a complaint once the sender keeps repeating the attempt.
+func (m *ManagerService) rejectBlacklistedMedia(message models.ChatMessage) {
+	log.Printf("Blocked blacklisted %s from user %s", message.Type, message.SenderID)
+
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorContentBlocked, "system_media_blocked"))
+	}
+
+	strikes, err := m.Storage.IncrementMediaStrikes(message.SenderID)
+	if err != nil {
+		log.Printf("ERROR: Failed to record media strike for user %s: %v", message.SenderID, err)
+		return
+	}
+	if strikes != MediaStrikesBeforeReport || message.RoomID == "" {
+		return
+	}
+
+	complaint := &models.Complaint{
+		RoomID:     message.RoomID,
+		ReporterID: "system",
+		SuspectID:  message.SenderID,
+		Reason:     "auto: repeatedly sent blacklisted stickers/GIFs",
+	}
+	if err := m.Storage.SaveComplaint(complaint); err != nil {
+		return
+	}
+	log.Printf("Auto-reported user %s for repeated blacklisted media in room %s", message.SenderID, message.RoomID)
+}
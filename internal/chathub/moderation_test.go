@@ -0,0 +1,64 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestManager_BlacklistedStickerIsNotRelayed(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("IsMediaBlacklisted", storage.MediaBlacklistStickerSet, "bad_pack").Return(true, nil)
+	storageMock.On("IncrementMediaStrikes", "user_A").Return(int64(chathub.MediaStrikesBeforeReport), nil)
+	storageMock.On("SaveComplaint", mock.AnythingOfType("*models.Complaint")).Return(nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "sticker", Content: "file", StickerSetName: "bad_pack"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	storageMock.AssertNotCalled(t, "PublishSavedMessage", mock.Anything)
+	storageMock.AssertCalled(t, "SaveComplaint", mock.MatchedBy(func(c *models.Complaint) bool {
+		return c.SuspectID == "user_A" && c.RoomID == "room1"
+	}))
+
+	select {
+	case msg := <-clientA.RecvChannel:
+		assert.Equal(t, "system_media_blocked", msg.Content)
+	default:
+		t.Error("sender was not informed about the blocked sticker")
+	}
+}
+
+func TestManager_AllowedAnimationIsRelayed(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("IsMediaBlacklisted", storage.MediaBlacklistFile, "gif_1").Return(false, nil)
+	storageMock.On("GetUserAttribute", "user_A", "shadow_banned").Return("", nil)
+	storageMock.On("GetUserAttribute", "user_A", "first_message_reviewed").Return("1", nil)
+	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil)
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "animation", Content: "file", MediaUniqueID: "gif_1"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "PublishSavedMessage", mock.AnythingOfType("models.ChatMessage"))
+}
@@ -0,0 +1,127 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"strings"
+	"time"
+)
+
+// MaxMutedMessages is how many chat messages of a muted partner are held for replay. Older
+// ones are dropped from the replay; they are still in the history.
+const MaxMutedMessages = 100
+
+// unmuteDiscard is the argument of /unmute that drops the held messages instead of
+// replaying them.
+const unmuteDiscard = "discard"
+
+// roomMute is a user's mute of their partner in a room, with the partner's chat messages
+// that were held since.
+type roomMute struct {
+	roomID string
+	held   []models.ChatMessage
+}
+
+// handleMuteCommand processes command_mute: the sender stops receiving the chat messages
+// and typing indicators of their current partner until they unmute. The partner is not told;
+// their messages are saved as usual. Mutes live in the hub of the sender's instance and end
+// with the room.
+func (m *ManagerService) handleMuteCommand(message models.ChatMessage) {
+	client, ok := m.Clients[message.SenderID]
+	if !ok {
+		return
+	}
+	if message.RoomID == "" {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorNotInChat, "system_mute_no_partner"))
+		return
+	}
+	if mute, ok := m.mutes[message.SenderID]; !ok || mute.roomID != message.RoomID {
+		m.mutes[message.SenderID] = &roomMute{roomID: message.RoomID}
+		log.Printf("User %s muted their partner in room %s", message.SenderID, message.RoomID)
+	}
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_mute_on",
+		SenderID: "system",
+	})
+}
+
+// handleUnmuteCommand processes command_unmute: the partner's held messages are relayed to
+// the sender, oldest first, unless the command's argument is "discard" (e.g.
+// "/unmute discard"), and new ones are delivered again.
+func (m *ManagerService) handleUnmuteCommand(message models.ChatMessage) {
+	client, ok := m.Clients[message.SenderID]
+	if !ok {
+		return
+	}
+	mute, muted := m.mutes[message.SenderID]
+	if !muted || mute.roomID != message.RoomID || message.RoomID == "" {
+		delete(m.mutes, message.SenderID)
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_mute_not_muted",
+			SenderID: "system",
+		})
+		return
+	}
+	delete(m.mutes, message.SenderID)
+
+	args := strings.TrimSpace(message.Content)
+	if strings.HasPrefix(args, "/") {
+		_, args, _ = strings.Cut(args, " ")
+	}
+	replay := strings.TrimSpace(args) != unmuteDiscard
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_info",
+		Content:  "system_mute_off",
+		SenderID: "system",
+	})
+	if !replay {
+		log.Printf("User %s unmuted their partner in room %s, discarding %d held messages", message.SenderID, mute.roomID, len(mute.held))
+		return
+	}
+	now := time.Now()
+	for _, held := range mute.held {
+		m.relay(client, held, now)
+	}
+	log.Printf("User %s unmuted their partner in room %s, replaying %d held messages", message.SenderID, mute.roomID, len(mute.held))
+}
+
+// holdMuted reports whether a message for recipientID is kept from them because they muted
+// its sender: chat messages are held for replay, typing indicators are dropped.
+func (m *ManagerService) holdMuted(recipientID string, message models.ChatMessage) bool {
+	mute, ok := m.mutes[recipientID]
+	if !ok || mute.roomID != message.RoomID || message.SenderID == recipientID {
+		return false
+	}
+	if message.Type == "typing" {
+		return true
+	}
+	if !isConversationalMessage(message.Type) {
+		return false
+	}
+	if len(mute.held) == MaxMutedMessages {
+		mute.held = mute.held[1:]
+	}
+	mute.held = append(mute.held, message)
+	return true
+}
+
+// pruneMutes forgets the mutes of rooms this instance no longer receives messages of, with
+// the messages held in them.
+func (m *ManagerService) pruneMutes(rooms map[string]bool) {
+	for userID, mute := range m.mutes {
+		if !rooms[mute.roomID] {
+			delete(m.mutes, userID)
+		}
+	}
+}
+
+// forgetRoomMutes drops the mutes of a closed room.
+func (m *ManagerService) forgetRoomMutes(roomID string) {
+	for userID, mute := range m.mutes {
+		if mute.roomID == roomID {
+			delete(m.mutes, userID)
+		}
+	}
+}
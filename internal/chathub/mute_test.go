@@ -0,0 +1,80 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMuteHub() (*chathub.ManagerService, *MockClient) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true}, nil)
+	return hub, addTestClient(hub, "user_A", "room1")
+}
+
+func TestManager_MuteHoldsPartnerMessagesUntilUnmute(t *testing.T) {
+	hub, clientA := newMuteHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_mute", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "system_mute_on", (<-clientA.RecvChannel).Content)
+
+	hub.PubSubCh <- models.ChatMessage{ID: 1, Type: "text", Content: "calm down", RoomID: "room1", SenderID: "user_B"}
+	hub.PubSubCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	hub.PubSubCh <- models.ChatMessage{ID: 2, Type: "text", Content: "sorry", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, clientA.RecvChannel, "muted messages must not be delivered")
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_unmute", Content: "/unmute", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+	if assert.Len(t, clientA.RecvChannel, 3) {
+		assert.Equal(t, "system_mute_off", (<-clientA.RecvChannel).Content)
+		assert.Equal(t, "calm down", (<-clientA.RecvChannel).Content)
+		assert.Equal(t, "sorry", (<-clientA.RecvChannel).Content)
+	}
+
+	hub.PubSubCh <- models.ChatMessage{ID: 3, Type: "text", Content: "hi again", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "hi again", (<-clientA.RecvChannel).Content)
+}
+
+func TestManager_UnmuteDiscardsHeldMessages(t *testing.T) {
+	hub, clientA := newMuteHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_mute", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+	hub.PubSubCh <- models.ChatMessage{ID: 1, Type: "text", Content: "calm down", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	hub.IncomingCh <- models.ChatMessage{Type: "command_unmute", Content: "/unmute discard", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+
+	if assert.Len(t, clientA.RecvChannel, 2) {
+		assert.Equal(t, "system_mute_on", (<-clientA.RecvChannel).Content)
+		assert.Equal(t, "system_mute_off", (<-clientA.RecvChannel).Content)
+	}
+}
+
+func TestManager_MuteNeedsPartner(t *testing.T) {
+	hub, clientA := newMuteHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_mute", SenderID: "user_A"}
+	time.Sleep(50 * time.Millisecond)
+
+	notice := <-clientA.RecvChannel
+	assert.Equal(t, "system_mute_no_partner", notice.Content)
+	assert.Equal(t, models.ErrorNotInChat, notice.Error.Code)
+}
@@ -0,0 +1,73 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultOfflineMessageTTL is how long chat messages wait for a recipient who was offline
+// when they were relayed.
+const DefaultOfflineMessageTTL = 24 * time.Hour
+
+// MaxOfflineMessages is how many chat messages may wait for an offline recipient. Messages
+// beyond it fail, and their senders are told.
+const MaxOfflineMessages = 100
+
+// queueOffline keeps a chat message relayed to a recipient who has no client on this
+// instance, so that it is delivered when they connect again (see flushOffline). Messages
+// that were not saved to the history are not kept. If the recipient did not drop out here
+// and is online, they are connected to another instance, which relays the message itself.
+func (m *ManagerService) queueOffline(recipientID string, message models.ChatMessage) {
+	if m.OfflineMessageTTL <= 0 || message.ID == 0 || !isConversationalMessage(message.Type) {
+		return
+	}
+	if _, dropped := m.dropped[recipientID]; !dropped {
+		online, err := m.Storage.IsUserOnline(recipientID)
+		if err != nil {
+			log.Printf("ERROR: Failed to load presence of user %s: %v", recipientID, err)
+		} else if online {
+			return
+		}
+	}
+
+	queued, err := m.Storage.QueueOfflineMessage(recipientID, message, MaxOfflineMessages, m.OfflineMessageTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to queue message %d for offline user %s: %v", message.ID, recipientID, err)
+		return
+	}
+	if !queued {
+		log.Printf("WARN: %d messages wait for offline user %s already, dropping message %d.", MaxOfflineMessages, recipientID, message.ID)
+		m.failDelivery(recipientID, message)
+	}
+}
+
+// flushOffline relays the chat messages that were queued for a user while they were offline
+// to the client they connected with, oldest first. Messages of rooms the user is no longer
+// in are dropped, as the partner who sent them has left.
+func (m *ManagerService) flushOffline(client Client) {
+	if m.OfflineMessageTTL <= 0 {
+		return
+	}
+	userID := client.GetUserID()
+	messages, err := m.Storage.TakeOfflineMessages(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load offline messages of user %s: %v", userID, err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	roomID := client.GetRoomID()
+	now := time.Now()
+	delivered := 0
+	for _, message := range messages {
+		if roomID == "" || message.RoomID != roomID {
+			continue
+		}
+		m.relay(client, message, now)
+		delivered++
+	}
+	log.Printf("Relayed %d of %d messages that waited for user %s.", delivered, len(messages), userID)
+}
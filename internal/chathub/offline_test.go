@@ -0,0 +1,74 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newOfflineHub() (*chathub.ManagerService, *MockStorage) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", IsActive: true}, nil)
+	return hub, storageMock
+}
+
+func TestManager_QueuesMessagesForOfflinePartner(t *testing.T) {
+	hub, storageMock := newOfflineHub()
+	storageMock.On("IsUserOnline", "user_A").Return(false, nil)
+	storageMock.On("QueueOfflineMessage", "user_A", mock.Anything, chathub.MaxOfflineMessages, chathub.DefaultOfflineMessageTTL).Return(true, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	message := models.ChatMessage{ID: 7, Type: "text", Content: "hello", RoomID: "room1", SenderID: "user_B"}
+	hub.PubSubCh <- message
+	hub.PubSubCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "QueueOfflineMessage", "user_A", message, chathub.MaxOfflineMessages, chathub.DefaultOfflineMessageTTL)
+	storageMock.AssertNumberOfCalls(t, "QueueOfflineMessage", 1)
+}
+
+func TestManager_LeavesMessagesForPartnerOnlineElsewhere(t *testing.T) {
+	hub, storageMock := newOfflineHub()
+	storageMock.On("IsUserOnline", "user_A").Return(true, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.PubSubCh <- models.ChatMessage{ID: 7, Type: "text", Content: "hello", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "QueueOfflineMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestManager_FlushesOfflineMessagesOnRegister(t *testing.T) {
+	hub, storageMock := newOfflineHub()
+	storageMock.On("TakeOfflineMessages", "user_A").Return([]models.ChatMessage{
+		{ID: 5, Type: "text", Content: "old chat", RoomID: "room0", SenderID: "user_C"},
+		{ID: 7, Type: "text", Content: "hello", RoomID: "room1", SenderID: "user_B"},
+		{ID: 8, Type: "text", Content: "are you there?", RoomID: "room1", SenderID: "user_B"},
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	hub.RegisterCh <- clientA
+	time.Sleep(100 * time.Millisecond)
+
+	if assert.Len(t, clientA.RecvChannel, 2, "only the messages of the current room are delivered") {
+		assert.Equal(t, "hello", (<-clientA.RecvChannel).Content)
+		assert.Equal(t, "are you there?", (<-clientA.RecvChannel).Content)
+	}
+}
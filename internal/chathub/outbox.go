@@ -0,0 +1,141 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultDeliveryRetryDelay is how long a relayed message that could not be handed to its
+// recipient's client waits before it is retried; each further attempt waits twice as long.
+const DefaultDeliveryRetryDelay = 500 * time.Millisecond
+
+// Limits of the outbox of a recipient.
+const (
+	// MaxDeliveryAttempts is how many times the hub tries to hand a relayed message to a
+	// client before it gives up and tells the sender that the message was not delivered.
+	MaxDeliveryAttempts = 5
+	// MaxPendingDeliveries is how many relayed messages may wait for one client. Messages
+	// beyond it fail right away.
+	MaxPendingDeliveries = 100
+)
+
+// Delivery states of relayed messages, as counted by chatgogo_hub_deliveries_total.
+const (
+	// DeliveryDelivered means the message was handed to the recipient's client.
+	DeliveryDelivered = "delivered"
+	// DeliveryDeferred means the client was busy and the message was queued for a retry.
+	DeliveryDeferred = "deferred"
+	// DeliveryFailed means the hub gave up, and the sender was told.
+	DeliveryFailed = "failed"
+)
+
+var (
+	deliveries = metrics.Default.NewCounterVec("chatgogo_hub_deliveries_total",
+		"Relayed messages handed to clients, by delivery state.", "state")
+	deliveriesPending = metrics.Default.NewGauge("chatgogo_hub_deliveries_pending",
+		"Relayed messages waiting in the hub for a busy client.")
+)
+
+// pendingDelivery is a relayed message waiting in the outbox of its recipient.
+type pendingDelivery struct {
+	message     models.ChatMessage
+	attempts    int
+	nextAttempt time.Time
+}
+
+// deliveryRetryDelay returns DeliveryRetryDelay, or DefaultDeliveryRetryDelay if it is not
+// positive.
+func (m *ManagerService) deliveryRetryDelay() time.Duration {
+	if m.DeliveryRetryDelay <= 0 {
+		return DefaultDeliveryRetryDelay
+	}
+	return m.DeliveryRetryDelay
+}
+
+// relay hands a message relayed in a room to the client of its recipient, who is connected
+// to this instance. If the client's send channel is full, or earlier messages still wait
+// for it, the message is queued in the recipient's outbox and retried with backoff by
+// retryDeliveries, so that a slow client neither blocks the hub nor loses messages or gets
+// them out of order.
+func (m *ManagerService) relay(client Client, message models.ChatMessage, now time.Time) {
+	recipientID := client.GetUserID()
+	if len(m.outbox[recipientID]) == 0 && m.offer(client, message, now) {
+		deliveries.Inc(DeliveryDelivered)
+		return
+	}
+	if len(m.outbox[recipientID]) >= MaxPendingDeliveries {
+		log.Printf("WARN: Outbox of user %s is full, dropping %s message.", recipientID, message.Type)
+		m.failDelivery(recipientID, message)
+		return
+	}
+
+	deliveries.Inc(DeliveryDeferred)
+	m.outbox[recipientID] = append(m.outbox[recipientID], &pendingDelivery{
+		message:     message,
+		attempts:    1,
+		nextAttempt: now.Add(m.deliveryRetryDelay()),
+	})
+	m.recordPendingDeliveries()
+}
+
+// retryDeliveries hands the messages waiting in the outboxes to their clients, oldest first,
+// once their backoff is over. When the oldest message of a recipient reaches
+// MaxDeliveryAttempts, or the recipient disconnected, all of their waiting messages fail.
+func (m *ManagerService) retryDeliveries(now time.Time) {
+	for recipientID, queue := range m.outbox {
+		client, connected := m.Clients[recipientID]
+		for len(queue) > 0 && !now.Before(queue[0].nextAttempt) {
+			head := queue[0]
+			if connected && m.offer(client, head.message, now) {
+				deliveries.Inc(DeliveryDelivered)
+				queue = queue[1:]
+				continue
+			}
+			head.attempts++
+			if !connected || head.attempts > MaxDeliveryAttempts {
+				log.Printf("WARN: Giving up delivering %d messages to user %s.", len(queue), recipientID)
+				for _, pending := range queue {
+					m.failDelivery(recipientID, pending.message)
+				}
+				queue = nil
+				break
+			}
+			head.nextAttempt = now.Add(m.deliveryRetryDelay() << (head.attempts - 1))
+			break
+		}
+
+		if len(queue) == 0 {
+			delete(m.outbox, recipientID)
+		} else {
+			m.outbox[recipientID] = queue
+		}
+	}
+	m.recordPendingDeliveries()
+}
+
+// failDelivery tells the sender of a relayed message that it was not delivered.
+func (m *ManagerService) failDelivery(recipientID string, message models.ChatMessage) {
+	deliveries.Inc(DeliveryFailed)
+	m.handleDeliveryFailed(DeliveryFailure(recipientID, message, DeliveryFailedError))
+}
+
+// recordPendingDeliveries reports the number of messages waiting in the outboxes.
+func (m *ManagerService) recordPendingDeliveries() {
+	pending := 0
+	for _, queue := range m.outbox {
+		pending += len(queue)
+	}
+	deliveriesPending.Set(float64(pending))
+}
+
+// trySend hands a message to a client without blocking, and reports whether it was taken.
+func trySend(client Client, message models.ChatMessage) bool {
+	select {
+	case client.GetSendChannel() <- message:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package chathub
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultOutboxRelayInterval is how often saved messages that were not published are
+	// looked for.
+	DefaultOutboxRelayInterval = 5 * time.Second
+	// DefaultOutboxRelayDelay is how long a saved message is left to the hub that saved it to
+	// publish, before it is relayed.
+	DefaultOutboxRelayDelay = 10 * time.Second
+	// DefaultOutboxRelayBatchSize is the maximum number of messages relayed per batch.
+	DefaultOutboxRelayBatchSize = 100
+)
+
+// OutboxStorage is the part of storage.Storage the OutboxRelay uses.
+type OutboxStorage interface {
+	RelayOutbox(savedBefore time.Time, limit int) (int, error)
+}
+
+// OutboxRelay is a background job that publishes the chat messages that were saved but not
+// published, e.g. because Redis was unreachable or the instance that saved them stopped in
+// between, so that every saved message is delivered at least once. It is safe to run on every
+// instance, as instances relaying at the same time skip each other's messages.
+type OutboxRelay struct {
+	// Storage provides access to the data persistence layer.
+	Storage OutboxStorage
+	// Interval is the time between two runs.
+	Interval time.Duration
+	// Delay is the age from which a saved message that was not published is relayed.
+	Delay time.Duration
+	// BatchSize is the maximum number of messages relayed per batch.
+	BatchSize int
+}
+
+// NewOutboxRelay creates and returns a new OutboxRelay with default settings.
+func NewOutboxRelay(s OutboxStorage) *OutboxRelay {
+	return &OutboxRelay{
+		Storage:   s,
+		Interval:  DefaultOutboxRelayInterval,
+		Delay:     DefaultOutboxRelayDelay,
+		BatchSize: DefaultOutboxRelayBatchSize,
+	}
+}
+
+// RelayPending publishes the messages saved more than Delay before now that are still in the
+// outbox, batch by batch, and returns the number of messages published.
+func (r *OutboxRelay) RelayPending(now time.Time) int {
+	relayed := 0
+	for {
+		n, err := r.Storage.RelayOutbox(now.Add(-r.Delay), r.BatchSize)
+		relayed += n
+		if err != nil {
+			log.Printf("ERROR: Failed to relay saved messages: %v", err)
+			break
+		}
+		if n < r.BatchSize {
+			break
+		}
+	}
+
+	if relayed > 0 {
+		log.Printf("Outbox Relay: published %d saved messages that were not published.", relayed)
+	}
+	return relayed
+}
@@ -0,0 +1,37 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestOutboxRelay_RelaysInBatches verifies that messages older than the delay are relayed
+// batch by batch, until a batch is not full.
+func TestOutboxRelay_RelaysInBatches(t *testing.T) {
+	storageMock := new(MockStorage)
+	relay := chathub.NewOutboxRelay(storageMock)
+	relay.BatchSize = 2
+	now := time.Now()
+	cutoff := now.Add(-chathub.DefaultOutboxRelayDelay)
+	storageMock.On("RelayOutbox", cutoff, 2).Return(2, nil).Once()
+	storageMock.On("RelayOutbox", cutoff, 2).Return(0, nil).Once()
+
+	assert.Equal(t, 2, relay.RelayPending(now))
+	storageMock.AssertExpectations(t)
+}
+
+// TestOutboxRelay_StopsOnError verifies that a failed publish ends the run, counting the
+// messages published before it.
+func TestOutboxRelay_StopsOnError(t *testing.T) {
+	storageMock := new(MockStorage)
+	relay := chathub.NewOutboxRelay(storageMock)
+	storageMock.On("RelayOutbox", mock.AnythingOfType("time.Time"), chathub.DefaultOutboxRelayBatchSize).Return(3, errors.New("redis down")).Once()
+
+	assert.Equal(t, 3, relay.RelayPending(time.Now()))
+	storageMock.AssertExpectations(t)
+}
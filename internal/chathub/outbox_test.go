@@ -0,0 +1,96 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newOutboxHub returns a hub relaying room1 between user_A and user_B, whose client has a
+// send channel of one message.
+func newOutboxHub(storageMock *MockStorage) (*chathub.ManagerService, *MockClient) {
+	hub := newTestHub(storageMock)
+	hub.DeliveryRetryDelay = 10 * time.Millisecond
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	clientB := addTestClient(hub, "user_B", "")
+	clientB.RecvChannel = make(chan models.ChatMessage, 1)
+	return hub, clientB
+}
+
+// TestManager_BusyClientGetsMessagesLater verifies that messages relayed to a client whose
+// send channel is full are retried, and delivered in order once it catches up.
+func TestManager_BusyClientGetsMessagesLater(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientB := newOutboxHub(storageMock)
+
+	go hub.Run(context.Background())
+
+	for _, text := range []string{"one", "two", "three"} {
+		hub.PubSubCh <- models.ChatMessage{Type: "text", RoomID: "room1", SenderID: "user_A", Content: text}
+	}
+	var received []string
+	for len(received) < 3 {
+		select {
+		case msg := <-clientB.RecvChannel:
+			received = append(received, msg.Content)
+		case <-time.After(time.Second):
+			t.Fatalf("Only received %v", received)
+		}
+	}
+
+	assert.Equal(t, []string{"one", "two", "three"}, received)
+	storageMock.AssertNotCalled(t, "PublishMessage", mock.Anything, mock.Anything)
+}
+
+// TestManager_UndeliverableMessageNotifiesSender verifies that the sender is told once the hub
+// gives up handing a message to a client that stays busy.
+func TestManager_UndeliverableMessageNotifiesSender(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, _ := newOutboxHub(storageMock)
+	var notice models.ChatMessage
+	storageMock.On("PublishMessage", "room1", mock.AnythingOfType("models.ChatMessage")).
+		Run(func(args mock.Arguments) { notice = args.Get(1).(models.ChatMessage) }).
+		Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	hub.PubSubCh <- models.ChatMessage{Type: "text", RoomID: "room1", SenderID: "user_A", Content: "fills the channel"}
+	hub.PubSubCh <- models.ChatMessage{Type: "text", RoomID: "room1", SenderID: "user_A", Content: "lost"}
+	time.Sleep(500 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, "system_delivery_failed", notice.Type)
+	assert.Equal(t, "system_delivery_failed", notice.Content)
+	assert.Equal(t, "user_B", notice.SenderID)
+}
+
+// TestManager_NonPositiveDeliveryRetryDelayUsesDefault verifies that the hub runs, and still
+// retries deliveries, when DeliveryRetryDelay is not set.
+func TestManager_NonPositiveDeliveryRetryDelayUsesDefault(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientB := newOutboxHub(storageMock)
+	hub.DeliveryRetryDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	for _, text := range []string{"one", "two"} {
+		hub.PubSubCh <- models.ChatMessage{Type: "text", RoomID: "room1", SenderID: "user_A", Content: text}
+	}
+	for _, want := range []string{"one", "two"} {
+		select {
+		case msg := <-clientB.RecvChannel:
+			assert.Equal(t, want, msg.Content)
+		case <-time.After(2 * chathub.DefaultDeliveryRetryDelay):
+			t.Fatalf("%q was not delivered", want)
+		}
+	}
+}
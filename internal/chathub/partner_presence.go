@@ -0,0 +1,168 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultPresenceTTL is how long a user counts as online after their connection was last
+// seen alive. The hub refreshes the online mark of its users on every activity check, so it
+// must be longer than ActivityCheckInterval.
+const DefaultPresenceTTL = 2 * time.Minute
+
+// presenceEvent is the room event with which the hub of a user tells the partner's hub that
+// the user came back online (Content "online") or went away ("away").
+const presenceEvent = "presence"
+
+// presenceStatus is the last known online status of a user in a room.
+type presenceStatus struct {
+	roomID string
+	online bool
+}
+
+// updatePresence marks the users whose connection is alive as online in storage for
+// PresenceTTL, and tells the partners of users whose status changed since the last check.
+// Users who dropped out and may still reconnect count as away, but their partners are told
+// by the reconnect notices instead (see trackDropped).
+func (m *ManagerService) updatePresence(now time.Time) {
+	if m.PresenceTTL <= 0 {
+		return
+	}
+	var online []string
+	for userID, client := range m.Clients {
+		alive := m.connectionAlive(userID, now)
+		if alive {
+			online = append(online, userID)
+		}
+		m.notePresence(userID, client.GetRoomID(), alive)
+	}
+	for userID, roomID := range m.dropped {
+		// The partner was told that the user is reconnecting when they dropped out.
+		m.presenceStatuses[userID] = presenceStatus{roomID: roomID, online: false}
+	}
+	for userID := range m.presenceStatuses {
+		_, connected := m.Clients[userID]
+		if _, dropped := m.dropped[userID]; !connected && !dropped {
+			delete(m.presenceStatuses, userID)
+		}
+	}
+	if err := m.Storage.RefreshPresence(online, m.PresenceTTL); err != nil {
+		log.Printf("ERROR: Failed to refresh presence of %d users: %v", len(online), err)
+	}
+}
+
+// connectionAlive reports whether a registered user counts as online: their connection was
+// seen alive, or they connected or sent something, within PresenceTTL. A Telegram client is
+// registered as long as the user has a chat with the bot, so for transports that do not report
+// their presence only the user's activity counts.
+func (m *ManagerService) connectionAlive(userID string, now time.Time) bool {
+	if seen, ok := m.LastSeen(userID); ok && now.Sub(seen) < m.PresenceTTL {
+		return true
+	}
+	active, ok := m.lastActive[userID]
+	return ok && now.Sub(active) < m.PresenceTTL
+}
+
+// notePresence records the online status of a user in a room and, if it changed, publishes
+// it to the room, unless the user hides their presence (models.User.HidePresence). The first
+// status of a user in a room is not published: both users are online when they are matched.
+func (m *ManagerService) notePresence(userID, roomID string, online bool) {
+	if roomID == "" {
+		delete(m.presenceStatuses, userID)
+		return
+	}
+	previous, known := m.presenceStatuses[userID]
+	m.presenceStatuses[userID] = presenceStatus{roomID: roomID, online: online}
+	if !known || previous.roomID != roomID || previous.online == online {
+		return
+	}
+
+	user, err := m.Storage.GetUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for a presence update: %v", userID, err)
+		return
+	}
+	if user.HidePresence {
+		return
+	}
+	event := models.ChatMessage{
+		Type:     presenceEvent,
+		RoomID:   roomID,
+		SenderID: userID,
+		Content:  presenceContent(online),
+	}
+	if err := m.Storage.PublishMessage(roomID, event); err != nil {
+		log.Printf("ERROR: Failed to publish presence of user %s in room %s: %v", userID, roomID, err)
+	}
+}
+
+// sendPartnerPresence tells a client whether the partner in its room is online, unless the
+// partner hides their presence.
+func (m *ManagerService) sendPartnerPresence(client Client, roomID string) {
+	room, err := m.Storage.GetRoomByID(roomID)
+	if err != nil || !room.IsActive {
+		return
+	}
+	partnerID := partnerOf(room, client.GetUserID())
+	partner, err := m.Storage.GetUserByID(partnerID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for their presence: %v", partnerID, err)
+		return
+	}
+	if partner.HidePresence {
+		return
+	}
+	online, err := m.Storage.IsUserOnline(partnerID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load presence of user %s: %v", partnerID, err)
+		return
+	}
+	m.sendToClient(client, partnerPresenceNotice(presenceContent(online)))
+}
+
+// presenceContent is the content of a presence event for an online status.
+func presenceContent(online bool) string {
+	if online {
+		return "online"
+	}
+	return "away"
+}
+
+// partnerPresenceNotice is the system message that tells a user the status of their partner,
+// which is "online" or "away". It says no more than that the partner was seen recently, so
+// that it does not reveal when exactly they left.
+func partnerPresenceNotice(status string) models.ChatMessage {
+	content := "system_partner_away"
+	if status == "online" {
+		content = "system_partner_online"
+	}
+	return models.ChatMessage{
+		Type:     "system_info",
+		Content:  content,
+		Metadata: status,
+		SenderID: "system",
+	}
+}
+
+// handleHidePresenceSetting processes command_hide_presence, with which a client hides the
+// online status of its user from partners (Content "on") or shows it again (any other
+// content).
+func (m *ManagerService) handleHidePresenceSetting(message models.ChatMessage) {
+	hidden := message.Content == "on"
+	if err := m.Storage.UpdateUserHidePresence(message.SenderID, hidden); err != nil {
+		log.Printf("ERROR: Failed to update presence privacy of user %s: %v", message.SenderID, err)
+		return
+	}
+	content := "system_hide_presence_off"
+	if hidden {
+		content = "system_hide_presence_on"
+	}
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  content,
+			SenderID: "system",
+		})
+	}
+}
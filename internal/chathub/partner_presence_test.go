@@ -0,0 +1,121 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newPartnerPresenceHub returns a hub with a fast activity check where user_A is connected in room1
+// and was just heard from.
+func newPartnerPresenceHub(storageMock *MockStorage, hidden bool) *chathub.ManagerService {
+	hub := newTestHub(storageMock)
+	hub.ActivityCheckInterval = 10 * time.Millisecond
+	hub.PresenceTTL = 50 * time.Millisecond
+	hub.DisconnectGrace = 0
+	storageMock.On("RefreshPresence", mock.Anything, hub.PresenceTTL).Return(nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", HidePresence: hidden}, nil)
+
+	addTestClient(hub, "user_A", "room1")
+	hub.TouchPresence("user_A")
+	return hub
+}
+
+// TestManager_PresenceChangesArePublished verifies that a user whose connection went quiet is
+// published to the room as away once, and as online again when it is heard from.
+func TestManager_PresenceChangesArePublished(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newPartnerPresenceHub(storageMock, false)
+	away := models.ChatMessage{Type: "presence", RoomID: "room1", SenderID: "user_A", Content: "away"}
+	online := models.ChatMessage{Type: "presence", RoomID: "room1", SenderID: "user_A", Content: "online"}
+	storageMock.On("PublishMessage", "room1", away).Return(nil).Once()
+	storageMock.On("PublishMessage", "room1", online).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+
+	time.Sleep(150 * time.Millisecond)
+	hub.TouchPresence("user_A")
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertCalled(t, "RefreshPresence", []string{"user_A"}, hub.PresenceTTL)
+}
+
+// TestManager_PresenceWithoutHeartbeatFollowsActivity verifies that a user whose transport does
+// not report their presence, like Telegram, is away once they have not sent anything for
+// PresenceTTL, and online again when they do.
+func TestManager_PresenceWithoutHeartbeatFollowsActivity(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	hub.ActivityCheckInterval = 20 * time.Millisecond
+	hub.PresenceTTL = 100 * time.Millisecond
+	hub.DisconnectGrace = 0
+	storageMock.On("TakeOfflineMessages", "user_A").Return([]models.ChatMessage(nil), nil)
+	storageMock.On("RefreshPresence", mock.Anything, hub.PresenceTTL).Return(nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A"}, nil)
+	published := make(chan string, 2)
+	for _, status := range []string{"away", "online"} {
+		event := models.ChatMessage{Type: "presence", RoomID: "room1", SenderID: "user_A", Content: status}
+		storageMock.On("PublishMessage", "room1", event).Run(func(args mock.Arguments) {
+			published <- args.Get(1).(models.ChatMessage).Content
+		}).Return(nil).Once()
+	}
+	client := newMockClient("user_A")
+	client.SetRoomID("room1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	hub.RegisterCh <- client
+
+	assert.Equal(t, "away", <-published)
+	hub.IncomingCh <- models.ChatMessage{Type: "command_settings", SenderID: "user_A", RoomID: "room1"}
+	assert.Equal(t, "online", <-published)
+}
+
+// TestManager_HiddenPresenceIsNotPublished verifies that the status of a user who hides their
+// presence is never published.
+func TestManager_HiddenPresenceIsNotPublished(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newPartnerPresenceHub(storageMock, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	time.Sleep(150 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "PublishMessage", mock.Anything, mock.Anything)
+}
+
+// TestManager_PartnerPresenceIsRelayed verifies that a presence event of the partner reaches
+// the user as a system message.
+func TestManager_PartnerPresenceIsRelayed(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	clientB := newMockClient("user_B")
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.PubSubCh <- models.ChatMessage{Type: "presence", RoomID: "room1", SenderID: "user_A", Content: "online"}
+	time.Sleep(50 * time.Millisecond)
+
+	notice := <-clientB.RecvChannel
+	assert.Equal(t, "system_info", notice.Type)
+	assert.Equal(t, "system_partner_online", notice.Content)
+	assert.Equal(t, "online", notice.Metadata)
+}
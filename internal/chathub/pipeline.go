@@ -0,0 +1,141 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// MessageHandler handles an incoming message in the hub goroutine.
+type MessageHandler func(message models.ChatMessage)
+
+// MessageMiddleware wraps the handling of incoming chat messages. It returns a handler that
+// may inspect or change a message and pass it on to next, or drop it by not calling next.
+// Middlewares run in the hub goroutine, so they may use the hub's state but must not block.
+type MessageMiddleware func(next MessageHandler) MessageHandler
+
+// defaultMessageMiddlewares are the steps every chat message goes through before it is
+// saved: the check that its sender is in a chat, the rate limit, the media blacklist, bot
+// detection and shadow bans, the review of the first messages of new accounts, and safe mode
+// with its profanity filter.
+func (m *ManagerService) defaultMessageMiddlewares() []MessageMiddleware {
+	return []MessageMiddleware{
+		m.roomRequiredMiddleware,
+		m.rateLimitMiddleware,
+		m.mediaBlacklistMiddleware,
+		m.honeypotMiddleware,
+		m.firstMessageReviewMiddleware,
+		m.safeModeMiddleware,
+	}
+}
+
+// Use adds middlewares to the handling of chat messages. They run in the order added, after
+// the default ones and before the message is saved and published.
+func (m *ManagerService) Use(middlewares ...MessageMiddleware) {
+	m.middlewares = append(m.middlewares, middlewares...)
+	m.pipeline = nil
+}
+
+// Handle sets the handler of a message type that is a command or a signal for the hub rather
+// than a chat message. Such messages skip the middlewares.
+func (m *ManagerService) Handle(msgType string, handler MessageHandler) {
+	if m.commands == nil {
+		m.commands = make(map[string]MessageHandler)
+	}
+	m.commands[msgType] = handler
+}
+
+// messagePipeline returns the handler of chat messages: the middlewares, then persistence and
+// publishing to the room. It is built on first use after the middlewares changed.
+func (m *ManagerService) messagePipeline() MessageHandler {
+	if m.pipeline == nil {
+		handler := m.publishMessage
+		handler = m.persistMiddleware(handler)
+		for i := len(m.middlewares) - 1; i >= 0; i-- {
+			handler = m.middlewares[i](handler)
+		}
+		m.pipeline = handler
+	}
+	return m.pipeline
+}
+
+// roomRequiredMiddleware drops chat messages sent outside a chat, telling their sender.
+func (m *ManagerService) roomRequiredMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if message.RoomID == "" && isConversationalMessage(message.Type) {
+			if client, ok := m.Clients[message.SenderID]; ok {
+				m.sendToClient(client, models.ErrorMessage(models.ErrorNotInChat, "not_in_chat"))
+			}
+			return
+		}
+		next(message)
+	}
+}
+
+func (m *ManagerService) rateLimitMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.allowMessage(message, time.Now()) {
+			next(message)
+		}
+	}
+}
+
+func (m *ManagerService) mediaBlacklistMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.isBlacklistedMedia(message) {
+			m.rejectBlacklistedMedia(message)
+			return
+		}
+		next(message)
+	}
+}
+
+func (m *ManagerService) honeypotMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.passesHoneypot(message, time.Now()) {
+			next(message)
+		}
+	}
+}
+
+func (m *ManagerService) firstMessageReviewMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.passesFirstMessageReview(message) {
+			next(message)
+		}
+	}
+}
+
+func (m *ManagerService) safeModeMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.applySafeMode(&message) {
+			next(message)
+		}
+	}
+}
+
+// persistMiddleware saves a message to the history, which gives it its ID, and passes it on
+// only if it was saved. With a Writer, the message is handed to it instead, which saves and
+// publishes it in a batch; only if its queue is full is the message saved here.
+func (m *ManagerService) persistMiddleware(next MessageHandler) MessageHandler {
+	return func(message models.ChatMessage) {
+		if m.Writer != nil && m.Writer.Submit(message) {
+			return
+		}
+		if err := m.Storage.SaveMessage(&message); err != nil {
+			log.Printf("ERROR: Failed to save message: %v", err)
+			messageWrites.Inc(writeFailed)
+			return
+		}
+		messageWrites.Inc(writeDirect)
+		next(message)
+	}
+}
+
+// publishMessage publishes a saved message to its room, from where the hubs of the room's
+// users relay it. If it fails, the OutboxRelay publishes the message later.
+func (m *ManagerService) publishMessage(message models.ChatMessage) {
+	if err := m.Storage.PublishSavedMessage(message); err != nil {
+		log.Printf("ERROR: Failed to publish message %d, leaving it to the outbox relay: %v", message.ID, err)
+	}
+}
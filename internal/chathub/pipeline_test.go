@@ -0,0 +1,101 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newPipelineHub() (*chathub.ManagerService, *MockStorage) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil)
+	return hub, storageMock
+}
+
+func TestManager_UseAddsMiddlewares(t *testing.T) {
+	hub, storageMock := newPipelineHub()
+	hub.Use(
+		func(next chathub.MessageHandler) chathub.MessageHandler {
+			return func(message models.ChatMessage) {
+				if strings.Contains(message.Content, "spam") {
+					return
+				}
+				next(message)
+			}
+		},
+		func(next chathub.MessageHandler) chathub.MessageHandler {
+			return func(message models.ChatMessage) {
+				message.Content = strings.ToUpper(message.Content)
+				next(message)
+			}
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "buy spam"}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Content: "hello"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNumberOfCalls(t, "PublishSavedMessage", 1)
+	storageMock.AssertCalled(t, "PublishSavedMessage", mock.MatchedBy(func(message models.ChatMessage) bool {
+		return message.Content == "HELLO"
+	}))
+}
+
+func TestManager_HandleSkipsMiddlewares(t *testing.T) {
+	hub, storageMock := newPipelineHub()
+	handled := make(chan string, 1)
+	hub.Handle("command_ping", func(message models.ChatMessage) {
+		handled <- message.SenderID
+	})
+	hub.Use(func(next chathub.MessageHandler) chathub.MessageHandler {
+		return func(message models.ChatMessage) {
+			t.Errorf("middleware called for %s", message.Type)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_ping", SenderID: "user_A"}
+	select {
+	case senderID := <-handled:
+		assert.Equal(t, "user_A", senderID)
+	case <-time.After(time.Second):
+		t.Fatal("command_ping was not handled")
+	}
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+}
+
+func TestManager_RejectsChatMessagesOutsideChat(t *testing.T) {
+	hub, storageMock := newPipelineHub()
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "text", SenderID: "user_A", Content: "hello?"}
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	if assert.Len(t, clientA.RecvChannel, 1) {
+		notice := <-clientA.RecvChannel
+		assert.Equal(t, "system_error", notice.Type)
+		assert.Equal(t, &models.ChatError{Code: models.ErrorNotInChat, Key: "not_in_chat"}, notice.Error)
+	}
+}
@@ -0,0 +1,145 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultDisconnectGrace is how long a web user who dropped out of a chat has to reconnect,
+// counted from the last sign of life of their connection, before their partner is freed.
+const DefaultDisconnectGrace = 90 * time.Second
+
+// presence records when each user's connection was last heard from. It is updated by the
+// read pumps of WebSocket clients, so it is safe for concurrent use. Records are dropped
+// when their user unregisters, or once a user who dropped out did not reconnect in time.
+type presence struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+func newPresence() *presence {
+	return &presence{lastSeen: make(map[string]time.Time)}
+}
+
+// TouchPresence records that the connection of a user is alive, e.g. because it answered a
+// ping. It is safe to call from any goroutine.
+func (m *ManagerService) TouchPresence(userID string) {
+	m.presence.mu.Lock()
+	defer m.presence.mu.Unlock()
+	m.presence.lastSeen[userID] = time.Now()
+}
+
+// LastSeen returns when the connection of a user was last heard from, if it ever was.
+func (m *ManagerService) LastSeen(userID string) (time.Time, bool) {
+	m.presence.mu.Lock()
+	defer m.presence.mu.Unlock()
+	seen, ok := m.presence.lastSeen[userID]
+	return seen, ok
+}
+
+// forgetPresence drops the presence record of a user.
+func (m *ManagerService) forgetPresence(userID string) {
+	m.presence.mu.Lock()
+	defer m.presence.mu.Unlock()
+	delete(m.presence.lastSeen, userID)
+}
+
+// trackDropped remembers a client that went away while in a room, so that its partner is
+// freed unless the user reconnects within DisconnectGrace. Only clients that report their
+// presence (WebSocket clients) are tracked; others stay in their room as before.
+func (m *ManagerService) trackDropped(client Client) {
+	roomID := client.GetRoomID()
+	if roomID == "" || m.DisconnectGrace <= 0 {
+		return
+	}
+	if _, ok := m.LastSeen(client.GetUserID()); !ok {
+		return
+	}
+	m.dropped[client.GetUserID()] = roomID
+	log.Printf("User %s dropped out of room %s, waiting %v for them to reconnect.", client.GetUserID(), roomID, m.DisconnectGrace)
+	m.publishReconnect(client.GetUserID(), roomID, reconnectDropped)
+}
+
+// resumeDropped puts a user who reconnected within DisconnectGrace back into the room they
+// dropped out of.
+func (m *ManagerService) resumeDropped(client Client) {
+	roomID, ok := m.dropped[client.GetUserID()]
+	if !ok {
+		return
+	}
+	delete(m.dropped, client.GetUserID())
+	if client.GetRoomID() == "" {
+		client.SetRoomID(roomID)
+	}
+	log.Printf("User %s reconnected to room %s.", client.GetUserID(), roomID)
+	if m.PresenceTTL > 0 {
+		// The partner is told below that the user is back, not again as a presence change.
+		m.presenceStatuses[client.GetUserID()] = presenceStatus{roomID: roomID, online: true}
+	}
+	m.publishReconnect(client.GetUserID(), roomID, reconnectResumed)
+}
+
+// reconnectEvent is the room event with which the hub of a web user who dropped out of a chat
+// tells the partner's hub that the user is reconnecting (Content reconnectDropped) or is back
+// (reconnectResumed).
+const reconnectEvent = "reconnect"
+
+// Contents of a reconnectEvent.
+const (
+	reconnectDropped = "dropped"
+	reconnectResumed = "resumed"
+)
+
+// publishReconnect publishes a reconnectEvent of a user to their room, unless the user hides
+// their presence (models.User.HidePresence).
+func (m *ManagerService) publishReconnect(userID, roomID, content string) {
+	user, err := m.Storage.GetUserByID(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for a reconnect notice: %v", userID, err)
+		return
+	}
+	if user.HidePresence {
+		return
+	}
+	event := models.ChatMessage{
+		Type:     reconnectEvent,
+		RoomID:   roomID,
+		SenderID: userID,
+		Content:  content,
+	}
+	if err := m.Storage.PublishMessage(roomID, event); err != nil {
+		log.Printf("ERROR: Failed to publish reconnect of user %s in room %s: %v", userID, roomID, err)
+	}
+}
+
+// partnerReconnectNotice is the system message that tells a user that their partner's
+// connection dropped and the chat waits for them to reconnect (reconnectDropped), or that
+// the partner is back (reconnectResumed).
+func partnerReconnectNotice(content string) models.ChatMessage {
+	notice := "system_partner_reconnecting"
+	if content == reconnectResumed {
+		notice = "system_partner_reconnected"
+	}
+	return models.ChatMessage{
+		Type:     "system_info",
+		Content:  notice,
+		SenderID: "system",
+	}
+}
+
+// checkDropped closes the rooms of users who dropped out and were not heard from for
+// DisconnectGrace, so that their partners, who would otherwise wait for a dead connection
+// forever, are told and can search again.
+func (m *ManagerService) checkDropped(now time.Time) {
+	for userID, roomID := range m.dropped {
+		if seen, ok := m.LastSeen(userID); ok && now.Sub(seen) < m.DisconnectGrace {
+			continue
+		}
+		delete(m.dropped, userID)
+		m.forgetPresence(userID)
+		log.Printf("User %s did not reconnect to room %s, freeing their partner.", userID, roomID)
+		m.closeRoomOfRemovedUser(roomID, userID, "disconnect", "system_partner_disconnected")
+	}
+}
@@ -0,0 +1,134 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newPresenceHub returns a hub where user_A, a web user, and user_B are chatting in room1.
+func newPresenceHub(storageMock *MockStorage) (*chathub.ManagerService, *MockClient, *MockClient) {
+	hub := newTestHub(storageMock)
+	hub.DisconnectGrace = 50 * time.Millisecond
+	hub.ActivityCheckInterval = 10 * time.Millisecond
+	hub.PresenceTTL = 0
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil).Maybe()
+	storageMock.On("PublishMessage", "room1", mock.Anything).Return(nil).Maybe()
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A"}, nil).Maybe()
+
+	clientA := addTestClient(hub, "user_A", "room1")
+	clientB := addTestClient(hub, "user_B", "room1")
+	hub.TouchPresence("user_A")
+	return hub, clientA, clientB
+}
+
+// TestManager_DroppedWebUserFreesPartner verifies that the partner of a web user who dropped
+// out of a chat is told and freed once the user did not reconnect within DisconnectGrace.
+func TestManager_DroppedWebUserFreesPartner(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA, clientB := newPresenceHub(storageMock)
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "disconnect").Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	hub.UnregisterCh <- clientA
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, clientB.RecvChannel, "The partner is not told before the grace period ends")
+
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	notice := <-clientB.RecvChannel
+	assert.Equal(t, "system_partner_disconnected", notice.Type)
+	assert.Equal(t, "", clientB.GetRoomID())
+	_, seen := hub.LastSeen("user_A")
+	assert.False(t, seen)
+}
+
+// TestManager_ReconnectWithinGraceResumesRoom verifies that a web user who reconnects before
+// DisconnectGrace passes is back in their room, and the chat goes on.
+func TestManager_ReconnectWithinGraceResumesRoom(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA, clientB := newPresenceHub(storageMock)
+	hub.DisconnectGrace = time.Hour
+
+	go hub.Run(context.Background())
+
+	hub.UnregisterCh <- clientA
+	time.Sleep(20 * time.Millisecond)
+	reconnected := newMockClient("user_A")
+	hub.RegisterCh <- reconnected
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "room1", reconnected.GetRoomID())
+	assert.Equal(t, "room1", clientB.GetRoomID())
+	assert.Empty(t, clientB.RecvChannel)
+	storageMock.AssertNotCalled(t, "CloseRoom", mock.Anything, mock.Anything, mock.Anything)
+	storageMock.AssertCalled(t, "PublishMessage", "room1", models.ChatMessage{Type: "reconnect", RoomID: "room1", SenderID: "user_A", Content: "dropped"})
+	storageMock.AssertCalled(t, "PublishMessage", "room1", models.ChatMessage{Type: "reconnect", RoomID: "room1", SenderID: "user_A", Content: "resumed"})
+}
+
+// TestManager_PartnerSeesReconnectNotices verifies that the partner of a web user who dropped
+// out is told that the user is reconnecting, and then that they are back.
+func TestManager_PartnerSeesReconnectNotices(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, _, clientB := newPresenceHub(storageMock)
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	go hub.Run(context.Background())
+
+	hub.PubSubCh <- models.ChatMessage{Type: "reconnect", RoomID: "room1", SenderID: "user_A", Content: "dropped"}
+	hub.PubSubCh <- models.ChatMessage{Type: "reconnect", RoomID: "room1", SenderID: "user_A", Content: "resumed"}
+	time.Sleep(50 * time.Millisecond)
+
+	if assert.Len(t, clientB.RecvChannel, 2) {
+		assert.Equal(t, "system_partner_reconnecting", (<-clientB.RecvChannel).Content)
+		assert.Equal(t, "system_partner_reconnected", (<-clientB.RecvChannel).Content)
+	}
+}
+
+// TestManager_HiddenPresenceHasNoReconnectNotices verifies that the partner of a user who
+// hides their presence is not told when the user drops out and comes back.
+func TestManager_HiddenPresenceHasNoReconnectNotices(t *testing.T) {
+	storageMock := new(MockStorage)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", HidePresence: true}, nil)
+	hub, clientA, _ := newPresenceHub(storageMock)
+	hub.DisconnectGrace = time.Hour
+
+	go hub.Run(context.Background())
+
+	hub.UnregisterCh <- clientA
+	time.Sleep(20 * time.Millisecond)
+	hub.RegisterCh <- newMockClient("user_A")
+	time.Sleep(50 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "PublishMessage", "room1", mock.MatchedBy(func(msg models.ChatMessage) bool {
+		return msg.Type == "reconnect"
+	}))
+}
+
+// TestManager_UnregisterForgetsPresence verifies that the presence record of a user who
+// leaves outside of a chat is dropped.
+func TestManager_UnregisterForgetsPresence(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, _, _ := newPresenceHub(storageMock)
+	clientC := newMockClient("user_C")
+	hub.Clients["user_C"] = clientC
+	hub.TouchPresence("user_C")
+
+	go hub.Run(context.Background())
+
+	hub.UnregisterCh <- clientC
+	assert.Eventually(t, func() bool {
+		_, ok := hub.LastSeen("user_C")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
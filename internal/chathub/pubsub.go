@@ -1,36 +1,195 @@
 package chathub
 
 import (
+	"chatgogo/backend/internal/metrics"
 	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
+	"time"
 )
 
+const (
+	// roomSubscriptionBuffer is how many changes of the joined rooms may wait for the
+	// pub/sub listener.
+	roomSubscriptionBuffer = 256
+	// roomLeaveDelay is how long the listener stays in a room after it was joined, even if no
+	// client of this instance is in it. It keeps a room that was just opened from being left by
+	// a sync that started before, and lets late messages of a closed room arrive.
+	roomLeaveDelay = time.Minute
+)
+
+var subscribedRooms = metrics.Default.NewGauge("chatgogo_hub_subscribed_rooms",
+	"Rooms whose Redis Pub/Sub channel the instance is subscribed to.")
+
+// roomSubscriptionChange changes the rooms the pub/sub listener is subscribed to. The listener
+// joins the rooms; if exact is set, it also leaves the rooms not listed.
+type roomSubscriptionChange struct {
+	rooms []string
+	exact bool
+}
+
+// roomListener is the subscription of the pub/sub listener and the rooms it joined. Its
+// changes are serialized, so that rooms can be joined by whoever opens them while the
+// listener reads messages.
+type roomListener struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	sub    storage.RoomSubscription
+	joined map[string]time.Time
+	closed bool
+}
+
+// apply joins and leaves rooms as requested by a change, unless the subscription ended.
+func (l *roomListener) apply(change roomSubscriptionChange, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	applyRoomSubscriptionChange(l.ctx, l.sub, l.joined, change, now)
+}
+
+// close ends the subscription, waiting for a change in progress.
+func (l *roomListener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.sub.Close()
+	subscribedRooms.Set(0)
+}
+
 // StartPubSubListener starts a goroutine that listens for messages on Redis Pub/Sub channels.
 // This allows for horizontal scaling, as messages published in one application instance
-// can be received and processed by all other instances.
-func (m *ManagerService) StartPubSubListener() {
+// can be received and processed by all other instances. The listener only subscribes to the
+// channels of the rooms of this instance's clients (see joinRoom and syncRoomSubscriptions),
+// and unsubscribes when ctx is cancelled.
+func (m *ManagerService) StartPubSubListener(ctx context.Context) {
 	go func() {
-		ctx := context.Background()
-		pubsub := m.Storage.SubscribeToAllRooms()
-		defer pubsub.Close()
+		listener := &roomListener{ctx: ctx, sub: m.Storage.SubscribeToRooms(), joined: make(map[string]time.Time)}
+		m.listener.Store(listener)
+		defer listener.close()
+		defer m.listener.Store(nil)
 
-		if _, err := pubsub.Receive(ctx); err != nil {
-			log.Printf("FATAL ERROR: Failed to subscribe to Redis PubSub: %v", err)
-			return
+		if m.InstanceID != "" {
+			listener.apply(roomSubscriptionChange{rooms: []string{instanceInbox(m.InstanceID)}}, time.Now())
 		}
 
-		ch := pubsub.Channel()
-		log.Println("Redis PubSub listener started, listening to all channels (*).")
+		ch := listener.sub.Channel()
+		log.Println("Redis PubSub listener started, listening to the rooms of this instance.")
 
-		for msg := range ch {
-			var chatMsg models.ChatMessage
-			if err := json.Unmarshal([]byte(msg.Payload), &chatMsg); err != nil {
-				log.Printf("ERROR: Failed to unmarshal Redis message payload: %v | Payload: %s", err, msg.Payload)
-				continue
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var chatMsg models.ChatMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &chatMsg); err != nil {
+					log.Printf("ERROR: Failed to unmarshal Redis message payload: %v | Payload: %s", err, msg.Payload)
+					continue
+				}
+				select {
+				case m.PubSubCh <- chatMsg:
+				case <-ctx.Done():
+					return
+				}
+			case change := <-m.roomSubs:
+				listener.apply(change, time.Now())
+			case <-ctx.Done():
+				log.Println("Redis PubSub listener stopped.")
+				return
 			}
-			m.PubSubCh <- chatMsg
 		}
 	}()
 }
+
+// applyRoomSubscriptionChange joins and leaves rooms as requested by a change, and records in
+// joined when each room was joined.
+func applyRoomSubscriptionChange(ctx context.Context, sub storage.RoomSubscription, joined map[string]time.Time, change roomSubscriptionChange, now time.Time) {
+	keep := make(map[string]bool, len(change.rooms))
+	var join []string
+	for _, roomID := range change.rooms {
+		keep[roomID] = true
+		if _, ok := joined[roomID]; !ok {
+			join = append(join, roomID)
+		}
+	}
+	if err := sub.Join(ctx, join...); err != nil {
+		log.Printf("ERROR: Failed to subscribe to %d rooms: %v", len(join), err)
+	} else {
+		for _, roomID := range join {
+			joined[roomID] = now
+		}
+	}
+
+	if change.exact {
+		var leave []string
+		for roomID, joinedAt := range joined {
+			if !keep[roomID] && now.Sub(joinedAt) >= roomLeaveDelay {
+				leave = append(leave, roomID)
+			}
+		}
+		if err := sub.Leave(ctx, leave...); err != nil {
+			log.Printf("ERROR: Failed to unsubscribe from %d rooms: %v", len(leave), err)
+		} else {
+			for _, roomID := range leave {
+				delete(joined, roomID)
+			}
+		}
+	}
+	subscribedRooms.Set(float64(len(joined)))
+}
+
+// joinRoom subscribes the pub/sub listener to a room a client of this instance entered. It is
+// safe to call from any goroutine and returns once the room is joined, so that the client can
+// be told about the room without missing its first messages. Before the listener started, the
+// room is joined when it does.
+func (m *ManagerService) joinRoom(roomID string) {
+	if roomID == "" {
+		return
+	}
+	if listener := m.listener.Load(); listener != nil {
+		listener.apply(roomSubscriptionChange{rooms: []string{roomID}}, time.Now())
+		return
+	}
+	select {
+	case m.roomSubs <- roomSubscriptionChange{rooms: []string{roomID}}:
+	default:
+		channelOverflows.Inc(overflowRoomSubscriptions)
+		log.Printf("WARN: PubSub listener is behind, room %s is joined on the next sync.", roomID)
+	}
+}
+
+// syncRoomSubscriptions subscribes the pub/sub listener to the rooms of the clients of this
+// instance and of the users who dropped out and may reconnect, and lets it leave the others.
+func (m *ManagerService) syncRoomSubscriptions() {
+	rooms := make(map[string]bool)
+	for _, client := range m.Clients {
+		if roomID := client.GetRoomID(); roomID != "" {
+			rooms[roomID] = true
+		}
+	}
+	for _, roomID := range m.dropped {
+		rooms[roomID] = true
+	}
+	m.pruneRoomMembers(rooms)
+	m.Rooms.prune(rooms)
+	m.pruneMutes(rooms)
+
+	change := roomSubscriptionChange{exact: true}
+	for roomID := range rooms {
+		change.rooms = append(change.rooms, roomID)
+	}
+	if m.InstanceID != "" {
+		change.rooms = append(change.rooms, instanceInbox(m.InstanceID))
+	}
+	select {
+	case m.roomSubs <- change:
+	default:
+		channelOverflows.Inc(overflowRoomSubscriptions)
+		log.Println("WARN: PubSub listener is behind, skipping room subscription sync.")
+	}
+}
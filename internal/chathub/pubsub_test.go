@@ -0,0 +1,79 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManager_JoinsRoomsOfItsClients verifies that the hub subscribes to the room of a client
+// that registers in it, and relays the messages published there to the client.
+func TestManager_JoinsRoomsOfItsClients(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	sub := newFakeSubscription()
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(sub)
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil)
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+
+	go hub.Run(context.Background())
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	hub.RegisterCh <- clientA
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, sub.Joined("room1"))
+	assert.False(t, sub.Joined("room2"))
+
+	payload, err := json.Marshal(models.ChatMessage{Type: "text", Content: "hi", RoomID: "room1", SenderID: "user_B"})
+	require.NoError(t, err)
+	sub.Messages <- &redis.Message{Channel: "chat:room:room1", Payload: string(payload)}
+	time.Sleep(50 * time.Millisecond)
+
+	if assert.Len(t, clientA.RecvChannel, 1) {
+		assert.Equal(t, "hi", (<-clientA.RecvChannel).Content)
+	}
+}
+
+// TestMatcher_JoinsRoomBeforeTellingUsers verifies that the room of a match is joined by the
+// time the users are told about it, so that the first messages in it are not missed.
+func TestMatcher_JoinsRoomBeforeTellingUsers(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	sub := newFakeSubscription()
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(sub)
+	storageMock.On("GetUserByID", mock.Anything).Return(&models.User{}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub.StartPubSubListener(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A"})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.FindMatch(models.SearchRequest{UserID: "user_A"})
+
+	notice := <-clientA.RecvChannel
+	require.Equal(t, "system_match_found", notice.Type)
+	assert.True(t, sub.Joined(notice.RoomID))
+}
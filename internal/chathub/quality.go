@@ -0,0 +1,174 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/events"
+	"chatgogo/backend/internal/models"
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultQualityScoreInterval is how often the scorer looks for newly closed rooms.
+	DefaultQualityScoreInterval = 5 * time.Minute
+	// DefaultQualityScoreBatchSize is the maximum number of rooms scored per run.
+	DefaultQualityScoreBatchSize = 100
+
+	// earlyNextThreshold is the chat duration under which a /next is considered an early skip.
+	earlyNextThreshold = time.Minute
+	// fullDurationThreshold is the chat duration that earns the full duration component.
+	fullDurationThreshold = 10 * time.Minute
+	// highQualityScore is the score from which both participants receive a reputation bonus.
+	highQualityScore = 70
+)
+
+// Score component weights. They add up to 100.
+const (
+	balanceWeight     = 40
+	durationWeight    = 30
+	noEarlyNextWeight = 10
+	noReportsWeight   = 20
+)
+
+// QualityStorage is the part of storage.Storage the QualityScorer uses.
+type QualityStorage interface {
+	AdjustUserRating(userID string, delta int) error
+	GetUnscoredClosedRooms(limit int) ([]models.ChatRoom, error)
+	UpdateRoomQualityScore(roomID string, score int) (bool, error)
+	GetMessageCountsBySender(roomID string) (map[string]int64, error)
+	GetComplaintsByRoom(roomID string) ([]models.Complaint, error)
+}
+
+// QualityScorer is a background job that scores closed rooms by conversation quality.
+// The resulting metric is stored on the ChatRoom and used to adjust the participants' reputation.
+type QualityScorer struct {
+	// Storage provides access to the data persistence layer.
+	Storage QualityStorage
+	// Interval is the time between two scoring runs.
+	Interval time.Duration
+	// BatchSize is the maximum number of rooms scored per run.
+	BatchSize int
+	// Events scales reputation rewards during themed events (e.g., a double-reputation weekend).
+	// It may be nil.
+	Events *events.Schedule
+}
+
+// NewQualityScorer creates and returns a new QualityScorer with default settings.
+func NewQualityScorer(s QualityStorage) *QualityScorer {
+	return &QualityScorer{
+		Storage:   s,
+		Interval:  DefaultQualityScoreInterval,
+		BatchSize: DefaultQualityScoreBatchSize,
+	}
+}
+
+// Run periodically scores closed rooms until ctx is cancelled. This function is intended to
+// be run as a goroutine.
+func (q *QualityScorer) Run(ctx context.Context) {
+	log.Println("Quality Scorer started.")
+	ticker := time.NewTicker(q.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Quality Scorer stopped.")
+			return
+		case <-ticker.C:
+			q.ScoreClosedRooms()
+		}
+	}
+}
+
+// ScoreClosedRooms scores one batch of closed, not yet scored rooms and applies the
+// resulting reputation adjustments. It returns the number of rooms scored.
+func (q *QualityScorer) ScoreClosedRooms() int {
+	rooms, err := q.Storage.GetUnscoredClosedRooms(q.BatchSize)
+	if err != nil {
+		log.Printf("ERROR: Failed to load closed rooms for scoring: %v", err)
+		return 0
+	}
+
+	scored := 0
+	for _, room := range rooms {
+		counts, err := q.Storage.GetMessageCountsBySender(room.RoomID)
+		if err != nil {
+			continue
+		}
+		complaints, err := q.Storage.GetComplaintsByRoom(room.RoomID)
+		if err != nil {
+			continue
+		}
+
+		score := ScoreRoom(room, counts, len(complaints))
+		stored, err := q.Storage.UpdateRoomQualityScore(room.RoomID, score)
+		if err != nil {
+			log.Printf("ERROR: Failed to save quality score for room %s: %v", room.RoomID, err)
+			continue
+		}
+		if !stored {
+			// Another instance scored the room first and adjusted the reputation already.
+			continue
+		}
+		q.adjustReputation(room, score, complaints)
+		scored++
+	}
+
+	if scored > 0 {
+		log.Printf("Quality Scorer: scored %d closed rooms.", scored)
+	}
+	return scored
+}
+
+// adjustReputation rewards both participants of a high-quality chat and penalizes
+// every user who was reported in the room. Rewards are multiplied by the reputation
+// multiplier of the events running when the room was closed.
+func (q *QualityScorer) adjustReputation(room models.ChatRoom, score int, complaints []models.Complaint) {
+	if score >= highQualityScore {
+		reward := q.Events.ReputationMultiplier(room.EndedAt)
+		for _, userID := range []string{room.User1ID, room.User2ID} {
+			if err := q.Storage.AdjustUserRating(userID, reward); err != nil {
+				log.Printf("ERROR: Failed to adjust rating for user %s: %v", userID, err)
+			}
+		}
+	}
+
+	penalized := make(map[string]bool)
+	for _, complaint := range complaints {
+		if penalized[complaint.SuspectID] {
+			continue
+		}
+		penalized[complaint.SuspectID] = true
+		if err := q.Storage.AdjustUserRating(complaint.SuspectID, -1); err != nil {
+			log.Printf("ERROR: Failed to adjust rating for user %s: %v", complaint.SuspectID, err)
+		}
+	}
+}
+
+// ScoreRoom computes a 0-100 quality score for a closed room from the message balance
+// between participants, the chat duration, whether it ended with an early /next, and
+// the number of complaints filed in it.
+func ScoreRoom(room models.ChatRoom, messageCounts map[string]int64, complaints int) int {
+	user1Count := messageCounts[room.User1ID]
+	user2Count := messageCounts[room.User2ID]
+
+	balance := 0.0
+	if user1Count > 0 && user2Count > 0 {
+		balance = float64(min(user1Count, user2Count)) / float64(max(user1Count, user2Count))
+	}
+
+	duration := room.EndedAt.Sub(room.StartedAt)
+	durationFactor := 0.0
+	if duration > 0 {
+		durationFactor = min(float64(duration)/float64(fullDurationThreshold), 1)
+	}
+
+	score := balanceWeight*balance + durationWeight*durationFactor
+	if !(room.CloseReason == "next" && duration < earlyNextThreshold) {
+		score += noEarlyNextWeight
+	}
+	if complaints == 0 {
+		score += noReportsWeight
+	}
+	return int(score + 0.5)
+}
@@ -0,0 +1,136 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/events"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScoreRoom(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name       string
+		room       models.ChatRoom
+		counts     map[string]int64
+		complaints int
+		expected   int
+	}{
+		{
+			name:     "Balanced long chat without reports",
+			room:     models.ChatRoom{User1ID: "a", User2ID: "b", StartedAt: start, EndedAt: start.Add(15 * time.Minute), CloseReason: "stop"},
+			counts:   map[string]int64{"a": 20, "b": 20},
+			expected: 100,
+		},
+		{
+			name:     "One-sided chat",
+			room:     models.ChatRoom{User1ID: "a", User2ID: "b", StartedAt: start, EndedAt: start.Add(5 * time.Minute), CloseReason: "stop"},
+			counts:   map[string]int64{"a": 10},
+			expected: 45,
+		},
+		{
+			name:     "Early next",
+			room:     models.ChatRoom{User1ID: "a", User2ID: "b", StartedAt: start, EndedAt: start.Add(30 * time.Second), CloseReason: "next"},
+			counts:   map[string]int64{"a": 1, "b": 1},
+			expected: 62,
+		},
+		{
+			name:       "Reported chat",
+			room:       models.ChatRoom{User1ID: "a", User2ID: "b", StartedAt: start, EndedAt: start.Add(10 * time.Minute), CloseReason: "stop"},
+			counts:     map[string]int64{"a": 10, "b": 5},
+			complaints: 1,
+			expected:   60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, chathub.ScoreRoom(tt.room, tt.counts, tt.complaints))
+		})
+	}
+}
+
+func TestQualityScorer_ScoreClosedRooms(t *testing.T) {
+	storageMock := new(MockStorage)
+	scorer := chathub.NewQualityScorer(storageMock)
+
+	start := time.Now()
+	room := models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", StartedAt: start, EndedAt: start.Add(20 * time.Minute)}
+	storageMock.On("GetUnscoredClosedRooms", chathub.DefaultQualityScoreBatchSize).Return([]models.ChatRoom{room}, nil)
+	storageMock.On("GetMessageCountsBySender", "room1").Return(map[string]int64{"user_A": 8, "user_B": 10}, nil)
+	storageMock.On("GetComplaintsByRoom", "room1").Return([]models.Complaint{}, nil)
+	storageMock.On("UpdateRoomQualityScore", "room1", 92).Return(true, nil)
+	storageMock.On("AdjustUserRating", "user_A", 1).Return(nil)
+	storageMock.On("AdjustUserRating", "user_B", 1).Return(nil)
+
+	scored := scorer.ScoreClosedRooms()
+
+	assert.Equal(t, 1, scored)
+	storageMock.AssertExpectations(t)
+}
+
+func TestQualityScorer_SkipsRoomScoredElsewhere(t *testing.T) {
+	storageMock := new(MockStorage)
+	scorer := chathub.NewQualityScorer(storageMock)
+
+	start := time.Now()
+	room := models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", StartedAt: start, EndedAt: start.Add(20 * time.Minute)}
+	storageMock.On("GetUnscoredClosedRooms", chathub.DefaultQualityScoreBatchSize).Return([]models.ChatRoom{room}, nil)
+	storageMock.On("GetMessageCountsBySender", "room1").Return(map[string]int64{"user_A": 8, "user_B": 10}, nil)
+	storageMock.On("GetComplaintsByRoom", "room1").Return([]models.Complaint{{SuspectID: "user_B"}}, nil)
+	storageMock.On("UpdateRoomQualityScore", "room1", 72).Return(false, nil)
+
+	scored := scorer.ScoreClosedRooms()
+
+	assert.Zero(t, scored, "a room another instance scored first is not scored again")
+	storageMock.AssertNotCalled(t, "AdjustUserRating", mock.Anything, mock.Anything)
+	storageMock.AssertExpectations(t)
+}
+
+func TestQualityScorer_EventReputationMultiplier(t *testing.T) {
+	storageMock := new(MockStorage)
+	scorer := chathub.NewQualityScorer(storageMock)
+
+	start := time.Now().Add(-time.Hour)
+	scorer.Events = events.NewSchedule("")
+	scorer.Events.SetEvents([]events.Event{{ID: "double_rep", StartsAt: start, EndsAt: start.Add(2 * time.Hour), ReputationMultiplier: 2}})
+
+	room := models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", StartedAt: start, EndedAt: start.Add(20 * time.Minute)}
+	storageMock.On("GetUnscoredClosedRooms", chathub.DefaultQualityScoreBatchSize).Return([]models.ChatRoom{room}, nil)
+	storageMock.On("GetMessageCountsBySender", "room1").Return(map[string]int64{"user_A": 8, "user_B": 10}, nil)
+	storageMock.On("GetComplaintsByRoom", "room1").Return([]models.Complaint{}, nil)
+	storageMock.On("UpdateRoomQualityScore", "room1", 92).Return(true, nil)
+	storageMock.On("AdjustUserRating", "user_A", 2).Return(nil)
+	storageMock.On("AdjustUserRating", "user_B", 2).Return(nil)
+
+	scorer.ScoreClosedRooms()
+
+	storageMock.AssertExpectations(t)
+}
+
+func TestQualityScorer_RunStopsWithContext(t *testing.T) {
+	storageMock := new(MockStorage)
+	storageMock.On("GetUnscoredClosedRooms", chathub.DefaultQualityScoreBatchSize).Return([]models.ChatRoom{}, nil).Maybe()
+	scorer := chathub.NewQualityScorer(storageMock)
+	scorer.Interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scorer.Run(ctx)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+}
@@ -0,0 +1,132 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"sort"
+	"time"
+)
+
+// SearchQueue is an ordered priority queue of users waiting for a match.
+// Entries are kept sorted by enqueue time, so iteration is first-come-first-served,
+// except that boosted requests come before regular ones. Each user's position in the
+// queue can be looked up.
+type SearchQueue struct {
+	// entries holds the queued requests in matching order.
+	entries []*queueEntry
+	// index maps user IDs to their queue entries.
+	index map[string]*queueEntry
+	// seq breaks ties between requests enqueued at the same instant.
+	seq uint64
+}
+
+// queueEntry is a single request in the SearchQueue.
+type queueEntry struct {
+	req models.SearchRequest
+	seq uint64
+}
+
+// NewSearchQueue creates and returns an empty SearchQueue.
+func NewSearchQueue() *SearchQueue {
+	return &SearchQueue{index: make(map[string]*queueEntry)}
+}
+
+// less reports whether entry a must be matched before entry b.
+func (a *queueEntry) less(b *queueEntry) bool {
+	if a.req.Boosted != b.req.Boosted {
+		return a.req.Boosted
+	}
+	if !a.req.EnqueuedAt.Equal(b.req.EnqueuedAt) {
+		return a.req.EnqueuedAt.Before(b.req.EnqueuedAt)
+	}
+	return a.seq < b.seq
+}
+
+// Push adds a request to the queue. A user who is already queued keeps their original
+// enqueue time, while the request itself (e.g., updated search criteria) is replaced.
+// If req.EnqueuedAt is zero, the current time is used.
+func (q *SearchQueue) Push(req models.SearchRequest) {
+	if existing, ok := q.index[req.UserID]; ok {
+		req.EnqueuedAt = existing.req.EnqueuedAt
+		if req.Boosted == existing.req.Boosted {
+			existing.req = req
+			return
+		}
+		// A changed boost moves the user, so the entry is re-inserted.
+		q.Remove(req.UserID)
+		q.insert(&queueEntry{req: req, seq: existing.seq})
+		return
+	}
+
+	if req.EnqueuedAt.IsZero() {
+		req.EnqueuedAt = time.Now()
+	}
+	q.seq++
+	q.insert(&queueEntry{req: req, seq: q.seq})
+}
+
+// insert places an entry at its position in the queue.
+func (q *SearchQueue) insert(entry *queueEntry) {
+	i := sort.Search(len(q.entries), func(i int) bool { return entry.less(q.entries[i]) })
+	q.entries = append(q.entries, nil)
+	copy(q.entries[i+1:], q.entries[i:])
+	q.entries[i] = entry
+	q.index[entry.req.UserID] = entry
+}
+
+// Remove deletes a user from the queue. It is a no-op if the user is not queued.
+func (q *SearchQueue) Remove(userID string) {
+	entry, ok := q.index[userID]
+	if !ok {
+		return
+	}
+	delete(q.index, userID)
+	for i, e := range q.entries {
+		if e == entry {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Get returns the queued request of a user.
+func (q *SearchQueue) Get(userID string) (models.SearchRequest, bool) {
+	entry, ok := q.index[userID]
+	if !ok {
+		return models.SearchRequest{}, false
+	}
+	return entry.req, true
+}
+
+// Contains reports whether a user is queued.
+func (q *SearchQueue) Contains(userID string) bool {
+	_, ok := q.index[userID]
+	return ok
+}
+
+// Len returns the number of queued users.
+func (q *SearchQueue) Len() int {
+	return len(q.entries)
+}
+
+// Position returns the 1-based position of a user in the queue, or 0 if the user is not queued.
+func (q *SearchQueue) Position(userID string) int {
+	entry, ok := q.index[userID]
+	if !ok {
+		return 0
+	}
+	for i, e := range q.entries {
+		if e == entry {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Ordered returns a snapshot of the queued requests in matching order.
+func (q *SearchQueue) Ordered() []models.SearchRequest {
+	reqs := make([]models.SearchRequest, len(q.entries))
+	for i, entry := range q.entries {
+		reqs[i] = entry.req
+	}
+	return reqs
+}
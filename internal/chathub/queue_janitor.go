@@ -0,0 +1,69 @@
+package chathub
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultQueueCleanupInterval is how often the janitor looks for stale queue entries.
+	DefaultQueueCleanupInterval = 5 * time.Minute
+	// DefaultQueueEntryMaxAge is how long a user may stay in the shared search queue before
+	// their entry is considered stale. It should be longer than the search timeout.
+	DefaultQueueEntryMaxAge = time.Hour
+	// DefaultQueueCleanupBatchSize is the maximum number of entries removed per batch.
+	DefaultQueueCleanupBatchSize = 500
+)
+
+// QueueJanitorStorage is the part of storage.Storage the QueueJanitor uses.
+type QueueJanitorStorage interface {
+	RemoveStaleSearchEntries(enqueuedBefore time.Time, limit int) ([]string, error)
+}
+
+// QueueJanitor is a background job that removes stale entries from the shared search queue
+// in Redis: users who never came back after a failed restore, deleted accounts and others
+// whose search was never ended. Entries are stamped with the time the user joined the
+// queue, so the janitor removes the ones older than MaxAge. It is safe to run on every
+// instance, since each entry is removed atomically.
+type QueueJanitor struct {
+	// Storage provides access to the data persistence layer.
+	Storage QueueJanitorStorage
+	// Interval is the time between two cleanups.
+	Interval time.Duration
+	// MaxAge is the age from which a queue entry is removed.
+	MaxAge time.Duration
+	// BatchSize is the maximum number of entries removed per batch.
+	BatchSize int
+}
+
+// NewQueueJanitor creates and returns a new QueueJanitor with default settings.
+func NewQueueJanitor(s QueueJanitorStorage) *QueueJanitor {
+	return &QueueJanitor{
+		Storage:   s,
+		Interval:  DefaultQueueCleanupInterval,
+		MaxAge:    DefaultQueueEntryMaxAge,
+		BatchSize: DefaultQueueCleanupBatchSize,
+	}
+}
+
+// RemoveStaleEntries removes the queue entries that were added more than MaxAge before now,
+// batch by batch, and returns the number of entries removed.
+func (j *QueueJanitor) RemoveStaleEntries(now time.Time) int {
+	removed := 0
+	for {
+		userIDs, err := j.Storage.RemoveStaleSearchEntries(now.Add(-j.MaxAge), j.BatchSize)
+		if err != nil {
+			log.Printf("ERROR: Failed to remove stale search queue entries: %v", err)
+			break
+		}
+		removed += len(userIDs)
+		if len(userIDs) < j.BatchSize {
+			break
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("Queue Janitor: removed %d search queue entries older than %v.", removed, j.MaxAge)
+	}
+	return removed
+}
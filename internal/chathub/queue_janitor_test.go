@@ -0,0 +1,24 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQueueJanitor_RemovesStaleEntriesInBatches verifies that the janitor removes the entries
+// older than MaxAge batch by batch, until a batch is not full.
+func TestQueueJanitor_RemovesStaleEntriesInBatches(t *testing.T) {
+	storageMock := new(MockStorage)
+	janitor := chathub.NewQueueJanitor(storageMock)
+	janitor.BatchSize = 2
+	now := time.Now()
+	cutoff := now.Add(-chathub.DefaultQueueEntryMaxAge)
+	storageMock.On("RemoveStaleSearchEntries", cutoff, 2).Return([]string{"user_A", "user_B"}, nil).Once()
+	storageMock.On("RemoveStaleSearchEntries", cutoff, 2).Return([]string{"user_C"}, nil).Once()
+
+	assert.Equal(t, 3, janitor.RemoveStaleEntries(now))
+	storageMock.AssertExpectations(t)
+}
@@ -0,0 +1,68 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultQueueStatusInterval is how often waiting users are told their place in the queue
+// if it changed.
+const DefaultQueueStatusInterval = time.Minute
+
+// queueStatus loads a user's place in the shared matchmaking queue as a "system_queue_status"
+// message, whose Metadata is "<position>/<total>". It returns false if the user is not
+// searching or the status cannot be loaded.
+func (m *ManagerService) queueStatus(userID string) (models.ChatMessage, bool) {
+	position, total, err := m.Storage.GetSearchQueueStatus(userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load queue status of user %s: %v", userID, err)
+		return models.ChatMessage{}, false
+	}
+	if position == 0 {
+		return models.ChatMessage{}, false
+	}
+	return models.ChatMessage{
+		Type:     "system_queue_status",
+		Content:  "system_queue_status",
+		Metadata: fmt.Sprintf("%d/%d", position, total),
+		SenderID: "system",
+	}, true
+}
+
+// handleStatusCommand answers /status with the sender's place in the matchmaking queue.
+func (m *ManagerService) handleStatusCommand(message models.ChatMessage) {
+	client, ok := m.Clients[message.SenderID]
+	if !ok {
+		return
+	}
+
+	status, searching := m.queueStatus(message.SenderID)
+	if !searching {
+		content := "system_status_not_searching"
+		if message.RoomID != "" {
+			content = "system_status_in_chat"
+		}
+		status = models.ChatMessage{Type: "system_info", Content: content, SenderID: "system"}
+	}
+	m.sendToClient(client, status)
+	if !searching && message.RoomID != "" {
+		m.sendPartnerPresence(client, message.RoomID)
+	}
+}
+
+// pushQueueStatus tells every queued user their place in the queue, unless it did not
+// change since they were last told.
+func (m *MatcherService) pushQueueStatus() {
+	for _, req := range m.Queue.Ordered() {
+		m.Hub.withClient(req.UserID, func(client Client) {
+			status, searching := m.Hub.queueStatus(req.UserID)
+			if !searching || m.lastStatus[req.UserID] == status.Metadata {
+				return
+			}
+			m.lastStatus[req.UserID] = status.Metadata
+			m.Hub.sendToClient(client, status)
+		})
+	}
+}
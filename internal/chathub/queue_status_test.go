@@ -0,0 +1,74 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestManager_StatusCommand verifies that /status reports the place in the queue, or tells
+// users who are not searching what to do instead, and users in a chat whether their partner
+// is online.
+func TestManager_StatusCommand(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetSearchQueueStatus", "user_A").Return(3, 7, nil)
+	storageMock.On("GetSearchQueueStatus", "user_B").Return(0, 7, nil)
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_B", User2ID: "user_C"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("GetUserByID", "user_C").Return(&models.User{ID: "user_C"}, nil)
+	storageMock.On("IsUserOnline", "user_C").Return(false, nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_status", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_status", SenderID: "user_B"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_status", SenderID: "user_B", RoomID: "room1"}
+	time.Sleep(100 * time.Millisecond)
+
+	status := <-clientA.RecvChannel
+	assert.Equal(t, "system_queue_status", status.Type)
+	assert.Equal(t, "3/7", status.Metadata)
+	assert.Equal(t, "system_status_not_searching", (<-clientB.RecvChannel).Content)
+	assert.Equal(t, "system_status_in_chat", (<-clientB.RecvChannel).Content)
+	presence := <-clientB.RecvChannel
+	assert.Equal(t, "system_partner_away", presence.Content)
+	assert.Equal(t, "away", presence.Metadata)
+}
+
+// TestMatcherPushesQueueStatusChanges verifies that waiting users are periodically told
+// their place in the queue, but only when it changed.
+func TestMatcherPushesQueueStatusChanges(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	matcher.MatchScanInterval = time.Hour
+	matcher.QueueStatusInterval = 10 * time.Millisecond
+
+	storageMock.On("GetSearchingUsers").Return([]string{"user_A"}, nil)
+	storageMock.On("GetSearchRequest", "user_A").Return(nil, nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A"}, nil)
+	storageMock.On("GetSearchQueueStatus", "user_A").Return(2, 5, nil).Times(3)
+	storageMock.On("GetSearchQueueStatus", "user_A").Return(1, 4, nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go matcher.Run(context.Background())
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "2/5", (<-clientA.RecvChannel).Metadata)
+	assert.Equal(t, "1/4", (<-clientA.RecvChannel).Metadata)
+	assert.Empty(t, clientA.RecvChannel, "an unchanged status must not be pushed again")
+}
@@ -0,0 +1,142 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestSearchQueueOrdering verifies that the queue is ordered by enqueue time and keeps
+// a re-queued user's original place.
+func TestSearchQueueOrdering(t *testing.T) {
+	q := chathub.NewSearchQueue()
+	base := time.Now()
+
+	q.Push(models.SearchRequest{UserID: "user_C", EnqueuedAt: base.Add(2 * time.Second)})
+	q.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: base})
+	q.Push(models.SearchRequest{UserID: "user_B", EnqueuedAt: base.Add(time.Second)})
+	q.Push(models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female"}})
+
+	var order []string
+	for _, req := range q.Ordered() {
+		order = append(order, req.UserID)
+	}
+	assert.Equal(t, []string{"user_A", "user_B", "user_C"}, order)
+	assert.Equal(t, 1, q.Position("user_A"))
+	assert.Equal(t, 3, q.Position("user_C"))
+
+	reqA, ok := q.Get("user_A")
+	assert.True(t, ok)
+	assert.Equal(t, "female", reqA.Params.TargetGender, "Re-queueing must update the search criteria")
+
+	q.Remove("user_A")
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, 1, q.Position("user_B"))
+	assert.Equal(t, 0, q.Position("user_A"))
+}
+
+// TestMatcherMatchesLongestWaitingFirst verifies first-come-first-served matching when
+// several candidates are equally suitable.
+func TestMatcherMatchesLongestWaitingFirst(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	base := time.Now()
+	for i, id := range []string{"user_old", "user_mid", "user_new"} {
+		hub.Clients[id] = newMockClient(id)
+		matcher.Queue.Push(models.SearchRequest{UserID: id, EnqueuedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	hub.Clients["user_A"] = newMockClient("user_A")
+	reqA := models.SearchRequest{UserID: "user_A", EnqueuedAt: base.Add(time.Minute)}
+	matcher.Queue.Push(reqA)
+
+	matcher.FindMatch(reqA)
+
+	assert.False(t, matcher.Queue.Contains("user_old"), "Longest-waiting user should be matched first")
+	assert.Equal(t, 1, matcher.QueuePosition("user_mid"))
+	assert.Equal(t, 2, matcher.QueuePosition("user_new"))
+}
+
+// TestMatcherExpiresStaleSearches verifies that users waiting longer than SearchTimeout
+// are dequeued and notified, while newer searches are kept.
+func TestMatcherExpiresStaleSearches(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("RemoveUserFromSearchQueue", "user_old").Return(nil).Once()
+
+	now := time.Now()
+	clientOld := newMockClient("user_old")
+	hub.Clients["user_old"] = clientOld
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_old", EnqueuedAt: now.Add(-matcher.SearchTimeout - time.Second)})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_new", EnqueuedAt: now.Add(-time.Minute)})
+
+	expired := matcher.ExpireStaleSearches(now)
+
+	assert.Equal(t, 1, expired)
+	assert.False(t, matcher.Queue.Contains("user_old"))
+	assert.True(t, matcher.Queue.Contains("user_new"))
+	assert.Equal(t, "system_search_timeout", (<-clientOld.RecvChannel).Content)
+	storageMock.AssertExpectations(t)
+}
+
+// TestSearchQueueBoostedFirst verifies that boosted requests are placed ahead of regular
+// ones and that a change of boost moves a queued user.
+func TestSearchQueueBoostedFirst(t *testing.T) {
+	q := chathub.NewSearchQueue()
+	base := time.Now()
+
+	q.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: base})
+	q.Push(models.SearchRequest{UserID: "user_B", EnqueuedAt: base.Add(time.Second)})
+	q.Push(models.SearchRequest{UserID: "user_P", EnqueuedAt: base.Add(2 * time.Second), Boosted: true})
+	assert.Equal(t, 1, q.Position("user_P"))
+	assert.Equal(t, 2, q.Position("user_A"))
+
+	// Losing the boost sends the user back to their place by enqueue time.
+	q.Push(models.SearchRequest{UserID: "user_P"})
+	assert.Equal(t, 3, q.Position("user_P"))
+
+	q.Push(models.SearchRequest{UserID: "user_B", Boosted: true})
+	assert.Equal(t, 1, q.Position("user_B"))
+	assert.Equal(t, 3, q.Len())
+}
+
+// TestMatcherPrefersPremiumCandidates verifies that premium users are matched first when
+// several candidates are equally suitable.
+func TestMatcherPrefersPremiumCandidates(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	premiumUntil := time.Now().Add(24 * time.Hour)
+	storageMock.On("GetUserByID", "user_premium").Return(&models.User{ID: "user_premium", PremiumUntil: &premiumUntil}, nil)
+	storageMock.On("GetUserByID", mock.AnythingOfType("string")).Return(&models.User{}, nil)
+	storageMock.On("AddUserToSearchQueue", mock.AnythingOfType("string")).Return(nil)
+	storageMock.On("SaveRoom", mock.AnythingOfType("*models.ChatRoom")).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	for _, id := range []string{"user_old", "user_premium", "user_A"} {
+		hub.Clients[id] = newMockClient(id)
+		matcher.AddUserToQueue(models.SearchRequest{UserID: id})
+	}
+	assert.Equal(t, 1, matcher.QueuePosition("user_premium"))
+
+	reqA, _ := matcher.Queue.Get("user_A")
+	matcher.FindMatch(reqA)
+
+	assert.False(t, matcher.Queue.Contains("user_premium"), "Premium user should be matched first")
+	assert.True(t, matcher.Queue.Contains("user_old"))
+}
@@ -0,0 +1,58 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"slices"
+	"time"
+)
+
+// Reactions are the emoji a user can react to a partner message with.
+var Reactions = []string{"👍", "❤️"}
+
+// handleReaction processes a "reaction" message, with which a client reacts to the partner
+// message in ReplyToMessageID with the emoji in Content, or takes its reaction back with an
+// empty Content. The reaction is saved to the history and published to the room like a chat
+// message, so that the partner's client shows it on its copy of the message. Reactions to
+// messages that were not sent by the partner in that room are ignored.
+func (m *ManagerService) handleReaction(message models.ChatMessage) {
+	if message.RoomID == "" || message.ReplyToMessageID == nil {
+		return
+	}
+	if message.Content != "" && !slices.Contains(Reactions, message.Content) {
+		log.Printf("Ignoring unsupported reaction %q of user %s", message.Content, message.SenderID)
+		return
+	}
+	room, err := m.Storage.GetRoomByID(message.RoomID)
+	if err != nil {
+		log.Printf("ERROR: Room not found for reaction: %v", err)
+		return
+	}
+	if !room.IsActive || (room.User1ID != message.SenderID && room.User2ID != message.SenderID) {
+		return
+	}
+
+	history, err := m.Storage.FindHistoryByID(*message.ReplyToMessageID)
+	if err != nil || history == nil || history.RoomID != room.RoomID || history.SenderID != partnerOf(room, message.SenderID) {
+		log.Printf("Ignoring reaction of user %s to message %d not sent to them in room %s", message.SenderID, *message.ReplyToMessageID, room.RoomID)
+		return
+	}
+	if !m.allowMessage(message, time.Now()) {
+		return
+	}
+
+	reaction := models.ChatMessage{
+		Type:             "reaction",
+		RoomID:           room.RoomID,
+		SenderID:         message.SenderID,
+		Content:          message.Content,
+		ReplyToMessageID: message.ReplyToMessageID,
+	}
+	if err := m.Storage.SaveMessage(&reaction); err != nil {
+		log.Printf("ERROR: Failed to save reaction: %v", err)
+		return
+	}
+	if err := m.Storage.PublishSavedMessage(reaction); err != nil {
+		log.Printf("ERROR: Failed to publish reaction in room %s, leaving it to the outbox relay: %v", room.RoomID, err)
+	}
+}
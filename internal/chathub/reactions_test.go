@@ -0,0 +1,66 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// newReactionHub returns a hub where user_A and user_B chat in room1 and user_B sent history
+// entry 7.
+func newReactionHub(storageMock *MockStorage) *chathub.ManagerService {
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	history := &models.ChatHistory{Model: gorm.Model{ID: 7}, RoomID: "room1", SenderID: "user_B"}
+	storageMock.On("FindHistoryByID", uint(7)).Return(history, nil)
+	return hub
+}
+
+// TestManager_ReactionIsSavedAndPublished verifies that a reaction to a partner message is
+// saved and published to the room, and that taking it back is relayed as an empty reaction.
+func TestManager_ReactionIsSavedAndPublished(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newReactionHub(storageMock)
+	original := uint(7)
+	like := models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_A", Content: "👍", ReplyToMessageID: &original}
+	undo := models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_A", ReplyToMessageID: &original}
+	storageMock.On("SaveMessage", &like).Return(nil).Once()
+	storageMock.On("PublishSavedMessage", like).Return(nil).Once()
+	storageMock.On("SaveMessage", &undo).Return(nil).Once()
+	storageMock.On("PublishSavedMessage", undo).Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- like
+	hub.IncomingCh <- undo
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+}
+
+// TestManager_ReactionIsValidated verifies that reactions with an unsupported emoji, to the
+// user's own message or to an unknown message are dropped.
+func TestManager_ReactionIsValidated(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newReactionHub(storageMock)
+	storageMock.On("FindHistoryByID", uint(8)).Return((*models.ChatHistory)(nil), nil)
+	original, unknown := uint(7), uint(8)
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_A", Content: "💩", ReplyToMessageID: &original}
+	hub.IncomingCh <- models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_B", Content: "👍", ReplyToMessageID: &original}
+	hub.IncomingCh <- models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_A", Content: "👍", ReplyToMessageID: &unknown}
+	hub.IncomingCh <- models.ChatMessage{Type: "reaction", RoomID: "room1", SenderID: "user_A", Content: "👍"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	storageMock.AssertNotCalled(t, "PublishSavedMessage", mock.Anything)
+}
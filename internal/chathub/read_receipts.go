@@ -0,0 +1,87 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+)
+
+// handleReadReceipt processes a "read" message, sent by a client whose user has seen the
+// partner's messages up to the history entry in message.ID. The read position of the user is
+// recorded, and if it moved forward a system_seen event with that history ID is relayed to
+// the partner. Receipts are only relayed when both users opted in (models.User.ReadReceipts),
+// so that no one sees receipts they do not send.
+func (m *ManagerService) handleReadReceipt(message models.ChatMessage) {
+	if message.RoomID == "" || message.ID == 0 {
+		return
+	}
+	room, err := m.Storage.GetRoomByID(message.RoomID)
+	if err != nil {
+		log.Printf("ERROR: Room not found for read receipt: %v", err)
+		return
+	}
+	if !room.IsActive || (room.User1ID != message.SenderID && room.User2ID != message.SenderID) {
+		return
+	}
+	partnerID := partnerOf(room, message.SenderID)
+
+	history, err := m.Storage.FindHistoryByID(message.ID)
+	if err != nil || history == nil || history.RoomID != room.RoomID || history.SenderID != partnerID {
+		log.Printf("Ignoring read receipt of user %s for message %d not sent to them in room %s", message.SenderID, message.ID, room.RoomID)
+		return
+	}
+
+	moved, err := m.Storage.MarkRead(room.RoomID, message.SenderID, message.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to record read receipt of user %s in room %s: %v", message.SenderID, room.RoomID, err)
+		return
+	}
+	if !moved || !m.exchangeReadReceipts(message.SenderID, partnerID) {
+		return
+	}
+
+	seen := models.ChatMessage{
+		ID:       message.ID,
+		Type:     "system_seen",
+		RoomID:   room.RoomID,
+		SenderID: message.SenderID,
+	}
+	if err := m.Storage.PublishMessage(room.RoomID, seen); err != nil {
+		log.Printf("ERROR: Failed to publish read receipt in room %s: %v", room.RoomID, err)
+	}
+}
+
+// exchangeReadReceipts reports whether both users opted into read receipts.
+func (m *ManagerService) exchangeReadReceipts(user1ID, user2ID string) bool {
+	for _, userID := range []string{user1ID, user2ID} {
+		user, err := m.Storage.GetUserByID(userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to load user %s for a read receipt: %v", userID, err)
+			return false
+		}
+		if !user.ReadReceipts {
+			return false
+		}
+	}
+	return true
+}
+
+// handleReadReceiptsSetting processes command_read_receipts, with which a client turns the
+// read receipts of its user on (Content "on") or off (any other content).
+func (m *ManagerService) handleReadReceiptsSetting(message models.ChatMessage) {
+	enabled := message.Content == "on"
+	if err := m.Storage.UpdateUserReadReceipts(message.SenderID, enabled); err != nil {
+		log.Printf("ERROR: Failed to update read receipts of user %s: %v", message.SenderID, err)
+		return
+	}
+	content := "system_read_receipts_off"
+	if enabled {
+		content = "system_read_receipts_on"
+	}
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  content,
+			SenderID: "system",
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// newReadReceiptHub returns a hub where user_A and user_B chat in room1 and user_B sent
+// history entry 7, with the given read receipt opt-in of user_B.
+func newReadReceiptHub(storageMock *MockStorage, partnerOptedIn bool) *chathub.ManagerService {
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	history := &models.ChatHistory{Model: gorm.Model{ID: 7}, RoomID: "room1", SenderID: "user_B"}
+	storageMock.On("FindHistoryByID", uint(7)).Return(history, nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", ReadReceipts: true}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", ReadReceipts: partnerOptedIn}, nil)
+	return hub
+}
+
+// TestManager_ReadReceiptIsRelayedOnce verifies that a read receipt is published to the room
+// as a system_seen event once, and not again for an older or repeated position.
+func TestManager_ReadReceiptIsRelayedOnce(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newReadReceiptHub(storageMock, true)
+	storageMock.On("MarkRead", "room1", "user_A", uint(7)).Return(true, nil).Once()
+	storageMock.On("MarkRead", "room1", "user_A", uint(7)).Return(false, nil).Once()
+	seen := models.ChatMessage{ID: 7, Type: "system_seen", RoomID: "room1", SenderID: "user_A"}
+	storageMock.On("PublishMessage", "room1", seen).Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	for i := 0; i < 2; i++ {
+		hub.IncomingCh <- models.ChatMessage{ID: 7, Type: "read", RoomID: "room1", SenderID: "user_A"}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+}
+
+// TestManager_ReadReceiptNeedsBothUsers verifies that the read position is recorded but not
+// relayed when the partner did not opt into read receipts, and that receipts for messages the
+// user did not receive are ignored.
+func TestManager_ReadReceiptNeedsBothUsers(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newReadReceiptHub(storageMock, false)
+	storageMock.On("MarkRead", "room1", "user_A", uint(7)).Return(true, nil).Once()
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{ID: 7, Type: "read", RoomID: "room1", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{ID: 7, Type: "read", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	storageMock.AssertNotCalled(t, "MarkRead", "room1", "user_B", mock.Anything)
+	storageMock.AssertNotCalled(t, "PublishMessage", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,92 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+)
+
+// DefaultRelaxAfter is how long a user with search filters waits before each filter
+// relaxation step.
+const DefaultRelaxAfter = 2 * time.Minute
+
+// relaxNotices are the messages telling a user which relaxation step was applied, by level.
+var relaxNotices = map[int]string{
+	models.RelaxAgeWidened:    "system_filters_relaxed_age_widened",
+	models.RelaxAgeDropped:    "system_filters_relaxed_age_any",
+	models.RelaxGenderDropped: "system_filters_relaxed_gender_any",
+	models.RelaxRegionDropped: "system_filters_relaxed_region_any",
+}
+
+// RelaxFilters loosens the search filters of users who have waited without a match: after
+// every RelaxAfter, the next step of models.SearchParams.Relax is applied, FloodedRelaxSpeedup
+// times as often in flooded segments (see BalanceLiquidity). The user is told
+// about each step that changes their filters, so they can keep their original filters
+// instead. Strict requests, and requests with nothing left to relax, are never relaxed. It
+// returns the number of relaxed requests.
+func (m *MatcherService) RelaxFilters(now time.Time) int {
+	if m.RelaxAfter <= 0 {
+		return 0
+	}
+
+	relaxed := 0
+	for _, req := range m.Queue.Ordered() {
+		if req.Strict || req.EffectiveParams() == req.Params.Relax(models.MaxRelaxLevel) {
+			continue
+		}
+		relaxAfter := m.RelaxAfter
+		if m.isFlooded(req) {
+			relaxAfter /= FloodedRelaxSpeedup
+		}
+		target := min(int(now.Sub(req.EnqueuedAt)/relaxAfter), models.MaxRelaxLevel)
+		if target <= req.RelaxLevel {
+			continue
+		}
+
+		for level := req.RelaxLevel + 1; level <= target; level++ {
+			if req.Params.Relax(level) != req.Params.Relax(level-1) {
+				m.notifyRelaxed(req.UserID, relaxNotices[level])
+			}
+		}
+		req.RelaxLevel = target
+		m.Queue.Push(req)
+		log.Printf("Relaxed search filters of user %s to level %d.", req.UserID, target)
+		relaxed++
+	}
+	return relaxed
+}
+
+// notifyRelaxed tells a searching user that their filters were relaxed.
+func (m *MatcherService) notifyRelaxed(userID, notice string) {
+	m.Hub.withClient(userID, func(client Client) {
+		m.Hub.sendToClient(client, models.ChatMessage{
+			Type:     "system_filters_relaxed",
+			Content:  notice,
+			SenderID: "system",
+		})
+	})
+}
+
+// handleKeepFilters restores the original search filters of a searching user and stops
+// relaxing them. It does nothing if the user is not searching.
+func (m *ManagerService) handleKeepFilters(message models.ChatMessage) {
+	searching, err := m.Storage.IsUserSearching(message.SenderID)
+	if err != nil {
+		log.Printf("ERROR: Failed to check search status of user %s: %v", message.SenderID, err)
+		return
+	}
+	if !searching {
+		return
+	}
+
+	if !m.requestMatch(models.SearchRequest{UserID: message.SenderID, Strict: true}) {
+		return
+	}
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_filters_kept",
+			SenderID: "system",
+		})
+	}
+}
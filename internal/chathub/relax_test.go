@@ -0,0 +1,89 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMatcherRelaxFilters verifies that filters are relaxed step by step while a user waits,
+// that only steps changing the filters are announced, and that strict requests are kept.
+func TestMatcherRelaxFilters(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	start := time.Now()
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", EnqueuedAt: start,
+		Params: models.SearchParams{TargetGender: "female", TargetAgeMin: 20, TargetAgeMax: 30}})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B", EnqueuedAt: start,
+		Params: models.SearchParams{TargetGender: "male"}, Strict: true})
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_C", EnqueuedAt: start})
+
+	assert.Equal(t, 0, matcher.RelaxFilters(start.Add(time.Minute)))
+
+	assert.Equal(t, 1, matcher.RelaxFilters(start.Add(chathub.DefaultRelaxAfter)))
+	reqA, _ := matcher.Queue.Get("user_A")
+	assert.Equal(t, models.SearchParams{TargetGender: "female", TargetAgeMin: 18, TargetAgeMax: 35}, reqA.EffectiveParams())
+	assert.Equal(t, "system_filters_relaxed_age_widened", (<-clientA.RecvChannel).Content)
+
+	// Both remaining steps are due at once.
+	assert.Equal(t, 1, matcher.RelaxFilters(start.Add(3*chathub.DefaultRelaxAfter)))
+	reqA, _ = matcher.Queue.Get("user_A")
+	assert.Equal(t, models.SearchParams{TargetAgeMin: models.AdultAge}, reqA.EffectiveParams())
+	assert.Equal(t, "system_filters_relaxed_age_any", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_filters_relaxed_gender_any", (<-clientA.RecvChannel).Content)
+
+	reqB, _ := matcher.Queue.Get("user_B")
+	assert.Equal(t, 0, reqB.RelaxLevel)
+	assert.Equal(t, 0, matcher.RelaxFilters(start.Add(time.Hour)))
+}
+
+// TestManager_KeepFilters verifies that keeping filters re-queues a searching user as strict
+// and is ignored for users who are not searching.
+func TestManager_KeepFilters(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("IsUserSearching", "user_A").Return(true, nil)
+	storageMock.On("IsUserSearching", "user_B").Return(false, nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_keep_filters", SenderID: "user_A"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_keep_filters", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, models.SearchRequest{UserID: "user_A", Strict: true}, <-hub.MatchRequestCh)
+	assert.Empty(t, hub.MatchRequestCh)
+	assert.Equal(t, "system_filters_kept", (<-clientA.RecvChannel).Content)
+}
+
+// TestAddUserToQueueStrictKeepsCriteria verifies that a strict request for a queued user
+// restores the criteria they searched with and resets relaxation.
+func TestAddUserToQueueStrictKeepsCriteria(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+	storageMock.On("AddUserToSearchQueue", "user_A").Return(nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", PreferredGender: "male"}, nil)
+
+	params := models.SearchParams{TargetGender: "female"}
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_A", Params: params, RelaxLevel: models.MaxRelaxLevel})
+
+	matcher.AddUserToQueue(models.SearchRequest{UserID: "user_A", Strict: true})
+
+	req, _ := matcher.Queue.Get("user_A")
+	assert.Equal(t, params, req.EffectiveParams())
+	assert.True(t, req.Strict)
+}
@@ -0,0 +1,107 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"strings"
+)
+
+// handleReportCommand files a complaint against the sender's current partner and asks the
+// reporter whether to end the chat or continue it (system_report_choice). The partner is not
+// told about the report. Any text after /report is kept as the reason. The room must be one
+// of the sender's according to storage, and a partner is reported once per room.
+func (m *ManagerService) handleReportCommand(message models.ChatMessage) {
+	client, ok := m.Clients[message.SenderID]
+	if message.RoomID == "" {
+		if ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorNotInChat, "system_report_no_partner"))
+		}
+		return
+	}
+
+	room, err := m.Storage.GetRoomByID(message.RoomID)
+	if err != nil {
+		log.Printf("ERROR: Room not found for report command: %v", err)
+		return
+	}
+	if room.User1ID != message.SenderID && room.User2ID != message.SenderID {
+		log.Printf("WARNING: User %s tried to report in room %s, which is not theirs.", message.SenderID, room.RoomID)
+		if ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorNotInChat, "system_report_no_partner"))
+		}
+		return
+	}
+	suspectID := partnerOf(room, message.SenderID)
+	if m.reportedBefore(room.RoomID, message.SenderID, suspectID) {
+		if ok {
+			m.sendToClient(client, models.ChatMessage{
+				Type:     "system_report_choice",
+				Content:  "system_report_already_filed",
+				RoomID:   room.RoomID,
+				SenderID: "system",
+			})
+		}
+		return
+	}
+	_, reason, _ := strings.Cut(message.Content, " ")
+	complaint := &models.Complaint{
+		RoomID:     room.RoomID,
+		ReporterID: message.SenderID,
+		SuspectID:  suspectID,
+		Reason:     strings.TrimSpace(reason),
+	}
+	if err := m.Storage.SaveComplaint(complaint); err != nil {
+		log.Printf("ERROR: Failed to save complaint of user %s in room %s: %v", message.SenderID, room.RoomID, err)
+		if ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorInternal, "system_report_failed"))
+		}
+		return
+	}
+	log.Printf("User %s reported user %s in room %s", complaint.ReporterID, complaint.SuspectID, room.RoomID)
+
+	if ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_report_choice",
+			Content:  "system_report_filed",
+			RoomID:   room.RoomID,
+			SenderID: "system",
+		})
+	}
+}
+
+// reportedBefore reports whether the reporter filed a complaint against the suspect in the
+// room already. If the complaints cannot be loaded, the report is filed again.
+func (m *ManagerService) reportedBefore(roomID, reporterID, suspectID string) bool {
+	complaints, err := m.Storage.GetComplaintsByRoomAndReportedUser(roomID, suspectID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load the complaints against user %s in room %s: %v", suspectID, roomID, err)
+		return false
+	}
+	for _, complaint := range complaints {
+		if complaint.ReporterID == reporterID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReportEnd ends the chat of a reporter who chose not to continue it, and puts them
+// back into the search queue. Unlike /next, it does not count towards the skip limit, and the
+// reported partner is not re-queued. It does nothing once the chat is over.
+func (m *ManagerService) handleReportEnd(message models.ChatMessage) {
+	if message.RoomID == "" {
+		return
+	}
+	m.handleStopCommand(message)
+}
+
+// handleReportContinue confirms to a reporter that their chat goes on.
+func (m *ManagerService) handleReportContinue(message models.ChatMessage) {
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  "system_report_continue",
+			SenderID: "system",
+		})
+	}
+}
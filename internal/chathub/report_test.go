@@ -0,0 +1,103 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestManager_ReportAsksToEndOrContinue verifies that /report files a complaint against the
+// partner without telling them, and asks the reporter whether to end the chat.
+func TestManager_ReportAsksToEndOrContinue(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("GetComplaintsByRoomAndReportedUser", "room1", "user_B").Return([]models.Complaint{{ReporterID: "user_C"}}, nil)
+	var complaint *models.Complaint
+	storageMock.On("SaveComplaint", mock.AnythingOfType("*models.Complaint")).
+		Run(func(args mock.Arguments) { complaint = args.Get(0).(*models.Complaint) }).
+		Return(nil).Once()
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_report", SenderID: "user_A", RoomID: "room1", Content: "/report insults"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_report_continue", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, &models.Complaint{RoomID: "room1", ReporterID: "user_A", SuspectID: "user_B", Reason: "insults"}, complaint)
+	choice := <-clientA.RecvChannel
+	assert.Equal(t, "system_report_choice", choice.Type)
+	assert.Equal(t, "system_report_filed", choice.Content)
+	assert.Equal(t, "room1", choice.RoomID)
+	assert.Equal(t, "system_report_continue", (<-clientA.RecvChannel).Content)
+	assert.Empty(t, clientB.RecvChannel, "The reported partner is not told")
+	storageMock.AssertNotCalled(t, "CloseRoom", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestManager_ReportIsFiledOncePerRoom verifies that a second /report against the same
+// partner files no second complaint, and that a report into a room of other users is refused.
+func TestManager_ReportIsFiledOncePerRoom(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}, nil)
+	storageMock.On("GetRoomByID", "room2").Return(&models.ChatRoom{RoomID: "room2", IsActive: true, User1ID: "user_B", User2ID: "user_C"}, nil)
+	storageMock.On("GetComplaintsByRoomAndReportedUser", "room1", "user_B").Return([]models.Complaint{{ReporterID: "user_A", SuspectID: "user_B"}}, nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_report", SenderID: "user_A", RoomID: "room1", Content: "/report again"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_report", SenderID: "user_A", RoomID: "room2", Content: "/report"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "SaveComplaint", mock.Anything)
+	choice := <-clientA.RecvChannel
+	assert.Equal(t, "system_report_choice", choice.Type)
+	assert.Equal(t, "system_report_already_filed", choice.Content)
+	assert.Equal(t, "system_report_no_partner", (<-clientA.RecvChannel).Content)
+}
+
+// TestManager_ReportEndClosesRoomAndRequeuesReporter verifies that a reporter who ends the
+// chat is searching again, without counting towards the skip limit.
+func TestManager_ReportEndClosesRoomAndRequeuesReporter(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	hub.SkipLimit = 1
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "report_end").Return(nil)
+	storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil)
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	go hub.Run(context.Background())
+
+	for i := 0; i < 2; i++ {
+		hub.IncomingCh <- models.ChatMessage{Type: "command_report_end", SenderID: "user_A", RoomID: "room1"}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, hub.MatchRequestCh, 2)
+	assert.Equal(t, "user_A", (<-hub.MatchRequestCh).UserID)
+	assert.Equal(t, "system_match_stop_partner", (<-clientB.RecvChannel).Content)
+	assert.Equal(t, "system_match_stop_self", (<-clientA.RecvChannel).Content)
+}
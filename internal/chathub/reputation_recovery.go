@@ -0,0 +1,59 @@
+package chathub
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultReputationRecoveryInterval is how often negative ratings recover.
+	DefaultReputationRecoveryInterval = 24 * time.Hour
+	// DefaultReputationRecoveryStep is how much a negative rating recovers per interval.
+	DefaultReputationRecoveryStep = 1
+	// DefaultReputationQuietPeriod is how long a user must not have been reported for their
+	// rating to recover.
+	DefaultReputationQuietPeriod = 7 * 24 * time.Hour
+)
+
+// ReputationStorage is the part of storage.Storage the ReputationRecovery uses.
+type ReputationStorage interface {
+	RecoverUserRatings(step int, quietSince time.Time) (int64, error)
+}
+
+// ReputationRecovery is a background job that lets negative ratings recover towards 0 while
+// their users are not reported, so that a few bad chats do not mark a user as reported for
+// good. It must run on one instance per interval, or ratings recover several times.
+type ReputationRecovery struct {
+	// Storage provides access to the data persistence layer.
+	Storage ReputationStorage
+	// Interval is the time between two recoveries.
+	Interval time.Duration
+	// Step is how much a negative rating recovers per run.
+	Step int
+	// QuietPeriod is how long a user must not have been reported for their rating to recover.
+	QuietPeriod time.Duration
+}
+
+// NewReputationRecovery creates and returns a new ReputationRecovery with default settings.
+func NewReputationRecovery(s ReputationStorage) *ReputationRecovery {
+	return &ReputationRecovery{
+		Storage:     s,
+		Interval:    DefaultReputationRecoveryInterval,
+		Step:        DefaultReputationRecoveryStep,
+		QuietPeriod: DefaultReputationQuietPeriod,
+	}
+}
+
+// RecoverRatings raises the negative ratings of the users not reported within QuietPeriod
+// before now by Step, and returns the number of users whose rating was raised.
+func (r *ReputationRecovery) RecoverRatings(now time.Time) int {
+	recovered, err := r.Storage.RecoverUserRatings(r.Step, now.Add(-r.QuietPeriod))
+	if err != nil {
+		log.Printf("ERROR: Failed to recover user ratings: %v", err)
+		return 0
+	}
+	if recovered > 0 {
+		log.Printf("Reputation Recovery: raised the ratings of %d users.", recovered)
+	}
+	return int(recovered)
+}
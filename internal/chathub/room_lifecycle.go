@@ -0,0 +1,150 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// RoomState is a stage in the lifecycle of a chat room.
+type RoomState string
+
+// States of a chat room. A room moves forward through them only, possibly skipping some:
+// matched → active → ending → closed.
+const (
+	// RoomMatched means the matcher opened the room and no chat message was relayed yet.
+	RoomMatched RoomState = "matched"
+	// RoomActive means a chat message was relayed in the room.
+	RoomActive RoomState = "active"
+	// RoomEnding means the room is being closed: the participants are told, but it may still
+	// be open in storage.
+	RoomEnding RoomState = "ending"
+	// RoomClosed means the room is closed in storage. It is the last state.
+	RoomClosed RoomState = "closed"
+)
+
+// roomStateOrder orders the states of a room; a room never moves to an earlier one.
+var roomStateOrder = map[RoomState]int{RoomMatched: 1, RoomActive: 2, RoomEnding: 3, RoomClosed: 4}
+
+// RoomEvent is the transition of a room into another state.
+type RoomEvent struct {
+	RoomID  string
+	User1ID string
+	User2ID string
+	// From is the state the room left, or "" if this instance did not know the room before,
+	// e.g. because it was matched on another instance.
+	From RoomState
+	To   RoomState
+	// By is the user who caused the transition, or "system".
+	By string
+	// Reason is why a room is ending or closed, e.g. "stop", "next", "ban" or "idle", as
+	// recorded by Storage.CloseRoom.
+	Reason string
+	At     time.Time
+}
+
+// RoomEventHandler handles room events. Handlers run synchronously in the goroutine that
+// moved the room, which is the matcher for RoomMatched and the hub for the other states, so
+// they must not block and must be safe for concurrent use.
+type RoomEventHandler func(event RoomEvent)
+
+var roomEvents = metrics.Default.NewCounterVec("chatgogo_hub_room_events_total",
+	"Rooms that moved into a lifecycle state on this instance, by state.", "state")
+
+// RoomLifecycle tracks the state of the rooms this instance's users are in, and tells its
+// subscribers about every transition. It is safe for concurrent use.
+type RoomLifecycle struct {
+	mu       sync.Mutex
+	states   map[string]RoomState
+	handlers []RoomEventHandler
+}
+
+// NewRoomLifecycle creates an empty RoomLifecycle.
+func NewRoomLifecycle() *RoomLifecycle {
+	return &RoomLifecycle{states: make(map[string]RoomState)}
+}
+
+// Subscribe adds a handler that is called for every room event from now on.
+func (l *RoomLifecycle) Subscribe(handler RoomEventHandler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers = append(l.handlers, handler)
+}
+
+// State returns the state of a room, if this instance knows it. Closed rooms are forgotten.
+func (l *RoomLifecycle) State(roomID string) (RoomState, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.states[roomID]
+	return state, ok
+}
+
+// Transition moves a room into a state and tells the subscribers, unless the room is in that
+// or a later state already. It reports whether the room moved.
+func (l *RoomLifecycle) Transition(room *models.ChatRoom, to RoomState, by, reason string) bool {
+	l.mu.Lock()
+	from := l.states[room.RoomID]
+	if roomStateOrder[to] <= roomStateOrder[from] {
+		l.mu.Unlock()
+		return false
+	}
+	if to == RoomClosed {
+		delete(l.states, room.RoomID)
+	} else {
+		l.states[room.RoomID] = to
+	}
+	handlers := append([]RoomEventHandler(nil), l.handlers...)
+	l.mu.Unlock()
+
+	event := RoomEvent{
+		RoomID:  room.RoomID,
+		User1ID: room.User1ID,
+		User2ID: room.User2ID,
+		From:    from,
+		To:      to,
+		By:      by,
+		Reason:  reason,
+		At:      time.Now(),
+	}
+	roomEvents.Inc(string(to))
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return true
+}
+
+// prune forgets the rooms that are not in keep, e.g. because none of this instance's users
+// is in them anymore.
+func (l *RoomLifecycle) prune(keep map[string]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for roomID := range l.states {
+		if !keep[roomID] {
+			delete(l.states, roomID)
+		}
+	}
+}
+
+// closeRoom closes a room in storage and moves it to RoomClosed, which lets the hub and the
+// other subscribers forget it. The room must have been moved to RoomEnding before its
+// participants were told.
+func (m *ManagerService) closeRoom(room *models.ChatRoom, closedBy, reason string) {
+	if err := m.Storage.CloseRoom(room.RoomID, closedBy, reason); err != nil {
+		log.Printf("ERROR: Failed to close room %s: %v", room.RoomID, err)
+	}
+	m.Rooms.Transition(room, RoomClosed, closedBy, reason)
+}
+
+// forgetClosedRoom is the hub's RoomEventHandler: it drops what the hub kept about a room
+// once it is closed. It runs in the hub goroutine, as only the hub closes rooms.
+func (m *ManagerService) forgetClosedRoom(event RoomEvent) {
+	if event.To != RoomClosed {
+		return
+	}
+	m.forgetRoomActivity(event.RoomID)
+	delete(m.safeModeRooms, event.RoomID)
+	m.forgetHoneypotRoom(event.RoomID)
+	m.forgetRoomMutes(event.RoomID)
+}
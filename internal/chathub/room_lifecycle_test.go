@@ -0,0 +1,78 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomLifecycle_MovesForwardOnly(t *testing.T) {
+	rooms := chathub.NewRoomLifecycle()
+	var events []chathub.RoomEvent
+	rooms.Subscribe(func(event chathub.RoomEvent) { events = append(events, event) })
+	room := &models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"}
+
+	assert.True(t, rooms.Transition(room, chathub.RoomMatched, "system", ""))
+	assert.True(t, rooms.Transition(room, chathub.RoomActive, "user_A", ""))
+	assert.False(t, rooms.Transition(room, chathub.RoomActive, "user_B", ""), "an active room stays active")
+	assert.False(t, rooms.Transition(room, chathub.RoomMatched, "system", ""), "a room never moves back")
+	state, ok := rooms.State("room1")
+	assert.True(t, ok)
+	assert.Equal(t, chathub.RoomActive, state)
+
+	assert.True(t, rooms.Transition(room, chathub.RoomClosed, "user_A", "stop"))
+	_, ok = rooms.State("room1")
+	assert.False(t, ok, "closed rooms are forgotten")
+
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, chathub.RoomState(""), events[0].From)
+		assert.Equal(t, chathub.RoomActive, events[2].From)
+		assert.Equal(t, chathub.RoomClosed, events[2].To)
+		assert.Equal(t, "stop", events[2].Reason)
+	}
+}
+
+func TestManager_EmitsRoomEventsUntilStop(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "stop").Return(nil).Once()
+	storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil).Once()
+
+	events := make(chan chathub.RoomEvent, 10)
+	hub.Rooms.Subscribe(func(event chathub.RoomEvent) { events <- event })
+
+	clientA := newMockClient("user_A")
+	clientB := newMockClient("user_B")
+	clientA.SetRoomID("room1")
+	clientB.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+	hub.Clients["user_B"] = clientB
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	hub.PubSubCh <- models.ChatMessage{ID: 1, Type: "text", Content: "hi", RoomID: "room1", SenderID: "user_A"}
+	hub.PubSubCh <- models.ChatMessage{ID: 2, Type: "text", Content: "hello", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(50 * time.Millisecond)
+	hub.IncomingCh <- models.ChatMessage{Type: "command_stop", SenderID: "user_A", RoomID: "room1"}
+	time.Sleep(50 * time.Millisecond)
+
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, chathub.RoomActive, (<-events).To)
+		ending := <-events
+		assert.Equal(t, chathub.RoomEnding, ending.To)
+		assert.Equal(t, "user_A", ending.By)
+		closed := <-events
+		assert.Equal(t, chathub.RoomClosed, closed.To)
+		assert.Equal(t, "stop", closed.Reason)
+	}
+	_, ok := hub.Rooms.State("room1")
+	assert.False(t, ok)
+	storageMock.AssertExpectations(t)
+}
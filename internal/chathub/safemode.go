@@ -0,0 +1,91 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SafeModeMaskedWords are masked in safe-mode rooms. Unlike regular screening, they also
+// match inside longer words (e.g., "fucking"), and NSFW vocabulary is masked everywhere.
+var SafeModeMaskedWords = []string{
+	"fuck", "cunt", "bitch", "whore", "nigger", "faggot", "shit", "dick", "pussy", "slut",
+	"nsfw", "porn", "nudes", "onlyfans", "xxx", "sex", "nude",
+}
+
+// safeModeMaskPattern matches any word containing one of SafeModeMaskedWords.
+var safeModeMaskPattern = buildMaskPattern(SafeModeMaskedWords)
+
+// buildMaskPattern compiles a case-insensitive pattern matching whole words that contain
+// any of the given fragments.
+func buildMaskPattern(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)[\pL\pN]*(?:` + strings.Join(quoted, "|") + `)[\pL\pN]*`)
+}
+
+// maskSafeModeText replaces every word containing a masked fragment with asterisks.
+func maskSafeModeText(text string) string {
+	return safeModeMaskPattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
+
+// hasLinkEntity reports whether a message's formatting hides a link behind its text.
+func hasLinkEntity(entities []models.MessageEntity) bool {
+	for _, entity := range entities {
+		if entity.Type == "text_link" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeModeRoom reports whether a room runs in safe mode. The flag is looked up once per
+// room and cached until the room is closed. Lookup errors fail closed.
+func (m *ManagerService) isSafeModeRoom(roomID string) bool {
+	if safe, ok := m.safeModeRooms[roomID]; ok {
+		return safe
+	}
+
+	room, err := m.Storage.GetRoomByID(roomID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load room %s for safe mode check: %v", roomID, err)
+		return true
+	}
+	m.cacheRoom(room)
+	return room.SafeMode
+}
+
+// applySafeMode enforces safe mode on a message sent in a room with a minor: messages with
+// links are dropped, profanity is masked and media is covered by a spoiler. It returns
+// false if the message must not be relayed.
+func (m *ManagerService) applySafeMode(message *models.ChatMessage) bool {
+	if message.RoomID == "" || !m.isSafeModeRoom(message.RoomID) {
+		return true
+	}
+
+	text := &message.Content
+	if message.Type != "text" && message.Type != "" {
+		text = &message.Metadata
+	}
+
+	if urlPattern.MatchString(*text) || hasLinkEntity(message.Entities) {
+		log.Printf("Blocked link from user %s in safe-mode room %s", message.SenderID, message.RoomID)
+		if client, ok := m.Clients[message.SenderID]; ok {
+			m.sendToClient(client, models.ErrorMessage(models.ErrorContentBlocked, "system_safe_mode_link_blocked"))
+		}
+		return false
+	}
+
+	*text = maskSafeModeText(*text)
+	switch message.Type {
+	case "photo", "video", "animation":
+		message.Spoiler = true
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestManager_SafeModeRoom verifies that messages in a room with a minor have links
+// blocked, profanity masked and media covered by a spoiler.
+func TestManager_SafeModeRoom(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true, SafeMode: true}, nil).Once()
+	storageMock.On("GetUserAttribute", "user_A", "shadow_banned").Return("", nil)
+	storageMock.On("GetUserAttribute", "user_A", "first_message_reviewed").Return("1", nil)
+	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
+
+	published := make(chan models.ChatMessage, 4)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).
+		Run(func(args mock.Arguments) { published <- args.Get(0).(models.ChatMessage) }).
+		Return(nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "see https://example.com"}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "click me",
+		Entities: []models.MessageEntity{{Type: "text_link", Offset: 0, Length: 5, URL: "https://example.com"}}}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "what the Fucking hell"}
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "photo", Content: "file", Metadata: "nsfw pic"}
+	time.Sleep(100 * time.Millisecond)
+
+	for range 2 {
+		select {
+		case msg := <-clientA.RecvChannel:
+			assert.Equal(t, "system_safe_mode_link_blocked", msg.Content)
+		default:
+			t.Error("sender was not informed about the blocked link")
+		}
+	}
+
+	if assert.Len(t, published, 2) {
+		text, media := <-published, <-published
+		assert.Equal(t, "what the ******* hell", text.Content)
+		assert.Equal(t, "**** pic", media.Metadata)
+		assert.True(t, media.Spoiler, "media must be covered by a spoiler")
+	}
+	storageMock.AssertExpectations(t)
+}
+
+// TestMatcherSafeModeForMinors verifies that rooms with a minor are created in safe mode and
+// that minors are kept out of adult-only searches.
+func TestMatcherSafeModeForMinors(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	matcher := chathub.NewMatcherService(hub, storageMock)
+
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", Age: 16}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B", Age: 25}, nil)
+	storageMock.On("GetUserByID", "user_C").Return(&models.User{ID: "user_C", Age: 17}, nil)
+	storageMock.On("SaveRoom", mock.MatchedBy(func(room *models.ChatRoom) bool { return room.SafeMode })).Return(nil).Once()
+	expectRoomGuard(storageMock)
+	storageMock.On("GetRecentPartners", mock.Anything, mock.Anything).Return(map[string]time.Time{}, nil)
+	storageMock.On("ClaimMatch", mock.Anything, mock.Anything).Return(true, nil)
+
+	for _, id := range []string{"user_A", "user_B", "user_C"} {
+		hub.Clients[id] = newMockClient(id)
+	}
+
+	// The minor asks for adults only; the filter is not honoured and nobody is matched.
+	reqA := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetAgeMin: 18}}
+	matcher.Queue.Push(reqA)
+	matcher.Queue.Push(models.SearchRequest{UserID: "user_B"})
+	matcher.FindMatch(reqA)
+	storageMock.AssertNotCalled(t, "SaveRoom", mock.Anything)
+
+	// A minor without filters is matched with the adult, in a safe-mode room.
+	reqC := models.SearchRequest{UserID: "user_C"}
+	matcher.Queue.Push(reqC)
+	matcher.FindMatch(reqC)
+
+	storageMock.AssertExpectations(t)
+	assert.Equal(t, 1, matcher.Queue.Len())
+	assert.Equal(t, 1, matcher.QueuePosition("user_A"))
+}
@@ -0,0 +1,135 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultNewAccountReviewPeriod is the account age below which the first URL/media
+// message is screened before being relayed.
+const DefaultNewAccountReviewPeriod = 24 * time.Hour
+
+// firstMessageReviewedAttr is the user attribute set once a user's first URL/media message
+// passed screening (or the account turned out to be old enough not to need it).
+const firstMessageReviewedAttr = "first_message_reviewed"
+
+// urlPattern matches the link formats commonly used in spam messages.
+var urlPattern = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/|telegram\.me/)\S+`)
+
+// ContentScreener decides whether a message is safe to relay.
+type ContentScreener interface {
+	// Screen returns false and a short reason if the message must not be relayed.
+	Screen(message models.ChatMessage) (ok bool, reason string)
+}
+
+// KeywordScreener is a lightweight ContentScreener based on word and link lists.
+type KeywordScreener struct {
+	// ProfanityWords are rejected wherever they appear as whole words.
+	ProfanityWords []string
+	// NSFWWords are rejected when they appear in media captions or in text next to a link.
+	NSFWWords []string
+	// BlockedLinkFragments are rejected when they appear inside a URL (e.g., link shorteners).
+	BlockedLinkFragments []string
+}
+
+// NewKeywordScreener creates a KeywordScreener with a small built-in set of rules.
+func NewKeywordScreener() *KeywordScreener {
+	return &KeywordScreener{
+		ProfanityWords: []string{"fuck", "cunt", "bitch", "whore", "nigger", "faggot"},
+		NSFWWords:      []string{"nsfw", "porn", "nudes", "onlyfans", "xxx", "18+", "sex"},
+		BlockedLinkFragments: []string{
+			"bit.ly", "tinyurl.com", "goo.gl", "cutt.ly", "is.gd", "t.co/",
+			"t.me/joinchat", "t.me/+", "onlyfans.com",
+		},
+	}
+}
+
+// Screen checks the text (or media caption) of a message against the configured word
+// and link lists.
+func (k *KeywordScreener) Screen(message models.ChatMessage) (bool, string) {
+	text := message.Content
+	if message.Type != "text" {
+		text = message.Metadata
+	}
+	lower := strings.ToLower(text)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !(r == '+' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r > 127)
+	})
+
+	for _, word := range words {
+		for _, profanity := range k.ProfanityWords {
+			if word == profanity {
+				return false, "profanity"
+			}
+		}
+	}
+
+	links := urlPattern.FindAllString(lower, -1)
+	for _, link := range links {
+		for _, fragment := range k.BlockedLinkFragments {
+			if strings.Contains(link, fragment) {
+				return false, "blocked_link"
+			}
+		}
+	}
+
+	if message.Type != "text" || len(links) > 0 {
+		for _, word := range words {
+			for _, nsfw := range k.NSFWWords {
+				if word == nsfw {
+					return false, "nsfw"
+				}
+			}
+		}
+	}
+	return true, ""
+}
+
+// needsFirstMessageReview reports whether a message is of a kind that is screened for new
+// accounts: any media message or a text containing a URL.
+func needsFirstMessageReview(message models.ChatMessage) bool {
+	switch message.Type {
+	case "photo", "video", "animation", "sticker", "voice", "video_note":
+		return true
+	case "text":
+		return urlPattern.MatchString(message.Content)
+	}
+	return false
+}
+
+// passesFirstMessageReview holds the first URL/media message of accounts younger than
+// NewAccountReviewPeriod for automated screening. It returns false if the message must
+// not be relayed. Once a message passes, the user is not screened again.
+func (m *ManagerService) passesFirstMessageReview(message models.ChatMessage) bool {
+	if m.Screener == nil || !needsFirstMessageReview(message) {
+		return true
+	}
+
+	reviewed, err := m.Storage.GetUserAttribute(message.SenderID, firstMessageReviewedAttr)
+	if err != nil || reviewed != "" {
+		return true
+	}
+
+	user, err := m.Storage.GetUserByID(message.SenderID)
+	if err != nil {
+		return true
+	}
+
+	if time.Since(user.CreatedAt) < m.NewAccountReviewPeriod {
+		if ok, reason := m.Screener.Screen(message); !ok {
+			log.Printf("Held first %s message from new user %s: %s", message.Type, message.SenderID, reason)
+			if client, ok := m.Clients[message.SenderID]; ok {
+				m.sendToClient(client, models.ErrorMessage(models.ErrorMessageHeld, "system_message_held"))
+			}
+			return false
+		}
+	}
+
+	if err := m.Storage.SetUserAttribute(message.SenderID, firstMessageReviewedAttr, "1"); err != nil {
+		log.Printf("ERROR: Failed to mark first message review for user %s: %v", message.SenderID, err)
+	}
+	return true
+}
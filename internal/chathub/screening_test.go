@@ -0,0 +1,84 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestKeywordScreener(t *testing.T) {
+	screener := chathub.NewKeywordScreener()
+	tests := []struct {
+		name    string
+		message models.ChatMessage
+		ok      bool
+	}{
+		{"Plain link", models.ChatMessage{Type: "text", Content: "check https://example.com"}, true},
+		{"Link shortener", models.ChatMessage{Type: "text", Content: "hot pics https://bit.ly/abc"}, false},
+		{"Invite link", models.ChatMessage{Type: "text", Content: "join t.me/+AbCdEf"}, false},
+		{"Profanity", models.ChatMessage{Type: "text", Content: "fuck you www.example.com"}, false},
+		{"NSFW caption", models.ChatMessage{Type: "photo", Content: "file", Metadata: "NSFW 18+"}, false},
+		{"Clean photo", models.ChatMessage{Type: "photo", Content: "file", Metadata: "my cat"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _ := screener.Screen(tt.message)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestManager_FirstMessageReviewHoldsSpamFromNewAccount(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetUserAttribute", "user_A", "shadow_banned").Return("", nil)
+	storageMock.On("GetUserAttribute", "user_A", "first_message_reviewed").Return("", nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", CreatedAt: time.Now().Add(-time.Hour)}, nil)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "free stuff https://bit.ly/x"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	select {
+	case msg := <-clientA.RecvChannel:
+		assert.Equal(t, "system_message_held", msg.Content)
+	default:
+		t.Error("sender was not informed that the message was held")
+	}
+}
+
+func TestManager_FirstMessageReviewSkipsOldAccounts(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+	storageMock.On("GetUserAttribute", "user_A", "shadow_banned").Return("", nil)
+	storageMock.On("GetUserAttribute", "user_A", "first_message_reviewed").Return("", nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", CreatedAt: time.Now().Add(-48 * time.Hour)}, nil)
+	storageMock.On("SetUserAttribute", "user_A", "first_message_reviewed", "1").Return(nil)
+	storageMock.On("SaveMessage", mock.AnythingOfType("*models.ChatMessage")).Return(nil)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true}, nil)
+	storageMock.On("PublishSavedMessage", mock.AnythingOfType("models.ChatMessage")).Return(nil)
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "https://bit.ly/x"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "PublishSavedMessage", mock.AnythingOfType("models.ChatMessage"))
+	storageMock.AssertCalled(t, "SetUserAttribute", "user_A", "first_message_reviewed", "1")
+}
@@ -0,0 +1,53 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// searchFilterErrors are the messages telling a user why the search criteria given with
+// their search command were rejected.
+var searchFilterErrors = map[error]string{
+	models.ErrInvalidSearchGender: "system_search_invalid_gender",
+	models.ErrInvalidSearchAge:    "system_search_invalid_age",
+	models.ErrInvalidSearchFilter: "system_search_invalid_filter",
+}
+
+// startSearchParams returns the search criteria given with a command_start message, if
+// any. WebSocket clients send them as a JSON SearchFilter in the Metadata; otherwise they
+// are parsed from the arguments following the command in the Content, e.g.
+// "/start female 20-30". Empty criteria mean the user's saved search preferences apply.
+func startSearchParams(message models.ChatMessage) (models.SearchParams, error) {
+	var filter models.SearchFilter
+	if message.Metadata != "" {
+		if err := json.Unmarshal([]byte(message.Metadata), &filter); err != nil {
+			return models.SearchParams{}, models.ErrInvalidSearchFilter
+		}
+	} else {
+		args := strings.TrimSpace(message.Content)
+		if strings.HasPrefix(args, "/") {
+			_, args, _ = strings.Cut(args, " ")
+		}
+		var err error
+		if filter, err = models.ParseSearchFilter(args); err != nil {
+			return models.SearchParams{}, err
+		}
+	}
+	return filter.Params()
+}
+
+// rejectSearchFilter tells a user that the search criteria given with their search
+// command are invalid.
+func (m *ManagerService) rejectSearchFilter(userID string, err error) {
+	content := searchFilterErrors[models.ErrInvalidSearchFilter]
+	for target, key := range searchFilterErrors {
+		if errors.Is(err, target) {
+			content = key
+		}
+	}
+	if client, ok := m.Clients[userID]; ok {
+		m.sendToClient(client, models.ErrorMessage(models.ErrorInvalidRequest, content))
+	}
+}
@@ -0,0 +1,52 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestManager_StartWithInlineFilter verifies that search criteria given with /start, as
+// command arguments or as a JSON payload, are used for the search.
+func TestManager_StartWithInlineFilter(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Content: "/start female 20-30"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Metadata: `{"gender":"male","age_min":25}`}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Content: "/start"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, models.SearchParams{TargetGender: "female", TargetAgeMin: 20, TargetAgeMax: 30}, (<-hub.MatchRequestCh).Params)
+	assert.Equal(t, models.SearchParams{TargetGender: "male", TargetAgeMin: 25}, (<-hub.MatchRequestCh).Params)
+	assert.True(t, (<-hub.MatchRequestCh).Params.IsEmpty(), "Without a filter, saved preferences apply")
+}
+
+// TestManager_StartWithInvalidFilter verifies that an invalid inline filter is reported to
+// the user and does not start a search.
+func TestManager_StartWithInvalidFilter(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Content: "/start female 30-20"}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Metadata: `{"gender":"robot"}`}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A", Metadata: `not json`}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, "system_search_invalid_age", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_search_invalid_gender", (<-clientA.RecvChannel).Content)
+	assert.Equal(t, "system_search_invalid_filter", (<-clientA.RecvChannel).Content)
+	assert.Empty(t, hub.MatchRequestCh)
+}
@@ -0,0 +1,224 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"strings"
+	"sync"
+)
+
+// sessionGroupBuffer is how many messages may wait for the sessions of a user.
+const sessionGroupBuffer = 64
+
+// session is one connection of a user in a sessionGroup.
+type session struct {
+	client Client
+	// removed is closed when the session leaves the group, which ends a delivery to it that
+	// is waiting.
+	removed chan struct{}
+}
+
+// sessionGroup is the Client of a user who is connected more than once, e.g. through
+// Telegram and the web app at the same time, or from two browser tabs. The hub treats it as
+// the user's only client and sends to its channel, and a goroutine delivers each message to
+// every session. Only that goroutine sends to and closes the channels of the sessions, so that
+// a session leaving the group never races a delivery to it.
+type sessionGroup struct {
+	userID string
+	send   chan models.ChatMessage
+	// wake tells the goroutine that sessions left the group.
+	wake chan struct{}
+
+	mu       sync.Mutex
+	sessions []session
+	// retired are the sessions that left the group and whose channels are not closed yet.
+	retired []session
+}
+
+// newSessionGroup creates the group of the sessions of a user, starting with the client
+// they were connected with, and starts delivering to it.
+func newSessionGroup(client Client) *sessionGroup {
+	g := &sessionGroup{
+		userID:   client.GetUserID(),
+		send:     make(chan models.ChatMessage, sessionGroupBuffer),
+		wake:     make(chan struct{}, 1),
+		sessions: []session{{client: client, removed: make(chan struct{})}},
+	}
+	go g.forward()
+	return g
+}
+
+// Sessions returns the clients a user is connected with, given the client the hub knows
+// them by.
+func Sessions(client Client) []Client {
+	g, ok := client.(*sessionGroup)
+	if !ok {
+		return []Client{client}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clients := make([]Client, 0, len(g.sessions))
+	for _, s := range g.sessions {
+		clients = append(clients, s.client)
+	}
+	return clients
+}
+
+// addSession adds a client to the sessions of a user who is connected already, and returns
+// the group the hub knows the user by from now on. The sessions share the room: the new one
+// joins the room of the others, or brings its own if they have none.
+func (m *ManagerService) addSession(previous, client Client) *sessionGroup {
+	g, ok := previous.(*sessionGroup)
+	if !ok {
+		g = newSessionGroup(previous)
+	}
+	if roomID := g.GetRoomID(); roomID != "" {
+		client.SetRoomID(roomID)
+	} else {
+		g.SetRoomID(client.GetRoomID())
+	}
+	g.add(client)
+	log.Printf("Client %s connected again, now has %d sessions.", client.GetUserID(), g.size())
+	return g
+}
+
+func (g *sessionGroup) add(client Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sessions {
+		if s.client == client {
+			return
+		}
+	}
+	g.sessions = append(g.sessions, session{client: client, removed: make(chan struct{})})
+}
+
+// remove takes a client out of the group and reports whether it was in it. Its channel is
+// closed by the delivery goroutine.
+func (g *sessionGroup) remove(client Client) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, s := range g.sessions {
+		if s.client != client {
+			continue
+		}
+		g.sessions = append(g.sessions[:i:i], g.sessions[i+1:]...)
+		g.retired = append(g.retired, s)
+		close(s.removed)
+		select {
+		case g.wake <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	return false
+}
+
+func (g *sessionGroup) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.sessions)
+}
+
+// forward delivers the messages sent to the group to each session, until the channel of the
+// group is closed, and then closes the channels of all sessions. A session that cannot take
+// a message holds up the others until it takes it or leaves the group.
+func (g *sessionGroup) forward() {
+	for {
+		select {
+		case message, ok := <-g.send:
+			if !ok {
+				g.closeSessions()
+				return
+			}
+			g.mu.Lock()
+			sessions := append([]session(nil), g.sessions...)
+			g.mu.Unlock()
+			for _, s := range sessions {
+				select {
+				case s.client.GetSendChannel() <- message:
+				case <-s.removed:
+				}
+			}
+		case <-g.wake:
+		}
+		g.closeRetired()
+	}
+}
+
+// closeRetired closes the channels of the sessions that left the group.
+func (g *sessionGroup) closeRetired() {
+	g.mu.Lock()
+	retired := g.retired
+	g.retired = nil
+	g.mu.Unlock()
+	for _, s := range retired {
+		close(s.client.GetSendChannel())
+	}
+}
+
+// closeSessions closes the channels of all sessions, once the group is closed. The sessions
+// are taken out of the group first, so that none can leave it without its channel being
+// closed.
+func (g *sessionGroup) closeSessions() {
+	g.mu.Lock()
+	sessions := g.sessions
+	g.sessions = nil
+	g.mu.Unlock()
+	g.closeRetired()
+	for _, s := range sessions {
+		close(s.client.GetSendChannel())
+	}
+}
+
+func (g *sessionGroup) GetUserID() string {
+	return g.userID
+}
+
+// GetRoomID returns the room of the sessions, which all share it.
+func (g *sessionGroup) GetRoomID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.sessions) == 0 {
+		return ""
+	}
+	return g.sessions[0].client.GetRoomID()
+}
+
+// SetRoomID moves all sessions into a room.
+func (g *sessionGroup) SetRoomID(roomID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sessions {
+		s.client.SetRoomID(roomID)
+	}
+}
+
+func (g *sessionGroup) GetSendChannel() chan<- models.ChatMessage {
+	return g.send
+}
+
+// Run does nothing; the sessions run on their own.
+func (g *sessionGroup) Run() {}
+
+// Close closes the connections of all sessions.
+func (g *sessionGroup) Close() {
+	for _, client := range Sessions(g) {
+		client.Close()
+	}
+}
+
+// Transport names the transports of the sessions, e.g. "telegram+websocket".
+func (g *sessionGroup) Transport() string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, client := range Sessions(g) {
+		namer, ok := client.(transportNamer)
+		if !ok || seen[namer.Transport()] {
+			continue
+		}
+		seen[namer.Transport()] = true
+		names = append(names, namer.Transport())
+	}
+	return strings.Join(names, "+")
+}
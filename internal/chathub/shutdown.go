@@ -0,0 +1,85 @@
+package chathub
+
+import "log"
+
+// shutdown stops the hub once the context of Run is cancelled. It flushes the events still
+// waiting in the hub's channels, hands pending searches to storage so that the matcher
+// restores them on the next start, and closes the channels of all clients, which makes
+// their write pumps deliver what is buffered and stop. The matcher must be stopped first, as
+// it sends to the clients too.
+func (m *ManagerService) shutdown() {
+	log.Println("Chat Hub Manager shutting down...")
+	flushed := m.flushPending()
+	persisted := m.persistPendingSearches()
+
+	for recipientID, queue := range m.outbox {
+		log.Printf("Dropping %d messages waiting for user %s on shutdown.", len(queue), recipientID)
+	}
+	m.clientsMu.Lock()
+	for userID, client := range m.Clients {
+		close(client.GetSendChannel())
+		delete(m.Clients, userID)
+	}
+	m.clientsMu.Unlock()
+	log.Printf("Chat Hub Manager stopped: %d pending events flushed, %d pending searches persisted.", flushed, persisted)
+}
+
+// flushPending handles the events waiting in the hub's channels, until they are empty. It
+// returns the number of events handled.
+func (m *ManagerService) flushPending() int {
+	flushed := 0
+	for {
+		select {
+		case client := <-m.RegisterCh:
+			m.handleRegister(client)
+		case client := <-m.UnregisterCh:
+			m.handleUnregister(client)
+		case message := <-m.IncomingCh:
+			m.handleIncomingMessage(message)
+		case message := <-m.PubSubCh:
+			m.handlePubSubMessage(message)
+		default:
+			return flushed
+		}
+		flushed++
+	}
+}
+
+// persistPendingSearches applies the search requests and cancellations the matcher did not
+// receive to the shared queue in storage, and returns the number of searches added. The
+// requests are saved whole, so that the matcher restoring the queue searches with their
+// criteria. Pending rematches are dropped; the users can send /again once more. It only takes
+// what is waiting in the channels and never blocks.
+func (m *ManagerService) persistPendingSearches() int {
+	persisted := 0
+	for pending := true; pending; {
+		select {
+		case req := <-m.MatchRequestCh:
+			if err := m.Storage.SaveSearchRequest(req); err != nil {
+				log.Printf("ERROR: Failed to persist pending search of user %s: %v", req.UserID, err)
+				continue
+			}
+			persisted++
+		default:
+			pending = false
+		}
+	}
+	for pending := true; pending; {
+		select {
+		case userID := <-m.CancelSearchCh:
+			m.cancellations = append(m.cancellations, userID)
+		case rematch := <-m.RematchCh:
+			log.Printf("Dropping pending rematch of %s and %s on shutdown.", rematch.User1ID, rematch.User2ID)
+		default:
+			pending = false
+		}
+	}
+	for _, userID := range m.cancellations {
+		if err := m.Storage.RemoveUserFromSearchQueue(userID); err != nil {
+			log.Printf("ERROR: Failed to persist search cancellation of user %s: %v", userID, err)
+		}
+	}
+	m.cancellations = nil
+	m.recordMatchBacklog()
+	return persisted
+}
@@ -0,0 +1,51 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestManager_ShutdownFlushesAndPersists verifies that a cancelled hub handles the messages
+// still pending, hands the searches the matcher did not receive to storage with their
+// criteria, and closes the channels of its clients.
+func TestManager_ShutdownFlushesAndPersists(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTestHub(storageMock)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil)
+	withCriteria := mock.MatchedBy(func(req models.SearchRequest) bool {
+		return req.UserID == "user_A" && req.Params.TargetGender == "female"
+	})
+	storageMock.On("SaveSearchRequest", withCriteria).Return(nil)
+	storageMock.On("RemoveUserFromSearchQueue", "user_B").Return(nil)
+
+	clientA := newMockClient("user_A")
+	hub.Clients["user_A"] = clientA
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", Content: "/start female", SenderID: "user_A"}
+	hub.CancelSearchCh <- "user_B"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The hub did not stop")
+	}
+	storageMock.AssertCalled(t, "SaveSearchRequest", withCriteria)
+	storageMock.AssertCalled(t, "RemoveUserFromSearchQueue", "user_B")
+	assert.Empty(t, hub.MatchRequestCh)
+	assert.Empty(t, hub.Clients)
+	assert.Equal(t, "system_search_start", (<-clientA.RecvChannel).Content)
+	_, open := <-clientA.RecvChannel
+	assert.False(t, open, "The client's channel is closed")
+}
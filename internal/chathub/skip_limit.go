@@ -0,0 +1,114 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Defaults of the /next rate limit.
+const (
+	// DefaultSkipLimit is the number of /next allowed within SkipWindow.
+	DefaultSkipLimit = 5
+	// DefaultSkipWindow is the period over which /next commands are counted.
+	DefaultSkipWindow = time.Minute
+	// DefaultSkipCooldown is how long a user who exceeded the limit cannot search.
+	DefaultSkipCooldown = 2 * time.Minute
+	// DefaultSkipRepeatWindow is the period after a cooldown in which exceeding the limit
+	// again costs reputation.
+	DefaultSkipRepeatWindow = time.Hour
+)
+
+// SkipPenalty is the rating score deducted from a user who exceeds the /next limit again
+// within SkipRepeatWindow of their previous cooldown.
+const SkipPenalty = 1
+
+// skipState is what the hub remembers about the /next commands of a user.
+type skipState struct {
+	// skips are the times of the user's /next commands within the current window.
+	skips []time.Time
+	// cooldownUntil is the end of the user's current or last cooldown.
+	cooldownUntil time.Time
+}
+
+// skipLimited records a /next of a user and reports whether it exceeds SkipLimit within
+// SkipWindow. A user who exceeds it cannot search for SkipCooldown; doing so again within
+// SkipRepeatWindow of the previous cooldown also costs SkipPenalty rating points, which
+// penalized reports. /next during a cooldown is limited without a new penalty.
+func (m *ManagerService) skipLimited(userID string, now time.Time) (limited, penalized bool) {
+	if m.SkipLimit <= 0 {
+		return false, false
+	}
+	state, ok := m.skips[userID]
+	if !ok {
+		state = &skipState{}
+		m.skips[userID] = state
+	}
+	if now.Before(state.cooldownUntil) {
+		return true, false
+	}
+
+	recent := state.skips[:0]
+	for _, at := range state.skips {
+		if now.Sub(at) < m.SkipWindow {
+			recent = append(recent, at)
+		}
+	}
+	state.skips = append(recent, now)
+	if len(state.skips) <= m.SkipLimit {
+		return false, false
+	}
+
+	penalized = !state.cooldownUntil.IsZero() && now.Sub(state.cooldownUntil) < m.SkipRepeatWindow
+	state.skips = nil
+	state.cooldownUntil = now.Add(m.SkipCooldown)
+	log.Printf("User %s exceeded the /next limit; cooldown until %s", userID, state.cooldownUntil.Format(time.RFC3339))
+	if penalized {
+		if err := m.Storage.AdjustUserRating(userID, -SkipPenalty); err != nil {
+			log.Printf("ERROR: Failed to penalize user %s for skipping partners: %v", userID, err)
+		}
+	}
+	return true, penalized
+}
+
+// rejectSkipCooldown tells a user on a /next cooldown that they cannot search yet. It
+// returns false if the user is not on a cooldown.
+func (m *ManagerService) rejectSkipCooldown(userID string, now time.Time) bool {
+	state, ok := m.skips[userID]
+	if !ok || !now.Before(state.cooldownUntil) {
+		return false
+	}
+	m.sendSkipCooldown(userID, "system_skip_cooldown", now)
+	return true
+}
+
+// sendSkipCooldown sends a system_skip_cooldown notice with the given content to a user.
+// Its Metadata is the number of minutes left until the user can search again.
+func (m *ManagerService) sendSkipCooldown(userID, content string, now time.Time) {
+	client, ok := m.Clients[userID]
+	if !ok {
+		return
+	}
+	minutes := int(math.Ceil(m.skips[userID].cooldownUntil.Sub(now).Minutes()))
+	m.sendToClient(client, models.ChatMessage{
+		Type:     "system_skip_cooldown",
+		Content:  content,
+		Metadata: strconv.Itoa(max(minutes, 1)),
+		SenderID: "system",
+	})
+}
+
+// pruneSkips forgets the /next history of users whose window and repeat window are over.
+func (m *ManagerService) pruneSkips(now time.Time) {
+	for userID, state := range m.skips {
+		lastSkip := time.Time{}
+		if len(state.skips) > 0 {
+			lastSkip = state.skips[len(state.skips)-1]
+		}
+		if now.Sub(lastSkip) >= m.SkipWindow && now.Sub(state.cooldownUntil) >= m.SkipRepeatWindow {
+			delete(m.skips, userID)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSkipHub returns a hub where user_A and user_B are connected and every /next of user_A
+// leaves room1.
+func newSkipHub(storageMock *MockStorage) (*chathub.ManagerService, *MockClient) {
+	hub := newTestHub(storageMock)
+	storageMock.On("GetRoomByID", "room1").Return(&models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B"}, nil)
+	storageMock.On("CloseRoom", "room1", "user_A", "next").Return(nil)
+	storageMock.On("AddRecentPartners", "user_A", "user_B", chathub.DefaultRematchCooldown).Return(nil)
+	storageMock.On("IsUserBanned", "user_A").Return(false, nil).Maybe()
+
+	clientA := addTestClient(hub, "user_A", "")
+	addTestClient(hub, "user_B", "")
+	return hub, clientA
+}
+
+// TestManager_SkipLimitCooldown verifies that a /next over the limit ends the chat without a
+// new search, and that the user cannot search again during the cooldown.
+func TestManager_SkipLimitCooldown(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA := newSkipHub(storageMock)
+	hub.SkipLimit = 2
+
+	go hub.Run(context.Background())
+
+	for i := 0; i < 3; i++ {
+		hub.IncomingCh <- models.ChatMessage{Type: "command_next", SenderID: "user_A", RoomID: "room1"}
+	}
+	hub.IncomingCh <- models.ChatMessage{Type: "command_start", SenderID: "user_A"}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, hub.MatchRequestCh, 2, "Only the /next within the limit search again")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "system_match_stop_self", (<-clientA.RecvChannel).Content)
+	}
+	notice := <-clientA.RecvChannel
+	assert.Equal(t, "system_skip_cooldown", notice.Type)
+	assert.Equal(t, "system_skip_cooldown", notice.Content)
+	assert.Equal(t, "2", notice.Metadata)
+	assert.Equal(t, "system_skip_cooldown", (<-clientA.RecvChannel).Content, "/start is refused during the cooldown")
+	storageMock.AssertNotCalled(t, "AdjustUserRating", "user_A", -chathub.SkipPenalty)
+}
+
+// TestManager_SkipLimitPenalty verifies that exceeding the limit again soon after a cooldown
+// lowers the user's rating.
+func TestManager_SkipLimitPenalty(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub, clientA := newSkipHub(storageMock)
+	hub.SkipLimit = 1
+	hub.SkipCooldown = 50 * time.Millisecond
+	storageMock.On("AdjustUserRating", "user_A", -chathub.SkipPenalty).Return(nil).Once()
+
+	go hub.Run(context.Background())
+
+	next := models.ChatMessage{Type: "command_next", SenderID: "user_A", RoomID: "room1"}
+	hub.IncomingCh <- next
+	hub.IncomingCh <- next
+	time.Sleep(100 * time.Millisecond)
+	hub.IncomingCh <- next
+	hub.IncomingCh <- next
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertExpectations(t)
+	var notices []string
+	for len(clientA.RecvChannel) > 0 {
+		if msg := <-clientA.RecvChannel; msg.Type == "system_skip_cooldown" {
+			notices = append(notices, msg.Content)
+		}
+	}
+	assert.Equal(t, []string{"system_skip_cooldown", "system_skip_penalty"}, notices)
+}
@@ -0,0 +1,83 @@
+package chathub
+
+import (
+	"context"
+	"time"
+)
+
+// Transports of clients, as reported in a UserSnapshot.
+const (
+	TransportWebSocket = "websocket"
+	TransportTelegram  = "telegram"
+)
+
+// transportNamer is implemented by clients that can name their transport.
+type transportNamer interface {
+	Transport() string
+}
+
+// UserSnapshot is the live state of a user in the hub of this instance, for support. A user
+// connected to another instance shows as not connected.
+type UserSnapshot struct {
+	// Connected reports whether the user has a client registered in this hub.
+	Connected bool `json:"connected"`
+	// Transport is the transport of the client (TransportWebSocket, TransportTelegram), or the
+	// transports of its sessions joined by "+" if the user is connected more than once.
+	Transport string `json:"transport,omitempty"`
+	// RoomID is the room the client is in.
+	RoomID string `json:"room_id,omitempty"`
+	// AwaitingReconnect reports whether the user's connection dropped mid-chat and the room
+	// is kept open for DisconnectGrace.
+	AwaitingReconnect bool `json:"awaiting_reconnect"`
+	// LastSeen is when the user's WebSocket connection was last heard from.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	// PendingDeliveries is the number of messages waiting for the client in the outbox.
+	PendingDeliveries int `json:"pending_deliveries"`
+	// SkipCooldownUntil is the end of the user's search cooldown after too many /next.
+	SkipCooldownUntil *time.Time `json:"skip_cooldown_until,omitempty"`
+}
+
+// snapshotRequest asks the hub goroutine for the snapshot of a user.
+type snapshotRequest struct {
+	userID string
+	result chan UserSnapshot
+}
+
+// Snapshot returns the live state of a user in the hub. The state is read by the hub
+// goroutine, so Snapshot waits for it to get to the request, or for ctx to be done.
+func (m *ManagerService) Snapshot(ctx context.Context, userID string) (UserSnapshot, error) {
+	req := snapshotRequest{userID: userID, result: make(chan UserSnapshot, 1)}
+	select {
+	case m.snapshotCh <- req:
+	case <-ctx.Done():
+		return UserSnapshot{}, ctx.Err()
+	}
+	select {
+	case snapshot := <-req.result:
+		return snapshot, nil
+	case <-ctx.Done():
+		return UserSnapshot{}, ctx.Err()
+	}
+}
+
+// snapshot assembles the live state of a user from the hub's own state.
+func (m *ManagerService) snapshot(userID string, now time.Time) UserSnapshot {
+	var snapshot UserSnapshot
+	if client, ok := m.Clients[userID]; ok {
+		snapshot.Connected = true
+		snapshot.RoomID = client.GetRoomID()
+		if namer, ok := client.(transportNamer); ok {
+			snapshot.Transport = namer.Transport()
+		}
+	}
+	_, snapshot.AwaitingReconnect = m.dropped[userID]
+	if seen, ok := m.LastSeen(userID); ok {
+		snapshot.LastSeen = &seen
+	}
+	snapshot.PendingDeliveries = len(m.outbox[userID])
+	if state, ok := m.skips[userID]; ok && now.Before(state.cooldownUntil) {
+		until := state.cooldownUntil
+		snapshot.SkipCooldownUntil = &until
+	}
+	return snapshot
+}
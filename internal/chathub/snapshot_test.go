@@ -0,0 +1,40 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManager_Snapshot verifies that the snapshot of a user reflects their client and the
+// hub state kept about them.
+func TestManager_Snapshot(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := chathub.NewManagerService(storageMock)
+	storageMock.On("GetActiveRoomIDs").Return([]string{}, nil)
+	storageMock.On("SubscribeToRooms").Return(newFakeSubscription())
+
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+	hub.Clients["user_A"] = clientA
+	hub.TouchPresence("user_A")
+
+	go hub.Run(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	snapshot, err := hub.Snapshot(ctx, "user_A")
+	require.NoError(t, err)
+	assert.True(t, snapshot.Connected)
+	assert.Equal(t, "room1", snapshot.RoomID)
+	assert.NotNil(t, snapshot.LastSeen)
+	assert.Nil(t, snapshot.SkipCooldownUntil)
+
+	snapshot, err = hub.Snapshot(ctx, "user_B")
+	require.NoError(t, err)
+	assert.Equal(t, chathub.UserSnapshot{}, snapshot)
+}
@@ -0,0 +1,63 @@
+package chathub
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+)
+
+// handleTyping processes a "typing" message, sent by a client while its user is typing. It is
+// relayed to the partner through the room, but not saved, unless the user hid their typing
+// (models.User.HideTyping). Hiding only affects the indicators the user sends; they still
+// see their partner's.
+func (m *ManagerService) handleTyping(message models.ChatMessage) {
+	if message.RoomID == "" {
+		return
+	}
+	room, err := m.Storage.GetRoomByID(message.RoomID)
+	if err != nil {
+		log.Printf("ERROR: Room not found for typing indicator: %v", err)
+		return
+	}
+	if !room.IsActive || (room.User1ID != message.SenderID && room.User2ID != message.SenderID) {
+		return
+	}
+
+	user, err := m.Storage.GetUserByID(message.SenderID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %s for a typing indicator: %v", message.SenderID, err)
+		return
+	}
+	if user.HideTyping {
+		return
+	}
+
+	typing := models.ChatMessage{
+		Type:     "typing",
+		RoomID:   room.RoomID,
+		SenderID: message.SenderID,
+	}
+	if err := m.Storage.PublishMessage(room.RoomID, typing); err != nil {
+		log.Printf("ERROR: Failed to publish typing indicator in room %s: %v", room.RoomID, err)
+	}
+}
+
+// handleHideTypingSetting processes command_hide_typing, with which a client hides the typing
+// indicators of its user from partners (Content "on") or shows them again (any other content).
+func (m *ManagerService) handleHideTypingSetting(message models.ChatMessage) {
+	hidden := message.Content == "on"
+	if err := m.Storage.UpdateUserHideTyping(message.SenderID, hidden); err != nil {
+		log.Printf("ERROR: Failed to update typing privacy of user %s: %v", message.SenderID, err)
+		return
+	}
+	content := "system_hide_typing_off"
+	if hidden {
+		content = "system_hide_typing_on"
+	}
+	if client, ok := m.Clients[message.SenderID]; ok {
+		m.sendToClient(client, models.ChatMessage{
+			Type:     "system_info",
+			Content:  content,
+			SenderID: "system",
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTypingHub returns a hub where user_A, who hides their typing as given, chats with user_B
+// in room1.
+func newTypingHub(storageMock *MockStorage, hideTyping bool) *chathub.ManagerService {
+	hub := newTestHub(storageMock)
+	storageMock.On("TakeOfflineMessages", mock.Anything).Return([]models.ChatMessage(nil), nil).Maybe()
+
+	room := &models.ChatRoom{RoomID: "room1", IsActive: true, User1ID: "user_A", User2ID: "user_B"}
+	storageMock.On("GetRoomByID", "room1").Return(room, nil)
+	storageMock.On("GetUserByID", "user_A").Return(&models.User{ID: "user_A", HideTyping: hideTyping}, nil)
+	storageMock.On("GetUserByID", "user_B").Return(&models.User{ID: "user_B"}, nil)
+	return hub
+}
+
+// TestManager_TypingIsPublishedWithoutSaving verifies that a typing indicator is relayed
+// through the room but not stored in the history.
+func TestManager_TypingIsPublishedWithoutSaving(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTypingHub(storageMock, false)
+	typing := models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_A"}
+	storageMock.On("PublishMessage", "room1", typing).Return(nil)
+
+	go hub.Run(context.Background())
+
+	hub.IncomingCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_A", Content: "ignored"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertCalled(t, "PublishMessage", "room1", typing)
+	storageMock.AssertNotCalled(t, "SaveMessage", mock.Anything)
+}
+
+// TestManager_HiddenTypingIsNotSent verifies that the typing of a user who hid it is not
+// relayed, while they still receive their partner's.
+func TestManager_HiddenTypingIsNotSent(t *testing.T) {
+	storageMock := new(MockStorage)
+	hub := newTypingHub(storageMock, true)
+	clientA := newMockClient("user_A")
+	clientA.SetRoomID("room1")
+
+	go hub.Run(context.Background())
+	hub.RegisterCh <- clientA
+	time.Sleep(20 * time.Millisecond)
+
+	hub.IncomingCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_A"}
+	hub.PubSubCh <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	time.Sleep(100 * time.Millisecond)
+
+	storageMock.AssertNotCalled(t, "PublishMessage", mock.Anything, mock.Anything)
+	if assert.Len(t, clientA.RecvChannel, 1) {
+		received := <-clientA.RecvChannel
+		assert.Equal(t, "typing", received.Type)
+		assert.Equal(t, "user_B", received.SenderID)
+	}
+}
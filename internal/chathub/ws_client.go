@@ -4,7 +4,10 @@ import (
 	"chatgogo/backend/internal/models"
 	"encoding/json"
 	"log"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 )
@@ -16,27 +19,62 @@ const (
 	pongWait = 60 * time.Second
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. It leaves room for a text of
+	// MaxTextLength characters after UTF-8 and JSON escaping.
+	maxMessageSize = 6*MaxTextLength + 4096
 )
 
+// MaxTextLength is the maximum number of characters in the text or caption of a message
+// accepted from WebSocket clients. Longer texts are split into parts by the Telegram client.
+const MaxTextLength = 4 * 4096
+
+// internalMessageTypes are submitted by the backend itself, never by users: the signals of
+// transports and moderators, and the deletion of a user's data, which the Telegram bot submits
+// only after the user confirmed it.
+var internalMessageTypes = map[string]bool{
+	"command_user_banned":     true,
+	"command_bot_blocked":     true,
+	"command_delivery_failed": true,
+	"command_delete_data":     true,
+}
+
+// acceptedFromClient reports whether a WebSocket client may send a message of the type.
+// System messages only go from the hub to clients.
+func acceptedFromClient(msgType string) bool {
+	return !internalMessageTypes[msgType] && !strings.HasPrefix(msgType, "system_")
+}
+
 // WebSocketClient is an implementation of the Client interface for WebSocket connections.
 type WebSocketClient struct {
 	UserID string
-	RoomID string
 	Conn   *websocket.Conn
-	Hub    *ManagerService
+	Hub    Hub
 	Send   chan models.ChatMessage
+
+	// mu guards roomID, which the hub sets and readPump checks messages against.
+	mu     sync.Mutex
+	roomID string
 }
 
 // GetUserID returns the client's user ID.
 func (c *WebSocketClient) GetUserID() string { return c.UserID }
 
 // GetRoomID returns the ID of the room the client is in.
-func (c *WebSocketClient) GetRoomID() string { return c.RoomID }
+func (c *WebSocketClient) GetRoomID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roomID
+}
 
 // SetRoomID sets the client's current room ID.
-func (c *WebSocketClient) SetRoomID(id string) { c.RoomID = id }
+func (c *WebSocketClient) SetRoomID(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roomID = id
+}
+
+// Transport returns TransportWebSocket.
+func (c *WebSocketClient) Transport() string { return TransportWebSocket }
 
 // GetSendChannel returns the client's outbound message channel.
 func (c *WebSocketClient) GetSendChannel() chan<- models.ChatMessage { return c.Send }
@@ -55,17 +93,21 @@ func (c *WebSocketClient) Close() {
 
 // readPump pumps messages from the WebSocket connection to the hub.
 // It ensures that the client is unregistered and the connection is closed
-// when the read loop exits.
+// when the read loop exits. Every pong and message counts as a sign of life of the user
+// (see Hub.TouchPresence). Messages of internal types and messages to another room than the
+// client's are dropped.
 func (c *WebSocketClient) readPump() {
 	defer func() {
-		c.Hub.UnregisterCh <- c
+		c.Hub.Unregister(c)
 		c.Conn.Close()
 	}()
 
 	c.Conn.SetReadLimit(maxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Hub.TouchPresence(c.UserID)
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.Hub.TouchPresence(c.UserID)
 		return nil
 	})
 
@@ -83,8 +125,30 @@ func (c *WebSocketClient) readPump() {
 			log.Printf("Error decoding JSON from client %s: %v", c.UserID, err)
 			continue
 		}
+		if !acceptedFromClient(msg.Type) {
+			log.Printf("WARNING: Client %s sent a message of the internal type %q, dropping it.", c.UserID, msg.Type)
+			continue
+		}
+		if msg.RoomID != "" && msg.RoomID != c.GetRoomID() {
+			log.Printf("WARNING: Client %s sent a message to room %s it is not in, dropping it.", c.UserID, msg.RoomID)
+			continue
+		}
+		if utf8.RuneCountInString(msg.Content) > MaxTextLength || utf8.RuneCountInString(msg.Metadata) > MaxTextLength {
+			c.rejectTooLong()
+			continue
+		}
+		c.Hub.TouchPresence(c.UserID)
 		msg.SenderID = c.UserID
-		c.Hub.IncomingCh <- msg
+		c.Hub.Submit(msg)
+	}
+}
+
+// rejectTooLong tells the client that its message exceeded MaxTextLength and was not sent.
+func (c *WebSocketClient) rejectTooLong() {
+	select {
+	case c.Send <- models.ErrorMessage(models.ErrorMessageTooLong, "system_message_too_long"):
+	default:
+		channelOverflows.Inc(overflowClientSend)
 	}
 }
 
@@ -0,0 +1,62 @@
+package chathub_test
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHub records the messages WebSocket clients submit.
+type recordingHub struct {
+	submitted chan models.ChatMessage
+}
+
+func (h *recordingHub) Register(chathub.Client)              {}
+func (h *recordingHub) Unregister(chathub.Client)            {}
+func (h *recordingHub) Submit(message models.ChatMessage)    { h.submitted <- message }
+func (h *recordingHub) RequestMatch(string)                  {}
+func (h *recordingHub) TouchPresence(string)                 {}
+func (h *recordingHub) UserSessions(string) []chathub.Client { return nil }
+
+func TestWebSocketClient_DropsInternalAndForeignRoomMessages(t *testing.T) {
+	hub := &recordingHub{submitted: make(chan models.ChatMessage, 10)}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		client := &chathub.WebSocketClient{UserID: "user_A", Conn: conn, Hub: hub, Send: make(chan models.ChatMessage, 10)}
+		client.SetRoomID("room1")
+		client.Run()
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, message := range []models.ChatMessage{
+		{Type: "command_user_banned", SenderID: "user_B"},
+		{Type: "command_delete_data"},
+		{Type: "system_match_found", RoomID: "room1"},
+		{Type: "text", RoomID: "room2", Content: "into another chat"},
+		{Type: "text", RoomID: "room1", Content: "hello", SenderID: "user_B"},
+	} {
+		require.NoError(t, conn.WriteJSON(message))
+	}
+
+	select {
+	case message := <-hub.submitted:
+		assert.Equal(t, models.ChatMessage{Type: "text", RoomID: "room1", Content: "hello", SenderID: "user_A"}, message)
+	case <-time.After(time.Second):
+		t.Fatal("the chat message was not submitted")
+	}
+	assert.Empty(t, hub.submitted)
+}
@@ -0,0 +1,81 @@
+// Package config holds tunable settings shared between services, with defaults that can
+// be overridden through environment variables.
+package config
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"os"
+	"strconv"
+)
+
+// ReputationTier is a coarse band of User.RatingScore used by the matcher.
+type ReputationTier int
+
+const (
+	// ReputationTierLow holds frequently reported users.
+	ReputationTierLow ReputationTier = iota
+	// ReputationTierStandard holds users without a notable reputation.
+	ReputationTierStandard
+	// ReputationTierHigh holds trusted users, who are never matched with the low tier.
+	ReputationTierHigh
+)
+
+// ReputationTiers defines the rating score thresholds of the reputation tiers.
+type ReputationTiers struct {
+	// LowMax is the highest rating score of the low tier.
+	LowMax int
+	// HighMin is the lowest rating score of the high tier.
+	HighMin int
+}
+
+// DefaultReputationTiers returns the default thresholds, aligned with the trust badges
+// shown to chat partners.
+func DefaultReputationTiers() ReputationTiers {
+	return ReputationTiers{
+		LowMax:  models.ReportedRatingThreshold,
+		HighMin: models.TrustedRatingThreshold,
+	}
+}
+
+// ReputationTiersFromEnv returns the default thresholds, overridden by the
+// REPUTATION_LOW_MAX and REPUTATION_HIGH_MIN environment variables if they are valid.
+func ReputationTiersFromEnv() ReputationTiers {
+	tiers := DefaultReputationTiers()
+	if v := os.Getenv("REPUTATION_LOW_MAX"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			tiers.LowMax = n
+		} else {
+			log.Printf("Warning: Invalid REPUTATION_LOW_MAX value '%s'. Using %d.", v, tiers.LowMax)
+		}
+	}
+	if v := os.Getenv("REPUTATION_HIGH_MIN"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			tiers.HighMin = n
+		} else {
+			log.Printf("Warning: Invalid REPUTATION_HIGH_MIN value '%s'. Using %d.", v, tiers.HighMin)
+		}
+	}
+	if tiers.HighMin <= tiers.LowMax {
+		log.Printf("Warning: REPUTATION_HIGH_MIN must be greater than REPUTATION_LOW_MAX. Using defaults.")
+		return DefaultReputationTiers()
+	}
+	return tiers
+}
+
+// TierOf returns the tier of a rating score.
+func (t ReputationTiers) TierOf(score int) ReputationTier {
+	switch {
+	case score <= t.LowMax:
+		return ReputationTierLow
+	case score >= t.HighMin:
+		return ReputationTierHigh
+	}
+	return ReputationTierStandard
+}
+
+// CanMatch reports whether users of two tiers may be paired. High-tier users are
+// protected from the low tier.
+func CanMatch(a, b ReputationTier) bool {
+	return !(a == ReputationTierLow && b == ReputationTierHigh || a == ReputationTierHigh && b == ReputationTierLow)
+}
@@ -0,0 +1,30 @@
+package config_test
+
+import (
+	"chatgogo/backend/internal/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReputationTiers(t *testing.T) {
+	tiers := config.ReputationTiers{LowMax: -3, HighMin: 10}
+
+	assert.Equal(t, config.ReputationTierLow, tiers.TierOf(-3))
+	assert.Equal(t, config.ReputationTierStandard, tiers.TierOf(0))
+	assert.Equal(t, config.ReputationTierHigh, tiers.TierOf(10))
+
+	assert.True(t, config.CanMatch(config.ReputationTierLow, config.ReputationTierStandard))
+	assert.True(t, config.CanMatch(config.ReputationTierHigh, config.ReputationTierStandard))
+	assert.False(t, config.CanMatch(config.ReputationTierLow, config.ReputationTierHigh))
+	assert.False(t, config.CanMatch(config.ReputationTierHigh, config.ReputationTierLow))
+}
+
+func TestReputationTiersFromEnv(t *testing.T) {
+	t.Setenv("REPUTATION_LOW_MAX", "-5")
+	t.Setenv("REPUTATION_HIGH_MIN", "20")
+	assert.Equal(t, config.ReputationTiers{LowMax: -5, HighMin: 20}, config.ReputationTiersFromEnv())
+
+	t.Setenv("REPUTATION_HIGH_MIN", "-10")
+	assert.Equal(t, config.DefaultReputationTiers(), config.ReputationTiersFromEnv())
+}
@@ -0,0 +1,473 @@
+// Package doctor implements the startup self-check run by `chatgogo --doctor`. It checks the
+// environment configuration and every service the backend depends on, and reports all
+// problems at once instead of failing on the first one.
+package doctor
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/escalation"
+	"chatgogo/backend/internal/events"
+	"chatgogo/backend/internal/features"
+	"chatgogo/backend/internal/localization"
+	"chatgogo/backend/internal/migrations"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Status is the outcome of a single check.
+type Status int
+
+const (
+	// StatusOK means the check passed.
+	StatusOK Status = iota
+	// StatusWarn means the service starts, but a feature is disabled or degraded.
+	StatusWarn
+	// StatusFail means the service cannot start or will misbehave.
+	StatusFail
+)
+
+// String returns the label of the status used in the report.
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	// Check names what was checked (e.g., an environment variable or a service).
+	Check  string
+	Status Status
+	Detail string
+}
+
+// Report collects the results of all checks.
+type Report struct {
+	Results []Result
+}
+
+// Add appends results to the report.
+func (r *Report) Add(results ...Result) {
+	r.Results = append(r.Results, results...)
+}
+
+// Failed reports whether any check failed.
+func (r *Report) Failed() bool {
+	return slices.ContainsFunc(r.Results, func(result Result) bool { return result.Status == StatusFail })
+}
+
+// Write prints the report, one line per check, followed by a summary.
+func (r *Report) Write(w io.Writer) error {
+	counts := make(map[Status]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+		if _, err := fmt.Fprintf(w, "[%-4s] %s: %s\n", result.Status, result.Check, result.Detail); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n", counts[StatusOK], counts[StatusWarn], counts[StatusFail])
+	return err
+}
+
+// kind is the expected format of an environment variable.
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindNonNegativeInt
+	kindPositiveInt
+	kindNonNegativeFloat
+	kindDuration
+	kindPositiveDuration
+	kindBool
+	kindIDList
+	kindURL
+	kindHTTPSURL
+	kindPublicKeyFile
+	kindEventsFile
+	kindTransport
+	kindCommandThresholds
+	kindFeatureList
+)
+
+// variable describes an environment variable read by the backend.
+type variable struct {
+	name     string
+	required bool
+	kind     kind
+	// unsetWarning is reported when an optional variable is not set and leaving it unset
+	// disables a feature.
+	unsetWarning string
+	// replacedBy names a variable which, when set, makes a required variable optional.
+	replacedBy string
+	// requiredWith names a variable which, when set, makes an optional variable required.
+	requiredWith string
+}
+
+// variables lists the environment variables read by cmd/main.go and internal/config.
+// TestVariablesCoverGetenv fails when a variable the backend reads is missing here.
+var variables = []variable{
+	{name: "DB_HOST", required: true},
+	{name: "DB_PORT", required: true, kind: kindNonNegativeInt},
+	{name: "DB_USER", required: true},
+	{name: "DB_PASSWORD"},
+	{name: "DB_NAME", required: true},
+	{name: "DB_REPLICA_DSN"},
+	{name: "DB_SLOW_QUERY_THRESHOLD", kind: kindDuration},
+	{name: "REDIS_HOST", required: true, replacedBy: "REDIS_ADDRS"},
+	{name: "REDIS_PORT", required: true, kind: kindNonNegativeInt, replacedBy: "REDIS_ADDRS"},
+	{name: "REDIS_ADDRS"},
+	{name: "REDIS_PASSWORD"},
+	{name: "REDIS_DB", kind: kindNonNegativeInt},
+	{name: "REDIS_SENTINEL_MASTER"},
+	{name: "REDIS_SENTINEL_PASSWORD"},
+	{name: "REDIS_CLUSTER", kind: kindBool},
+	{name: "MIGRATE_ON_START", kind: kindBool},
+	{name: "TELEGRAM_BOT_TOKEN", required: true},
+	{name: "ADMIN_TELEGRAM_IDS", kind: kindIDList, unsetWarning: "no administrators, moderation commands are disabled"},
+	{name: "MODERATOR_PUBLIC_KEY_FILE", kind: kindPublicKeyFile, unsetWarning: "critical complaints will not be escalated"},
+	{name: "MATCHER_MIN_INTEREST_OVERLAP", kind: kindNonNegativeInt},
+	{name: "MATCHER_SEARCH_TIMEOUT", kind: kindDuration},
+	{name: "MATCHER_SCAN_INTERVAL", kind: kindPositiveDuration},
+	{name: "MATCHER_REMATCH_COOLDOWN", kind: kindDuration},
+	{name: "MATCHER_SAME_PAIR_COOLDOWN", kind: kindDuration},
+	{name: "MATCHER_RELAX_AFTER", kind: kindDuration},
+	{name: "MATCHER_REQUEUE_ON_NEXT", kind: kindBool},
+	{name: "MATCHER_LEADER_ELECTION", kind: kindBool},
+	{name: "MATCHER_LEADER_LEASE_TTL", kind: kindPositiveDuration},
+	{name: "REPUTATION_LOW_MAX", kind: kindInt},
+	{name: "REPUTATION_HIGH_MIN", kind: kindInt},
+	{name: "MATCHER_SKIP_LIMIT", kind: kindNonNegativeInt},
+	{name: "MATCHER_SKIP_COOLDOWN", kind: kindPositiveDuration},
+	{name: "MATCHER_FLOOD_MIN_DEMAND", kind: kindNonNegativeInt},
+	{name: "MATCHER_FLOODED_SEARCH_TIMEOUT", kind: kindDuration},
+	{name: "MATCHER_REQUEST_QUEUE_SIZE", kind: kindPositiveInt},
+	{name: "SEARCH_QUEUE_MAX_AGE", kind: kindDuration},
+	{name: "REPUTATION_LOW_MAX", kind: kindInt},
+	{name: "REPUTATION_HIGH_MIN", kind: kindInt},
+	{name: "HUB_CHANNEL_BUFFER", kind: kindPositiveInt},
+	{name: "CLIENT_REGISTRY", kind: kindBool},
+	{name: "WS_SEND_BUFFER", kind: kindPositiveInt},
+	{name: "WS_DISCONNECT_GRACE", kind: kindDuration},
+	{name: "PRESENCE_TTL", kind: kindDuration},
+	{name: "OFFLINE_MESSAGE_TTL", kind: kindDuration},
+	{name: "DEAD_CLIENT_TIMEOUT", kind: kindDuration},
+	{name: "ROOM_IDLE_TIMEOUT", kind: kindDuration},
+	{name: "HISTORY_RETENTION", kind: kindDuration},
+	{name: "MESSAGE_TRANSPORT", kind: kindTransport},
+	{name: "MESSAGE_STREAM_CONSUMER"},
+	{name: "MESSAGE_BATCH_WRITES", kind: kindBool},
+	{name: "MESSAGE_BATCH_INTERVAL", kind: kindDuration},
+	{name: "MESSAGE_RATE_LIMIT", kind: kindNonNegativeFloat},
+	{name: "MESSAGE_BURST", kind: kindNonNegativeInt},
+	{name: "COMMAND_ABUSE_THRESHOLDS", kind: kindCommandThresholds},
+	{name: "TELEGRAM_SEND_BUFFER", kind: kindPositiveInt},
+	{name: "TELEGRAM_SEND_WORKERS", kind: kindNonNegativeInt},
+	{name: "SUPERADMIN_TELEGRAM_IDS", kind: kindIDList},
+	{name: "LABS_DISABLED_FEATURES", kind: kindFeatureList},
+	{name: "ANONYMIZATION_KEY", unsetWarning: "pseudonyms in exports, analytics and the admin API change on every restart"},
+	{name: "ARCHIVE_S3_BUCKET"},
+	{name: "ARCHIVE_S3_ENDPOINT", kind: kindURL, requiredWith: "ARCHIVE_S3_BUCKET"},
+	{name: "ARCHIVE_S3_REGION"},
+	{name: "ARCHIVE_S3_ACCESS_KEY"},
+	{name: "ARCHIVE_S3_SECRET_KEY"},
+	{name: "ARCHIVE_AFTER", kind: kindPositiveDuration},
+	{name: "MEDIA_S3_BUCKET"},
+	{name: "MEDIA_S3_ENDPOINT", kind: kindURL, requiredWith: "MEDIA_S3_BUCKET"},
+	{name: "MEDIA_S3_REGION"},
+	{name: "MEDIA_S3_ACCESS_KEY"},
+	{name: "MEDIA_S3_SECRET_KEY"},
+	{name: "MEDIA_PUBLIC_URL", kind: kindURL},
+	{name: "EVENTS_FILE", kind: kindEventsFile},
+	{name: "WEBAPP_URL", kind: kindHTTPSURL},
+}
+
+// CheckEnvironment checks that every required variable is set and every set variable has
+// the expected format. Values are read with getenv, normally os.Getenv.
+func CheckEnvironment(getenv func(string) string) []Result {
+	var results []Result
+	for _, v := range variables {
+		value := getenv(v.name)
+		if value == "" {
+			switch {
+			case v.required && (v.replacedBy == "" || getenv(v.replacedBy) == ""):
+				results = append(results, Result{v.name, StatusFail, "not set"})
+			case v.requiredWith != "" && getenv(v.requiredWith) != "":
+				results = append(results, Result{v.name, StatusFail, "not set, but " + v.requiredWith + " is"})
+			case v.unsetWarning != "":
+				results = append(results, Result{v.name, StatusWarn, "not set, " + v.unsetWarning})
+			}
+			continue
+		}
+		if err := validate(v.kind, value); err != nil {
+			results = append(results, Result{v.name, StatusFail, err.Error()})
+			continue
+		}
+		results = append(results, Result{v.name, StatusOK, "set"})
+	}
+
+	if getenv("REDIS_ADDR") != "" {
+		results = append(results, Result{"REDIS_ADDR", StatusWarn, "not used, set REDIS_HOST and REDIS_PORT, or REDIS_ADDRS, instead"})
+	}
+	if getenv("REDIS_SENTINEL_MASTER") != "" && getenv("REDIS_CLUSTER") == "true" {
+		results = append(results, Result{"REDIS_CLUSTER", StatusWarn,
+			"combined with REDIS_SENTINEL_MASTER, the Sentinel master and its replicas are used like a cluster"})
+	}
+	cluster := getenv("REDIS_CLUSTER") == "true" || strings.Contains(getenv("REDIS_ADDRS"), ",") && getenv("REDIS_SENTINEL_MASTER") == ""
+	if cluster && getenv("MESSAGE_TRANSPORT") == "streams" {
+		results = append(results, Result{"MESSAGE_TRANSPORT", StatusFail, "streams are not supported with Redis Cluster, use pubsub"})
+	}
+	if getenv("MESSAGE_TRANSPORT") == "streams" && getenv("MESSAGE_STREAM_CONSUMER") == "" {
+		results = append(results, Result{"MESSAGE_STREAM_CONSUMER", StatusFail, "not set, but MESSAGE_TRANSPORT is streams"})
+	}
+	low, lowErr := strconv.Atoi(getenv("REPUTATION_LOW_MAX"))
+	high, highErr := strconv.Atoi(getenv("REPUTATION_HIGH_MIN"))
+	if lowErr == nil && highErr == nil && high <= low {
+		results = append(results, Result{"REPUTATION_LOW_MAX/REPUTATION_HIGH_MIN", StatusWarn,
+			"the high tier must start above the low tier, the defaults are used instead"})
+	}
+	return results
+}
+
+// validate checks a set value against its expected format.
+func validate(k kind, value string) error {
+	switch k {
+	case kindInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+	case kindNonNegativeInt:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("invalid non-negative integer %q", value)
+		}
+	case kindPositiveInt:
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			return fmt.Errorf("invalid positive integer %q", value)
+		}
+	case kindNonNegativeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 {
+			return fmt.Errorf("invalid non-negative number %q", value)
+		}
+	case kindDuration:
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("invalid duration %q (e.g., 30s, 5m, 0 to disable)", value)
+		}
+	case kindPositiveDuration:
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid positive duration %q (e.g., 5s)", value)
+		}
+	case kindBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("invalid value %q, use true or false", value)
+		}
+	case kindIDList:
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if _, err := strconv.ParseInt(part, 10, 64); err != nil {
+				return fmt.Errorf("invalid Telegram user ID %q", part)
+			}
+		}
+	case kindURL:
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q is not an HTTP(S) URL", value)
+		}
+	case kindHTTPSURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%q is not an HTTPS URL", value)
+		}
+	case kindPublicKeyFile:
+		if _, err := escalation.LoadPublicKey(value); err != nil {
+			return err
+		}
+	case kindEventsFile:
+		if err := events.NewSchedule(value).Reload(); err != nil {
+			return err
+		}
+	case kindTransport:
+		if value != "pubsub" && value != "streams" {
+			return fmt.Errorf("invalid transport %q, use pubsub or streams", value)
+		}
+	case kindCommandThresholds:
+		if _, err := chathub.ParseCommandAbuseThresholds(value); err != nil {
+			return fmt.Errorf("invalid thresholds %q: %v", value, err)
+		}
+	case kindFeatureList:
+		for _, feature := range strings.Split(value, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" && !features.IsLab(feature) {
+				return fmt.Errorf("unknown feature %q, use one of %s", feature, strings.Join(features.Labs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// CheckDatabase checks that the database is reachable and its schema matches the given
+// models: every table and column of the models must exist.
+func CheckDatabase(db *gorm.DB, models ...any) []Result {
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	if err != nil {
+		return []Result{{"database", StatusFail, fmt.Sprintf("unreachable: %v", err)}}
+	}
+	results := []Result{{"database", StatusOK, "reachable"}}
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			results = append(results, Result{"schema", StatusFail, fmt.Sprintf("failed to parse model %T: %v", model, err)})
+			continue
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(model) {
+			results = append(results, Result{"schema " + table, StatusFail, "table is missing, run migrations with --migrate up"})
+			continue
+		}
+		var missing []string
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				missing = append(missing, field.DBName)
+			}
+		}
+		if len(missing) > 0 {
+			results = append(results, Result{"schema " + table, StatusFail,
+				fmt.Sprintf("missing columns %s, run migrations with --migrate up", strings.Join(missing, ", "))})
+			continue
+		}
+		results = append(results, Result{"schema " + table, StatusOK, "up to date"})
+	}
+	return results
+}
+
+// CheckMigrations checks that every migration of the build was applied to the database. A
+// migration the build does not know, e.g. after rolling back to an older release, is only a
+// warning.
+func CheckMigrations(m *migrations.Migrator) Result {
+	statuses, unknown, err := m.Status()
+	if err != nil {
+		return Result{"migrations", StatusFail, fmt.Sprintf("failed to read status: %v", err)}
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.Dirty {
+			return Result{"migrations", StatusFail, fmt.Sprintf("%04d_%s failed halfway, fix the schema and force its version", status.Version, status.Name)}
+		}
+		if !status.Applied {
+			pending = append(pending, fmt.Sprintf("%04d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return Result{"migrations", StatusFail, fmt.Sprintf("pending %s, run migrations with --migrate up", strings.Join(pending, ", "))}
+	}
+	if unknown > 0 {
+		return Result{"migrations", StatusWarn, fmt.Sprintf("database is at %04d, newer than this build", unknown)}
+	}
+	if len(statuses) == 0 {
+		return Result{"migrations", StatusOK, "none known"}
+	}
+	latest := statuses[len(statuses)-1]
+	return Result{"migrations", StatusOK, fmt.Sprintf("up to date at %04d_%s", latest.Version, latest.Name)}
+}
+
+// CheckRedis checks that Redis is reachable. addr describes where it is expected.
+func CheckRedis(ctx context.Context, rdb redis.UniversalClient, addr string) Result {
+	start := time.Now()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return Result{"redis", StatusFail, fmt.Sprintf("unreachable at %s: %v", addr, err)}
+	}
+	return Result{"redis", StatusOK, fmt.Sprintf("reachable at %s (%v)", addr, time.Since(start).Round(time.Millisecond))}
+}
+
+// CheckBotToken checks that the Telegram Bot API accepts the token. apiEndpoint is
+// normally tgbotapi.APIEndpoint.
+func CheckBotToken(token, apiEndpoint string) Result {
+	if token == "" {
+		return Result{"telegram", StatusFail, "TELEGRAM_BOT_TOKEN is not set"}
+	}
+	bot, err := tgbotapi.NewBotAPIWithClient(token, apiEndpoint, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return Result{"telegram", StatusFail, fmt.Sprintf("token rejected: %v", err)}
+	}
+	return Result{"telegram", StatusOK, "authorized as @" + bot.Self.UserName}
+}
+
+// placeholderPattern matches the fmt verbs of a translation.
+var placeholderPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+
+// CheckLocales checks that every language has the keys of the base language, with the
+// same format placeholders. Missing keys fall back to the base language and are only a
+// warning; mismatched placeholders garble the message and fail the check.
+func CheckLocales(l *localization.Localizer, base string) []Result {
+	baseKeys := l.Keys(base)
+	if baseKeys == nil {
+		return []Result{{"locale " + base, StatusFail, "base language catalog is missing"}}
+	}
+
+	var results []Result
+	for _, lang := range l.Languages() {
+		if lang == base {
+			continue
+		}
+		keys := l.Keys(lang)
+		var missing, extra, mismatched []string
+		for _, key := range baseKeys {
+			if !slices.Contains(keys, key) {
+				missing = append(missing, key)
+			} else if !slices.Equal(placeholders(l.GetString(base, key)), placeholders(l.GetString(lang, key))) {
+				mismatched = append(mismatched, key)
+			}
+		}
+		for _, key := range keys {
+			if !slices.Contains(baseKeys, key) {
+				extra = append(extra, key)
+			}
+		}
+
+		check := "locale " + lang
+		if len(mismatched) > 0 {
+			results = append(results, Result{check, StatusFail, "placeholders differ from " + base + ": " + strings.Join(mismatched, ", ")})
+		}
+		if len(missing) > 0 {
+			results = append(results, Result{check, StatusWarn, "missing keys: " + strings.Join(missing, ", ")})
+		}
+		if len(extra) > 0 {
+			results = append(results, Result{check, StatusWarn, "keys not in " + base + ": " + strings.Join(extra, ", ")})
+		}
+		if len(mismatched)+len(missing)+len(extra) == 0 {
+			results = append(results, Result{check, StatusOK, fmt.Sprintf("%d keys, consistent with %s", len(keys), base)})
+		}
+	}
+	return results
+}
+
+// placeholders returns the fmt verbs of a translation, in order, without escaped percent signs.
+func placeholders(s string) []string {
+	var verbs []string
+	for _, verb := range placeholderPattern.FindAllString(s, -1) {
+		if verb != "%%" {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs
+}
@@ -0,0 +1,194 @@
+package doctor
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/localization"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envOf(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func resultOf(t *testing.T, results []Result, check string) Result {
+	t.Helper()
+	for _, result := range results {
+		if result.Check == check {
+			return result
+		}
+	}
+	t.Fatalf("no result for %s in %v", check, results)
+	return Result{}
+}
+
+func validEnv() map[string]string {
+	return map[string]string{
+		"DB_HOST": "localhost", "DB_PORT": "5432", "DB_USER": "user", "DB_NAME": "chatgogodb",
+		"REDIS_HOST": "localhost", "REDIS_PORT": "6379", "TELEGRAM_BOT_TOKEN": "123:abc",
+		"ADMIN_TELEGRAM_IDS": "1, 2", "MATCHER_SEARCH_TIMEOUT": "0", "ANONYMIZATION_KEY": "secret",
+	}
+}
+
+func TestCheckEnvironment(t *testing.T) {
+	env := validEnv()
+	results := CheckEnvironment(envOf(env))
+	for _, result := range results {
+		if result.Check != "MODERATOR_PUBLIC_KEY_FILE" {
+			assert.Equal(t, StatusOK, result.Status, result.Check)
+		}
+	}
+	assert.Equal(t, StatusWarn, resultOf(t, results, "MODERATOR_PUBLIC_KEY_FILE").Status)
+
+	delete(env, "REDIS_HOST")
+	env["REDIS_ADDR"] = "localhost:6379"
+	env["MATCHER_SCAN_INTERVAL"] = "0"
+	env["MATCHER_LEADER_ELECTION"] = "yes"
+	env["WEBAPP_URL"] = "http://example.com/webapp"
+	env["REPUTATION_LOW_MAX"], env["REPUTATION_HIGH_MIN"] = "5", "5"
+	env["HUB_CHANNEL_BUFFER"] = "0"
+	env["MESSAGE_RATE_LIMIT"] = "-1"
+	env["COMMAND_ABUSE_THRESHOLDS"] = "next=3,unknown=1"
+	env["LABS_DISABLED_FEATURES"] = "icebreakers, teleport"
+	env["MEDIA_S3_BUCKET"] = "media"
+	env["MESSAGE_TRANSPORT"] = "streams"
+	results = CheckEnvironment(envOf(env))
+
+	assert.Equal(t, Result{"REDIS_HOST", StatusFail, "not set"}, resultOf(t, results, "REDIS_HOST"))
+	assert.Equal(t, StatusWarn, resultOf(t, results, "REDIS_ADDR").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "MATCHER_SCAN_INTERVAL").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "MATCHER_LEADER_ELECTION").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "WEBAPP_URL").Status)
+	assert.Equal(t, StatusWarn, resultOf(t, results, "REPUTATION_LOW_MAX/REPUTATION_HIGH_MIN").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "HUB_CHANNEL_BUFFER").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "MESSAGE_RATE_LIMIT").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "COMMAND_ABUSE_THRESHOLDS").Status)
+	assert.Equal(t, StatusFail, resultOf(t, results, "LABS_DISABLED_FEATURES").Status)
+	assert.Equal(t, Result{"MEDIA_S3_ENDPOINT", StatusFail, "not set, but MEDIA_S3_BUCKET is"}, resultOf(t, results, "MEDIA_S3_ENDPOINT"))
+	assert.Equal(t, Result{"MESSAGE_STREAM_CONSUMER", StatusFail, "not set, but MESSAGE_TRANSPORT is streams"}, resultOf(t, results, "MESSAGE_STREAM_CONSUMER"))
+}
+
+// getenvPattern matches the variables read with os.Getenv.
+var getenvPattern = regexp.MustCompile(`Getenv\("([A-Z0-9_]+)"\)`)
+
+// TestVariablesCoverGetenv keeps variables in sync with the code: every variable the backend
+// reads must be checked. The integration tests read their own variables and are skipped.
+func TestVariablesCoverGetenv(t *testing.T) {
+	known := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		known[v.name] = true
+	}
+	for _, root := range []string{filepath.Join("..", "..", "cmd"), ".."} {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == "integration" {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			source, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, match := range getenvPattern.FindAllStringSubmatch(string(source), -1) {
+				assert.True(t, known[match[1]], "%s reads %s, which is not in variables", path, match[1])
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestCheckEnvironment_RedisAddrs(t *testing.T) {
+	env := validEnv()
+	delete(env, "REDIS_HOST")
+	delete(env, "REDIS_PORT")
+	env["REDIS_ADDRS"] = "redis-1:6379, redis-2:6379"
+	env["MESSAGE_TRANSPORT"] = "streams"
+	env["MESSAGE_STREAM_CONSUMER"] = "chatgogo-0"
+	results := CheckEnvironment(envOf(env))
+
+	assert.Equal(t, StatusOK, resultOf(t, results, "REDIS_ADDRS").Status)
+	for _, result := range results {
+		assert.NotEqual(t, "REDIS_HOST", result.Check)
+	}
+	assert.Contains(t, results, Result{"MESSAGE_TRANSPORT", StatusFail, "streams are not supported with Redis Cluster, use pubsub"})
+
+	env["REDIS_SENTINEL_MASTER"] = "mymaster"
+	results = CheckEnvironment(envOf(env))
+	for _, result := range results {
+		assert.NotEqual(t, StatusFail, result.Status, result.Check)
+	}
+}
+
+func TestCheckLocales(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("en.json", `{"hello": "Hello", "count": "%d of %d (%d%%)", "bye": "Bye"}`)
+	write("ru.json", `{"hello": "Привет", "count": "%d из %d (%d%%)", "bye": "Пока"}`)
+	write("ua.json", `{"hello": "Привіт", "count": "%s з %d", "extra": "!"}`)
+	l, err := localization.NewLocalizer(dir)
+	require.NoError(t, err)
+
+	results := CheckLocales(l, "en")
+
+	assert.Equal(t, []Result{
+		{"locale ru", StatusOK, "3 keys, consistent with en"},
+		{"locale ua", StatusFail, "placeholders differ from en: count"},
+		{"locale ua", StatusWarn, "missing keys: bye"},
+		{"locale ua", StatusWarn, "keys not in en: extra"},
+	}, results)
+	assert.Equal(t, StatusFail, CheckLocales(l, "de")[0].Status)
+}
+
+func TestCheckLocalesOfRepository(t *testing.T) {
+	l, err := localization.NewLocalizer(filepath.Join("..", "localization"))
+	require.NoError(t, err)
+
+	for _, result := range CheckLocales(l, "en") {
+		assert.Equal(t, StatusOK, result.Status, "%s: %s", result.Check, result.Detail)
+	}
+}
+
+func TestCheckBotToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/botgood/getMe" {
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"chatgogo_bot"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	}))
+	defer server.Close()
+	endpoint := server.URL + "/bot%s/%s"
+
+	assert.Equal(t, Result{"telegram", StatusOK, "authorized as @chatgogo_bot"}, CheckBotToken("good", endpoint))
+	assert.Equal(t, StatusFail, CheckBotToken("bad", endpoint).Status)
+	assert.Equal(t, StatusFail, CheckBotToken("", endpoint).Status)
+}
+
+func TestReport(t *testing.T) {
+	report := &Report{}
+	report.Add(Result{"redis", StatusOK, "reachable"}, Result{"WEBAPP_URL", StatusWarn, "not set"})
+	assert.False(t, report.Failed())
+	report.Add(Result{"DB_HOST", StatusFail, "not set"})
+	assert.True(t, report.Failed())
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	assert.Equal(t, "[OK  ] redis: reachable\n[WARN] WEBAPP_URL: not set\n[FAIL] DB_HOST: not set\n\n1 passed, 1 warnings, 1 failed\n", buf.String())
+}
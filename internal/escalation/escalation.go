@@ -0,0 +1,233 @@
+// Package escalation prepares sealed chat transcripts for legal escalation of
+// confirmed critical complaints. Transcripts are encrypted with the moderator
+// public key so that only holders of the moderator private key can read them.
+package escalation
+
+import (
+	"chatgogo/backend/internal/models"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// bundleVersion is the format version of SealedBundle.
+const bundleVersion = 1
+
+// Store defines the storage methods required to build and attach transcripts.
+type Store interface {
+	GetComplaintByID(id uint) (*models.Complaint, error)
+	UpdateComplaint(complaint *models.Complaint) error
+	GetRoomByID(roomID string) (*models.ChatRoom, error)
+	GetChatHistory(roomID string) ([]models.ChatHistory, error)
+	GetUserByID(userID string) (*models.User, error)
+}
+
+// Participant holds the deanonymized identifiers of a room participant.
+type Participant struct {
+	UserID     string `json:"user_id"`
+	TelegramID int64  `json:"telegram_id"`
+}
+
+// Transcript is the plaintext content of a sealed bundle.
+type Transcript struct {
+	Complaint    models.Complaint     `json:"complaint"`
+	Room         models.ChatRoom      `json:"room"`
+	Participants []Participant        `json:"participants"`
+	History      []models.ChatHistory `json:"history"`
+	GeneratedAt  time.Time            `json:"generated_at"`
+}
+
+// SealedBundle is the encrypted form of a Transcript. The transcript is encrypted with
+// a random AES-256-GCM key, which in turn is encrypted with the moderator RSA key (OAEP).
+type SealedBundle struct {
+	Version      int    `json:"version"`
+	EncryptedKey []byte `json:"encrypted_key"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Service attaches sealed transcripts to confirmed critical complaints.
+type Service struct {
+	Storage   Store
+	PublicKey *rsa.PublicKey
+}
+
+// NewService creates and returns a new escalation Service.
+func NewService(s Store, publicKey *rsa.PublicKey) *Service {
+	return &Service{Storage: s, PublicKey: publicKey}
+}
+
+// LoadPublicKey reads a PEM-encoded RSA public key (PKIX or PKCS#1) from a file.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderator public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("moderator public key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse moderator public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("moderator public key is not an RSA key")
+	}
+	return key, nil
+}
+
+// HandleConfirmedComplaint builds, seals and attaches a transcript bundle to a complaint
+// if it is confirmed and critical. Other complaints are left untouched.
+func (s *Service) HandleConfirmedComplaint(complaintID uint) error {
+	complaint, err := s.Storage.GetComplaintByID(complaintID)
+	if err != nil {
+		return fmt.Errorf("failed to load complaint %d: %w", complaintID, err)
+	}
+	if complaint.Status != models.ComplaintStatusConfirmed || complaint.Severity != models.ComplaintSeverityCritical {
+		return nil
+	}
+
+	transcript, err := s.buildTranscript(complaint)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := Seal(transcript, s.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to seal transcript for complaint %d: %w", complaintID, err)
+	}
+
+	now := time.Now()
+	complaint.TranscriptBundle = string(bundle)
+	complaint.EscalatedAt = &now
+	if err := s.Storage.UpdateComplaint(complaint); err != nil {
+		return fmt.Errorf("failed to attach transcript to complaint %d: %w", complaintID, err)
+	}
+
+	log.Printf("Sealed transcript attached to critical complaint %d (room %s).", complaintID, complaint.RoomID)
+	return nil
+}
+
+// buildTranscript collects the room metadata, full history and participant identities.
+func (s *Service) buildTranscript(complaint *models.Complaint) (*Transcript, error) {
+	room, err := s.Storage.GetRoomByID(complaint.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load room %s: %w", complaint.RoomID, err)
+	}
+
+	history, err := s.Storage.GetChatHistory(complaint.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history of room %s: %w", complaint.RoomID, err)
+	}
+
+	transcript := &Transcript{
+		Complaint:   *complaint,
+		Room:        *room,
+		History:     history,
+		GeneratedAt: time.Now(),
+	}
+	transcript.Complaint.TranscriptBundle = ""
+
+	for _, userID := range []string{room.User1ID, room.User2ID} {
+		participant := Participant{UserID: userID}
+		if user, err := s.Storage.GetUserByID(userID); err == nil {
+			participant.TelegramID = user.TelegramID
+		}
+		transcript.Participants = append(transcript.Participants, participant)
+	}
+	return transcript, nil
+}
+
+// Seal encrypts a transcript for the holder of the private key matching publicKey and
+// returns the JSON-encoded SealedBundle.
+func Seal(transcript *Transcript, publicKey *rsa.PublicKey) ([]byte, error) {
+	if publicKey == nil {
+		return nil, errors.New("moderator public key is not configured")
+	}
+
+	plaintext, err := json.Marshal(transcript)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(SealedBundle{
+		Version:      bundleVersion,
+		EncryptedKey: encryptedKey,
+		Nonce:        nonce,
+		Ciphertext:   gcm.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// Open decrypts a JSON-encoded SealedBundle with the moderator private key.
+func Open(bundle []byte, privateKey *rsa.PrivateKey) (*Transcript, error) {
+	var sealed SealedBundle
+	if err := json.Unmarshal(bundle, &sealed); err != nil {
+		return nil, err
+	}
+	if sealed.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", sealed.Version)
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, sealed.EncryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, sealed.Nonce, sealed.Ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcript Transcript
+	if err := json.Unmarshal(plaintext, &transcript); err != nil {
+		return nil, err
+	}
+	return &transcript, nil
+}
+
+// newGCM creates an AES-GCM cipher for the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,93 @@
+package escalation_test
+
+import (
+	"chatgogo/backend/internal/escalation"
+	"chatgogo/backend/internal/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore is an in-memory implementation of escalation.Store.
+type fakeStore struct {
+	complaint *models.Complaint
+	room      *models.ChatRoom
+	history   []models.ChatHistory
+	users     map[string]*models.User
+	updated   *models.Complaint
+}
+
+func (f *fakeStore) GetComplaintByID(id uint) (*models.Complaint, error) {
+	if f.complaint == nil || f.complaint.ID != id {
+		return nil, errors.New("complaint not found")
+	}
+	c := *f.complaint
+	return &c, nil
+}
+
+func (f *fakeStore) UpdateComplaint(complaint *models.Complaint) error {
+	f.updated = complaint
+	return nil
+}
+
+func (f *fakeStore) GetRoomByID(roomID string) (*models.ChatRoom, error) { return f.room, nil }
+
+func (f *fakeStore) GetChatHistory(roomID string) ([]models.ChatHistory, error) {
+	return f.history, nil
+}
+
+func (f *fakeStore) GetUserByID(userID string) (*models.User, error) {
+	if user, ok := f.users[userID]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func newFakeStore(severity string) *fakeStore {
+	complaint := &models.Complaint{RoomID: "room1", ReporterID: "user_A", SuspectID: "user_B",
+		Status: models.ComplaintStatusConfirmed, Severity: severity}
+	complaint.ID = 7
+	return &fakeStore{
+		complaint: complaint,
+		room:      &models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"},
+		history:   []models.ChatHistory{{RoomID: "room1", SenderID: "user_B", Content: "threat", Type: "text"}},
+		users: map[string]*models.User{
+			"user_A": {ID: "user_A", TelegramID: 111},
+			"user_B": {ID: "user_B", TelegramID: 222},
+		},
+	}
+}
+
+func TestHandleConfirmedComplaint_AttachesSealedTranscript(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	store := newFakeStore(models.ComplaintSeverityCritical)
+	service := escalation.NewService(store, &privateKey.PublicKey)
+
+	require.NoError(t, service.HandleConfirmedComplaint(7))
+
+	require.NotNil(t, store.updated)
+	assert.NotNil(t, store.updated.EscalatedAt)
+	assert.NotContains(t, store.updated.TranscriptBundle, "threat", "bundle must be encrypted")
+
+	transcript, err := escalation.Open([]byte(store.updated.TranscriptBundle), privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, "room1", transcript.Room.RoomID)
+	assert.Equal(t, "threat", transcript.History[0].Content)
+	assert.ElementsMatch(t, []escalation.Participant{{UserID: "user_A", TelegramID: 111}, {UserID: "user_B", TelegramID: 222}}, transcript.Participants)
+}
+
+func TestHandleConfirmedComplaint_IgnoresNonCritical(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	store := newFakeStore(models.ComplaintSeverityNormal)
+	service := escalation.NewService(store, &privateKey.PublicKey)
+
+	require.NoError(t, service.HandleConfirmedComplaint(7))
+
+	assert.Nil(t, store.updated)
+}
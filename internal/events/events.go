@@ -0,0 +1,180 @@
+// Package events implements scheduled themed periods (e.g., a "movie night" queue or a
+// double-reputation weekend). Events are described in a JSON configuration file, so admins
+// can schedule them without code changes; the file is re-read whenever it is modified.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single scheduled themed period.
+type Event struct {
+	// ID uniquely identifies the event; it is used to announce each event only once.
+	ID string `json:"id"`
+	// Name is a human-readable title, used in logs and as a fallback announcement.
+	Name     string    `json:"name"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// ThemeInterests are interests the matcher favors while the event is active: every
+	// theme interest shared by both users counts as an extra shared interest.
+	ThemeInterests []string `json:"theme_interests,omitempty"`
+	// ReputationMultiplier scales reputation rewards for good chats (e.g., 2 for a
+	// double-reputation weekend). Values below 1 are treated as 1.
+	ReputationMultiplier int `json:"reputation_multiplier,omitempty"`
+	// Announcement holds the opt-in announcement text by language code.
+	Announcement map[string]string `json:"announcement,omitempty"`
+}
+
+// IsActive reports whether the event is running at the given time.
+func (e Event) IsActive(now time.Time) bool {
+	return !now.Before(e.StartsAt) && now.Before(e.EndsAt)
+}
+
+// AnnouncementFor returns the announcement text in the given language, falling back to
+// English and then to the event name.
+func (e Event) AnnouncementFor(lang string) string {
+	if text, ok := e.Announcement[lang]; ok && text != "" {
+		return text
+	}
+	if text, ok := e.Announcement["en"]; ok && text != "" {
+		return text
+	}
+	return e.Name
+}
+
+// Schedule holds the configured events. All methods are safe for concurrent use,
+// and a nil *Schedule behaves as an empty schedule.
+type Schedule struct {
+	// Path is the JSON configuration file. If empty, events are only set via SetEvents.
+	Path string
+
+	mu      sync.RWMutex
+	events  []Event
+	modTime time.Time
+}
+
+// NewSchedule creates a Schedule backed by the configuration file at path.
+// Call Reload to load it.
+func NewSchedule(path string) *Schedule {
+	return &Schedule{Path: path}
+}
+
+// Reload re-reads the configuration file if it changed since the last load.
+// On error, the previously loaded events are kept.
+func (s *Schedule) Reload() error {
+	if s == nil || s.Path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to stat events file: %w", err)
+	}
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read events file: %w", err)
+	}
+	var events []Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return fmt.Errorf("failed to parse events file: %w", err)
+	}
+	if err := validate(events); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.events = events
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// validate checks that every event has a unique ID and a valid time window.
+func validate(events []Event) error {
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		if event.ID == "" {
+			return errors.New("event without id in events file")
+		}
+		if seen[event.ID] {
+			return fmt.Errorf("duplicate event id %q in events file", event.ID)
+		}
+		seen[event.ID] = true
+		if !event.EndsAt.After(event.StartsAt) {
+			return fmt.Errorf("event %q must end after it starts", event.ID)
+		}
+	}
+	return nil
+}
+
+// SetEvents replaces the configured events.
+func (s *Schedule) SetEvents(events []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = events
+}
+
+// Active returns the events running at the given time.
+func (s *Schedule) Active(now time.Time) []Event {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var active []Event
+	for _, event := range s.events {
+		if event.IsActive(now) {
+			active = append(active, event)
+		}
+	}
+	return active
+}
+
+// ReputationMultiplier returns the highest reputation multiplier among the events active
+// at the given time, or 1 if there is none.
+func (s *Schedule) ReputationMultiplier(now time.Time) int {
+	multiplier := 1
+	for _, event := range s.Active(now) {
+		multiplier = max(multiplier, event.ReputationMultiplier)
+	}
+	return multiplier
+}
+
+// ThemeBonus returns the number of active theme interests listed by both users.
+func (s *Schedule) ThemeBonus(now time.Time, a, b []string) int {
+	bonus := 0
+	for _, event := range s.Active(now) {
+		for _, theme := range event.ThemeInterests {
+			if hasInterest(a, theme) && hasInterest(b, theme) {
+				bonus++
+			}
+		}
+	}
+	return bonus
+}
+
+// hasInterest reports whether interests contains the given interest, ignoring case
+// and surrounding whitespace.
+func hasInterest(interests []string, interest string) bool {
+	interest = strings.ToLower(strings.TrimSpace(interest))
+	for _, candidate := range interests {
+		if strings.ToLower(strings.TrimSpace(candidate)) == interest {
+			return true
+		}
+	}
+	return false
+}
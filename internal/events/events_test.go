@@ -0,0 +1,63 @@
+package events_test
+
+import (
+	"chatgogo/backend/internal/events"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleActiveEvents(t *testing.T) {
+	now := time.Now()
+	schedule := events.NewSchedule("")
+	schedule.SetEvents([]events.Event{
+		{ID: "movie_night", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), ThemeInterests: []string{"Movies"}},
+		{ID: "double_rep", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), ReputationMultiplier: 2},
+		{ID: "past", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour), ReputationMultiplier: 5},
+	})
+
+	assert.Len(t, schedule.Active(now), 2)
+	assert.Equal(t, 2, schedule.ReputationMultiplier(now))
+	assert.Equal(t, 1, schedule.ReputationMultiplier(now.Add(2*time.Hour)))
+	assert.Equal(t, 1, schedule.ThemeBonus(now, []string{"movies", "chess"}, []string{" MOVIES "}))
+	assert.Equal(t, 0, schedule.ThemeBonus(now, []string{"movies"}, []string{"chess"}))
+}
+
+func TestNilScheduleIsEmpty(t *testing.T) {
+	var schedule *events.Schedule
+	assert.NoError(t, schedule.Reload())
+	assert.Empty(t, schedule.Active(time.Now()))
+	assert.Equal(t, 1, schedule.ReputationMultiplier(time.Now()))
+}
+
+func TestScheduleReloadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"id": "movie_night", "name": "Movie night", "starts_at": "2026-01-01T18:00:00Z", "ends_at": "2026-01-01T23:00:00Z",
+		 "theme_interests": ["movies"], "announcement": {"en": "Movie night!", "ua": "Кіновечір!"}}
+	]`), 0o644))
+
+	schedule := events.NewSchedule(path)
+	require.NoError(t, schedule.Reload())
+
+	active := schedule.Active(time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC))
+	require.Len(t, active, 1)
+	assert.Equal(t, "Кіновечір!", active[0].AnnouncementFor("ua"))
+	assert.Equal(t, "Movie night!", active[0].AnnouncementFor("ru"))
+}
+
+func TestScheduleReloadKeepsEventsOnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": "a", "starts_at": "2026-01-01T18:00:00Z", "ends_at": "2026-01-02T18:00:00Z"}]`), 0o644))
+	schedule := events.NewSchedule(path)
+	require.NoError(t, schedule.Reload())
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id": "b", "starts_at": "2026-01-02T18:00:00Z", "ends_at": "2026-01-01T18:00:00Z"}]`), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.Error(t, schedule.Reload())
+	assert.Len(t, schedule.Active(time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)), 1)
+}
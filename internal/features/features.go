@@ -0,0 +1,94 @@
+// Package features implements feature flags for experimental features. Operators switch
+// experimental features on or off for the whole service, and each user opts into the
+// features that are on individually, in the /labs menu, so risky features reach volunteers
+// first.
+package features
+
+import (
+	"chatgogo/backend/internal/models"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Experimental features users can opt into in /labs. Each must be checked with
+// Service.Enabled by the code it gates.
+const (
+	// Icebreakers suggests a conversation starter when a chat begins (telegram.Client).
+	Icebreakers = "icebreakers"
+)
+
+// Labs lists the experimental features, in the order they are offered in /labs.
+var Labs = []string{Icebreakers}
+
+// IsLab reports whether feature is an experimental feature users can opt into.
+func IsLab(feature string) bool {
+	return slices.Contains(Labs, feature)
+}
+
+// Service decides which features a user gets. All methods are safe for concurrent use, and
+// a nil *Service has every experimental feature switched on.
+type Service struct {
+	mu       sync.RWMutex
+	disabled map[string]bool
+}
+
+// NewService returns a Service with every experimental feature switched on.
+func NewService() *Service {
+	return &Service{disabled: map[string]bool{}}
+}
+
+// SetEnabled switches a feature on or off for the whole service. A feature switched off is
+// neither offered in /labs nor enabled for users who opted into it earlier.
+func (s *Service) SetEnabled(feature string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled[feature] = !enabled
+}
+
+// DisableList switches off the features in a comma-separated list, e.g. the value of
+// LABS_DISABLED_FEATURES. It returns the names that are not experimental features.
+func (s *Service) DisableList(list string) (unknown []string) {
+	for _, feature := range strings.Split(list, ",") {
+		feature = strings.TrimSpace(feature)
+		if feature == "" {
+			continue
+		}
+		if !IsLab(feature) {
+			unknown = append(unknown, feature)
+			continue
+		}
+		s.SetEnabled(feature, false)
+	}
+	return unknown
+}
+
+// Available reports whether an experimental feature is switched on for the service.
+func (s *Service) Available(feature string) bool {
+	if !IsLab(feature) {
+		return false
+	}
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.disabled[feature]
+}
+
+// Offered returns the experimental features users can currently opt into, in /labs order.
+func (s *Service) Offered() []string {
+	var offered []string
+	for _, feature := range Labs {
+		if s.Available(feature) {
+			offered = append(offered, feature)
+		}
+	}
+	return offered
+}
+
+// Enabled reports whether a user gets an experimental feature: it is switched on for the
+// service, and the user opted into it.
+func (s *Service) Enabled(user *models.User, feature string) bool {
+	return user != nil && s.Available(feature) && user.HasLabFeature(feature)
+}
@@ -0,0 +1,27 @@
+package features_test
+
+import (
+	"chatgogo/backend/internal/features"
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceEnabled(t *testing.T) {
+	service := features.NewService()
+	volunteer := &models.User{LabFeatures: []string{features.Icebreakers}}
+
+	assert.True(t, service.Enabled(volunteer, features.Icebreakers))
+	assert.False(t, service.Enabled(&models.User{}, features.Icebreakers), "Features are opt-in")
+	assert.False(t, service.Enabled(nil, features.Icebreakers))
+	assert.Equal(t, []string{features.Icebreakers}, service.Offered())
+
+	assert.Equal(t, []string{"bogus", "translation"}, service.DisableList(" icebreakers ,bogus,translation"))
+	assert.False(t, service.Enabled(volunteer, features.Icebreakers), "Switched-off features are off for volunteers too")
+	assert.Empty(t, service.Offered())
+
+	var none *features.Service
+	assert.True(t, none.Enabled(volunteer, features.Icebreakers))
+	assert.False(t, none.Available("bogus"))
+}
@@ -0,0 +1,47 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoomArchive_PrunesArchivedHistory: only scored rooms without complaints awaiting review
+// are archivable, and archiving one deletes its history and records where it went.
+func TestRoomArchive_PrunesArchivedHistory(t *testing.T) {
+	e := newEnv(t)
+	ended := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	score := 50
+	archivable := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_A", User2ID: "user_B", EndedAt: ended, QualityScore: &score}
+	reported := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_C", User2ID: "user_D", EndedAt: ended, QualityScore: &score}
+	unscored := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_E", User2ID: "user_F", EndedAt: ended}
+	for _, room := range []*models.ChatRoom{&archivable, &reported, &unscored} {
+		require.NoError(t, e.DB.Create(room).Error)
+	}
+	require.NoError(t, e.Storage.SaveComplaint(&models.Complaint{RoomID: reported.RoomID, ReporterID: "user_C", SuspectID: "user_D"}))
+	require.NoError(t, e.Storage.SaveMessage(&models.ChatMessage{Type: "text", Content: "hello", SenderID: "user_A", RoomID: archivable.RoomID}))
+
+	rooms, err := e.Storage.GetArchivableRooms(ended.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, archivable.RoomID, rooms[0].RoomID)
+
+	require.NoError(t, e.Storage.MarkRoomArchived(archivable.RoomID, "https://archive.example.com/room.jsonl"))
+	history, err := e.Storage.GetChatHistory(archivable.RoomID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	var stored models.ChatRoom
+	require.NoError(t, e.DB.First(&stored, "room_id = ?", archivable.RoomID).Error)
+	assert.NotNil(t, stored.ArchivedAt)
+	assert.Equal(t, "https://archive.example.com/room.jsonl", stored.ArchiveURL)
+
+	rooms, err = e.Storage.GetArchivableRooms(ended.Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+}
@@ -0,0 +1,36 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestComplaintLookups: complaints are found by room and reported user, and by reporter from
+// a point in time on.
+func TestComplaintLookups(t *testing.T) {
+	e := newEnv(t)
+	roomID, otherRoomID := uuid.NewString(), uuid.NewString()
+	reporter := "reporter_" + uuid.NewString()[:8]
+	require.NoError(t, e.Storage.SaveComplaint(&models.Complaint{RoomID: roomID, ReporterID: reporter, SuspectID: "user_B"}))
+	require.NoError(t, e.Storage.SaveComplaint(&models.Complaint{RoomID: roomID, ReporterID: "user_B", SuspectID: reporter}))
+	require.NoError(t, e.Storage.SaveComplaint(&models.Complaint{RoomID: otherRoomID, ReporterID: reporter, SuspectID: "user_B"}))
+
+	complaints, err := e.Storage.GetComplaintsByRoomAndReportedUser(roomID, "user_B")
+	require.NoError(t, err)
+	require.Len(t, complaints, 1)
+	assert.Equal(t, reporter, complaints[0].ReporterID)
+
+	complaints, err = e.Storage.GetComplaintsByReporterSince(reporter, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, complaints, 2)
+	complaints, err = e.Storage.GetComplaintsByReporterSince(reporter, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, complaints)
+}
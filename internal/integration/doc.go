@@ -0,0 +1,8 @@
+// Package integration holds the end-to-end tests of the chat flows against real PostgreSQL
+// and Redis servers. They run the storage Service, hub and matcher together and serve as
+// executable specifications of the hub's event loop.
+//
+// The tests are built with the integration tag and need the servers given by
+// INTEGRATION_POSTGRES_DSN and INTEGRATION_REDIS_ADDR; `make test-integration` starts both
+// with docker-compose.test.yml. Every test empties the database and the Redis database.
+package integration
@@ -0,0 +1,127 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/migrations"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// messageTimeout is how long a test waits for a message to reach a client.
+const messageTimeout = 5 * time.Second
+
+// env is a hub and matcher running against the test servers.
+type env struct {
+	Storage storage.Storage
+	DB      *gorm.DB
+	Redis   redis.UniversalClient
+	Hub     *chathub.ManagerService
+}
+
+// newEnv connects to the test servers, empties them and starts a hub and a matcher, which are
+// stopped when the test ends. The test is skipped if the servers are not configured.
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	dsn, redisAddr := os.Getenv("INTEGRATION_POSTGRES_DSN"), os.Getenv("INTEGRATION_REDIS_ADDR")
+	if dsn == "" || redisAddr == "" {
+		t.Skip("INTEGRATION_POSTGRES_DSN and INTEGRATION_REDIS_ADDR are not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("TRUNCATE chat_rooms, users, complaints, chat_histories, bans, outbox_messages").Error)
+
+	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	require.NoError(t, rdb.FlushDB(context.Background()).Err())
+	t.Cleanup(func() { rdb.Close() })
+
+	s := storage.NewStorageService(db, rdb)
+	hub := chathub.NewManagerService(s)
+	matcher := chathub.NewMatcherService(hub, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	go matcher.Run(ctx)
+
+	return &env{Storage: s, DB: db, Redis: rdb, Hub: hub}
+}
+
+// connect creates a user with the given Telegram ID and registers a client for them.
+func (e *env) connect(t *testing.T, telegramID int64) *testClient {
+	t.Helper()
+	user, err := e.Storage.SaveUserIfNotExists(telegramID)
+	require.NoError(t, err)
+	client := &testClient{userID: user.ID, send: make(chan models.ChatMessage, 100)}
+	e.Hub.RegisterCh <- client
+	return client
+}
+
+// send passes a message of a client to the hub, from the client's current room.
+func (e *env) send(client *testClient, msgType, content string) {
+	e.Hub.IncomingCh <- models.ChatMessage{
+		Type:     msgType,
+		Content:  content,
+		SenderID: client.GetUserID(),
+		RoomID:   client.GetRoomID(),
+	}
+}
+
+// testClient is a chathub.Client that keeps the messages sent to it.
+type testClient struct {
+	userID string
+	send   chan models.ChatMessage
+
+	mu     sync.Mutex
+	roomID string
+}
+
+func (c *testClient) GetUserID() string { return c.userID }
+
+func (c *testClient) GetRoomID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roomID
+}
+
+func (c *testClient) SetRoomID(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roomID = roomID
+}
+
+func (c *testClient) GetSendChannel() chan<- models.ChatMessage { return c.send }
+func (c *testClient) Run()                                      {}
+func (c *testClient) Close()                                    {}
+
+// expect waits for a message of the given type and content, skipping the others, and returns
+// it. An empty content matches any content.
+func (c *testClient) expect(t *testing.T, msgType, content string) models.ChatMessage {
+	t.Helper()
+	timeout := time.After(messageTimeout)
+	for {
+		select {
+		case msg, ok := <-c.send:
+			require.True(t, ok, "client %s was closed", c.userID)
+			if msg.Type == msgType && (content == "" || msg.Content == content) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("client %s did not receive %s %q within %v", c.userID, msgType, content, messageTimeout)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build integration
+
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// match lets two connected users search and waits until they are matched, returning the room.
+func (e *env) match(t *testing.T, a, b *testClient) string {
+	t.Helper()
+	e.send(a, "command_start", "/start")
+	a.expect(t, "system_info", "system_search_start")
+	e.send(b, "command_start", "/start")
+
+	roomID := a.expect(t, "system_match_found", "").RoomID
+	assert.Equal(t, roomID, b.expect(t, "system_match_found", "").RoomID)
+	require.NotEmpty(t, roomID)
+	return roomID
+}
+
+// TestFlow_ChatAndStop: two users search and are matched, a message is saved and relayed to
+// the partner, and /stop closes the room and frees both.
+func TestFlow_ChatAndStop(t *testing.T) {
+	e := newEnv(t)
+	alice, bob := e.connect(t, 1001), e.connect(t, 1002)
+
+	roomID := e.match(t, alice, bob)
+	room, err := e.Storage.GetRoomByID(roomID)
+	require.NoError(t, err)
+	assert.True(t, room.IsActive)
+	assert.ElementsMatch(t, []string{alice.GetUserID(), bob.GetUserID()}, []string{room.User1ID, room.User2ID})
+
+	e.send(alice, "text", "hello")
+	received := bob.expect(t, "text", "hello")
+	assert.Equal(t, alice.GetUserID(), received.SenderID)
+	history, err := e.Storage.GetChatHistory(roomID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "hello", history[0].Content)
+
+	e.send(alice, "command_stop", "/stop")
+	alice.expect(t, "system_info", "system_match_stop_self")
+	bob.expect(t, "system_info", "system_match_stop_partner")
+	require.Eventually(t, func() bool {
+		room, err := e.Storage.GetRoomByID(roomID)
+		return err == nil && !room.IsActive
+	}, messageTimeout, 50*time.Millisecond)
+	assert.Empty(t, alice.GetRoomID())
+	assert.Empty(t, bob.GetRoomID())
+	room, _ = e.Storage.GetRoomByID(roomID)
+	assert.Equal(t, alice.GetUserID(), room.ClosedBy)
+	assert.Equal(t, "stop", room.CloseReason)
+}
+
+// TestFlow_ReportAndEnd: a user reports their partner, a complaint is filed without telling
+// the partner, and ending the chat closes the room and puts the reporter back into search.
+func TestFlow_ReportAndEnd(t *testing.T) {
+	e := newEnv(t)
+	alice, bob := e.connect(t, 2001), e.connect(t, 2002)
+	roomID := e.match(t, alice, bob)
+
+	e.send(alice, "command_report", "/report spam")
+	alice.expect(t, "system_report_choice", "system_report_filed")
+	complaints, err := e.Storage.GetComplaintsBySuspect(bob.GetUserID())
+	require.NoError(t, err)
+	require.Len(t, complaints, 1)
+	assert.Equal(t, roomID, complaints[0].RoomID)
+	assert.Equal(t, alice.GetUserID(), complaints[0].ReporterID)
+	assert.Equal(t, "spam", complaints[0].Reason)
+
+	e.send(alice, "command_report_end", "")
+	bob.expect(t, "system_info", "system_match_stop_partner")
+	require.Eventually(t, func() bool {
+		searching, err := e.Storage.IsUserSearching(alice.GetUserID())
+		return err == nil && searching
+	}, messageTimeout, 50*time.Millisecond, "the reporter searches again")
+	room, err := e.Storage.GetRoomByID(roomID)
+	require.NoError(t, err)
+	assert.False(t, room.IsActive)
+}
@@ -0,0 +1,36 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveMessages_BulkInsertsHistoryAndOutbox: a batch is saved with its outbox entries, and
+// the messages get the IDs of their history records, in order.
+func TestSaveMessages_BulkInsertsHistoryAndOutbox(t *testing.T) {
+	e := newEnv(t)
+	roomID := uuid.NewString()
+	msgs := []*models.ChatMessage{
+		{Type: "text", Content: "first", SenderID: "user_A", RoomID: roomID},
+		{Type: "text", Content: "second", SenderID: "user_B", RoomID: roomID},
+	}
+	require.NoError(t, e.Storage.SaveMessages(msgs))
+	require.NotZero(t, msgs[0].ID)
+	assert.Greater(t, msgs[1].ID, msgs[0].ID)
+
+	history, err := e.Storage.GetChatHistory(roomID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, msgs[0].ID, history[0].ID)
+	assert.Equal(t, "second", history[1].Content)
+
+	var pending int64
+	require.NoError(t, e.DB.Model(&models.OutboxMessage{}).Where("room_id = ?", roomID).Count(&pending).Error)
+	assert.Equal(t, int64(2), pending)
+}
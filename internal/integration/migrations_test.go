@@ -0,0 +1,49 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/migrations"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrations_DownAndUp: reverting the last migration makes it pending, and applying the
+// pending migrations applies only it.
+func TestMigrations_DownAndUp(t *testing.T) {
+	e := newEnv(t)
+	migrator := migrations.New(e.DB)
+	last := migrator.Migrations[len(migrator.Migrations)-1]
+	require.NoError(t, migrator.Verify())
+
+	reverted, err := migrator.Down()
+	require.NoError(t, err)
+	require.NotNil(t, reverted)
+	assert.Equal(t, last.Version, reverted.Version)
+	assert.Error(t, migrator.Verify(), "the reverted migration is pending")
+
+	applied, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Equal(t, []migrations.Migration{last}, applied)
+	require.NoError(t, migrator.Verify())
+}
+
+// TestMigrations_AdoptsLegacyVersions: a database whose versions the previous runner recorded
+// in schema_migrations is taken over at its last version instead of being migrated again.
+func TestMigrations_AdoptsLegacyVersions(t *testing.T) {
+	e := newEnv(t)
+	migrator := migrations.New(e.DB)
+	last := migrator.Migrations[len(migrator.Migrations)-1]
+	require.NoError(t, e.DB.Exec("DROP TABLE schema_version").Error)
+	require.NoError(t, e.DB.Exec("DROP TABLE IF EXISTS schema_migrations").Error)
+	require.NoError(t, e.DB.Exec("CREATE TABLE schema_migrations (version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL)").Error)
+	t.Cleanup(func() { e.DB.Exec("DROP TABLE schema_migrations") })
+	require.NoError(t, e.DB.Exec("INSERT INTO schema_migrations VALUES (?, ?, now())", last.Version, last.Name).Error)
+
+	applied, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	require.NoError(t, migrator.Verify())
+}
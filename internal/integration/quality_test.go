@@ -0,0 +1,33 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoomQuality_ScoredOnce: a room keeps the first quality score stored for it, so that an
+// instance scoring it a second time learns it must not adjust the reputation again.
+func TestRoomQuality_ScoredOnce(t *testing.T) {
+	e := newEnv(t)
+	room := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_A", User2ID: "user_B", EndedAt: time.Now()}
+	require.NoError(t, e.DB.Create(&room).Error)
+
+	stored, err := e.Storage.UpdateRoomQualityScore(room.RoomID, 80)
+	require.NoError(t, err)
+	assert.True(t, stored)
+	stored, err = e.Storage.UpdateRoomQualityScore(room.RoomID, 40)
+	require.NoError(t, err)
+	assert.False(t, stored, "a room already scored is not scored again")
+
+	var saved models.ChatRoom
+	require.NoError(t, e.DB.First(&saved, "room_id = ?", room.RoomID).Error)
+	require.NotNil(t, saved.QualityScore)
+	assert.Equal(t, 80, *saved.QualityScore)
+}
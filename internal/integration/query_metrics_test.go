@@ -0,0 +1,43 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestQueryLogger_RecordsQueriesByMethod: queries made through a database with the QueryLogger
+// are counted under the Storage method that made them, including those in transactions, and
+// logged as slow from the threshold on.
+func TestQueryLogger_RecordsQueriesByMethod(t *testing.T) {
+	e := newEnv(t)
+	db := e.DB.Session(&gorm.Session{Logger: storage.NewQueryLogger(time.Nanosecond).LogMode(logger.Silent)})
+	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("INTEGRATION_REDIS_ADDR")})
+	t.Cleanup(func() { rdb.Close() })
+	s := storage.NewStorageService(db, rdb)
+
+	roomID := uuid.NewString()
+	require.NoError(t, s.SaveMessage(&models.ChatMessage{Type: "text", Content: "hello", SenderID: "user_A", RoomID: roomID}))
+	_, err := s.GetComplaintsByRoom(roomID)
+	require.NoError(t, err)
+
+	var buf strings.Builder
+	require.NoError(t, metrics.Default.Write(&buf))
+	exposition := buf.String()
+	assert.Contains(t, exposition, `chatgogo_storage_query_duration_seconds_count{method="SaveMessage"}`)
+	assert.Contains(t, exposition, `chatgogo_storage_query_duration_seconds_count{method="GetComplaintsByRoom"}`)
+	assert.Contains(t, exposition, `chatgogo_storage_slow_queries_total{method="GetComplaintsByRoom"}`)
+}
@@ -0,0 +1,37 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadReplica_ServesHeavyReads: with a read replica registered, here a second connection to
+// the test database, heavy reads see what was written to the primary, and writes, including
+// transactional ones, still go through.
+func TestReadReplica_ServesHeavyReads(t *testing.T) {
+	e := newEnv(t)
+	require.NoError(t, storage.UseReadReplica(e.DB, os.Getenv("INTEGRATION_POSTGRES_DSN")))
+
+	roomID := uuid.NewString()
+	require.NoError(t, e.Storage.SaveComplaint(&models.Complaint{RoomID: roomID, ReporterID: "user_A", SuspectID: "user_B"}))
+	message := &models.ChatMessage{Type: "text", Content: "replicated hello", SenderID: "user_B", RoomID: roomID}
+	require.NoError(t, e.Storage.SaveMessage(message))
+
+	complaints, err := e.Storage.GetComplaintsBySuspect("user_B")
+	require.NoError(t, err)
+	assert.Len(t, complaints, 1)
+	counts, err := e.Storage.GetMessageCountsBySender(roomID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts["user_B"])
+	hits, err := e.Storage.SearchHistory(models.HistorySearch{Query: "hello", RoomID: roomID, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, hits, 1)
+}
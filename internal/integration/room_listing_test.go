@@ -0,0 +1,53 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListRooms_FiltersAndCountsMessages: rooms are listed newest first with their message
+// counts, and can be filtered by state, participant and message count, and paged.
+func TestListRooms_FiltersAndCountsMessages(t *testing.T) {
+	e := newEnv(t)
+	start := time.Now().Add(-time.Hour)
+	quiet := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_A", User2ID: "user_B", StartedAt: start, EndedAt: start.Add(time.Minute)}
+	chatty := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_A", User2ID: "user_C", StartedAt: start.Add(10 * time.Minute), IsActive: true}
+	other := models.ChatRoom{RoomID: uuid.NewString(), User1ID: "user_D", User2ID: "user_E", StartedAt: start.Add(20 * time.Minute), IsActive: true}
+	for _, room := range []*models.ChatRoom{&quiet, &chatty, &other} {
+		require.NoError(t, e.DB.Create(room).Error)
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, e.Storage.SaveMessage(&models.ChatMessage{Type: "text", Content: "hi", SenderID: "user_C", RoomID: chatty.RoomID}))
+	}
+
+	rooms, err := e.Storage.ListRooms(models.RoomFilter{ParticipantID: "user_A", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, rooms, 2)
+	assert.Equal(t, chatty.RoomID, rooms[0].RoomID)
+	assert.Equal(t, int64(2), rooms[0].MessageCount)
+	assert.Equal(t, quiet.RoomID, rooms[1].RoomID)
+	assert.Equal(t, int64(0), rooms[1].MessageCount)
+
+	active, none := true, 0
+	rooms, err = e.Storage.ListRooms(models.RoomFilter{Active: &active, MaxMessages: &none, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, other.RoomID, rooms[0].RoomID)
+
+	rooms, err = e.Storage.ListRooms(models.RoomFilter{MinMessages: 1, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, chatty.RoomID, rooms[0].RoomID)
+
+	rooms, err = e.Storage.ListRooms(models.RoomFilter{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, chatty.RoomID, rooms[0].RoomID)
+}
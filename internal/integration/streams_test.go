@@ -0,0 +1,116 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive waits for the next message of a subscription and returns its content.
+func receive(t *testing.T, sub storage.RoomSubscription) string {
+	t.Helper()
+	select {
+	case msg := <-sub.Channel():
+		var message models.ChatMessage
+		require.NoError(t, json.Unmarshal([]byte(msg.Payload), &message))
+		return message.Content
+	case <-time.After(messageTimeout):
+		t.Fatalf("no message within %v", messageTimeout)
+		return ""
+	}
+}
+
+// assertNoMessage fails if the subscription hands over a message while its reads block.
+func assertNoMessage(t *testing.T, sub storage.RoomSubscription) {
+	t.Helper()
+	select {
+	case msg := <-sub.Channel():
+		t.Fatalf("unexpected message %s", msg.Payload)
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// publish publishes a text message with the given content to a room.
+func publish(t *testing.T, s storage.Storage, roomID, content string) {
+	t.Helper()
+	require.NoError(t, s.PublishMessage(roomID, models.ChatMessage{Type: "text", Content: content, RoomID: roomID}))
+}
+
+// TestStreams_JoinReadsMessagesPublishedBefore: a room without a cursor is read from its first
+// message, so messages published before any instance joined it are delivered.
+func TestStreams_JoinReadsMessagesPublishedBefore(t *testing.T) {
+	e := newEnv(t)
+	s := storage.NewStreamStorageService(e.DB, e.Redis, "instance-a")
+	roomID := uuid.NewString()
+	publish(t, s, roomID, "before")
+
+	sub := s.SubscribeToRooms()
+	defer sub.Close()
+	require.NoError(t, sub.Join(context.Background(), roomID))
+	assert.Equal(t, "before", receive(t, sub))
+	publish(t, s, roomID, "after")
+	assert.Equal(t, "after", receive(t, sub))
+}
+
+// TestStreams_ConsumerResumesFromCursor: a consumer that joins a room again, e.g. after a
+// restart, gets the messages published meanwhile but not the ones it already read, and a room
+// it left starts over.
+func TestStreams_ConsumerResumesFromCursor(t *testing.T) {
+	e := newEnv(t)
+	s := storage.NewStreamStorageService(e.DB, e.Redis, "instance-a")
+	roomID := uuid.NewString()
+	ctx := context.Background()
+
+	sub := s.SubscribeToRooms()
+	require.NoError(t, sub.Join(ctx, roomID))
+	publish(t, s, roomID, "first")
+	assert.Equal(t, "first", receive(t, sub))
+	require.Eventually(t, func() bool {
+		cursor, err := e.Redis.HGet(ctx, "chat:stream_cursor:instance-a", roomID).Result()
+		return err == nil && cursor != ""
+	}, messageTimeout, 10*time.Millisecond)
+	require.NoError(t, sub.Close())
+
+	publish(t, s, roomID, "while away")
+	restarted := s.SubscribeToRooms()
+	defer restarted.Close()
+	require.NoError(t, restarted.Join(ctx, roomID))
+	assert.Equal(t, "while away", receive(t, restarted))
+	assertNoMessage(t, restarted)
+
+	require.NoError(t, restarted.Leave(ctx, roomID))
+	_, err := e.Redis.HGet(ctx, "chat:stream_cursor:instance-a", roomID).Result()
+	assert.ErrorIs(t, err, redis.Nil)
+	require.NoError(t, restarted.Join(ctx, roomID))
+	assert.Equal(t, "first", receive(t, restarted))
+}
+
+// TestStreams_ConsumersKeepOwnCursors: every consumer reads a room from its own cursor.
+func TestStreams_ConsumersKeepOwnCursors(t *testing.T) {
+	e := newEnv(t)
+	a := storage.NewStreamStorageService(e.DB, e.Redis, "instance-a")
+	b := storage.NewStreamStorageService(e.DB, e.Redis, "instance-b")
+	roomID := uuid.NewString()
+	ctx := context.Background()
+
+	subA := a.SubscribeToRooms()
+	defer subA.Close()
+	require.NoError(t, subA.Join(ctx, roomID))
+	publish(t, a, roomID, "hello")
+	assert.Equal(t, "hello", receive(t, subA))
+
+	subB := b.SubscribeToRooms()
+	defer subB.Close()
+	require.NoError(t, subB.Join(ctx, roomID))
+	assert.Equal(t, "hello", receive(t, subB))
+}
@@ -0,0 +1,40 @@
+//go:build integration
+
+package integration
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUserCache_UpdatesDropCachedUsers: GetUserByID serves users from the cache, and updates
+// through the storage are visible right away.
+func TestUserCache_UpdatesDropCachedUsers(t *testing.T) {
+	e := newEnv(t)
+	user, err := e.Storage.SaveUserIfNotExists(2001)
+	require.NoError(t, err)
+
+	cached, err := e.Storage.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cached.Age)
+
+	// Writes that bypass the storage are not seen until the cached copy expires.
+	require.NoError(t, e.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("gender", "female").Error)
+	cached, err = e.Storage.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, cached.Gender)
+
+	require.NoError(t, e.Storage.UpdateUserAge(user.ID, 30))
+	updated, err := e.Storage.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 30, updated.Age)
+	assert.Equal(t, "female", updated.Gender)
+
+	require.NoError(t, e.Storage.UpdateUserLanguage(2001, "ua"))
+	updated, err = e.Storage.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ua", updated.Language)
+}
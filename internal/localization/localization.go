@@ -8,10 +8,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
 
+// DefaultDir is the directory of the translation files, relative to the working directory
+// of the service.
+const DefaultDir = "internal/localization"
+
 // Localizer manages the translations for the application.
 // It holds a map of languages, each with its own map of translation keys and values.
 type Localizer struct {
@@ -79,3 +84,34 @@ func (l *Localizer) GetString(lang, key string) string {
 
 	return key
 }
+
+// Languages returns the codes of the loaded languages, sorted.
+func (l *Localizer) Languages() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	langs := make([]string, 0, len(l.translations))
+	for lang := range l.translations {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Keys returns the translation keys of a language, sorted. It returns nil for an unknown
+// language.
+func (l *Localizer) Keys(lang string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	translations, ok := l.translations[lang]
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(translations))
+	for key := range translations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+// Package media re-hosts the media relayed in chats. Telegram media is stored in the history
+// as a file ID, which only the bot can use and which may expire, so a background job copies
+// each file to an object store and records the URL of the copy on the history entry. Web
+// history, moderation review and exports can then show the media itself.
+package media
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"time"
+)
+
+const (
+	// DefaultRehostInterval is how often the rehoster looks for newly relayed media.
+	DefaultRehostInterval = time.Minute
+	// DefaultRehostBatchSize is the maximum number of files re-hosted per run.
+	DefaultRehostBatchSize = 50
+	// DefaultRehostBacklog is how far back the rehoster looks for media on start.
+	DefaultRehostBacklog = 24 * time.Hour
+	// DefaultMaxSize is the largest file that is re-hosted, which is also the largest file a
+	// Telegram bot can download.
+	DefaultMaxSize = 20 << 20
+
+	// rehostTimeout bounds the download and upload of one file.
+	rehostTimeout = 2 * time.Minute
+)
+
+// File is a media file opened at its source.
+type File struct {
+	// Body is the content of the file. The caller closes it.
+	Body io.ReadCloser
+	// Size is the size of the file in bytes, or -1 if unknown.
+	Size int64
+	// Name is the name of the file at the source; its extension names the file type.
+	Name string
+}
+
+// Source opens media files by the file ID stored in the history.
+type Source interface {
+	Open(ctx context.Context, fileID string) (*File, error)
+}
+
+// Store keeps re-hosted media files.
+type Store interface {
+	// Put stores a file under key and returns the URL at which it can be fetched.
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error)
+	// Delete removes the file at a URL Put returned. Deleting a missing file succeeds.
+	Delete(ctx context.Context, url string) error
+}
+
+// Rehoster is a background job that copies relayed media from its Source to a Store and
+// records the URL of the copy on the history entry.
+type Rehoster struct {
+	// Storage provides access to the data persistence layer.
+	Storage storage.MessageStore
+	// Source opens the media files.
+	Source Source
+	// Store keeps the copies.
+	Store Store
+	// Interval is the time between two runs.
+	Interval time.Duration
+	// BatchSize is the maximum number of files re-hosted per run.
+	BatchSize int
+	// MaxSize is the largest file that is re-hosted; larger files are skipped.
+	MaxSize int64
+
+	// since is how far back the rehoster looks, and lastID the last history entry it tried.
+	// A file that cannot be re-hosted is skipped, not retried on every run.
+	since  time.Time
+	lastID uint
+}
+
+// NewRehoster creates and returns a new Rehoster with default settings, which looks
+// DefaultRehostBacklog back for media that was not re-hosted yet.
+func NewRehoster(s storage.MessageStore, source Source, store Store) *Rehoster {
+	return &Rehoster{
+		Storage:   s,
+		Source:    source,
+		Store:     store,
+		Interval:  DefaultRehostInterval,
+		BatchSize: DefaultRehostBatchSize,
+		MaxSize:   DefaultMaxSize,
+		since:     time.Now().Add(-DefaultRehostBacklog),
+	}
+}
+
+// Run periodically re-hosts newly relayed media until ctx is cancelled. This function is
+// intended to be run as a goroutine.
+func (r *Rehoster) Run(ctx context.Context) {
+	log.Println("Media Rehoster started.")
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Media Rehoster stopped.")
+			return
+		case <-ticker.C:
+			r.RehostPending()
+		}
+	}
+}
+
+// RehostPending re-hosts one batch of media that was not re-hosted yet. It returns the
+// number of files re-hosted.
+func (r *Rehoster) RehostPending() int {
+	history, err := r.Storage.GetUnhostedMedia(r.lastID, r.since, r.BatchSize)
+	if err != nil {
+		log.Printf("ERROR: Failed to load media to re-host: %v", err)
+		return 0
+	}
+
+	rehosted := 0
+	for _, entry := range history {
+		r.lastID = entry.ID
+		url, err := r.rehost(entry)
+		if err != nil {
+			log.Printf("WARN: Failed to re-host %s of history entry %d: %v", entry.Type, entry.ID, err)
+			continue
+		}
+		if err := r.Storage.SetHistoryMediaURL(entry.ID, url); err != nil {
+			log.Printf("ERROR: Failed to save media URL of history entry %d: %v", entry.ID, err)
+			continue
+		}
+		rehosted++
+	}
+
+	if rehosted > 0 {
+		log.Printf("Media Rehoster: re-hosted %d files.", rehosted)
+	}
+	return rehosted
+}
+
+// rehost copies the media of a history entry to the store and returns the URL of the copy.
+func (r *Rehoster) rehost(entry models.ChatHistory) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rehostTimeout)
+	defer cancel()
+
+	file, err := r.Source.Open(ctx, entry.Content)
+	if err != nil {
+		return "", err
+	}
+	defer file.Body.Close()
+	if r.MaxSize > 0 && file.Size > r.MaxSize {
+		return "", fmt.Errorf("file of %d bytes is larger than %d bytes", file.Size, r.MaxSize)
+	}
+
+	ext := path.Ext(file.Name)
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	key := fmt.Sprintf("media/%s/%d%s", entry.RoomID, entry.ID, ext)
+	return r.Store.Put(ctx, key, contentType, file.Body, file.Size)
+}
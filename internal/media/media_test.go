@@ -0,0 +1,104 @@
+package media
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// mediaStorage is a storage.MessageStore holding unhosted media history entries.
+type mediaStorage struct {
+	storage.MessageStore
+	history []models.ChatHistory
+	urls    map[uint]string
+}
+
+func (s *mediaStorage) GetUnhostedMedia(afterID uint, since time.Time, limit int) ([]models.ChatHistory, error) {
+	var result []models.ChatHistory
+	for _, entry := range s.history {
+		if entry.ID > afterID && s.urls[entry.ID] == "" && len(result) < limit {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func (s *mediaStorage) SetHistoryMediaURL(historyID uint, url string) error {
+	s.urls[historyID] = url
+	return nil
+}
+
+// fakeSource serves files by file ID.
+type fakeSource map[string]string
+
+func (f fakeSource) Open(ctx context.Context, fileID string) (*File, error) {
+	content, ok := f[fileID]
+	if !ok {
+		return nil, errors.New("file expired")
+	}
+	return &File{Body: io.NopCloser(strings.NewReader(content)), Size: int64(len(content)), Name: fileID + ".jpg"}, nil
+}
+
+// fakeStore records the stored files.
+type fakeStore struct {
+	files        map[string]string
+	contentTypes map[string]string
+}
+
+func (f *fakeStore) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	f.files[key], f.contentTypes[key] = string(data), contentType
+	return "https://cdn.example.com/" + key, nil
+}
+
+func (f *fakeStore) Delete(ctx context.Context, url string) error {
+	delete(f.files, strings.TrimPrefix(url, "https://cdn.example.com/"))
+	return nil
+}
+
+// TestRehostPendingCopiesMedia verifies that media is copied to the store under a key of its
+// room and history entry, and that files which cannot be opened are skipped, not retried.
+func TestRehostPendingCopiesMedia(t *testing.T) {
+	s := &mediaStorage{
+		history: []models.ChatHistory{
+			{Model: gorm.Model{ID: 1}, RoomID: "room1", Type: "photo", Content: "expired"},
+			{Model: gorm.Model{ID: 2}, RoomID: "room1", Type: "photo", Content: "file2"},
+		},
+		urls: make(map[uint]string),
+	}
+	store := &fakeStore{files: make(map[string]string), contentTypes: make(map[string]string)}
+	rehoster := NewRehoster(s, fakeSource{"file2": "jpeg data"}, store)
+
+	require.Equal(t, 1, rehoster.RehostPending())
+	assert.Equal(t, "jpeg data", store.files["media/room1/2.jpg"])
+	assert.Equal(t, "image/jpeg", store.contentTypes["media/room1/2.jpg"])
+	assert.Equal(t, map[uint]string{2: "https://cdn.example.com/media/room1/2.jpg"}, s.urls)
+
+	assert.Equal(t, 0, rehoster.RehostPending(), "the expired file is not retried")
+}
+
+// TestRehostPendingSkipsLargeFiles verifies that files above MaxSize are not copied.
+func TestRehostPendingSkipsLargeFiles(t *testing.T) {
+	s := &mediaStorage{
+		history: []models.ChatHistory{{Model: gorm.Model{ID: 1}, RoomID: "room1", Type: "video", Content: "big"}},
+		urls:    make(map[uint]string),
+	}
+	store := &fakeStore{files: make(map[string]string), contentTypes: make(map[string]string)}
+	rehoster := NewRehoster(s, fakeSource{"big": "0123456789"}, store)
+	rehoster.MaxSize = 5
+
+	assert.Equal(t, 0, rehoster.RehostPending())
+	assert.Empty(t, store.files)
+}
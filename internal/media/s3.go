@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// S3Store is a Store in an S3-compatible bucket (AWS S3, MinIO, Cloudflare R2, ...). Objects
+// are addressed path-style, so that the same settings work with every provider.
+type S3Store struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.eu-central-1.amazonaws.com.
+	Endpoint string
+	// Region is the region the requests are signed for.
+	Region string
+	// Bucket is the bucket the files are stored in.
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is the base URL under which the objects are served, e.g. a CDN in front of
+	// the bucket. If empty, the URL of the object in the S3 API is returned.
+	PublicURL string
+	// Client is the HTTP client used for the requests.
+	Client *http.Client
+}
+
+// Put uploads a file with a signed PUT request. A file of unknown size (-1) is read into
+// memory first, because S3 needs the length of the upload.
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body io.Reader, size int64) (string, error) {
+	if size < 0 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("s3: failed to read %s: %w", key, err)
+		}
+		body, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	objectURL := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, body)
+	if err != nil {
+		return "", fmt.Errorf("s3: failed to create request for %s: %w", key, err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("s3: failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("s3: upload of %s failed with status %d: %s", key, resp.StatusCode, detail)
+	}
+
+	if s.PublicURL != "" {
+		return strings.TrimSuffix(s.PublicURL, "/") + "/" + key, nil
+	}
+	return objectURL, nil
+}
+
+// Delete deletes the object at a URL returned by Put with a signed DELETE request.
+func (s *S3Store) Delete(ctx context.Context, url string) error {
+	key, ok := strings.CutPrefix(url, s.objectURL(""))
+	if s.PublicURL != "" && !ok {
+		key, ok = strings.CutPrefix(url, strings.TrimSuffix(s.PublicURL, "/")+"/")
+	}
+	if !ok || key == "" {
+		return fmt.Errorf("s3: %s is not an object of bucket %s", url, s.Bucket)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("s3: failed to create request for %s: %w", key, err)
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3: failed to delete %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3: deletion of %s failed with status %d: %s", key, resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// objectURL returns the URL of an object in the S3 API.
+func (s *S3Store) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.Endpoint, "/"), s.Bucket, key)
+}
+
+// unsignedPayload is the payload hash of requests whose body is not signed, so that it can
+// be streamed instead of being hashed up front.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds an AWS Signature Version 4 Authorization header to a request.
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + unsignedPayload + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.SecretKey, date, s.Region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// signingKey derives the Signature Version 4 key of a day, region and service.
+func signingKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSigningKey checks the key derivation against the example of the AWS Signature
+// Version 4 documentation.
+func TestSigningKey(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
+
+// TestS3StorePut verifies that a file is uploaded path-style with a signed request, and that
+// the URL under PublicURL is returned.
+func TestS3StorePut(t *testing.T) {
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/bucket/media/room1/2.jpg", r.URL.Path)
+		assert.Equal(t, "image/jpeg", r.Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Equal(t, unsignedPayload, r.Header.Get("X-Amz-Content-Sha256"))
+		data, _ := io.ReadAll(r.Body)
+		uploaded = string(data)
+	}))
+	defer server.Close()
+
+	store := &S3Store{
+		Endpoint:  server.URL,
+		Region:    "eu-central-1",
+		Bucket:    "bucket",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		PublicURL: "https://cdn.example.com/",
+		Client:    server.Client(),
+	}
+	url, err := store.Put(context.Background(), "media/room1/2.jpg", "image/jpeg", strings.NewReader("jpeg data"), -1)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/media/room1/2.jpg", url)
+	assert.Equal(t, "jpeg data", uploaded)
+}
+
+// TestS3StoreDelete verifies that an object is deleted by its public URL with a signed request,
+// and that URLs outside the bucket are refused.
+func TestS3StoreDelete(t *testing.T) {
+	var deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		deleted = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := &S3Store{
+		Endpoint:  server.URL,
+		Region:    "eu-central-1",
+		Bucket:    "bucket",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		PublicURL: "https://cdn.example.com/",
+		Client:    server.Client(),
+	}
+	require.NoError(t, store.Delete(context.Background(), "https://cdn.example.com/media/room1/2.jpg"))
+	assert.Equal(t, "/bucket/media/room1/2.jpg", deleted)
+	assert.Error(t, store.Delete(context.Background(), "https://elsewhere.example.com/media/room1/2.jpg"))
+}
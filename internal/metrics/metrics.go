@@ -0,0 +1,442 @@
+// Package metrics provides labelled counters, gauges and histograms exported in the
+// Prometheus text exposition format, so the service can be scraped without pulling in a
+// client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CounterVec is a monotonically increasing counter partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// NewCounterVec creates a counter with the given metric name, help text and label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+// Inc increments the counter for the given label values, which must match the label
+// names in number and order.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter for the given label values by n.
+func (c *CounterVec) Add(n uint64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+// Value returns the current count for the given label values.
+func (c *CounterVec) Value(labelValues ...string) uint64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// key renders label values as the Prometheus label set, e.g. `{type="message"}`.
+func (c *CounterVec) key(labelValues []string) string {
+	return labelKey(c.name, c.labels, labelValues)
+}
+
+// labelKey renders the label values of a metric as the Prometheus label set. The values
+// must match the label names in number and order.
+func labelKey(name string, labels, labelValues []string) string {
+	if len(labelValues) != len(labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", name, len(labels), len(labelValues)))
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		pairs[i] = fmt.Sprintf("%s=%q", label, labelValues[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// write writes the counter in the text exposition format, series sorted by label set.
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]uint64, len(keys))
+	for i, key := range keys {
+		values[i] = c.values[key]
+	}
+	c.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s%s %d\n", c.name, key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a single value that can go up and down, such as a queue length.
+type Gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a gauge with the given metric name and help text.
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+// write writes the gauge in the text exposition format.
+func (g *Gauge) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.Value()))
+	return err
+}
+
+// GaugeVec is a gauge partitioned by label values, such as the queue length per segment.
+type GaugeVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGaugeVec creates a gauge with the given metric name, help text and label names.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Set sets the gauge for the given label values to v.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := labelKey(g.name, g.labels, labelValues)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Value returns the current value of the gauge for the given label values.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	key := labelKey(g.name, g.labels, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+// write writes the gauge in the text exposition format, series sorted by label set.
+func (g *GaugeVec) write(w io.Writer) error {
+	g.mu.Lock()
+	keys := make([]string, 0, len(g.values))
+	for key := range g.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]float64, len(keys))
+	for i, key := range keys {
+		values[i] = g.values[key]
+	}
+	g.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, key, formatFloat(values[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram counts observations, such as durations, in cumulative buckets and keeps their
+// sum, so that both the distribution and the average can be derived.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // counts[i] is the number of observations <= buckets[i].
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a histogram with the given metric name, help text and upper bucket
+// bounds, which must be sorted in increasing order. The +Inf bucket is implicit.
+func NewHistogram(name, help string, buckets ...float64) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	return &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Sum returns the sum of all observed values.
+func (h *Histogram) Sum() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sum
+}
+
+// write writes the histogram in the text exposition format.
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+		return err
+	}
+	for i, bound := range h.buckets {
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatFloat(bound), counts[i]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n",
+		h.name, count, h.name, formatFloat(sum), h.name, count)
+	return err
+}
+
+// HistogramVec is a histogram partitioned by label values, such as the duration of each
+// kind of query.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// histogramSeries is the state of one label set of a HistogramVec.
+type histogramSeries struct {
+	counts []uint64 // counts[i] is the number of observations <= buckets[i].
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram with the given metric name, help text, upper bucket
+// bounds, which must be sorted in increasing order, and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Observe records a value for the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.name, h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += v
+}
+
+// Count returns the number of observations for the given label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := labelKey(h.name, h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if series, ok := h.series[key]; ok {
+		return series.count
+	}
+	return 0
+}
+
+// write writes the histogram in the text exposition format, series sorted by label set.
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]histogramSeries, len(keys))
+	for i, key := range keys {
+		s := h.series[key]
+		series[i] = histogramSeries{counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum}
+	}
+	h.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		// The bucket bound is the last label: {method="x"} becomes {method="x",le="1"}.
+		prefix := "{"
+		if key != "" {
+			prefix = strings.TrimSuffix(key, "}") + ","
+		}
+		for j, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%sle=%q} %d\n", h.name, prefix, formatFloat(bound), series[i].counts[j]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, prefix, series[i].count, h.name, key, formatFloat(series[i].sum), h.name, key, series[i].count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFloat renders a value in the shortest form that reads back exactly.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Collector is a metric that a Registry can export: a *CounterVec, *Gauge, *GaugeVec,
+// *Histogram or *HistogramVec.
+type Collector interface {
+	write(w io.Writer) error
+}
+
+// Registry is a set of metrics exported together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry served by the application's /metrics endpoint.
+var Default = NewRegistry()
+
+// Register adds metrics to the registry.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// NewCounterVec creates a counter and registers it in the registry.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := NewCounterVec(name, help, labels...)
+	r.Register(c)
+	return c
+}
+
+// NewGauge creates a gauge and registers it in the registry.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := NewGauge(name, help)
+	r.Register(g)
+	return g
+}
+
+// NewGaugeVec creates a labelled gauge and registers it in the registry.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := NewGaugeVec(name, help, labels...)
+	r.Register(g)
+	return g
+}
+
+// NewHistogram creates a histogram and registers it in the registry.
+func (r *Registry) NewHistogram(name, help string, buckets ...float64) *Histogram {
+	h := NewHistogram(name, help, buckets...)
+	r.Register(h)
+	return h
+}
+
+// NewHistogramVec creates a labelled histogram and registers it in the registry.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := NewHistogramVec(name, help, buckets, labels...)
+	r.Register(h)
+	return h
+}
+
+// Write writes all registered metrics in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler serving the registry to Prometheus scrapers.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_total", "Test counter.", "kind")
+
+	c.Inc("a")
+	c.Inc("a")
+	c.Add(5, "b")
+
+	assert.Equal(t, uint64(2), c.Value("a"))
+	assert.Equal(t, uint64(5), c.Value("b"))
+	assert.Equal(t, uint64(0), c.Value("c"))
+	assert.Panics(t, func() { c.Inc() })
+}
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry()
+	updates := r.NewCounterVec("updates_total", "Updates received.", "type")
+	retries := r.NewCounterVec("retries_total", "Retries.")
+	updates.Inc("message")
+	updates.Inc("callback_query")
+	updates.Inc("message")
+	retries.Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+	assert.Equal(t, strings.Join([]string{
+		"# HELP updates_total Updates received.",
+		"# TYPE updates_total counter",
+		`updates_total{type="callback_query"} 1`,
+		`updates_total{type="message"} 2`,
+		"# HELP retries_total Retries.",
+		"# TYPE retries_total counter",
+		"retries_total 1",
+		"",
+	}, "\n"), rec.Body.String())
+}
+
+func TestGaugeAndHistogramExposition(t *testing.T) {
+	r := NewRegistry()
+	queue := r.NewGauge("queue_length", "Queued users.")
+	wait := r.NewHistogram("wait_seconds", "Wait time.", 1, 10)
+	queue.Set(3)
+	queue.Set(2)
+	wait.Observe(0.5)
+	wait.Observe(4)
+	wait.Observe(30)
+
+	assert.Equal(t, 2.0, queue.Value())
+	assert.Equal(t, uint64(3), wait.Count())
+	assert.Equal(t, 34.5, wait.Sum())
+	assert.Panics(t, func() { NewHistogram("bad", "Unsorted.", 10, 1) })
+
+	var buf strings.Builder
+	assert.NoError(t, r.Write(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"# HELP queue_length Queued users.",
+		"# TYPE queue_length gauge",
+		"queue_length 2",
+		"# HELP wait_seconds Wait time.",
+		"# TYPE wait_seconds histogram",
+		`wait_seconds_bucket{le="1"} 1`,
+		`wait_seconds_bucket{le="10"} 2`,
+		`wait_seconds_bucket{le="+Inf"} 3`,
+		"wait_seconds_sum 34.5",
+		"wait_seconds_count 3",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestGaugeVecExposition(t *testing.T) {
+	r := NewRegistry()
+	waiting := r.NewGaugeVec("waiting", "Waiting users.", "segment")
+	waiting.Set(4, "b")
+	waiting.Set(1.5, "a")
+	waiting.Set(3, "b")
+
+	assert.Equal(t, 3.0, waiting.Value("b"))
+	assert.Equal(t, 0.0, waiting.Value("c"))
+	assert.Panics(t, func() { waiting.Set(1) })
+
+	var buf strings.Builder
+	assert.NoError(t, r.Write(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"# HELP waiting Waiting users.",
+		"# TYPE waiting gauge",
+		`waiting{segment="a"} 1.5`,
+		`waiting{segment="b"} 3`,
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestHistogramVecExposition(t *testing.T) {
+	r := NewRegistry()
+	duration := r.NewHistogramVec("duration_seconds", "Duration.", []float64{0.1, 1}, "method")
+	duration.Observe(0.05, "b")
+	duration.Observe(2, "b")
+	duration.Observe(0.5, "a")
+
+	assert.Equal(t, uint64(2), duration.Count("b"))
+	assert.Equal(t, uint64(0), duration.Count("c"))
+	assert.Panics(t, func() { duration.Observe(1) })
+	assert.Panics(t, func() { NewHistogramVec("bad", "Unsorted.", []float64{1, 0.1}) })
+
+	var buf strings.Builder
+	assert.NoError(t, r.Write(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"# HELP duration_seconds Duration.",
+		"# TYPE duration_seconds histogram",
+		`duration_seconds_bucket{method="a",le="0.1"} 0`,
+		`duration_seconds_bucket{method="a",le="1"} 1`,
+		`duration_seconds_bucket{method="a",le="+Inf"} 1`,
+		`duration_seconds_sum{method="a"} 0.5`,
+		`duration_seconds_count{method="a"} 1`,
+		`duration_seconds_bucket{method="b",le="0.1"} 1`,
+		`duration_seconds_bucket{method="b",le="1"} 1`,
+		`duration_seconds_bucket{method="b",le="+Inf"} 2`,
+		`duration_seconds_sum{method="b"} 2.05`,
+		`duration_seconds_count{method="b"} 2`,
+		"",
+	}, "\n"), buf.String())
+}
@@ -0,0 +1,313 @@
+// Package migrations versions the PostgreSQL schema. Each migration is a pair of SQL files in
+// sql/, NNNN_name.up.sql and NNNN_name.down.sql, embedded in the binary. They are applied with
+// golang-migrate, which records the version of a database in its schema_version table.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// versionTable is the table golang-migrate records the version of a database in.
+const versionTable = "schema_version"
+
+// legacyTable is the table the versions applied to a database were recorded in, one row per
+// migration, before golang-migrate applied them. It is kept for older releases.
+const legacyTable = "schema_migrations"
+
+// fileName matches the file names of migrations, e.g. 0002_history_search_index.up.sql.
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change of the schema.
+type Migration struct {
+	// Version orders the migrations; it is unique and starts at 1.
+	Version int
+	// Name describes the change, e.g. "outbox_messages".
+	Name string
+	// Up is the SQL applying the change.
+	Up string
+	// Down is the SQL reverting the change.
+	Down string
+}
+
+// Status is the state of a migration in a database.
+type Status struct {
+	Migration
+	// Applied reports whether the migration was applied.
+	Applied bool
+	// Dirty reports whether applying or reverting the migration failed halfway. The schema
+	// must be fixed by hand and the version forced before migrating again.
+	Dirty bool
+}
+
+// Embedded returns the migrations built into the binary, ordered by version.
+func Embedded() []Migration {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		panic(err)
+	}
+	migrations, err := Parse(sub)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// Parse reads the migrations in the root of fsys, ordered by version. Every migration needs
+// both an up and a down file, and versions must be consecutive from 1.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s is out of sequence, expected version %d", m.Version, m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database.
+type Migrator struct {
+	// DB is the database migrated.
+	DB *gorm.DB
+	// Migrations are the known migrations, ordered by version.
+	Migrations []Migration
+	// Source holds the files of Migrations.
+	Source fs.FS
+}
+
+// New creates a Migrator of the embedded migrations.
+func New(db *gorm.DB) *Migrator {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		panic(err)
+	}
+	return &Migrator{DB: db, Migrations: Embedded(), Source: sub}
+}
+
+// open creates a golang-migrate instance on a connection of its own; golang-migrate holds
+// its advisory lock, so that instances starting at the same time apply each migration once,
+// on that connection. The returned function closes it.
+func (m *Migrator) open() (*migrate.Migrate, func(), error) {
+	sqlDB, err := m.DB.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	driver, err := postgres.WithConnection(context.Background(), conn, &postgres.Config{MigrationsTable: versionTable})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	source, err := iofs.New(m.Source, ".")
+	if err != nil {
+		driver.Close()
+		return nil, nil, err
+	}
+	mg, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		source.Close()
+		driver.Close()
+		return nil, nil, err
+	}
+	return mg, func() { mg.Close() }, nil
+}
+
+// version returns the version of the database and whether it is dirty. A database golang-migrate
+// did not migrate yet is at the last version recorded in legacyTable, if any.
+func (m *Migrator) version(mg *migrate.Migrate) (int, bool, error) {
+	version, dirty, err := mg.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		legacy, err := m.legacyVersion()
+		return legacy, false, err
+	}
+	return int(version), dirty, err
+}
+
+// legacyVersion returns the last version recorded in legacyTable, or 0.
+func (m *Migrator) legacyVersion() (int, error) {
+	if !m.DB.Migrator().HasTable(legacyTable) {
+		return 0, nil
+	}
+	var version int
+	err := m.DB.Table(legacyTable).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// adopt records the version of legacyTable in versionTable, unless golang-migrate already
+// migrated the database, and returns the version of the database.
+func (m *Migrator) adopt(mg *migrate.Migrate) (int, error) {
+	version, _, err := mg.Version()
+	if !errors.Is(err, migrate.ErrNilVersion) {
+		return int(version), err
+	}
+	legacy, err := m.legacyVersion()
+	if err != nil || legacy == 0 {
+		return 0, err
+	}
+	return legacy, mg.Force(legacy)
+}
+
+// Up applies the pending migrations in order and returns the migrations it applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	mg, closeMigrate, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeMigrate()
+	before, err := m.adopt(mg)
+	if err != nil {
+		return nil, err
+	}
+	upErr := mg.Up()
+	if errors.Is(upErr, migrate.ErrNoChange) {
+		upErr = nil
+	}
+	after, dirty, err := m.version(mg)
+	if err != nil {
+		return nil, errors.Join(upErr, err)
+	}
+	if dirty {
+		// The dirty version is the one that failed.
+		after--
+	}
+	var applied []Migration
+	for _, migration := range m.Migrations {
+		if migration.Version > before && migration.Version <= after {
+			applied = append(applied, migration)
+		}
+	}
+	if upErr != nil {
+		return applied, fmt.Errorf("migrating from version %d: %w", after, upErr)
+	}
+	return applied, nil
+}
+
+// Down reverts the last applied migration and returns it, or nil if none was applied.
+func (m *Migrator) Down() (*Migration, error) {
+	mg, closeMigrate, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeMigrate()
+	version, _, err := mg.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	migration, ok := m.find(int(version))
+	if !ok {
+		return nil, fmt.Errorf("migration %d is not known to this build", version)
+	}
+	if err := mg.Steps(-1); err != nil {
+		return nil, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return &migration, nil
+}
+
+// Status returns the state of every known migration, and the version of the database if this
+// build does not know it, e.g. after rolling back to an older release, or 0.
+func (m *Migrator) Status() ([]Status, int, error) {
+	mg, closeMigrate, err := m.open()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeMigrate()
+	version, dirty, err := m.version(mg)
+	if err != nil {
+		return nil, 0, err
+	}
+	statuses := make([]Status, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		statuses[i] = Status{Migration: migration, Applied: migration.Version <= version}
+		if dirty && migration.Version == version {
+			statuses[i].Applied, statuses[i].Dirty = false, true
+		}
+	}
+	unknown := 0
+	if _, ok := m.find(version); version > 0 && !ok {
+		unknown = version
+	}
+	return statuses, unknown, nil
+}
+
+// Verify returns an error if a known migration was not applied to the database.
+func (m *Migrator) Verify() error {
+	statuses, _, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Dirty {
+			return fmt.Errorf("migration %04d_%s failed halfway, fix the schema and force its version", status.Version, status.Name)
+		}
+		if !status.Applied {
+			return fmt.Errorf("migration %04d_%s is pending", status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// find returns the known migration of a version.
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
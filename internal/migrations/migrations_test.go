@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedded(t *testing.T) {
+	migrations := Embedded()
+
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "initial_schema", migrations[0].Name)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+	}
+}
+
+func TestParse(t *testing.T) {
+	migrations, err := Parse(fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX i ON t (c);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX i;")},
+		"0001_create.up.sql":      {Data: []byte("CREATE TABLE t (c text);")},
+		"0001_create.down.sql":    {Data: []byte("DROP TABLE t;")},
+		"README.md":               {Data: []byte("not a migration")},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create", Up: "CREATE TABLE t (c text);", Down: "DROP TABLE t;"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX i ON t (c);", Down: "DROP INDEX i;"},
+	}, migrations)
+}
+
+func TestParse_Rejects(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {
+			"0001_create.up.sql": {Data: []byte("CREATE TABLE t (c text);")},
+		},
+		"gap": {
+			"0001_create.up.sql":   {Data: []byte("CREATE TABLE t (c text);")},
+			"0001_create.down.sql": {Data: []byte("DROP TABLE t;")},
+			"0003_drop.up.sql":     {Data: []byte("DROP TABLE t;")},
+			"0003_drop.down.sql":   {Data: []byte("CREATE TABLE t (c text);")},
+		},
+		"two names": {
+			"0001_create.up.sql": {Data: []byte("CREATE TABLE t (c text);")},
+			"0001_make.down.sql": {Data: []byte("DROP TABLE t;")},
+		},
+	} {
+		_, err := Parse(fsys)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"chatgogo/backend/internal/models"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+// migratedModels are the models whose tables the migrations create, as in cmd/main.go.
+var migratedModels = []any{&models.ChatRoom{}, &models.User{}, &models.Complaint{}, &models.ChatHistory{}, &models.Ban{}, &models.OutboxMessage{}}
+
+// autoMigrated is the schema AutoMigrate created for the models before migrations were
+// versioned, the oldest schema 0001_initial_schema upgrades.
+var autoMigrated = map[string][]string{
+	"users":          {"id", "telegram_id", "age", "gender", "interests", "rating_score", "default_media_spoiler", "language"},
+	"chat_rooms":     {"room_id", "user1_id", "user2_id", "is_active", "started_at", "ended_at"},
+	"complaints":     {"id", "created_at", "updated_at", "deleted_at", "room_id", "reporter_id", "suspect_id", "logged_messages", "reason", "status"},
+	"chat_histories": {"id", "created_at", "updated_at", "deleted_at", "room_id", "sender_id", "content", "type", "metadata", "reply_to_message_id", "tg_message_id_sender", "tg_message_id_receiver"},
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	addColumnPattern   = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// migrateTables returns the columns of each table after applying the up migrations to a
+// database with the given tables.
+func migrateTables(t *testing.T, tables map[string][]string) map[string][]string {
+	t.Helper()
+	migrated := make(map[string][]string, len(tables))
+	for table, columns := range tables {
+		migrated[table] = slices.Clone(columns)
+	}
+	for _, m := range Embedded() {
+		for _, match := range createTablePattern.FindAllStringSubmatch(m.Up, -1) {
+			if _, exists := migrated[match[1]]; exists {
+				continue
+			}
+			var columns []string
+			for _, line := range strings.Split(match[2], "\n") {
+				if fields := strings.Fields(line); len(fields) > 0 {
+					columns = append(columns, fields[0])
+				}
+			}
+			migrated[match[1]] = columns
+		}
+		for _, match := range addColumnPattern.FindAllStringSubmatch(m.Up, -1) {
+			require.Contains(t, migrated, match[1], "%s alters a table it does not create", m.Name)
+			if !slices.Contains(migrated[match[1]], match[2]) {
+				migrated[match[1]] = append(migrated[match[1]], match[2])
+			}
+		}
+	}
+	return migrated
+}
+
+// modelSchema returns the columns of each table of migratedModels.
+func modelSchema(t *testing.T) map[string][]string {
+	t.Helper()
+	tables := make(map[string][]string, len(migratedModels))
+	for _, model := range migratedModels {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		require.NoError(t, err)
+		for _, field := range s.Fields {
+			if field.DBName != "" {
+				tables[s.Table] = append(tables[s.Table], field.DBName)
+			}
+		}
+	}
+	return tables
+}
+
+func sorted(tables map[string][]string) map[string][]string {
+	for _, columns := range tables {
+		sort.Strings(columns)
+	}
+	return tables
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	want := sorted(modelSchema(t))
+
+	assert.Equal(t, want, sorted(migrateTables(t, nil)), "a new database")
+	assert.Equal(t, want, sorted(migrateTables(t, autoMigrated)), "a database AutoMigrate created")
+}
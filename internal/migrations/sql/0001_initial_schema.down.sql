@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS bans;
+DROP TABLE IF EXISTS chat_histories;
+DROP TABLE IF EXISTS complaints;
+DROP TABLE IF EXISTS chat_rooms;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,118 @@
+-- The schema that AutoMigrate created before migrations were versioned. Databases it created
+-- keep their tables, and the ALTER TABLE statements add the columns the models gained since,
+-- so every statement is a no-op on a database that is already up to date.
+
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    telegram_id bigint,
+    age bigint,
+    gender text,
+    interests text[],
+    rating_score bigint,
+    default_media_spoiler boolean DEFAULT true,
+    language text DEFAULT 'en',
+    created_at timestamptz,
+    bot_blocked_at timestamptz,
+    preferred_gender text,
+    preferred_age_min bigint,
+    preferred_age_max bigint,
+    premium_until timestamptz,
+    blocked_users text[],
+    auto_requeue boolean,
+    region text,
+    prefer_near_timezone boolean,
+    lab_features text[],
+    read_receipts boolean,
+    hide_typing boolean,
+    hide_presence boolean
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bot_blocked_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_gender text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_age_min bigint;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_age_max bigint;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS premium_until timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_users text[];
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auto_requeue boolean;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS region text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS prefer_near_timezone boolean;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lab_features text[];
+ALTER TABLE users ADD COLUMN IF NOT EXISTS read_receipts boolean;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_typing boolean;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_presence boolean;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_telegram_id ON users (telegram_id);
+
+CREATE TABLE IF NOT EXISTS chat_rooms (
+    room_id text PRIMARY KEY,
+    user1_id text,
+    user2_id text,
+    is_active boolean,
+    started_at timestamptz,
+    ended_at timestamptz,
+    closed_by text,
+    close_reason text,
+    quality_score bigint,
+    safe_mode boolean
+);
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS closed_by text;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS close_reason text;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS quality_score bigint;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS safe_mode boolean;
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_quality_score ON chat_rooms (quality_score);
+
+CREATE TABLE IF NOT EXISTS complaints (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    room_id uuid NOT NULL,
+    reporter_id text NOT NULL,
+    suspect_id text NOT NULL,
+    logged_messages text,
+    reason text,
+    status text DEFAULT 'new',
+    severity text DEFAULT 'normal',
+    transcript_bundle text,
+    escalated_at timestamptz
+);
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS severity text DEFAULT 'normal';
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS transcript_bundle text;
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS escalated_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_complaints_deleted_at ON complaints (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_complaints_room_id ON complaints (room_id);
+CREATE INDEX IF NOT EXISTS idx_complaints_suspect_id ON complaints (suspect_id);
+
+CREATE TABLE IF NOT EXISTS chat_histories (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    room_id uuid NOT NULL,
+    sender_id text NOT NULL,
+    content text NOT NULL,
+    type text NOT NULL,
+    metadata text,
+    media_url text,
+    reply_to_message_id bigint,
+    tg_message_id_sender bigint,
+    tg_message_id_receiver bigint
+);
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_url text;
+CREATE INDEX IF NOT EXISTS idx_chat_histories_deleted_at ON chat_histories (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_room_msg ON chat_histories (room_id, sender_id);
+CREATE INDEX IF NOT EXISTS idx_chat_histories_reply_to_message_id ON chat_histories (reply_to_message_id);
+CREATE INDEX IF NOT EXISTS idx_chat_histories_tg_message_id_sender ON chat_histories (tg_message_id_sender);
+CREATE INDEX IF NOT EXISTS idx_chat_histories_tg_message_id_receiver ON chat_histories (tg_message_id_receiver);
+
+CREATE TABLE IF NOT EXISTS bans (
+    id bigserial PRIMARY KEY,
+    user_id text NOT NULL,
+    starts_at timestamptz NOT NULL,
+    ends_at timestamptz,
+    level text NOT NULL,
+    complaint_id bigint,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_bans_user_id ON bans (user_id);
+CREATE INDEX IF NOT EXISTS idx_bans_complaint_id ON bans (complaint_id);
+CREATE INDEX IF NOT EXISTS idx_bans_deleted_at ON bans (deleted_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_chat_histories_search;
@@ -0,0 +1,4 @@
+-- Full-text search over chat history (storage.Service.SearchHistory). The expression must
+-- stay the same as historySearchDocument for the index to be used.
+CREATE INDEX IF NOT EXISTS idx_chat_histories_search ON chat_histories
+    USING GIN (to_tsvector('simple', CASE WHEN type = 'text' THEN content ELSE COALESCE(metadata, '') END));
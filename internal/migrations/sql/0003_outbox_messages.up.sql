@@ -0,0 +1,8 @@
+-- Chat messages saved but not yet published to their room (models.OutboxMessage).
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    history_id bigint PRIMARY KEY,
+    room_id uuid NOT NULL,
+    payload text NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_created_at ON outbox_messages (created_at);
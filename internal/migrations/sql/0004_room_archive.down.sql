@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_chat_rooms_unarchived;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS archive_url;
+ALTER TABLE chat_rooms DROP COLUMN IF EXISTS archived_at;
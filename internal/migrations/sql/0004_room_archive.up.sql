@@ -0,0 +1,6 @@
+-- Rooms whose history was moved to object storage (archive.Archiver).
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS archived_at timestamptz;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS archive_url text;
+-- The closed rooms still to be archived (storage.Service.GetArchivableRooms).
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_unarchived ON chat_rooms (ended_at)
+    WHERE is_active = false AND archived_at IS NULL;
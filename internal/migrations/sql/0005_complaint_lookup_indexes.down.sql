@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_complaints_reporter_created_at;
+DROP INDEX IF EXISTS idx_complaints_room_suspect;
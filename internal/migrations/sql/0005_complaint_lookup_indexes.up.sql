@@ -0,0 +1,4 @@
+-- Lookups of complaints against a user in a room (Storage.GetComplaintsByRoomAndReportedUser)
+-- and of the complaints a user filed recently (Storage.GetComplaintsByReporterSince).
+CREATE INDEX IF NOT EXISTS idx_complaints_room_suspect ON complaints (room_id, suspect_id);
+CREATE INDEX IF NOT EXISTS idx_complaints_reporter_created_at ON complaints (reporter_id, created_at);
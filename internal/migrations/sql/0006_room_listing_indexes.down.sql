@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_chat_rooms_user2_id;
+DROP INDEX IF EXISTS idx_chat_rooms_user1_id;
+DROP INDEX IF EXISTS idx_chat_rooms_started_at;
@@ -0,0 +1,5 @@
+-- Listing rooms for administrators (Storage.ListRooms): newest first, by start time, and by
+-- participant.
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_started_at ON chat_rooms (started_at);
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_user1_id ON chat_rooms (user1_id);
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_user2_id ON chat_rooms (user2_id);
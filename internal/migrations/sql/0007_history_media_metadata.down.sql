@@ -0,0 +1,5 @@
+ALTER TABLE chat_histories DROP COLUMN IF EXISTS media_height;
+ALTER TABLE chat_histories DROP COLUMN IF EXISTS media_width;
+ALTER TABLE chat_histories DROP COLUMN IF EXISTS media_duration;
+ALTER TABLE chat_histories DROP COLUMN IF EXISTS media_mime_type;
+ALTER TABLE chat_histories DROP COLUMN IF EXISTS media_file_size;
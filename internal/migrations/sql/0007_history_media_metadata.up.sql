@@ -0,0 +1,7 @@
+-- The attached file of media messages (models.MediaInfo), for media quotas, moderation
+-- filters and clients that render attachments.
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_file_size bigint;
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_mime_type text;
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_duration bigint;
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_width bigint;
+ALTER TABLE chat_histories ADD COLUMN IF NOT EXISTS media_height bigint;
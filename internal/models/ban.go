@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ban levels.
+const (
+	BanLevelTemporary = "temporary"
+	BanLevelPermanent = "permanent"
+)
+
+// Ban is a sanction applied to a user. Every ban is kept as a row, so that the sanction
+// history of a user is complete and a ban applied by mistake can be reverted; reverting
+// soft-deletes the row. Whether a user is banned right now is mirrored in Redis (the
+// ban:{userID} key) from their bans that are neither over nor reverted.
+type Ban struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID string `gorm:"type:text;not null;index"`
+	// StartsAt is when the ban was applied.
+	StartsAt time.Time `gorm:"not null"`
+	// EndsAt is the end of a temporary ban, nil for a permanent one.
+	EndsAt *time.Time
+	// Level is BanLevelTemporary or BanLevelPermanent.
+	Level string `gorm:"type:text;not null"`
+	// ComplaintID is the confirmed complaint the ban was applied for, if any.
+	ComplaintID *uint `gorm:"index"`
+	// DeletedAt is set when the ban is reverted. Reverted bans stay in the history.
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// NewBan returns a ban of a user starting at the given time. A zero duration bans the user
+// permanently.
+func NewBan(userID string, start time.Time, duration time.Duration, complaintID *uint) *Ban {
+	ban := &Ban{UserID: userID, StartsAt: start, Level: BanLevelPermanent, ComplaintID: complaintID}
+	if duration > 0 {
+		end := start.Add(duration)
+		ban.EndsAt = &end
+		ban.Level = BanLevelTemporary
+	}
+	return ban
+}
+
+// IsActive reports whether the ban applies at the given time: it started, is not over and
+// was not reverted.
+func (b *Ban) IsActive(now time.Time) bool {
+	return !b.DeletedAt.Valid && !now.Before(b.StartsAt) && (b.EndsAt == nil || now.Before(*b.EndsAt))
+}
+
+// IsReverted reports whether the ban was reverted.
+func (b *Ban) IsReverted() bool {
+	return b.DeletedAt.Valid
+}
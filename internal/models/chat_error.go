@@ -0,0 +1,70 @@
+package models
+
+// ErrorCode identifies a failure reported to a client. Codes are stable, unlike the
+// localized texts of the messages reporting them.
+type ErrorCode string
+
+// Error codes of system messages.
+const (
+	// ErrorNotInChat means the request needs a chat partner, and the user has none.
+	ErrorNotInChat ErrorCode = "not_in_chat"
+	// ErrorBanned means the user is banned from chatting.
+	ErrorBanned ErrorCode = "banned"
+	// ErrorRateLimited means the user sent too many messages and must slow down.
+	ErrorRateLimited ErrorCode = "rate_limited"
+	// ErrorServiceBusy means the server is overloaded and rejected the request.
+	ErrorServiceBusy ErrorCode = "service_busy"
+	// ErrorInvalidRequest means the request, e.g. a search filter, is malformed.
+	ErrorInvalidRequest ErrorCode = "invalid_request"
+	// ErrorMessageTooLong means the message exceeded the maximum length.
+	ErrorMessageTooLong ErrorCode = "message_too_long"
+	// ErrorContentBlocked means the message was dropped because of its content, e.g. a
+	// blacklisted sticker or a link in a safe-mode room.
+	ErrorContentBlocked ErrorCode = "content_blocked"
+	// ErrorMessageHeld means the message was held for review.
+	ErrorMessageHeld ErrorCode = "message_held"
+	// ErrorDeliveryFailed means the message could not be delivered to the partner.
+	ErrorDeliveryFailed ErrorCode = "delivery_failed"
+	// ErrorInternal means the server failed to handle the request.
+	ErrorInternal ErrorCode = "internal"
+)
+
+// retryableErrors are the codes of failures that may not happen again if the same request is
+// repeated later.
+var retryableErrors = map[ErrorCode]bool{
+	ErrorRateLimited:    true,
+	ErrorServiceBusy:    true,
+	ErrorDeliveryFailed: true,
+	ErrorInternal:       true,
+}
+
+// Retryable reports whether repeating the failed request later may succeed.
+func (c ErrorCode) Retryable() bool {
+	return retryableErrors[c]
+}
+
+// ChatError is the structured description of a failure reported in a system message.
+type ChatError struct {
+	// Code identifies the failure.
+	Code ErrorCode `json:"code"`
+	// Key is the localization key of the text describing the failure to the user.
+	Key string `json:"key"`
+	// Retryable tells whether repeating the failed request later may succeed.
+	Retryable bool `json:"retryable"`
+}
+
+// NewChatError describes a failure with the given code and localization key.
+func NewChatError(code ErrorCode, key string) *ChatError {
+	return &ChatError{Code: code, Key: key, Retryable: code.Retryable()}
+}
+
+// ErrorMessage builds a "system_error" message reporting a failure to a user. Its Content is
+// the localization key, as for "system_info" messages.
+func ErrorMessage(code ErrorCode, key string) ChatMessage {
+	return ChatMessage{
+		Type:     "system_error",
+		Content:  key,
+		SenderID: "system",
+		Error:    NewChatError(code, key),
+	}
+}
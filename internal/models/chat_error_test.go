@@ -0,0 +1,30 @@
+package models_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorMessageEnvelope verifies the JSON clients receive for a failure.
+func TestErrorMessageEnvelope(t *testing.T) {
+	data, err := json.Marshal(models.ErrorMessage(models.ErrorRateLimited, "system_flood_warning"))
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "system_error", decoded["type"])
+	assert.Equal(t, "system_flood_warning", decoded["content"])
+	assert.Equal(t, map[string]any{"code": "rate_limited", "key": "system_flood_warning", "retryable": true}, decoded["error"])
+}
+
+// TestErrorCodeRetryable verifies which failures are worth retrying.
+func TestErrorCodeRetryable(t *testing.T) {
+	assert.True(t, models.ErrorServiceBusy.Retryable())
+	assert.False(t, models.ErrorBanned.Retryable())
+	assert.False(t, models.ErrorNotInChat.Retryable())
+	assert.False(t, models.ErrorCode("unknown").Retryable())
+}
@@ -18,6 +18,12 @@ type ChatHistory struct {
 	Type string `gorm:"type:text;not null"`
 	// Metadata contains additional information, such as captions for media.
 	Metadata string `gorm:"type:text"`
+	// MediaURL is the URL of a copy of the media re-hosted outside Telegram, so that it can
+	// be shown after the transport-specific file ID in Content expired. Empty until the media
+	// was re-hosted, and always empty when re-hosting is disabled.
+	MediaURL string `gorm:"type:text"`
+	// Media describes the attached file of media messages, as reported by the transport.
+	Media MediaInfo `gorm:"embedded;embeddedPrefix:media_"`
 	// ReplyToMessageID is a reference to the ID of the message being replied to.
 	ReplyToMessageID *uint `gorm:"index"`
 
@@ -26,3 +32,33 @@ type ChatHistory struct {
 	// TgMessageIDReceiver is the Telegram message ID for the message's recipient.
 	TgMessageIDReceiver *uint `gorm:"index"`
 }
+
+// AttachedMedia returns what is known about the attached file of the entry, or nil if
+// nothing is, e.g. for text messages.
+func (h ChatHistory) AttachedMedia() *MediaInfo {
+	if h.Media.IsZero() {
+		return nil
+	}
+	media := h.Media
+	return &media
+}
+
+// MediaInfo describes an attached file: its size and MIME type, and the duration and
+// dimensions of playable and visual media. Fields the transport did not report are zero.
+type MediaInfo struct {
+	// FileSize is the size of the file in bytes.
+	FileSize int64 `json:"file_size,omitempty"`
+	// MIMEType is the MIME type of the file, e.g. "video/mp4".
+	MIMEType string `gorm:"type:text" json:"mime_type,omitempty"`
+	// Duration is the length of audio and video in seconds.
+	Duration int `json:"duration,omitempty"`
+	// Width is the width of images and video in pixels.
+	Width int `json:"width,omitempty"`
+	// Height is the height of images and video in pixels.
+	Height int `json:"height,omitempty"`
+}
+
+// IsZero reports whether nothing is known about the file.
+func (m MediaInfo) IsZero() bool {
+	return m == MediaInfo{}
+}
@@ -17,4 +17,19 @@ type ChatRoom struct {
 	StartedAt time.Time
 	// EndedAt is the timestamp when the chat room was closed.
 	EndedAt time.Time
+	// ClosedBy is the anonymous ID of the user who closed the room, if any.
+	ClosedBy string
+	// CloseReason describes how the room was closed (e.g., "stop", "next").
+	CloseReason string
+	// QualityScore is the 0-100 conversation quality metric computed after the room is closed.
+	// It is nil until the room has been scored.
+	QualityScore *int `gorm:"index"`
+	// SafeMode is set when a participant is a minor. Messages in such rooms have links
+	// blocked, profanity masked and media covered by a spoiler, regardless of user settings.
+	SafeMode bool
+	// ArchivedAt is when the room's history was moved to the archive, nil while it is in the
+	// database.
+	ArchivedAt *time.Time
+	// ArchiveURL is the URL of the archived transcript of the room's history, if archived.
+	ArchiveURL string
 }
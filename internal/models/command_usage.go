@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// CommandUsage is how often a bot command was issued within an hour, globally and by its
+// busiest users.
+type CommandUsage struct {
+	// Command is the name of the command, without the slash (e.g., "next").
+	Command string `json:"command"`
+	// Hour is the start of the hour counted.
+	Hour time.Time `json:"hour"`
+	// Total is the number of invocations by all users.
+	Total int64 `json:"total"`
+	// TopUsers are the users who issued the command most often, busiest first.
+	TopUsers []CommandUserCount `json:"top_users"`
+}
+
+// CommandUserCount is the number of invocations of a command by one user.
+type CommandUserCount struct {
+	// UserID is the anonymous ID of the user.
+	UserID string `json:"user_id"`
+	// Count is the number of invocations.
+	Count int64 `json:"count"`
+	// Outlier is set if the count reaches the abuse threshold of the command.
+	Outlier bool `json:"outlier"`
+}
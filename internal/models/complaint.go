@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Complaint represents a user-submitted report against another user.
 // It contains details about the complaint, including the chat room, participants,
@@ -22,4 +26,21 @@ type Complaint struct {
 	Reason string `gorm:"type:text"`
 	// Status indicates the current state of the complaint (e.g., 'new', 'under_review').
 	Status string `gorm:"type:text;default:new"`
+	// Severity classifies how serious the reported incident is (e.g., 'normal', 'critical').
+	Severity string `gorm:"type:text;default:normal"`
+	// TranscriptBundle is the encrypted transcript attached when a critical complaint is
+	// confirmed. It can only be opened with the moderator private key.
+	TranscriptBundle string `gorm:"type:text"`
+	// EscalatedAt is the time the transcript bundle was attached.
+	EscalatedAt *time.Time
 }
+
+// Complaint statuses and severities used by the moderation workflow.
+const (
+	ComplaintStatusNew       = "new"
+	ComplaintStatusConfirmed = "confirmed"
+	ComplaintStatusRejected  = "rejected"
+
+	ComplaintSeverityNormal   = "normal"
+	ComplaintSeverityCritical = "critical"
+)
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// HistorySearch is a full-text search of the chat history, used by moderators to
+// investigate complaints. Empty scopes do not restrict the search.
+type HistorySearch struct {
+	// Query are the keywords, in web search syntax: all words must occur, "quoted words" in
+	// that order, a word after - must not occur, and OR between two words lets either occur.
+	// Words are matched in any language, but not stemmed.
+	Query string
+	// RoomID restricts the search to the messages of one room.
+	RoomID string
+	// SenderID restricts the search to the messages of one user.
+	SenderID string
+	// From restricts the search to messages sent at or after it.
+	From time.Time
+	// To restricts the search to messages sent before it.
+	To time.Time
+	// Limit is the maximum number of messages returned, newest first.
+	Limit int
+}
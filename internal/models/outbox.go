@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboxMessage is a chat message saved to the history but not yet published to its room.
+// It is written in the same transaction as its ChatHistory entry and deleted once the message
+// was published, so that a message that was saved is published at least once, even if the
+// instance that saved it failed to publish it.
+type OutboxMessage struct {
+	// HistoryID is the ID of the ChatHistory entry of the message.
+	HistoryID uint `gorm:"primaryKey;autoIncrement:false"`
+	// RoomID is the room the message is published to.
+	RoomID string `gorm:"type:uuid;not null"`
+	// Payload is the JSON-encoded ChatMessage, as published.
+	Payload string `gorm:"type:text;not null"`
+	// CreatedAt is when the message was saved.
+	CreatedAt time.Time `gorm:"index"`
+}
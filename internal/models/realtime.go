@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // ChatMessage is the real-time, in-memory representation of a message.
 // It is used for communication between different parts of the application,
 // such as routing through the central hub and publishing to Redis.
@@ -20,6 +22,33 @@ type ChatMessage struct {
 	Type string `json:"type"`
 	// Metadata contains optional extra information, like a caption.
 	Metadata string `json:"metadata,omitempty"`
+	// MediaUniqueID is the platform's stable unique ID of the attached file, if any.
+	MediaUniqueID string `json:"media_unique_id,omitempty"`
+	// StickerSetName is the name of the sticker pack for "sticker" messages.
+	StickerSetName string `json:"sticker_set_name,omitempty"`
+	// Media describes the attached file of media messages, if the platform reported it.
+	Media *MediaInfo `json:"media,omitempty"`
+	// Spoiler forces the media to be covered by a spoiler, regardless of the recipient's settings.
+	Spoiler bool `json:"spoiler,omitempty"`
+	// Entities holds the formatting of the text (for "text" messages) or of the caption
+	// (for media messages).
+	Entities []MessageEntity `json:"entities,omitempty"`
+	// Error describes the failure a system message reports, so that clients can handle it
+	// without parsing Content.
+	Error *ChatError `json:"error,omitempty"`
+}
+
+// MessageEntity is a formatted span of a message text, e.g., bold text or a link.
+// Offsets and lengths are measured in UTF-16 code units, as in the Telegram Bot API.
+type MessageEntity struct {
+	// Type is the kind of formatting (e.g., "bold", "italic", "text_link").
+	Type string `json:"type"`
+	// Offset is the start of the span.
+	Offset int `json:"offset"`
+	// Length is the length of the span.
+	Length int `json:"length"`
+	// URL is the target of a "text_link" entity.
+	URL string `json:"url,omitempty"`
 }
 
 // SearchRequest represents a user's request to find a chat partner.
@@ -28,12 +57,112 @@ type SearchRequest struct {
 	// UserID is the anonymous ID of the user initiating the search.
 	UserID string
 	// Params contains the search criteria for a chat partner.
-	Params struct {
-		TargetGender string
-		TargetAgeMin int
-		TargetAgeMax int
-	}
+	Params SearchParams
+	// EnqueuedAt is the time the user joined the matchmaking queue.
+	EnqueuedAt time.Time
+	// Boosted is set for premium users, who are placed ahead of regular users in the queue.
+	Boosted bool
+	// RelaxLevel is the number of filter relaxation steps applied to Params (see SearchParams.Relax).
+	RelaxLevel int
+	// Strict keeps Params from being relaxed while the user waits.
+	Strict bool
 	// ResultCh is a channel used to send the RoomID back to the user's session
-	// once a match is found.
-	ResultCh chan string
+	// once a match is found. It is not saved with the request.
+	ResultCh chan string `json:"-"`
+}
+
+// EffectiveParams returns the search criteria after the relaxation steps applied so far.
+func (r SearchRequest) EffectiveParams() SearchParams {
+	return r.Params.Relax(r.RelaxLevel)
+}
+
+// SearchParams holds the optional criteria a user sets for their chat partner.
+// Zero values mean "no preference".
+type SearchParams struct {
+	// TargetGender is the required gender of the partner.
+	TargetGender string
+	// TargetAgeMin is the minimum age of the partner.
+	TargetAgeMin int
+	// TargetAgeMax is the maximum age of the partner.
+	TargetAgeMax int
+	// NearRegion is the searcher's region; the partner's region must be near its timezone.
+	NearRegion string
+}
+
+// IsEmpty reports whether no search criteria are set.
+func (p SearchParams) IsEmpty() bool {
+	return p == SearchParams{}
+}
+
+// IsAdultOnly reports whether the criteria only admit adult partners.
+func (p SearchParams) IsAdultOnly() bool {
+	return p.TargetAgeMin >= AdultAge
+}
+
+// Filter relaxation steps applied by SearchParams.Relax, in order.
+const (
+	// RelaxAgeWidened widens the age range by RelaxAgeStep years on each side.
+	RelaxAgeWidened = 1
+	// RelaxAgeDropped drops the age range.
+	RelaxAgeDropped = 2
+	// RelaxGenderDropped drops the gender criterion.
+	RelaxGenderDropped = 3
+	// RelaxRegionDropped drops the timezone criterion.
+	RelaxRegionDropped = 4
+	// MaxRelaxLevel is the last relaxation step.
+	MaxRelaxLevel = RelaxRegionDropped
+)
+
+// RelaxAgeStep is how many years the age range is widened on each side by RelaxAgeWidened.
+const RelaxAgeStep = 5
+
+// Relax returns the criteria loosened by the given number of relaxation steps: first the age
+// range is widened, then dropped, then the gender criterion and finally the timezone
+// criterion are dropped. Adult-only criteria stay adult-only, so relaxing never admits
+// minors.
+func (p SearchParams) Relax(level int) SearchParams {
+	adultOnly := p.IsAdultOnly()
+	if level >= RelaxAgeWidened {
+		if p.TargetAgeMin > 0 {
+			p.TargetAgeMin = max(p.TargetAgeMin-RelaxAgeStep, MinUserAge)
+		}
+		if p.TargetAgeMax > 0 {
+			p.TargetAgeMax = min(p.TargetAgeMax+RelaxAgeStep, MaxUserAge)
+		}
+	}
+	if level >= RelaxAgeDropped {
+		p.TargetAgeMin, p.TargetAgeMax = 0, 0
+	}
+	if level >= RelaxGenderDropped {
+		p.TargetGender = ""
+	}
+	if level >= RelaxRegionDropped {
+		p.NearRegion = ""
+	}
+	if adultOnly && p.TargetAgeMin < AdultAge {
+		p.TargetAgeMin = AdultAge
+	}
+	return p
+}
+
+// MatchesUser reports whether the given user's profile satisfies the criteria.
+// A user with an unknown age never satisfies an age filter, and a user without a region
+// never satisfies a timezone filter.
+func (p SearchParams) MatchesUser(user *User) bool {
+	if user == nil {
+		return p.IsEmpty()
+	}
+	if p.TargetGender != "" && user.Gender != p.TargetGender {
+		return false
+	}
+	if p.TargetAgeMin > 0 && (user.Age == 0 || user.Age < p.TargetAgeMin) {
+		return false
+	}
+	if p.TargetAgeMax > 0 && (user.Age == 0 || user.Age > p.TargetAgeMax) {
+		return false
+	}
+	if p.NearRegion != "" && !RegionsNear(p.NearRegion, user.Region) {
+		return false
+	}
+	return true
 }
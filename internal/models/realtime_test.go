@@ -0,0 +1,50 @@
+package models_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSearchParamsRelax verifies the filter relaxation steps.
+func TestSearchParamsRelax(t *testing.T) {
+	p := models.SearchParams{TargetGender: "female", TargetAgeMin: 14, TargetAgeMax: 16}
+
+	assert.Equal(t, p, p.Relax(0))
+	assert.Equal(t, models.SearchParams{TargetGender: "female", TargetAgeMin: 10, TargetAgeMax: 21}, p.Relax(models.RelaxAgeWidened))
+	assert.Equal(t, models.SearchParams{TargetGender: "female"}, p.Relax(models.RelaxAgeDropped))
+	assert.Equal(t, models.SearchParams{}, p.Relax(models.RelaxGenderDropped))
+}
+
+// TestSearchParamsRelaxKeepsAdultOnly verifies that relaxing adult-only criteria never admits minors.
+func TestSearchParamsRelaxKeepsAdultOnly(t *testing.T) {
+	p := models.SearchParams{TargetAgeMin: 20}
+
+	assert.Equal(t, models.SearchParams{TargetAgeMin: models.AdultAge}, p.Relax(models.RelaxAgeWidened))
+	assert.Equal(t, models.SearchParams{TargetAgeMin: models.AdultAge}, p.Relax(models.MaxRelaxLevel))
+	assert.Equal(t, models.SearchParams{TargetAgeMax: 16}, models.SearchParams{TargetAgeMax: 11}.Relax(models.RelaxAgeWidened))
+}
+
+// TestSearchParamsNearRegion verifies the timezone criterion and that it is relaxed last.
+func TestSearchParamsNearRegion(t *testing.T) {
+	p := models.SearchParams{TargetGender: "female", NearRegion: "europe_east"}
+
+	assert.True(t, p.MatchesUser(&models.User{Gender: "female", Region: "middle_east"}))
+	assert.False(t, p.MatchesUser(&models.User{Gender: "female", Region: "east_asia"}))
+	assert.False(t, p.MatchesUser(&models.User{Gender: "female"}), "users without a region never match")
+
+	assert.Equal(t, models.SearchParams{NearRegion: "europe_east"}, p.Relax(models.RelaxGenderDropped))
+	assert.Equal(t, models.SearchParams{}, p.Relax(models.RelaxRegionDropped))
+}
+
+// TestRegionsNear verifies the timezone distance between regions, across the date line.
+func TestRegionsNear(t *testing.T) {
+	assert.True(t, models.RegionsNear("europe_central", "europe_central"))
+	assert.True(t, models.RegionsNear("america_east", "south_america"))
+	assert.False(t, models.RegionsNear("europe_west", "central_asia"))
+	assert.True(t, models.RegionsNear("oceania", "east_asia"))
+	assert.False(t, models.RegionsNear("america_west", "oceania"))
+	assert.False(t, models.RegionsNear("europe_west", ""))
+	assert.False(t, models.RegionsNear("atlantis", "atlantis"))
+}
@@ -0,0 +1,53 @@
+package models
+
+// Region is a coarse area a user can pick in their settings. Only its typical UTC offset is
+// used, to pair people who are awake at the same hours; it is never shown to partners.
+type Region struct {
+	// Code is the stored identifier of the region.
+	Code string
+	// UTCOffset is the typical offset of the region from UTC, in hours.
+	UTCOffset int
+}
+
+// Regions are the regions users can choose from, west to east.
+var Regions = []Region{
+	{Code: "america_west", UTCOffset: -8},
+	{Code: "america_east", UTCOffset: -5},
+	{Code: "south_america", UTCOffset: -3},
+	{Code: "europe_west", UTCOffset: 0},
+	{Code: "europe_central", UTCOffset: 1},
+	{Code: "europe_east", UTCOffset: 2},
+	{Code: "middle_east", UTCOffset: 3},
+	{Code: "central_asia", UTCOffset: 5},
+	{Code: "east_asia", UTCOffset: 8},
+	{Code: "oceania", UTCOffset: 10},
+}
+
+// MaxTimezoneGap is the largest difference, in hours, between the UTC offsets of two
+// regions that are considered near each other's timezone.
+const MaxTimezoneGap = 3
+
+// RegionByCode returns the region with the given code.
+func RegionByCode(code string) (Region, bool) {
+	for _, region := range Regions {
+		if region.Code == code {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// RegionsNear reports whether two regions are within MaxTimezoneGap hours of each other,
+// taking the wrap-around at the date line into account. Unknown regions are never near.
+func RegionsNear(a, b string) bool {
+	regionA, okA := RegionByCode(a)
+	regionB, okB := RegionByCode(b)
+	if !okA || !okB {
+		return false
+	}
+	gap := regionA.UTCOffset - regionB.UTCOffset
+	if gap < 0 {
+		gap = -gap
+	}
+	return min(gap, 24-gap) <= MaxTimezoneGap
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// RoomFilter selects the rooms listed for administrators (Storage.ListRooms). Zero fields do
+// not restrict the list.
+type RoomFilter struct {
+	// Active restricts the list to active rooms if true, and to closed rooms if false.
+	Active *bool
+	// ParticipantID restricts the list to the rooms of one user.
+	ParticipantID string
+	// From restricts the list to rooms started at or after it.
+	From time.Time
+	// To restricts the list to rooms started before it.
+	To time.Time
+	// MinMessages restricts the list to rooms with at least this many messages.
+	MinMessages int
+	// MaxMessages restricts the list to rooms with at most this many messages.
+	MaxMessages *int
+	// Limit is the maximum number of rooms returned, newest first.
+	Limit int
+	// Offset is the number of matching rooms skipped, for the following pages.
+	Offset int
+}
+
+// RoomListing is a room listed for administrators, with the size of its history.
+type RoomListing struct {
+	ChatRoom
+	// MessageCount is the number of messages in the room's history; it is 0 once the
+	// history was archived or deleted.
+	MessageCount int64
+}
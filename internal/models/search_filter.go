@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when search criteria given with a search command are invalid.
+var (
+	// ErrInvalidSearchGender means the partner gender is not "male" or "female".
+	ErrInvalidSearchGender = errors.New("invalid partner gender")
+	// ErrInvalidSearchAge means the partner age range is malformed or out of bounds.
+	ErrInvalidSearchAge = errors.New("invalid partner age range")
+	// ErrInvalidSearchFilter means an argument is neither a gender nor an age range.
+	ErrInvalidSearchFilter = errors.New("invalid search filter")
+)
+
+// SearchFilter is the search criteria given with a single search command, e.g.
+// "/start female 20-30". WebSocket clients send it as the JSON Metadata of a
+// command_start message. Zero values mean "no preference".
+type SearchFilter struct {
+	// Gender is the required gender of the partner.
+	Gender string `json:"gender,omitempty"`
+	// AgeMin is the minimum age of the partner.
+	AgeMin int `json:"age_min,omitempty"`
+	// AgeMax is the maximum age of the partner.
+	AgeMax int `json:"age_max,omitempty"`
+}
+
+// ParseSearchFilter parses the arguments of a search command: an optional partner gender
+// ("male", "female", "m", "f" or "any") and an optional age range in the format accepted by
+// ParseAgeRange, in any order.
+func ParseSearchFilter(args string) (SearchFilter, error) {
+	var filter SearchFilter
+	for _, arg := range strings.Fields(strings.ToLower(args)) {
+		switch arg {
+		case "male", "m":
+			filter.Gender = "male"
+		case "female", "f":
+			filter.Gender = "female"
+		case "any":
+			filter.Gender = ""
+		default:
+			if !strings.ContainsAny(arg, "0123456789") {
+				return SearchFilter{}, ErrInvalidSearchFilter
+			}
+			ageMin, ageMax, ok := ParseAgeRange(arg)
+			if !ok {
+				return SearchFilter{}, ErrInvalidSearchAge
+			}
+			filter.AgeMin, filter.AgeMax = ageMin, ageMax
+		}
+	}
+	return filter, nil
+}
+
+// Params validates the filter and returns it as search criteria.
+func (f SearchFilter) Params() (SearchParams, error) {
+	if f.Gender != "" && f.Gender != "male" && f.Gender != "female" {
+		return SearchParams{}, ErrInvalidSearchGender
+	}
+	for _, age := range []int{f.AgeMin, f.AgeMax} {
+		if age != 0 && (age < MinUserAge || age > MaxUserAge) {
+			return SearchParams{}, ErrInvalidSearchAge
+		}
+	}
+	if f.AgeMin < 0 || f.AgeMax < 0 || f.AgeMax != 0 && f.AgeMin > f.AgeMax {
+		return SearchParams{}, ErrInvalidSearchAge
+	}
+	return SearchParams{TargetGender: f.Gender, TargetAgeMin: f.AgeMin, TargetAgeMax: f.AgeMax}, nil
+}
+
+// ParseAgeRange parses a partner age range such as "18-30", "18-" (18 and older) or "-30"
+// (up to 30). A bound of 0 means no limit. Bounds must lie within the allowed profile ages.
+func ParseAgeRange(text string) (ageMin, ageMax int, ok bool) {
+	lower, upper, found := strings.Cut(strings.ReplaceAll(strings.TrimSpace(text), "–", "-"), "-")
+	if !found {
+		return 0, 0, false
+	}
+	bounds := [2]int{}
+	for i, bound := range []string{lower, upper} {
+		bound = strings.TrimSpace(bound)
+		if bound == "" || bound == "0" {
+			continue
+		}
+		age, err := strconv.Atoi(bound)
+		if err != nil || age < MinUserAge || age > MaxUserAge {
+			return 0, 0, false
+		}
+		bounds[i] = age
+	}
+	ageMin, ageMax = bounds[0], bounds[1]
+	if ageMin == 0 && ageMax == 0 || ageMax != 0 && ageMin > ageMax {
+		return 0, 0, false
+	}
+	return ageMin, ageMax, true
+}
@@ -0,0 +1,67 @@
+package models_test
+
+import (
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAgeRange(t *testing.T) {
+	cases := []struct {
+		text     string
+		min, max int
+		ok       bool
+	}{
+		{"18-30", 18, 30, true},
+		{" 20 – 25 ", 20, 25, true},
+		{"25-", 25, 0, true},
+		{"-40", 0, 40, true},
+		{"30-18", 0, 0, false},
+		{"-", 0, 0, false},
+		{"18", 0, 0, false},
+		{"5-30", 0, 0, false},
+		{"18-200", 0, 0, false},
+		{"abc-30", 0, 0, false},
+	}
+	for _, c := range cases {
+		ageMin, ageMax, ok := models.ParseAgeRange(c.text)
+		assert.Equal(t, c.ok, ok, c.text)
+		assert.Equal(t, c.min, ageMin, c.text)
+		assert.Equal(t, c.max, ageMax, c.text)
+	}
+}
+
+// TestParseSearchFilter verifies the arguments accepted by search commands.
+func TestParseSearchFilter(t *testing.T) {
+	filter, err := models.ParseSearchFilter("female 20-30")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SearchFilter{Gender: "female", AgeMin: 20, AgeMax: 30}, filter)
+
+	filter, err = models.ParseSearchFilter(" 25-  M ")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SearchFilter{Gender: "male", AgeMin: 25}, filter)
+
+	filter, err = models.ParseSearchFilter("")
+	assert.NoError(t, err)
+	assert.Equal(t, models.SearchFilter{}, filter)
+
+	_, err = models.ParseSearchFilter("female 30-20")
+	assert.ErrorIs(t, err, models.ErrInvalidSearchAge)
+	_, err = models.ParseSearchFilter("robot")
+	assert.ErrorIs(t, err, models.ErrInvalidSearchFilter)
+}
+
+// TestSearchFilterParams verifies the validation of filters sent by WebSocket clients.
+func TestSearchFilterParams(t *testing.T) {
+	params, err := models.SearchFilter{Gender: "male", AgeMin: 18}.Params()
+	assert.NoError(t, err)
+	assert.Equal(t, models.SearchParams{TargetGender: "male", TargetAgeMin: 18}, params)
+
+	_, err = models.SearchFilter{Gender: "robot"}.Params()
+	assert.ErrorIs(t, err, models.ErrInvalidSearchGender)
+	_, err = models.SearchFilter{AgeMin: 5}.Params()
+	assert.ErrorIs(t, err, models.ErrInvalidSearchAge)
+	_, err = models.SearchFilter{AgeMin: 40, AgeMax: 30}.Params()
+	assert.ErrorIs(t, err, models.ErrInvalidSearchAge)
+}
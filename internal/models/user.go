@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq" // Required for pq.StringArray
 	"gorm.io/gorm"
@@ -17,6 +19,110 @@ type User struct {
 	RatingScore         int            // Rating score given by chat partners
 	DefaultMediaSpoiler bool           `gorm:"default:true"` // User preference: if true, media sent by this user will have spoiler flag by default
 	Language            string         `gorm:"default:'en'"` // User's interface language
+	CreatedAt           time.Time      // Account creation time, populated by GORM
+	BotBlockedAt        *time.Time     // Set while the user has blocked the bot; the user is inactive until they write again
+	PreferredGender     string         // Search preference: partner gender, empty for any
+	PreferredAgeMin     int            // Search preference: minimum partner age, 0 for no minimum
+	PreferredAgeMax     int            // Search preference: maximum partner age, 0 for no maximum
+	PremiumUntil        *time.Time     // End of the premium entitlement, nil if the user never had one
+	BlockedUsers        pq.StringArray `gorm:"type:text[]"` // IDs of users this user blocked; they are never matched again
+	AutoRequeue         *bool          // Preference: search again when the partner leaves with /next; nil uses the server default
+	Region              string         // Coarse region (see Regions), empty if not set
+	PreferNearTimezone  bool           // Search preference: only match people whose region is near the user's timezone
+	LabFeatures         pq.StringArray `gorm:"type:text[]"` // Experimental features the user opted into in /labs (see package features)
+	ReadReceipts        bool           // Preference: exchange "seen" receipts with partners who opted in too
+	HideTyping          bool           // Preference: do not show partners when this user is typing
+	HidePresence        bool           // Preference: do not show partners whether this user is online
+}
+
+// Bounds of the age a user may enter in their profile.
+const (
+	MinUserAge = 10
+	MaxUserAge = 100
+)
+
+// AdultAge is the age from which a user is treated as an adult. Rooms with a younger
+// participant run in safe mode.
+const AdultAge = 18
+
+// Trust badges shown to chat partners. They are coarse bands derived from the user's
+// reputation and account age, so exact rating scores are never revealed.
+const (
+	TrustBadgeNew                = "new"
+	TrustBadgeTrusted            = "trusted"
+	TrustBadgeFrequentlyReported = "frequently_reported"
+)
+
+const (
+	// TrustedRatingThreshold is the rating score from which a user is considered trusted.
+	TrustedRatingThreshold = 10
+	// ReportedRatingThreshold is the rating score at or below which a user is considered
+	// frequently reported.
+	ReportedRatingThreshold = -3
+	// NewUserPeriod is the account age under which a user is considered new.
+	NewUserPeriod = 7 * 24 * time.Hour
+)
+
+// TrustBadge returns the user's trust band at the given time, or an empty string if the
+// user is neither new, trusted nor frequently reported.
+func (u *User) TrustBadge(now time.Time) string {
+	switch {
+	case u.RatingScore <= ReportedRatingThreshold:
+		return TrustBadgeFrequentlyReported
+	case u.RatingScore >= TrustedRatingThreshold:
+		return TrustBadgeTrusted
+	case now.Sub(u.CreatedAt) < NewUserPeriod:
+		return TrustBadgeNew
+	}
+	return ""
+}
+
+// Profile fields that contribute to the profile completeness.
+const (
+	ProfileFieldAge       = "age"
+	ProfileFieldGender    = "gender"
+	ProfileFieldInterests = "interests"
+)
+
+// MissingProfileFields returns the profile fields the user has not filled in yet.
+func (u *User) MissingProfileFields() []string {
+	var missing []string
+	if u.Age == 0 {
+		missing = append(missing, ProfileFieldAge)
+	}
+	if u.Gender == "" {
+		missing = append(missing, ProfileFieldGender)
+	}
+	if len(u.Interests) == 0 {
+		missing = append(missing, ProfileFieldInterests)
+	}
+	return missing
+}
+
+// ProfileCompleteness returns the share of filled-in profile fields as a 0-100 percentage.
+// Interests weigh the most, as they drive partner selection.
+func (u *User) ProfileCompleteness() int {
+	completeness := 100
+	for _, field := range u.MissingProfileFields() {
+		switch field {
+		case ProfileFieldInterests:
+			completeness -= 40
+		default:
+			completeness -= 30
+		}
+	}
+	return completeness
+}
+
+// IsPremium reports whether the user's premium entitlement is active at the given time.
+func (u *User) IsPremium(now time.Time) bool {
+	return u.PremiumUntil != nil && now.Before(*u.PremiumUntil)
+}
+
+// IsMinor reports whether the user stated an age below AdultAge. Users with an unknown
+// age are not treated as minors.
+func (u *User) IsMinor() bool {
+	return u.Age > 0 && u.Age < AdultAge
 }
 
 // BeforeCreate is a GORM hook that is called before a record is created.
@@ -29,3 +135,47 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+// SearchParams returns the user's persisted search preferences as search criteria.
+// The timezone preference only applies once the user has chosen a region.
+func (u *User) SearchParams() SearchParams {
+	params := SearchParams{
+		TargetGender: u.PreferredGender,
+		TargetAgeMin: u.PreferredAgeMin,
+		TargetAgeMax: u.PreferredAgeMax,
+	}
+	if u.PreferNearTimezone && u.Region != "" {
+		params.NearRegion = u.Region
+	}
+	return params
+}
+
+// WantsAutoRequeue reports whether the user is put back into the search queue when their
+// partner leaves with /next. Users who never chose use the server default.
+func (u *User) WantsAutoRequeue(serverDefault bool) bool {
+	if u.AutoRequeue == nil {
+		return serverDefault
+	}
+	return *u.AutoRequeue
+}
+
+// HasBlocked reports whether the user blocked the given user.
+func (u *User) HasBlocked(userID string) bool {
+	for _, id := range u.BlockedUsers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLabFeature reports whether the user opted into an experimental feature. Whether they
+// get it also depends on the feature being switched on; see features.Service.Enabled.
+func (u *User) HasLabFeature(feature string) bool {
+	for _, f := range u.LabFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
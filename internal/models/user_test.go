@@ -4,6 +4,7 @@ import (
 	"chatgogo/backend/internal/models"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -233,3 +234,74 @@ func BenchmarkUserBeforeCreate(b *testing.B) {
 		_ = user.BeforeCreate(nil)
 	}
 }
+
+// TestUserTrustBadge verifies the reputation bands shown to chat partners.
+func TestUserTrustBadge(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		user     models.User
+		expected string
+	}{
+		{"New account", models.User{CreatedAt: now.Add(-time.Hour)}, models.TrustBadgeNew},
+		{"Regular account", models.User{CreatedAt: old, RatingScore: 3}, ""},
+		{"Trusted account", models.User{CreatedAt: old, RatingScore: models.TrustedRatingThreshold}, models.TrustBadgeTrusted},
+		{"Reported account", models.User{CreatedAt: old, RatingScore: models.ReportedRatingThreshold}, models.TrustBadgeFrequentlyReported},
+		{"Reported new account", models.User{CreatedAt: now, RatingScore: -5}, models.TrustBadgeFrequentlyReported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.user.TrustBadge(now))
+		})
+	}
+}
+
+// TestUserProfileCompleteness verifies the missing fields and the completeness percentage.
+func TestUserProfileCompleteness(t *testing.T) {
+	empty := models.User{}
+	assert.Equal(t, []string{models.ProfileFieldAge, models.ProfileFieldGender, models.ProfileFieldInterests}, empty.MissingProfileFields())
+	assert.Equal(t, 0, empty.ProfileCompleteness())
+
+	partial := models.User{Age: 20, Gender: "female"}
+	assert.Equal(t, []string{models.ProfileFieldInterests}, partial.MissingProfileFields())
+	assert.Equal(t, 60, partial.ProfileCompleteness())
+
+	full := models.User{Age: 20, Gender: "female", Interests: pq.StringArray{"music"}}
+	assert.Empty(t, full.MissingProfileFields())
+	assert.Equal(t, 100, full.ProfileCompleteness())
+}
+
+// TestUserIsPremium verifies that the premium entitlement is active only until PremiumUntil.
+func TestUserIsPremium(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+	user := models.User{PremiumUntil: &until}
+
+	assert.True(t, user.IsPremium(now))
+	assert.False(t, user.IsPremium(until))
+	assert.False(t, (&models.User{}).IsPremium(now))
+}
+
+// TestUserWantsAutoRequeue verifies that an explicit preference overrides the server default.
+func TestUserWantsAutoRequeue(t *testing.T) {
+	on, off := true, false
+
+	assert.True(t, (&models.User{}).WantsAutoRequeue(true))
+	assert.False(t, (&models.User{}).WantsAutoRequeue(false))
+	assert.True(t, (&models.User{AutoRequeue: &on}).WantsAutoRequeue(false))
+	assert.False(t, (&models.User{AutoRequeue: &off}).WantsAutoRequeue(true))
+}
+
+func TestUserSearchParamsNearTimezone(t *testing.T) {
+	user := &models.User{PreferNearTimezone: true}
+	assert.Empty(t, user.SearchParams().NearRegion, "the preference needs a region")
+
+	user.Region = "europe_east"
+	assert.Equal(t, "europe_east", user.SearchParams().NearRegion)
+
+	user.PreferNearTimezone = false
+	assert.Empty(t, user.SearchParams().NearRegion)
+}
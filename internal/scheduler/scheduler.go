@@ -0,0 +1,150 @@
+// Package scheduler runs the recurring background jobs of the hub process, e.g. closing idle
+// rooms or deleting old history, each at its own interval. Every run of a job is counted in
+// the metrics, with the number of items it processed.
+package scheduler
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Results of job runs counted by chatgogo_scheduler_job_runs_total.
+const (
+	// resultDone is a run that did its work.
+	resultDone = "done"
+	// resultSkipped is a run of an exclusive job that another instance did in this interval.
+	resultSkipped = "skipped"
+	// resultFailed is a run of an exclusive job that could not be claimed.
+	resultFailed = "failed"
+)
+
+// claimTTLFactor is the part of the interval of an exclusive job for which a run is claimed.
+// It is shorter than the interval, so that the claiming instance, whose ticker fires a little
+// late, can claim the next run again.
+const claimTTLFactor = 0.9
+
+var (
+	jobRuns = metrics.Default.NewCounterVec("chatgogo_scheduler_job_runs_total",
+		"Runs of scheduled jobs, by job and result (done, skipped or failed).", "job", "result")
+	jobItems = metrics.Default.NewCounterVec("chatgogo_scheduler_job_items_total",
+		"Items, e.g. rooms or messages, processed by scheduled jobs.", "job")
+	jobLastRun = metrics.Default.NewGaugeVec("chatgogo_scheduler_job_last_run_timestamp_seconds",
+		"Unix time of the last finished run of a scheduled job on this instance.", "job")
+	jobDuration = metrics.Default.NewGaugeVec("chatgogo_scheduler_job_duration_seconds",
+		"Duration of the last run of a scheduled job on this instance.", "job")
+)
+
+// Job is a recurring task.
+type Job struct {
+	// Name identifies the job in logs, metrics and claims.
+	Name string
+	// Interval is the time between two runs, the first of which is at startup. Jobs with no
+	// interval are not scheduled.
+	Interval time.Duration
+	// Exclusive jobs run on one instance per interval, whichever claims the run first, e.g.
+	// because running them twice would apply their effect twice. Other jobs run on every
+	// instance.
+	Exclusive bool
+	// Run does the work due at now and returns the number of items it processed. It logs its
+	// own errors.
+	Run func(now time.Time) int
+}
+
+// Claimer claims the runs of exclusive jobs across instances, e.g. *storage.Service.
+type Claimer interface {
+	// ClaimJobRun reports whether this instance may run a job, which it may not if another
+	// claimed it within ttl.
+	ClaimJobRun(job string, ttl time.Duration) (bool, error)
+}
+
+// Scheduler runs registered jobs, each in its own goroutine, so that a slow job does not
+// delay the others. A job never overlaps with itself.
+type Scheduler struct {
+	// Claims claims the runs of exclusive jobs. Without it, they run on every instance.
+	Claims Claimer
+
+	jobs []Job
+}
+
+// New creates a Scheduler claiming the runs of exclusive jobs with claims.
+func New(claims Claimer) *Scheduler {
+	return &Scheduler{Claims: claims}
+}
+
+// Register adds a job. It must be called before Run.
+func (s *Scheduler) Register(job Job) {
+	if job.Interval <= 0 {
+		log.Printf("Scheduler: job %s is disabled.", job.Name)
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs returns the names of the registered jobs.
+func (s *Scheduler) Jobs() []string {
+	names := make([]string, len(s.jobs))
+	for i, job := range s.jobs {
+		names[i] = job.Name
+	}
+	return names
+}
+
+// Run runs the registered jobs at their intervals until ctx is cancelled, and then waits for
+// the runs in progress to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("Scheduler started with jobs %v.", s.Jobs())
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.schedule(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+// schedule runs a job right away and then every interval until ctx is cancelled. Running it
+// at startup means that jobs with long intervals still run on instances that restart more
+// often; the claims of exclusive jobs outlive restarts, so they are not run more often.
+func (s *Scheduler) schedule(ctx context.Context, job Job) {
+	s.runOnce(job, time.Now())
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runOnce(job, now)
+		}
+	}
+}
+
+// runOnce runs a job, unless it is exclusive and another instance claimed this run.
+func (s *Scheduler) runOnce(job Job, now time.Time) {
+	if job.Exclusive && s.Claims != nil {
+		claimed, err := s.Claims.ClaimJobRun(job.Name, time.Duration(float64(job.Interval)*claimTTLFactor))
+		if err != nil {
+			log.Printf("ERROR: Failed to claim a run of job %s: %v", job.Name, err)
+			jobRuns.Inc(job.Name, resultFailed)
+			return
+		}
+		if !claimed {
+			jobRuns.Inc(job.Name, resultSkipped)
+			return
+		}
+	}
+
+	started := time.Now()
+	items := job.Run(now)
+	jobDuration.Set(time.Since(started).Seconds(), job.Name)
+	jobLastRun.Set(float64(time.Now().Unix()), job.Name)
+	jobRuns.Inc(job.Name, resultDone)
+	if items > 0 {
+		jobItems.Add(uint64(items), job.Name)
+	}
+}
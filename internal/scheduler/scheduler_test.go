@@ -0,0 +1,66 @@
+package scheduler_test
+
+import (
+	"chatgogo/backend/internal/scheduler"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// claims hands out the run of each job to the first caller.
+type claims struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+}
+
+func (c *claims) ClaimJobRun(job string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.claimed[job] {
+		return false, nil
+	}
+	c.claimed[job] = true
+	return true, nil
+}
+
+func TestSchedulerRunsJobsAtTheirIntervals(t *testing.T) {
+	var fast, slow atomic.Int32
+	jobs := scheduler.New(nil)
+	jobs.Register(scheduler.Job{Name: "fast", Interval: 10 * time.Millisecond, Run: func(time.Time) int { fast.Add(1); return 1 }})
+	jobs.Register(scheduler.Job{Name: "slow", Interval: time.Hour, Run: func(time.Time) int { slow.Add(1); return 1 }})
+	jobs.Register(scheduler.Job{Name: "disabled", Run: func(time.Time) int { return 1 }})
+	assert.Equal(t, []string{"fast", "slow"}, jobs.Jobs())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	jobs.Run(ctx)
+
+	assert.GreaterOrEqual(t, fast.Load(), int32(3))
+	assert.Equal(t, int32(1), slow.Load(), "jobs run once at startup")
+}
+
+func TestSchedulerRunsExclusiveJobsOnce(t *testing.T) {
+	shared := &claims{claimed: map[string]bool{}}
+	var runs atomic.Int32
+	job := scheduler.Job{Name: "recovery", Interval: 10 * time.Millisecond, Exclusive: true, Run: func(time.Time) int { runs.Add(1); return 0 }}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 35*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for range 2 {
+		instance := scheduler.New(shared)
+		instance.Register(job)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance.Run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), runs.Load(), "the claim lasts for the whole test")
+}
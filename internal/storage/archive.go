@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetArchivableRooms returns up to limit rooms whose history can be moved to the archive,
+// oldest first: rooms that ended before endedBefore, were scored and were not archived yet.
+// Rooms with complaints awaiting review are left in the database, as moderators may need
+// their history.
+func (s *Service) GetArchivableRooms(endedBefore time.Time, limit int) ([]models.ChatRoom, error) {
+	var rooms []models.ChatRoom
+	err := s.DB.Where("is_active = ? AND archived_at IS NULL AND quality_score IS NOT NULL AND ended_at < ?", false, endedBefore).
+		Where("NOT EXISTS (?)", s.DB.Model(&models.Complaint{}).Select("1").
+			Where("complaints.room_id::text = chat_rooms.room_id AND complaints.status = ?", models.ComplaintStatusNew)).
+		Order("ended_at asc").
+		Limit(limit).
+		Find(&rooms).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get archivable rooms: %v", err)
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// MarkRoomArchived records that the history of a room was archived at url, and deletes it
+// from the database, in one transaction.
+func (s *Service) MarkRoomArchived(roomID, url string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("room_id = ?", roomID).Delete(&models.ChatHistory{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ChatRoom{}).Where("room_id = ?", roomID).
+			Updates(map[string]any{"archived_at": time.Now(), "archive_url": url}).Error
+	})
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// DeletedUserID replaces the ID of a user whose data was deleted in the records kept for
+// other users, e.g. as the sender of messages in the history of their partners or as the
+// suspect of a complaint.
+const DeletedUserID = "deleted"
+
+// ErrUserBanned is returned by DeleteUserData for a user with an active ban, who must not
+// evade it by starting over with a new account.
+var ErrUserBanned = errors.New("user is banned")
+
+// userKeysKeyPrefix prefixes the sets indexing the Redis keys of a user that do not expire,
+// e.g. their attributes, so that DeleteUserData finds them without scanning the keyspace.
+const userKeysKeyPrefix = "user_keys:"
+
+// userExpiringKeysKeyPrefix prefixes the sets indexing the expiring Redis keys of a user,
+// e.g. rematch requests, link codes and pseudonyms. Each set expires with the longest-lived
+// key it indexes.
+const userExpiringKeysKeyPrefix = "user_expiring_keys:"
+
+// indexUserKey records in pipe that key holds data of a user and expires after ttl, or
+// never if ttl is 0, so that DeleteUserData deletes it.
+func (s *Service) indexUserKey(pipe redis.Pipeliner, userID, key string, ttl time.Duration) {
+	if ttl <= 0 {
+		pipe.SAdd(s.Ctx, userKeysKeyPrefix+userID, key)
+		return
+	}
+	index := userExpiringKeysKeyPrefix + userID
+	pipe.SAdd(s.Ctx, index, key)
+	pipe.ExpireNX(s.Ctx, index, ttl)
+	pipe.ExpireGT(s.Ctx, index, ttl)
+}
+
+// GetUserFiles returns the URLs of the files kept outside the database that hold data of a
+// user: the re-hosted media they sent and the archived transcripts of their rooms. They must
+// be deleted before DeleteUserData, which forgets them.
+func (s *Service) GetUserFiles(userID string) (mediaURLs, archiveURLs []string, err error) {
+	err = s.DB.Unscoped().Model(&models.ChatHistory{}).
+		Where("sender_id = ? AND media_url <> ''", userID).
+		Pluck("media_url", &mediaURLs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.DB.Model(&models.ChatRoom{}).
+		Where("(user1_id = ? OR user2_id = ?) AND archive_url <> ''", userID, userID).
+		Pluck("archive_url", &archiveURLs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return mediaURLs, archiveURLs, nil
+}
+
+// DeleteUserData erases a user on their request: their user row and bans are deleted, and
+// their ID is replaced with DeletedUserID in the rooms, chat history and complaints kept for
+// their partners and moderation. Their unpublished messages are dropped from the outbox, and
+// the URLs of their re-hosted media and of the archived transcripts of their rooms, whose
+// files the caller deleted (see GetUserFiles), are cleared. Their Redis keys, e.g. state,
+// attributes, presence, strikes, identity links and pseudonyms, are deleted and they are taken
+// out of the search queue, event announcements and command usage counts. The user must have
+// left their chat. It returns ErrUserBanned, and deletes nothing, while the user is banned.
+func (s *Service) DeleteUserData(userID string) error {
+	banned, err := s.IsUserBanned(userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrUserBanned
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		sent := tx.Unscoped().Model(&models.ChatHistory{}).Select("id").Where("sender_id = ?", userID)
+		if err := tx.Where("history_id IN (?)", sent).Delete(&models.OutboxMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.ChatHistory{}).
+			Where("sender_id = ? AND media_url <> ''", userID).
+			Update("media_url", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ChatRoom{}).
+			Where("(user1_id = ? OR user2_id = ?) AND archive_url <> ''", userID, userID).
+			Update("archive_url", "").Error; err != nil {
+			return err
+		}
+		updates := []struct {
+			model  any
+			column string
+		}{
+			{&models.ChatHistory{}, "sender_id"},
+			{&models.ChatRoom{}, "user1_id"},
+			{&models.ChatRoom{}, "user2_id"},
+			{&models.ChatRoom{}, "closed_by"},
+			{&models.Complaint{}, "reporter_id"},
+			{&models.Complaint{}, "suspect_id"},
+		}
+		for _, update := range updates {
+			if err := tx.Unscoped().Model(update.model).
+				Where(update.column+" = ?", userID).
+				Update(update.column, DeletedUserID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Ban{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteUserKeys(userID)
+}
+
+// deleteUserKeys deletes the Redis keys of a user, found by their fixed names and the user's
+// key indexes, and removes the user from the shared sets and the command usage counts of the
+// last commandUsageTTL, under their ID and their pseudonyms.
+func (s *Service) deleteUserKeys(userID string) error {
+	now := time.Now()
+	pipe := s.Redis.Pipeline()
+	persistent := pipe.SMembers(s.Ctx, userKeysKeyPrefix+userID)
+	expiring := pipe.SMembers(s.Ctx, userExpiringKeysKeyPrefix+userID)
+	var commands []*redis.StringSliceCmd
+	for age := time.Duration(0); age <= commandUsageTTL; age += time.Hour {
+		_, totals := commandUsageKeys("", now.Add(-age))
+		commands = append(commands, pipe.HKeys(s.Ctx, totals))
+	}
+	if _, err := pipe.Exec(s.Ctx); err != nil {
+		return err
+	}
+
+	keys := []string{
+		userCacheKeyPrefix + userID,
+		"user_state:" + userID,
+		presenceKeyPrefix + userID,
+		clientInstanceKeyPrefix + userID,
+		offlineKeyPrefix + userID,
+		matchLockKeyPrefix + userID,
+		identityLinkKeyPrefix + userID,
+		"media_strikes:" + userID,
+		"recent_partners:" + userID,
+		"ban:" + userID,
+		userKeysKeyPrefix + userID,
+		userExpiringKeysKeyPrefix + userID,
+	}
+	counted := []any{userID}
+	for _, key := range append(persistent.Val(), expiring.Val()...) {
+		keys = append(keys, key)
+		if pseudonym, ok := strings.CutPrefix(key, pseudonymKeyPrefix); ok {
+			counted = append(counted, pseudonym)
+		}
+	}
+
+	pipe = s.Redis.Pipeline()
+	for _, key := range keys {
+		pipe.Del(s.Ctx, key)
+	}
+	pipe.ZRem(s.Ctx, searchQueueKey, userID)
+	pipe.SRem(s.Ctx, eventSubscribersKey, userID)
+	for i, hourCommands := range commands {
+		hour := now.Add(-time.Duration(i) * time.Hour)
+		for _, command := range hourCommands.Val() {
+			perUser, _ := commandUsageKeys(command, hour)
+			pipe.ZRem(s.Ctx, perUser, counted...)
+		}
+	}
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
@@ -0,0 +1,999 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// MemoryStorage is an implementation of Storage that keeps everything in the memory of the
+// process, for tests and the demo mode, so that the hub, the matcher and the bot run without
+// PostgreSQL and Redis. It follows the semantics of Service: the tables are kept in maps and
+// the Redis data under the same keys, with their expiry, in a small keyspace. It is safe for
+// concurrent use, but not shared between processes, and everything is lost when the process
+// exits.
+//
+// It differs from Service where Service relies on the database: SearchHistory only
+// approximates the PostgreSQL full-text search, and IsUserBanned reads the bans instead of a
+// mirror, so SyncEndedBans has nothing to sync.
+type MemoryStorage struct {
+	mu sync.Mutex
+
+	users         map[string]*models.User
+	rooms         map[string]*models.ChatRoom
+	history       map[uint]*models.ChatHistory
+	complaints    map[uint]*models.Complaint
+	bans          map[uint]*models.Ban
+	outbox        map[uint]models.OutboxMessage
+	lastHistoryID uint
+	lastComplaint uint
+	lastBanID     uint
+
+	keys          map[string]*memoryEntry
+	subscriptions map[*memorySubscription]bool
+}
+
+// memoryEntry is the value of a key of the Redis data of a MemoryStorage: a string, a hash, a
+// set or a sorted set, depending on the commands used with the key.
+type memoryEntry struct {
+	value string
+	hash  map[string]string
+	set   map[string]bool
+	zset  map[string]float64
+	// expiresAt is when the key expires; zero if it does not.
+	expiresAt time.Time
+}
+
+// memoryMember is a member of a sorted set with its score.
+type memoryMember struct {
+	member string
+	score  float64
+}
+
+// NewMemoryStorage creates and returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:         make(map[string]*models.User),
+		rooms:         make(map[string]*models.ChatRoom),
+		history:       make(map[uint]*models.ChatHistory),
+		complaints:    make(map[uint]*models.Complaint),
+		bans:          make(map[uint]*models.Ban),
+		outbox:        make(map[uint]models.OutboxMessage),
+		keys:          make(map[string]*memoryEntry),
+		subscriptions: make(map[*memorySubscription]bool),
+	}
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// entry returns the entry of a key, or nil if the key does not exist or expired.
+func (m *MemoryStorage) entry(key string) *memoryEntry {
+	e, ok := m.keys[key]
+	if !ok {
+		return nil
+	}
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(m.keys, key)
+		return nil
+	}
+	return e
+}
+
+// entryOrNew returns the entry of a key, creating it if it does not exist.
+func (m *MemoryStorage) entryOrNew(key string) *memoryEntry {
+	e := m.entry(key)
+	if e == nil {
+		e = &memoryEntry{hash: make(map[string]string), set: make(map[string]bool), zset: make(map[string]float64)}
+		m.keys[key] = e
+	}
+	return e
+}
+
+// get returns the string value of a key, like GET.
+func (m *MemoryStorage) get(key string) (string, bool) {
+	e := m.entry(key)
+	if e == nil {
+		return "", false
+	}
+	return e.value, true
+}
+
+// set sets the string value of a key, expiring after ttl unless it is 0, like SET.
+func (m *MemoryStorage) set(key, value string, ttl time.Duration) {
+	e := &memoryEntry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	m.keys[key] = e
+}
+
+// setNX sets the string value of a key like set, unless the key exists, and reports whether
+// it did, like SET NX.
+func (m *MemoryStorage) setNX(key, value string, ttl time.Duration) bool {
+	if m.entry(key) != nil {
+		return false
+	}
+	m.set(key, value, ttl)
+	return true
+}
+
+// expire lets a key expire after ttl, like EXPIRE: a ttl of 0 or less deletes it.
+func (m *MemoryStorage) expire(key string, ttl time.Duration) {
+	e := m.entry(key)
+	if e == nil {
+		return
+	}
+	if ttl <= 0 {
+		delete(m.keys, key)
+		return
+	}
+	e.expiresAt = time.Now().Add(ttl)
+}
+
+// scan returns the existing keys matching a pattern, like SCAN.
+func (m *MemoryStorage) scan(pattern string) []string {
+	var keys []string
+	for key := range m.keys {
+		if ok, _ := path.Match(pattern, key); ok && m.entry(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// zrange returns the members of a sorted set ordered by score, and members of the same score
+// by name, like ZRANGE.
+func (m *MemoryStorage) zrange(key string) []memoryMember {
+	e := m.entry(key)
+	if e == nil {
+		return nil
+	}
+	members := make([]memoryMember, 0, len(e.zset))
+	for member, score := range e.zset {
+		members = append(members, memoryMember{member: member, score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+// zremScoredBefore removes up to limit members of a sorted set scored at or before max and
+// returns them, like removeScoredBeforeScript.
+func (m *MemoryStorage) zremScoredBefore(key string, max float64, limit int) []string {
+	removed := []string{}
+	for _, member := range m.zrange(key) {
+		if member.score > max || (limit >= 0 && len(removed) >= limit) {
+			break
+		}
+		delete(m.keys[key].zset, member.member)
+		removed = append(removed, member.member)
+	}
+	return removed
+}
+
+// page returns the items left after skipping offset of them, at most limit of them unless
+// limit is negative, like OFFSET and LIMIT.
+func page[T any](items []T, offset, limit int) []T {
+	if offset > 0 {
+		if offset >= len(items) {
+			return items[:0]
+		}
+		items = items[offset:]
+	}
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// clonePtr returns a copy of the value p points to, so that callers cannot change the stored
+// records through the pointers of the copies they get.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// cloneUser returns a copy of a user that shares nothing with it.
+func cloneUser(user *models.User) *models.User {
+	c := *user
+	c.Interests = append(pq.StringArray(nil), user.Interests...)
+	c.BlockedUsers = append(pq.StringArray(nil), user.BlockedUsers...)
+	c.LabFeatures = append(pq.StringArray(nil), user.LabFeatures...)
+	c.BotBlockedAt = clonePtr(user.BotBlockedAt)
+	c.PremiumUntil = clonePtr(user.PremiumUntil)
+	c.AutoRequeue = clonePtr(user.AutoRequeue)
+	return &c
+}
+
+// createUser stores a new user and sets its generated fields. As with GORM, the fields of
+// columns with a default take it when they are zero.
+func (m *MemoryStorage) createUser(user *models.User) {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	if user.Language == "" {
+		user.Language = "en"
+	}
+	if !user.DefaultMediaSpoiler {
+		user.DefaultMediaSpoiler = true
+	}
+	m.users[user.ID] = cloneUser(user)
+}
+
+// updateUser applies an update to a stored user, if the user exists.
+func (m *MemoryStorage) updateUser(userID string, update func(user *models.User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user, ok := m.users[userID]; ok {
+		update(user)
+	}
+	return nil
+}
+
+// SaveUser saves a user, creating it if it does not exist.
+func (m *MemoryStorage) SaveUser(user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[user.ID]
+	if !ok {
+		m.createUser(user)
+		return nil
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = stored.CreatedAt
+	}
+	m.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+// SaveUserIfNotExists finds a user by their Telegram ID or creates a new one if not found.
+func (m *MemoryStorage) SaveUserIfNotExists(telegramID int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user := m.userByTelegramID(telegramID); user != nil {
+		return cloneUser(user), nil
+	}
+	user := &models.User{TelegramID: telegramID}
+	m.createUser(user)
+	return user, nil
+}
+
+// userByTelegramID returns the stored user with a Telegram ID, or nil.
+func (m *MemoryStorage) userByTelegramID(telegramID int64) *models.User {
+	for _, user := range m.users {
+		if user.TelegramID == telegramID {
+			return user
+		}
+	}
+	return nil
+}
+
+// GetUserByTelegramID retrieves a user by their Telegram ID.
+func (m *MemoryStorage) GetUserByTelegramID(telegramID int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user := m.userByTelegramID(telegramID)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return cloneUser(user), nil
+}
+
+// GetUserByID retrieves a user by their internal ID.
+func (m *MemoryStorage) GetUserByID(userID string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return cloneUser(user), nil
+}
+
+// GetUsersByIDs retrieves the users with the given internal IDs. Users that do not exist are
+// left out.
+func (m *MemoryStorage) GetUsersByIDs(userIDs []string) ([]models.User, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []models.User{}
+	seen := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if user, ok := m.users[userID]; ok && !seen[userID] {
+			seen[userID] = true
+			users = append(users, *cloneUser(user))
+		}
+	}
+	return users, nil
+}
+
+// UpdateUserMediaSpoiler updates the user's preference for default media spoiler flag.
+func (m *MemoryStorage) UpdateUserMediaSpoiler(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.DefaultMediaSpoiler = value })
+}
+
+// UpdateUserAge updates the user's age.
+func (m *MemoryStorage) UpdateUserAge(userID string, age int) error {
+	return m.updateUser(userID, func(user *models.User) { user.Age = age })
+}
+
+// UpdateUserGender updates the user's gender.
+func (m *MemoryStorage) UpdateUserGender(userID string, gender string) error {
+	return m.updateUser(userID, func(user *models.User) { user.Gender = gender })
+}
+
+// UpdateUserInterests updates the user's interests.
+func (m *MemoryStorage) UpdateUserInterests(userID string, interests []string) error {
+	return m.updateUser(userID, func(user *models.User) { user.Interests = append(pq.StringArray(nil), interests...) })
+}
+
+// SetUserBotBlocked marks a user as inactive because they blocked the bot, or clears the mark.
+func (m *MemoryStorage) SetUserBotBlocked(userID string, blocked bool) error {
+	var blockedAt *time.Time
+	if blocked {
+		now := time.Now()
+		blockedAt = &now
+	}
+	return m.updateUser(userID, func(user *models.User) { user.BotBlockedAt = blockedAt })
+}
+
+// UpdateUserSearchPreferences updates the user's preferred partner gender and age range.
+func (m *MemoryStorage) UpdateUserSearchPreferences(userID string, gender string, ageMin, ageMax int) error {
+	return m.updateUser(userID, func(user *models.User) {
+		user.PreferredGender, user.PreferredAgeMin, user.PreferredAgeMax = gender, ageMin, ageMax
+	})
+}
+
+// UpdateUserAutoRequeue updates the user's preference for searching again after /next.
+func (m *MemoryStorage) UpdateUserAutoRequeue(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.AutoRequeue = &value })
+}
+
+// UpdateUserRegion updates the user's coarse region. An empty region clears it.
+func (m *MemoryStorage) UpdateUserRegion(userID string, region string) error {
+	return m.updateUser(userID, func(user *models.User) { user.Region = region })
+}
+
+// UpdateUserNearTimezone updates the user's preference for partners near their timezone.
+func (m *MemoryStorage) UpdateUserNearTimezone(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.PreferNearTimezone = value })
+}
+
+// UpdateUserReadReceipts updates the user's opt-in to read receipts.
+func (m *MemoryStorage) UpdateUserReadReceipts(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.ReadReceipts = value })
+}
+
+// UpdateUserHideTyping updates whether the user's typing indicators are hidden from partners.
+func (m *MemoryStorage) UpdateUserHideTyping(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.HideTyping = value })
+}
+
+// UpdateUserHidePresence updates whether the user's online status is hidden from partners.
+func (m *MemoryStorage) UpdateUserHidePresence(userID string, value bool) error {
+	return m.updateUser(userID, func(user *models.User) { user.HidePresence = value })
+}
+
+// UpdateUserLanguage updates the language preference of the users with a Telegram ID.
+func (m *MemoryStorage) UpdateUserLanguage(telegramID int64, languageCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.TelegramID == telegramID {
+			user.Language = languageCode
+		}
+	}
+	return nil
+}
+
+// SetUserPremium sets the end of the user's premium entitlement. A nil until revokes it.
+func (m *MemoryStorage) SetUserPremium(userID string, until *time.Time) error {
+	return m.updateUser(userID, func(user *models.User) { user.PremiumUntil = clonePtr(until) })
+}
+
+// BlockUser adds blockedID to the user's block list. Blocking a user twice has no effect.
+func (m *MemoryStorage) BlockUser(userID, blockedID string) error {
+	return m.updateUser(userID, func(user *models.User) { user.BlockedUsers = addString(user.BlockedUsers, blockedID) })
+}
+
+// UnblockUser removes blockedID from the user's block list.
+func (m *MemoryStorage) UnblockUser(userID, blockedID string) error {
+	return m.updateUser(userID, func(user *models.User) { user.BlockedUsers = removeString(user.BlockedUsers, blockedID) })
+}
+
+// SetUserLabFeature opts the user into an experimental feature, or out of it.
+func (m *MemoryStorage) SetUserLabFeature(userID, feature string, enabled bool) error {
+	return m.updateUser(userID, func(user *models.User) {
+		if enabled {
+			user.LabFeatures = addString(user.LabFeatures, feature)
+		} else {
+			user.LabFeatures = removeString(user.LabFeatures, feature)
+		}
+	})
+}
+
+// addString appends a value to an array unless it holds it already.
+func addString(values pq.StringArray, value string) pq.StringArray {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// removeString removes every occurrence of a value from an array, like array_remove.
+func removeString(values pq.StringArray, value string) pq.StringArray {
+	if values == nil {
+		return nil
+	}
+	kept := pq.StringArray{}
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// reachableUsers returns copies of the Telegram users who did not block the bot and match a
+// condition.
+func (m *MemoryStorage) reachableUsers(match func(user *models.User) bool) []models.User {
+	users := []models.User{}
+	for _, user := range m.users {
+		if user.TelegramID != 0 && user.BotBlockedAt == nil && match(user) {
+			users = append(users, *cloneUser(user))
+		}
+	}
+	return users
+}
+
+// GetIncompleteProfiles returns a page of reachable Telegram users whose age, gender or
+// interests are not filled in, ordered by creation time.
+func (m *MemoryStorage) GetIncompleteProfiles(offset, limit int) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := m.reachableUsers(func(user *models.User) bool {
+		return user.Age == 0 || user.Gender == "" || len(user.Interests) == 0
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return page(users, offset, limit), nil
+}
+
+// GetBroadcastRecipients returns a page of reachable Telegram users, ordered by ID, whose ID
+// is greater than afterID.
+func (m *MemoryStorage) GetBroadcastRecipients(afterID string, limit int) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := m.reachableUsers(func(user *models.User) bool { return user.ID > afterID })
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return page(users, 0, limit), nil
+}
+
+// AdjustUserRating adds delta (which may be negative) to the user's rating score.
+func (m *MemoryStorage) AdjustUserRating(userID string, delta int) error {
+	return m.updateUser(userID, func(user *models.User) { user.RatingScore += delta })
+}
+
+// RecoverUserRatings raises the negative ratings of the users who were not reported since
+// quietSince by step, up to 0, and returns the number of users whose rating was raised.
+func (m *MemoryStorage) RecoverUserRatings(step int, quietSince time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reported := make(map[string]bool)
+	for _, complaint := range m.complaints {
+		if !complaint.CreatedAt.Before(quietSince) {
+			reported[complaint.SuspectID] = true
+		}
+	}
+	var recovered int64
+	for _, user := range m.users {
+		if user.RatingScore < 0 && !reported[user.ID] {
+			user.RatingScore = min(user.RatingScore+step, 0)
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+// SetUserState sets the user's current state.
+func (m *MemoryStorage) SetUserState(userID string, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set("user_state:"+userID, state, 0)
+	return nil
+}
+
+// GetUserState retrieves the user's current state, or "" if none is set.
+func (m *MemoryStorage) GetUserState(userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, _ := m.get("user_state:" + userID)
+	return state, nil
+}
+
+// ClearUserState removes the user's state.
+func (m *MemoryStorage) ClearUserState(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, "user_state:"+userID)
+	return nil
+}
+
+// SetUserAttribute sets a generic attribute for a user.
+func (m *MemoryStorage) SetUserAttribute(userID string, key string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set("user_attr:"+userID+":"+key, value, 0)
+	return nil
+}
+
+// GetUserAttribute retrieves a generic attribute for a user, or "" if it is not set.
+func (m *MemoryStorage) GetUserAttribute(userID string, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, _ := m.get("user_attr:" + userID + ":" + key)
+	return value, nil
+}
+
+// DeleteUserAttribute removes a generic attribute for a user.
+func (m *MemoryStorage) DeleteUserAttribute(userID string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, "user_attr:"+userID+":"+key)
+	return nil
+}
+
+// RefreshPresence marks users as online for ttl.
+func (m *MemoryStorage) RefreshPresence(userIDs []string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, userID := range userIDs {
+		m.set(presenceKeyPrefix+userID, "1", ttl)
+	}
+	return nil
+}
+
+// IsUserOnline reports whether a user was marked online and the mark has not expired yet.
+func (m *MemoryStorage) IsUserOnline(userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entry(presenceKeyPrefix+userID) != nil, nil
+}
+
+// CreateLinkCode creates a one-time code that links the web identity userID to whoever
+// redeems it with TakeLinkCode before ttl passes.
+func (m *MemoryStorage) CreateLinkCode(userID string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		code, err := randomLinkCode()
+		if err != nil {
+			return "", err
+		}
+		if m.setNX(linkCodeKeyPrefix+code, userID, ttl) {
+			return code, nil
+		}
+	}
+}
+
+// TakeLinkCode redeems a code created with CreateLinkCode and returns the web identity it
+// links, or "" if the code does not exist or expired.
+func (m *MemoryStorage) TakeLinkCode(code string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webID, _ := m.get(linkCodeKeyPrefix + code)
+	delete(m.keys, linkCodeKeyPrefix+code)
+	return webID, nil
+}
+
+// LinkIdentity records that the web identity webID acts as userID until ttl passes.
+func (m *MemoryStorage) LinkIdentity(webID, userID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(identityLinkKeyPrefix+webID, userID, ttl)
+	return nil
+}
+
+// GetLinkedIdentity returns the user the web identity webID was linked to, or "".
+func (m *MemoryStorage) GetLinkedIdentity(webID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID, _ := m.get(identityLinkKeyPrefix + webID)
+	return userID, nil
+}
+
+// SavePseudonyms remembers the user IDs of pseudonyms handed out in an export for ttl.
+func (m *MemoryStorage) SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for pseudonym, userID := range pseudonyms {
+		m.set(pseudonymKeyPrefix+pseudonym, userID, ttl)
+	}
+	return nil
+}
+
+// ResolvePseudonym returns the user ID of a pseudonym saved with SavePseudonyms, or "".
+func (m *MemoryStorage) ResolvePseudonym(pseudonym string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID, _ := m.get(pseudonymKeyPrefix + pseudonym)
+	return userID, nil
+}
+
+// SetEventSubscription opts a user in to or out of themed event announcements.
+func (m *MemoryStorage) SetEventSubscription(userID string, subscribed bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if subscribed {
+		m.entryOrNew(eventSubscribersKey).set[userID] = true
+	} else if e := m.entry(eventSubscribersKey); e != nil {
+		delete(e.set, userID)
+	}
+	return nil
+}
+
+// IsEventSubscriber checks whether a user opted in to themed event announcements.
+func (m *MemoryStorage) IsEventSubscriber(userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(eventSubscribersKey)
+	return e != nil && e.set[userID], nil
+}
+
+// GetEventSubscribers returns the IDs of all users who opted in to themed event announcements.
+func (m *MemoryStorage) GetEventSubscribers() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscribers := []string{}
+	if e := m.entry(eventSubscribersKey); e != nil {
+		for userID := range e.set {
+			subscribers = append(subscribers, userID)
+		}
+	}
+	return subscribers, nil
+}
+
+// userKeyPatterns are the patterns of the keys of a user that MemoryStorage.DeleteUserData
+// finds by scanning its small keyspace, with %s standing for the user ID.
+var userKeyPatterns = []string{"user_attr:%s:*", "rematch:%s:*", "rematch:*:%s"}
+
+// userValuePrefixes prefix the keys that hold the ID of the user they belong to.
+var userValuePrefixes = []string{linkCodeKeyPrefix, identityLinkKeyPrefix, pseudonymKeyPrefix}
+
+// GetUserFiles returns the URLs of the re-hosted media a user sent and of the archived
+// transcripts of their rooms.
+func (m *MemoryStorage) GetUserFiles(userID string) (mediaURLs, archiveURLs []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, history := range m.history {
+		if history.SenderID == userID && history.MediaURL != "" {
+			mediaURLs = append(mediaURLs, history.MediaURL)
+		}
+	}
+	for _, room := range m.rooms {
+		if (room.User1ID == userID || room.User2ID == userID) && room.ArchiveURL != "" {
+			archiveURLs = append(archiveURLs, room.ArchiveURL)
+		}
+	}
+	return mediaURLs, archiveURLs, nil
+}
+
+// DeleteUserData erases a user like Service.DeleteUserData. It returns ErrUserBanned, and
+// deletes nothing, while the user is banned.
+func (m *MemoryStorage) DeleteUserData(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isBanned(userID, time.Now()) {
+		return ErrUserBanned
+	}
+
+	for _, history := range m.history {
+		if history.SenderID == userID {
+			delete(m.outbox, history.ID)
+			history.SenderID = DeletedUserID
+			history.MediaURL = ""
+		}
+	}
+	for _, room := range m.rooms {
+		if room.User1ID == userID || room.User2ID == userID {
+			room.ArchiveURL = ""
+		}
+		for _, field := range []*string{&room.User1ID, &room.User2ID, &room.ClosedBy} {
+			if *field == userID {
+				*field = DeletedUserID
+			}
+		}
+	}
+	for _, complaint := range m.complaints {
+		for _, field := range []*string{&complaint.ReporterID, &complaint.SuspectID} {
+			if *field == userID {
+				*field = DeletedUserID
+			}
+		}
+	}
+	for id, ban := range m.bans {
+		if ban.UserID == userID {
+			delete(m.bans, id)
+		}
+	}
+	delete(m.users, userID)
+
+	keys := []string{
+		"user_state:" + userID,
+		presenceKeyPrefix + userID,
+		clientInstanceKeyPrefix + userID,
+		offlineKeyPrefix + userID,
+		matchLockKeyPrefix + userID,
+		identityLinkKeyPrefix + userID,
+		"media_strikes:" + userID,
+		"recent_partners:" + userID,
+	}
+	for _, pattern := range userKeyPatterns {
+		keys = append(keys, m.scan(fmt.Sprintf(pattern, userID))...)
+	}
+	counted := []string{userID}
+	for _, prefix := range userValuePrefixes {
+		for _, key := range m.scan(prefix + "*") {
+			if value, _ := m.get(key); value == userID {
+				keys = append(keys, key)
+				if pseudonym, ok := strings.CutPrefix(key, pseudonymKeyPrefix); ok {
+					counted = append(counted, pseudonym)
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		delete(m.keys, key)
+	}
+	for _, key := range append(m.scan("command_usage:*"), searchQueueKey) {
+		if e := m.entry(key); e != nil {
+			for _, id := range counted {
+				delete(e.zset, id)
+			}
+		}
+	}
+	if e := m.entry(eventSubscribersKey); e != nil {
+		delete(e.set, userID)
+	}
+	return nil
+}
+
+// AddUserToSearchQueue adds a user to the matchmaking queue. A user who is already queued
+// keeps their original place. A search request saved for the user before is dropped.
+func (m *MemoryStorage) AddUserToSearchQueue(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueue(userID)
+	delete(m.keys, searchRequestKeyPrefix+userID)
+	return nil
+}
+
+// SaveSearchRequest adds a user to the matchmaking queue like AddUserToSearchQueue, and keeps
+// their search request for whoever restores the queue.
+func (m *MemoryStorage) SaveSearchRequest(req models.SearchRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueue(req.UserID)
+	m.set(searchRequestKeyPrefix+req.UserID, string(data), searchRequestTTL)
+	return nil
+}
+
+// GetSearchRequest returns the search request saved for a queued user, or nil if there is none.
+func (m *MemoryStorage) GetSearchRequest(userID string) (*models.SearchRequest, error) {
+	m.mu.Lock()
+	data, ok := m.get(searchRequestKeyPrefix + userID)
+	m.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var req models.SearchRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// enqueue adds a user to the matchmaking queue unless they are queued already.
+func (m *MemoryStorage) enqueue(userID string) {
+	queue := m.entryOrNew(searchQueueKey).zset
+	if _, ok := queue[userID]; !ok {
+		queue[userID] = float64(time.Now().UnixNano())
+	}
+}
+
+// RemoveUserFromSearchQueue removes a user, and their saved search request, from the
+// matchmaking queue.
+func (m *MemoryStorage) RemoveUserFromSearchQueue(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e := m.entry(searchQueueKey); e != nil {
+		delete(e.zset, userID)
+	}
+	delete(m.keys, searchRequestKeyPrefix+userID)
+	return nil
+}
+
+// GetSearchingUsers returns the IDs of the users in the matchmaking queue, ordered by the
+// time they joined it.
+func (m *MemoryStorage) GetSearchingUsers() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []string{}
+	for _, member := range m.zrange(searchQueueKey) {
+		users = append(users, member.member)
+	}
+	return users, nil
+}
+
+// IsUserSearching checks whether a user is currently in the matchmaking queue.
+func (m *MemoryStorage) IsUserSearching(userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(searchQueueKey)
+	if e == nil {
+		return false, nil
+	}
+	_, ok := e.zset[userID]
+	return ok, nil
+}
+
+// ClaimMatch takes two users out of the matchmaking queue, but only if both are still in it.
+func (m *MemoryStorage) ClaimMatch(user1ID, user2ID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(searchQueueKey)
+	if e == nil {
+		return false, nil
+	}
+	_, ok1 := e.zset[user1ID]
+	_, ok2 := e.zset[user2ID]
+	if !ok1 || !ok2 {
+		return false, nil
+	}
+	delete(e.zset, user1ID)
+	delete(e.zset, user2ID)
+	return true, nil
+}
+
+// LockMatch locks users while a room is opened for them, with a token identifying the
+// holder. It returns false, locking none of them, if one is locked already.
+func (m *MemoryStorage) LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := matchLockKeys(userIDs)
+	for _, key := range keys {
+		if m.entry(key) != nil {
+			return false, nil
+		}
+	}
+	for _, key := range keys {
+		m.set(key, token, ttl)
+	}
+	return true, nil
+}
+
+// UnlockMatch releases the locks of users taken with LockMatch, unless they expired and were
+// taken by another holder meanwhile.
+func (m *MemoryStorage) UnlockMatch(token string, userIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range matchLockKeys(userIDs) {
+		m.deleteIfEqual(key, token)
+	}
+	return nil
+}
+
+// deleteIfEqual deletes a key if it holds value, like deleteIfEqualScript.
+func (m *MemoryStorage) deleteIfEqual(key, value string) {
+	if current, ok := m.get(key); ok && current == value {
+		delete(m.keys, key)
+	}
+}
+
+// RemoveStaleSearchEntries removes up to limit users who joined the matchmaking queue before
+// the given time, and returns their IDs.
+func (m *MemoryStorage) RemoveStaleSearchEntries(enqueuedBefore time.Time, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zremScoredBefore(searchQueueKey, float64(enqueuedBefore.UnixNano()), limit), nil
+}
+
+// GetSearchQueueStatus returns the 1-based position of a user in the matchmaking queue and the
+// number of searching users. The position is 0 if the user is not searching.
+func (m *MemoryStorage) GetSearchQueueStatus(userID string) (position, total int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queue := m.zrange(searchQueueKey)
+	for i, member := range queue {
+		if member.member == userID {
+			position = i + 1
+		}
+	}
+	return position, len(queue), nil
+}
+
+// RegisterClientInstance records that an instance holds the clients of users, for ttl.
+func (m *MemoryStorage) RegisterClientInstance(instanceID string, userIDs []string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, userID := range userIDs {
+		m.set(clientInstanceKeyPrefix+userID, instanceID, ttl)
+	}
+	return nil
+}
+
+// UnregisterClientInstance removes the registry entry of a user, unless another instance
+// registered the user's client since.
+func (m *MemoryStorage) UnregisterClientInstance(instanceID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteIfEqual(clientInstanceKeyPrefix+userID, instanceID)
+	return nil
+}
+
+// GetClientInstance returns the ID of the instance holding the client of a user, or "".
+func (m *MemoryStorage) GetClientInstance(userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	instanceID, _ := m.get(clientInstanceKeyPrefix + userID)
+	return instanceID, nil
+}
+
+// AcquireMatcherLeadership takes or renews the matcher leader lease for the given instance.
+func (m *MemoryStorage) AcquireMatcherLeadership(instanceID string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if leader, ok := m.get(matcherLeaderKey); ok && leader == instanceID {
+		m.expire(matcherLeaderKey, ttl)
+		return true, nil
+	}
+	return m.setNX(matcherLeaderKey, instanceID, ttl), nil
+}
+
+// ClaimJobRun claims a run of a scheduled job for the caller, unless another caller claimed
+// one within ttl, and reports whether it did.
+func (m *MemoryStorage) ClaimJobRun(job string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setNX(jobRunKeyPrefix+job, strconv.FormatInt(time.Now().Unix(), 10), ttl), nil
+}
+
+// MarkEventAnnounced records that an event has been announced. It returns true only for
+// the first call per event.
+func (m *MemoryStorage) MarkEventAnnounced(eventID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	announced := m.entryOrNew("events_announced").set
+	if announced[eventID] {
+		return false, nil
+	}
+	announced[eventID] = true
+	return true, nil
+}
@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// cloneHistory returns a copy of a history entry that shares nothing with it.
+func cloneHistory(history *models.ChatHistory) models.ChatHistory {
+	c := *history
+	c.ReplyToMessageID = clonePtr(history.ReplyToMessageID)
+	c.TgMessageIDSender = clonePtr(history.TgMessageIDSender)
+	c.TgMessageIDReceiver = clonePtr(history.TgMessageIDReceiver)
+	return c
+}
+
+// historyWhere returns copies of the history entries that match a condition, in ID order.
+func (m *MemoryStorage) historyWhere(match func(history *models.ChatHistory) bool) []models.ChatHistory {
+	entries := []models.ChatHistory{}
+	for _, history := range m.history {
+		if match(history) {
+			entries = append(entries, cloneHistory(history))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// newHistory returns the history entry of a message with the given ID, saved at the given time.
+func newHistory(msg *models.ChatMessage, id uint, at time.Time) *models.ChatHistory {
+	history := historyOf(msg)
+	history.Model = gorm.Model{ID: id, CreatedAt: at, UpdatedAt: at}
+	c := cloneHistory(&history)
+	return &c
+}
+
+// SaveMessage saves a ChatMessage as a ChatHistory entry, and adds it to the outbox until it
+// is published with PublishSavedMessage or RelayOutbox. It sets the ID of the message and
+// records it as the last activity of its room.
+func (m *MemoryStorage) SaveMessage(msg *models.ChatMessage) error {
+	return m.SaveMessages([]*models.ChatMessage{msg})
+}
+
+// SaveMessages saves several ChatMessages like SaveMessage: either all of them are saved, or
+// none is. It sets the IDs of the messages in order.
+func (m *MemoryStorage) SaveMessages(msgs []*models.ChatMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payloads := make([]string, len(msgs))
+	for i, msg := range msgs {
+		saved := *msg
+		saved.ID = m.lastHistoryID + uint(i) + 1
+		payload, err := json.Marshal(saved)
+		if err != nil {
+			log.Printf("ERROR: Failed to save a batch of %d messages: %v", len(msgs), err)
+			return err
+		}
+		payloads[i] = string(payload)
+	}
+
+	now := time.Now()
+	for i, msg := range msgs {
+		m.lastHistoryID++
+		msg.ID = m.lastHistoryID
+		m.history[msg.ID] = newHistory(msg, msg.ID, now)
+		m.outbox[msg.ID] = models.OutboxMessage{HistoryID: msg.ID, RoomID: msg.RoomID, Payload: payloads[i], CreatedAt: now}
+		m.touchRoom(msg.RoomID, now)
+	}
+	return nil
+}
+
+// GetChatHistory retrieves the message history for a given room, ordered by creation time.
+func (m *MemoryStorage) GetChatHistory(roomID string) ([]models.ChatHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.historyWhere(func(history *models.ChatHistory) bool { return history.RoomID == roomID }), nil
+}
+
+// GetMessageCountsBySender returns the number of messages each participant sent in a room,
+// keyed by sender ID.
+func (m *MemoryStorage) GetMessageCountsBySender(roomID string) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int64)
+	for _, history := range m.history {
+		if history.RoomID == roomID {
+			counts[history.SenderID]++
+		}
+	}
+	return counts, nil
+}
+
+// SaveTgMessageID records the Telegram message ID of the sender's or the receiver's copy of a
+// message.
+func (m *MemoryStorage) SaveTgMessageID(historyID uint, anonID string, tgMsgID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history, ok := m.history[historyID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	tgID := uint(tgMsgID)
+	if history.SenderID == anonID {
+		history.TgMessageIDSender = &tgID
+	} else {
+		history.TgMessageIDReceiver = &tgID
+	}
+	history.UpdatedAt = time.Now()
+	return nil
+}
+
+// sentAsTelegramMessage reports whether one of the copies of a history entry is a Telegram
+// message.
+func sentAsTelegramMessage(history *models.ChatHistory, tgMsgID uint) bool {
+	return (history.TgMessageIDSender != nil && *history.TgMessageIDSender == tgMsgID) ||
+		(history.TgMessageIDReceiver != nil && *history.TgMessageIDReceiver == tgMsgID)
+}
+
+// FindOriginalHistoryIDByTgID finds the ID of the last history entry one of whose copies is a
+// Telegram message, or nil if there is none.
+func (m *MemoryStorage) FindOriginalHistoryIDByTgID(tgMsgID uint) (*uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.historyWhere(func(history *models.ChatHistory) bool { return sentAsTelegramMessage(history, tgMsgID) })
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[len(entries)-1].ID, nil
+}
+
+// FindOriginalHistoryIDByTgIDMedia finds the original of an edited media message, like
+// Service.FindOriginalHistoryIDByTgIDMedia: of the earliest entries of each content sent as
+// the Telegram message, the latest one.
+func (m *MemoryStorage) FindOriginalHistoryIDByTgIDMedia(tgMsgID uint) (*uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	earliest := make(map[string]models.ChatHistory)
+	for _, history := range m.historyWhere(func(history *models.ChatHistory) bool { return sentAsTelegramMessage(history, tgMsgID) }) {
+		if first, ok := earliest[history.Content]; !ok || history.CreatedAt.Before(first.CreatedAt) {
+			earliest[history.Content] = history
+		}
+	}
+	var original *models.ChatHistory
+	for _, history := range earliest {
+		if original == nil || history.CreatedAt.After(original.CreatedAt) {
+			original = &history
+		}
+	}
+	if original == nil {
+		return nil, nil
+	}
+	return &original.ID, nil
+}
+
+// FindPartnerTelegramIDForReply determines the Telegram message ID to reply to: of the copy of
+// the original message the current recipient has.
+func (m *MemoryStorage) FindPartnerTelegramIDForReply(originalHistoryID uint, currentRecipientAnonID string) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history, ok := m.history[originalHistoryID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	tgMsgID := history.TgMessageIDReceiver
+	if history.SenderID == currentRecipientAnonID {
+		tgMsgID = history.TgMessageIDSender
+	}
+	if tgMsgID == nil {
+		return nil, nil
+	}
+	tgID := int(*tgMsgID)
+	return &tgID, nil
+}
+
+// FindHistoryByID retrieves a history entry by its ID, or nil if it does not exist.
+func (m *MemoryStorage) FindHistoryByID(id uint) (*models.ChatHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history, ok := m.history[id]
+	if !ok {
+		return nil, nil
+	}
+	c := cloneHistory(history)
+	return &c, nil
+}
+
+// GetUnhostedMedia returns up to limit media history entries with an ID above afterID,
+// sent since the given time, that have not been re-hosted yet, in ID order.
+func (m *MemoryStorage) GetUnhostedMedia(afterID uint, since time.Time, limit int) ([]models.ChatHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.historyWhere(func(history *models.ChatHistory) bool {
+		return history.ID > afterID && !history.CreatedAt.Before(since) &&
+			slices.Contains(mediaTypes, history.Type) && history.MediaURL == ""
+	})
+	return page(entries, 0, limit), nil
+}
+
+// SetHistoryMediaURL records the URL of the re-hosted copy of the media of a history entry.
+func (m *MemoryStorage) SetHistoryMediaURL(historyID uint, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if history, ok := m.history[historyID]; ok {
+		history.MediaURL = url
+		history.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// DeleteHistoryBefore deletes up to limit history entries sent before the given time, oldest
+// first, and returns the number of entries deleted.
+func (m *MemoryStorage) DeleteHistoryBefore(before time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.historyWhere(func(history *models.ChatHistory) bool { return history.CreatedAt.Before(before) })
+	entries = page(entries, 0, limit)
+	for _, history := range entries {
+		delete(m.history, history.ID)
+	}
+	return int64(len(entries)), nil
+}
+
+// SearchHistory returns the history entries whose text matches the keywords of a search,
+// within its scopes, newest first. The keywords are matched as whole words, ignoring case,
+// with the syntax of models.HistorySearch.Query.
+func (m *MemoryStorage) SearchHistory(search models.HistorySearch) ([]models.ChatHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query := parseHistoryQuery(search.Query)
+	entries := m.historyWhere(func(history *models.ChatHistory) bool {
+		document := history.Metadata
+		if history.Type == "text" {
+			document = history.Content
+		}
+		return (search.RoomID == "" || history.RoomID == search.RoomID) &&
+			(search.SenderID == "" || history.SenderID == search.SenderID) &&
+			(search.From.IsZero() || !history.CreatedAt.Before(search.From)) &&
+			(search.To.IsZero() || history.CreatedAt.Before(search.To)) &&
+			query.matches(searchWords(document))
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return page(entries, 0, search.Limit), nil
+}
+
+// historyQuery are the keywords of a history search: every group must match, which one of
+// its terms does.
+type historyQuery [][]historyTerm
+
+// historyTerm is a word or a phrase that must occur in a document, or must not if negated.
+type historyTerm struct {
+	words   []string
+	negated bool
+}
+
+// parseHistoryQuery parses keywords in web search syntax, like websearch_to_tsquery.
+func parseHistoryQuery(keywords string) historyQuery {
+	var query historyQuery
+	or := false
+	for rest := strings.TrimSpace(keywords); rest != ""; rest = strings.TrimSpace(rest) {
+		term := historyTerm{}
+		if rest[0] == '-' {
+			term.negated = true
+			rest = rest[1:]
+		}
+		var raw string
+		if rest != "" && rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				raw, rest = rest[1:], ""
+			} else {
+				raw, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+			if strings.EqualFold(raw, "or") && !term.negated && len(query) > 0 {
+				or = true
+				continue
+			}
+		}
+		if term.words = searchWords(raw); len(term.words) == 0 {
+			continue
+		}
+		if or {
+			query[len(query)-1] = append(query[len(query)-1], term)
+			or = false
+		} else {
+			query = append(query, []historyTerm{term})
+		}
+	}
+	return query
+}
+
+// matches reports whether the words of a document match the query. An empty query matches
+// nothing.
+func (q historyQuery) matches(document []string) bool {
+	if len(q) == 0 {
+		return false
+	}
+	for _, group := range q {
+		if !slices.ContainsFunc(group, func(term historyTerm) bool {
+			return containsPhrase(document, term.words) != term.negated
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase reports whether words occur in a document in that order, next to each other.
+func containsPhrase(document, words []string) bool {
+	for i := 0; i+len(words) <= len(document); i++ {
+		if slices.Equal(document[i:i+len(words)], words) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchWords splits a text into its lowercase words, like the "simple" text search
+// configuration.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// PublishSavedMessage publishes a message saved by SaveMessage, like PublishMessage, and
+// removes it from the outbox.
+func (m *MemoryStorage) PublishSavedMessage(msg models.ChatMessage) error {
+	if err := m.PublishMessage(msg.RoomID, msg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.outbox, msg.ID)
+	return nil
+}
+
+// RelayOutbox publishes up to limit messages that were saved before savedBefore but are still
+// in the outbox, oldest first, removes them from it, and returns their number.
+func (m *MemoryStorage) RelayOutbox(savedBefore time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := []models.OutboxMessage{}
+	for _, entry := range m.outbox {
+		if entry.CreatedAt.Before(savedBefore) {
+			pending = append(pending, entry)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].HistoryID < pending[j].HistoryID })
+	pending = page(pending, 0, limit)
+	for _, entry := range pending {
+		m.publish(entry.RoomID, entry.Payload)
+		delete(m.outbox, entry.HistoryID)
+	}
+	return len(pending), nil
+}
+
+// QueueOfflineMessage keeps a saved message for a user who is offline, until they take it
+// with TakeOfflineMessages or ttl passes after the last message was queued. It reports false
+// if limit messages wait already.
+func (m *MemoryStorage) QueueOfflineMessage(userID string, msg models.ChatMessage, limit int, ttl time.Duration) (bool, error) {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := offlineKeyPrefix + userID
+	field := strconv.FormatUint(uint64(msg.ID), 10)
+	if e := m.entry(key); e != nil {
+		if _, ok := e.hash[field]; !ok && len(e.hash) >= limit {
+			return false, nil
+		}
+	} else if limit <= 0 {
+		return false, nil
+	}
+	m.entryOrNew(key).hash[field] = string(msgBytes)
+	m.expire(key, time.Duration(int(ttl.Seconds()))*time.Second)
+	return true, nil
+}
+
+// TakeOfflineMessages removes the messages queued for a user with QueueOfflineMessage and
+// returns them in the order they were sent.
+func (m *MemoryStorage) TakeOfflineMessages(userID string) ([]models.ChatMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := offlineKeyPrefix + userID
+	messages := []models.ChatMessage{}
+	if e := m.entry(key); e != nil {
+		for _, raw := range e.hash {
+			var msg models.ChatMessage
+			if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+				log.Printf("ERROR: Failed to decode offline message of user %s: %v", userID, err)
+				continue
+			}
+			messages = append(messages, msg)
+		}
+	}
+	delete(m.keys, key)
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cloneComplaint returns a copy of a complaint that shares nothing with it.
+func cloneComplaint(complaint *models.Complaint) models.Complaint {
+	c := *complaint
+	c.EscalatedAt = clonePtr(complaint.EscalatedAt)
+	return c
+}
+
+// cloneBan returns a copy of a ban that shares nothing with it.
+func cloneBan(ban *models.Ban) models.Ban {
+	c := *ban
+	c.EndsAt = clonePtr(ban.EndsAt)
+	c.ComplaintID = clonePtr(ban.ComplaintID)
+	return c
+}
+
+// complaintsWhere returns copies of the complaints that match a condition, oldest first.
+func (m *MemoryStorage) complaintsWhere(match func(complaint *models.Complaint) bool) []models.Complaint {
+	complaints := []models.Complaint{}
+	for _, complaint := range m.complaints {
+		if match(complaint) {
+			complaints = append(complaints, cloneComplaint(complaint))
+		}
+	}
+	sort.Slice(complaints, func(i, j int) bool {
+		if !complaints[i].CreatedAt.Equal(complaints[j].CreatedAt) {
+			return complaints[i].CreatedAt.Before(complaints[j].CreatedAt)
+		}
+		return complaints[i].ID < complaints[j].ID
+	})
+	return complaints
+}
+
+// SaveComplaint saves a user complaint. It sets the default status to "new" if not provided.
+func (m *MemoryStorage) SaveComplaint(complaint *models.Complaint) error {
+	if complaint.Status == "" {
+		complaint.Status = models.ComplaintStatusNew
+	}
+	if complaint.Severity == "" {
+		complaint.Severity = models.ComplaintSeverityNormal
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveComplaint(complaint)
+	return nil
+}
+
+// saveComplaint stores a complaint, creating it if it has no ID yet.
+func (m *MemoryStorage) saveComplaint(complaint *models.Complaint) {
+	now := time.Now()
+	if complaint.ID == 0 {
+		m.lastComplaint++
+		complaint.ID = m.lastComplaint
+	}
+	if complaint.CreatedAt.IsZero() {
+		complaint.CreatedAt = now
+	}
+	complaint.UpdatedAt = now
+	c := cloneComplaint(complaint)
+	m.complaints[c.ID] = &c
+}
+
+// GetComplaintsByRoom retrieves all complaints filed for a given room.
+func (m *MemoryStorage) GetComplaintsByRoom(roomID string) ([]models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complaintsWhere(func(complaint *models.Complaint) bool { return complaint.RoomID == roomID }), nil
+}
+
+// GetComplaintByID retrieves a complaint by its ID.
+func (m *MemoryStorage) GetComplaintByID(id uint) (*models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	complaint, ok := m.complaints[id]
+	if !ok {
+		return nil, errors.New("complaint not found")
+	}
+	c := cloneComplaint(complaint)
+	return &c, nil
+}
+
+// UpdateComplaint saves all fields of an existing complaint, e.g. after moderation.
+func (m *MemoryStorage) UpdateComplaint(complaint *models.Complaint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveComplaint(complaint)
+	return nil
+}
+
+// GetComplaintsByReporter retrieves all complaints filed by a user, oldest first.
+func (m *MemoryStorage) GetComplaintsByReporter(userID string) ([]models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complaintsWhere(func(complaint *models.Complaint) bool { return complaint.ReporterID == userID }), nil
+}
+
+// GetComplaintsBySuspect retrieves all complaints filed against a user, oldest first.
+func (m *MemoryStorage) GetComplaintsBySuspect(userID string) ([]models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complaintsWhere(func(complaint *models.Complaint) bool { return complaint.SuspectID == userID }), nil
+}
+
+// GetComplaintsByRoomAndReportedUser retrieves the complaints filed against a user for a
+// given room, oldest first.
+func (m *MemoryStorage) GetComplaintsByRoomAndReportedUser(roomID, userID string) ([]models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complaintsWhere(func(complaint *models.Complaint) bool {
+		return complaint.RoomID == roomID && complaint.SuspectID == userID
+	}), nil
+}
+
+// GetComplaintsByReporterSince retrieves the complaints filed by a user at or after since,
+// oldest first.
+func (m *MemoryStorage) GetComplaintsByReporterSince(userID string, since time.Time) ([]models.Complaint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.complaintsWhere(func(complaint *models.Complaint) bool {
+		return complaint.ReporterID == userID && !complaint.CreatedAt.Before(since)
+	}), nil
+}
+
+// isBanned reports whether a user has a ban that applies at the given time.
+func (m *MemoryStorage) isBanned(userID string, now time.Time) bool {
+	for _, ban := range m.bans {
+		if ban.UserID == userID && ban.IsActive(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUserBanned checks if a user is currently banned.
+func (m *MemoryStorage) IsUserBanned(anonID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.isBanned(anonID, time.Now()), nil
+}
+
+// BanUser records a ban, which applies from its start until it ends or is reverted.
+func (m *MemoryStorage) BanUser(ban *models.Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastBanID++
+	ban.ID = m.lastBanID
+	c := cloneBan(ban)
+	m.bans[c.ID] = &c
+	return nil
+}
+
+// RevertBan reverts a ban by marking it deleted, keeping it in the user's sanction history,
+// and returns the reverted ban.
+func (m *MemoryStorage) RevertBan(banID uint) (*models.Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ban, ok := m.bans[banID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if ban.IsReverted() {
+		c := cloneBan(ban)
+		return &c, ErrBanReverted
+	}
+	ban.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	c := cloneBan(ban)
+	return &c, nil
+}
+
+// GetBansForUser returns the sanction history of a user, including reverted bans, oldest
+// first.
+func (m *MemoryStorage) GetBansForUser(userID string) ([]models.Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bans := []models.Ban{}
+	for _, ban := range m.bans {
+		if ban.UserID == userID {
+			bans = append(bans, cloneBan(ban))
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		if !bans[i].StartsAt.Equal(bans[j].StartsAt) {
+			return bans[i].StartsAt.Before(bans[j].StartsAt)
+		}
+		return bans[i].ID < bans[j].ID
+	})
+	return bans, nil
+}
+
+// SyncEndedBans returns the number of users whose bans ended between endedAfter and
+// endedBefore. IsUserBanned reads the bans, so there is no mirror to sync.
+func (m *MemoryStorage) SyncEndedBans(endedAfter, endedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := make(map[string]bool)
+	for _, ban := range m.bans {
+		if !ban.IsReverted() && ban.EndsAt != nil && ban.EndsAt.After(endedAfter) && !ban.EndsAt.After(endedBefore) {
+			users[ban.UserID] = true
+		}
+	}
+	return len(users), nil
+}
+
+// AddToMediaBlacklist adds a sticker set name or file unique ID to the moderation blacklist.
+func (m *MemoryStorage) AddToMediaBlacklist(kind, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entryOrNew("media_blacklist:" + kind).set[value] = true
+	return nil
+}
+
+// RemoveFromMediaBlacklist removes a sticker set name or file unique ID from the moderation
+// blacklist.
+func (m *MemoryStorage) RemoveFromMediaBlacklist(kind, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e := m.entry("media_blacklist:" + kind); e != nil {
+		delete(e.set, value)
+	}
+	return nil
+}
+
+// IsMediaBlacklisted checks whether a sticker set name or file unique ID is blacklisted.
+func (m *MemoryStorage) IsMediaBlacklisted(kind, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry("media_blacklist:" + kind)
+	return e != nil && e.set[value], nil
+}
+
+// IncrementMediaStrikes records an attempt to send blacklisted media and returns the number
+// of attempts the user made within the last 24 hours.
+func (m *MemoryStorage) IncrementMediaStrikes(userID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := "media_strikes:" + userID
+	e := m.entryOrNew(key)
+	count, _ := strconv.ParseInt(e.value, 10, 64)
+	count++
+	e.value = strconv.FormatInt(count, 10)
+	if count == 1 {
+		m.expire(key, mediaStrikesTTL)
+	}
+	return count, nil
+}
+
+// RecordCommandUsage counts an invocation of a command by a user in the hour of at, and
+// returns the number of times the user issued it in that hour.
+func (m *MemoryStorage) RecordCommandUsage(userID, command string, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	perUser, totals := commandUsageKeys(command, at)
+	counts := m.entryOrNew(perUser).zset
+	counts[userID]++
+	total, _ := strconv.ParseInt(m.entryOrNew(totals).hash[command], 10, 64)
+	m.keys[totals].hash[command] = strconv.FormatInt(total+1, 10)
+	m.expire(perUser, commandUsageTTL)
+	m.expire(totals, commandUsageTTL)
+	return int64(counts[userID]), nil
+}
+
+// GetCommandUsage returns the number of invocations of a command in the hour of at, and the
+// limit users who issued it most often.
+func (m *MemoryStorage) GetCommandUsage(command string, at time.Time, limit int) (*models.CommandUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	perUser, totals := commandUsageKeys(command, at)
+	usage := &models.CommandUsage{Command: command, Hour: at.Truncate(time.Hour)}
+	if e := m.entry(totals); e != nil {
+		usage.Total, _ = strconv.ParseInt(e.hash[command], 10, 64)
+	}
+	top := m.zrange(perUser)
+	for i := len(top) - 1; i >= 0 && len(usage.TopUsers) < limit; i-- {
+		usage.TopUsers = append(usage.TopUsers, models.CommandUserCount{UserID: top[i].member, Count: int64(top[i].score)})
+	}
+	return usage, nil
+}
@@ -0,0 +1,473 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cloneRoom returns a copy of a room that shares nothing with it.
+func cloneRoom(room *models.ChatRoom) *models.ChatRoom {
+	c := *room
+	c.QualityScore = clonePtr(room.QualityScore)
+	c.ArchivedAt = clonePtr(room.ArchivedAt)
+	return &c
+}
+
+// hasParticipant reports whether a user is one of the participants of a room.
+func hasParticipant(room *models.ChatRoom, userID string) bool {
+	return room.User1ID == userID || room.User2ID == userID
+}
+
+// roomsWhere returns copies of the rooms that match a condition, ordered by less.
+func (m *MemoryStorage) roomsWhere(match func(room *models.ChatRoom) bool, less func(a, b *models.ChatRoom) bool) []models.ChatRoom {
+	rooms := []models.ChatRoom{}
+	for _, room := range m.rooms {
+		if match(room) {
+			rooms = append(rooms, *cloneRoom(room))
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return less(&rooms[i], &rooms[j]) })
+	return rooms
+}
+
+// endedFirst orders rooms by the time they ended, the earliest first.
+func endedFirst(a, b *models.ChatRoom) bool { return a.EndedAt.Before(b.EndedAt) }
+
+// endedLast orders rooms by the time they ended, the latest first.
+func endedLast(a, b *models.ChatRoom) bool { return a.EndedAt.After(b.EndedAt) }
+
+// SaveRoom saves a chat room. An active room starts counting towards the idle timeout (see
+// ClaimIdleRooms) at its start.
+func (m *MemoryStorage) SaveRoom(room *models.ChatRoom) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rooms[room.RoomID] = cloneRoom(room)
+	if room.IsActive {
+		startedAt := room.StartedAt
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		m.touchRoom(room.RoomID, startedAt)
+	}
+	return nil
+}
+
+// touchRoom records activity in a room.
+func (m *MemoryStorage) touchRoom(roomID string, at time.Time) {
+	m.entryOrNew(roomActivityKey).zset[roomID] = float64(at.Unix())
+}
+
+// CloseRoom marks a chat room as inactive and sets its end time.
+func (m *MemoryStorage) CloseRoom(roomID, closedBy, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if room, ok := m.rooms[roomID]; ok {
+		room.IsActive = false
+		room.EndedAt = time.Now()
+		room.ClosedBy = closedBy
+		room.CloseReason = reason
+	}
+	if e := m.entry(roomActivityKey); e != nil {
+		delete(e.zset, roomID)
+	}
+	return nil
+}
+
+// MoveRoomSeat gives the seat of a user in an active room to another user.
+func (m *MemoryStorage) MoveRoomSeat(roomID, fromUserID, toUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomID]
+	if !ok || !room.IsActive {
+		return nil
+	}
+	if room.User1ID == fromUserID {
+		room.User1ID = toUserID
+	}
+	if room.User2ID == fromUserID {
+		room.User2ID = toUserID
+	}
+	return nil
+}
+
+// TrackActiveRooms adds the active rooms that are not tracked yet to the activity tracking of
+// ClaimIdleRooms, as of their start, and returns the number of rooms added.
+func (m *MemoryStorage) TrackActiveRooms() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activity := m.entryOrNew(roomActivityKey)
+	added := 0
+	for roomID, room := range m.rooms {
+		if _, tracked := activity.zset[roomID]; !room.IsActive || tracked {
+			continue
+		}
+		startedAt := room.StartedAt
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		activity.zset[roomID] = float64(startedAt.Unix())
+		added++
+	}
+	return added, nil
+}
+
+// ClaimIdleRooms removes up to limit rooms whose last activity was before the given time from
+// the activity tracking, and returns their IDs.
+func (m *MemoryStorage) ClaimIdleRooms(activeBefore time.Time, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zremScoredBefore(roomActivityKey, float64(activeBefore.Unix()), limit), nil
+}
+
+// GetActiveRoomIDForUser finds the active room ID for a specific user, or "" if the user is
+// not in an active room.
+func (m *MemoryStorage) GetActiveRoomIDForUser(userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, room := range m.rooms {
+		if room.IsActive && hasParticipant(room, userID) {
+			return room.RoomID, nil
+		}
+	}
+	return "", nil
+}
+
+// GetLastClosedRoomForUser returns the user's most recently closed chat room, or nil if the
+// user never finished a chat.
+func (m *MemoryStorage) GetLastClosedRoomForUser(userID string) (*models.ChatRoom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rooms := m.roomsWhere(func(room *models.ChatRoom) bool {
+		return !room.IsActive && hasParticipant(room, userID)
+	}, endedLast)
+	if len(rooms) == 0 {
+		return nil, nil
+	}
+	return &rooms[0], nil
+}
+
+// GetActiveRoomIDs returns the IDs of all currently active rooms.
+func (m *MemoryStorage) GetActiveRoomIDs() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	roomIDs := []string{}
+	for _, room := range m.rooms {
+		if room.IsActive {
+			roomIDs = append(roomIDs, room.RoomID)
+		}
+	}
+	return roomIDs, nil
+}
+
+// GetRoomByID retrieves a chat room by its unique RoomID.
+func (m *MemoryStorage) GetRoomByID(roomID string) (*models.ChatRoom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return nil, errors.New("chat room not found")
+	}
+	return cloneRoom(room), nil
+}
+
+// ListRooms returns the rooms matching a filter with the number of messages in their history,
+// newest first.
+func (m *MemoryStorage) ListRooms(filter models.RoomFilter) ([]models.RoomListing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int64)
+	for _, history := range m.history {
+		counts[history.RoomID]++
+	}
+
+	listings := []models.RoomListing{}
+	for _, room := range m.rooms {
+		count := counts[room.RoomID]
+		switch {
+		case filter.Active != nil && room.IsActive != *filter.Active,
+			filter.ParticipantID != "" && !hasParticipant(room, filter.ParticipantID),
+			!filter.From.IsZero() && room.StartedAt.Before(filter.From),
+			!filter.To.IsZero() && !room.StartedAt.Before(filter.To),
+			count < int64(filter.MinMessages),
+			filter.MaxMessages != nil && count > int64(*filter.MaxMessages):
+			continue
+		}
+		listings = append(listings, models.RoomListing{ChatRoom: *cloneRoom(room), MessageCount: count})
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		if !listings[i].StartedAt.Equal(listings[j].StartedAt) {
+			return listings[i].StartedAt.After(listings[j].StartedAt)
+		}
+		return listings[i].RoomID < listings[j].RoomID
+	})
+	return page(listings, filter.Offset, filter.Limit), nil
+}
+
+// AddRecentPartners records two users as each other's recent chat partners. The records of a
+// user expire ttl after the last write.
+func (m *MemoryStorage) AddRecentPartners(user1ID, user2ID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, pair := range [][2]string{{user1ID, user2ID}, {user2ID, user1ID}} {
+		key := "recent_partners:" + pair[0]
+		partners := m.entryOrNew(key).zset
+		partners[pair[1]] = float64(now.Unix())
+		m.zremScoredBefore(key, float64(now.Add(-ttl).Unix()), -1)
+		m.expire(key, ttl)
+	}
+	return nil
+}
+
+// GetRecentPartners returns the users a user chatted with since the given time, mapped to
+// the time their last chat ended.
+func (m *MemoryStorage) GetRecentPartners(userID string, since time.Time) (map[string]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	partners := make(map[string]time.Time)
+	for _, member := range m.zrange("recent_partners:" + userID) {
+		if member.score >= float64(since.Unix()) {
+			partners[member.member] = time.Unix(int64(member.score), 0)
+		}
+	}
+	return partners, nil
+}
+
+// AddRematchRequest records that a user wants to chat again with their last partner. The
+// request expires after ttl.
+func (m *MemoryStorage) AddRematchRequest(fromID, toID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set("rematch:"+fromID+":"+toID, "1", ttl)
+	return nil
+}
+
+// TakeRematchRequest removes a pending rematch request from one user to another. It returns
+// false if there was no such request or it expired.
+func (m *MemoryStorage) TakeRematchRequest(fromID, toID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := "rematch:" + fromID + ":" + toID
+	_, ok := m.get(key)
+	delete(m.keys, key)
+	return ok, nil
+}
+
+// GetUnscoredClosedRooms returns up to limit closed rooms that do not have a quality score yet,
+// oldest first.
+func (m *MemoryStorage) GetUnscoredClosedRooms(limit int) ([]models.ChatRoom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rooms := m.roomsWhere(func(room *models.ChatRoom) bool {
+		return !room.IsActive && room.QualityScore == nil
+	}, endedFirst)
+	return page(rooms, 0, limit), nil
+}
+
+// UpdateRoomQualityScore stores the computed quality score of a room, unless it already has
+// one. It reports whether the score was stored.
+func (m *MemoryStorage) UpdateRoomQualityScore(roomID string, score int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomID]
+	if !ok || room.QualityScore != nil {
+		return false, nil
+	}
+	room.QualityScore = &score
+	return true, nil
+}
+
+// GetScoredRoomsForUser returns up to limit of the user's closed rooms that have a quality
+// score, most recently ended first.
+func (m *MemoryStorage) GetScoredRoomsForUser(userID string, limit int) ([]models.ChatRoom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rooms := m.roomsWhere(func(room *models.ChatRoom) bool {
+		return !room.IsActive && room.QualityScore != nil && hasParticipant(room, userID)
+	}, endedLast)
+	return page(rooms, 0, limit), nil
+}
+
+// GetArchivableRooms returns up to limit rooms whose history can be moved to the archive,
+// oldest first, like Service.GetArchivableRooms.
+func (m *MemoryStorage) GetArchivableRooms(endedBefore time.Time, limit int) ([]models.ChatRoom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	awaitingReview := make(map[string]bool)
+	for _, complaint := range m.complaints {
+		if complaint.Status == models.ComplaintStatusNew {
+			awaitingReview[complaint.RoomID] = true
+		}
+	}
+	rooms := m.roomsWhere(func(room *models.ChatRoom) bool {
+		return !room.IsActive && room.ArchivedAt == nil && room.QualityScore != nil &&
+			room.EndedAt.Before(endedBefore) && !awaitingReview[room.RoomID]
+	}, endedFirst)
+	return page(rooms, 0, limit), nil
+}
+
+// MarkRoomArchived records that the history of a room was archived at url, and deletes it.
+func (m *MemoryStorage) MarkRoomArchived(roomID, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, history := range m.history {
+		if history.RoomID == roomID {
+			delete(m.history, id)
+		}
+	}
+	if room, ok := m.rooms[roomID]; ok {
+		now := time.Now()
+		room.ArchivedAt = &now
+		room.ArchiveURL = url
+	}
+	return nil
+}
+
+// PublishMessage serializes a ChatMessage to JSON and delivers it to the subscriptions that
+// joined its room.
+func (m *MemoryStorage) PublishMessage(roomID string, msg models.ChatMessage) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publish(roomID, string(msgBytes))
+	return nil
+}
+
+// publish delivers a JSON-encoded ChatMessage to the subscriptions that joined its room.
+func (m *MemoryStorage) publish(roomID, payload string) {
+	for sub := range m.subscriptions {
+		if sub.rooms[roomID] {
+			sub.deliver(&redis.Message{Channel: RoomChannel(roomID), Payload: payload})
+		}
+	}
+}
+
+// SubscribeToRooms opens a subscription that has not joined any room yet.
+func (m *MemoryStorage) SubscribeToRooms() RoomSubscription {
+	sub := &memorySubscription{
+		storage: m,
+		rooms:   make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		out:     make(chan *redis.Message),
+		closed:  make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.subscriptions[sub] = true
+	m.mu.Unlock()
+	go sub.run()
+	return sub
+}
+
+// memorySubscription is the RoomSubscription of a MemoryStorage. Publishing never waits for
+// the reader: the messages wait in the subscription until they are read.
+type memorySubscription struct {
+	storage *MemoryStorage
+	// rooms are the joined rooms, guarded by the mutex of the storage.
+	rooms map[string]bool
+
+	mu      sync.Mutex
+	pending []*redis.Message
+	wake    chan struct{}
+	out     chan *redis.Message
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (s *memorySubscription) Join(ctx context.Context, roomIDs ...string) error {
+	s.storage.mu.Lock()
+	defer s.storage.mu.Unlock()
+	for _, roomID := range roomIDs {
+		s.rooms[roomID] = true
+	}
+	return nil
+}
+
+func (s *memorySubscription) Leave(ctx context.Context, roomIDs ...string) error {
+	s.storage.mu.Lock()
+	defer s.storage.mu.Unlock()
+	for _, roomID := range roomIDs {
+		delete(s.rooms, roomID)
+	}
+	return nil
+}
+
+func (s *memorySubscription) Channel() <-chan *redis.Message {
+	return s.out
+}
+
+func (s *memorySubscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.storage.mu.Lock()
+		delete(s.storage.subscriptions, s)
+		s.storage.mu.Unlock()
+		close(s.closed)
+	})
+	return nil
+}
+
+// deliver queues a message for the reader.
+func (s *memorySubscription) deliver(msg *redis.Message) {
+	s.mu.Lock()
+	s.pending = append(s.pending, msg)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run hands the queued messages to the reader in order, until the subscription is closed,
+// and then closes its channel.
+func (s *memorySubscription) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+		msg := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.out <- msg:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// MarkRead records that a participant of a room read the messages up to the given history
+// entry, and reports whether this moved their read position forward.
+func (m *MemoryStorage) MarkRead(roomID, userID string, historyID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := "room_read:" + roomID
+	if e := m.entry(key); e != nil {
+		if current, _ := strconv.ParseUint(e.hash[userID], 10, 64); uint64(historyID) <= current {
+			return false, nil
+		}
+	}
+	m.entryOrNew(key).hash[userID] = strconv.FormatUint(uint64(historyID), 10)
+	m.expire(key, readReceiptTTL)
+	return true, nil
+}
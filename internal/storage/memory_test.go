@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive returns the next message of a subscription, or fails the test after a second.
+func receive(t *testing.T, sub RoomSubscription) models.ChatMessage {
+	t.Helper()
+	select {
+	case msg := <-sub.Channel():
+		var chatMsg models.ChatMessage
+		require.NoError(t, json.Unmarshal([]byte(msg.Payload), &chatMsg))
+		assert.Equal(t, RoomChannel(chatMsg.RoomID), msg.Channel)
+		return chatMsg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return models.ChatMessage{}
+	}
+}
+
+// TestMemoryStorage_PublishesSavedMessagesToJoinedRooms verifies that saved messages reach
+// only the subscriptions of their room, whether published directly or by the outbox relay.
+func TestMemoryStorage_PublishesSavedMessagesToJoinedRooms(t *testing.T) {
+	s := NewMemoryStorage()
+	sub := s.SubscribeToRooms()
+	defer sub.Close()
+	require.NoError(t, sub.Join(context.Background(), "room1"))
+
+	first := &models.ChatMessage{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "hello"}
+	other := &models.ChatMessage{RoomID: "room2", SenderID: "user_C", Type: "text", Content: "elsewhere"}
+	second := &models.ChatMessage{RoomID: "room1", SenderID: "user_B", Type: "text", Content: "hi"}
+	require.NoError(t, s.SaveMessages([]*models.ChatMessage{first, other}))
+	require.NoError(t, s.SaveMessage(second))
+	assert.Equal(t, []uint{1, 2, 3}, []uint{first.ID, other.ID, second.ID})
+
+	require.NoError(t, s.PublishSavedMessage(*other))
+	require.NoError(t, s.PublishSavedMessage(*first))
+	assert.Equal(t, "hello", receive(t, sub).Content)
+
+	relayed, err := s.RelayOutbox(time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, relayed, "only the unpublished message is relayed")
+	assert.Equal(t, uint(3), receive(t, sub).ID)
+
+	history, err := s.GetChatHistory("room1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "hello", history[0].Content)
+
+	require.NoError(t, sub.Close())
+	_, open := <-sub.Channel()
+	assert.False(t, open, "the channel is closed with the subscription")
+}
+
+// TestMemoryStorage_SearchQueueAndLocks verifies that users are claimed from the queue only
+// together, and that match locks are exclusive until released or expired.
+func TestMemoryStorage_SearchQueueAndLocks(t *testing.T) {
+	s := NewMemoryStorage()
+	for _, userID := range []string{"user_A", "user_B", "user_C"} {
+		require.NoError(t, s.AddUserToSearchQueue(userID))
+	}
+	position, total, err := s.GetSearchQueueStatus("user_B")
+	require.NoError(t, err)
+	assert.Equal(t, 2, position)
+	assert.Equal(t, 3, total)
+
+	claimed, err := s.ClaimMatch("user_A", "user_B")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = s.ClaimMatch("user_B", "user_C")
+	require.NoError(t, err)
+	assert.False(t, claimed, "user_B was claimed already")
+	searching, err := s.GetSearchingUsers()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_C"}, searching)
+
+	locked, err := s.LockMatch("match1", []string{"user_A", "user_B"}, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	locked, err = s.LockMatch("match2", []string{"user_B", "user_C"}, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, locked)
+	require.NoError(t, s.UnlockMatch("match2", []string{"user_B"}))
+	require.NoError(t, s.UnlockMatch("match1", []string{"user_A", "user_B"}))
+	locked, err = s.LockMatch("match2", []string{"user_B", "user_C"}, 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	time.Sleep(30 * time.Millisecond)
+	locked, err = s.LockMatch("match3", []string{"user_C"}, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, locked, "the lock of match2 expired")
+}
+
+// TestMemoryStorage_SavedSearchRequests verifies that a saved search request is kept while
+// the user is queued, and dropped when they leave the queue or are queued without one.
+func TestMemoryStorage_SavedSearchRequests(t *testing.T) {
+	s := NewMemoryStorage()
+	req := models.SearchRequest{UserID: "user_A", Params: models.SearchParams{TargetGender: "female", TargetAgeMin: 20}, RelaxLevel: 1}
+	require.NoError(t, s.SaveSearchRequest(req))
+	searching, err := s.IsUserSearching("user_A")
+	require.NoError(t, err)
+	assert.True(t, searching)
+	saved, err := s.GetSearchRequest("user_A")
+	require.NoError(t, err)
+	assert.Equal(t, &req, saved)
+
+	require.NoError(t, s.RemoveUserFromSearchQueue("user_A"))
+	saved, err = s.GetSearchRequest("user_A")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	require.NoError(t, s.SaveSearchRequest(req))
+	require.NoError(t, s.AddUserToSearchQueue("user_A"))
+	saved, err = s.GetSearchRequest("user_A")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+}
+
+// TestMemoryStorage_BansAndDataDeletion verifies that a ban applies until it is reverted, and
+// that a user's data can only be deleted while they are not banned.
+func TestMemoryStorage_BansAndDataDeletion(t *testing.T) {
+	s := NewMemoryStorage()
+	user, err := s.SaveUserIfNotExists(42)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user.ID)
+	assert.Equal(t, "en", user.Language)
+	require.NoError(t, s.SaveRoom(&models.ChatRoom{RoomID: "room1", User1ID: user.ID, User2ID: "user_B", IsActive: true, StartedAt: time.Now()}))
+	require.NoError(t, s.SetUserAttribute(user.ID, "last_message", "7"))
+	code, err := s.CreateLinkCode(user.ID, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.LinkIdentity("web_1", user.ID, time.Hour))
+	require.NoError(t, s.SavePseudonyms(map[string]string{"anon_1": user.ID}, time.Hour))
+
+	ban := models.NewBan(user.ID, time.Now().Add(-time.Minute), time.Hour, nil)
+	require.NoError(t, s.BanUser(ban))
+	banned, err := s.IsUserBanned(user.ID)
+	require.NoError(t, err)
+	assert.True(t, banned)
+	assert.ErrorIs(t, s.DeleteUserData(user.ID), ErrUserBanned)
+
+	_, err = s.RevertBan(ban.ID)
+	require.NoError(t, err)
+	_, err = s.RevertBan(ban.ID)
+	assert.ErrorIs(t, err, ErrBanReverted)
+	bans, err := s.GetBansForUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, bans, 1, "reverted bans stay in the history")
+	assert.True(t, bans[0].IsReverted())
+
+	require.NoError(t, s.DeleteUserData(user.ID))
+	_, err = s.GetUserByID(user.ID)
+	assert.Error(t, err)
+	room, err := s.GetRoomByID("room1")
+	require.NoError(t, err)
+	assert.Equal(t, DeletedUserID, room.User1ID)
+	value, err := s.GetUserAttribute(user.ID, "last_message")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	for _, get := range []func() (string, error){
+		func() (string, error) { return s.TakeLinkCode(code) },
+		func() (string, error) { return s.GetLinkedIdentity("web_1") },
+		func() (string, error) { return s.ResolvePseudonym("anon_1") },
+	} {
+		value, err := get()
+		require.NoError(t, err)
+		assert.Empty(t, value)
+	}
+}
+
+// TestMemoryStorage_ClaimIdleRooms verifies that rooms are claimed once, by the time of their
+// last message, and that closed rooms are no longer tracked.
+func TestMemoryStorage_ClaimIdleRooms(t *testing.T) {
+	s := NewMemoryStorage()
+	started := time.Now().Add(-time.Hour)
+	for _, roomID := range []string{"quiet", "busy", "closed"} {
+		require.NoError(t, s.SaveRoom(&models.ChatRoom{RoomID: roomID, IsActive: true, StartedAt: started}))
+	}
+	require.NoError(t, s.SaveMessage(&models.ChatMessage{RoomID: "busy", SenderID: "user_A", Type: "text", Content: "hi"}))
+	require.NoError(t, s.CloseRoom("closed", "user_A", "stop"))
+
+	idle, err := s.ClaimIdleRooms(time.Now().Add(-time.Minute), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"quiet"}, idle)
+	idle, err = s.ClaimIdleRooms(time.Now().Add(-time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, idle)
+}
+
+// TestMemoryStorage_TrackActiveRooms verifies that active rooms missing from the activity
+// tracking are added as of their start, and tracked rooms keep their last activity.
+func TestMemoryStorage_TrackActiveRooms(t *testing.T) {
+	s := NewMemoryStorage()
+	started := time.Now().Add(-time.Hour)
+	for _, roomID := range []string{"untracked", "busy", "closed"} {
+		require.NoError(t, s.SaveRoom(&models.ChatRoom{RoomID: roomID, IsActive: true, StartedAt: started}))
+	}
+	require.NoError(t, s.SaveMessage(&models.ChatMessage{RoomID: "busy", SenderID: "user_A", Type: "text", Content: "hi"}))
+	require.NoError(t, s.CloseRoom("closed", "user_A", "stop"))
+	delete(s.entry(roomActivityKey).zset, "untracked")
+
+	added, err := s.TrackActiveRooms()
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	idle, err := s.ClaimIdleRooms(time.Now().Add(-time.Minute), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"untracked"}, idle)
+}
+
+// TestMemoryStorage_SearchHistory verifies the web search syntax of history searches.
+func TestMemoryStorage_SearchHistory(t *testing.T) {
+	s := NewMemoryStorage()
+	for _, msg := range []*models.ChatMessage{
+		{RoomID: "room1", SenderID: "user_A", Type: "text", Content: "Meet me at the old bridge"},
+		{RoomID: "room1", SenderID: "user_B", Type: "text", Content: "the bridge is old"},
+		{RoomID: "room1", SenderID: "user_A", Type: "photo", Content: "file-id", Metadata: "a photo of the river"},
+	} {
+		require.NoError(t, s.SaveMessage(msg))
+	}
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{query: "bridge", want: []uint{2, 1}},
+		{query: `"old bridge"`, want: []uint{1}},
+		{query: "bridge -meet", want: []uint{2}},
+		{query: "river or meet", want: []uint{3, 1}},
+		{query: "file", want: nil},
+		{query: "", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits, err := s.SearchHistory(models.HistorySearch{Query: tt.query, Limit: 10})
+			require.NoError(t, err)
+			var ids []uint
+			for _, hit := range hits {
+				ids = append(ids, hit.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
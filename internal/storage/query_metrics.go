@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultSlowQueryThreshold is the duration from which a query is logged as slow, the same as
+// GORM's default logger.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// otherMethod labels the queries that were not made by a Service method, e.g. migrations.
+const otherMethod = "other"
+
+var (
+	queryDuration = metrics.Default.NewHistogramVec("chatgogo_storage_query_duration_seconds",
+		"Duration of the PostgreSQL queries, by Storage method.",
+		[]float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}, "method")
+	queryErrors = metrics.Default.NewCounterVec("chatgogo_storage_query_errors_total",
+		"PostgreSQL queries that failed, by Storage method. Finding no record is not a failure.", "method")
+	slowQueries = metrics.Default.NewCounterVec("chatgogo_storage_slow_queries_total",
+		"PostgreSQL queries that took at least the slow query threshold, by Storage method.", "method")
+)
+
+// servicePrefix is the prefix of the names of Service methods in stack traces, e.g.
+// "chatgogo/backend/internal/storage.(*Service).".
+var servicePrefix = func() string {
+	name := runtime.FuncForPC(reflect.ValueOf((*Service).SaveMessage).Pointer()).Name()
+	return strings.TrimSuffix(name, "SaveMessage")
+}()
+
+// QueryLogger is a GORM logger that records the duration and failures of every query in the
+// storage metrics, labelled by the Service method that made it, and logs the queries that
+// took at least SlowThreshold. Everything else is left to the wrapped logger.
+type QueryLogger struct {
+	logger.Interface
+	// SlowThreshold is the duration from which a query is logged as slow; 0 disables the log.
+	SlowThreshold time.Duration
+}
+
+// NewQueryLogger creates a QueryLogger wrapping a logger like GORM's default one, without its
+// own slow query log.
+func NewQueryLogger(slowThreshold time.Duration) *QueryLogger {
+	return &QueryLogger{
+		Interface: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			LogLevel: logger.Warn,
+			Colorful: true,
+		}),
+		SlowThreshold: slowThreshold,
+	}
+}
+
+// LogMode returns a QueryLogger wrapping the wrapped logger at the given level.
+func (l *QueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &QueryLogger{Interface: l.Interface.LogMode(level), SlowThreshold: l.SlowThreshold}
+}
+
+// Trace is called by GORM after every query.
+func (l *QueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	method := queryMethod()
+	queryDuration.Observe(elapsed.Seconds(), method)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		queryErrors.Inc(method)
+	}
+	if l.SlowThreshold > 0 && elapsed >= l.SlowThreshold {
+		slowQueries.Inc(method)
+		sql, rows := fc()
+		log.Printf("WARN: Slow query in %s took %v (rows: %d): %s", method, elapsed, rows, sql)
+	}
+	l.Interface.Trace(ctx, begin, fc, err)
+}
+
+// queryMethod returns the name of the outermost Service method on the stack, the one called
+// by the rest of the application, or otherMethod if there is none.
+func queryMethod() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	method := otherMethod
+	for {
+		frame, more := frames.Next()
+		if name, ok := strings.CutPrefix(frame.Function, servicePrefix); ok {
+			// Closures, e.g. of transactions, are named like "MarkRoomArchived.func1".
+			method, _, _ = strings.Cut(name, ".")
+		}
+		if !more {
+			return method
+		}
+	}
+}
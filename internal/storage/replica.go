@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaResolver names the dbresolver configuration of the read replica, which only the
+// queries of reads opt into.
+const replicaResolver = "replica"
+
+// UseReadReplica registers the PostgreSQL read replica at dsn with db, so that the heavy
+// reads of the Service (see reads) are served by it. All other queries, and every write,
+// still go to the primary, so the hub reads its own writes.
+func UseReadReplica(db *gorm.DB, dsn string) error {
+	return db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{postgres.Open(dsn)},
+	}, replicaResolver))
+}
+
+// reads returns the database session of heavy reads, e.g. of moderation or statistics, which
+// is the read replica if one was registered with UseReadReplica, and the primary otherwise.
+// The replica may lag behind, so reads whose results are written back, or that must see
+// what was just written, use DB.
+func (s *Service) reads() *gorm.DB {
+	return s.DB.Clauses(dbresolver.Use(replicaResolver))
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+)
+
+// roomMessageCount counts the messages of a room in a query of chat_rooms. The room ID is cast
+// to the type of chat_histories.room_id so that the index of the history on rooms is used.
+const roomMessageCount = "(SELECT count(*) FROM chat_histories WHERE chat_histories.room_id = chat_rooms.room_id::uuid AND chat_histories.deleted_at IS NULL)"
+
+// ListRooms returns the rooms matching a filter with the number of messages in their history,
+// newest first, for the admin API. It reads from the replica, if any.
+func (s *Service) ListRooms(filter models.RoomFilter) ([]models.RoomListing, error) {
+	query := s.reads().Model(&models.ChatRoom{}).Select("chat_rooms.*, " + roomMessageCount + " AS message_count")
+	if filter.Active != nil {
+		query = query.Where("is_active = ?", *filter.Active)
+	}
+	if filter.ParticipantID != "" {
+		query = query.Where("(user1_id = ? OR user2_id = ?)", filter.ParticipantID, filter.ParticipantID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("started_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("started_at < ?", filter.To)
+	}
+	if filter.MinMessages > 0 {
+		query = query.Where(roomMessageCount+" >= ?", filter.MinMessages)
+	}
+	if filter.MaxMessages != nil {
+		query = query.Where(roomMessageCount+" <= ?", *filter.MaxMessages)
+	}
+
+	var rooms []models.RoomListing
+	err := query.Order("started_at desc, room_id").Limit(filter.Limit).Offset(filter.Offset).Find(&rooms).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to list rooms: %v", err)
+		return nil, err
+	}
+	return rooms, nil
+}
@@ -5,27 +5,223 @@ package storage
 import (
 	"chatgogo/backend/internal/models"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"log"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Media blacklist kinds used with the media blacklist operations.
+const (
+	// MediaBlacklistStickerSet identifies entries that block a whole sticker pack by its set name.
+	MediaBlacklistStickerSet = "sticker_set"
+	// MediaBlacklistFile identifies entries that block a single file (e.g., a GIF) by its unique ID.
+	MediaBlacklistFile = "file"
+)
+
+// searchQueueKey is the Redis sorted set holding the matchmaking queue, scored by enqueue time.
+const searchQueueKey = "matchmaking_queue"
+
+// claimMatchScript atomically removes two users from the matchmaking queue, but only if both
+// are still in it. It returns 1 if the pair was claimed and 0 otherwise.
+var claimMatchScript = redis.NewScript(`
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) and redis.call("ZSCORE", KEYS[1], ARGV[2]) then
+	redis.call("ZREM", KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// matchLockKeyPrefix prefixes the keys that lock users while a room is opened for them, so
+// that concurrent matches cannot put a user into two rooms. Its hash tag keeps all locks in
+// one Redis Cluster slot, as lockKeysScript sets the locks of both users at once.
+const matchLockKeyPrefix = "{match_lock}:"
+
+// lockKeysScript sets all keys KEYS to ARGV[1], expiring after ARGV[2] milliseconds, and
+// returns 1, unless one of them exists, in which case it sets none and returns 0.
+var lockKeysScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call("EXISTS", key) == 1 then
+		return 0
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call("SET", key, ARGV[1], "PX", ARGV[2])
+end
+return 1
+`)
+
+// unlockKeysScript deletes those of the keys KEYS that hold ARGV[1].
+var unlockKeysScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call("GET", key) == ARGV[1] then
+		redis.call("DEL", key)
+	end
+end
+return 0
+`)
+
+// removeScoredBeforeScript removes up to ARGV[2] members of the sorted set KEYS[1] scored at
+// or before ARGV[1] and returns them, e.g. the users who joined the matchmaking queue before a
+// time.
+var removeScoredBeforeScript = redis.NewScript(`
+local stale = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+if #stale > 0 then
+	redis.call("ZREM", KEYS[1], unpack(stale))
+end
+return stale
+`)
+
+// readReceiptTTL is how long the last message read by each participant of a room is kept
+// after their last read receipt.
+const readReceiptTTL = 24 * time.Hour
+
+// markReadScript records the last message a participant of a room read, in the room's hash
+// of read positions, unless they already read a later one. It returns 1 if the position
+// moved forward and 0 otherwise.
+var markReadScript = redis.NewScript(`
+local current = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0")
+if tonumber(ARGV[2]) <= current then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+// matcherLeaderKey holds the ID of the instance currently running the matcher.
+const matcherLeaderKey = "matcher:leader"
+
+// roomActivityKey is the Redis sorted set of active rooms, scored by the Unix time of their
+// last saved message, or of their start.
+const roomActivityKey = "room_activity"
+
+// searchRequestKeyPrefix prefixes the keys that hold the search request of a queued user as
+// JSON, so that whoever restores the queue, e.g. after a shutdown, searches with its criteria.
+const searchRequestKeyPrefix = "search_request:"
+
+// searchRequestTTL is how long the search request of a queued user is kept.
+const searchRequestTTL = 24 * time.Hour
+
+// presenceKeyPrefix prefixes the keys that mark a user as online. They expire unless the
+// instance the user is connected to refreshes them.
+const presenceKeyPrefix = "presence:"
+
+// clientInstanceKeyPrefix prefixes the keys of the client registry, which hold the ID of the
+// instance a user's client is connected to. They expire unless that instance refreshes them.
+const clientInstanceKeyPrefix = "client_instance:"
+
+// jobRunKeyPrefix prefixes the keys that claim a run of an exclusive scheduled job for one
+// instance.
+const jobRunKeyPrefix = "job_run:"
+
+// linkCodeKeyPrefix prefixes the keys of the one-time codes that link a web identity to
+// another user, holding the ID of the web identity.
+const linkCodeKeyPrefix = "link_code:"
+
+// identityLinkKeyPrefix prefixes the keys that hold the user a web identity was linked to.
+const identityLinkKeyPrefix = "identity_link:"
+
+// pseudonymKeyPrefix prefixes the keys that hold the user ID of a pseudonym handed out in an
+// export (see package anonymize).
+const pseudonymKeyPrefix = "pseudonym:"
+
+// linkCodeAlphabet are the characters of link codes, without the ones easily mistaken for
+// each other.
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// linkCodeLength is the number of characters of a link code.
+const linkCodeLength = 8
+
+// deleteIfEqualScript deletes the key KEYS[1] if it holds ARGV[1].
+var deleteIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// offlineKeyPrefix prefixes the hashes of the messages waiting for users who were offline
+// when they were relayed, keyed by the history ID of each message.
+const offlineKeyPrefix = "offline:"
+
+// queueOfflineScript adds the message ARGV[2] with history ID ARGV[1] to the hash KEYS[1],
+// unless it holds ARGV[3] messages already, and lets the hash expire after ARGV[4] seconds.
+// It returns 0 if the hash was full and 1 otherwise.
+var queueOfflineScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 and redis.call("HLEN", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// acquireLeadershipScript extends the lease of the current leader, or takes the lease if no
+// one holds it. It returns 1 if the caller holds the lease afterwards and 0 otherwise.
+var acquireLeadershipScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
 // Storage defines the interface for all data persistence operations.
-// It abstracts the underlying database and cache implementations.
+// It abstracts the underlying database and cache implementations. It is composed of focused
+// stores, so that components can depend on only the operations they use.
 type Storage interface {
+	UserStore
+	RoomStore
+	MessageStore
+	ComplaintStore
+	QueueStore
+	InstanceStore
+}
+
+// UserStore stores users, their profiles and settings, and the transient state kept for them
+// in Redis.
+type UserStore interface {
 	// User operations
 	SaveUser(user *models.User) error
 	SaveUserIfNotExists(telegramID int64) (*models.User, error)
 	GetUserByTelegramID(telegramID int64) (*models.User, error)
-	IsUserBanned(anonID string) (bool, error)
+	GetUserByID(userID string) (*models.User, error)
+	GetUsersByIDs(userIDs []string) ([]models.User, error)
 	UpdateUserMediaSpoiler(userID string, value bool) error
 	UpdateUserAge(userID string, age int) error
 	UpdateUserGender(userID string, gender string) error
 	UpdateUserInterests(userID string, interests []string) error
+	SetUserBotBlocked(userID string, blocked bool) error
+	GetIncompleteProfiles(offset, limit int) ([]models.User, error)
+	GetBroadcastRecipients(afterID string, limit int) ([]models.User, error)
+	UpdateUserSearchPreferences(userID string, gender string, ageMin, ageMax int) error
+	UpdateUserAutoRequeue(userID string, value bool) error
+	UpdateUserRegion(userID string, region string) error
+	UpdateUserNearTimezone(userID string, value bool) error
+	UpdateUserReadReceipts(userID string, value bool) error
+	UpdateUserHideTyping(userID string, value bool) error
+	UpdateUserHidePresence(userID string, value bool) error
+	UpdateUserLanguage(telegramID int64, languageCode string) error
+	SetUserPremium(userID string, until *time.Time) error
+	BlockUser(userID, blockedID string) error
+	UnblockUser(userID, blockedID string) error
+	SetUserLabFeature(userID, feature string, enabled bool) error
+	GetUserFiles(userID string) (mediaURLs, archiveURLs []string, err error)
+	DeleteUserData(userID string) error
+	AdjustUserRating(userID string, delta int) error
+	RecoverUserRatings(step int, quietSince time.Time) (int64, error)
 
 	// User State Management (Redis)
 	SetUserState(userID string, state string) error
@@ -37,73 +233,325 @@ type Storage interface {
 	GetUserAttribute(userID string, key string) (string, error)
 	DeleteUserAttribute(userID string, key string) error
 
+	// Presence (Redis)
+	RefreshPresence(userIDs []string, ttl time.Duration) error
+	IsUserOnline(userID string) (bool, error)
+
+	// Identity links (Redis)
+	CreateLinkCode(userID string, ttl time.Duration) (string, error)
+	TakeLinkCode(code string) (string, error)
+	LinkIdentity(webID, userID string, ttl time.Duration) error
+	GetLinkedIdentity(webID string) (string, error)
+
+	// Pseudonyms (Redis)
+	SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error
+	ResolvePseudonym(pseudonym string) (string, error)
+
+	// Event subscriptions
+	SetEventSubscription(userID string, subscribed bool) error
+	IsEventSubscriber(userID string) (bool, error)
+	GetEventSubscribers() ([]string, error)
+}
+
+// RoomStore stores chat rooms and carries the messages published to them.
+type RoomStore interface {
 	// Room operations
 	SaveRoom(room *models.ChatRoom) error
-	CloseRoom(roomID string) error
+	CloseRoom(roomID, closedBy, reason string) error
+	MoveRoomSeat(roomID, fromUserID, toUserID string) error
+	ClaimIdleRooms(activeBefore time.Time, limit int) ([]string, error)
+	TrackActiveRooms() (int, error)
 	GetActiveRoomIDForUser(userID string) (string, error)
+	GetLastClosedRoomForUser(userID string) (*models.ChatRoom, error)
 	GetActiveRoomIDs() ([]string, error)
 	GetRoomByID(roomID string) (*models.ChatRoom, error)
-	GetUserByID(userID string) (*models.User, error)
+	ListRooms(filter models.RoomFilter) ([]models.RoomListing, error)
 
-	// Message and History operations
+	// Partners (Redis)
+	AddRecentPartners(user1ID, user2ID string, ttl time.Duration) error
+	GetRecentPartners(userID string, since time.Time) (map[string]time.Time, error)
+	AddRematchRequest(fromID, toID string, ttl time.Duration) error
+	TakeRematchRequest(fromID, toID string) (bool, error)
+
+	// Room quality operations
+	GetUnscoredClosedRooms(limit int) ([]models.ChatRoom, error)
+	UpdateRoomQualityScore(roomID string, score int) (bool, error)
+	GetScoredRoomsForUser(userID string, limit int) ([]models.ChatRoom, error)
+
+	// Room archive operations
+	GetArchivableRooms(endedBefore time.Time, limit int) ([]models.ChatRoom, error)
+	MarkRoomArchived(roomID, url string) error
+
+	// Room channels (Redis Pub/Sub)
 	PublishMessage(roomID string, msg models.ChatMessage) error
+	SubscribeToRooms() RoomSubscription
+}
+
+// MessageStore stores the history of chat messages and the messages waiting for offline
+// users.
+type MessageStore interface {
+	// Message and History operations
 	SaveMessage(msg *models.ChatMessage) error
+	SaveMessages(msgs []*models.ChatMessage) error
 	GetChatHistory(roomID string) ([]models.ChatHistory, error)
+	GetMessageCountsBySender(roomID string) (map[string]int64, error)
 	SaveTgMessageID(historyID uint, anonID string, tgMsgID int) error
+	MarkRead(roomID, userID string, historyID uint) (bool, error)
 	FindPartnerTelegramIDForReply(originalHistoryID uint, currentRecipientAnonID string) (*int, error)
 	FindOriginalHistoryIDByTgID(tgMsgID uint) (*uint, error)
 	FindOriginalHistoryIDByTgIDMedia(tgMsgID uint) (*uint, error)
 	FindHistoryByID(id uint) (*models.ChatHistory, error)
+	GetUnhostedMedia(afterID uint, since time.Time, limit int) ([]models.ChatHistory, error)
+	SetHistoryMediaURL(historyID uint, url string) error
+	DeleteHistoryBefore(before time.Time, limit int) (int64, error)
+	SearchHistory(search models.HistorySearch) ([]models.ChatHistory, error)
+
+	// Outbox operations
+	PublishSavedMessage(msg models.ChatMessage) error
+	RelayOutbox(savedBefore time.Time, limit int) (int, error)
 
+	// Offline messages (Redis)
+	QueueOfflineMessage(userID string, msg models.ChatMessage, limit int, ttl time.Duration) (bool, error)
+	TakeOfflineMessages(userID string) ([]models.ChatMessage, error)
+}
+
+// ComplaintStore stores complaints and the bans and abuse signals of moderation.
+type ComplaintStore interface {
 	// Complaint operations
 	SaveComplaint(complaint *models.Complaint) error
+	GetComplaintsByRoom(roomID string) ([]models.Complaint, error)
+	GetComplaintByID(id uint) (*models.Complaint, error)
+	UpdateComplaint(complaint *models.Complaint) error
+	GetComplaintsByReporter(userID string) ([]models.Complaint, error)
+	GetComplaintsBySuspect(userID string) ([]models.Complaint, error)
+	GetComplaintsByRoomAndReportedUser(roomID, userID string) ([]models.Complaint, error)
+	GetComplaintsByReporterSince(userID string, since time.Time) ([]models.Complaint, error)
+
+	// Ban operations
+	IsUserBanned(anonID string) (bool, error)
+	BanUser(ban *models.Ban) error
+	RevertBan(banID uint) (*models.Ban, error)
+	GetBansForUser(userID string) ([]models.Ban, error)
+	SyncEndedBans(endedAfter, endedBefore time.Time) (int, error)
+
+	// Media moderation operations (Redis)
+	AddToMediaBlacklist(kind, value string) error
+	RemoveFromMediaBlacklist(kind, value string) error
+	IsMediaBlacklisted(kind, value string) (bool, error)
+	IncrementMediaStrikes(userID string) (int64, error)
+
+	// Command usage operations (Redis)
+	RecordCommandUsage(userID, command string, at time.Time) (int64, error)
+	GetCommandUsage(command string, at time.Time, limit int) (*models.CommandUsage, error)
+}
 
+// QueueStore keeps the shared search queue and the locks of matching users from it.
+type QueueStore interface {
 	// Search Queue operations
 	AddUserToSearchQueue(userID string) error
+	SaveSearchRequest(req models.SearchRequest) error
+	GetSearchRequest(userID string) (*models.SearchRequest, error)
 	RemoveUserFromSearchQueue(userID string) error
 	GetSearchingUsers() ([]string, error)
-	SubscribeToAllRooms() *redis.PubSub
+	IsUserSearching(userID string) (bool, error)
+	ClaimMatch(user1ID, user2ID string) (bool, error)
+	LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error)
+	UnlockMatch(token string, userIDs []string) error
+	RemoveStaleSearchEntries(enqueuedBefore time.Time, limit int) ([]string, error)
+	GetSearchQueueStatus(userID string) (position, total int, err error)
+}
 
-	// User settings
-	UpdateUserLanguage(telegramID int64, languageCode string) error
+// InstanceStore coordinates the hub instances: which one a client is connected to, which one
+// leads the matcher, and which one runs a job or an announcement that must happen once.
+type InstanceStore interface {
+	// Client registry (Redis)
+	RegisterClientInstance(instanceID string, userIDs []string, ttl time.Duration) error
+	UnregisterClientInstance(instanceID, userID string) error
+	GetClientInstance(userID string) (string, error)
+
+	// Leadership and claims (Redis)
+	AcquireMatcherLeadership(instanceID string, ttl time.Duration) (bool, error)
+	ClaimJobRun(job string, ttl time.Duration) (bool, error)
+	MarkEventAnnounced(eventID string) (bool, error)
 }
 
 // Service provides the implementation of the Storage interface,
 // using a GORM DB client for PostgreSQL and a go-redis client for Redis.
 type Service struct {
-	DB    *gorm.DB
-	Redis *redis.Client
+	DB *gorm.DB
+	// Redis is a client of a single Redis server, of a master managed by Sentinels or of a
+	// Redis Cluster, as made by redis.NewUniversalClient. With a cluster, keys used together in
+	// a script or transaction must share a hash slot, and streams are not supported.
+	Redis redis.UniversalClient
 	Ctx   context.Context
+	// StreamConsumer, if set, is the name of this instance as a reader of room messages, which
+	// are then carried over Redis Streams instead of Pub/Sub (see NewStreamStorageService).
+	StreamConsumer string
+	// UserCacheTTL is how long GetUserByID serves a user from Redis; 0 disables the cache.
+	UserCacheTTL time.Duration
 }
 
 // NewStorageService creates and returns a new Service instance.
 // It requires a GORM DB client and a Redis client as parameters.
-func NewStorageService(db *gorm.DB, rdb *redis.Client) Storage {
+func NewStorageService(db *gorm.DB, rdb redis.UniversalClient) Storage {
 	return &Service{
-		DB:    db,
-		Redis: rdb,
-		Ctx:   context.Background(),
+		DB:           db,
+		Redis:        rdb,
+		Ctx:          context.Background(),
+		UserCacheTTL: DefaultUserCacheTTL,
 	}
 }
 
 // SaveUser saves a user record to the PostgreSQL database.
 func (s *Service) SaveUser(user *models.User) error {
-	return s.DB.Save(user).Error
+	return s.forgetUser(user.ID, s.DB.Save(user).Error)
 }
 
 // SaveRoom saves a chat room record to the PostgreSQL database.
+// An active room starts counting towards the idle timeout (see ClaimIdleRooms) at its start.
 func (s *Service) SaveRoom(room *models.ChatRoom) error {
-	return s.DB.Save(room).Error
+	if err := s.DB.Save(room).Error; err != nil {
+		return err
+	}
+	if room.IsActive {
+		startedAt := room.StartedAt
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		s.touchRoom(room.RoomID, startedAt)
+	}
+	return nil
 }
 
 // CloseRoom marks a chat room as inactive and sets its end time.
-func (s *Service) CloseRoom(roomID string) error {
-	return s.DB.Model(&models.ChatRoom{}).
+// closedBy is the user who ended the chat and reason describes how it ended (e.g., "stop", "next").
+func (s *Service) CloseRoom(roomID, closedBy, reason string) error {
+	err := s.DB.Model(&models.ChatRoom{}).
 		Where("room_id = ?", roomID).
 		Updates(map[string]interface{}{
-			"is_active": false,
-			"ended_at":  gorm.Expr("NOW()"),
+			"is_active":    false,
+			"ended_at":     gorm.Expr("NOW()"),
+			"closed_by":    closedBy,
+			"close_reason": reason,
 		}).Error
+	if err != nil {
+		return err
+	}
+	if err := s.Redis.ZRem(s.Ctx, roomActivityKey, roomID).Err(); err != nil {
+		log.Printf("ERROR: Failed to stop tracking activity of room %s: %v", roomID, err)
+	}
+	return nil
+}
+
+// MoveRoomSeat gives the seat of a user in an active room to another user, who continues the
+// chat in their place.
+func (s *Service) MoveRoomSeat(roomID, fromUserID, toUserID string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, column := range []string{"user1_id", "user2_id"} {
+			err := tx.Model(&models.ChatRoom{}).
+				Where("room_id = ? AND is_active = ? AND "+column+" = ?", roomID, true, fromUserID).
+				Update(column, toUserID).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// touchRoom records activity in a room. Failures are only logged, as they at most let the
+// room be closed as idle early.
+func (s *Service) touchRoom(roomID string, at time.Time) {
+	if err := s.Redis.ZAdd(s.Ctx, roomActivityKey, redis.Z{Score: float64(at.Unix()), Member: roomID}).Err(); err != nil {
+		log.Printf("ERROR: Failed to record activity of room %s: %v", roomID, err)
+	}
+}
+
+// ClaimIdleRooms atomically removes up to limit rooms whose last activity was before the given
+// time from the activity tracking, and returns their IDs. Each room is claimed by one caller
+// only; the rooms may have been closed meanwhile.
+func (s *Service) ClaimIdleRooms(activeBefore time.Time, limit int) ([]string, error) {
+	return removeScoredBeforeScript.Run(s.Ctx, s.Redis, []string{roomActivityKey}, activeBefore.Unix(), limit).StringSlice()
+}
+
+// TrackActiveRooms adds the active rooms that are not tracked yet, e.g. rooms opened before
+// the tracking existed or after Redis lost its data, to the activity tracking of
+// ClaimIdleRooms as of their start. It returns the number of rooms added.
+func (s *Service) TrackActiveRooms() (int, error) {
+	var rooms []models.ChatRoom
+	if err := s.DB.Select("room_id", "started_at").Where("is_active = ?", true).Find(&rooms).Error; err != nil {
+		return 0, err
+	}
+	if len(rooms) == 0 {
+		return 0, nil
+	}
+	members := make([]redis.Z, 0, len(rooms))
+	for _, room := range rooms {
+		startedAt := room.StartedAt
+		if startedAt.IsZero() {
+			startedAt = time.Now()
+		}
+		members = append(members, redis.Z{Score: float64(startedAt.Unix()), Member: room.RoomID})
+	}
+	added, err := s.Redis.ZAddNX(s.Ctx, roomActivityKey, members...).Result()
+	return int(added), err
+}
+
+// AddRecentPartners records two users as each other's recent chat partners. The records are
+// kept in a per-user Redis sorted set scored by time, which expires ttl after the last write.
+func (s *Service) AddRecentPartners(user1ID, user2ID string, ttl time.Duration) error {
+	now := float64(time.Now().Unix())
+	pipe := s.Redis.Pipeline()
+	for _, pair := range [][2]string{{user1ID, user2ID}, {user2ID, user1ID}} {
+		key := "recent_partners:" + pair[0]
+		pipe.ZAdd(s.Ctx, key, redis.Z{Score: now, Member: pair[1]})
+		pipe.ZRemRangeByScore(s.Ctx, key, "-inf", strconv.FormatInt(time.Now().Add(-ttl).Unix(), 10))
+		pipe.Expire(s.Ctx, key, ttl)
+	}
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// AddRematchRequest records that a user wants to chat again with their last partner. The
+// request expires after ttl.
+func (s *Service) AddRematchRequest(fromID, toID string, ttl time.Duration) error {
+	key := "rematch:" + fromID + ":" + toID
+	pipe := s.Redis.Pipeline()
+	pipe.Set(s.Ctx, key, 1, ttl)
+	s.indexUserKey(pipe, fromID, key, ttl)
+	s.indexUserKey(pipe, toID, key, ttl)
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// TakeRematchRequest atomically removes a pending rematch request from one user to another.
+// It returns false if there was no such request or it expired.
+func (s *Service) TakeRematchRequest(fromID, toID string) (bool, error) {
+	err := s.Redis.GetDel(s.Ctx, "rematch:"+fromID+":"+toID).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetRecentPartners returns the users a user chatted with since the given time, mapped to
+// the time their last chat ended.
+func (s *Service) GetRecentPartners(userID string, since time.Time) (map[string]time.Time, error) {
+	entries, err := s.Redis.ZRangeByScoreWithScores(s.Ctx, "recent_partners:"+userID, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	partners := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		if partnerID, ok := entry.Member.(string); ok {
+			partners[partnerID] = time.Unix(int64(entry.Score), 0)
+		}
+	}
+	return partners, nil
 }
 
 // IsUserBanned checks if a user is currently banned by looking up their ID in Redis.
@@ -119,28 +567,233 @@ func (s *Service) IsUserBanned(anonID string) (bool, error) {
 	return true, nil // Banned if the key exists.
 }
 
-// PublishMessage serializes a ChatMessage to JSON and publishes it to a Redis Pub/Sub channel.
-// The channel name is the roomID, allowing subscribers to listen for messages in specific rooms.
+// BanUser records a ban and applies it. A ban that ends sooner than another active ban of
+// the user does not shorten it.
+func (s *Service) BanUser(ban *models.Ban) error {
+	if err := s.DB.Create(ban).Error; err != nil {
+		return err
+	}
+	return s.syncBan(ban.UserID)
+}
+
+// ErrBanReverted is returned by RevertBan for a ban that was already reverted.
+var ErrBanReverted = errors.New("ban already reverted")
+
+// RevertBan reverts a ban by soft-deleting it, and restores the user's ban state from their
+// other bans, exactly as if the ban had never been applied. It returns the reverted ban.
+func (s *Service) RevertBan(banID uint) (*models.Ban, error) {
+	var ban models.Ban
+	if err := s.DB.Unscoped().First(&ban, banID).Error; err != nil {
+		return nil, err
+	}
+	if ban.IsReverted() {
+		return &ban, ErrBanReverted
+	}
+	if err := s.DB.Delete(&ban).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Unscoped().First(&ban, banID).Error; err != nil {
+		return nil, err
+	}
+	return &ban, s.syncBan(ban.UserID)
+}
+
+// GetBansForUser returns the sanction history of a user, including reverted bans, oldest
+// first.
+func (s *Service) GetBansForUser(userID string) ([]models.Ban, error) {
+	var bans []models.Ban
+	err := s.DB.Unscoped().Where("user_id = ?", userID).Order("starts_at, id").Find(&bans).Error
+	return bans, err
+}
+
+// SyncEndedBans mirrors the bans of the users whose bans ended between endedAfter and
+// endedBefore to Redis again, so that the mirror follows their remaining bans even if it was
+// written without an expiry, and returns the number of users synced.
+func (s *Service) SyncEndedBans(endedAfter, endedBefore time.Time) (int, error) {
+	var userIDs []string
+	if err := s.DB.Model(&models.Ban{}).
+		Where("ends_at > ? AND ends_at <= ?", endedAfter, endedBefore).
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	synced := 0
+	for _, userID := range userIDs {
+		if err := s.syncBan(userID); err != nil {
+			log.Printf("ERROR: Failed to sync ended bans of user %s: %v", userID, err)
+			continue
+		}
+		synced++
+	}
+	return synced, nil
+}
+
+// syncBan mirrors the active bans of a user to the Redis key checked by IsUserBanned: it
+// expires with the longest active ban, never if one of them is permanent, and is removed if
+// there is none.
+func (s *Service) syncBan(userID string) error {
+	var bans []models.Ban
+	now := time.Now()
+	if err := s.DB.Where("user_id = ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", userID, now, now).
+		Order("starts_at").Find(&bans).Error; err != nil {
+		return err
+	}
+	key := "ban:" + userID
+	if len(bans) == 0 {
+		return s.Redis.Del(s.Ctx, key).Err()
+	}
+
+	var ttl time.Duration
+	for _, ban := range bans {
+		if ban.EndsAt == nil {
+			ttl = 0
+			break
+		}
+		if remaining := ban.EndsAt.Sub(now); remaining > ttl {
+			ttl = remaining
+		}
+	}
+	return s.Redis.Set(s.Ctx, key, bans[0].StartsAt.Unix(), ttl).Err()
+}
+
+// RoomChannelPrefix namespaces the Redis Pub/Sub channels of chat rooms, so that the Redis
+// instance can be shared with other applications.
+const RoomChannelPrefix = "chat:room:"
+
+// RoomChannel returns the name of the Redis Pub/Sub channel of a room.
+func RoomChannel(roomID string) string {
+	return RoomChannelPrefix + roomID
+}
+
+// PublishMessage serializes a ChatMessage to JSON and publishes it to the Redis Pub/Sub
+// channel of the room (see RoomChannel), allowing subscribers to listen for messages in
+// specific rooms. With a StreamConsumer, it is appended to the stream of the room instead.
 func (s *Service) PublishMessage(roomID string, msg models.ChatMessage) error {
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	return s.Redis.Publish(s.Ctx, roomID, string(msgBytes)).Err()
+	return s.publishPayload(roomID, string(msgBytes))
+}
+
+// publishPayload publishes a JSON-encoded ChatMessage to a room, like PublishMessage.
+func (s *Service) publishPayload(roomID, payload string) error {
+	if s.StreamConsumer != "" {
+		return s.publishToStream(roomID, payload)
+	}
+	return s.Redis.Publish(s.Ctx, RoomChannel(roomID), payload).Err()
+}
+
+// PublishSavedMessage publishes a message saved by SaveMessage, like PublishMessage, and
+// removes it from the outbox. A saved message that is not published this way is published by
+// RelayOutbox.
+func (s *Service) PublishSavedMessage(msg models.ChatMessage) error {
+	if err := s.PublishMessage(msg.RoomID, msg); err != nil {
+		return err
+	}
+	return s.DB.Delete(&models.OutboxMessage{}, msg.ID).Error
+}
+
+// RelayOutbox publishes up to limit messages that were saved before savedBefore but are still
+// in the outbox, oldest first, and removes them from it. It returns the number of messages
+// published, which may be published twice if their removal fails. The messages are locked
+// while they are published, so that instances relaying at the same time skip each other's.
+func (s *Service) RelayOutbox(savedBefore time.Time, limit int) (int, error) {
+	var published []uint
+	var publishErr error
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var pending []models.OutboxMessage
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("created_at < ?", savedBefore).
+			Order("history_id").
+			Limit(limit).
+			Find(&pending).Error; err != nil {
+			return err
+		}
+		for _, entry := range pending {
+			if publishErr = s.publishPayload(entry.RoomID, entry.Payload); publishErr != nil {
+				break
+			}
+			published = append(published, entry.HistoryID)
+		}
+		if len(published) == 0 {
+			return nil
+		}
+		return tx.Delete(&models.OutboxMessage{}, published).Error
+	})
+	if err != nil {
+		return len(published), err
+	}
+	return len(published), publishErr
+}
+
+// RoomSubscription is a Redis Pub/Sub subscription to the channels of chat rooms, which
+// joins and leaves rooms while it is open. It is not safe for concurrent use.
+type RoomSubscription interface {
+	// Join subscribes to the channels of the given rooms.
+	Join(ctx context.Context, roomIDs ...string) error
+	// Leave unsubscribes from the channels of the given rooms.
+	Leave(ctx context.Context, roomIDs ...string) error
+	// Channel returns the channel of the messages published to the joined rooms.
+	Channel() <-chan *redis.Message
+	// Close ends the subscription.
+	Close() error
+}
+
+// SubscribeToRooms opens a subscription that has not joined any room yet. The hub joins
+// the rooms of its clients, so that an instance only receives the messages it relays.
+func (s *Service) SubscribeToRooms() RoomSubscription {
+	if s.StreamConsumer != "" {
+		return s.subscribeToStreams()
+	}
+	return &roomSubscription{pubsub: s.Redis.Subscribe(s.Ctx)}
+}
+
+// roomSubscription is the RoomSubscription of a *redis.PubSub.
+type roomSubscription struct {
+	pubsub *redis.PubSub
 }
 
-// SubscribeToAllRooms creates a Redis Pub/Sub subscription to all channels using a pattern.
-// This is used by the hub to receive messages for all chat rooms.
-func (s *Service) SubscribeToAllRooms() *redis.PubSub {
-	return s.Redis.PSubscribe(s.Ctx, "*")
+func (r *roomSubscription) Join(ctx context.Context, roomIDs ...string) error {
+	if len(roomIDs) == 0 {
+		return nil
+	}
+	return r.pubsub.Subscribe(ctx, roomChannels(roomIDs)...)
+}
+
+func (r *roomSubscription) Leave(ctx context.Context, roomIDs ...string) error {
+	// Without channels, Unsubscribe would leave every room.
+	if len(roomIDs) == 0 {
+		return nil
+	}
+	return r.pubsub.Unsubscribe(ctx, roomChannels(roomIDs)...)
+}
+
+func (r *roomSubscription) Channel() <-chan *redis.Message {
+	return r.pubsub.Channel()
+}
+
+func (r *roomSubscription) Close() error {
+	return r.pubsub.Close()
+}
+
+// roomChannels returns the channels of the given rooms.
+func roomChannels(roomIDs []string) []string {
+	channels := make([]string, len(roomIDs))
+	for i, roomID := range roomIDs {
+		channels[i] = RoomChannel(roomID)
+	}
+	return channels
 }
 
 // SaveComplaint saves a user complaint record to the PostgreSQL database.
 // It sets the default status to "new" if not provided.
 func (s *Service) SaveComplaint(complaint *models.Complaint) error {
 	if complaint.Status == "" {
-		complaint.Status = "new"
+		complaint.Status = models.ComplaintStatusNew
+	}
+	if complaint.Severity == "" {
+		complaint.Severity = models.ComplaintSeverityNormal
 	}
 
 	result := s.DB.Create(complaint)
@@ -151,9 +804,77 @@ func (s *Service) SaveComplaint(complaint *models.Complaint) error {
 	return nil
 }
 
-// SaveMessage persists a ChatMessage to the PostgreSQL database as a ChatHistory record.
-// After saving, it updates the original ChatMessage's ID with the one generated by the database.
-func (s *Service) SaveMessage(msg *models.ChatMessage) error {
+// GetComplaintsByRoom retrieves all complaints filed for a given room.
+func (s *Service) GetComplaintsByRoom(roomID string) ([]models.Complaint, error) {
+	var complaints []models.Complaint
+	if err := s.reads().Where("room_id = ?", roomID).Find(&complaints).Error; err != nil {
+		log.Printf("ERROR: Failed to get complaints for room %s: %v", roomID, err)
+		return nil, err
+	}
+	return complaints, nil
+}
+
+// GetComplaintByID retrieves a complaint by its primary key.
+func (s *Service) GetComplaintByID(id uint) (*models.Complaint, error) {
+	var complaint models.Complaint
+	if err := s.DB.First(&complaint, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("complaint not found")
+		}
+		return nil, err
+	}
+	return &complaint, nil
+}
+
+// GetComplaintsByReporter retrieves all complaints filed by a user, oldest first.
+func (s *Service) GetComplaintsByReporter(userID string) ([]models.Complaint, error) {
+	var complaints []models.Complaint
+	if err := s.reads().Where("reporter_id = ?", userID).Order("created_at").Find(&complaints).Error; err != nil {
+		log.Printf("ERROR: Failed to get complaints filed by %s: %v", userID, err)
+		return nil, err
+	}
+	return complaints, nil
+}
+
+// GetComplaintsBySuspect retrieves all complaints filed against a user, oldest first.
+func (s *Service) GetComplaintsBySuspect(userID string) ([]models.Complaint, error) {
+	var complaints []models.Complaint
+	if err := s.reads().Where("suspect_id = ?", userID).Order("created_at").Find(&complaints).Error; err != nil {
+		log.Printf("ERROR: Failed to get complaints against %s: %v", userID, err)
+		return nil, err
+	}
+	return complaints, nil
+}
+
+// GetComplaintsByRoomAndReportedUser retrieves the complaints filed against a user for a
+// given room, oldest first.
+func (s *Service) GetComplaintsByRoomAndReportedUser(roomID, userID string) ([]models.Complaint, error) {
+	var complaints []models.Complaint
+	if err := s.DB.Where("room_id = ? AND suspect_id = ?", roomID, userID).Order("created_at").Find(&complaints).Error; err != nil {
+		log.Printf("ERROR: Failed to get complaints against %s in room %s: %v", userID, roomID, err)
+		return nil, err
+	}
+	return complaints, nil
+}
+
+// GetComplaintsByReporterSince retrieves the complaints filed by a user at or after since,
+// oldest first.
+func (s *Service) GetComplaintsByReporterSince(userID string, since time.Time) ([]models.Complaint, error) {
+	var complaints []models.Complaint
+	if err := s.DB.Where("reporter_id = ? AND created_at >= ?", userID, since).Order("created_at").Find(&complaints).Error; err != nil {
+		log.Printf("ERROR: Failed to get complaints filed by %s since %v: %v", userID, since, err)
+		return nil, err
+	}
+	return complaints, nil
+}
+
+// UpdateComplaint saves all fields of an existing complaint, e.g. after moderation.
+func (s *Service) UpdateComplaint(complaint *models.Complaint) error {
+	return s.DB.Save(complaint).Error
+}
+
+// historyOf returns the unsaved ChatHistory record of a message.
+func historyOf(msg *models.ChatMessage) models.ChatHistory {
 	history := models.ChatHistory{
 		RoomID:            msg.RoomID,
 		SenderID:          msg.SenderID,
@@ -163,19 +884,90 @@ func (s *Service) SaveMessage(msg *models.ChatMessage) error {
 		ReplyToMessageID:  msg.ReplyToMessageID,
 		TgMessageIDSender: msg.TgMessageIDSender,
 	}
+	if msg.Media != nil {
+		history.Media = *msg.Media
+	}
+	return history
+}
 
-	// Create the record in the DB. GORM will populate history.ID.
-	if err := s.DB.Create(&history).Error; err != nil {
+// SaveMessage persists a ChatMessage to the PostgreSQL database as a ChatHistory record, and
+// adds it to the outbox until it is published with PublishSavedMessage or RelayOutbox.
+// After saving, it updates the original ChatMessage's ID with the one generated by the database
+// and records the message as the last activity of its room.
+func (s *Service) SaveMessage(msg *models.ChatMessage) error {
+	history := historyOf(msg)
+
+	// Create the record in the DB, with the message in the outbox until it is published.
+	// GORM will populate history.ID.
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		saved := *msg
+		saved.ID = history.ID
+		payload, err := json.Marshal(saved)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.OutboxMessage{HistoryID: history.ID, RoomID: msg.RoomID, Payload: string(payload)}).Error
+	})
+	if err != nil {
 		log.Printf("ERROR: Failed to save message for room %s: %v", msg.RoomID, err)
 		return err
 	}
 
 	// Update the ID in the original ChatMessage struct for further use (e.g., publishing).
 	msg.ID = history.ID
+	s.touchRoom(msg.RoomID, history.CreatedAt)
+	return nil
+}
+
+// SaveMessages persists several ChatMessages like SaveMessage, with one bulk insert of their
+// history records and one of their outbox entries, in a single transaction: either all of
+// them are saved, or none is. It sets the IDs of the messages in order.
+func (s *Service) SaveMessages(msgs []*models.ChatMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	history := make([]models.ChatHistory, len(msgs))
+	for i, msg := range msgs {
+		history[i] = historyOf(msg)
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		outbox := make([]models.OutboxMessage, len(msgs))
+		for i, msg := range msgs {
+			saved := *msg
+			saved.ID = history[i].ID
+			payload, err := json.Marshal(saved)
+			if err != nil {
+				return err
+			}
+			outbox[i] = models.OutboxMessage{HistoryID: history[i].ID, RoomID: msg.RoomID, Payload: string(payload)}
+		}
+		return tx.Create(&outbox).Error
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to save a batch of %d messages: %v", len(msgs), err)
+		return err
+	}
+
+	lastActivity := make(map[string]time.Time)
+	for i, msg := range msgs {
+		msg.ID = history[i].ID
+		lastActivity[msg.RoomID] = history[i].CreatedAt
+	}
+	for roomID, at := range lastActivity {
+		s.touchRoom(roomID, at)
+	}
 	return nil
 }
 
 // GetChatHistory retrieves the message history for a given room, ordered by creation time.
+// It reads from the primary, as escalated complaints need the messages sent right before them.
 func (s *Service) GetChatHistory(roomID string) ([]models.ChatHistory, error) {
 	var history []models.ChatHistory
 	err := s.DB.Where("room_id = ?", roomID).Order("created_at asc").Find(&history).Error
@@ -208,6 +1000,15 @@ func (s *Service) SaveTgMessageID(historyID uint, anonID string, tgMsgID int) er
 	return s.DB.Save(&history).Error
 }
 
+// MarkRead records that a participant of a room read the messages up to the given history
+// entry. It reports whether this moved their read position forward, so that an out-of-order
+// or repeated receipt is not relayed twice.
+func (s *Service) MarkRead(roomID, userID string, historyID uint) (bool, error) {
+	moved, err := markReadScript.Run(s.Ctx, s.Redis, []string{"room_read:" + roomID},
+		userID, historyID, int(readReceiptTTL.Seconds())).Int()
+	return moved == 1, err
+}
+
 // FindOriginalHistoryIDByTgID finds the internal message ID (ChatHistory.ID)
 // corresponding to a given Telegram message ID. This is crucial for handling replies.
 func (s *Service) FindOriginalHistoryIDByTgID(tgMsgID uint) (*uint, error) {
@@ -292,6 +1093,64 @@ func (s *Service) FindHistoryByID(id uint) (*models.ChatHistory, error) {
 	return &history, nil
 }
 
+// mediaTypes are the message types whose Content is the file ID of a media file.
+var mediaTypes = []string{"photo", "video", "animation", "sticker", "voice", "video_note"}
+
+// GetUnhostedMedia returns up to limit media history entries with an ID above afterID,
+// sent since the given time, that have not been re-hosted yet, in ID order.
+func (s *Service) GetUnhostedMedia(afterID uint, since time.Time, limit int) ([]models.ChatHistory, error) {
+	var history []models.ChatHistory
+	err := s.DB.Where("id > ? AND created_at >= ? AND type IN ? AND (media_url IS NULL OR media_url = '')", afterID, since, mediaTypes).
+		Order("id asc").
+		Limit(limit).
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// historySearchDocument is the text of a history entry that SearchHistory matches: the
+// content of text messages and the caption of media. The "simple" configuration splits words
+// without stemming them, as users write in several languages. The GIN index of migration
+// 0002_history_search_index is built on the same expression.
+const historySearchDocument = `to_tsvector('simple', CASE WHEN type = 'text' THEN content ELSE COALESCE(metadata, '') END)`
+
+// SearchHistory returns the history entries whose text matches the keywords of a search,
+// within its scopes, newest first.
+func (s *Service) SearchHistory(search models.HistorySearch) ([]models.ChatHistory, error) {
+	query := s.reads().Where(historySearchDocument+" @@ websearch_to_tsquery('simple', ?)", search.Query)
+	if search.RoomID != "" {
+		query = query.Where("room_id = ?", search.RoomID)
+	}
+	if search.SenderID != "" {
+		query = query.Where("sender_id = ?", search.SenderID)
+	}
+	if !search.From.IsZero() {
+		query = query.Where("created_at >= ?", search.From)
+	}
+	if !search.To.IsZero() {
+		query = query.Where("created_at < ?", search.To)
+	}
+	var history []models.ChatHistory
+	err := query.Order("created_at desc, id desc").Limit(search.Limit).Find(&history).Error
+	return history, err
+}
+
+// DeleteHistoryBefore permanently deletes up to limit history entries sent before the given
+// time, oldest first, and returns the number of entries deleted.
+func (s *Service) DeleteHistoryBefore(before time.Time, limit int) (int64, error) {
+	oldest := s.DB.Unscoped().Model(&models.ChatHistory{}).Select("id").
+		Where("created_at < ?", before).Order("id").Limit(limit)
+	result := s.DB.Unscoped().Where("id IN (?)", oldest).Delete(&models.ChatHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// SetHistoryMediaURL records the URL of the re-hosted copy of the media of a history entry.
+func (s *Service) SetHistoryMediaURL(historyID uint, url string) error {
+	return s.DB.Model(&models.ChatHistory{}).Where("id = ?", historyID).Update("media_url", url).Error
+}
+
 // GetActiveRoomIDs returns a slice of all currently active room IDs.
 func (s *Service) GetActiveRoomIDs() ([]string, error) {
 	var roomIDs []string
@@ -322,6 +1181,23 @@ func (s *Service) GetActiveRoomIDForUser(userID string) (string, error) {
 	return room.RoomID, nil
 }
 
+// GetLastClosedRoomForUser returns the user's most recently closed chat room, or nil if the
+// user never finished a chat.
+func (s *Service) GetLastClosedRoomForUser(userID string) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	err := s.DB.Where("is_active = ?", false).
+		Where("user1_id = ? OR user2_id = ?", userID, userID).
+		Order("ended_at DESC").
+		First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
 // GetRoomByID retrieves a chat room by its unique RoomID.
 func (s *Service) GetRoomByID(roomID string) (*models.ChatRoom, error) {
 	var room models.ChatRoom
@@ -358,9 +1234,15 @@ func (s *Service) SaveUserIfNotExists(telegramID int64) (*models.User, error) {
 
 // UpdateUserLanguage updates the user's language preference.
 func (s *Service) UpdateUserLanguage(telegramID int64, languageCode string) error {
-	return s.DB.Model(&models.User{}).
+	var users []models.User
+	err := s.DB.Model(&users).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
 		Where("telegram_id = ?", telegramID).
 		Update("language", languageCode).Error
+	for _, user := range users {
+		err = s.forgetUser(user.ID, err)
+	}
+	return err
 }
 
 // GetUserByTelegramID retrieves a user by their Telegram ID.
@@ -375,30 +1257,145 @@ func (s *Service) GetUserByTelegramID(telegramID int64) (*models.User, error) {
 	return &user, nil
 }
 
-// AddUserToSearchQueue adds a user's ID to the Redis set representing the matchmaking queue.
+// AddUserToSearchQueue adds a user's ID to the Redis sorted set representing the matchmaking queue.
+// The score is the enqueue time, so a user who is already queued keeps their original place.
+// A search request saved for the user before is dropped.
 func (s *Service) AddUserToSearchQueue(userID string) error {
-	return s.Redis.SAdd(s.Ctx, "search_queue", userID).Err()
+	pipe := s.Redis.Pipeline()
+	pipe.ZAddNX(s.Ctx, searchQueueKey, redis.Z{Score: float64(time.Now().UnixNano()), Member: userID})
+	pipe.Del(s.Ctx, searchRequestKeyPrefix+userID)
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// SaveSearchRequest adds a user to the matchmaking queue like AddUserToSearchQueue, and keeps
+// their search request, criteria included, for whoever restores the queue.
+func (s *Service) SaveSearchRequest(req models.SearchRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	pipe := s.Redis.Pipeline()
+	pipe.ZAddNX(s.Ctx, searchQueueKey, redis.Z{Score: float64(time.Now().UnixNano()), Member: req.UserID})
+	pipe.Set(s.Ctx, searchRequestKeyPrefix+req.UserID, data, searchRequestTTL)
+	_, err = pipe.Exec(s.Ctx)
+	return err
+}
+
+// GetSearchRequest returns the search request saved for a queued user with SaveSearchRequest,
+// or nil if there is none.
+func (s *Service) GetSearchRequest(userID string) (*models.SearchRequest, error) {
+	data, err := s.Redis.Get(s.Ctx, searchRequestKeyPrefix+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var req models.SearchRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
 }
 
-// RemoveUserFromSearchQueue removes a user's ID from the matchmaking queue in Redis.
+// RemoveUserFromSearchQueue removes a user's ID, and their saved search request, from the
+// matchmaking queue in Redis.
 func (s *Service) RemoveUserFromSearchQueue(userID string) error {
-	return s.Redis.SRem(s.Ctx, "search_queue", userID).Err()
+	pipe := s.Redis.Pipeline()
+	pipe.ZRem(s.Ctx, searchQueueKey, userID)
+	pipe.Del(s.Ctx, searchRequestKeyPrefix+userID)
+	_, err := pipe.Exec(s.Ctx)
+	return err
 }
 
-// GetSearchingUsers returns a slice of all user IDs currently in the matchmaking queue.
+// IsUserSearching checks whether a user is currently in the matchmaking queue.
+func (s *Service) IsUserSearching(userID string) (bool, error) {
+	_, err := s.Redis.ZScore(s.Ctx, searchQueueKey, userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClaimMatch atomically takes two users out of the shared matchmaking queue before they are
+// paired. It returns false if either user was already taken (e.g., matched by another
+// instance) or left the queue, in which case nothing is removed.
+func (s *Service) ClaimMatch(user1ID, user2ID string) (bool, error) {
+	claimed, err := claimMatchScript.Run(s.Ctx, s.Redis, []string{searchQueueKey}, user1ID, user2ID).Int()
+	return claimed == 1, err
+}
+
+// LockMatch atomically locks users while a room is opened for them, with a token identifying
+// the holder. It returns false, locking none of them, if one is locked already. Locks expire
+// after ttl in case their holder dies.
+func (s *Service) LockMatch(token string, userIDs []string, ttl time.Duration) (bool, error) {
+	locked, err := lockKeysScript.Run(s.Ctx, s.Redis, matchLockKeys(userIDs), token, ttl.Milliseconds()).Int()
+	return locked == 1, err
+}
+
+// UnlockMatch releases the locks of users taken with LockMatch, unless they expired and were
+// taken by another holder meanwhile.
+func (s *Service) UnlockMatch(token string, userIDs []string) error {
+	return unlockKeysScript.Run(s.Ctx, s.Redis, matchLockKeys(userIDs), token).Err()
+}
+
+// matchLockKeys returns the keys of the match locks of users.
+func matchLockKeys(userIDs []string) []string {
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = matchLockKeyPrefix + userID
+	}
+	return keys
+}
+
+// RemoveStaleSearchEntries atomically removes up to limit users who joined the matchmaking
+// queue before the given time, and returns their IDs.
+func (s *Service) RemoveStaleSearchEntries(enqueuedBefore time.Time, limit int) ([]string, error) {
+	return removeScoredBeforeScript.Run(s.Ctx, s.Redis, []string{searchQueueKey}, enqueuedBefore.UnixNano(), limit).StringSlice()
+}
+
+// GetSearchQueueStatus returns the 1-based position of a user in the matchmaking queue and the
+// number of searching users. The position is 0 if the user is not searching.
+func (s *Service) GetSearchQueueStatus(userID string) (position, total int, err error) {
+	pipe := s.Redis.Pipeline()
+	rank := pipe.ZRank(s.Ctx, searchQueueKey, userID)
+	card := pipe.ZCard(s.Ctx, searchQueueKey)
+	if _, err := pipe.Exec(s.Ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, err
+	}
+	if r, err := rank.Result(); err == nil {
+		position = int(r) + 1
+	}
+	return position, int(card.Val()), nil
+}
+
+// AcquireMatcherLeadership takes or renews the matcher leader lease for the given instance.
+// It returns true if the instance is the leader for the next ttl.
+func (s *Service) AcquireMatcherLeadership(instanceID string, ttl time.Duration) (bool, error) {
+	acquired, err := acquireLeadershipScript.Run(s.Ctx, s.Redis, []string{matcherLeaderKey}, instanceID, ttl.Milliseconds()).Int()
+	return acquired == 1, err
+}
+
+// GetSearchingUsers returns a slice of all user IDs currently in the matchmaking queue,
+// ordered by the time they joined it.
 func (s *Service) GetSearchingUsers() ([]string, error) {
-	return s.Redis.SMembers(s.Ctx, "search_queue").Result()
+	return s.Redis.ZRange(s.Ctx, searchQueueKey, 0, -1).Result()
 }
 
 // UpdateUserMediaSpoiler updates the user's preference for default media spoiler flag.
 func (s *Service) UpdateUserMediaSpoiler(userID string, value bool) error {
-	return s.DB.Model(&models.User{}).
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
 		Where("id = ?", userID).
-		Update("default_media_spoiler", value).Error
+		Update("default_media_spoiler", value).Error)
 }
 
-// GetUserByID retrieves a user by their internal ID.
+// GetUserByID retrieves a user by their internal ID. Users are cached in Redis for
+// UserCacheTTL (see user_cache.go), as every relayed message needs its recipient.
 func (s *Service) GetUserByID(userID string) (*models.User, error) {
+	if user, ok := s.cachedUser(userID); ok {
+		return user, nil
+	}
 	var user models.User
 	if err := s.DB.Where("id = ?", userID).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -406,28 +1403,181 @@ func (s *Service) GetUserByID(userID string) (*models.User, error) {
 		}
 		return nil, err
 	}
+	s.cacheUser(&user)
 	return &user, nil
 }
 
+// GetUsersByIDs retrieves the users with the given internal IDs in one query. Users that do
+// not exist are left out, and the order is undefined.
+func (s *Service) GetUsersByIDs(userIDs []string) ([]models.User, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	var users []models.User
+	if err := s.DB.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // UpdateUserAge updates the user's age.
 func (s *Service) UpdateUserAge(userID string, age int) error {
-	return s.DB.Model(&models.User{}).
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
 		Where("id = ?", userID).
-		Update("age", age).Error
+		Update("age", age).Error)
 }
 
 // UpdateUserGender updates the user's gender.
 func (s *Service) UpdateUserGender(userID string, gender string) error {
-	return s.DB.Model(&models.User{}).
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
 		Where("id = ?", userID).
-		Update("gender", gender).Error
+		Update("gender", gender).Error)
 }
 
 // UpdateUserInterests updates the user's interests.
 func (s *Service) UpdateUserInterests(userID string, interests []string) error {
-	return s.DB.Model(&models.User{}).
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("interests", pq.StringArray(interests)).Error)
+}
+
+// SetUserBotBlocked marks a user as inactive because they blocked the bot, or clears the mark
+// once they interact with the bot again.
+func (s *Service) SetUserBotBlocked(userID string, blocked bool) error {
+	var blockedAt *time.Time
+	if blocked {
+		now := time.Now()
+		blockedAt = &now
+	}
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("bot_blocked_at", blockedAt).Error)
+}
+
+// UpdateUserSearchPreferences updates the user's preferred partner gender and age range.
+func (s *Service) UpdateUserSearchPreferences(userID string, gender string, ageMin, ageMax int) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"preferred_gender":  gender,
+			"preferred_age_min": ageMin,
+			"preferred_age_max": ageMax,
+		}).Error)
+}
+
+// UpdateUserAutoRequeue updates the user's preference for searching again when their partner
+// leaves with /next.
+func (s *Service) UpdateUserAutoRequeue(userID string, value bool) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("auto_requeue", value).Error)
+}
+
+// UpdateUserRegion updates the user's coarse region. An empty region clears it.
+func (s *Service) UpdateUserRegion(userID string, region string) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("region", region).Error)
+}
+
+// UpdateUserNearTimezone updates the user's preference for partners near their timezone.
+func (s *Service) UpdateUserNearTimezone(userID string, value bool) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("prefer_near_timezone", value).Error)
+}
+
+// UpdateUserReadReceipts updates the user's opt-in to read receipts.
+func (s *Service) UpdateUserReadReceipts(userID string, value bool) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("read_receipts", value).Error)
+}
+
+// UpdateUserHideTyping updates whether the user's typing indicators are hidden from partners.
+func (s *Service) UpdateUserHideTyping(userID string, value bool) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("hide_typing", value).Error)
+}
+
+// UpdateUserHidePresence updates whether the user's online status is hidden from partners.
+func (s *Service) UpdateUserHidePresence(userID string, value bool) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("hide_presence", value).Error)
+}
+
+// SetUserPremium sets the end of the user's premium entitlement. A nil until revokes it.
+func (s *Service) SetUserPremium(userID string, until *time.Time) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("premium_until", until).Error)
+}
+
+// BlockUser adds blockedID to the user's block list. Blocking a user twice has no effect.
+func (s *Service) BlockUser(userID, blockedID string) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("NOT (? = ANY(COALESCE(blocked_users, '{}')))", blockedID).
+		Update("blocked_users", gorm.Expr("array_append(COALESCE(blocked_users, '{}'), ?)", blockedID)).Error)
+}
+
+// UnblockUser removes blockedID from the user's block list.
+func (s *Service) UnblockUser(userID, blockedID string) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
 		Where("id = ?", userID).
-		Update("interests", pq.StringArray(interests)).Error
+		Update("blocked_users", gorm.Expr("array_remove(blocked_users, ?)", blockedID)).Error)
+}
+
+// SetUserLabFeature opts the user into an experimental feature, or out of it. Opting in
+// twice has no effect.
+func (s *Service) SetUserLabFeature(userID, feature string, enabled bool) error {
+	if !enabled {
+		return s.forgetUser(userID, s.DB.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("lab_features", gorm.Expr("array_remove(lab_features, ?)", feature)).Error)
+	}
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Where("NOT (? = ANY(COALESCE(lab_features, '{}')))", feature).
+		Update("lab_features", gorm.Expr("array_append(COALESCE(lab_features, '{}'), ?)", feature)).Error)
+}
+
+// GetIncompleteProfiles returns a page of reachable Telegram users whose age, gender or
+// interests are not filled in, ordered by creation time.
+func (s *Service) GetIncompleteProfiles(offset, limit int) ([]models.User, error) {
+	var users []models.User
+	err := s.DB.
+		Where("telegram_id <> 0 AND bot_blocked_at IS NULL").
+		Where("age = 0 OR gender = '' OR gender IS NULL OR interests IS NULL OR cardinality(interests) = 0").
+		Order("created_at").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get incomplete profiles: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetBroadcastRecipients returns a page of reachable Telegram users, ordered by ID, whose ID
+// is greater than afterID. Paging by ID keeps pages stable while users are deactivated during
+// a broadcast.
+func (s *Service) GetBroadcastRecipients(afterID string, limit int) ([]models.User, error) {
+	var users []models.User
+	err := s.DB.
+		Where("telegram_id <> 0 AND bot_blocked_at IS NULL").
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get broadcast recipients: %v", err)
+		return nil, err
+	}
+	return users, nil
 }
 
 // SetUserState sets the user's current state in Redis.
@@ -458,7 +1608,11 @@ func (s *Service) ClearUserState(userID string) error {
 // SetUserAttribute sets a generic attribute for a user in Redis.
 func (s *Service) SetUserAttribute(userID string, key string, value string) error {
 	redisKey := "user_attr:" + userID + ":" + key
-	return s.Redis.Set(s.Ctx, redisKey, value, 0).Err()
+	pipe := s.Redis.Pipeline()
+	pipe.Set(s.Ctx, redisKey, value, 0)
+	s.indexUserKey(pipe, userID, redisKey, 0)
+	_, err := pipe.Exec(s.Ctx)
+	return err
 }
 
 // GetUserAttribute retrieves a generic attribute for a user from Redis.
@@ -477,5 +1631,385 @@ func (s *Service) GetUserAttribute(userID string, key string) (string, error) {
 // DeleteUserAttribute removes a generic attribute for a user from Redis.
 func (s *Service) DeleteUserAttribute(userID string, key string) error {
 	redisKey := "user_attr:" + userID + ":" + key
-	return s.Redis.Del(s.Ctx, redisKey).Err()
+	pipe := s.Redis.Pipeline()
+	pipe.Del(s.Ctx, redisKey)
+	pipe.SRem(s.Ctx, userKeysKeyPrefix+userID, redisKey)
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// GetUnscoredClosedRooms returns up to limit closed rooms that do not have a quality score yet,
+// oldest first.
+func (s *Service) GetUnscoredClosedRooms(limit int) ([]models.ChatRoom, error) {
+	var rooms []models.ChatRoom
+	err := s.DB.Where("is_active = ? AND quality_score IS NULL", false).
+		Order("ended_at asc").
+		Limit(limit).
+		Find(&rooms).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get unscored closed rooms: %v", err)
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// GetMessageCountsBySender returns the number of messages each participant sent in a room,
+// keyed by sender ID.
+func (s *Service) GetMessageCountsBySender(roomID string) (map[string]int64, error) {
+	var rows []struct {
+		SenderID string
+		Count    int64
+	}
+	err := s.reads().Model(&models.ChatHistory{}).
+		Select("sender_id, count(*) as count").
+		Where("room_id = ?", roomID).
+		Group("sender_id").
+		Scan(&rows).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to count messages for room %s: %v", roomID, err)
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SenderID] = row.Count
+	}
+	return counts, nil
+}
+
+// UpdateRoomQualityScore stores the computed quality score of a room, unless it already has
+// one. It reports whether the score was stored, so that the reputation adjustments of a room
+// scored by several instances at once are applied only once.
+func (s *Service) UpdateRoomQualityScore(roomID string, score int) (bool, error) {
+	result := s.DB.Model(&models.ChatRoom{}).
+		Where("room_id = ? AND quality_score IS NULL", roomID).
+		Update("quality_score", score)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetScoredRoomsForUser returns up to limit of the user's closed rooms that have a quality
+// score, most recently ended first.
+func (s *Service) GetScoredRoomsForUser(userID string, limit int) ([]models.ChatRoom, error) {
+	var rooms []models.ChatRoom
+	err := s.reads().Where("is_active = ? AND quality_score IS NOT NULL", false).
+		Where("user1_id = ? OR user2_id = ?", userID, userID).
+		Order("ended_at DESC").
+		Limit(limit).
+		Find(&rooms).Error
+	if err != nil {
+		log.Printf("ERROR: Failed to get scored rooms of user %s: %v", userID, err)
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// AdjustUserRating atomically adds delta (which may be negative) to the user's rating score.
+func (s *Service) AdjustUserRating(userID string, delta int) error {
+	return s.forgetUser(userID, s.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("rating_score", gorm.Expr("rating_score + ?", delta)).Error)
+}
+
+// RecoverUserRatings raises the negative ratings of the users who were not reported since
+// quietSince by step, up to 0, and returns the number of users whose rating was raised.
+func (s *Service) RecoverUserRatings(step int, quietSince time.Time) (int64, error) {
+	reported := s.DB.Model(&models.Complaint{}).Select("suspect_id").Where("created_at >= ?", quietSince)
+	var users []models.User
+	result := s.DB.Model(&users).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("rating_score < 0 AND id NOT IN (?)", reported).
+		Update("rating_score", gorm.Expr("LEAST(rating_score + ?, 0)", step))
+	for _, user := range users {
+		s.forgetUser(user.ID, nil)
+	}
+	return result.RowsAffected, result.Error
+}
+
+// mediaStrikesTTL is how long blacklisted-media strikes are remembered for a user.
+const mediaStrikesTTL = 24 * time.Hour
+
+// AddToMediaBlacklist adds a sticker set name or file unique ID to the moderation blacklist.
+func (s *Service) AddToMediaBlacklist(kind, value string) error {
+	return s.Redis.SAdd(s.Ctx, "media_blacklist:"+kind, value).Err()
+}
+
+// RemoveFromMediaBlacklist removes a sticker set name or file unique ID from the moderation blacklist.
+func (s *Service) RemoveFromMediaBlacklist(kind, value string) error {
+	return s.Redis.SRem(s.Ctx, "media_blacklist:"+kind, value).Err()
+}
+
+// IsMediaBlacklisted checks whether a sticker set name or file unique ID is blacklisted.
+func (s *Service) IsMediaBlacklisted(kind, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return s.Redis.SIsMember(s.Ctx, "media_blacklist:"+kind, value).Result()
+}
+
+// IncrementMediaStrikes records an attempt to send blacklisted media and returns the number
+// of attempts the user made within the last 24 hours.
+func (s *Service) IncrementMediaStrikes(userID string) (int64, error) {
+	key := "media_strikes:" + userID
+	count, err := s.Redis.Incr(s.Ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		s.Redis.Expire(s.Ctx, key, mediaStrikesTTL)
+	}
+	return count, nil
+}
+
+// commandUsageTTL is how long the hourly command usage counters are kept.
+const commandUsageTTL = 48 * time.Hour
+
+// commandUsageKeys returns the key of the sorted set counting the invocations of a command
+// per user, and of the hash counting the invocations of all commands, in the hour of at.
+func commandUsageKeys(command string, at time.Time) (perUser, totals string) {
+	hour := strconv.FormatInt(at.Truncate(time.Hour).Unix(), 10)
+	return "command_usage:" + command + ":" + hour, "command_usage_totals:" + hour
+}
+
+// RecordCommandUsage counts an invocation of a command by a user in the hour of at, and
+// returns the number of times the user issued it in that hour.
+func (s *Service) RecordCommandUsage(userID, command string, at time.Time) (int64, error) {
+	perUser, totals := commandUsageKeys(command, at)
+	pipe := s.Redis.Pipeline()
+	count := pipe.ZIncrBy(s.Ctx, perUser, 1, userID)
+	pipe.HIncrBy(s.Ctx, totals, command, 1)
+	pipe.Expire(s.Ctx, perUser, commandUsageTTL)
+	pipe.Expire(s.Ctx, totals, commandUsageTTL)
+	if _, err := pipe.Exec(s.Ctx); err != nil {
+		return 0, err
+	}
+	return int64(count.Val()), nil
+}
+
+// GetCommandUsage returns the number of invocations of a command in the hour of at, and the
+// limit users who issued it most often.
+func (s *Service) GetCommandUsage(command string, at time.Time, limit int) (*models.CommandUsage, error) {
+	perUser, totals := commandUsageKeys(command, at)
+	pipe := s.Redis.Pipeline()
+	top := pipe.ZRevRangeWithScores(s.Ctx, perUser, 0, int64(limit)-1)
+	total := pipe.HGet(s.Ctx, totals, command)
+	if _, err := pipe.Exec(s.Ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	usage := &models.CommandUsage{Command: command, Hour: at.Truncate(time.Hour)}
+	usage.Total, _ = total.Int64()
+	for _, z := range top.Val() {
+		userID, _ := z.Member.(string)
+		usage.TopUsers = append(usage.TopUsers, models.CommandUserCount{UserID: userID, Count: int64(z.Score)})
+	}
+	return usage, nil
+}
+
+// eventSubscribersKey is the Redis set of users who opted in to event announcements.
+const eventSubscribersKey = "event_subscribers"
+
+// SetEventSubscription opts a user in to or out of themed event announcements.
+func (s *Service) SetEventSubscription(userID string, subscribed bool) error {
+	if subscribed {
+		return s.Redis.SAdd(s.Ctx, eventSubscribersKey, userID).Err()
+	}
+	return s.Redis.SRem(s.Ctx, eventSubscribersKey, userID).Err()
+}
+
+// IsEventSubscriber checks whether a user opted in to themed event announcements.
+func (s *Service) IsEventSubscriber(userID string) (bool, error) {
+	return s.Redis.SIsMember(s.Ctx, eventSubscribersKey, userID).Result()
+}
+
+// GetEventSubscribers returns the IDs of all users who opted in to themed event announcements.
+func (s *Service) GetEventSubscribers() ([]string, error) {
+	return s.Redis.SMembers(s.Ctx, eventSubscribersKey).Result()
+}
+
+// MarkEventAnnounced records that an event has been announced. It returns true only for
+// the first call per event, so each event is announced once even across restarts.
+func (s *Service) MarkEventAnnounced(eventID string) (bool, error) {
+	added, err := s.Redis.SAdd(s.Ctx, "events_announced", eventID).Result()
+	return added == 1, err
+}
+
+// RefreshPresence marks users as online for ttl.
+func (s *Service) RefreshPresence(userIDs []string, ttl time.Duration) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	pipe := s.Redis.Pipeline()
+	for _, userID := range userIDs {
+		pipe.Set(s.Ctx, presenceKeyPrefix+userID, 1, ttl)
+	}
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// RegisterClientInstance records in the client registry that an instance holds the clients of
+// users, for ttl.
+func (s *Service) RegisterClientInstance(instanceID string, userIDs []string, ttl time.Duration) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	pipe := s.Redis.Pipeline()
+	for _, userID := range userIDs {
+		pipe.Set(s.Ctx, clientInstanceKeyPrefix+userID, instanceID, ttl)
+	}
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// UnregisterClientInstance removes the registry entry of a user, unless another instance
+// registered the user's client since.
+func (s *Service) UnregisterClientInstance(instanceID, userID string) error {
+	return deleteIfEqualScript.Run(s.Ctx, s.Redis, []string{clientInstanceKeyPrefix + userID}, instanceID).Err()
+}
+
+// GetClientInstance returns the ID of the instance holding the client of a user, or "" if
+// no instance does.
+func (s *Service) GetClientInstance(userID string) (string, error) {
+	instanceID, err := s.Redis.Get(s.Ctx, clientInstanceKeyPrefix+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return instanceID, err
+}
+
+// QueueOfflineMessage keeps a saved message for a user who is offline, until they take it
+// with TakeOfflineMessages or ttl passes after the last message was queued. A message is kept
+// once, even if several instances queue it. It reports false if limit messages wait already.
+func (s *Service) QueueOfflineMessage(userID string, msg models.ChatMessage, limit int, ttl time.Duration) (bool, error) {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return false, err
+	}
+	queued, err := queueOfflineScript.Run(s.Ctx, s.Redis, []string{offlineKeyPrefix + userID},
+		msg.ID, string(msgBytes), limit, int(ttl.Seconds())).Int()
+	return queued == 1, err
+}
+
+// TakeOfflineMessages removes the messages queued for a user with QueueOfflineMessage and
+// returns them in the order they were sent.
+func (s *Service) TakeOfflineMessages(userID string) ([]models.ChatMessage, error) {
+	key := offlineKeyPrefix + userID
+	var fields *redis.MapStringStringCmd
+	if _, err := s.Redis.TxPipelined(s.Ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(s.Ctx, key)
+		pipe.Del(s.Ctx, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.ChatMessage, 0, len(fields.Val()))
+	for _, raw := range fields.Val() {
+		var msg models.ChatMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			log.Printf("ERROR: Failed to decode offline message of user %s: %v", userID, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// ClaimJobRun claims a run of a scheduled job for the caller, unless another caller claimed
+// one within ttl, and reports whether it did.
+func (s *Service) ClaimJobRun(job string, ttl time.Duration) (bool, error) {
+	return s.Redis.SetNX(s.Ctx, jobRunKeyPrefix+job, time.Now().Unix(), ttl).Result()
+}
+
+// CreateLinkCode creates a one-time code that links the web identity userID to whoever
+// redeems it with TakeLinkCode before ttl passes.
+func (s *Service) CreateLinkCode(userID string, ttl time.Duration) (string, error) {
+	for {
+		code, err := randomLinkCode()
+		if err != nil {
+			return "", err
+		}
+		created, err := s.Redis.SetNX(s.Ctx, linkCodeKeyPrefix+code, userID, ttl).Result()
+		if err != nil {
+			return "", err
+		}
+		if created {
+			pipe := s.Redis.Pipeline()
+			s.indexUserKey(pipe, userID, linkCodeKeyPrefix+code, ttl)
+			_, err := pipe.Exec(s.Ctx)
+			return code, err
+		}
+	}
+}
+
+// randomLinkCode returns a random code of linkCodeLength characters of linkCodeAlphabet.
+func randomLinkCode() (string, error) {
+	buf := make([]byte, linkCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = linkCodeAlphabet[int(b)%len(linkCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// TakeLinkCode redeems a code created with CreateLinkCode and returns the web identity it
+// links, or "" if the code does not exist or expired. A code can be taken once.
+func (s *Service) TakeLinkCode(code string) (string, error) {
+	webID, err := s.Redis.GetDel(s.Ctx, linkCodeKeyPrefix+code).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return webID, err
+}
+
+// LinkIdentity records that the web identity webID acts as userID until ttl passes.
+func (s *Service) LinkIdentity(webID, userID string, ttl time.Duration) error {
+	pipe := s.Redis.Pipeline()
+	pipe.Set(s.Ctx, identityLinkKeyPrefix+webID, userID, ttl)
+	s.indexUserKey(pipe, userID, identityLinkKeyPrefix+webID, ttl)
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// GetLinkedIdentity returns the user the web identity webID was linked to with LinkIdentity,
+// or "" if it is not linked.
+func (s *Service) GetLinkedIdentity(webID string) (string, error) {
+	userID, err := s.Redis.Get(s.Ctx, identityLinkKeyPrefix+webID).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return userID, err
+}
+
+// SavePseudonyms remembers the user IDs of pseudonyms handed out in an export for ttl.
+func (s *Service) SavePseudonyms(pseudonyms map[string]string, ttl time.Duration) error {
+	if len(pseudonyms) == 0 {
+		return nil
+	}
+	pipe := s.Redis.Pipeline()
+	for pseudonym, userID := range pseudonyms {
+		pipe.Set(s.Ctx, pseudonymKeyPrefix+pseudonym, userID, ttl)
+		s.indexUserKey(pipe, userID, pseudonymKeyPrefix+pseudonym, ttl)
+	}
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// ResolvePseudonym returns the user ID of a pseudonym saved with SavePseudonyms, or "" if it
+// is unknown or expired.
+func (s *Service) ResolvePseudonym(pseudonym string) (string, error) {
+	userID, err := s.Redis.Get(s.Ctx, pseudonymKeyPrefix+pseudonym).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return userID, err
+}
+
+// IsUserOnline reports whether a user was marked online by an instance and the mark has not
+// expired yet.
+func (s *Service) IsUserOnline(userID string) (bool, error) {
+	n, err := s.Redis.Exists(s.Ctx, presenceKeyPrefix+userID).Result()
+	return n > 0, err
 }
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// roomStreamMaxLen is about how many messages the stream of a room keeps.
+	roomStreamMaxLen = 1000
+	// roomStreamTTL is how long the stream of a room is kept after its last message, and the
+	// cursors of a consumer after its last read.
+	roomStreamTTL = 24 * time.Hour
+	// streamReadBlock is how long a read waits for new messages. Rooms joined meanwhile are
+	// read from the next read on.
+	streamReadBlock = time.Second
+	// streamReadCount is the maximum number of messages read per room and read.
+	streamReadCount = 100
+	// streamPayloadField is the stream entry field holding the JSON-encoded message.
+	streamPayloadField = "payload"
+	// streamCursorKeyPrefix prefixes the hash of the last read stream ID of each room, per
+	// consumer.
+	streamCursorKeyPrefix = "chat:stream_cursor:"
+)
+
+// NewStreamStorageService is NewStorageService, but carries room messages over Redis
+// Streams instead of Pub/Sub. Messages published while no instance reads a room stay in its
+// stream, and the consumer, which must keep its name across restarts, resumes each room it
+// joins again from the last message it read there.
+func NewStreamStorageService(db *gorm.DB, rdb redis.UniversalClient, consumer string) Storage {
+	return &Service{
+		DB:             db,
+		Redis:          rdb,
+		Ctx:            context.Background(),
+		StreamConsumer: consumer,
+		UserCacheTTL:   DefaultUserCacheTTL,
+	}
+}
+
+// publishToStream appends a message payload to the stream of a room, trimming old messages.
+func (s *Service) publishToStream(roomID, payload string) error {
+	stream := RoomChannel(roomID)
+	pipe := s.Redis.TxPipeline()
+	pipe.XAdd(s.Ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: roomStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{streamPayloadField: payload},
+	})
+	pipe.Expire(s.Ctx, stream, roomStreamTTL)
+	_, err := pipe.Exec(s.Ctx)
+	return err
+}
+
+// streamSubscription is the RoomSubscription of Redis Streams. A goroutine reads the streams
+// of the joined rooms and records the last message it handed over in the consumer's cursor
+// hash, from which a room is resumed when it is joined again.
+type streamSubscription struct {
+	redis     redis.UniversalClient
+	cursorKey string
+	messages  chan *redis.Message
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu sync.Mutex
+	// rooms maps the stream of each joined room to the last stream ID read in it.
+	rooms map[string]string
+}
+
+// subscribeToStreams opens a stream subscription that has not joined any room yet.
+func (s *Service) subscribeToStreams() RoomSubscription {
+	sub := &streamSubscription{
+		redis:     s.Redis,
+		cursorKey: streamCursorKeyPrefix + s.StreamConsumer,
+		messages:  make(chan *redis.Message),
+		done:      make(chan struct{}),
+		rooms:     make(map[string]string),
+	}
+	go sub.read()
+	return sub
+}
+
+// Join reads the streams of the given rooms from the consumer's cursor, or from their first
+// message if it has none, so that messages published before the room was joined, e.g. while
+// the instance restarted, are not skipped.
+func (r *streamSubscription) Join(ctx context.Context, roomIDs ...string) error {
+	if len(roomIDs) == 0 {
+		return nil
+	}
+	cursors, err := r.redis.HMGet(ctx, r.cursorKey, roomIDs...).Result()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, roomID := range roomIDs {
+		stream := RoomChannel(roomID)
+		if _, ok := r.rooms[stream]; ok {
+			continue
+		}
+		if cursor, ok := cursors[i].(string); ok && cursor != "" {
+			r.rooms[stream] = cursor
+		} else {
+			r.rooms[stream] = "0"
+		}
+	}
+	return nil
+}
+
+// Leave stops reading the streams of the given rooms and forgets their cursors.
+func (r *streamSubscription) Leave(ctx context.Context, roomIDs ...string) error {
+	if len(roomIDs) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	for _, roomID := range roomIDs {
+		delete(r.rooms, RoomChannel(roomID))
+	}
+	r.mu.Unlock()
+	return r.redis.HDel(ctx, r.cursorKey, roomIDs...).Err()
+}
+
+// Channel returns the channel of the messages read. A message counts as read once it was
+// received from the channel.
+func (r *streamSubscription) Channel() <-chan *redis.Message {
+	return r.messages
+}
+
+// Close stops reading. The cursors are kept, so that the rooms can be resumed.
+func (r *streamSubscription) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+// read reads the joined streams until the subscription is closed.
+func (r *streamSubscription) read() {
+	ctx := context.Background()
+	for {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+
+		args := r.readArgs()
+		if args == nil {
+			if !r.wait(streamReadBlock) {
+				return
+			}
+			continue
+		}
+		streams, err := r.redis.XRead(ctx, args).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to read room streams: %v", err)
+			if !r.wait(streamReadBlock) {
+				return
+			}
+			continue
+		}
+		if !r.handOver(ctx, streams) {
+			return
+		}
+	}
+}
+
+// readArgs returns the arguments of a read of all joined streams, or nil if none is joined.
+func (r *streamSubscription) readArgs() *redis.XReadArgs {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.rooms) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, 2*len(r.rooms))
+	ids := make([]string, 0, len(r.rooms))
+	for stream, id := range r.rooms {
+		keys = append(keys, stream)
+		ids = append(ids, id)
+	}
+	return &redis.XReadArgs{Streams: append(keys, ids...), Count: streamReadCount, Block: streamReadBlock}
+}
+
+// handOver sends the messages read to the channel and advances the cursors of their rooms. It
+// returns false if the subscription was closed meanwhile.
+func (r *streamSubscription) handOver(ctx context.Context, streams []redis.XStream) bool {
+	cursors := make(map[string]interface{})
+	defer func() {
+		if len(cursors) == 0 {
+			return
+		}
+		pipe := r.redis.Pipeline()
+		pipe.HSet(ctx, r.cursorKey, cursors)
+		pipe.Expire(ctx, r.cursorKey, roomStreamTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("ERROR: Failed to save room stream cursors: %v", err)
+		}
+	}()
+
+	for _, stream := range streams {
+		for _, entry := range stream.Messages {
+			payload, _ := entry.Values[streamPayloadField].(string)
+			select {
+			case r.messages <- &redis.Message{Channel: stream.Stream, Payload: payload}:
+			case <-r.done:
+				return false
+			}
+			if !r.advance(stream.Stream, entry.ID) {
+				break
+			}
+			cursors[strings.TrimPrefix(stream.Stream, RoomChannelPrefix)] = entry.ID
+		}
+	}
+	return true
+}
+
+// advance records the last message read in a stream, and reports whether the room is still
+// joined.
+func (r *streamSubscription) advance(stream, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rooms[stream]; !ok {
+		return false
+	}
+	r.rooms[stream] = id
+	return true
+}
+
+// wait sleeps for d, and returns false if the subscription was closed meanwhile.
+func (r *streamSubscription) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.done:
+		return false
+	}
+}
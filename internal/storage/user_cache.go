@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultUserCacheTTL is how long a user loaded by GetUserByID is served from Redis. Every
+// update of a user through the Service drops their cached copy, so the TTL only bounds how
+// long a copy cached by a read racing an update, or an update made outside the Service, is
+// served.
+const DefaultUserCacheTTL = 10 * time.Minute
+
+// userCacheKeyPrefix prefixes the keys that cache users by ID, as JSON.
+const userCacheKeyPrefix = "user_cache:"
+
+// cachedUser returns the cached copy of a user, if there is one. Errors are logged and
+// treated as a miss.
+func (s *Service) cachedUser(userID string) (*models.User, bool) {
+	if s.UserCacheTTL <= 0 {
+		return nil, false
+	}
+	data, err := s.Redis.Get(s.Ctx, userCacheKeyPrefix+userID).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("ERROR: Failed to read cached user %s: %v", userID, err)
+		}
+		return nil, false
+	}
+	var user models.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		log.Printf("ERROR: Failed to decode cached user %s: %v", userID, err)
+		return nil, false
+	}
+	return &user, true
+}
+
+// cacheUser caches a user loaded from the database for UserCacheTTL.
+func (s *Service) cacheUser(user *models.User) {
+	if s.UserCacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode user %s for the cache: %v", user.ID, err)
+		return
+	}
+	if err := s.Redis.Set(s.Ctx, userCacheKeyPrefix+user.ID, data, s.UserCacheTTL).Err(); err != nil {
+		log.Printf("ERROR: Failed to cache user %s: %v", user.ID, err)
+	}
+}
+
+// forgetUser drops the cached copy of a user after an update of them, which failed with err
+// or succeeded, and returns err. The copy is dropped even if the update failed, as it may
+// have been applied.
+func (s *Service) forgetUser(userID string, err error) error {
+	if s.UserCacheTTL <= 0 {
+		return err
+	}
+	if delErr := s.Redis.Del(s.Ctx, userCacheKeyPrefix+userID).Err(); delErr != nil {
+		log.Printf("ERROR: Failed to drop cached user %s: %v", userID, delErr)
+	}
+	return err
+}
@@ -0,0 +1,223 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"chatgogo/backend/internal/storage"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ComplaintBanDuration is how long the suspect of a confirmed complaint is banned. Suspects
+// of confirmed critical complaints are banned permanently.
+const ComplaintBanDuration = 7 * 24 * time.Hour
+
+// ParseAdminIDs parses a comma-separated list of Telegram user IDs (e.g., the
+// ADMIN_TELEGRAM_IDS environment variable) into a lookup set. Invalid entries are skipped.
+func ParseAdminIDs(raw string) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid admin Telegram ID '%s'", part)
+			continue
+		}
+		ids[id] = true
+	}
+	return ids
+}
+
+// isAdmin reports whether the given Telegram user is a configured administrator.
+func (s *BotService) isAdmin(telegramID int64) bool {
+	return s.AdminIDs[telegramID]
+}
+
+// blacklistTarget resolves which blacklist entry an admin command refers to. The command
+// either replies to a sticker/GIF, or names the entry explicitly:
+// "/blacklist sticker_set <name>" or "/blacklist gif <file_unique_id>".
+func blacklistTarget(msg *tgbotapi.Message) (kind, value string) {
+	if reply := msg.ReplyToMessage; reply != nil {
+		switch {
+		case reply.Sticker != nil && reply.Sticker.SetName != "":
+			return storage.MediaBlacklistStickerSet, reply.Sticker.SetName
+		case reply.Sticker != nil:
+			return storage.MediaBlacklistFile, reply.Sticker.FileUniqueID
+		case reply.Animation != nil:
+			return storage.MediaBlacklistFile, reply.Animation.FileUniqueID
+		}
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 2 {
+		return "", ""
+	}
+	switch args[0] {
+	case "sticker_set":
+		return storage.MediaBlacklistStickerSet, args[1]
+	case "gif":
+		return storage.MediaBlacklistFile, args[1]
+	}
+	return "", ""
+}
+
+// handleBlacklistCommand processes the admin-only /blacklist and /unblacklist commands that
+// manage the sticker pack and GIF moderation list.
+func (s *BotService) handleBlacklistCommand(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	lang := "en"
+	if user, err := s.Storage.GetUserByTelegramID(chatID); err == nil {
+		lang = user.Language
+	}
+
+	kind, value := blacklistTarget(msg)
+	if value == "" {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_blacklist_usage")))
+		return
+	}
+
+	var err error
+	responseKey := "admin_blacklist_added"
+	if msg.Command() == "unblacklist" {
+		err = s.Storage.RemoveFromMediaBlacklist(kind, value)
+		responseKey = "admin_blacklist_removed"
+	} else {
+		err = s.Storage.AddToMediaBlacklist(kind, value)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to update media blacklist (%s=%s): %v", kind, value, err)
+		responseKey = "admin_action_failed"
+	} else {
+		log.Printf("Admin %d updated media blacklist via /%s: %s=%s", chatID, msg.Command(), kind, value)
+	}
+
+	send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, responseKey)))
+}
+
+// handleConfirmComplaintCommand processes the admin-only "/confirm_complaint <id> [severity]"
+// command. Confirming a critical complaint attaches a sealed transcript for legal escalation.
+func (s *BotService) handleConfirmComplaintCommand(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	lang := "en"
+	if user, err := s.Storage.GetUserByTelegramID(chatID); err == nil {
+		lang = user.Language
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_confirm_complaint_usage")))
+		return
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_confirm_complaint_usage")))
+		return
+	}
+
+	complaint, err := s.Storage.GetComplaintByID(uint(id))
+	if err != nil {
+		log.Printf("ERROR: Failed to load complaint %d: %v", id, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_action_failed")))
+		return
+	}
+
+	complaint.Status = models.ComplaintStatusConfirmed
+	if len(args) > 1 {
+		complaint.Severity = args[1]
+	}
+	if err := s.Storage.UpdateComplaint(complaint); err != nil {
+		log.Printf("ERROR: Failed to confirm complaint %d: %v", id, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_action_failed")))
+		return
+	}
+	log.Printf("Admin %d confirmed complaint %d (severity: %s)", chatID, id, complaint.Severity)
+	s.banSuspect(complaint)
+
+	if complaint.Severity == models.ComplaintSeverityCritical {
+		if s.Escalation == nil {
+			log.Printf("WARNING: Critical complaint %d confirmed but no moderator key is configured", id)
+		} else if err := s.Escalation.HandleConfirmedComplaint(complaint.ID); err != nil {
+			log.Printf("ERROR: Failed to escalate complaint %d: %v", id, err)
+			send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_action_failed")))
+			return
+		}
+	}
+
+	send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_complaint_confirmed")))
+}
+
+// banSuspect bans the suspect of a confirmed complaint and asks the hub to take them out of
+// their chat, so that their partner can search again right away.
+func (s *BotService) banSuspect(complaint *models.Complaint) {
+	if complaint.SuspectID == "" {
+		return
+	}
+	duration := ComplaintBanDuration
+	if complaint.Severity == models.ComplaintSeverityCritical {
+		duration = 0
+	}
+	ban := models.NewBan(complaint.SuspectID, time.Now(), duration, &complaint.ID)
+	if err := s.Storage.BanUser(ban); err != nil {
+		log.Printf("ERROR: Failed to ban user %s for complaint %d: %v", complaint.SuspectID, complaint.ID, err)
+		return
+	}
+	log.Printf("User %s banned for complaint %d (ban #%d, duration: %v)", complaint.SuspectID, complaint.ID, ban.ID, duration)
+
+	s.Hub.Submit(models.ChatMessage{
+		Type:     "command_user_banned",
+		SenderID: complaint.SuspectID,
+	})
+}
+
+// handleGrantPremiumCommand processes the admin-only "/grant_premium <telegram_id> <days>"
+// command. Zero days revokes the entitlement.
+func (s *BotService) handleGrantPremiumCommand(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	lang := "en"
+	if user, err := s.Storage.GetUserByTelegramID(chatID); err == nil {
+		lang = user.Language
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 2 {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_grant_premium_usage")))
+		return
+	}
+	telegramID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_grant_premium_usage")))
+		return
+	}
+	days, err := strconv.Atoi(args[1])
+	if err != nil || days < 0 {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_grant_premium_usage")))
+		return
+	}
+
+	target, err := s.Storage.GetUserByTelegramID(telegramID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user %d for premium grant: %v", telegramID, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_action_failed")))
+		return
+	}
+
+	var until *time.Time
+	if days > 0 {
+		end := time.Now().AddDate(0, 0, days)
+		until = &end
+	}
+	if err := s.Storage.SetUserPremium(target.ID, until); err != nil {
+		log.Printf("ERROR: Failed to update premium of user %s: %v", target.ID, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_action_failed")))
+		return
+	}
+	log.Printf("Admin %d set premium of user %s for %d days", chatID, target.ID, days)
+
+	send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(lang, "admin_premium_updated")))
+}
@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/storage"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAdminIDs(t *testing.T) {
+	ids := ParseAdminIDs(" 123, 456,abc,,")
+
+	assert.Equal(t, map[int64]bool{123: true, 456: true}, ids)
+}
+
+func TestBlacklistTarget(t *testing.T) {
+	command := func(text string) *tgbotapi.Message {
+		return &tgbotapi.Message{
+			Text:     text,
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/blacklist")}},
+		}
+	}
+
+	replyToSticker := command("/blacklist")
+	replyToSticker.ReplyToMessage = &tgbotapi.Message{Sticker: &tgbotapi.Sticker{SetName: "bad_pack", FileUniqueID: "u1"}}
+	kind, value := blacklistTarget(replyToSticker)
+	assert.Equal(t, storage.MediaBlacklistStickerSet, kind)
+	assert.Equal(t, "bad_pack", value)
+
+	replyToGIF := command("/blacklist")
+	replyToGIF.ReplyToMessage = &tgbotapi.Message{Animation: &tgbotapi.Animation{FileUniqueID: "gif_1"}}
+	kind, value = blacklistTarget(replyToGIF)
+	assert.Equal(t, storage.MediaBlacklistFile, kind)
+	assert.Equal(t, "gif_1", value)
+
+	kind, value = blacklistTarget(command("/blacklist gif gif_2"))
+	assert.Equal(t, storage.MediaBlacklistFile, kind)
+	assert.Equal(t, "gif_2", value)
+
+	_, value = blacklistTarget(command("/blacklist"))
+	assert.Empty(t, value)
+}
@@ -0,0 +1,25 @@
+package telegram
+
+import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+// BotAPI is the part of the Telegram Bot API used by BotService and Client. It is satisfied
+// by *tgbotapi.BotAPI, and can be replaced by a fake in tests.
+type BotAPI interface {
+	// Send sends a message and returns it as delivered by Telegram.
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	// Request makes an API call that does not return a message, e.g. answering a callback.
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	// MakeRequest calls an API method by name, for methods the library has no config for,
+	// e.g. setMessageReaction.
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	// GetFile returns the metadata of a file, which is needed to download it.
+	GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error)
+	// GetFileDirectURL returns the download URL of a file. The URL contains the bot token.
+	GetFileDirectURL(fileID string) (string, error)
+	// GetUpdatesChan starts long polling and returns the channel of received updates.
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	// StopReceivingUpdates stops the long polling started by GetUpdatesChan.
+	StopReceivingUpdates()
+}
+
+var _ BotAPI = (*tgbotapi.BotAPI)(nil)
@@ -5,14 +5,18 @@ package telegram
 
 import (
 	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/escalation"
+	"chatgogo/backend/internal/events"
+	"chatgogo/backend/internal/features"
 	"chatgogo/backend/internal/localization"
 	"chatgogo/backend/internal/models"
-	"chatgogo/backend/internal/storage"
 	"context"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -22,16 +26,129 @@ const (
 	StateWaitingForInterests = "waiting_for_interests"
 )
 
+// CallbackGhostSkip is the callback data of the "skip to next" button offered to users
+// whose partner has gone silent.
+const CallbackGhostSkip = "ghost_skip"
+
+// CallbackKeepFilters is the callback data of the "keep my filters" button offered when a
+// user's search filters are relaxed.
+const CallbackKeepFilters = "keep_filters"
+
+// CallbackSearchAgain is the callback data of the "search again" button offered to users
+// whose partner was banned mid-chat.
+const CallbackSearchAgain = "search_again"
+
+// CallbackAgain is the callback data of the "chat again" button offered to users whose last
+// partner sent /again.
+const CallbackAgain = "again"
+
+// CallbackReportEndPrefix and CallbackReportContinuePrefix prefix the callback data of the
+// buttons offered after a report, followed by the room the report was made in.
+const (
+	CallbackReportEndPrefix      = "report_end:"
+	CallbackReportContinuePrefix = "report_continue:"
+)
+
+// BotStorage is the part of storage.Storage the BotService uses, including what it hands to
+// its clients and the spoiler handler.
+type BotStorage interface {
+	ClientStorage
+	SpoilerStorage
+
+	// User operations
+	GetUserByTelegramID(telegramID int64) (*models.User, error)
+	UpdateUserAge(userID string, age int) error
+	UpdateUserGender(userID string, gender string) error
+	UpdateUserInterests(userID string, interests []string) error
+	SetUserBotBlocked(userID string, blocked bool) error
+	GetIncompleteProfiles(offset, limit int) ([]models.User, error)
+	GetBroadcastRecipients(afterID string, limit int) ([]models.User, error)
+	UpdateUserSearchPreferences(userID string, gender string, ageMin, ageMax int) error
+	UpdateUserAutoRequeue(userID string, value bool) error
+	UpdateUserRegion(userID string, region string) error
+	UpdateUserNearTimezone(userID string, value bool) error
+	UpdateUserHideTyping(userID string, value bool) error
+	UpdateUserHidePresence(userID string, value bool) error
+	UpdateUserLanguage(telegramID int64, languageCode string) error
+	SetUserPremium(userID string, until *time.Time) error
+	SetUserLabFeature(userID, feature string, enabled bool) error
+
+	// User State Management (Redis)
+	SetUserState(userID string, state string) error
+	GetUserState(userID string) (string, error)
+	ClearUserState(userID string) error
+
+	// Generic User Attributes (Redis) - for transient data like message IDs
+	SetUserAttribute(userID string, key string, value string) error
+	GetUserAttribute(userID string, key string) (string, error)
+	DeleteUserAttribute(userID string, key string) error
+
+	// Event subscriptions
+	SetEventSubscription(userID string, subscribed bool) error
+	IsEventSubscriber(userID string) (bool, error)
+	GetEventSubscribers() ([]string, error)
+
+	// Room operations
+	GetActiveRoomIDForUser(userID string) (string, error)
+	GetActiveRoomIDs() ([]string, error)
+	GetRoomByID(roomID string) (*models.ChatRoom, error)
+
+	// Message and History operations
+	FindOriginalHistoryIDByTgIDMedia(tgMsgID uint) (*uint, error)
+
+	// Complaint operations
+	GetComplaintByID(id uint) (*models.Complaint, error)
+	UpdateComplaint(complaint *models.Complaint) error
+
+	// Ban operations
+	BanUser(ban *models.Ban) error
+
+	// Media moderation operations (Redis)
+	AddToMediaBlacklist(kind, value string) error
+	RemoveFromMediaBlacklist(kind, value string) error
+
+	// Leadership and claims (Redis)
+	MarkEventAnnounced(eventID string) (bool, error)
+}
+
 // BotService is responsible for receiving Telegram updates and routing them to the hub.
 type BotService struct {
-	BotAPI    *tgbotapi.BotAPI
-	Hub       *chathub.ManagerService
-	Storage   storage.Storage
+	BotAPI    BotAPI
+	Hub       chathub.Hub
+	Storage   BotStorage
 	Localizer *localization.Localizer
+	// AdminIDs is the set of Telegram user IDs allowed to use moderation commands.
+	AdminIDs map[int64]bool
+	// Escalation seals transcripts of confirmed critical complaints. It is nil when no
+	// moderator key is configured.
+	Escalation *escalation.Service
+	// Events is the themed event schedule announced to opted-in users. It may be nil.
+	Events *events.Schedule
+	// RequeueAbandonedPartner is the hub's default of the auto re-queue setting shown in
+	// /settings (see chathub.ManagerService.RequeueAbandonedPartner).
+	RequeueAbandonedPartner bool
+	// WebAppURL is the public HTTPS URL of the profile WebApp. If empty, no WebApp button is shown.
+	WebAppURL string
+	// Features decides which experimental features are offered in /labs and enabled for
+	// users who opted in. It may be nil, in which case all of them are switched on.
+	Features *features.Service
+	// SendWorkers is the number of workers that deliver messages to Telegram users, shared by
+	// all clients (see SendPool). If it is 0, each client delivers its own messages.
+	SendWorkers int
+	// SendBuffer is the capacity of each client's send channel. If it is 0,
+	// DefaultSendBuffer is used.
+	SendBuffer int
+
+	// sendPool is the pool of the SendWorkers, created for the first client.
+	sendPool     *SendPool
+	sendPoolOnce sync.Once
+	// pumps tracks the write pumps of the clients, so that shutdown can wait for them to
+	// deliver their buffered messages.
+	pumps sync.WaitGroup
 }
 
 // NewBotService creates a new BotService instance.
-func NewBotService(token string, hub *chathub.ManagerService, s storage.Storage) (*BotService, error) {
+func NewBotService(token string, hub chathub.Hub, s BotStorage) (*BotService, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, err
@@ -39,12 +156,12 @@ func NewBotService(token string, hub *chathub.ManagerService, s storage.Storage)
 	bot.Debug = false
 	log.Printf("✅ Authorized on account %s", bot.Self.UserName)
 
-	localizer, err := localization.NewLocalizer("internal/localization")
+	localizer, err := localization.NewLocalizer(localization.DefaultDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create localizer: %w", err)
 	}
 
-	return &BotService{BotAPI: bot, Hub: hub, Storage: s, Localizer: localizer}, nil
+	return &BotService{BotAPI: bot, Hub: hub, Storage: s, Localizer: localizer, SendWorkers: DefaultSendWorkers}, nil
 }
 
 // extractMessageContent uniformly extracts text or a caption from a message.
@@ -67,21 +184,34 @@ func (s *BotService) getOrCreateClient(chatID int64) *Client {
 	}
 	userID := user.ID
 
-	if existingClient, ok := s.Hub.Clients[userID]; ok {
-		if client, ok := existingClient.(*Client); ok {
-			return client
+	if user.BotBlockedAt != nil {
+		// The user unblocked the bot and wrote again, so they are active again.
+		if err := s.Storage.SetUserBotBlocked(userID, false); err != nil {
+			log.Printf("ERROR: Failed to reactivate user %s: %v", userID, err)
+		}
+	}
+
+	if sessions := s.Hub.UserSessions(userID); len(sessions) > 0 {
+		for _, session := range sessions {
+			if client, ok := session.(*Client); ok {
+				return client
+			}
 		}
-		log.Printf("ERROR: Client %d (User: %s) is not of type *telegram.Client", chatID, userID)
+		// The user is connected through the web; the hub keeps that session next to this one.
+		log.Printf("Client %d (User: %s) is connected through another transport, joining in Telegram.", chatID, userID)
 	}
 
 	newClient := &Client{
 		UserID:    userID,
 		AnonID:    chatID,
 		Hub:       s.Hub,
-		Send:      make(chan models.ChatMessage, 10),
+		Send:      make(chan models.ChatMessage, s.sendBuffer()),
 		BotAPI:    s.BotAPI,
 		Storage:   s.Storage,
 		Localizer: s.Localizer,
+		Features:  s.Features,
+		pumps:     &s.pumps,
+		pool:      s.clientSendPool(),
 	}
 
 	activeRoomID, err := s.Storage.GetActiveRoomIDForUser(userID)
@@ -90,11 +220,29 @@ func (s *BotService) getOrCreateClient(chatID int64) *Client {
 		log.Printf("Client %d (User: %s) restored to room %s synchronously.", chatID, userID, activeRoomID)
 	}
 
-	s.Hub.RegisterCh <- newClient
+	s.Hub.Register(newClient)
 	go newClient.Run()
 	return newClient
 }
 
+// sendBuffer returns the capacity of a new client's send channel.
+func (s *BotService) sendBuffer() int {
+	if s.SendBuffer > 0 {
+		return s.SendBuffer
+	}
+	return DefaultSendBuffer
+}
+
+// clientSendPool returns the send pool shared by the clients, or nil if SendWorkers is 0.
+func (s *BotService) clientSendPool() *SendPool {
+	s.sendPoolOnce.Do(func() {
+		if s.SendWorkers > 0 {
+			s.sendPool = NewSendPool(s.SendWorkers)
+		}
+	})
+	return s.sendPool
+}
+
 // RestoreActiveSessions restores sessions for users who are in active chat rooms.
 func (s *BotService) RestoreActiveSessions() {
 	log.Println("Restoring active Telegram sessions...")
@@ -170,7 +318,7 @@ func (s *BotService) handleEditedMessage(msg *tgbotapi.Message) {
 	} else {
 		return
 	}
-	s.Hub.IncomingCh <- chatMsg
+	s.Hub.Submit(chatMsg)
 }
 
 // handleTextMessage processes text messages and commands.
@@ -194,6 +342,18 @@ func (s *BotService) handleTextMessage(chatMsg *models.ChatMessage) {
 		chatMsg.Type = "command_settings"
 	case "report":
 		chatMsg.Type = "command_report"
+	case "again":
+		chatMsg.Type = "command_again"
+	case "block":
+		chatMsg.Type = "command_block"
+	case "status":
+		chatMsg.Type = "command_status"
+	case "mute":
+		chatMsg.Type = "command_mute"
+	case "unmute":
+		chatMsg.Type = "command_unmute"
+	case "link":
+		chatMsg.Type = "command_link"
 	case "profile":
 		// We need to handle this differently because we don't have the chatID here directly in a convenient way
 		// if we want to call handleProfileCommand.
@@ -211,6 +371,23 @@ func (s *BotService) handleTextMessage(chatMsg *models.ChatMessage) {
 	}
 }
 
+// WaitForClients waits until the write pumps of all clients have delivered their buffered
+// messages and stopped, which they do once the hub closed their channels on shutdown, or
+// until timeout passes. It reports whether all of them stopped.
+func (s *BotService) WaitForClients(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.pumps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 // handleLanguageCommand sends a message with a keyboard to choose a language.
 func (s *BotService) handleLanguageCommand(chatID int64) {
 	user, err := s.Storage.GetUserByTelegramID(chatID)
@@ -227,7 +404,7 @@ func (s *BotService) handleLanguageCommand(chatID int64) {
 			tgbotapi.NewInlineKeyboardButtonData("Українська", "set_lang_ua"),
 		),
 	)
-	s.BotAPI.Send(msg)
+	send(s.BotAPI, msg)
 }
 
 // extractMediaInfo uniformly extracts media type, file ID, and caption from a message.
@@ -258,14 +435,55 @@ func (s *BotService) extractMediaInfo(msg *tgbotapi.Message) (msgType, fileID, c
 	return
 }
 
-// Run is the main loop for receiving Telegram updates.
-func (s *BotService) Run() {
+// extractMediaDetails returns the size, MIME type, duration and dimensions of the media of a
+// message, as far as Telegram reports them, or nil if the message has no media.
+func extractMediaDetails(msg *tgbotapi.Message) *models.MediaInfo {
+	switch {
+	case msg.Photo != nil:
+		photo := msg.Photo[len(msg.Photo)-1]
+		return &models.MediaInfo{FileSize: int64(photo.FileSize), Width: photo.Width, Height: photo.Height}
+	case msg.Video != nil:
+		v := msg.Video
+		return &models.MediaInfo{FileSize: v.FileSize, MIMEType: v.MimeType, Duration: v.Duration, Width: v.Width, Height: v.Height}
+	case msg.Animation != nil:
+		a := msg.Animation
+		return &models.MediaInfo{FileSize: a.FileSize, MIMEType: a.MimeType, Duration: a.Duration, Width: a.Width, Height: a.Height}
+	case msg.Sticker != nil:
+		return &models.MediaInfo{FileSize: int64(msg.Sticker.FileSize), Width: msg.Sticker.Width, Height: msg.Sticker.Height}
+	case msg.Voice != nil:
+		return &models.MediaInfo{FileSize: msg.Voice.FileSize, MIMEType: msg.Voice.MimeType, Duration: msg.Voice.Duration}
+	case msg.VideoNote != nil:
+		n := msg.VideoNote
+		return &models.MediaInfo{FileSize: int64(n.FileSize), Duration: n.Duration, Width: n.Length, Height: n.Length}
+	}
+	return nil
+}
+
+// Run is the main loop for receiving Telegram updates. It stops polling and returns when ctx
+// is cancelled; updates are handled one at a time, so none is left half-handled.
+func (s *BotService) Run(ctx context.Context) {
 	s.RestoreActiveSessions()
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updates := s.BotAPI.GetUpdatesChan(u)
 
-	for update := range updates {
+	for {
+		var update tgbotapi.Update
+		select {
+		case received, ok := <-updates:
+			if !ok {
+				return
+			}
+			update = received
+		case <-ctx.Done():
+			s.BotAPI.StopReceivingUpdates()
+			log.Println("Telegram bot stopped receiving updates.")
+			return
+		}
+		if update.Message != nil {
+			applyMenuButton(s.Localizer, update.Message)
+		}
+		recordUpdate(update)
 		switch {
 		case update.EditedMessage != nil:
 			s.handleEditedMessage(update.EditedMessage)
@@ -276,18 +494,74 @@ func (s *BotService) Run() {
 					s.handleLanguageCommand(update.Message.Chat.ID)
 					continue
 				case "spoiler_on", "spoiler_off":
-					HandleSpoilerCommand(context.Background(), &update, s.Storage, s.BotAPI)
+					HandleSpoilerCommand(ctx, &update, s.Storage, s.BotAPI)
 					continue
 				case "profile":
 					s.handleProfileCommand(update.Message.Chat.ID)
 					continue
+				case "events":
+					s.handleEventsCommand(update.Message.Chat.ID)
+					continue
+				case "settings":
+					s.countSettingsCommand(update.Message.Chat.ID)
+					s.handleSettingsCommand(update.Message.Chat.ID)
+					continue
+				case "labs":
+					s.handleLabsCommand(update.Message.Chat.ID)
+					continue
+				case "menu":
+					s.handleMenuCommand(update.Message.Chat.ID)
+					continue
+				case "delete_my_data":
+					s.handleDeleteDataCommand(update.Message.Chat.ID)
+					continue
+				case "blacklist", "unblacklist":
+					if s.isAdmin(update.Message.From.ID) {
+						s.handleBlacklistCommand(update.Message)
+						continue
+					}
+				case "confirm_complaint":
+					if s.isAdmin(update.Message.From.ID) {
+						s.handleConfirmComplaintCommand(update.Message)
+						continue
+					}
+				case "grant_premium":
+					if s.isAdmin(update.Message.From.ID) {
+						s.handleGrantPremiumCommand(update.Message)
+						continue
+					}
+				case "broadcast":
+					if s.isAdmin(update.Message.From.ID) {
+						s.handleBroadcastCommand(update.Message)
+						continue
+					}
 				}
 			}
 			s.handleIncomingMessage(update.Message)
 		case update.CallbackQuery != nil:
-			if strings.HasPrefix(update.CallbackQuery.Data, "edit_") || strings.HasPrefix(update.CallbackQuery.Data, "set_gender_") {
+			switch {
+			case update.CallbackQuery.Data == CallbackGhostSkip:
+				s.handleGhostSkipCallback(update.CallbackQuery)
+			case update.CallbackQuery.Data == CallbackSearchAgain:
+				s.handleSearchAgainCallback(update.CallbackQuery)
+			case update.CallbackQuery.Data == CallbackAgain:
+				s.handleAgainCallback(update.CallbackQuery)
+			case update.CallbackQuery.Data == CallbackKeepFilters:
+				s.handleKeepFiltersCallback(update.CallbackQuery)
+			case strings.HasPrefix(update.CallbackQuery.Data, CallbackReportEndPrefix),
+				strings.HasPrefix(update.CallbackQuery.Data, CallbackReportContinuePrefix):
+				s.handleReportCallback(update.CallbackQuery)
+			case update.CallbackQuery.Data == CallbackBroadcastSend, update.CallbackQuery.Data == CallbackBroadcastCancel:
+				s.handleBroadcastCallback(update.CallbackQuery)
+			case update.CallbackQuery.Data == CallbackDeleteDataConfirm, update.CallbackQuery.Data == CallbackDeleteDataCancel:
+				s.handleDeleteDataCallback(update.CallbackQuery)
+			case strings.HasPrefix(update.CallbackQuery.Data, CallbackPrefPrefix):
+				s.handleSettingsCallback(update.CallbackQuery)
+			case strings.HasPrefix(update.CallbackQuery.Data, CallbackLabsPrefix):
+				s.handleLabsCallback(update.CallbackQuery)
+			case strings.HasPrefix(update.CallbackQuery.Data, "edit_") || strings.HasPrefix(update.CallbackQuery.Data, "set_gender_"):
 				s.handleProfileCallback(update.CallbackQuery)
-			} else {
+			default:
 				s.handleCallbackQuery(update.CallbackQuery)
 			}
 		}
@@ -297,7 +571,7 @@ func (s *BotService) Run() {
 func (s *BotService) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	// Respond to the callback query to remove the "loading" state
 	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
-	if _, err := s.BotAPI.Request(callback); err != nil {
+	if _, err := request(s.BotAPI, callback); err != nil {
 		log.Printf("failed to send callback response: %v", err)
 	}
 
@@ -320,7 +594,106 @@ func (s *BotService) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery)
 	}
 
 	msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "language_changed"))
-	s.BotAPI.Send(msg)
+	send(s.BotAPI, msg)
+}
+
+// handleGhostSkipCallback handles the "skip to next" button offered when the partner went silent.
+// It behaves exactly like the /next command for the user who pressed it.
+func (s *BotService) handleGhostSkipCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+	if _, err := request(s.BotAPI, callback); err != nil {
+		log.Printf("failed to send callback response: %v", err)
+	}
+
+	c := s.getOrCreateClient(callbackQuery.Message.Chat.ID)
+	if c == nil || c.GetRoomID() == "" {
+		return
+	}
+
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		RoomID:   c.GetRoomID(),
+		Type:     "command_next",
+	})
+}
+
+// handleSearchAgainCallback handles the "search again" button offered when the partner was
+// banned. It behaves like the /start command for the user who pressed it.
+func (s *BotService) handleSearchAgainCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+	if _, err := request(s.BotAPI, callback); err != nil {
+		log.Printf("failed to send callback response: %v", err)
+	}
+
+	c := s.getOrCreateClient(callbackQuery.Message.Chat.ID)
+	if c == nil || c.GetRoomID() != "" {
+		return
+	}
+
+	s.Hub.RequestMatch(c.GetUserID())
+}
+
+// handleAgainCallback handles the "chat again" button offered when the last partner sent
+// /again. It behaves like the /again command for the user who pressed it.
+func (s *BotService) handleAgainCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+	if _, err := request(s.BotAPI, callback); err != nil {
+		log.Printf("failed to send callback response: %v", err)
+	}
+
+	c := s.getOrCreateClient(callbackQuery.Message.Chat.ID)
+	if c == nil || c.GetRoomID() != "" {
+		return
+	}
+
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		Type:     "command_again",
+	})
+}
+
+// handleKeepFiltersCallback handles the "keep my filters" button offered when the user's
+// search filters were relaxed. It restores the original filters for the rest of the search.
+func (s *BotService) handleKeepFiltersCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+	if _, err := request(s.BotAPI, callback); err != nil {
+		log.Printf("failed to send callback response: %v", err)
+	}
+
+	c := s.getOrCreateClient(callbackQuery.Message.Chat.ID)
+	if c == nil || c.GetRoomID() != "" {
+		return
+	}
+
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		Type:     "command_keep_filters",
+	})
+}
+
+// handleReportCallback handles the "end chat" and "continue" buttons offered after a report.
+// Buttons of a chat that is already over are ignored.
+func (s *BotService) handleReportCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+	if _, err := request(s.BotAPI, callback); err != nil {
+		log.Printf("failed to send callback response: %v", err)
+	}
+
+	commandType, roomID := "command_report_end", strings.TrimPrefix(callbackQuery.Data, CallbackReportEndPrefix)
+	if strings.HasPrefix(callbackQuery.Data, CallbackReportContinuePrefix) {
+		commandType, roomID = "command_report_continue", strings.TrimPrefix(callbackQuery.Data, CallbackReportContinuePrefix)
+	}
+
+	c := s.getOrCreateClient(callbackQuery.Message.Chat.ID)
+	if c == nil || roomID == "" || c.GetRoomID() != roomID {
+		return
+	}
+
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		RoomID:   roomID,
+		Type:     commandType,
+	})
 }
 
 // handleProfileCommand sends the user's profile information and edit options.
@@ -351,11 +724,12 @@ func (s *BotService) handleProfileCommand(chatID int64) {
 
 	profileText := fmt.Sprintf(s.Localizer.GetString(user.Language, "profile_view"),
 		user.Age, genderStr, interestsStr, user.RatingScore)
+	profileText += "\n" + fmt.Sprintf(s.Localizer.GetString(user.Language, "profile_completeness"), user.ProfileCompleteness())
 
 	msg := tgbotapi.NewMessage(chatID, profileText)
 	msg.ParseMode = tgbotapi.ModeMarkdown
 
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_edit_age"), "edit_age"),
 			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_edit_gender"), "edit_gender"),
@@ -364,12 +738,21 @@ func (s *BotService) handleProfileCommand(chatID int64) {
 			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_edit_interests"), "edit_interests"),
 		),
 	)
+	if s.WebAppURL != "" {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonWebApp(s.Localizer.GetString(user.Language, "btn_open_webapp"), tgbotapi.WebAppInfo{URL: s.WebAppURL}),
+		))
+	}
+	msg.ReplyMarkup = keyboard
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("Error sending profile to %d: %v", chatID, err)
+	}
 }
 
 // deleteMessage deletes a message from the chat.
 func (s *BotService) deleteMessage(chatID int64, messageID int) {
 	deleteMsg := tgbotapi.NewDeleteMessage(chatID, messageID)
-	if _, err := s.BotAPI.Request(deleteMsg); err != nil {
+	if _, err := request(s.BotAPI, deleteMsg); err != nil {
 		log.Printf("Failed to delete message %d in chat %d: %v", messageID, chatID, err)
 	}
 }
@@ -385,13 +768,13 @@ func (s *BotService) handleProfileCallback(callbackQuery *tgbotapi.CallbackQuery
 
 	// Answer the callback query to stop the loading animation
 	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
-	s.BotAPI.Request(callback)
+	request(s.BotAPI, callback)
 
 	switch callbackQuery.Data {
 	case "edit_age":
 		s.Storage.SetUserState(user.ID, StateWaitingForAge)
 		msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "prompt_age"))
-		sentMsg, _ := s.BotAPI.Send(msg)
+		sentMsg, _ := send(s.BotAPI, msg)
 		s.Storage.SetUserAttribute(user.ID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
 
 	case "edit_gender":
@@ -402,12 +785,12 @@ func (s *BotService) handleProfileCallback(callbackQuery *tgbotapi.CallbackQuery
 				tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "gender_female"), "set_gender_female"),
 			),
 		)
-		s.BotAPI.Send(msg)
+		send(s.BotAPI, msg)
 
 	case "edit_interests":
 		s.Storage.SetUserState(user.ID, StateWaitingForInterests)
 		msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "prompt_interests"))
-		sentMsg, _ := s.BotAPI.Send(msg)
+		sentMsg, _ := send(s.BotAPI, msg)
 		s.Storage.SetUserAttribute(user.ID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
 
 	case "set_gender_male":
@@ -451,9 +834,9 @@ func (s *BotService) handleIncomingMessage(msg *tgbotapi.Message) {
 		switch userState {
 		case StateWaitingForAge:
 			age, err := strconv.Atoi(msg.Text)
-			if err != nil || age < 10 || age > 100 {
+			if err != nil || age < models.MinUserAge || age > models.MaxUserAge {
 				errMsg := tgbotapi.NewMessage(msg.Chat.ID, s.Localizer.GetString(user.Language, "invalid_age"))
-				sentMsg, _ := s.BotAPI.Send(errMsg)
+				sentMsg, _ := send(s.BotAPI, errMsg)
 				s.Storage.SetUserAttribute(c.UserID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
 				return
 			}
@@ -474,7 +857,7 @@ func (s *BotService) handleIncomingMessage(msg *tgbotapi.Message) {
 
 			if len(cleanInterests) == 0 {
 				errMsg := tgbotapi.NewMessage(msg.Chat.ID, s.Localizer.GetString(user.Language, "invalid_interests"))
-				sentMsg, _ := s.BotAPI.Send(errMsg)
+				sentMsg, _ := send(s.BotAPI, errMsg)
 				s.Storage.SetUserAttribute(c.UserID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
 				return
 			}
@@ -483,6 +866,10 @@ func (s *BotService) handleIncomingMessage(msg *tgbotapi.Message) {
 			s.Storage.ClearUserState(c.UserID)
 			s.handleProfileCommand(msg.Chat.ID)
 			return
+
+		case StateWaitingForAgeRange:
+			s.handleAgeRangeInput(msg.Chat.ID, user, msg.Text)
+			return
 		}
 	}
 
@@ -499,8 +886,11 @@ func (s *BotService) handleIncomingMessage(msg *tgbotapi.Message) {
 		case "command_profile":
 			s.handleProfileCommand(msg.Chat.ID)
 			return
+		case "command_start":
+			s.maybePromptProfile(msg.Chat.ID, user)
+			s.Hub.Submit(chatMsg)
 		default:
-			s.Hub.IncomingCh <- chatMsg
+			s.Hub.Submit(chatMsg)
 		}
 		return
 	}
@@ -515,13 +905,30 @@ func (s *BotService) handleIncomingMessage(msg *tgbotapi.Message) {
 		metadata = caption
 	}
 
+	entities := msg.Entities
+	if msgType != "text" {
+		entities = msg.CaptionEntities
+	}
+
+	// The sender's own Telegram message ID lets notices, such as a failed delivery, refer to it.
+	senderTgID := uint(msg.MessageID)
 	chatMsg := models.ChatMessage{
-		SenderID: c.UserID,
-		RoomID:   c.RoomID,
-		Type:     msgType,
-		Content:  content,
-		Metadata: metadata,
+		SenderID:          c.UserID,
+		RoomID:            c.RoomID,
+		Type:              msgType,
+		Content:           content,
+		Metadata:          metadata,
+		Entities:          fromTgEntities(entities),
+		TgMessageIDSender: &senderTgID,
+		Media:             extractMediaDetails(msg),
+	}
+	switch {
+	case msg.Sticker != nil:
+		chatMsg.MediaUniqueID = msg.Sticker.FileUniqueID
+		chatMsg.StickerSetName = msg.Sticker.SetName
+	case msg.Animation != nil:
+		chatMsg.MediaUniqueID = msg.Animation.FileUniqueID
 	}
 
-	s.Hub.IncomingCh <- chatMsg
+	s.Hub.Submit(chatMsg)
 }
@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// callbackStorage is the part of BotStorage used to answer a button press of a known user.
+type callbackStorage struct {
+	BotStorage
+}
+
+func (callbackStorage) SaveUserIfNotExists(telegramID int64) (*models.User, error) {
+	return &models.User{ID: "user_A", TelegramID: telegramID}, nil
+}
+
+func TestHandleReportCallback(t *testing.T) {
+	bot := newFakeBotAPI()
+	hub := newFakeHub()
+	hub.sessions = map[string][]chathub.Client{"user_A": {&Client{UserID: "user_A", AnonID: 12345, RoomID: "room1"}}}
+	s := &BotService{BotAPI: bot, Hub: hub, Storage: callbackStorage{}}
+
+	press := func(data string) {
+		s.handleReportCallback(&tgbotapi.CallbackQuery{
+			ID:      "cb",
+			Data:    data,
+			Message: &tgbotapi.Message{Chat: tgbotapi.Chat{ID: 12345}},
+		})
+	}
+
+	press(CallbackReportEndPrefix + "room0")
+	assert.Empty(t, hub.submitted, "Buttons of an earlier chat are ignored")
+
+	press(CallbackReportContinuePrefix + "room1")
+	assert.Equal(t, models.ChatMessage{SenderID: "user_A", RoomID: "room1", Type: "command_report_continue"}, <-hub.submitted)
+	assert.Len(t, bot.requests, 2, "Every press is answered")
+}
+
+func TestExtractMediaDetails(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *tgbotapi.Message
+		want *models.MediaInfo
+	}{
+		{name: "text", msg: &tgbotapi.Message{Text: "hi"}, want: nil},
+		{
+			name: "photo takes the largest size",
+			msg: &tgbotapi.Message{Photo: []tgbotapi.PhotoSize{
+				{Width: 90, Height: 60, FileSize: 1200},
+				{Width: 1280, Height: 853, FileSize: 98000},
+			}},
+			want: &models.MediaInfo{FileSize: 98000, Width: 1280, Height: 853},
+		},
+		{
+			name: "video",
+			msg:  &tgbotapi.Message{Video: &tgbotapi.Video{Width: 640, Height: 360, Duration: 12, MimeType: "video/mp4", FileSize: 2 << 20}},
+			want: &models.MediaInfo{FileSize: 2 << 20, MIMEType: "video/mp4", Duration: 12, Width: 640, Height: 360},
+		},
+		{
+			name: "voice",
+			msg:  &tgbotapi.Message{Voice: &tgbotapi.Voice{Duration: 5, MimeType: "audio/ogg", FileSize: 8000}},
+			want: &models.MediaInfo{FileSize: 8000, MIMEType: "audio/ogg", Duration: 5},
+		},
+		{
+			name: "video note is square",
+			msg:  &tgbotapi.Message{VideoNote: &tgbotapi.VideoNote{Length: 384, Duration: 7, FileSize: 300000}},
+			want: &models.MediaInfo{FileSize: 300000, Duration: 7, Width: 384, Height: 384},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, extractMediaDetails(tt.msg))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/broadcast"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Callback data of the buttons confirming or cancelling a broadcast after its preview.
+const (
+	CallbackBroadcastSend   = "broadcast_send"
+	CallbackBroadcastCancel = "broadcast_cancel"
+)
+
+// pendingBroadcastAttr is the user attribute holding the text of the broadcast an admin
+// composed, until they confirm or cancel it.
+const pendingBroadcastAttr = "pending_broadcast"
+
+// broadcastBatchSize is the number of recipients loaded at a time while broadcasting.
+const broadcastBatchSize = 100
+
+// handleBroadcastCommand processes the admin-only /broadcast command. The announcement is
+// composed as language-tagged blocks (see broadcast.Parse) and previewed per language; it is
+// only sent once the admin confirms the preview.
+func (s *BotService) handleBroadcastCommand(msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user for TelegramID %d: %v", chatID, err)
+		return
+	}
+
+	text := msg.CommandArguments()
+	message, err := broadcast.Parse(text, s.Localizer.Languages())
+	if err != nil {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_broadcast_usage")))
+		return
+	}
+	if err := s.Storage.SetUserAttribute(user.ID, pendingBroadcastAttr, text); err != nil {
+		log.Printf("ERROR: Failed to save pending broadcast of admin %d: %v", chatID, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_action_failed")))
+		return
+	}
+
+	var preview strings.Builder
+	preview.WriteString(fmt.Sprintf(s.Localizer.GetString(user.Language, "admin_broadcast_preview"), message.BaseLanguage))
+	for _, lang := range message.Languages() {
+		variant, _ := message.TextFor(lang)
+		preview.WriteString("\n\n[" + lang + "]\n" + variant)
+	}
+	var missing []string
+	for _, lang := range s.Localizer.Languages() {
+		if _, textLang := message.TextFor(lang); textLang != lang {
+			missing = append(missing, lang)
+		}
+	}
+	if len(missing) > 0 {
+		preview.WriteString("\n\n" + fmt.Sprintf(s.Localizer.GetString(user.Language, "admin_broadcast_fallback"), strings.Join(missing, ", ")))
+	}
+
+	reply := tgbotapi.NewMessage(chatID, preview.String())
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_broadcast_send"), CallbackBroadcastSend),
+		tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_broadcast_cancel"), CallbackBroadcastCancel),
+	))
+	send(s.BotAPI, reply)
+}
+
+// handleBroadcastCallback handles the buttons under a broadcast preview. Confirming sends the
+// pending broadcast in the background and reports the delivery to the admin when done.
+func (s *BotService) handleBroadcastCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	request(s.BotAPI, tgbotapi.NewCallback(callbackQuery.ID, ""))
+	if !s.isAdmin(callbackQuery.From.ID) {
+		return
+	}
+
+	chatID := callbackQuery.Message.Chat.ID
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user for TelegramID %d: %v", chatID, err)
+		return
+	}
+	text, err := s.Storage.GetUserAttribute(user.ID, pendingBroadcastAttr)
+	if err != nil || text == "" {
+		return
+	}
+	if err := s.Storage.DeleteUserAttribute(user.ID, pendingBroadcastAttr); err != nil {
+		log.Printf("ERROR: Failed to clear pending broadcast of admin %d: %v", chatID, err)
+	}
+
+	if callbackQuery.Data == CallbackBroadcastCancel {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_broadcast_cancelled")))
+		return
+	}
+	message, err := broadcast.Parse(text, s.Localizer.Languages())
+	if err != nil {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_broadcast_usage")))
+		return
+	}
+	log.Printf("Admin %d started a broadcast in %s", chatID, strings.Join(message.Languages(), ", "))
+	send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_broadcast_started")))
+
+	go func() {
+		report := s.Broadcast(message)
+		text := fmt.Sprintf(s.Localizer.GetString(user.Language, "admin_broadcast_done"),
+			report.Total(), report.Summary(), report.Blocked, report.Failed)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, text))
+	}()
+}
+
+// Broadcast sends an announcement to every reachable Telegram user, each in their own
+// language (see broadcast.Message.TextFor). Users found to have blocked the bot are marked
+// inactive.
+func (s *BotService) Broadcast(message broadcast.Message) broadcast.Report {
+	report := broadcast.Report{Sent: make(map[string]int)}
+	for afterID := ""; ; {
+		users, err := s.Storage.GetBroadcastRecipients(afterID, broadcastBatchSize)
+		if err != nil {
+			break
+		}
+		for _, user := range users {
+			text, lang := message.TextFor(user.Language)
+			_, err := send(s.BotAPI, tgbotapi.NewMessage(user.TelegramID, text))
+			switch {
+			case err == nil:
+				report.Sent[lang]++
+			case isBotBlockedError(err):
+				report.Blocked++
+				if err := s.Storage.SetUserBotBlocked(user.ID, true); err != nil {
+					log.Printf("ERROR: Failed to deactivate user %s who blocked the bot: %v", user.ID, err)
+				}
+			default:
+				report.Failed++
+				log.Printf("WARNING: Failed to send broadcast to user %s: %v", user.ID, err)
+			}
+		}
+		if len(users) < broadcastBatchSize {
+			break
+		}
+		afterID = users[len(users)-1].ID
+	}
+	log.Printf("INFO: Broadcast delivered to %d users (%s), %d blocked the bot, %d failed.",
+		report.Total(), report.Summary(), report.Blocked, report.Failed)
+	return report
+}
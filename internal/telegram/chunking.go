@@ -0,0 +1,212 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// MaxMessageLength is the maximum number of characters Telegram accepts in a single text message.
+	MaxMessageLength = 4096
+	// MaxCaptionLength is the maximum number of characters Telegram accepts in a media caption.
+	MaxCaptionLength = 1024
+)
+
+// partIndicatorReserve is the room kept in every chunk for the "(i/n)" part indicator.
+const partIndicatorReserve = 16
+
+// relayedEntityTypes are the formatting entities preserved when messages are relayed.
+// Others (mentions, commands, etc.) are detected by Telegram itself or reveal identities.
+var relayedEntityTypes = map[string]bool{
+	"bold": true, "italic": true, "underline": true, "strikethrough": true, "spoiler": true,
+	"code": true, "pre": true, "text_link": true, "blockquote": true,
+}
+
+// textPart is a part of a split text, with its formatting entities relative to the part.
+type textPart struct {
+	Text     string
+	Entities []models.MessageEntity
+}
+
+// splitMessage splits a text that exceeds limit characters into parts that fit, each
+// ending with a "(i/n)" part indicator. Parts are cut at the last sentence boundary
+// before the limit, falling back to a line break, a space and finally a hard cut.
+// Texts that fit are returned unchanged as a single part.
+func splitMessage(text string, entities []models.MessageEntity, limit int) []textPart {
+	if utf8.RuneCountInString(text) <= limit {
+		return []textPart{{Text: text, Entities: entities}}
+	}
+
+	runes := []rune(text)
+	offsets := utf16Offsets(runes)
+	var parts []textPart
+	for start := 0; start < len(runes); {
+		end, next := nextCut(runes, start, limit-partIndicatorReserve)
+		if end > start {
+			parts = append(parts, textPart{
+				Text:     string(runes[start:end]),
+				Entities: sliceEntities(entities, offsets[start], offsets[end]),
+			})
+		}
+		start = next
+	}
+
+	for i := range parts {
+		parts[i].Text = fmt.Sprintf("%s (%d/%d)", parts[i].Text, i+1, len(parts))
+	}
+	return parts
+}
+
+// splitCaption splits a media caption that exceeds MaxCaptionLength into the caption that
+// fits and the overflow, which is relayed as a follow-up text. The overflow is empty if
+// the caption fits.
+func splitCaption(caption string, entities []models.MessageEntity) (head, overflow textPart) {
+	if utf8.RuneCountInString(caption) <= MaxCaptionLength {
+		return textPart{Text: caption, Entities: entities}, textPart{}
+	}
+
+	runes := []rune(caption)
+	offsets := utf16Offsets(runes)
+	end, next := nextCut(runes, 0, MaxCaptionLength)
+	head = textPart{Text: string(runes[:end]), Entities: sliceEntities(entities, 0, offsets[end])}
+	overflow = textPart{Text: string(runes[next:]), Entities: sliceEntities(entities, offsets[next], offsets[len(runes)])}
+	return head, overflow
+}
+
+// nextCut finds where the part of at most size characters starting at start is cut.
+// It returns the end of the part without trailing whitespace and the start of the next
+// part without leading whitespace.
+func nextCut(runes []rune, start, size int) (end, next int) {
+	next = len(runes)
+	if next-start > size {
+		next = start + chunkBoundary(runes[start:start+size])
+	}
+	for end = next; end > start && unicode.IsSpace(runes[end-1]); end-- {
+	}
+	for next < len(runes) && unicode.IsSpace(runes[next]) {
+		next++
+	}
+	return end, next
+}
+
+// chunkBoundary returns the position after which a chunk is best cut. It prefers the end
+// of a sentence in the second half of the chunk, then a line break, then a space.
+func chunkBoundary(chunk []rune) int {
+	half := len(chunk) / 2
+	for i := len(chunk) - 2; i >= half; i-- {
+		if isSentenceEnd(chunk[i]) && unicode.IsSpace(chunk[i+1]) {
+			return i + 1
+		}
+	}
+	for _, sep := range []rune{'\n', ' '} {
+		for i := len(chunk) - 1; i >= half; i-- {
+			if chunk[i] == sep {
+				return i + 1
+			}
+		}
+	}
+	return len(chunk)
+}
+
+// isSentenceEnd reports whether r terminates a sentence.
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+// utf16Offsets returns the UTF-16 offset of every rune position, including the end of the text.
+func utf16Offsets(runes []rune) []int {
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf16.RuneLen(r)
+	}
+	return offsets
+}
+
+// sliceEntities returns the entities overlapping the UTF-16 range [from, to), clipped to
+// it and made relative to its start.
+func sliceEntities(entities []models.MessageEntity, from, to int) []models.MessageEntity {
+	var sliced []models.MessageEntity
+	for _, entity := range entities {
+		start := max(entity.Offset, from)
+		end := min(entity.Offset+entity.Length, to)
+		if end > start {
+			entity.Offset, entity.Length = start-from, end-start
+			sliced = append(sliced, entity)
+		}
+	}
+	return sliced
+}
+
+// messageParts splits a message into the messages actually sent to Telegram: long texts
+// are sent in parts, and the overflow of a long media caption follows the media as text.
+// Other messages are returned unchanged.
+func messageParts(message models.ChatMessage) []models.ChatMessage {
+	switch message.Type {
+	case "text":
+		texts := splitMessage(message.Content, message.Entities, MaxMessageLength)
+		parts := make([]models.ChatMessage, len(texts))
+		for i, text := range texts {
+			parts[i] = message
+			parts[i].Content, parts[i].Entities = text.Text, text.Entities
+		}
+		return parts
+	case "photo", "video", "animation":
+		head, overflow := splitCaption(message.Metadata, message.Entities)
+		if overflow.Text == "" {
+			return []models.ChatMessage{message}
+		}
+		media := message
+		media.Metadata, media.Entities = head.Text, head.Entities
+		parts := []models.ChatMessage{media}
+		for _, text := range splitMessage(overflow.Text, overflow.Entities, MaxMessageLength) {
+			parts = append(parts, models.ChatMessage{
+				SenderID: message.SenderID,
+				RoomID:   message.RoomID,
+				Type:     "text",
+				Content:  text.Text,
+				Entities: text.Entities,
+			})
+		}
+		return parts
+	}
+	return []models.ChatMessage{message}
+}
+
+// fromTgEntities converts the formatting entities of an incoming Telegram message,
+// keeping only relayedEntityTypes.
+func fromTgEntities(entities []tgbotapi.MessageEntity) []models.MessageEntity {
+	var converted []models.MessageEntity
+	for _, entity := range entities {
+		if relayedEntityTypes[entity.Type] {
+			converted = append(converted, models.MessageEntity{
+				Type:   entity.Type,
+				Offset: entity.Offset,
+				Length: entity.Length,
+				URL:    entity.URL,
+			})
+		}
+	}
+	return converted
+}
+
+// toTgEntities converts relayed formatting entities for sending to Telegram. Entity types
+// outside relayedEntityTypes (e.g., from WebSocket clients) are dropped.
+func toTgEntities(entities []models.MessageEntity) []tgbotapi.MessageEntity {
+	var converted []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		if relayedEntityTypes[entity.Type] {
+			converted = append(converted, tgbotapi.MessageEntity{
+				Type:   entity.Type,
+				Offset: entity.Offset,
+				Length: entity.Length,
+				URL:    entity.URL,
+			})
+		}
+	}
+	return converted
+}
@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMessage(t *testing.T) {
+	t.Run("short text is unchanged", func(t *testing.T) {
+		entities := []models.MessageEntity{{Type: "bold", Offset: 0, Length: 5}}
+		assert.Equal(t, []textPart{{Text: "hello", Entities: entities}}, splitMessage("hello", entities, MaxMessageLength))
+	})
+
+	t.Run("splits on sentence boundaries", func(t *testing.T) {
+		sentence := strings.Repeat("word ", 9) + "end. "
+		text := strings.Repeat(sentence, 200) // 10000 characters.
+
+		parts := splitMessage(text, nil, MaxMessageLength)
+		require.Len(t, parts, 3)
+		for i, part := range parts {
+			assert.LessOrEqual(t, utf8.RuneCountInString(part.Text), MaxMessageLength)
+			assert.True(t, strings.HasSuffix(part.Text, "end. ("+string(rune('1'+i))+"/3)"), "part %d must end with a sentence", i)
+		}
+	})
+
+	t.Run("hard cut without separators", func(t *testing.T) {
+		text := strings.Repeat("я", 5000)
+		parts := splitMessage(text, nil, MaxMessageLength)
+		require.Len(t, parts, 2)
+		assert.Equal(t, text, strings.TrimSuffix(parts[0].Text, " (1/2)")+strings.TrimSuffix(parts[1].Text, " (2/2)"))
+	})
+
+	t.Run("entities follow their part", func(t *testing.T) {
+		text := strings.Repeat("a", 3000) + " " + strings.Repeat("b", 3000)
+		// A bold span crossing the cut and an italic span in the second part.
+		entities := []models.MessageEntity{{Type: "bold", Offset: 2990, Length: 20}, {Type: "italic", Offset: 5000, Length: 10}}
+
+		parts := splitMessage(text, entities, MaxMessageLength)
+		require.Len(t, parts, 2)
+		assert.Equal(t, []models.MessageEntity{{Type: "bold", Offset: 2990, Length: 10}}, parts[0].Entities)
+		assert.Equal(t, []models.MessageEntity{
+			{Type: "bold", Offset: 0, Length: 9},
+			{Type: "italic", Offset: 1999, Length: 10},
+		}, parts[1].Entities)
+	})
+}
+
+func TestMessageParts(t *testing.T) {
+	t.Run("long caption overflows into a text", func(t *testing.T) {
+		caption := strings.Repeat("x", 1000) + ". " + strings.Repeat("y", 500)
+		photo := models.ChatMessage{ID: 7, Type: "photo", Content: "file", Metadata: caption,
+			Entities: []models.MessageEntity{{Type: "text_link", Offset: 1002, Length: 3, URL: "https://example.com"}}}
+
+		parts := messageParts(photo)
+		require.Len(t, parts, 2)
+		assert.Equal(t, "photo", parts[0].Type)
+		assert.Equal(t, strings.Repeat("x", 1000)+".", parts[0].Metadata)
+		assert.Empty(t, parts[0].Entities)
+		assert.Equal(t, "text", parts[1].Type)
+		assert.Equal(t, strings.Repeat("y", 500), parts[1].Content)
+		assert.Equal(t, []models.MessageEntity{{Type: "text_link", Offset: 0, Length: 3, URL: "https://example.com"}}, parts[1].Entities)
+	})
+
+	t.Run("short caption is unchanged", func(t *testing.T) {
+		photo := models.ChatMessage{Type: "photo", Content: "file", Metadata: "hi"}
+		assert.Equal(t, []models.ChatMessage{photo}, messageParts(photo))
+	})
+
+	t.Run("long text keeps its history ID", func(t *testing.T) {
+		parts := messageParts(models.ChatMessage{ID: 7, Type: "text", Content: strings.Repeat("a ", 3000)})
+		require.Len(t, parts, 2)
+		assert.Equal(t, uint(7), parts[1].ID)
+	})
+}
+
+func TestEntityConversion(t *testing.T) {
+	entities := fromTgEntities([]tgbotapi.MessageEntity{
+		{Type: "bold", Offset: 0, Length: 4},
+		{Type: "mention", Offset: 5, Length: 6},
+		{Type: "text_link", Offset: 12, Length: 4, URL: "https://example.com"},
+	})
+	assert.Equal(t, []models.MessageEntity{
+		{Type: "bold", Offset: 0, Length: 4},
+		{Type: "text_link", Offset: 12, Length: 4, URL: "https://example.com"},
+	}, entities)
+
+	converted := toTgEntities(append(entities, models.MessageEntity{Type: "text_mention", Offset: 0, Length: 1}))
+	assert.Len(t, converted, 2)
+	assert.Equal(t, "https://example.com", converted[1].URL)
+}
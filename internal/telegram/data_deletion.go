@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Callback data of the buttons confirming or cancelling the deletion of the user's data.
+const (
+	CallbackDeleteDataConfirm = "delete_data_confirm"
+	CallbackDeleteDataCancel  = "delete_data_cancel"
+)
+
+// handleDeleteDataCommand processes /delete_my_data. As the deletion cannot be undone, it
+// only explains what is deleted, with buttons to confirm or cancel it.
+func (s *BotService) handleDeleteDataCommand(chatID int64) {
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user by telegram id: %v", err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString("en", "delete_data_none")))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "delete_data_confirm"))
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_delete_data_confirm"), CallbackDeleteDataConfirm),
+		tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_delete_data_cancel"), CallbackDeleteDataCancel),
+	))
+	send(s.BotAPI, msg)
+}
+
+// handleDeleteDataCallback handles the buttons under the /delete_my_data confirmation.
+// Confirming asks the hub to delete the user's data (see chathub command_delete_data), which
+// tells the user once it is done.
+func (s *BotService) handleDeleteDataCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	request(s.BotAPI, tgbotapi.NewCallback(callbackQuery.ID, ""))
+
+	chatID := callbackQuery.Message.Chat.ID
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		// The data was deleted already, e.g. by pressing the button twice.
+		log.Printf("Error getting user by telegram id: %v", err)
+		return
+	}
+	if callbackQuery.Data == CallbackDeleteDataCancel {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "delete_data_cancelled")))
+		return
+	}
+
+	c := s.getOrCreateClient(chatID)
+	if c == nil {
+		return
+	}
+	log.Printf("User %s confirmed the deletion of their data.", user.ID)
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		RoomID:   c.GetRoomID(),
+		Type:     "command_delete_data",
+	})
+}
@@ -0,0 +1,104 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultEventAnnounceInterval is how often the event schedule is reloaded and checked for
+// newly started events.
+const DefaultEventAnnounceInterval = time.Minute
+
+// handleEventsCommand processes the /events command, which toggles the user's opt-in to
+// themed event announcements and lists the events currently running.
+func (s *BotService) handleEventsCommand(chatID int64) {
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load user for TelegramID %d: %v", chatID, err)
+		return
+	}
+
+	subscribed, err := s.Storage.IsEventSubscriber(user.ID)
+	if err == nil {
+		err = s.Storage.SetEventSubscription(user.ID, !subscribed)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to toggle event subscription for user %s: %v", user.ID, err)
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "admin_action_failed")))
+		return
+	}
+
+	responseKey := "events_subscribed"
+	if subscribed {
+		responseKey = "events_unsubscribed"
+	}
+	text := s.Localizer.GetString(user.Language, responseKey)
+
+	if active := s.Events.Active(time.Now()); len(active) > 0 {
+		var lines []string
+		for _, event := range active {
+			lines = append(lines, "• "+event.AnnouncementFor(user.Language))
+		}
+		text += "\n\n" + s.Localizer.GetString(user.Language, "events_active") + "\n" + strings.Join(lines, "\n")
+	}
+	send(s.BotAPI, tgbotapi.NewMessage(chatID, text))
+}
+
+// RunEventAnnouncer periodically reloads the event schedule and announces newly started
+// events to opted-in users, until ctx is cancelled. This function is intended to be run as a
+// goroutine.
+func (s *BotService) RunEventAnnouncer(ctx context.Context, interval time.Duration) {
+	log.Println("Event announcer started.")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Events.Reload(); err != nil {
+			log.Printf("ERROR: Failed to reload event schedule: %v", err)
+		}
+		s.announceActiveEvents(time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("Event announcer stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// announceActiveEvents sends the announcement of every active event that has not been
+// announced yet to all subscribers.
+func (s *BotService) announceActiveEvents(now time.Time) {
+	for _, event := range s.Events.Active(now) {
+		first, err := s.Storage.MarkEventAnnounced(event.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to mark event %s as announced: %v", event.ID, err)
+			continue
+		}
+		if !first {
+			continue
+		}
+
+		subscribers, err := s.Storage.GetEventSubscribers()
+		if err != nil {
+			log.Printf("ERROR: Failed to load event subscribers: %v", err)
+			continue
+		}
+		for _, userID := range subscribers {
+			user, err := s.Storage.GetUserByID(userID)
+			if err != nil || user.TelegramID == 0 {
+				continue
+			}
+			text := s.Localizer.GetString(user.Language, "events_announcement_title") + "\n" + event.AnnouncementFor(user.Language)
+			if _, err := send(s.BotAPI, tgbotapi.NewMessage(user.TelegramID, text)); err != nil {
+				log.Printf("WARNING: Failed to announce event %s to user %s: %v", event.ID, userID, err)
+			}
+		}
+		log.Printf("INFO: Announced event %s to %d subscribers.", event.ID, len(subscribers))
+	}
+}
@@ -0,0 +1,87 @@
+package telegram
+
+import (
+	"errors"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeBotAPI is a BotAPI that records what the bot sends instead of calling Telegram.
+type fakeBotAPI struct {
+	mu       sync.Mutex
+	sent     []tgbotapi.Chattable
+	requests []tgbotapi.Chattable
+	// calls records the API methods called by name, with their parameters.
+	calls []fakeCall
+	// sendErr, if set, is returned by Send instead of sending.
+	sendErr error
+	// updates is returned by GetUpdatesChan.
+	updates chan tgbotapi.Update
+	// fileURL, if set, is the base URL of the files returned by GetFileDirectURL.
+	fileURL string
+}
+
+// fakeCall is an API method called through MakeRequest.
+type fakeCall struct {
+	endpoint string
+	params   tgbotapi.Params
+}
+
+func newFakeBotAPI() *fakeBotAPI {
+	return &fakeBotAPI{updates: make(chan tgbotapi.Update, 10)}
+}
+
+func (f *fakeBotAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sendErr != nil {
+		return tgbotapi.Message{}, f.sendErr
+	}
+	f.sent = append(f.sent, c)
+	return tgbotapi.Message{MessageID: len(f.sent)}, nil
+}
+
+func (f *fakeBotAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, c)
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeBotAPI) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fakeCall{endpoint: endpoint, params: params})
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeBotAPI) GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error) {
+	return tgbotapi.File{FileID: config.FileID}, nil
+}
+
+func (f *fakeBotAPI) GetFileDirectURL(fileID string) (string, error) {
+	if f.fileURL == "" {
+		return "", errors.New("no file URL")
+	}
+	return f.fileURL + "/" + fileID, nil
+}
+
+func (f *fakeBotAPI) GetUpdatesChan(tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	return f.updates
+}
+
+func (f *fakeBotAPI) StopReceivingUpdates() {}
+
+// sentMessages returns the plain messages sent so far.
+func (f *fakeBotAPI) sentMessages() []tgbotapi.MessageConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var messages []tgbotapi.MessageConfig
+	for _, c := range f.sent {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
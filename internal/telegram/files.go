@@ -0,0 +1,45 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/media"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// FileSource is a media.Source that downloads files relayed through Telegram by their file ID.
+type FileSource struct {
+	BotAPI BotAPI
+	// Client is the HTTP client used for the downloads.
+	Client *http.Client
+}
+
+// Open starts the download of a file. Errors never contain the download URL, which carries
+// the bot token.
+func (f *FileSource) Open(ctx context.Context, fileID string) (*media.File, error) {
+	fileURL, err := f.BotAPI.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to get file %s: %w", fileID, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("telegram: failed to create download of file %s", fileID)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("telegram: failed to download file %s: %w", fileID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("telegram: download of file %s failed with status %d", fileID, resp.StatusCode)
+	}
+	return &media.File{Body: resp.Body, Size: resp.ContentLength, Name: path.Base(req.URL.Path)}, nil
+}
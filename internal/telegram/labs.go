@@ -0,0 +1,88 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/localization"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CallbackLabsPrefix prefixes the callback data of the /labs buttons, followed by the feature
+// to switch on or off.
+const CallbackLabsPrefix = "labs_"
+
+// icebreakerCount is the number of conversation starters, localized as icebreaker_1 to
+// icebreaker_<icebreakerCount>.
+const icebreakerCount = 8
+
+// icebreaker returns a random conversation starter in a language, for users who opted into
+// features.Icebreakers.
+func icebreaker(localizer *localization.Localizer, lang string) string {
+	return localizer.GetString(lang, fmt.Sprintf("icebreaker_%d", rand.IntN(icebreakerCount)+1))
+}
+
+// handleLabsCommand shows the experimental features the user can opt into, with a button
+// per feature to switch it on or off for them.
+func (s *BotService) handleLabsCommand(chatID int64) {
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user by telegram id: %v", err)
+		return
+	}
+
+	offered := s.Features.Offered()
+	if len(offered) == 0 {
+		send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "labs_empty")))
+		return
+	}
+
+	lines := []string{s.Localizer.GetString(user.Language, "labs_view")}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(offered))
+	for _, feature := range offered {
+		name := s.Localizer.GetString(user.Language, "labs_"+feature)
+		lines = append(lines, fmt.Sprintf("• *%s* — %s", name, s.Localizer.GetString(user.Language, "labs_desc_"+feature)))
+
+		buttonKey := "btn_labs_off"
+		if user.HasLabFeature(feature) {
+			buttonKey = "btn_labs_on"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf(s.Localizer.GetString(user.Language, buttonKey), name), CallbackLabsPrefix+feature)))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("Error sending labs menu to %d: %v", chatID, err)
+	}
+}
+
+// handleLabsCallback switches an experimental feature on or off for the user who pressed its
+// button in /labs. Features that are no longer offered are ignored.
+func (s *BotService) handleLabsCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	request(s.BotAPI, tgbotapi.NewCallback(callbackQuery.ID, ""))
+
+	chatID := callbackQuery.Message.Chat.ID
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return
+	}
+
+	feature := strings.TrimPrefix(callbackQuery.Data, CallbackLabsPrefix)
+	if !s.Features.Available(feature) {
+		log.Printf("Ignoring unavailable lab feature %q from user %s", feature, user.ID)
+		return
+	}
+	enabled := !user.HasLabFeature(feature)
+	if err := s.Storage.SetUserLabFeature(user.ID, feature, enabled); err != nil {
+		log.Printf("ERROR: Failed to update lab feature %s of user %s: %v", feature, user.ID, err)
+		return
+	}
+	log.Printf("User %s switched lab feature %s to %v", user.ID, feature, enabled)
+	s.handleLabsCommand(chatID)
+}
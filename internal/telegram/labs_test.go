@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/features"
+	"chatgogo/backend/internal/localization"
+	"chatgogo/backend/internal/models"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labsStorage keeps a single user whose lab features can be toggled.
+type labsStorage struct {
+	BotStorage
+	user *models.User
+}
+
+func (s *labsStorage) GetUserByTelegramID(telegramID int64) (*models.User, error) {
+	user := *s.user
+	return &user, nil
+}
+
+func (s *labsStorage) SetUserLabFeature(userID, feature string, enabled bool) error {
+	features := s.user.LabFeatures[:0:0]
+	for _, f := range s.user.LabFeatures {
+		if f != feature {
+			features = append(features, f)
+		}
+	}
+	if enabled {
+		features = append(features, feature)
+	}
+	s.user.LabFeatures = features
+	return nil
+}
+
+func TestHandleLabsCallback(t *testing.T) {
+	l, err := localization.NewLocalizer("../localization")
+	require.NoError(t, err)
+	bot := newFakeBotAPI()
+	store := &labsStorage{user: &models.User{ID: "user_A", Language: "en"}}
+	flags := features.NewService()
+	s := &BotService{BotAPI: bot, Storage: store, Localizer: l, Features: flags}
+
+	press := func(data string) {
+		s.handleLabsCallback(&tgbotapi.CallbackQuery{
+			ID:      "cb",
+			Data:    data,
+			Message: &tgbotapi.Message{Chat: tgbotapi.Chat{ID: 12345}},
+		})
+	}
+
+	press(CallbackLabsPrefix + features.Icebreakers)
+	assert.True(t, flags.Enabled(store.user, features.Icebreakers))
+	sent := bot.sentMessages()
+	require.Len(t, sent, 1, "The menu is shown again")
+	keyboard := sent[0].ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	assert.Equal(t, "✅ Icebreakers", keyboard.InlineKeyboard[0][0].Text)
+
+	press(CallbackLabsPrefix + features.Icebreakers)
+	assert.Empty(t, store.user.LabFeatures)
+
+	flags.SetEnabled(features.Icebreakers, false)
+	press(CallbackLabsPrefix + features.Icebreakers)
+	assert.False(t, store.user.HasLabFeature(features.Icebreakers), "Switched-off features cannot be opted into")
+	assert.Len(t, bot.sentMessages(), 2)
+
+	press(CallbackLabsPrefix + "translation")
+	assert.Len(t, bot.sentMessages(), 2, "Unknown features are ignored")
+}
+
+func TestBuildTelegramMessageSuggestsIcebreakerToVolunteers(t *testing.T) {
+	client, store := newTestClient(t, newFakeBotAPI())
+	match := models.ChatMessage{Type: "system_match_found", Content: "system_match_found", RoomID: "room1", SenderID: "system"}
+
+	msg := client.buildTelegramMessage(12345, match).(tgbotapi.MessageConfig)
+	assert.Equal(t, client.Localizer.GetString("en", "system_match_found"), msg.Text)
+
+	store.labs = []string{features.Icebreakers}
+	msg = client.buildTelegramMessage(12345, match).(tgbotapi.MessageConfig)
+	assert.Contains(t, msg.Text, "💡")
+
+	client.Features = features.NewService()
+	client.Features.SetEnabled(features.Icebreakers, false)
+	msg = client.buildTelegramMessage(12345, match).(tgbotapi.MessageConfig)
+	assert.NotContains(t, msg.Text, "💡", "Switched-off features are off for volunteers too")
+}
@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/localization"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// menuButtons are the buttons of the in-chat menu, row by row, with the command each one
+// stands for.
+var menuButtons = [][]struct{ key, command string }{
+	{{"btn_menu_next", "next"}, {"btn_menu_stop", "stop"}},
+	{{"btn_menu_report", "report"}, {"btn_menu_settings", "settings"}},
+}
+
+// menuKeyboard builds the persistent reply keyboard with the most used chat actions, so
+// that users on mobile do not have to type commands mid-conversation.
+func menuKeyboard(l *localization.Localizer, lang string) tgbotapi.ReplyKeyboardMarkup {
+	rows := make([][]tgbotapi.KeyboardButton, 0, len(menuButtons))
+	for _, buttons := range menuButtons {
+		row := make([]tgbotapi.KeyboardButton, 0, len(buttons))
+		for _, button := range buttons {
+			row = append(row, tgbotapi.NewKeyboardButton(l.GetString(lang, button.key)))
+		}
+		rows = append(rows, row)
+	}
+	keyboard := tgbotapi.NewReplyKeyboard(rows...)
+	keyboard.IsPersistent = true
+	return keyboard
+}
+
+// menuCommand returns the command of a menu button label in any loaded language.
+func menuCommand(l *localization.Localizer, text string) (string, bool) {
+	for _, lang := range l.Languages() {
+		for _, buttons := range menuButtons {
+			for _, button := range buttons {
+				if text == l.GetString(lang, button.key) {
+					return button.command, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// applyMenuButton turns a menu button press into the command it stands for, so that it is
+// routed exactly like the typed command.
+func applyMenuButton(l *localization.Localizer, msg *tgbotapi.Message) {
+	if msg.Text == "" || msg.IsCommand() {
+		return
+	}
+	command, ok := menuCommand(l, msg.Text)
+	if !ok {
+		return
+	}
+	msg.Text = "/" + command
+	msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(msg.Text)}}
+}
+
+// handleMenuCommand shows the in-chat menu keyboard.
+func (s *BotService) handleMenuCommand(chatID int64) {
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user by telegram id: %v", err)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "menu_shown"))
+	msg.ReplyMarkup = menuKeyboard(s.Localizer, user.Language)
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("Error sending menu to %d: %v", chatID, err)
+	}
+}
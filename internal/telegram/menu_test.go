@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/localization"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMenuButton(t *testing.T) {
+	l, err := localization.NewLocalizer("../localization")
+	require.NoError(t, err)
+
+	for _, lang := range l.Languages() {
+		msg := &tgbotapi.Message{Text: l.GetString(lang, "btn_menu_next")}
+		applyMenuButton(l, msg)
+		assert.True(t, msg.IsCommand(), lang)
+		assert.Equal(t, "next", msg.Command(), lang)
+	}
+
+	msg := &tgbotapi.Message{Text: l.GetString("ua", "btn_menu_settings")}
+	applyMenuButton(l, msg)
+	assert.Equal(t, "settings", msg.Command())
+
+	msg = &tgbotapi.Message{Text: "next"}
+	applyMenuButton(l, msg)
+	assert.False(t, msg.IsCommand())
+	assert.Equal(t, "next", msg.Text)
+}
+
+func TestMenuKeyboard(t *testing.T) {
+	l, err := localization.NewLocalizer("../localization")
+	require.NoError(t, err)
+
+	keyboard := menuKeyboard(l, "en")
+	assert.True(t, keyboard.IsPersistent)
+	assert.True(t, keyboard.ResizeKeyboard)
+	require.Len(t, keyboard.Keyboard, 2)
+	assert.Equal(t, l.GetString("en", "btn_menu_next"), keyboard.Keyboard[0][0].Text)
+	assert.Equal(t, l.GetString("en", "btn_menu_settings"), keyboard.Keyboard[1][1].Text)
+}
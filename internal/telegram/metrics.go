@@ -0,0 +1,173 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/metrics"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MaxRateLimitRetries is how many times a request throttled by Telegram (HTTP 429) is
+// retried after the advertised delay before giving up.
+const MaxRateLimitRetries = 3
+
+// maxRetryAfter caps the delay honoured for a single 429 retry.
+const maxRetryAfter = 30 * time.Second
+
+// MaxTransientRetries is how many times a request that failed with a network error or a
+// Telegram server error (5xx) is retried, waiting transientRetryDelay and then twice as long
+// before each attempt.
+const MaxTransientRetries = 2
+
+// transientRetryDelay is the wait before the first retry of a transient failure.
+const transientRetryDelay = time.Second
+
+var (
+	updatesReceived = metrics.Default.NewCounterVec("chatgogo_telegram_updates_total",
+		"Telegram updates received, by update type.", "type")
+	commandsReceived = metrics.Default.NewCounterVec("chatgogo_telegram_commands_total",
+		"Bot commands received, by command.", "command")
+	sendResults = metrics.Default.NewCounterVec("chatgogo_telegram_sends_total",
+		"Telegram API calls, by result class.", "result")
+	rateLimitRetries = metrics.Default.NewCounterVec("chatgogo_telegram_rate_limit_retries_total",
+		"Telegram API calls retried after a 429 Too Many Requests response.")
+	transientRetries = metrics.Default.NewCounterVec("chatgogo_telegram_transient_retries_total",
+		"Telegram API calls retried after a network or server error.")
+)
+
+// knownCommands bounds the command label, so arbitrary user input does not create series.
+var knownCommands = map[string]bool{
+	"start": true, "stop": true, "next": true, "settings": true, "report": true, "block": true, "again": true, "status": true, "profile": true, "mute": true, "unmute": true, "link": true,
+	"language": true, "spoiler_on": true, "spoiler_off": true, "events": true, "menu": true, "labs": true, "delete_my_data": true,
+	"blacklist": true, "unblacklist": true, "confirm_complaint": true, "grant_premium": true,
+}
+
+// sleep waits before a retry. It is replaced in tests.
+var sleep = time.Sleep
+
+// recordUpdate counts a received update by type, and commands by name.
+func recordUpdate(update tgbotapi.Update) {
+	switch {
+	case update.EditedMessage != nil:
+		updatesReceived.Inc("edited_message")
+	case update.Message != nil && update.Message.IsCommand():
+		updatesReceived.Inc("command")
+		command := update.Message.Command()
+		if !knownCommands[command] {
+			command = "unknown"
+		}
+		commandsReceived.Inc(command)
+	case update.Message != nil:
+		updatesReceived.Inc("message")
+	case update.CallbackQuery != nil:
+		updatesReceived.Inc("callback_query")
+	default:
+		updatesReceived.Inc("other")
+	}
+}
+
+// sendErrorClass classifies the result of a Telegram API call for the send metrics.
+func sendErrorClass(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return "network"
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case apiErr.Code == http.StatusForbidden:
+		return "forbidden"
+	case apiErr.Code == http.StatusBadRequest:
+		return "bad_request"
+	case apiErr.Code >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "other"
+	}
+}
+
+// retryAfter returns how long to wait before retrying a throttled call, or false if err
+// is not a 429 response.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+	delay := time.Duration(apiErr.RetryAfter) * time.Second
+	if delay <= 0 {
+		delay = time.Second
+	}
+	return min(delay, maxRetryAfter), true
+}
+
+// isTransient reports whether a failed Telegram API call may succeed if retried: it failed
+// with a network error or a server error.
+func isTransient(err error) bool {
+	class := sendErrorClass(err)
+	return class == "network" || class == "server_error"
+}
+
+// callWithRetry runs a Telegram API call, retrying it after 429 responses and, with
+// exponential backoff, after transient failures, and records its final result. A call whose
+// response was lost to a network error may thus be made twice.
+func callWithRetry(call func() error) error {
+	err := call()
+	throttledRetries, failedRetries := 0, 0
+	for err != nil {
+		if delay, throttled := retryAfter(err); throttled && throttledRetries < MaxRateLimitRetries {
+			throttledRetries++
+			log.Printf("WARNING: Telegram rate limit hit, retrying in %v", delay)
+			rateLimitRetries.Inc()
+			sleep(delay)
+		} else if !throttled && isTransient(err) && failedRetries < MaxTransientRetries {
+			delay := transientRetryDelay << failedRetries
+			failedRetries++
+			log.Printf("WARNING: Telegram API call failed (%v), retrying in %v", err, delay)
+			transientRetries.Inc()
+			sleep(delay)
+		} else {
+			break
+		}
+		err = call()
+	}
+	sendResults.Inc(sendErrorClass(err))
+	return err
+}
+
+// send sends a message through the bot, retrying on rate limits and recording metrics.
+func send(bot BotAPI, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+	err := callWithRetry(func() (err error) {
+		msg, err = bot.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+// request makes a Telegram API request (e.g., answering a callback) through the bot,
+// retrying on rate limits and recording metrics.
+func request(bot BotAPI, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := callWithRetry(func() (err error) {
+		resp, err = bot.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+// makeRequest calls an API method by name through the bot, retrying on rate limits and
+// recording metrics.
+func makeRequest(bot BotAPI, endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := callWithRetry(func() (err error) {
+		resp, err = bot.MakeRequest(endpoint, params)
+		return err
+	})
+	return resp, err
+}
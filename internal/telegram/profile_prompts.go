@@ -0,0 +1,121 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// DefaultProfilePromptInterval is how often users with incomplete profiles are looked up
+	// and reminded to fill them in.
+	DefaultProfilePromptInterval = 6 * time.Hour
+	// ProfilePromptCooldown is the minimum time between two profile prompts to the same user.
+	ProfilePromptCooldown = 7 * 24 * time.Hour
+
+	// profilePromptBatchSize is the page size used when scanning incomplete profiles.
+	profilePromptBatchSize = 100
+	// profilePromptedAtAttr is the user attribute holding the Unix time of the last prompt.
+	profilePromptedAtAttr = "profile_prompted_at"
+)
+
+// profileFieldCallbacks maps missing profile fields to the one-tap edit flows of /profile.
+var profileFieldCallbacks = []struct {
+	field, callback, label string
+}{
+	{models.ProfileFieldAge, "edit_age", "btn_edit_age"},
+	{models.ProfileFieldGender, "edit_gender", "btn_edit_gender"},
+	{models.ProfileFieldInterests, "edit_interests", "btn_edit_interests"},
+}
+
+// maybePromptProfile asks a user with an incomplete profile to fill in the missing fields,
+// unless they were already prompted within ProfilePromptCooldown. It reports whether a
+// prompt was sent.
+func (s *BotService) maybePromptProfile(chatID int64, user *models.User) bool {
+	missing := user.MissingProfileFields()
+	if len(missing) == 0 {
+		return false
+	}
+
+	lastPrompt, err := s.Storage.GetUserAttribute(user.ID, profilePromptedAtAttr)
+	if err != nil {
+		return false
+	}
+	if unix, err := strconv.ParseInt(lastPrompt, 10, 64); err == nil && time.Since(time.Unix(unix, 0)) < ProfilePromptCooldown {
+		return false
+	}
+
+	isMissing := make(map[string]bool, len(missing))
+	for _, field := range missing {
+		isMissing[field] = true
+	}
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, entry := range profileFieldCallbacks {
+		if isMissing[entry.field] {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, entry.label), entry.callback))
+		}
+	}
+
+	text := fmt.Sprintf(s.Localizer.GetString(user.Language, "profile_prompt"), user.ProfileCompleteness())
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("WARNING: Failed to send profile prompt to user %s: %v", user.ID, err)
+		return false
+	}
+
+	if err := s.Storage.SetUserAttribute(user.ID, profilePromptedAtAttr, strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		log.Printf("ERROR: Failed to record profile prompt for user %s: %v", user.ID, err)
+	}
+	return true
+}
+
+// RunProfilePrompter periodically reminds users with incomplete profiles to fill them in,
+// until ctx is cancelled. This function is intended to be run as a goroutine.
+func (s *BotService) RunProfilePrompter(ctx context.Context, interval time.Duration) {
+	log.Println("Profile prompter started.")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Profile prompter stopped.")
+			return
+		case <-ticker.C:
+			s.promptIncompleteProfiles()
+		}
+	}
+}
+
+// promptIncompleteProfiles reminds the users with incomplete profiles to fill them in. Users
+// who are chatting are not interrupted.
+func (s *BotService) promptIncompleteProfiles() {
+	prompted := 0
+	for offset := 0; ; offset += profilePromptBatchSize {
+		users, err := s.Storage.GetIncompleteProfiles(offset, profilePromptBatchSize)
+		if err != nil {
+			break
+		}
+		for i := range users {
+			if roomID, err := s.Storage.GetActiveRoomIDForUser(users[i].ID); err != nil || roomID != "" {
+				continue
+			}
+			if s.maybePromptProfile(users[i].TelegramID, &users[i]) {
+				prompted++
+			}
+		}
+		if len(users) < profilePromptBatchSize {
+			break
+		}
+	}
+	if prompted > 0 {
+		log.Printf("INFO: Sent profile completeness prompts to %d users.", prompted)
+	}
+}
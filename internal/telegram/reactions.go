@@ -0,0 +1,46 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// tgReactionType is a reaction as the Bot API expects it in setMessageReaction.
+type tgReactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+// setReaction shows the partner's reaction on the user's message it reacts to, or removes
+// it if the reaction was taken back. The library has no config for setMessageReaction, so
+// the method is called by name.
+func (c *Client) setReaction(message models.ChatMessage) {
+	if message.ReplyToMessageID == nil || c.Storage == nil {
+		return
+	}
+	tgID, err := c.Storage.FindPartnerTelegramIDForReply(*message.ReplyToMessageID, c.UserID)
+	if err != nil || tgID == nil {
+		log.Printf("WARN: No Telegram message of user %s for reaction to message %d: %v", c.UserID, *message.ReplyToMessageID, err)
+		return
+	}
+
+	reactions := []tgReactionType{}
+	if message.Content != "" {
+		// Telegram lists its reaction emoji without the variation selector, e.g. "❤".
+		reactions = append(reactions, tgReactionType{Type: "emoji", Emoji: strings.TrimSuffix(message.Content, "\ufe0f")})
+	}
+	data, err := json.Marshal(reactions)
+	if err != nil {
+		return
+	}
+	params := tgbotapi.Params{"reaction": string(data)}
+	params.AddNonZero64("chat_id", c.AnonID)
+	params.AddNonZero("message_id", *tgID)
+	if _, err := makeRequest(c.BotAPI, "setMessageReaction", params); err != nil {
+		log.Printf("WARN: Failed to set reaction on message %d for %d: %v", *tgID, c.AnonID, err)
+	}
+}
@@ -0,0 +1,47 @@
+package telegram
+
+// DefaultSendWorkers is the number of workers that deliver messages to Telegram users, unless
+// configured otherwise.
+const DefaultSendWorkers = 16
+
+// DefaultSendBuffer is the capacity of a client's send channel, unless configured otherwise.
+const DefaultSendBuffer = 10
+
+// sendQueueSize is the number of deliveries each worker of a SendPool buffers before Submit
+// blocks.
+const sendQueueSize = 64
+
+// SendPool delivers outbound messages to Telegram users with a fixed number of workers, so
+// that the number of goroutines blocked on the Bot API does not grow with the number of
+// chats. The deliveries of a chat always go to the same worker and are made in the order
+// they were submitted; the deliveries of different chats are made concurrently, unless they
+// share a worker.
+type SendPool struct {
+	queues []chan func()
+}
+
+// NewSendPool creates a SendPool and starts its workers.
+func NewSendPool(workers int) *SendPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &SendPool{queues: make([]chan func(), workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), sendQueueSize)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// Submit queues a delivery to a chat. It blocks while the queue of the chat's worker is full,
+// which slows down the chats of that worker instead of buffering without bound.
+func (p *SendPool) Submit(chatID int64, delivery func()) {
+	p.queues[uint64(chatID)%uint64(len(p.queues))] <- delivery
+}
+
+// work makes the deliveries of a queue one after another.
+func (p *SendPool) work(queue <-chan func()) {
+	for delivery := range queue {
+		delivery()
+	}
+}
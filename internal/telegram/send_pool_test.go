@@ -0,0 +1,53 @@
+package telegram
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendPoolKeepsChatOrder(t *testing.T) {
+	pool := NewSendPool(4)
+	var mu sync.Mutex
+	delivered := map[int64][]int{}
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		for chatID := int64(1); chatID <= 3; chatID++ {
+			wg.Add(1)
+			pool.Submit(chatID, func() {
+				defer wg.Done()
+				mu.Lock()
+				delivered[chatID] = append(delivered[chatID], i)
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	for chatID := int64(1); chatID <= 3; chatID++ {
+		if assert.Len(t, delivered[chatID], 50) {
+			for i, n := range delivered[chatID] {
+				assert.Equal(t, i, n, "chat %d", chatID)
+			}
+		}
+	}
+}
+
+func TestSendPoolDeliversOtherChatsWhileOneIsStuck(t *testing.T) {
+	pool := NewSendPool(2)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	pool.Submit(2, func() { <-stuck })
+
+	done := make(chan struct{})
+	pool.Submit(1, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("chat 1 waited for the delivery to chat 2")
+	}
+}
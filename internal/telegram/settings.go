@@ -0,0 +1,270 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/models"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StateWaitingForAgeRange is the user state while a custom partner age range is entered.
+const StateWaitingForAgeRange = "waiting_for_age_range"
+
+// CallbackPrefPrefix prefixes the callback data of the /settings search preference buttons.
+const CallbackPrefPrefix = "pref_"
+
+// agePresets are the partner age ranges offered as one-tap buttons in /settings.
+var agePresets = []struct{ min, max int }{
+	{18, 25}, {26, 35}, {36, 0},
+}
+
+// countSettingsCommand passes a /settings of a user to the hub, which counts it in the
+// command usage analytics.
+func (s *BotService) countSettingsCommand(chatID int64) {
+	c := s.getOrCreateClient(chatID)
+	if c == nil {
+		return
+	}
+	s.Hub.Submit(models.ChatMessage{
+		SenderID: c.GetUserID(),
+		RoomID:   c.GetRoomID(),
+		Type:     "command_settings",
+	})
+}
+
+// handleSettingsCommand shows the user's search preferences with buttons to change them.
+// The preferences are applied to every search started with /start or /next. The auto
+// re-queue toggle decides whether the user searches again when their partner leaves with /next,
+// and the timezone toggle restricts partners to regions near the user's own. The privacy
+// toggles hide the user's typing and online status from partners.
+func (s *BotService) handleSettingsCommand(chatID int64) {
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user by telegram id: %v", err)
+		return
+	}
+
+	autoRequeue := user.WantsAutoRequeue(s.RequeueAbandonedPartner)
+	autoRequeueLabel, autoRequeueButton, autoRequeueData := "pref_off", "btn_pref_requeue_on", "pref_requeue_on"
+	if autoRequeue {
+		autoRequeueLabel, autoRequeueButton, autoRequeueData = "pref_on", "btn_pref_requeue_off", "pref_requeue_off"
+	}
+	nearTimezoneLabel, nearTimezoneButton, nearTimezoneData := "pref_off", "btn_pref_tz_on", "pref_tz_on"
+	if user.PreferNearTimezone {
+		nearTimezoneLabel, nearTimezoneButton, nearTimezoneData = "pref_on", "btn_pref_tz_off", "pref_tz_off"
+	}
+	hideTypingLabel, hideTypingButton, hideTypingData := "pref_off", "btn_pref_hide_typing_on", "pref_hide_typing_on"
+	if user.HideTyping {
+		hideTypingLabel, hideTypingButton, hideTypingData = "pref_on", "btn_pref_hide_typing_off", "pref_hide_typing_off"
+	}
+	hidePresenceLabel, hidePresenceButton, hidePresenceData := "pref_off", "btn_pref_hide_presence_on", "pref_hide_presence_on"
+	if user.HidePresence {
+		hidePresenceLabel, hidePresenceButton, hidePresenceData = "pref_on", "btn_pref_hide_presence_off", "pref_hide_presence_off"
+	}
+	text := fmt.Sprintf(s.Localizer.GetString(user.Language, "settings_view"),
+		s.preferredGenderLabel(user), s.preferredAgeLabel(user), s.Localizer.GetString(user.Language, autoRequeueLabel),
+		s.regionLabel(user), s.Localizer.GetString(user.Language, nearTimezoneLabel),
+		s.Localizer.GetString(user.Language, hideTypingLabel), s.Localizer.GetString(user.Language, hidePresenceLabel))
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+
+	ageRow := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "pref_age_any"), "pref_age_any"),
+	}
+	for _, preset := range agePresets {
+		ageRow = append(ageRow, tgbotapi.NewInlineKeyboardButtonData(
+			formatAgeRange(preset.min, preset.max), fmt.Sprintf("pref_age_%d_%d", preset.min, preset.max)))
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "pref_gender_any"), "pref_gender_any"),
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "gender_male"), "pref_gender_male"),
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "gender_female"), "pref_gender_female"),
+		),
+		ageRow,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_pref_age_custom"), "pref_age_custom"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, autoRequeueButton), autoRequeueData),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, "btn_pref_region"), "pref_region"),
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, nearTimezoneButton), nearTimezoneData),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, hideTypingButton), hideTypingData),
+			tgbotapi.NewInlineKeyboardButtonData(s.Localizer.GetString(user.Language, hidePresenceButton), hidePresenceData),
+		),
+	)
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("Error sending settings to %d: %v", chatID, err)
+	}
+}
+
+// handleRegionPrompt offers the coarse regions a user can pick, and an option to clear it.
+func (s *BotService) handleRegionPrompt(chatID int64, user *models.User) {
+	msg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "prompt_region"))
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(models.Regions)+1)
+	for _, region := range models.Regions {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			s.Localizer.GetString(user.Language, "region_"+region.Code), "pref_region_"+region.Code)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+		s.Localizer.GetString(user.Language, "region_none"), "pref_region_none")))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := send(s.BotAPI, msg); err != nil {
+		log.Printf("Error sending region prompt to %d: %v", chatID, err)
+	}
+}
+
+// handleSettingsCallback handles the search preference buttons of /settings.
+func (s *BotService) handleSettingsCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	chatID := callbackQuery.Message.Chat.ID
+	user, err := s.Storage.GetUserByTelegramID(chatID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return
+	}
+
+	// Answer the callback query to stop the loading animation
+	request(s.BotAPI, tgbotapi.NewCallback(callbackQuery.ID, ""))
+
+	gender, ageMin, ageMax := user.PreferredGender, user.PreferredAgeMin, user.PreferredAgeMax
+	data := strings.TrimPrefix(callbackQuery.Data, CallbackPrefPrefix)
+	switch {
+	case data == "gender_any":
+		gender = ""
+	case data == "gender_male", data == "gender_female":
+		gender = strings.TrimPrefix(data, "gender_")
+	case data == "requeue_on", data == "requeue_off":
+		if err := s.Storage.UpdateUserAutoRequeue(user.ID, data == "requeue_on"); err != nil {
+			log.Printf("ERROR: Failed to update auto re-queue preference of user %s: %v", user.ID, err)
+			return
+		}
+		s.handleSettingsCommand(chatID)
+		return
+	case data == "hide_typing_on", data == "hide_typing_off":
+		if err := s.Storage.UpdateUserHideTyping(user.ID, data == "hide_typing_on"); err != nil {
+			log.Printf("ERROR: Failed to update typing privacy of user %s: %v", user.ID, err)
+			return
+		}
+		s.handleSettingsCommand(chatID)
+		return
+	case data == "hide_presence_on", data == "hide_presence_off":
+		if err := s.Storage.UpdateUserHidePresence(user.ID, data == "hide_presence_on"); err != nil {
+			log.Printf("ERROR: Failed to update presence privacy of user %s: %v", user.ID, err)
+			return
+		}
+		s.handleSettingsCommand(chatID)
+		return
+	case data == "region":
+		s.handleRegionPrompt(chatID, user)
+		return
+	case strings.HasPrefix(data, "region_"):
+		region := strings.TrimPrefix(data, "region_")
+		if region == "none" {
+			region = ""
+		} else if _, ok := models.RegionByCode(region); !ok {
+			log.Printf("Ignoring invalid region %q from user %s", callbackQuery.Data, user.ID)
+			return
+		}
+		if err := s.Storage.UpdateUserRegion(user.ID, region); err != nil {
+			log.Printf("ERROR: Failed to update region of user %s: %v", user.ID, err)
+			return
+		}
+		s.handleSettingsCommand(chatID)
+		return
+	case data == "tz_on", data == "tz_off":
+		if err := s.Storage.UpdateUserNearTimezone(user.ID, data == "tz_on"); err != nil {
+			log.Printf("ERROR: Failed to update timezone preference of user %s: %v", user.ID, err)
+			return
+		}
+		if data == "tz_on" && user.Region == "" {
+			// The preference only applies once a region is known.
+			s.handleRegionPrompt(chatID, user)
+			return
+		}
+		s.handleSettingsCommand(chatID)
+		return
+	case data == "age_any":
+		ageMin, ageMax = 0, 0
+	case data == "age_custom":
+		s.Storage.SetUserState(user.ID, StateWaitingForAgeRange)
+		sentMsg, _ := send(s.BotAPI, tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "prompt_age_range")))
+		s.Storage.SetUserAttribute(user.ID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
+		return
+	case strings.HasPrefix(data, "age_"):
+		var ok bool
+		ageMin, ageMax, ok = models.ParseAgeRange(strings.ReplaceAll(strings.TrimPrefix(data, "age_"), "_", "-"))
+		if !ok {
+			log.Printf("Ignoring invalid age preset %q from user %s", callbackQuery.Data, user.ID)
+			return
+		}
+	default:
+		return
+	}
+
+	if err := s.Storage.UpdateUserSearchPreferences(user.ID, gender, ageMin, ageMax); err != nil {
+		log.Printf("ERROR: Failed to update search preferences of user %s: %v", user.ID, err)
+		return
+	}
+	s.handleSettingsCommand(chatID)
+}
+
+// handleAgeRangeInput stores a custom partner age range entered after "pref_age_custom".
+func (s *BotService) handleAgeRangeInput(chatID int64, user *models.User, text string) {
+	ageMin, ageMax, ok := models.ParseAgeRange(text)
+	if !ok {
+		errMsg := tgbotapi.NewMessage(chatID, s.Localizer.GetString(user.Language, "invalid_age_range"))
+		sentMsg, _ := send(s.BotAPI, errMsg)
+		s.Storage.SetUserAttribute(user.ID, "last_prompt_msg_id", strconv.Itoa(sentMsg.MessageID))
+		return
+	}
+	if err := s.Storage.UpdateUserSearchPreferences(user.ID, user.PreferredGender, ageMin, ageMax); err != nil {
+		log.Printf("ERROR: Failed to update search preferences of user %s: %v", user.ID, err)
+	}
+	s.Storage.ClearUserState(user.ID)
+	s.handleSettingsCommand(chatID)
+}
+
+// formatAgeRange renders a partner age range, e.g. "18–30", "36+" or "≤30".
+func formatAgeRange(ageMin, ageMax int) string {
+	switch {
+	case ageMax == 0:
+		return fmt.Sprintf("%d+", ageMin)
+	case ageMin == 0:
+		return fmt.Sprintf("≤%d", ageMax)
+	}
+	return fmt.Sprintf("%d–%d", ageMin, ageMax)
+}
+
+// preferredGenderLabel returns the localized partner gender preference of a user.
+func (s *BotService) preferredGenderLabel(user *models.User) string {
+	switch user.PreferredGender {
+	case "":
+		return s.Localizer.GetString(user.Language, "pref_gender_any")
+	case "male", "female":
+		return s.Localizer.GetString(user.Language, "gender_"+user.PreferredGender)
+	}
+	return user.PreferredGender
+}
+
+// regionLabel returns the localized region of a user.
+func (s *BotService) regionLabel(user *models.User) string {
+	if _, ok := models.RegionByCode(user.Region); !ok {
+		return s.Localizer.GetString(user.Language, "region_none")
+	}
+	return s.Localizer.GetString(user.Language, "region_"+user.Region)
+}
+
+// preferredAgeLabel returns the localized partner age preference of a user.
+func (s *BotService) preferredAgeLabel(user *models.User) string {
+	if user.PreferredAgeMin == 0 && user.PreferredAgeMax == 0 {
+		return s.Localizer.GetString(user.Language, "pref_age_any")
+	}
+	return formatAgeRange(user.PreferredAgeMin, user.PreferredAgeMax)
+}
@@ -0,0 +1,13 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAgeRange(t *testing.T) {
+	assert.Equal(t, "18–30", formatAgeRange(18, 30))
+	assert.Equal(t, "36+", formatAgeRange(36, 0))
+	assert.Equal(t, "≤40", formatAgeRange(0, 40))
+}
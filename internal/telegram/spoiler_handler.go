@@ -17,7 +17,7 @@ type SpoilerStorage interface {
 
 // HandleSpoilerCommand processes /spoiler_on and /spoiler_off commands.
 // It updates the user's preference in the storage and sends a confirmation message.
-func HandleSpoilerCommand(ctx context.Context, update *tgbotapi.Update, s SpoilerStorage, bot *tgbotapi.BotAPI) {
+func HandleSpoilerCommand(ctx context.Context, update *tgbotapi.Update, s SpoilerStorage, bot BotAPI) {
 	if update.Message == nil {
 		return
 	}
@@ -52,7 +52,7 @@ func HandleSpoilerCommand(ctx context.Context, update *tgbotapi.Update, s Spoile
 
 	// Send confirmation
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, responseText)
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := send(bot, msg); err != nil {
 		log.Printf("Error sending spoiler confirmation: %v", err)
 	}
 }
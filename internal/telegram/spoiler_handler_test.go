@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -48,15 +49,16 @@ func TestHandleSpoilerCommand_On(t *testing.T) {
 	mockStorage.On("SaveUserIfNotExists", int64(12345)).Return(user, nil)
 	mockStorage.On("UpdateUserMediaSpoiler", "user-uuid", true).Return(nil)
 
-	// Act
-	// Note: This will panic on bot.Send if bot is nil.
-	// In a real test environment, we'd use a mock server for Telegram or a wrapper.
-	// I'll add a comment about this limitation.
-	// HandleSpoilerCommand(ctx, update, mockStorage, nil)
+	bot := newFakeBotAPI()
 
-	// Silence unused variables for compilation
-	_ = ctx
-	_ = update
+	// Act
+	HandleSpoilerCommand(ctx, update, mockStorage, bot)
 
-	// mockStorage.AssertExpectations(t)
+	// Assert
+	mockStorage.AssertExpectations(t)
+	sent := bot.sentMessages()
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, int64(12345), sent[0].ChatID)
+		assert.Contains(t, sent[0].Text, "spoiler enabled")
+	}
 }
@@ -2,26 +2,57 @@ package telegram
 
 import (
 	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/features"
 	"chatgogo/backend/internal/localization"
 	"chatgogo/backend/internal/models"
-	"chatgogo/backend/internal/storage"
+	"chatgogo/backend/internal/timefmt"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// ClientStorage is the part of storage.Storage a Client uses.
+type ClientStorage interface {
+	GetUserByID(userID string) (*models.User, error)
+	SaveTgMessageID(historyID uint, anonID string, tgMsgID int) error
+	FindPartnerTelegramIDForReply(originalHistoryID uint, currentRecipientAnonID string) (*int, error)
+	FindHistoryByID(id uint) (*models.ChatHistory, error)
+}
+
 // Client implements the chathub.Client interface for Telegram users.
 type Client struct {
 	UserID    string // Internal UUID
 	AnonID    int64  // Telegram Chat ID
 	RoomID    string
-	Hub       *chathub.ManagerService
+	Hub       chathub.Hub
 	Send      chan models.ChatMessage
-	BotAPI    *tgbotapi.BotAPI
-	Storage   storage.Storage
+	BotAPI    BotAPI
+	Storage   ClientStorage
 	Localizer *localization.Localizer
+	// Features decides whether the user gets experimental features. It may be nil, in which
+	// case all of them are switched on for users who opted in.
+	Features *features.Service
+
+	// botBlocked is set once Telegram reports that the user blocked the bot.
+	// Further messages are dropped instead of retried. It is only used by deliveries.
+	botBlocked bool
+	// language is the language of the user's last delivery, used once the user can no longer
+	// be loaded, e.g. to tell them that their data was deleted. It is only used by deliveries.
+	language string
+	// pumps, if set, tracks the client's write pump (see BotService.WaitForClients).
+	pumps *sync.WaitGroup
+	// pool, if set, makes the client's deliveries; otherwise the write pump makes them.
+	pool *SendPool
+	// pending tracks the deliveries submitted to pool that were not made yet.
+	pending sync.WaitGroup
 }
 
 // GetUserID returns the client's internal user ID.
@@ -33,14 +64,20 @@ func (c *Client) GetRoomID() string { return c.RoomID }
 // SetRoomID sets the client's current room ID.
 func (c *Client) SetRoomID(id string) { c.RoomID = id }
 
+// Transport returns chathub.TransportTelegram.
+func (c *Client) Transport() string { return chathub.TransportTelegram }
+
 // GetSendChannel returns the client's outbound message channel.
 func (c *Client) GetSendChannel() chan<- models.ChatMessage { return c.Send }
 
 // applyDefaultSpoiler checks if the user has default spoilers enabled and applies it to the message.
-func (c *Client) applyDefaultSpoiler(msg tgbotapi.Chattable) tgbotapi.Chattable {
-	user, err := c.Storage.GetUserByID(c.UserID)
-	if err != nil || user == nil || !user.DefaultMediaSpoiler {
-		return msg
+// If forced is true (e.g., in safe-mode rooms), the spoiler is applied regardless of the setting.
+func (c *Client) applyDefaultSpoiler(msg tgbotapi.Chattable, forced bool) tgbotapi.Chattable {
+	if !forced {
+		user, err := c.Storage.GetUserByID(c.UserID)
+		if err != nil || user == nil || !user.DefaultMediaSpoiler {
+			return msg
+		}
 	}
 
 	v := reflect.ValueOf(msg)
@@ -63,7 +100,12 @@ func (c *Client) applyDefaultSpoiler(msg tgbotapi.Chattable) tgbotapi.Chattable
 }
 
 // Run starts the client's write pump.
-func (c *Client) Run() { go c.writePump() }
+func (c *Client) Run() {
+	if c.pumps != nil {
+		c.pumps.Add(1)
+	}
+	go c.writePump()
+}
 
 // Close closes the client's send channel.
 func (c *Client) Close() { close(c.Send) }
@@ -78,8 +120,12 @@ func (c *Client) setReplyID(tgMsg tgbotapi.Chattable, originalHistoryID uint) tg
 	if err != nil || replyTgIDUint == nil {
 		return tgMsg
 	}
-	replyTgID := int(*replyTgIDUint)
+	return withReplyTo(tgMsg, int(*replyTgIDUint))
+}
 
+// withReplyTo sets the ReplyToMessageID field of a Telegram message to the given Telegram
+// message ID, if the message type supports replies.
+func withReplyTo(tgMsg tgbotapi.Chattable, replyTgID int) tgbotapi.Chattable {
 	v := reflect.ValueOf(tgMsg)
 	if v.Kind() == reflect.Struct {
 		ptr := reflect.New(v.Type())
@@ -103,9 +149,15 @@ func escapeMarkdownV2(text string) string {
 	return text
 }
 
-// writePump pumps messages from the hub to the Telegram user.
+// writePump pumps messages from the hub to the Telegram user. The messages to deliver are
+// handed to the client's send pool, if it has one, and the pump stops once all of them were
+// delivered.
 func (c *Client) writePump() {
 	defer log.Printf("Stopping writePump for Telegram client %d (User: %s)", c.AnonID, c.UserID)
+	if c.pumps != nil {
+		defer c.pumps.Done()
+	}
+	defer c.pending.Wait()
 
 	for message := range c.Send {
 		if message.SenderID == c.UserID && message.Type != "system_info" {
@@ -115,28 +167,142 @@ func (c *Client) writePump() {
 		if c.AnonID == 0 {
 			continue
 		}
-
-		tgMsg := c.buildTelegramMessage(c.AnonID, message)
-		if tgMsg == nil {
+		// Telegram cannot show that a message was seen, nor tell the bot when its user read one.
+		if message.Type == "system_seen" {
 			continue
 		}
+		c.dispatch(message)
+	}
+}
 
-		if message.ReplyToMessageID != nil {
-			tgMsg = c.setReplyID(tgMsg, *message.ReplyToMessageID)
+// dispatch delivers a message on the client's send pool, or right away if it has none.
+func (c *Client) dispatch(message models.ChatMessage) {
+	if c.pool == nil {
+		c.deliverMessage(message)
+		return
+	}
+	c.pending.Add(1)
+	c.pool.Submit(c.AnonID, func() {
+		defer c.pending.Done()
+		c.deliverMessage(message)
+	})
+}
+
+// deliverMessage delivers a message from the hub to the Telegram user, unless the user
+// blocked the bot.
+func (c *Client) deliverMessage(message models.ChatMessage) {
+	if c.botBlocked {
+		return
+	}
+	// The partner's reaction is set on the user's own message it reacts to.
+	if message.Type == "reaction" {
+		c.setReaction(message)
+		return
+	}
+	// The partner's typing is shown as the chat action, which Telegram clears on its own.
+	if message.Type == "typing" {
+		if _, err := request(c.BotAPI, tgbotapi.NewChatAction(c.AnonID, tgbotapi.ChatTyping)); err != nil {
+			log.Printf("WARN: Failed to send typing action to %d: %v", c.AnonID, err)
 		}
+		return
+	}
 
-		sentMsg, err := c.BotAPI.Send(tgMsg)
+	// Texts over Telegram's limits are sent in parts; only the first part replies to the
+	// original message and is linked to the history entry. The overflow of a long caption
+	// is sent as a reply to its media.
+	mediaTgID := 0
+	for i, part := range messageParts(message) {
+		replyTo := 0
+		if i > 0 && message.Type != "text" {
+			replyTo = mediaTgID
+		}
+		sentID, err := c.deliver(part, i == 0, replyTo)
 		if err != nil {
-			log.Printf("ERROR: Failed to send Telegram message to %d: %v", c.AnonID, err)
-			continue
+			c.reportDeliveryFailure(message, err)
+			return
 		}
+		if i == 0 {
+			mediaTgID = sentID
+		}
+	}
+}
 
-		if message.ID != 0 && c.Storage != nil {
-			if err := c.Storage.SaveTgMessageID(uint(message.ID), c.UserID, sentMsg.MessageID); err != nil {
-				log.Printf("ERROR: Failed to save Telegram Message ID %d for history %d: %v", sentMsg.MessageID, message.ID, err)
-			}
+// deliver sends a single message to the Telegram user. If first is false, the message is
+// a continuation part and is not linked to its history entry; it replies to the Telegram
+// message replyTo instead, if set. It returns the Telegram ID of the sent message, or the
+// error that made delivery fail.
+func (c *Client) deliver(message models.ChatMessage, first bool, replyTo int) (int, error) {
+	tgMsg := c.buildTelegramMessage(c.AnonID, message)
+	if tgMsg == nil {
+		return 0, errUndeliverable
+	}
+
+	if first && message.ReplyToMessageID != nil {
+		tgMsg = c.setReplyID(tgMsg, *message.ReplyToMessageID)
+	} else if replyTo != 0 {
+		tgMsg = withReplyTo(tgMsg, replyTo)
+	}
+
+	sentMsg, err := send(c.BotAPI, tgMsg)
+	if err != nil {
+		if isBotBlockedError(err) {
+			c.handleBotBlocked()
+			return 0, err
+		}
+		log.Printf("ERROR: Failed to send Telegram message to %d: %v", c.AnonID, err)
+		return 0, err
+	}
+
+	if first && message.ID != 0 && c.Storage != nil {
+		if err := c.Storage.SaveTgMessageID(uint(message.ID), c.UserID, sentMsg.MessageID); err != nil {
+			log.Printf("ERROR: Failed to save Telegram Message ID %d for history %d: %v", sentMsg.MessageID, message.ID, err)
 		}
 	}
+	return sentMsg.MessageID, nil
+}
+
+// errUndeliverable is returned by deliver for messages that cannot be turned into a
+// Telegram message.
+var errUndeliverable = errors.New("message cannot be sent to Telegram")
+
+// reportDeliveryFailure tells the hub that a message from the partner could not be
+// delivered, so that the partner learns it was lost. Like handleBotBlocked, the report is
+// sent asynchronously.
+func (c *Client) reportDeliveryFailure(message models.ChatMessage, err error) {
+	if message.SenderID == c.UserID || strings.HasPrefix(message.Type, "system_") {
+		return
+	}
+	reason := chathub.DeliveryFailedError
+	if isBotBlockedError(err) {
+		reason = chathub.DeliveryFailedBlocked
+	}
+	failure := chathub.DeliveryFailure(c.UserID, message, reason)
+	go c.Hub.Submit(failure)
+}
+
+// isBotBlockedError reports whether a Telegram API error means the user blocked the bot
+// (or otherwise made the chat unreachable, e.g., by deleting their account).
+func isBotBlockedError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusForbidden
+}
+
+// handleBotBlocked stops delivery to a user who blocked the bot and asks the hub to
+// deactivate them. The request is sent asynchronously, as the hub may itself be waiting
+// to deliver to this client.
+func (c *Client) handleBotBlocked() {
+	c.botBlocked = true
+	log.Printf("INFO: Telegram user %d (User: %s) blocked the bot, stopping delivery.", c.AnonID, c.UserID)
+
+	message := models.ChatMessage{
+		Type:     "command_bot_blocked",
+		SenderID: c.UserID,
+		RoomID:   c.RoomID,
+	}
+	go c.Hub.Submit(message)
 }
 
 // buildTelegramMessage constructs a `tgbotapi.Chattable` from a `models.ChatMessage`.
@@ -144,9 +310,13 @@ func (c *Client) buildTelegramMessage(chatID int64, message models.ChatMessage)
 	user, err := c.Storage.GetUserByID(c.UserID)
 	if err != nil {
 		log.Printf("Error getting user by id: %v", err)
-		// Fallback to English if user not found
-		user = &models.User{Language: "en"}
+		// Fall back to the language of the last delivery, or to English if there was none.
+		user = &models.User{Language: c.language}
+		if user.Language == "" {
+			user.Language = "en"
+		}
 	}
+	c.language = user.Language
 
 	const parseMode = tgbotapi.ModeMarkdown
 	var content string
@@ -178,7 +348,12 @@ func (c *Client) buildTelegramMessage(chatID int64, message models.ChatMessage)
 	}
 
 	switch message.Type {
-	case "text", "system_info":
+	case "text":
+		// User texts keep their own formatting entities instead of being parsed as Markdown.
+		msg := tgbotapi.NewMessage(chatID, message.Content)
+		msg.Entities = toTgEntities(message.Entities)
+		return msg
+	case "system_info", "system_error":
 		msg := tgbotapi.NewMessage(chatID, content)
 		msg.ParseMode = parseMode
 		return msg
@@ -199,21 +374,21 @@ func (c *Client) buildTelegramMessage(chatID int64, message models.ChatMessage)
 			return nil
 		}
 		fileID := tgbotapi.FileID(message.Content)
-		caption := escapeMarkdownV2(message.Metadata)
+		caption, entities := message.Metadata, toTgEntities(message.Entities)
 
 		switch message.Type {
 		case "photo":
 			msg := tgbotapi.NewPhoto(chatID, fileID)
-			msg.Caption, msg.ParseMode = caption, parseMode
-			return c.applyDefaultSpoiler(msg)
+			msg.Caption, msg.CaptionEntities = caption, entities
+			return c.applyDefaultSpoiler(msg, message.Spoiler)
 		case "video":
 			msg := tgbotapi.NewVideo(chatID, fileID)
-			msg.Caption, msg.ParseMode = caption, parseMode
-			return c.applyDefaultSpoiler(msg)
+			msg.Caption, msg.CaptionEntities = caption, entities
+			return c.applyDefaultSpoiler(msg, message.Spoiler)
 		case "animation":
 			msg := tgbotapi.NewAnimation(chatID, fileID)
-			msg.Caption, msg.ParseMode = caption, parseMode
-			return c.applyDefaultSpoiler(msg)
+			msg.Caption, msg.CaptionEntities = caption, entities
+			return c.applyDefaultSpoiler(msg, message.Spoiler)
 		}
 	case "sticker":
 		return tgbotapi.NewSticker(chatID, tgbotapi.FileID(message.Content))
@@ -227,8 +402,15 @@ func (c *Client) buildTelegramMessage(chatID int64, message models.ChatMessage)
 		return msg
 	case "system_match_found":
 		c.RoomID = message.RoomID
+		if message.Metadata != "" {
+			content += "\n" + c.Localizer.GetString(user.Language, "trust_badge_"+message.Metadata)
+		}
+		if c.Features.Enabled(user, features.Icebreakers) {
+			content += "\n\n" + fmt.Sprintf(c.Localizer.GetString(user.Language, "icebreaker_suggestion"), icebreaker(c.Localizer, user.Language))
+		}
 		msg := tgbotapi.NewMessage(chatID, content)
 		msg.ParseMode = parseMode
+		msg.ReplyMarkup = menuKeyboard(c.Localizer, user.Language)
 		return msg
 	case "system_match_stop_self":
 		c.RoomID = ""
@@ -240,6 +422,102 @@ func (c *Client) buildTelegramMessage(chatID int64, message models.ChatMessage)
 		msg := tgbotapi.NewMessage(chatID, content)
 		msg.ParseMode = parseMode
 		return msg
+	case "system_ghost_skip_offer":
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_skip_next"), CallbackGhostSkip),
+			),
+		)
+		return msg
+	case "system_again_offer":
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_again"), CallbackAgain),
+			),
+		)
+		return msg
+	case "system_report_choice":
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_report_end"), CallbackReportEndPrefix+message.RoomID),
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_report_continue"), CallbackReportContinuePrefix+message.RoomID),
+			),
+		)
+		return msg
+	case "system_filters_relaxed":
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_keep_filters"), CallbackKeepFilters),
+			),
+		)
+		return msg
+	case "system_queue_status":
+		var position, total int
+		if _, err := fmt.Sscanf(message.Metadata, "%d/%d", &position, &total); err != nil {
+			log.Printf("ERROR: Invalid queue status %q: %v", message.Metadata, err)
+			return nil
+		}
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(content, position, total))
+		msg.ParseMode = parseMode
+		return msg
+	case "system_skip_cooldown":
+		minutes, err := strconv.Atoi(message.Metadata)
+		if err != nil {
+			log.Printf("ERROR: Invalid skip cooldown %q: %v", message.Metadata, err)
+			return nil
+		}
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(content, timefmt.In(user.Language, time.Duration(minutes)*time.Minute)))
+		msg.ParseMode = parseMode
+		return msg
+	case "system_long_wait":
+		if message.Metadata != "" {
+			minutes, err := strconv.Atoi(message.Metadata)
+			if err != nil {
+				log.Printf("ERROR: Invalid expected wait %q: %v", message.Metadata, err)
+				return nil
+			}
+			content = fmt.Sprintf(content, timefmt.Duration(user.Language, time.Duration(minutes)*time.Minute))
+		}
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		return msg
+	case "system_banned":
+		if message.Metadata != "" {
+			end, err := time.Parse(time.RFC3339, message.Metadata)
+			if err != nil {
+				log.Printf("ERROR: Invalid ban end %q: %v", message.Metadata, err)
+				return nil
+			}
+			content = fmt.Sprintf(content, timefmt.In(user.Language, time.Until(end)))
+		}
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		return msg
+	case "system_delivery_failed":
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		if message.TgMessageIDSender != nil {
+			return withReplyTo(msg, int(*message.TgMessageIDSender))
+		}
+		return msg
+	case "system_partner_banned", "system_partner_deleted", "system_partner_disconnected", "system_room_idle_closed":
+		c.RoomID = ""
+		msg := tgbotapi.NewMessage(chatID, content)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(c.Localizer.GetString(user.Language, "btn_search_again"), CallbackSearchAgain),
+			),
+		)
+		return msg
 	default:
 		log.Printf("Unhandled message type in buildTelegramMessage: %s", message.Type)
 		msg := tgbotapi.NewMessage(chatID, "⚠️ Unsupported message type.")
@@ -0,0 +1,278 @@
+package telegram
+
+import (
+	"chatgogo/backend/internal/chathub"
+	"chatgogo/backend/internal/localization"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestIsBotBlockedError(t *testing.T) {
+	blocked := &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+
+	assert.True(t, isBotBlockedError(blocked))
+	assert.True(t, isBotBlockedError(fmt.Errorf("send failed: %w", blocked)))
+	assert.False(t, isBotBlockedError(&tgbotapi.Error{Code: 429, Message: "Too Many Requests"}))
+	assert.False(t, isBotBlockedError(errors.New("connection reset")))
+}
+
+func TestSendErrorClass(t *testing.T) {
+	assert.Equal(t, "ok", sendErrorClass(nil))
+	assert.Equal(t, "rate_limited", sendErrorClass(&tgbotapi.Error{Code: 429}))
+	assert.Equal(t, "forbidden", sendErrorClass(&tgbotapi.Error{Code: 403}))
+	assert.Equal(t, "bad_request", sendErrorClass(&tgbotapi.Error{Code: 400}))
+	assert.Equal(t, "server_error", sendErrorClass(&tgbotapi.Error{Code: 502}))
+	assert.Equal(t, "other", sendErrorClass(&tgbotapi.Error{Code: 404}))
+	assert.Equal(t, "network", sendErrorClass(errors.New("connection reset")))
+}
+
+func TestCallWithRetryHonoursRetryAfter(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	retriesBefore := rateLimitRetries.Value()
+	okBefore := sendResults.Value("ok")
+	throttled := &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 2}}
+
+	calls := 0
+	err := callWithRetry(func() error {
+		calls++
+		if calls < 3 {
+			return throttled
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second}, slept)
+	assert.Equal(t, retriesBefore+2, rateLimitRetries.Value())
+	assert.Equal(t, okBefore+1, sendResults.Value("ok"))
+
+	// A call that stays throttled gives up after MaxRateLimitRetries.
+	calls = 0
+	err = callWithRetry(func() error { calls++; return throttled })
+	assert.ErrorIs(t, err, throttled)
+	assert.Equal(t, MaxRateLimitRetries+1, calls)
+}
+
+func TestCallWithRetryBacksOffOnTransientErrors(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	calls := 0
+	err := callWithRetry(func() error {
+		calls++
+		if calls < 3 {
+			return &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, slept)
+
+	// Errors that cannot go away, such as a blocked bot, are not retried.
+	calls = 0
+	err = callWithRetry(func() error { calls++; return &tgbotapi.Error{Code: 403} })
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	// A call that keeps failing gives up after MaxTransientRetries.
+	calls = 0
+	err = callWithRetry(func() error { calls++; return errors.New("connection reset") })
+	assert.Error(t, err)
+	assert.Equal(t, MaxTransientRetries+1, calls)
+}
+
+// deliveryStorage is the part of ClientStorage that writePump uses.
+type deliveryStorage struct {
+	ClientStorage
+	saved map[uint]int
+	// language is the language of the user, "en" if empty.
+	language string
+	// deleted makes the user unknown, as after their data was deleted.
+	deleted bool
+	// labs are the lab features the user opted into.
+	labs []string
+}
+
+func (s *deliveryStorage) GetUserByID(userID string) (*models.User, error) {
+	if s.deleted {
+		return nil, gorm.ErrRecordNotFound
+	}
+	language := s.language
+	if language == "" {
+		language = "en"
+	}
+	return &models.User{ID: userID, Language: language, LabFeatures: s.labs}, nil
+}
+
+func (s *deliveryStorage) SaveTgMessageID(historyID uint, anonID string, tgMsgID int) error {
+	s.saved[historyID] = tgMsgID
+	return nil
+}
+
+// FindPartnerTelegramIDForReply knows the Telegram copy 42 of history entry 7.
+func (s *deliveryStorage) FindPartnerTelegramIDForReply(historyID uint, anonID string) (*int, error) {
+	if historyID != 7 {
+		return nil, nil
+	}
+	tgID := 42
+	return &tgID, nil
+}
+
+// fakeHub records the messages a client submits to the hub, and knows the given sessions.
+type fakeHub struct {
+	submitted chan models.ChatMessage
+	sessions  map[string][]chathub.Client
+}
+
+func newFakeHub() *fakeHub {
+	return &fakeHub{submitted: make(chan models.ChatMessage, 1)}
+}
+
+func (h *fakeHub) Register(chathub.Client)           { panic("unexpected Register") }
+func (h *fakeHub) Unregister(chathub.Client)         { panic("unexpected Unregister") }
+func (h *fakeHub) Submit(message models.ChatMessage) { h.submitted <- message }
+func (h *fakeHub) RequestMatch(userID string)        { panic("unexpected RequestMatch") }
+func (h *fakeHub) TouchPresence(userID string)       { panic("unexpected TouchPresence") }
+func (h *fakeHub) UserSessions(userID string) []chathub.Client {
+	return h.sessions[userID]
+}
+
+func newTestClient(t *testing.T, bot BotAPI) (*Client, *deliveryStorage) {
+	localizer, err := localization.NewLocalizer("../localization")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &deliveryStorage{saved: map[uint]int{}}
+	client := &Client{
+		UserID:    "user_A",
+		AnonID:    12345,
+		Hub:       newFakeHub(),
+		Send:      make(chan models.ChatMessage, 10),
+		BotAPI:    bot,
+		Storage:   store,
+		Localizer: localizer,
+	}
+	return client, store
+}
+
+func TestWritePumpDeliversPartnerMessages(t *testing.T) {
+	bot := newFakeBotAPI()
+	client, store := newTestClient(t, bot)
+
+	client.Send <- models.ChatMessage{ID: 7, Type: "text", Content: "hello", SenderID: "user_B"}
+	client.Send <- models.ChatMessage{Type: "text", Content: "echo", SenderID: "user_A"}
+	client.Close()
+	client.writePump()
+
+	sent := bot.sentMessages()
+	if assert.Len(t, sent, 1, "The client's own messages are not echoed back") {
+		assert.Equal(t, int64(12345), sent[0].ChatID)
+		assert.Equal(t, "hello", sent[0].Text)
+	}
+	assert.Equal(t, map[uint]int{7: 1}, store.saved)
+}
+
+func TestWritePumpStopsWhenBotIsBlocked(t *testing.T) {
+	bot := newFakeBotAPI()
+	bot.sendErr = &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+	client, _ := newTestClient(t, bot)
+	client.RoomID = "room1"
+
+	client.Send <- models.ChatMessage{Type: "system_info", Content: "system_search_start", SenderID: "system"}
+	client.Close()
+	client.writePump()
+
+	assert.True(t, client.botBlocked)
+	blocked := <-client.Hub.(*fakeHub).submitted
+	assert.Equal(t, "command_bot_blocked", blocked.Type)
+	assert.Equal(t, "room1", blocked.RoomID)
+}
+
+func TestWritePumpShowsPartnerTypingAsChatAction(t *testing.T) {
+	bot := newFakeBotAPI()
+	client, _ := newTestClient(t, bot)
+
+	client.Send <- models.ChatMessage{Type: "typing", RoomID: "room1", SenderID: "user_B"}
+	client.Close()
+	client.writePump()
+
+	assert.Empty(t, bot.sentMessages())
+	if assert.Len(t, bot.requests, 1) {
+		assert.Equal(t, tgbotapi.NewChatAction(12345, tgbotapi.ChatTyping), bot.requests[0])
+	}
+}
+
+func TestWritePumpSetsPartnerReactions(t *testing.T) {
+	bot := newFakeBotAPI()
+	client, _ := newTestClient(t, bot)
+	original := uint(7)
+
+	client.Send <- models.ChatMessage{Type: "reaction", Content: "❤️", ReplyToMessageID: &original, SenderID: "user_B"}
+	client.Send <- models.ChatMessage{Type: "reaction", ReplyToMessageID: &original, SenderID: "user_B"}
+	client.Close()
+	client.writePump()
+
+	assert.Empty(t, bot.sentMessages())
+	if assert.Len(t, bot.calls, 2) {
+		assert.Equal(t, "setMessageReaction", bot.calls[0].endpoint)
+		assert.Equal(t, tgbotapi.Params{"chat_id": "12345", "message_id": "42", "reaction": `[{"type":"emoji","emoji":"❤"}]`}, bot.calls[0].params)
+		assert.Equal(t, "[]", bot.calls[1].params["reaction"], "a reaction taken back is removed")
+	}
+}
+
+func TestBuildTelegramMessageShowsBanCountdown(t *testing.T) {
+	client, _ := newTestClient(t, newFakeBotAPI())
+	end := time.Now().Add(2*time.Hour - time.Second)
+
+	msg := client.buildTelegramMessage(12345, models.ChatMessage{
+		Type:     "system_banned",
+		Content:  "system_banned_until",
+		Metadata: end.Format(time.RFC3339),
+		SenderID: "system",
+	})
+
+	assert.Equal(t, "🚫 Your account has been banned for breaking the rules. You can chat again in 2 hours.", msg.(tgbotapi.MessageConfig).Text)
+}
+
+func TestBuildTelegramMessageKeepsLanguageOfDeletedUser(t *testing.T) {
+	client, store := newTestClient(t, newFakeBotAPI())
+	store.language = "ua"
+	client.buildTelegramMessage(12345, models.ChatMessage{Type: "system_info", Content: "system_search_cancelled", SenderID: "system"})
+
+	store.deleted = true
+	msg := client.buildTelegramMessage(12345, models.ChatMessage{Type: "system_info", Content: "system_data_deleted", SenderID: "system"})
+
+	assert.Equal(t, client.Localizer.GetString("ua", "system_data_deleted"), msg.(tgbotapi.MessageConfig).Text)
+}
+
+func TestWritePumpDeliversOnSendPool(t *testing.T) {
+	bot := newFakeBotAPI()
+	client, store := newTestClient(t, bot)
+	client.pool = NewSendPool(2)
+
+	for i := 1; i <= 5; i++ {
+		client.Send <- models.ChatMessage{ID: uint(i), Type: "text", Content: strconv.Itoa(i), SenderID: "user_B"}
+	}
+	client.Close()
+	client.writePump()
+
+	var texts []string
+	for _, msg := range bot.sentMessages() {
+		texts = append(texts, msg.Text)
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, texts, "the pump returns once its messages were delivered in order")
+	assert.Len(t, store.saved, 5)
+}
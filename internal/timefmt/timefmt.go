@@ -0,0 +1,137 @@
+// Package timefmt formats durations and timestamps shown to users, such as ban countdowns
+// and wait estimates, as humanized strings in their language ("in 2 hours", "через 2
+// години") instead of Go's default formats ("2h0m0s"). Unknown languages fall back to
+// English.
+package timefmt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// unit is a unit of time with its forms in one language.
+type unit struct {
+	size time.Duration
+	// forms are the forms of the unit after a number, indexed by pluralForm.
+	forms [3]string
+}
+
+// language holds how durations and dates are written in one language.
+type language struct {
+	second, minute, hour, day unit
+	// in is the format of a point in time that far in the future ("in %s").
+	in string
+	// months are the month names as used in dates, January first.
+	months [12]string
+	// plural picks the form of a unit after the number n.
+	plural func(n int) int
+}
+
+// englishPlural picks "1 hour" or "2 hours".
+func englishPlural(n int) int {
+	if n == 1 {
+		return 0
+	}
+	return 1
+}
+
+// slavicPlural picks the Russian and Ukrainian form after a number: "1 година",
+// "2 години", "5 годин".
+func slavicPlural(n int) int {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// languages holds the supported languages by code. The Russian and Ukrainian forms are in
+// the accusative case, which fits after "через", "на" and "примерно".
+var languages = map[string]*language{
+	"en": {
+		second: unit{time.Second, [3]string{"second", "seconds", "seconds"}},
+		minute: unit{time.Minute, [3]string{"minute", "minutes", "minutes"}},
+		hour:   unit{time.Hour, [3]string{"hour", "hours", "hours"}},
+		day:    unit{24 * time.Hour, [3]string{"day", "days", "days"}},
+		in:     "in %s",
+		months: [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		plural: englishPlural,
+	},
+	"ru": {
+		second: unit{time.Second, [3]string{"секунду", "секунды", "секунд"}},
+		minute: unit{time.Minute, [3]string{"минуту", "минуты", "минут"}},
+		hour:   unit{time.Hour, [3]string{"час", "часа", "часов"}},
+		day:    unit{24 * time.Hour, [3]string{"день", "дня", "дней"}},
+		in:     "через %s",
+		months: [12]string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"},
+		plural: slavicPlural,
+	},
+	"ua": {
+		second: unit{time.Second, [3]string{"секунду", "секунди", "секунд"}},
+		minute: unit{time.Minute, [3]string{"хвилину", "хвилини", "хвилин"}},
+		hour:   unit{time.Hour, [3]string{"годину", "години", "годин"}},
+		day:    unit{24 * time.Hour, [3]string{"день", "дні", "днів"}},
+		in:     "через %s",
+		months: [12]string{"січня", "лютого", "березня", "квітня", "травня", "червня", "липня", "серпня", "вересня", "жовтня", "листопада", "грудня"},
+		plural: slavicPlural,
+	},
+}
+
+// lookup returns the language with the given code, or English.
+func lookup(lang string) *language {
+	if l, ok := languages[lang]; ok {
+		return l
+	}
+	return languages["en"]
+}
+
+// count writes n of a unit, e.g. "2 hours".
+func (l *language) count(n int, u unit) string {
+	return fmt.Sprintf("%d %s", n, u.forms[l.plural(n)])
+}
+
+// Duration returns d in words, in at most two units and rounded up, so that a countdown
+// never promises less than is left: "45 seconds", "3 minutes", "1 hour 30 minutes",
+// "2 days 4 hours". Durations under a second are shown as one second.
+func Duration(lang string, d time.Duration) string {
+	l := lookup(lang)
+	if d < time.Minute {
+		return l.count(max(ceil(d, time.Second), 1), l.second)
+	}
+	if d < time.Hour {
+		return l.count(ceil(d, time.Minute), l.minute)
+	}
+
+	major, minor := l.hour, l.minute
+	if d >= l.day.size {
+		major, minor = l.day, l.hour
+	}
+	total := ceil(d, minor.size)
+	perMajor := int(major.size / minor.size)
+	parts := []string{l.count(total/perMajor, major)}
+	if rest := total % perMajor; rest > 0 {
+		parts = append(parts, l.count(rest, minor))
+	}
+	return strings.Join(parts, " ")
+}
+
+// In returns when something happens d from now: "in 2 hours", "через 2 години".
+func In(lang string, d time.Duration) string {
+	return fmt.Sprintf(lookup(lang).in, Duration(lang, d))
+}
+
+// Date returns t as a day and time of day in its own location: "23 October 2026, 15:04",
+// "23 жовтня 2026, 15:04".
+func Date(lang string, t time.Time) string {
+	l := lookup(lang)
+	return fmt.Sprintf("%d %s %d, %s", t.Day(), l.months[t.Month()-1], t.Year(), t.Format("15:04"))
+}
+
+// ceil returns d in whole units, rounded up.
+func ceil(d, unit time.Duration) int {
+	return int((d + unit - 1) / unit)
+}
@@ -0,0 +1,49 @@
+package timefmt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		lang string
+		d    time.Duration
+		want string
+	}{
+		{"en", 0, "1 second"},
+		{"en", 45 * time.Second, "45 seconds"},
+		{"en", time.Minute, "1 minute"},
+		{"en", 61 * time.Second, "2 minutes"},
+		{"en", 90 * time.Minute, "1 hour 30 minutes"},
+		{"en", 2 * time.Hour, "2 hours"},
+		{"en", 7 * 24 * time.Hour, "7 days"},
+		{"en", 26*time.Hour + time.Minute, "1 day 3 hours"},
+		{"ua", 2 * time.Hour, "2 години"},
+		{"ua", 5 * time.Hour, "5 годин"},
+		{"ua", 21 * time.Minute, "21 хвилину"},
+		{"ua", 12 * time.Minute, "12 хвилин"},
+		{"ru", 22 * time.Hour, "22 часа"},
+		{"ru", 11 * 24 * time.Hour, "11 дней"},
+		{"ru", 3*time.Hour + 31*time.Minute, "3 часа 31 минуту"},
+		{"de", time.Hour, "1 hour"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Duration(tt.lang, tt.d), "%s %v", tt.lang, tt.d)
+	}
+}
+
+func TestIn(t *testing.T) {
+	assert.Equal(t, "in 2 minutes", In("en", 2*time.Minute))
+	assert.Equal(t, "через 2 години", In("ua", 2*time.Hour))
+	assert.Equal(t, "через 7 дней", In("ru", 7*24*time.Hour))
+}
+
+func TestDate(t *testing.T) {
+	at := time.Date(2026, time.October, 23, 15, 4, 0, 0, time.UTC)
+	assert.Equal(t, "23 October 2026, 15:04", Date("en", at))
+	assert.Equal(t, "23 жовтня 2026, 15:04", Date("ua", at))
+	assert.Equal(t, "23 октября 2026, 15:04", Date("ru", at))
+}
@@ -0,0 +1,252 @@
+// Package transcript defines the versioned JSONL format of exported chat transcripts.
+// Every export (archival, GDPR export, admin export and self-export) writes this format,
+// so transcripts can be read back by one reader whatever produced them.
+//
+// A transcript is a JSON Lines stream: the first line is a Header, every following line
+// is one Message in the order it was sent. Readers ignore unknown fields, so new optional
+// fields can be added without a version bump; incompatible changes increment Version.
+package transcript
+
+import (
+	"bufio"
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Format identifies a chatgogo transcript in the header.
+	Format = "chatgogo.transcript"
+	// Version is the current format version. Readers reject transcripts with a newer version.
+	Version = 1
+)
+
+// Export purposes recorded in the header.
+const (
+	PurposeArchive = "archive"
+	PurposeGDPR    = "gdpr"
+	PurposeAdmin   = "admin"
+	PurposeSelf    = "self"
+)
+
+// maxLineSize bounds a single transcript line, which holds at most one message.
+const maxLineSize = 1 << 20
+
+var (
+	// ErrNotTranscript is returned when a stream does not start with a transcript header.
+	ErrNotTranscript = errors.New("transcript: not a chatgogo transcript")
+	// ErrUnsupportedVersion is returned for transcripts written by a newer format version.
+	ErrUnsupportedVersion = errors.New("transcript: unsupported format version")
+)
+
+// Header is the first line of a transcript and describes the exported room.
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Purpose is the export that produced the transcript (e.g., PurposeGDPR).
+	Purpose string `json:"purpose"`
+	RoomID  string `json:"room_id"`
+	// Participants are the anonymous IDs of the room participants, or their pseudonyms.
+	Participants []string `json:"participants"`
+	// Pseudonymized reports whether the user IDs of the transcript were replaced with
+	// pseudonyms of this export (see package anonymize).
+	Pseudonymized bool       `json:"pseudonymized,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	ExportedAt    time.Time  `json:"exported_at"`
+}
+
+// Message is one transcript line: a message of the room as it was stored.
+type Message struct {
+	ID       uint   `json:"id"`
+	SenderID string `json:"sender_id"`
+	Type     string `json:"type"`
+	// Content is the text, or the Telegram file ID of media.
+	Content string `json:"content"`
+	// Metadata is the caption of media.
+	Metadata string `json:"metadata,omitempty"`
+	// MediaURL is the URL of the re-hosted copy of media, if it was re-hosted.
+	MediaURL string `json:"media_url,omitempty"`
+	// Media describes the attached file of media, if it is known.
+	Media     *models.MediaInfo `json:"media,omitempty"`
+	ReplyToID *uint             `json:"reply_to_id,omitempty"`
+	SentAt    time.Time         `json:"sent_at"`
+}
+
+// NewHeader builds the header of a transcript of a room, exported now for the given purpose.
+func NewHeader(room models.ChatRoom, purpose string, now time.Time) Header {
+	header := Header{
+		Purpose:      purpose,
+		RoomID:       room.RoomID,
+		Participants: []string{room.User1ID, room.User2ID},
+		StartedAt:    room.StartedAt,
+		ExportedAt:   now,
+	}
+	if !room.IsActive && !room.EndedAt.IsZero() {
+		endedAt := room.EndedAt
+		header.EndedAt = &endedAt
+	}
+	return header
+}
+
+// MessageFromHistory converts a stored history entry into a transcript message.
+func MessageFromHistory(history models.ChatHistory) Message {
+	return Message{
+		ID:        history.ID,
+		SenderID:  history.SenderID,
+		Type:      history.Type,
+		Content:   history.Content,
+		Metadata:  history.Metadata,
+		MediaURL:  history.MediaURL,
+		Media:     history.AttachedMedia(),
+		ReplyToID: history.ReplyToMessageID,
+		SentAt:    history.CreatedAt,
+	}
+}
+
+// Writer writes a transcript to an underlying stream.
+type Writer struct {
+	enc *json.Encoder
+	// ids pseudonymizes the sender IDs of the messages, if set.
+	ids *anonymize.Mapping
+}
+
+// NewWriter writes the header to w and returns a Writer for the messages. Format and
+// Version in the header are set by the writer.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.Format, header.Version = Format, Version
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("transcript: failed to write header: %w", err)
+	}
+	return &Writer{enc: enc}, nil
+}
+
+// NewAnonymizedWriter is NewWriter, but replaces the participants and the senders of the
+// messages with their pseudonyms in ids, so that the transcript holds no user IDs.
+func NewAnonymizedWriter(w io.Writer, header Header, ids *anonymize.Mapping) (*Writer, error) {
+	header.Participants = ids.IDs(header.Participants)
+	header.Pseudonymized = true
+	tw, err := NewWriter(w, header)
+	if err != nil {
+		return nil, err
+	}
+	tw.ids = ids
+	return tw, nil
+}
+
+// Write appends a message to the transcript.
+func (w *Writer) Write(message Message) error {
+	if w.ids != nil {
+		message.SenderID = w.ids.ID(message.SenderID)
+	}
+	if err := w.enc.Encode(message); err != nil {
+		return fmt.Errorf("transcript: failed to write message %d: %w", message.ID, err)
+	}
+	return nil
+}
+
+// Encode writes a whole transcript of the given history.
+func Encode(w io.Writer, header Header, history []models.ChatHistory) error {
+	tw, err := NewWriter(w, header)
+	if err != nil {
+		return err
+	}
+	return tw.writeHistory(history)
+}
+
+// EncodeAnonymized writes a whole transcript of the given history with pseudonyms instead of
+// user IDs, see NewAnonymizedWriter.
+func EncodeAnonymized(w io.Writer, header Header, history []models.ChatHistory, ids *anonymize.Mapping) error {
+	tw, err := NewAnonymizedWriter(w, header, ids)
+	if err != nil {
+		return err
+	}
+	return tw.writeHistory(history)
+}
+
+// writeHistory appends the messages of a stored history.
+func (w *Writer) writeHistory(history []models.ChatHistory) error {
+	for _, entry := range history {
+		if err := w.Write(MessageFromHistory(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader reads a transcript from an underlying stream.
+type Reader struct {
+	scanner *bufio.Scanner
+	header  Header
+	line    int
+}
+
+// NewReader reads and validates the header of a transcript.
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	tr := &Reader{scanner: scanner}
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("transcript: failed to read header: %w", err)
+		}
+		return nil, ErrNotTranscript
+	}
+	tr.line = 1
+	if err := json.Unmarshal(scanner.Bytes(), &tr.header); err != nil || tr.header.Format != Format {
+		return nil, ErrNotTranscript
+	}
+	if tr.header.Version < 1 || tr.header.Version > Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, tr.header.Version)
+	}
+	return tr, nil
+}
+
+// Header returns the transcript header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next message. It returns io.EOF after the last message.
+func (r *Reader) Next() (Message, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		var message Message
+		if err := json.Unmarshal(r.scanner.Bytes(), &message); err != nil {
+			return Message{}, fmt.Errorf("transcript: invalid message on line %d: %w", r.line, err)
+		}
+		return message, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Message{}, fmt.Errorf("transcript: failed to read line %d: %w", r.line+1, err)
+	}
+	return Message{}, io.EOF
+}
+
+// Decode reads a whole transcript.
+func Decode(r io.Reader) (Header, []Message, error) {
+	tr, err := NewReader(r)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	var messages []Message
+	for {
+		message, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return tr.Header(), messages, nil
+		}
+		if err != nil {
+			return tr.Header(), messages, err
+		}
+		messages = append(messages, message)
+	}
+}
@@ -0,0 +1,113 @@
+package transcript
+
+import (
+	"bytes"
+	"chatgogo/backend/internal/anonymize"
+	"chatgogo/backend/internal/models"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRoundTrip(t *testing.T) {
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	ended := started.Add(10 * time.Minute)
+	room := models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B", StartedAt: started, EndedAt: ended}
+	replyTo := uint(1)
+	history := []models.ChatHistory{
+		{Model: gorm.Model{ID: 1, CreatedAt: started.Add(time.Minute)}, RoomID: "room1", SenderID: "user_A", Type: "text", Content: "hi\nthere"},
+		{Model: gorm.Model{ID: 2, CreatedAt: started.Add(2 * time.Minute)}, RoomID: "room1", SenderID: "user_B", Type: "photo",
+			Content: "file_id", Metadata: "caption", ReplyToMessageID: &replyTo,
+			Media: models.MediaInfo{FileSize: 52000, Width: 1280, Height: 720}},
+	}
+	exported := ended.Add(time.Hour)
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, NewHeader(room, PurposeSelf, exported), history))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"), "one header line and one line per message")
+
+	header, messages, err := Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, Header{
+		Format:       Format,
+		Version:      Version,
+		Purpose:      PurposeSelf,
+		RoomID:       "room1",
+		Participants: []string{"user_A", "user_B"},
+		StartedAt:    started,
+		EndedAt:      &ended,
+		ExportedAt:   exported,
+	}, header)
+	require.Len(t, messages, 2)
+	assert.Equal(t, MessageFromHistory(history[0]), messages[0])
+	assert.Equal(t, MessageFromHistory(history[1]), messages[1])
+	assert.Equal(t, &replyTo, messages[1].ReplyToID)
+	assert.Nil(t, messages[0].Media, "text has no media details")
+	assert.Equal(t, &models.MediaInfo{FileSize: 52000, Width: 1280, Height: 720}, messages[1].Media)
+}
+
+func TestEncodeAnonymized(t *testing.T) {
+	room := models.ChatRoom{RoomID: "room1", User1ID: "user_A", User2ID: "user_B"}
+	history := []models.ChatHistory{
+		{Model: gorm.Model{ID: 1}, SenderID: "user_A", Type: "text", Content: "hi"},
+		{Model: gorm.Model{ID: 2}, SenderID: "system", Type: "system_info", Content: "bye"},
+	}
+	ids := anonymize.NewMapping(anonymize.NewHMAC([]byte("key")), "export-1")
+
+	var buf bytes.Buffer
+	require.NoError(t, EncodeAnonymized(&buf, NewHeader(room, PurposeAdmin, time.Now()), history, ids))
+	assert.NotContains(t, buf.String(), "user_A")
+	assert.NotContains(t, buf.String(), "user_B")
+
+	header, messages, err := Decode(&buf)
+	require.NoError(t, err)
+	assert.True(t, header.Pseudonymized)
+	assert.Equal(t, []string{ids.ID("user_A"), ids.ID("user_B")}, header.Participants)
+	require.Len(t, messages, 2)
+	assert.Equal(t, header.Participants[0], messages[0].SenderID)
+	assert.Equal(t, "system", messages[1].SenderID)
+}
+
+func TestActiveRoomHasNoEndTime(t *testing.T) {
+	header := NewHeader(models.ChatRoom{RoomID: "room1", IsActive: true}, PurposeAdmin, time.Now())
+	assert.Nil(t, header.EndedAt)
+}
+
+func TestReaderIgnoresUnknownFields(t *testing.T) {
+	input := `{"format":"chatgogo.transcript","version":1,"room_id":"room1","added_later":true}` + "\n" +
+		"\n" +
+		`{"id":7,"sender_id":"user_A","type":"text","content":"hello","reactions":["👍"]}` + "\n"
+
+	header, messages, err := Decode(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, "room1", header.RoomID)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "hello", messages[0].Content)
+}
+
+func TestReaderRejectsUnknownStreams(t *testing.T) {
+	_, err := NewReader(strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrNotTranscript)
+
+	_, err = NewReader(strings.NewReader(`{"format":"other","version":1}` + "\n"))
+	assert.ErrorIs(t, err, ErrNotTranscript)
+
+	_, err = NewReader(strings.NewReader(`{"format":"chatgogo.transcript","version":2}` + "\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestReaderReportsInvalidLines(t *testing.T) {
+	input := `{"format":"chatgogo.transcript","version":1}` + "\n" + "not json\n"
+
+	tr, err := NewReader(strings.NewReader(input))
+	require.NoError(t, err)
+	_, err = tr.Next()
+	assert.ErrorContains(t, err, "line 2")
+	assert.False(t, errors.Is(err, io.EOF))
+}